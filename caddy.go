@@ -38,12 +38,15 @@ import (
 	"log"
 	"net"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddylog"
 	"github.com/mholt/caddy/telemetry"
 )
 
@@ -122,6 +125,27 @@ type Instance struct {
 	// to access this value safely
 	Storage   map[interface{}]interface{}
 	StorageMu sync.RWMutex
+
+	// loadTimings records how long loading the config took
+	loadTimings *LoadTimings
+
+	// serverBlocks are the server blocks parsed from the
+	// Caddyfile, to tell what a restart changes
+	serverBlocks []caddyfile.ServerBlock
+
+	// blockSetups are the callbacks registered by setting
+	// up each server block, keyed by the block's keys
+	blockSetups map[string]*serverBlockSetup
+
+	// previous is the instance this one replaces while it
+	// starts, and reused are the keys of the server blocks
+	// it took over from previous
+	previous *Instance
+	reused   []string
+
+	// changes describes how the restart that started this
+	// instance changed the server blocks, if there was one
+	changes *ServerBlockChanges
 }
 
 // Instances returns the list of instances.
@@ -154,6 +178,8 @@ func (i *Instance) Stop() error {
 	}
 	instancesMu.Unlock()
 
+	EmitEvent(InstanceShutdownEvent, i)
+
 	return nil
 }
 
@@ -180,9 +206,12 @@ func (i *Instance) ShutdownCallbacks() []error {
 
 // Restart replaces the servers in i with new servers created from
 // executing the newCaddyfile. Upon success, it returns the new
-// instance to replace i. Upon failure, i will not be replaced.
+// instance to replace i. Upon failure, i will not be replaced:
+// whatever the new instance acquired before failing is released,
+// and i keeps serving with its configuration as if the restart
+// was never attempted.
 func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
-	log.Println("[INFO] Reloading")
+	caddylog.Info("Reloading", "server_type", i.serverType)
 
 	i.wg.Add(1)
 	defer i.wg.Done()
@@ -198,7 +227,7 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 				}
 			}
 			if err != nil {
-				log.Printf("[ERROR] Restart failed: %v", err)
+				caddylog.Error("Restart failed; keeping the previous configuration", "error", err)
 			}
 			if r != nil {
 				log.Printf("[PANIC] Restart: %v", r)
@@ -217,7 +246,6 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 	if newCaddyfile == nil {
 		newCaddyfile = i.caddyfileInput
 	}
-
 	// Add file descriptors of all the sockets that are capable of it
 	restartFds := make(map[string]restartTriple)
 	for _, s := range i.servers {
@@ -241,34 +269,70 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 	}
 
 	// create new instance; if the restart fails, it is simply discarded
-	newInst := &Instance{serverType: newCaddyfile.ServerType(), wg: i.wg, Storage: make(map[interface{}]interface{})}
+	newInst := &Instance{serverType: newCaddyfile.ServerType(), wg: i.wg, Storage: make(map[interface{}]interface{}), previous: i}
 
 	// attempt to start new instance
 	err = startWithListenerFds(newCaddyfile, newInst, restartFds)
+	newInst.previous = nil
 	if err != nil {
+		newInst.discard()
 		return i, fmt.Errorf("starting with listener file descriptors: %v", err)
 	}
 
-	// success! stop the old instance
-	err = i.Stop()
-	if err != nil {
-		return i, err
+	// success! the server blocks taken over belong to the new
+	// instance now, so stopping the old one leaves them alone;
+	// from here on the new instance is serving, so failures no
+	// longer undo the restart
+	for _, setup := range newInst.blockSetups {
+		setup.setOwner(newInst)
+	}
+	if err := i.Stop(); err != nil {
+		log.Printf("[ERROR] Stopping previous instance: %v", err)
 	}
 	for _, shutdownFunc := range i.OnShutdown {
-		err = shutdownFunc()
-		if err != nil {
-			return i, err
+		if err := shutdownFunc(); err != nil {
+			log.Printf("[ERROR] Shutdown callback of previous instance: %v", err)
 		}
 	}
 
+	newInst.changes = serverBlockChanges(i.serverBlocks, newInst.serverBlocks, newInst.reused)
+	caddylog.Info("Caddyfile changes", "added", newInst.changes.Added, "changed", newInst.changes.Changed,
+		"removed", newInst.changes.Removed, "reused", len(newInst.changes.Reused),
+		"unchanged", len(newInst.changes.Unchanged))
+
 	// Execute instantiation events
 	EmitEvent(InstanceStartupEvent, newInst)
 
-	log.Println("[INFO] Reloading complete")
+	reused, compiledNew := compiled.commit()
+	caddylog.Info("Reloading complete", "reused_artifacts", reused, "compiled_artifacts", compiledNew)
 
 	return newInst, nil
 }
 
+// discard releases what i acquired while failing to start as
+// the replacement of another instance: the listeners it opened
+// and whatever its setup functions allocated. None of its servers
+// are serving yet, since startServers serves only once every
+// server is listening. The listeners taken over from the other
+// instance are duplicates of its own, so closing them leaves
+// the other instance unaffected.
+func (i *Instance) discard() {
+	for _, s := range i.servers {
+		if s.listener != nil {
+			s.listener.Close()
+		}
+		if s.packet != nil {
+			s.packet.Close()
+		}
+	}
+	i.servers = nil
+	for _, shutdownFunc := range i.OnShutdown {
+		if err := shutdownFunc(); err != nil {
+			log.Printf("[ERROR] Shutdown callback of discarded instance: %v", err)
+		}
+	}
+}
+
 // SaveServer adds s and its associated listener ln to the
 // internally-kept list of servers that is running. For
 // saved servers, graceful restarts will be provided.
@@ -474,6 +538,7 @@ func Start(cdyfile Input) (*Instance, error) {
 	if err != nil {
 		return inst, err
 	}
+	compiled.commit()
 	signalSuccessToParent()
 	if pidErr := writePidFile(); pidErr != nil {
 		log.Printf("[ERROR] Could not write pidfile: %v", pidErr)
@@ -486,6 +551,10 @@ func Start(cdyfile Input) (*Instance, error) {
 }
 
 func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]restartTriple) error {
+	// artifacts compiled while loading this config are
+	// tracked separately from those of the previous load
+	compiled.begin()
+
 	// save this instance in the list now so that
 	// plugins can access it if need be, for example
 	// the caddytls package, so it can perform cert
@@ -517,11 +586,15 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 	if err != nil {
 		return err
 	}
+	EmitEvent(ConfigLoadEvent, cdyfile)
 
+	start := time.Now()
 	slist, err := inst.context.MakeServers()
 	if err != nil {
 		return err
 	}
+	inst.loadTimings.MakeServers = time.Since(start)
+	logLoadTimings(inst)
 
 	// run startup callbacks
 	if !IsUpgrade() && restartFds == nil {
@@ -575,6 +648,24 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 	return nil
 }
 
+// DescribeSites validates cdyfile like ValidateAndExecuteDirectives
+// does, then returns the addresses of its sites keyed by the listener
+// address they would be served on. Nothing is started, and parse
+// callbacks are not executed. The server type's Context must
+// implement SiteDescriber.
+func DescribeSites(cdyfile Input) (map[string][]string, error) {
+	inst := &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup), Storage: make(map[interface{}]interface{})}
+	err := ValidateAndExecuteDirectives(cdyfile, inst, true)
+	if err != nil {
+		return nil, err
+	}
+	describer, ok := inst.context.(SiteDescriber)
+	if !ok {
+		return nil, fmt.Errorf("server type %s cannot describe its sites", cdyfile.ServerType())
+	}
+	return describer.DescribeSites()
+}
+
 // ValidateAndExecuteDirectives will load the server blocks from cdyfile
 // by parsing it, then execute the directives configured by it and store
 // the resulting server blocks into inst. If justValidate is true, parse
@@ -582,7 +673,7 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 // is only to check the input for valid syntax.
 func ValidateAndExecuteDirectives(cdyfile Input, inst *Instance, justValidate bool) error {
 	// If parsing only inst will be nil, create an instance for this function call only.
-	if justValidate {
+	if justValidate && inst == nil {
 		inst = &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup), Storage: make(map[interface{}]interface{})}
 	}
 
@@ -592,76 +683,88 @@ func ValidateAndExecuteDirectives(cdyfile Input, inst *Instance, justValidate bo
 	if err != nil {
 		return err
 	}
+	dirs, err := DirectiveOrder(stypeName)
+	if err != nil {
+		return err
+	}
 
 	inst.caddyfileInput = cdyfile
+	inst.loadTimings = new(LoadTimings)
 
+	start := time.Now()
 	sblocks, err := loadServerBlocks(stypeName, cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
 	if err != nil {
 		return err
 	}
+	inst.loadTimings.Parse = time.Since(start)
+	inst.serverBlocks = sblocks
 
 	inst.context = stype.NewContext(inst)
 	if inst.context == nil {
 		return fmt.Errorf("server type %s produced a nil Context", stypeName)
 	}
 
+	start = time.Now()
 	sblocks, err = inst.context.InspectServerBlocks(cdyfile.Path(), sblocks)
 	if err != nil {
 		return fmt.Errorf("error inspecting server blocks: %v", err)
 	}
+	inst.loadTimings.Inspect = time.Since(start)
 
 	telemetry.Set("num_server_blocks", len(sblocks))
 
-	return executeDirectives(inst, cdyfile.Path(), stype.Directives(), sblocks, justValidate)
+	// the blocks taken over from the instance being
+	// replaced are not set up again
+	if !justValidate {
+		sblocks = reuseServerBlocks(inst, sblocks)
+	}
+
+	start = time.Now()
+	err = executeDirectives(inst, cdyfile.Path(), dirs, sblocks, justValidate)
+	inst.loadTimings.Setup = time.Since(start)
+	if justValidate {
+		logLoadTimings(inst)
+	}
+	return err
 }
 
 func executeDirectives(inst *Instance, filename string,
 	directives []string, sblocks []caddyfile.ServerBlock, justValidate bool) error {
+	// event hooks registered from here on belong to this config
+	atomic.AddInt32(&settingUp, 1)
+	defer atomic.AddInt32(&settingUp, -1)
+
 	// map of server block ID to map of directive name to whatever.
 	storages := make(map[int]map[string]interface{})
 
+	timings := inst.loadTimings
+	if timings == nil {
+		timings = new(LoadTimings)
+		inst.loadTimings = timings
+	}
+	timings.ServerBlocks = make([]ServerBlockTiming, len(sblocks))
+	for i, sb := range sblocks {
+		storages[i] = make(map[string]interface{})
+		timings.ServerBlocks[i].Keys = sb.Keys
+	}
+
 	// It is crucial that directives are executed in the proper order.
 	// We loop with the directives on the outer loop so we execute
 	// a directive for all server blocks before going to the next directive.
 	// This is important mainly due to the parsing callbacks (below).
 	for _, dir := range directives {
-		for i, sb := range sblocks {
-			var once sync.Once
-			if _, ok := storages[i]; !ok {
-				storages[i] = make(map[string]interface{})
+		start := time.Now()
+		if directiveIsConcurrent(inst.serverType, dir) {
+			if err := executeDirectiveConcurrently(inst, filename, dir, sblocks, storages); err != nil {
+				return err
 			}
-
-			for j, key := range sb.Keys {
-				// Execute directive if it is in the server block
-				if tokens, ok := sb.Tokens[dir]; ok {
-					controller := &Controller{
-						instance:  inst,
-						Key:       key,
-						Dispenser: caddyfile.NewDispenserTokens(filename, tokens),
-						OncePerServerBlock: func(f func() error) error {
-							var err error
-							once.Do(func() {
-								err = f()
-							})
-							return err
-						},
-						ServerBlockIndex:    i,
-						ServerBlockKeyIndex: j,
-						ServerBlockKeys:     sb.Keys,
-						ServerBlockStorage:  storages[i][dir],
-					}
-
-					setup, err := DirectiveAction(inst.serverType, dir)
-					if err != nil {
-						return err
-					}
-
-					err = setup(controller)
-					if err != nil {
-						return err
-					}
-
-					storages[i][dir] = controller.ServerBlockStorage // persist for this server block
+		} else {
+			for i, sb := range sblocks {
+				var cb callbacks
+				err := executeDirective(inst, filename, dir, i, sb, storages[i], &cb)
+				inst.blockSetup(sb).register(inst, cb)
+				if err != nil {
+					return err
 				}
 			}
 		}
@@ -677,11 +780,124 @@ func executeDirectives(inst *Instance, filename string,
 				}
 			}
 		}
+
+		// only report directives that appear in the config
+		for _, sb := range sblocks {
+			if _, ok := sb.Tokens[dir]; ok {
+				timings.Directives = append(timings.Directives, DirectiveTiming{Directive: dir, Duration: time.Since(start)})
+				break
+			}
+		}
 	}
 
 	return nil
 }
 
+// executeDirective runs the setup function of directive dir for
+// every key of server block sb, which has index i. If pending is
+// not nil, callbacks registered by the setup function are stored
+// there rather than being added to inst.
+func executeDirective(inst *Instance, filename, dir string, i int, sb caddyfile.ServerBlock,
+	storage map[string]interface{}, pending *callbacks) error {
+	tokens, ok := sb.Tokens[dir]
+	if !ok {
+		return nil
+	}
+
+	setup, err := DirectiveAction(inst.serverType, dir)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	defer func() { inst.loadTimings.addServerBlockTime(i, time.Since(start)) }()
+
+	var once sync.Once
+	for j, key := range sb.Keys {
+		controller := &Controller{
+			instance:  inst,
+			Key:       key,
+			Dispenser: caddyfile.NewDispenserTokens(filename, tokens),
+			OncePerServerBlock: func(f func() error) error {
+				var err error
+				once.Do(func() {
+					err = f()
+				})
+				return err
+			},
+			ServerBlockIndex:    i,
+			ServerBlockKeyIndex: j,
+			ServerBlockKeys:     sb.Keys,
+			ServerBlockStorage:  storage[dir],
+			pending:             pending,
+			Directive:           dir,
+			tokens:              tokens,
+		}
+
+		err = setup(controller)
+		if err != nil {
+			return err
+		}
+		if observer, ok := inst.context.(SetupObserver); ok {
+			observer.DirectiveSetUp(controller)
+		}
+
+		storage[dir] = controller.ServerBlockStorage // persist for this server block
+	}
+
+	return nil
+}
+
+// executeDirectiveConcurrently is like running executeDirective
+// for each server block in order, except that up to GOMAXPROCS
+// server blocks are set up at once. Callbacks are added to inst
+// in server block order, and if setup fails for any server block,
+// the error of the first failing block is returned (and the
+// others are logged), so the outcome does not depend on timing.
+func executeDirectiveConcurrently(inst *Instance, filename, dir string,
+	sblocks []caddyfile.ServerBlock, storages map[int]map[string]interface{}) error {
+	errs := make([]error, len(sblocks))
+	pending := make([]callbacks, len(sblocks))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, sb := range sblocks {
+		if _, ok := sb.Tokens[dir]; !ok {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, sb caddyfile.ServerBlock) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = executeDirective(inst, filename, dir, i, sb, storages[i], &pending[i])
+		}(i, sb)
+	}
+	wg.Wait()
+
+	var firstErr error
+	for i := range sblocks {
+		if errs[i] == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = errs[i]
+		} else {
+			log.Printf("[ERROR] %v", errs[i])
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	for i, sb := range sblocks {
+		inst.blockSetup(sb).register(inst, pending[i])
+	}
+	return nil
+}
+
 func startServers(serverList []Server, inst *Instance, restartFds map[string]restartTriple) error {
 	errChan := make(chan error, len(serverList))
 
@@ -0,0 +1,131 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/chain"
+)
+
+// adminHandler returns the handler of the admin API, which
+// describes and reconfigures the running process:
+//
+//	GET /chain    the handler chain of every site, as JSON
+//	GET /timings  how long loading the config of every
+//	              running instance took, as JSON
+//	POST /reload  reload with the Caddyfile in the body;
+//	              sites it leaves unchanged keep their
+//	              state, and the changes are described
+//	              in the response, as JSON
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/chain", chain.AdminHandler())
+	mux.Handle("/timings", timingsHandler(caddy.Instances))
+	mux.Handle("/reload", reloadHandler(caddy.ReloadWith))
+	return mux
+}
+
+// maxReloadBody is the size limit of a Caddyfile posted
+// to the reload endpoint.
+const maxReloadBody = 10 << 20
+
+// reloadHandler reloads with the Caddyfile in the body of
+// POST requests and describes how the server blocks changed.
+type reloadHandler func(caddy.Input) (*caddy.ServerBlockChanges, error)
+
+func (h reloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReloadBody))
+	if err != nil {
+		http.Error(w, "reading Caddyfile: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		http.Error(w, "no Caddyfile in request body", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h(caddy.CaddyfileInput{
+		Contents:       body,
+		Filepath:       "admin API",
+		ServerTypeName: serverType,
+	})
+	if err != nil {
+		// the running config is kept
+		http.Error(w, "reload failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := json.MarshalIndent(changes, "", "\t")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(resp, '\n'))
+}
+
+// timingsHandler serves the load timings of the instances
+// it returns that have been loaded.
+type timingsHandler func() []*caddy.Instance
+
+func (h timingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	timings := []*caddy.LoadTimings{}
+	for _, inst := range h() {
+		if t := inst.LoadTimings(); t != nil {
+			timings = append(timings, t)
+		}
+	}
+	body, err := json.MarshalIndent(timings, "", "\t")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(body, '\n'))
+}
+
+// startAdmin serves the admin API on addr in the background.
+// The API has no authentication, so addr should be reachable
+// only by those allowed to inspect and change the
+// configuration, like a loopback address.
+func startAdmin(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("admin API: %v", err)
+	}
+	log.Printf("[INFO] Serving admin API on %s", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, adminHandler()); err != nil {
+			log.Printf("[ERROR] Admin API: %v", err)
+		}
+	}()
+	return nil
+}
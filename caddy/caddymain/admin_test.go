@@ -0,0 +1,157 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAdminHandler(t *testing.T) {
+	h := adminHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/chain", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected JSON from /chain, got status %d and %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Errorf("Expected no sites without running instances, got %s", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown endpoint, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestTimingsHandler(t *testing.T) {
+	inst, err := caddy.Start(caddy.CaddyfileInput{Contents: []byte("http://localhost:0\ngzip"), ServerTypeName: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Stop()
+	h := timingsHandler(func() []*caddy.Instance { return []*caddy.Instance{inst, {}} })
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/timings", nil))
+	var timings []*caddy.LoadTimings
+	if err := json.Unmarshal(rec.Body.Bytes(), &timings); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(timings) != 1 {
+		t.Fatalf("Expected the timings of the loaded instance only, got %d", len(timings))
+	}
+	if got := timings[0]; got.Parse <= 0 || len(got.ServerBlocks) != 1 || got.ServerBlocks[0].Keys[0] != "http://localhost:0" {
+		t.Errorf("Expected the timings of loading http://localhost:0, got %+v", got)
+	}
+	var gzip bool
+	for _, d := range timings[0].Directives {
+		gzip = gzip || d.Directive == "gzip"
+	}
+	if !gzip {
+		t.Errorf("Expected a timing for the gzip directive, got %+v", timings[0].Directives)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/timings", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	inst, err := caddy.Start(caddy.CaddyfileInput{
+		Contents:       []byte("http://localhost:0 {\ngzip\n}\nhttp://127.0.0.1:0 {\ngzip\n}"),
+		ServerTypeName: "http",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, inst := range caddy.Instances() {
+			inst.Stop()
+		}
+	}()
+	siteConfig := func(inst *caddy.Instance, host string) *httpserver.SiteConfig {
+		for _, cfg := range httpserver.InstanceSites(inst) {
+			if cfg.Addr.Host == host {
+				return cfg
+			}
+		}
+		t.Fatalf("Expected a site for %s", host)
+		return nil
+	}
+	unchanged, changed := siteConfig(inst, "localhost"), siteConfig(inst, "127.0.0.1")
+	h := reloadHandler(caddy.ReloadWith)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/reload",
+		strings.NewReader("http://localhost:0 {\ngzip\n}\nhttp://127.0.0.1:0 {\nheader / X-Test 1\n}")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var changes caddy.ServerBlockChanges
+	if err := json.Unmarshal(rec.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(changes.Reused, []string{"http://localhost:0"}) ||
+		!reflect.DeepEqual(changes.Changed, []string{"http://127.0.0.1:0"}) {
+		t.Errorf("Expected localhost to be reused and 127.0.0.1 to be changed, got %+v", changes)
+	}
+
+	instances := caddy.Instances()
+	if len(instances) != 1 || instances[0] == inst {
+		t.Fatalf("Expected the instance to be replaced, got %v", instances)
+	}
+	if siteConfig(instances[0], "localhost") != unchanged {
+		t.Error("Expected the unchanged site to keep its config")
+	}
+	if siteConfig(instances[0], "127.0.0.1") == changed {
+		t.Error("Expected the changed site to be set up again")
+	}
+
+	// a Caddyfile that fails to load leaves the running one
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/reload", strings.NewReader("http://localhost:0 {\nbogus\n}")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid Caddyfile, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if current := caddy.Instances(); len(current) != 1 || current[0] != instances[0] {
+		t.Error("Expected the running instance to be kept after a failed reload")
+	}
+
+	for _, test := range []struct {
+		method, body   string
+		expectedStatus int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", " \n", http.StatusBadRequest},
+	} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/reload", strings.NewReader(test.body)))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Expected status %d for %s %q, got %d", test.expectedStatus, test.method, test.body, rec.Code)
+		}
+	}
+}
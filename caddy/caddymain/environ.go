@@ -0,0 +1,117 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/certmagic"
+)
+
+// environVars are the environment variables that change
+// how Caddy runs, which -environ reports whether set or not.
+var environVars = []string{
+	"CADDYPATH",
+	"CADDY_CLUSTERING",
+	"HOME",
+	"GOMAXPROCS",
+	"GOGC",
+	"GOMEMLIMIT",
+	"GODEBUG",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+}
+
+// describeEnviron returns a report of the environment Caddy
+// would run in with input: where its configuration and data
+// come from, which sites it would serve on which listeners,
+// the relevant environment variables and the OS limits. It
+// does not start any servers or obtain certificates.
+func describeEnviron(input caddy.Input) (string, error) {
+	sites, err := caddy.DescribeSites(input)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Configuration:")
+	fmt.Fprintf(w, "  Server type\t%s\n", input.ServerType())
+	if files := caddyfileFiles(input); len(files) > 0 {
+		fmt.Fprintf(w, "  Caddyfile\t%s\n", files[0])
+		for _, file := range files[1:] {
+			fmt.Fprintf(w, "  Imported\t%s\n", file)
+		}
+	} else {
+		fmt.Fprintf(w, "  Caddyfile\t%s (not a file)\n", input.Path())
+	}
+
+	fmt.Fprintln(w, "Storage:")
+	fmt.Fprintf(w, "  Assets\t%s\n", caddy.AssetsPath())
+	if fs, ok := certmagic.Default.Storage.(*certmagic.FileStorage); ok {
+		fmt.Fprintf(w, "  Certificates\t%s\n", fs.Path)
+	} else {
+		fmt.Fprintf(w, "  Certificates\t%T\n", certmagic.Default.Storage)
+	}
+
+	fmt.Fprintln(w, "Listeners:")
+	addrs := make([]string, 0, len(sites))
+	for addr := range sites {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		for i, site := range sites[addr] {
+			if i == 0 {
+				fmt.Fprintf(w, "  %s\t%s\n", addr, site)
+			} else {
+				fmt.Fprintf(w, "  \t%s\n", site)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "Environment:")
+	for _, name := range environVars {
+		if val, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(w, "  %s\t%s\n", name, val)
+		} else {
+			fmt.Fprintf(w, "  %s\t(unset)\n", name)
+		}
+	}
+
+	fmt.Fprintln(w, "Limits:")
+	fmt.Fprintf(w, "  CPUs\t%d (GOMAXPROCS %d)\n", runtime.NumCPU(), runtime.GOMAXPROCS(0))
+	if cur, max, err := caddy.FileDescriptorLimit(); err == nil {
+		fmt.Fprintf(w, "  Open files\t%d (hard limit %d)\n", cur, max)
+	} else {
+		fmt.Fprintf(w, "  Open files\t%v\n", err)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestDescribeEnviron(t *testing.T) {
+	os.Setenv("CADDYPATH", os.TempDir())
+	defer os.Unsetenv("CADDYPATH")
+
+	input := caddy.CaddyfileInput{
+		Contents:       []byte("example.com {\n}\nhttp://localhost:8080 {\n}\n"),
+		Filepath:       "Caddyfile",
+		ServerTypeName: "http",
+	}
+	str, err := describeEnviron(input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// compare lines with their columns joined by single spaces
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(str, "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, want := range []string{
+		"Caddyfile Caddyfile (not a file)",
+		"Assets " + os.TempDir(),
+		":443 https://example.com",
+		":80 http://example.com",
+		":8080 http://localhost:8080",
+		"CADDYPATH " + os.TempDir(),
+		"CADDY_CLUSTERING (unset)",
+	} {
+		if !lines[want] {
+			t.Errorf("Expected line %q in:\n%s", want, str)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mholt/caddy/caddyhttp/basicauth"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// hashPassword reads a password from stdin, prompting for it
+// twice if stdin is a terminal, and returns it hashed in the
+// form the basicauth directive takes.
+func hashPassword() (string, error) {
+	var passw []byte
+	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		first, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprint(os.Stderr, "Confirm password: ")
+		second, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(first, second) {
+			return "", fmt.Errorf("passwords do not match")
+		}
+		passw = first
+	} else {
+		var err error
+		passw, err = readPasswordLine(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(passw) == 0 {
+		return "", fmt.Errorf("empty password")
+	}
+	return basicauth.HashPassword(passw)
+}
+
+// readPasswordLine returns the first line of r, without
+// its line ending, as the password.
+func readPasswordLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPasswordLine(t *testing.T) {
+	for i, test := range []struct {
+		input, expect string
+	}{
+		{"s3cret", "s3cret"},
+		{"s3cret\n", "s3cret"},
+		{"s3cret\r\nignored\n", "s3cret"},
+		{"with spaces \n", "with spaces "},
+		{"", ""},
+	} {
+		passw, err := readPasswordLine(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if string(passw) != test.expect {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expect, passw)
+		}
+	}
+}
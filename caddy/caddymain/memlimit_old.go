@@ -0,0 +1,25 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !go1.19
+
+package caddymain
+
+import "errors"
+
+// setRuntimeMemoryLimit fails because the Go runtime only
+// supports a soft memory limit since Go 1.19.
+func setRuntimeMemoryLimit(bytes int64) error {
+	return errors.New("memory limit requires Caddy to be built with Go 1.19 or newer")
+}
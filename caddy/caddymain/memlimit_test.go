@@ -0,0 +1,51 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.19
+
+package caddymain
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestSetMemoryLimit(t *testing.T) {
+	original := debug.SetMemoryLimit(-1)
+	defer debug.SetMemoryLimit(original)
+	for i, test := range []struct {
+		input     string
+		output    int64
+		shouldErr bool
+	}{
+		{"", original, false},
+		{"512MB", 512000000, false},
+		{"2GiB", 2 << 30, false},
+		{"1048576", 1048576, false},
+		{"0", original, true},
+		{"lots", original, true},
+	} {
+		debug.SetMemoryLimit(original)
+		err := setMemoryLimit(test.input)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, but there wasn't any", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, but there was one: %v", i, err)
+		}
+		if actual := debug.SetMemoryLimit(-1); actual != test.output {
+			t.Errorf("Test %d: Memory limit was %d but expected %d", i, actual, test.output)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+)
+
+// loadPluginFiles opens the Go plugins (.so files built with
+// -buildmode=plugin) in the comma-separated list files, which
+// run their init functions and so register with caddy like
+// plugins compiled in do. A directive of such a plugin that is
+// not in its server type's list must set After or Before on
+// its caddy.Plugin to be put in order.
+//
+// A plugin file must be built with the exact same Go toolchain,
+// build flags and versions of every module it shares with this
+// program, caddy included, or it fails to load. Go plugins are
+// only supported on some platforms, and only in programs built
+// with cgo. Plugins running as separate processes, which would
+// not have these limits, are not supported, and plugin files
+// can only be given on the command line since the Caddyfile
+// has no global options.
+func loadPluginFiles(files string) error {
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading plugin file: %v (plugin files must be built with the same Go toolchain and module versions as %s)",
+				err, filepath.Base(os.Args[0]))
+		}
+		log.Printf("[INFO] Loaded plugin file %s", path)
+	}
+	return nil
+}
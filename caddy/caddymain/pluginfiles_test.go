@@ -0,0 +1,38 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPluginFiles(t *testing.T) {
+	if err := loadPluginFiles(""); err != nil {
+		t.Errorf("Expected no error without plugin files, got: %v", err)
+	}
+	if err := loadPluginFiles(" , "); err != nil {
+		t.Errorf("Expected no error for an empty list, got: %v", err)
+	}
+	missing := filepath.Join("testdata", "nonexistent.so")
+	err := loadPluginFiles(missing)
+	if err == nil {
+		t.Fatalf("Expected an error loading %s", missing)
+	}
+	if !strings.Contains(err.Error(), "same Go toolchain and module versions") {
+		t.Errorf("Expected the error to explain how plugin files must be built, got: %v", err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -29,22 +30,24 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
 	"github.com/klauspost/cpuid"
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddylog"
 	"github.com/mholt/caddy/caddytls"
 	"github.com/mholt/caddy/telemetry"
 	"github.com/mholt/certmagic"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 
-	_ "github.com/mholt/caddy/caddyhttp" // plug in the HTTP server type
+	_ "github.com/mholt/caddy/caddyhttp"             // plug in the HTTP server type
+	_ "github.com/mholt/caddy/caddytls/redisstorage" // plug in shared storage for clusters
 	// This is where other plugins get plugged in (imported)
 )
 
 func init() {
-	caddy.TrapSignals()
-
+	flag.StringVar(&adminAddr, "admin", "", "Address to serve the admin API on, e.g. localhost:2019 (default off)")
 	flag.BoolVar(&certmagic.Default.Agreed, "agree", false, "Agree to the CA's Subscriber Agreement")
 	flag.StringVar(&certmagic.Default.CA, "ca", certmagic.Default.CA, "URL to certificate authority's ACME server directory")
 	flag.StringVar(&certmagic.Default.DefaultServerName, "default-sni", certmagic.Default.DefaultServerName, "If a ClientHello ServerName is empty, use this ServerName to choose a TLS certificate")
@@ -53,22 +56,35 @@ func init() {
 	flag.StringVar(&disabledMetrics, "disabled-metrics", "", "Comma-separated list of telemetry metrics to disable")
 	flag.StringVar(&conf, "conf", "", "Caddyfile to load (default \""+caddy.DefaultConfigFile+"\")")
 	flag.StringVar(&cpu, "cpu", "100%", "CPU cap")
+	flag.StringVar(&gcPercent, "gc-percent", "", "Garbage collection target percentage, or 'off' (overrides GOGC)")
+	flag.StringVar(&memoryLimit, "memory-limit", "", "Soft memory limit of the Go runtime, e.g. 512MB (overrides GOMEMLIMIT)")
 	flag.BoolVar(&printEnv, "env", false, "Enable to print environment variables")
+	flag.BoolVar(&environ, "environ", false, "Print the configuration, storage, listeners, environment and limits Caddy would run with, then exit")
 	flag.StringVar(&envFile, "envfile", "", "Path to file with environment variables to load in KEY=VALUE format")
 	flag.BoolVar(&fromJSON, "json-to-caddyfile", false, "From JSON stdin to Caddyfile stdout")
 	flag.BoolVar(&plugins, "plugins", false, "List installed plugins")
+	flag.StringVar(&pluginFiles, "plugin-files", "", "Comma-separated list of Go plugin (.so) files to load, built with the same Go toolchain and module versions as this program")
+	flag.BoolVar(&directives, "directives", false, "List the directives of the server type and the packages plugging them in")
+	flag.BoolVar(&buildInfo, "build-info", false, "Show version, Go version and the modules built in")
 	flag.StringVar(&certmagic.Default.Email, "email", "", "Default ACME CA account email address")
 	flag.DurationVar(&certmagic.HTTPTimeout, "catimeout", certmagic.HTTPTimeout, "Default ACME CA HTTP timeout")
+	flag.BoolVar(&hashPasswd, "hash-password", false, "Hash a password read from stdin for use with basicauth")
+	flag.StringVar(&localCARoot, "local-ca-root", "", "Write the root certificate of the local CA to this file (- for stdout), e.g. to trust it")
 	flag.StringVar(&logfile, "log", "", "Process log file")
+	flag.StringVar(&logLevel, "log-level", "info", "Least severe level of process log messages: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of process log messages: text or json")
 	flag.IntVar(&logRollMB, "log-roll-mb", 100, "Roll process log when it reaches this many megabytes (0 to disable rolling)")
 	flag.BoolVar(&logRollCompress, "log-roll-compress", true, "Gzip-compress rolled process log files")
 	flag.StringVar(&caddy.PidFile, "pidfile", "", "Path to write pid file")
 	flag.BoolVar(&caddy.Quiet, "quiet", false, "Quiet mode (no initialization output)")
 	flag.StringVar(&revoke, "revoke", "", "Hostname for which to revoke the certificate")
+	flag.BoolVar(&caddy.LogLoadTimings, "timings", false, "Log how long each phase, directive, and site took to load")
 	flag.StringVar(&serverType, "type", "http", "Type of server to run")
 	flag.BoolVar(&toJSON, "caddyfile-to-json", false, "From Caddyfile stdin to JSON stdout")
 	flag.BoolVar(&version, "version", false, "Show version")
 	flag.BoolVar(&validate, "validate", false, "Parse the Caddyfile but do not start the server")
+	flag.BoolVar(&watch, "watch", false, "Reload when the Caddyfile or files it imports change")
+	flag.IntVar(&workers, "workers", 0, "Experimental: run this many worker processes sharing listeners (requires SO_REUSEPORT)")
 
 	caddy.RegisterCaddyfileLoader("flag", caddy.LoaderFunc(confLoader))
 	caddy.SetDefaultCaddyfileLoader("default", caddy.LoaderFunc(defaultLoader))
@@ -78,6 +94,11 @@ func init() {
 func Run() {
 	flag.Parse()
 
+	// a supervisor of worker processes handles signals itself
+	if workers == 0 || os.Getenv(workerEnvVar) != "" {
+		caddy.TrapSignals()
+	}
+
 	module := getBuildModule()
 	cleanModVersion := strings.TrimPrefix(module.Version, "v")
 
@@ -86,22 +107,23 @@ func Run() {
 	certmagic.UserAgent = appName + "/" + cleanModVersion
 
 	// Set up process log before anything bad happens
+	var logOut io.Writer
 	switch logfile {
 	case "stdout":
-		log.SetOutput(os.Stdout)
+		logOut = os.Stdout
 	case "stderr":
-		log.SetOutput(os.Stderr)
+		logOut = os.Stderr
 	case "":
-		log.SetOutput(ioutil.Discard)
+		logOut = ioutil.Discard
 	default:
 		if logRollMB > 0 {
-			log.SetOutput(&lumberjack.Logger{
+			logOut = &lumberjack.Logger{
 				Filename:   logfile,
 				MaxSize:    logRollMB,
 				MaxAge:     14,
 				MaxBackups: 10,
 				Compress:   logRollCompress,
-			})
+			}
 		} else {
 			err := os.MkdirAll(filepath.Dir(logfile), 0755)
 			if err != nil {
@@ -112,15 +134,36 @@ func Run() {
 				mustLogFatalf("%v", err)
 			}
 			// don't close file; log should be writeable for duration of process
-			log.SetOutput(f)
+			logOut = f
 		}
 	}
+	level, err := caddylog.ParseLevel(logLevel)
+	if err != nil {
+		mustLogFatalf("%v", err)
+	}
+	caddylog.SetLevel(level)
+	err = caddylog.SetFormat(logFormat)
+	if err != nil {
+		mustLogFatalf("%v", err)
+	}
+	caddylog.SetOutput(logOut)
+
+	// send what is logged with the standard logger through
+	// the leveled logger too, which adds the timestamp
+	log.SetFlags(0)
+	log.SetOutput(caddylog.Default())
 
 	// load all additional envs as soon as possible
 	if err := LoadEnvFromFile(envFile); err != nil {
 		mustLogFatalf("%v", err)
 	}
 
+	// plugin files register themselves like compiled-in plugins,
+	// so they must be loaded before plugins are listed or used
+	if err := loadPluginFiles(pluginFiles); err != nil {
+		mustLogFatalf("%v", err)
+	}
+
 	if printEnv {
 		for _, v := range os.Environ() {
 			fmt.Println(v)
@@ -146,6 +189,30 @@ func Run() {
 		fmt.Printf("Revoked certificate for %s\n", revoke)
 		os.Exit(0)
 	}
+	if hashPasswd {
+		hashed, err := hashPassword()
+		if err != nil {
+			mustLogFatalf("%v", err)
+		}
+		fmt.Println(hashed)
+		os.Exit(0)
+	}
+	if localCARoot != "" {
+		rootPEM, err := caddytls.ExportLocalCARoot()
+		if err != nil {
+			mustLogFatalf("%v", err)
+		}
+		if localCARoot == "-" {
+			os.Stdout.Write(rootPEM)
+		} else {
+			err = ioutil.WriteFile(localCARoot, rootPEM, 0644)
+			if err != nil {
+				mustLogFatalf("%v", err)
+			}
+			fmt.Printf("Wrote root certificate of local CA to %s\n", localCARoot)
+		}
+		os.Exit(0)
+	}
 	if version {
 		if module.Sum != "" {
 			// a build with a known version will also have a checksum
@@ -155,16 +222,53 @@ func Run() {
 		}
 		os.Exit(0)
 	}
+	if buildInfo {
+		fmt.Print(describeBuild(module))
+		os.Exit(0)
+	}
 	if plugins {
 		fmt.Println(caddy.DescribePlugins())
 		os.Exit(0)
 	}
+	if directives {
+		str, err := caddy.DescribeDirectives(serverType)
+		if err != nil {
+			mustLogFatalf("%v", err)
+		}
+		fmt.Print(str)
+		os.Exit(0)
+	}
 
 	// Check if we just need to do a Caddyfile Convert and exit
 	checkJSONCaddyfile()
 
+	// Supervise worker processes instead of serving, if requested;
+	// each worker runs this same program with the same flags
+	if os.Getenv(workerEnvVar) != "" {
+		caddy.PidFile = "" // the supervisor owns the pidfile
+	} else if workers > 0 {
+		if adminAddr != "" {
+			mustLogFatalf("cannot serve the admin API when running workers")
+		}
+		err := runWorkers(workers)
+		if err != nil {
+			mustLogFatalf("[ERROR] Running workers: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	// Set CPU cap
-	err := setCPU(cpu)
+	err = setCPU(cpu)
+	if err != nil {
+		mustLogFatalf("%v", err)
+	}
+
+	// Tune the garbage collector
+	err = setGCPercent(gcPercent)
+	if err != nil {
+		mustLogFatalf("%v", err)
+	}
+	err = setMemoryLimit(memoryLimit)
 	if err != nil {
 		mustLogFatalf("%v", err)
 	}
@@ -189,6 +293,15 @@ func Run() {
 		os.Exit(0)
 	}
 
+	if environ {
+		str, err := describeEnviron(caddyfileinput)
+		if err != nil {
+			mustLogFatalf("%v", err)
+		}
+		fmt.Print(str)
+		os.Exit(0)
+	}
+
 	// Start your engines
 	instance, err := caddy.Start(caddyfileinput)
 	if err != nil {
@@ -215,6 +328,16 @@ func Run() {
 	}
 	telemetry.StartEmitting()
 
+	if watch {
+		go watchCaddyfile(caddyfileinput)
+	}
+
+	if adminAddr != "" {
+		if err := startAdmin(adminAddr); err != nil {
+			mustLogFatalf("%v", err)
+		}
+	}
+
 	// Twiddle your thumbs
 	instance.Wait()
 }
@@ -227,9 +350,13 @@ func Run() {
 // log and exits.
 func mustLogFatalf(format string, args ...interface{}) {
 	if !caddy.IsUpgrade() {
+		log.SetFlags(log.LstdFlags)
 		log.SetOutput(os.Stderr)
+		log.Fatalf(format, args...)
 	}
-	log.Fatalf(format, args...)
+	// the process log may leave out messages below some level
+	caddylog.Error(strings.TrimPrefix(fmt.Sprintf(format, args...), "[ERROR] "))
+	os.Exit(1)
 }
 
 // confLoader loads the Caddyfile using the -conf flag.
@@ -298,6 +425,32 @@ func getBuildModule() *debug.Module {
 	return &debug.Module{Version: "unknown"}
 }
 
+// describeBuild returns a description of the build of
+// this program, with module being the caddy module.
+func describeBuild(module *debug.Module) string {
+	str := fmt.Sprintf("Caddy %s\n", module.Version)
+	if module.Sum != "" {
+		str += fmt.Sprintf("Checksum: %s\n", module.Sum)
+	}
+	str += fmt.Sprintf("Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return str
+	}
+	str += fmt.Sprintf("Main module: %s %s\n", bi.Main.Path, bi.Main.Version)
+	if len(bi.Deps) > 0 {
+		str += "\nModules:\n"
+	}
+	for _, mod := range bi.Deps {
+		str += fmt.Sprintf("  %s %s", mod.Path, mod.Version)
+		if mod.Replace != nil {
+			str += fmt.Sprintf(" => %s %s", mod.Replace.Path, mod.Replace.Version)
+		}
+		str += "\n"
+	}
+	return str
+}
+
 func checkJSONCaddyfile() {
 	if fromJSON {
 		jsonBytes, err := ioutil.ReadAll(os.Stdin)
@@ -334,10 +487,11 @@ func checkJSONCaddyfile() {
 // a number (e.g. 3) or a percent (e.g. 50%).
 // If the percent resolves to less than a single
 // GOMAXPROCS, it rounds it up to GOMAXPROCS=1.
+// Percentages are relative to availableCPU().
 func setCPU(cpu string) error {
 	var numCPU int
 
-	availCPU := runtime.NumCPU()
+	availCPU := availableCPU()
 
 	if strings.HasSuffix(cpu, "%") {
 		// Percent
@@ -369,6 +523,96 @@ func setCPU(cpu string) error {
 	return nil
 }
 
+// availableCPU returns the number of CPUs this process may
+// use. It is the number of logical CPUs, further limited by
+// the CPU quota of the process's cgroup (if any), which is
+// how containers are usually given a share of the CPU.
+func availableCPU() int {
+	numCPU := runtime.NumCPU()
+	if runtime.GOOS != "linux" {
+		return numCPU
+	}
+
+	var quota float64
+	var ok bool
+	if cpuMax, err := ioutil.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		// cgroup v2
+		quota, ok = parseCgroupCPUMax(string(cpuMax))
+	} else {
+		// cgroup v1
+		quotaUs, err1 := ioutil.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+		periodUs, err2 := ioutil.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+		if err1 == nil && err2 == nil {
+			quota, ok = parseCgroupCPUMax(string(quotaUs) + " " + string(periodUs))
+		}
+	}
+	if !ok {
+		return numCPU
+	}
+
+	quotaCPU := int(math.Ceil(quota))
+	if quotaCPU < numCPU {
+		return quotaCPU
+	}
+	return numCPU
+}
+
+// parseCgroupCPUMax parses a cgroup CPU limit in the
+// format of the cgroup v2 cpu.max file, "$QUOTA $PERIOD",
+// and returns the number of CPUs it amounts to. It returns
+// false if there is no limit or the input is malformed.
+// A quota of "max" or a negative quota means no limit.
+func parseCgroupCPUMax(cpuMax string) (float64, bool) {
+	fields := strings.Fields(cpuMax)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
+
+// setGCPercent parses gc and sets the garbage collection
+// target percentage accordingly. It accepts a positive
+// number or "off" to disable garbage collection. If gc
+// is empty, the runtime default (or GOGC) is left alone.
+func setGCPercent(gc string) error {
+	if gc == "" {
+		return nil
+	}
+	if gc == "off" {
+		debug.SetGCPercent(-1)
+		return nil
+	}
+	percent, err := strconv.Atoi(gc)
+	if err != nil || percent < 1 {
+		return errors.New("invalid GC percent: provide a number greater than 0 or 'off'")
+	}
+	debug.SetGCPercent(percent)
+	return nil
+}
+
+// setMemoryLimit parses limit as a size in bytes (e.g.
+// 512MB or 2GiB) and sets it as the soft memory limit of
+// the Go runtime. If limit is empty, the runtime default
+// (or GOMEMLIMIT) is left alone.
+func setMemoryLimit(limit string) error {
+	if limit == "" {
+		return nil
+	}
+	bytes, err := humanize.ParseBytes(limit)
+	if err != nil || bytes == 0 || bytes > math.MaxInt64 {
+		return fmt.Errorf("invalid memory limit: %s", limit)
+	}
+	return setRuntimeMemoryLimit(int64(bytes))
+}
+
 // detectContainer attempts to determine whether the process is
 // being run inside a container. References:
 // https://tuhrig.de/how-to-know-you-are-inside-a-docker-container/
@@ -578,23 +822,40 @@ func ParseEnvFile(envInput io.Reader) (map[string]string, error) {
 
 const appName = "Caddy"
 
+// workerEnvVar is set in the environment of worker
+// processes started with the -workers flag.
+const workerEnvVar = "CADDY__WORKER"
+
 // Flags that control program flow or startup
 var (
 	serverType      string
 	conf            string
 	cpu             string
+	gcPercent       string
+	memoryLimit     string
 	envFile         string
 	fromJSON        bool
 	logfile         string
+	logLevel        string
+	logFormat       string
 	logRollMB       int
 	logRollCompress bool
 	revoke          string
+	localCARoot     string
 	toJSON          bool
 	version         bool
 	plugins         bool
+	directives      bool
+	buildInfo       bool
 	printEnv        bool
+	environ         bool
 	validate        bool
 	disabledMetrics string
+	workers         int
+	watch           bool
+	hashPasswd      bool
+	pluginFiles     string
+	adminAddr       string
 )
 
 // EnableTelemetry defines whether telemetry is enabled in Run.
@@ -17,13 +17,14 @@ package caddymain
 import (
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"testing"
 )
 
 func TestSetCPU(t *testing.T) {
 	currentCPU := runtime.GOMAXPROCS(-1)
-	maxCPU := runtime.NumCPU()
+	maxCPU := availableCPU()
 	halfCPU := int(0.5 * float32(maxCPU))
 	if halfCPU < 1 {
 		halfCPU = 1
@@ -60,6 +61,60 @@ func TestSetCPU(t *testing.T) {
 	}
 }
 
+func TestParseCgroupCPUMax(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		output float64
+		ok     bool
+	}{
+		{"max 100000", 0, false},
+		{"200000 100000", 2, true},
+		{"50000 100000\n", 0.5, true},
+		{"-1\n 100000\n", 0, false}, // cgroup v1 without a quota
+		{"150000\n 100000\n", 1.5, true},
+		{"", 0, false},
+		{"100000", 0, false},
+		{"abc 100000", 0, false},
+		{"100000 0", 0, false},
+	} {
+		actual, ok := parseCgroupCPUMax(test.input)
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected ok=%t, got %t", i, test.ok, ok)
+		}
+		if actual != test.output {
+			t.Errorf("Test %d: Expected %v CPUs, got %v", i, test.output, actual)
+		}
+	}
+}
+
+func TestSetGCPercent(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(100))
+	for i, test := range []struct {
+		input     string
+		output    int
+		shouldErr bool
+	}{
+		{"", 100, false},
+		{"50", 50, false},
+		{"off", -1, false},
+		{"0", 100, true},
+		{"-5", 100, true},
+		{"abc", 100, true},
+	} {
+		debug.SetGCPercent(100)
+		err := setGCPercent(test.input)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, but there wasn't any", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, but there was one: %v", i, err)
+		}
+		if actual := debug.SetGCPercent(100); actual != test.output {
+			t.Errorf("Test %d: GC percent was %d but expected %d", i, actual, test.output)
+		}
+	}
+}
+
 func TestSplitTrim(t *testing.T) {
 	for i, test := range []struct {
 		input  string
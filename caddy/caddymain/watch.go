@@ -0,0 +1,147 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// How often the files of the Caddyfile are checked for
+// changes with -watch, and how long they must stay the
+// same before reloading, so that saving several files,
+// or saving in several steps, reloads only once.
+var (
+	watchInterval = 500 * time.Millisecond
+	watchDebounce = 1 * time.Second
+)
+
+// fileState is what we know of a watched file; files
+// that don't exist are watched too, in case they appear.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// watchCaddyfile reloads the running instance whenever
+// input, which should be the Caddyfile it was started
+// with, or one of the files it imports changes. If the
+// changed Caddyfile fails to load, the instance keeps
+// running with the previous one. It does not return.
+func watchCaddyfile(input caddy.Input) {
+	files := caddyfileFiles(input)
+	if len(files) == 0 {
+		log.Println("[WARNING] Not watching the Caddyfile, since it was not loaded from a file")
+		return
+	}
+	log.Printf("[INFO] Watching %v for changes", files)
+	watchFiles(files, nil, caddy.Reload)
+}
+
+// watchFiles calls reload once files changed and then
+// stayed the same for watchDebounce, until stop is closed.
+// After a successful reload, the files of the Caddyfile
+// returned by reload are watched instead.
+func watchFiles(files []string, stop <-chan struct{}, reload func() (caddy.Input, error)) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	states := statFiles(files)
+	var changedAt time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if current := statFiles(files); !reflect.DeepEqual(current, states) {
+			states, changedAt = current, time.Now()
+			continue
+		}
+		if changedAt.IsZero() || time.Since(changedAt) < watchDebounce {
+			continue
+		}
+		changedAt = time.Time{}
+
+		log.Println("[INFO] Caddyfile changed; reloading")
+		input, err := reload()
+		if err != nil {
+			log.Printf("[ERROR] Reloading changed Caddyfile; still running the previous one: %v", err)
+			continue
+		}
+		if newFiles := caddyfileFiles(input); len(newFiles) > 0 {
+			files, states = newFiles, statFiles(newFiles)
+		}
+	}
+}
+
+// caddyfileFiles returns the absolute paths of the file
+// input was loaded from and of the files it imports, or
+// nothing if it was not loaded from a file.
+func caddyfileFiles(input caddy.Input) []string {
+	if input == nil || input.Path() == "" {
+		return nil
+	}
+	path, err := filepath.Abs(input.Path())
+	if err != nil {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return nil
+	}
+	files := []string{path}
+
+	// the tokens of imported files are tagged with their
+	// absolute paths; if the Caddyfile fails to parse,
+	// watching the file itself will have to do
+	blocks, err := caddyfile.Parse(input.Path(), bytes.NewReader(input.Body()), nil)
+	if err != nil {
+		return files
+	}
+	seen := map[string]bool{path: true}
+	for _, block := range blocks {
+		for _, tokens := range block.Tokens {
+			for _, token := range tokens {
+				if file, err := filepath.Abs(token.File); err == nil && !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
+
+func statFiles(files []string) map[string]fileState {
+	states := make(map[string]fileState, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			states[file] = fileState{}
+			continue
+		}
+		states[file] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+	}
+	return states
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddymain
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func TestCaddyfileFiles(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddymain_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	tmpdir, _ = filepath.EvalSymlinks(tmpdir)
+
+	caddyfile := filepath.Join(tmpdir, "Caddyfile")
+	sites := filepath.Join(tmpdir, "sites.conf")
+	contents := []byte("localhost {\n\timport sites.conf\n}\n")
+	if err := ioutil.WriteFile(caddyfile, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(sites, []byte("gzip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := caddyfileFiles(caddy.CaddyfileInput{Filepath: caddyfile, Contents: contents})
+	if expected := []string{caddyfile, sites}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected files %v, got %v", expected, files)
+	}
+
+	if files := caddyfileFiles(caddy.CaddyfileInput{Filepath: "stdin", Contents: contents}); files != nil {
+		t.Errorf("Expected no files for a Caddyfile not loaded from a file, got %v", files)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	oldInterval, oldDebounce := watchInterval, watchDebounce
+	watchInterval, watchDebounce = 10*time.Millisecond, 50*time.Millisecond
+	defer func() { watchInterval, watchDebounce = oldInterval, oldDebounce }()
+
+	tmpdir, err := ioutil.TempDir("", "caddymain_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	file := filepath.Join(tmpdir, "Caddyfile")
+	if err := ioutil.WriteFile(file, []byte("localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watchFiles([]string{file}, stop, func() (caddy.Input, error) {
+			reloads <- struct{}{}
+			return nil, errors.New("fail, so the files stay the same")
+		})
+		close(done)
+	}()
+
+	// several writes in quick succession cause one reload
+	for i := 0; i < 3; i++ {
+		if err := ioutil.WriteFile(file, []byte("localhost\ngzip\n"[:10+i]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(watchInterval * 2)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a reload after the file changed")
+	}
+	select {
+	case <-reloads:
+		t.Error("Expected only one reload")
+	case <-time.After(watchDebounce * 3):
+	}
+
+	// even if the reload failed, the next change is noticed
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a reload after the file was removed")
+	}
+
+	close(stop)
+	<-done
+}
@@ -0,0 +1,28 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package caddymain
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// runWorkers returns an error, because worker processes
+// rely on SO_REUSEPORT which is not supported on this platform.
+func runWorkers(n int) error {
+	return fmt.Errorf("worker processes are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,225 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package caddymain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// runWorkers runs n copies of this process as workers that share
+// their listeners using SO_REUSEPORT. Workers that exit unexpectedly
+// are restarted with a backoff. Reload signals (SIGUSR1) are relayed
+// to every worker so they reload independently; termination signals
+// are relayed as well, after which runWorkers waits for all workers
+// to exit before returning.
+func runWorkers(n int) error {
+	if conf == "stdin" {
+		return fmt.Errorf("cannot read Caddyfile from stdin when running workers")
+	}
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT,
+		syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	if caddy.PidFile != "" {
+		pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+		if err := ioutil.WriteFile(caddy.PidFile, pid, 0644); err != nil {
+			log.Printf("[ERROR] Could not write pidfile: %v", err)
+		}
+		defer os.Remove(caddy.PidFile)
+	}
+
+	s := newSupervisor(n, workerCommand)
+	if err := s.startAll(); err != nil {
+		return err
+	}
+	log.Printf("[INFO] Supervising %d workers", n)
+
+	for sig := range sigchan {
+		switch sig {
+		case syscall.SIGUSR1:
+			log.Println("[INFO] SIGUSR1: Reloading workers")
+			s.signal(sig)
+
+		case syscall.SIGUSR2:
+			log.Println("[ERROR] SIGUSR2: Upgrades are not supported when running workers")
+
+		case syscall.SIGHUP:
+			// ignore; this signal is sometimes sent outside of the user's control
+
+		default:
+			log.Printf("[INFO] Stopping workers (%v)", sig)
+			s.shutdown(sig)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// supervisor keeps track of the worker processes.
+type supervisor struct {
+	workers  []*worker
+	command  func(id int) *exec.Cmd // makes the process of a worker
+	stopping bool
+	stop     chan struct{} // closed when stopping
+	mu       sync.Mutex    // protects stopping and each worker's cmd
+	wg       sync.WaitGroup
+}
+
+// worker is a single worker process.
+type worker struct {
+	id      int
+	cmd     *exec.Cmd
+	started time.Time
+	backoff time.Duration
+}
+
+// newSupervisor returns a supervisor of n workers whose
+// processes are made by command.
+func newSupervisor(n int, command func(id int) *exec.Cmd) *supervisor {
+	return &supervisor{
+		workers: make([]*worker, n),
+		command: command,
+		stop:    make(chan struct{}),
+	}
+}
+
+// workerCommand returns the command that runs this process
+// as worker id.
+func workerCommand(id int) *exec.Cmd {
+	args := append([]string{"-reuseport"}, os.Args[1:]...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), workerEnvVar+"="+strconv.Itoa(id))
+	return cmd
+}
+
+// startAll starts every worker. If one fails to start, the
+// workers already started are stopped before it returns.
+func (s *supervisor) startAll() error {
+	for i := range s.workers {
+		w := &worker{id: i + 1}
+		s.workers[i] = w
+		if err := s.start(w); err != nil {
+			s.shutdown(syscall.SIGTERM)
+			return fmt.Errorf("starting worker %d: %v", w.id, err)
+		}
+	}
+	return nil
+}
+
+// shutdown stops restarting workers, relays sig to the
+// running ones and waits for all of them to exit.
+func (s *supervisor) shutdown(sig os.Signal) {
+	s.mu.Lock()
+	if !s.stopping {
+		s.stopping = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.signal(sig)
+	s.wg.Wait()
+}
+
+// start launches the process for w and a goroutine
+// that restarts it if it exits unexpectedly.
+func (s *supervisor) start(w *worker) error {
+	cmd := s.command(w.id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.cmd = cmd
+	w.started = time.Now()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := cmd.Wait()
+
+		s.mu.Lock()
+		stopping := s.stopping
+		s.mu.Unlock()
+		if stopping {
+			return
+		}
+
+		// a worker that ran for a while before it died gets
+		// restarted right away; one that is crashing on startup
+		// is restarted with an increasing delay
+		if time.Since(w.started) > maxWorkerBackoff {
+			w.backoff = 0
+		} else if w.backoff == 0 {
+			w.backoff = time.Second
+		} else if w.backoff < maxWorkerBackoff {
+			w.backoff *= 2
+		}
+		log.Printf("[ERROR] Worker %d (pid %d) exited: %v; restarting in %s",
+			w.id, cmd.Process.Pid, err, w.backoff)
+
+		for delay := w.backoff; ; delay = maxWorkerBackoff {
+			select {
+			case <-time.After(delay):
+			case <-s.stop:
+				return
+			}
+			err := s.start(w)
+			if err == nil {
+				return
+			}
+			log.Printf("[ERROR] Restarting worker %d: %v", w.id, err)
+		}
+	}()
+
+	return nil
+}
+
+// signal relays sig to all running workers.
+func (s *supervisor) signal(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w == nil || w.cmd == nil || w.cmd.Process == nil {
+			continue
+		}
+		if err := w.cmd.Process.Signal(sig); err != nil {
+			log.Printf("[ERROR] Signaling worker %d: %v", w.id, err)
+		}
+	}
+}
+
+// maxWorkerBackoff is the longest delay before restarting
+// a worker that keeps exiting shortly after it starts.
+const maxWorkerBackoff = 30 * time.Second
@@ -0,0 +1,87 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package caddymain
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisorStartFailure(t *testing.T) {
+	s := newSupervisor(2, func(id int) *exec.Cmd {
+		if id == 2 {
+			return exec.Command("/nonexistent/caddy")
+		}
+		return exec.Command("sleep", "60")
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- s.startAll() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Expected error when a worker fails to start")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected startAll to return after stopping the started workers")
+	}
+
+	if !s.stopping {
+		t.Error("Expected supervisor to be stopping")
+	}
+	if s.workers[0].cmd.ProcessState == nil {
+		t.Error("Expected the started worker to have exited")
+	}
+}
+
+func TestSupervisorRestartsWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var starts int
+	restarted := make(chan struct{})
+	s := newSupervisor(1, func(id int) *exec.Cmd {
+		mu.Lock()
+		defer mu.Unlock()
+		starts++
+		if starts == 1 {
+			return exec.Command("sh", "-c", "exit 1")
+		}
+		if starts == 2 {
+			close(restarted)
+		}
+		return exec.Command("sleep", "60")
+	})
+	if err := s.startAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-restarted:
+	case <-time.After(10 * time.Second):
+		s.shutdown(syscall.SIGTERM)
+		t.Fatal("Expected worker that exited to be restarted")
+	}
+
+	s.shutdown(syscall.SIGTERM)
+	mu.Lock()
+	defer mu.Unlock()
+	if starts != 2 {
+		t.Errorf("Expected worker to start twice, got %d", starts)
+	}
+}
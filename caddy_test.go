@@ -17,8 +17,11 @@ package caddy
 import (
 	"fmt"
 	"log"
+	"net"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/mholt/caddy/caddyfile"
@@ -210,3 +213,208 @@ func TestIsInternal(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteDirectivesConcurrently(t *testing.T) {
+	const serverType = "concurrenttest"
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	RegisterPlugin("conc", Plugin{
+		ServerType: serverType,
+		Concurrent: true,
+		Action: func(c *Controller) error {
+			for c.Next() {
+				if c.NextArg() && c.Val() == "fail" {
+					return c.Errf("failed for %s", c.Key)
+				}
+			}
+			mu.Lock()
+			seen[c.Key] = true
+			mu.Unlock()
+			key := c.Key
+			c.OnStartup(func() error { return nil })
+			c.OnShutdown(func() error { return fmt.Errorf("%s", key) })
+			return nil
+		},
+	})
+
+	var sblocks []caddyfile.ServerBlock
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("site%d", i)
+		sblocks = append(sblocks, caddyfile.ServerBlock{
+			Keys:   []string{key},
+			Tokens: map[string][]caddyfile.Token{"conc": {{Text: "conc"}}},
+		})
+	}
+
+	inst := &Instance{serverType: serverType, Storage: make(map[interface{}]interface{})}
+	if err := executeDirectives(inst, "Testfile", []string{"conc"}, sblocks, true); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(seen) != len(sblocks) {
+		t.Errorf("Expected setup to run for %d sites, ran for %d", len(sblocks), len(seen))
+	}
+	if len(inst.OnShutdown) != len(sblocks) {
+		t.Fatalf("Expected %d shutdown callbacks, got %d", len(sblocks), len(inst.OnShutdown))
+	}
+	for i, fn := range inst.OnShutdown {
+		if got, expect := fn().Error(), sblocks[i].Keys[0]; got != expect {
+			t.Errorf("Expected callback %d to be for %s, got %s", i, expect, got)
+		}
+	}
+	if timings := inst.LoadTimings(); len(timings.Directives) != 1 || len(timings.ServerBlocks) != len(sblocks) {
+		t.Errorf("Expected timings for 1 directive and %d server blocks, got %+v", len(sblocks), timings)
+	}
+
+	// the first failing server block determines the error
+	sblocks[7].Tokens["conc"] = []caddyfile.Token{{Text: "conc"}, {Text: "fail"}}
+	sblocks[30].Tokens["conc"] = []caddyfile.Token{{Text: "conc"}, {Text: "fail"}}
+	inst = &Instance{serverType: serverType, Storage: make(map[interface{}]interface{})}
+	err := executeDirectives(inst, "Testfile", []string{"conc"}, sblocks, true)
+	if err == nil || !strings.Contains(err.Error(), "failed for site7") {
+		t.Errorf("Expected error from site7, got: %v", err)
+	}
+	if len(inst.OnStartup) != 0 {
+		t.Errorf("Expected no callbacks to be added after a failure, got %d", len(inst.OnStartup))
+	}
+}
+
+func testDirectiveSetup(c *Controller) error { return nil }
+
+func TestListDirectives(t *testing.T) {
+	const serverType = "directivestest"
+	RegisterServerType(serverType, ServerType{
+		Directives: func() []string { return []string{"first", "missing"} },
+	})
+	RegisterPlugin("first", Plugin{ServerType: serverType, Action: testDirectiveSetup})
+	RegisterPlugin("unlisted", Plugin{ServerType: serverType, Action: testDirectiveSetup})
+
+	infos, err := ListDirectives(serverType)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []DirectiveInfo{
+		{Name: "first", Package: "github.com/mholt/caddy", Listed: true},
+		{Name: "missing", Listed: true},
+		{Name: "unlisted", Package: "github.com/mholt/caddy"},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, infos)
+	}
+
+	if _, err := ListDirectives("nonexistent"); err == nil {
+		t.Errorf("Expected an error for unknown server type")
+	}
+}
+
+func TestPurgeEventHooksKeepsPluginHooks(t *testing.T) {
+	var got []EventName
+	RegisterEventHook("test-plugin", func(event EventName, info interface{}) error {
+		got = append(got, event)
+		return nil
+	})
+	defer eventHooks.Delete("test-plugin")
+
+	atomic.AddInt32(&settingUp, 1)
+	RegisterEventHook("test-config", func(event EventName, info interface{}) error {
+		t.Errorf("Expected hook of purged config not to run, got %s", event)
+		return nil
+	})
+	atomic.AddInt32(&settingUp, -1)
+	defer eventHooks.Delete("test-config")
+
+	purgeEventHooks()
+	EmitEvent(UpstreamDownEvent, "localhost:3000")
+
+	if !reflect.DeepEqual(got, []EventName{UpstreamDownEvent}) {
+		t.Errorf("Expected plugin hook to get %s after purge, got %v", UpstreamDownEvent, got)
+	}
+}
+
+// rollbackTestServer is a TCP-only Server whose Listen fails if
+// listenErr is set.
+type rollbackTestServer struct {
+	listenErr error
+	ln        net.Listener
+}
+
+func (s *rollbackTestServer) Listen() (net.Listener, error) {
+	if s.listenErr != nil {
+		return nil, s.listenErr
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	s.ln = ln
+	return ln, err
+}
+func (s *rollbackTestServer) Serve(net.Listener) error              { return nil }
+func (s *rollbackTestServer) ListenPacket() (net.PacketConn, error) { return nil, nil }
+func (s *rollbackTestServer) ServePacket(net.PacketConn) error      { return nil }
+
+// rollbackTestContext makes a server that listens and
+// one that fails to.
+type rollbackTestContext struct {
+	servers []Server
+}
+
+func (h *rollbackTestContext) InspectServerBlocks(name string, sblock []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblock, nil
+}
+func (h *rollbackTestContext) MakeServers() ([]Server, error) {
+	return h.servers, nil
+}
+
+func TestRestartRollsBackFailedStart(t *testing.T) {
+	const serverType = "rollbacktest"
+	listening := &rollbackTestServer{}
+	RegisterServerType(serverType, ServerType{
+		Directives: func() []string { return []string{"rollbacktest"} },
+		NewContext: func(inst *Instance) Context {
+			return &rollbackTestContext{servers: []Server{
+				listening,
+				&rollbackTestServer{listenErr: fmt.Errorf("address in use")},
+			}}
+		},
+	})
+	var calls []string
+	RegisterPlugin("rollbacktest", Plugin{
+		ServerType: serverType,
+		Action: func(c *Controller) error {
+			c.OnShutdown(func() error {
+				calls = append(calls, "new OnShutdown")
+				return nil
+			})
+			return nil
+		},
+	})
+
+	oldInst := &Instance{serverType: serverType, wg: new(sync.WaitGroup)}
+	oldInst.OnShutdown = append(oldInst.OnShutdown, func() error {
+		calls = append(calls, "old OnShutdown")
+		return nil
+	})
+	oldInst.OnRestartFailed = append(oldInst.OnRestartFailed, func() error {
+		calls = append(calls, "old OnRestartFailed")
+		return nil
+	})
+
+	inst, err := oldInst.Restart(CaddyfileInput{Contents: []byte("host\nrollbacktest"), ServerTypeName: serverType})
+	if err == nil {
+		t.Fatal("Expected restart to fail")
+	}
+	if inst != oldInst {
+		t.Error("Expected the previous instance to be returned")
+	}
+	if expected := []string{"new OnShutdown", "old OnRestartFailed"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected callbacks %v, got %v", expected, calls)
+	}
+	if listening.ln == nil {
+		t.Fatal("Expected the first server to have listened")
+	}
+	if _, err := listening.ln.Accept(); err == nil {
+		t.Error("Expected the listener of the discarded instance to be closed")
+	}
+	for _, other := range Instances() {
+		if other.serverType == serverType {
+			t.Error("Expected the discarded instance not to be in the instance list")
+		}
+	}
+}
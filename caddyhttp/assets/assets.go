@@ -0,0 +1,75 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package assets lets plugins compiled into the binary provide
+// file systems, such as bundled UI assets, that sites can serve
+// with the assets directive, so that no files are needed on disk.
+package assets
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	registry   = make(map[string]http.FileSystem)
+	registryMu sync.RWMutex
+)
+
+// Register makes fs available to the assets directive under
+// name. It is meant to be called from init functions of
+// plugins, with something like http.FS of an embed.FS, or any
+// other http.FileSystem compiled into the binary. Registering
+// the same name twice panics.
+func Register(name string, fs http.FileSystem) {
+	if name == "" {
+		panic("assets must have a name")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("assets named " + name + " already registered")
+	}
+	registry[name] = fs
+}
+
+// lookup returns the file system registered as name.
+func lookup(name string) (http.FileSystem, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	fs, ok := registry[name]
+	return fs, ok
+}
+
+// Mount is a file system that serves paths under Path from
+// FileSystem, and all others from Base.
+type Mount struct {
+	Path       string
+	FileSystem http.FileSystem
+	Base       http.FileSystem
+}
+
+// Open implements http.FileSystem.
+func (m Mount) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if name == m.Path {
+		return m.FileSystem.Open("/")
+	}
+	if strings.HasPrefix(name, m.Path+"/") {
+		return m.FileSystem.Open(strings.TrimPrefix(name, m.Path))
+	}
+	return m.Base.Open(name)
+}
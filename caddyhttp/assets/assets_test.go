@@ -0,0 +1,115 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// tempDir creates a directory with the given files, which
+// stands in for a file system compiled into the binary.
+func tempDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "caddy_assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, fs http.FileSystem, name string) string {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	defer f.Close()
+	if info, _ := f.Stat(); info.IsDir() {
+		return "dir"
+	}
+	b, _ := ioutil.ReadAll(f)
+	return string(b)
+}
+
+func TestAssets(t *testing.T) {
+	ui := tempDir(t, map[string]string{"index.html": "ui", "js/app.js": "app"})
+	defer os.RemoveAll(ui)
+	site := tempDir(t, map[string]string{"index.html": "site", "uihelp.html": "help"})
+	defer os.RemoveAll(site)
+
+	Register("test-ui", http.Dir(ui))
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-ui")
+		registryMu.Unlock()
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected registering a name twice to panic")
+			}
+		}()
+		Register("test-ui", http.Dir(ui))
+	}()
+
+	c := caddy.NewTestController("http", `assets test-ui /ui/`)
+	httpserver.GetConfig(c).Root = site
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fs := httpserver.GetConfig(c).SiteFileSystem()
+	for name, expected := range map[string]string{
+		"/index.html":         "site",
+		"/uihelp.html":        "help",
+		"/ui":                 "dir",
+		"/ui/index.html":      "ui",
+		"/ui/js/app.js":       "app",
+		"/ui/../ui/js/app.js": "app",
+	} {
+		if got := readFile(t, fs, name); got != expected {
+			t.Errorf("Expected %s to be '%s', got '%s'", name, expected, got)
+		}
+	}
+
+	c = caddy.NewTestController("http", `assets test-ui`)
+	httpserver.GetConfig(c).Root = site
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := readFile(t, httpserver.GetConfig(c).SiteFileSystem(), "/index.html"); got != "ui" {
+		t.Errorf("Expected assets to be the whole site, got '%s'", got)
+	}
+
+	for i, input := range []string{`assets`, `assets test-ui / extra`, `assets unknown`} {
+		if err := setup(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"path"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("assets", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup mounts registered assets into the file system of the site.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		fs, ok := lookup(args[0])
+		if !ok {
+			return c.Errf("no assets named '%s'; is the plugin providing them plugged in?", args[0])
+		}
+		mountPath := "/"
+		if len(args) == 2 {
+			mountPath = path.Clean("/" + args[1])
+		}
+
+		if mountPath == "/" {
+			cfg.FileSystem = fs
+		} else {
+			cfg.FileSystem = Mount{Path: mountPath, FileSystem: fs, Base: cfg.SiteFileSystem()}
+		}
+	}
+
+	return nil
+}
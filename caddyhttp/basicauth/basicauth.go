@@ -35,6 +35,7 @@ import (
 
 	"github.com/jimstudt/http-authentication/basic"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // BasicAuth is middleware to protect resources with a username and password.
@@ -174,6 +175,15 @@ func parseHtpasswd(pm map[string]PasswordMatcher, r io.Reader) error {
 			return fmt.Errorf("malformed line, no color: %q", line)
 		}
 		user, encoded := line[:i], line[i+1:]
+		if strings.HasPrefix(encoded, "$2") {
+			// the htpasswd package rejects bcrypt, which we support
+			matcher, err := BcryptMatcher(encoded)
+			if err != nil {
+				return fmt.Errorf("user %q: %v", user, err)
+			}
+			pm[user] = matcher
+			continue
+		}
 		for _, p := range basic.DefaultSystems {
 			matcher, err := p(encoded)
 			if err != nil {
@@ -207,3 +217,30 @@ func PlainMatcher(passw string) PasswordMatcher {
 		return subtle.ConstantTimeCompare([]byte(pwSum), []byte(passwSum)) == 1
 	}
 }
+
+// BcryptPrefix marks a password given to basicauth in the
+// Caddyfile as a bcrypt hash instead of the plaintext password.
+const BcryptPrefix = "bcrypt="
+
+// BcryptMatcher returns a PasswordMatcher that compares passwords
+// against hash, a bcrypt hash like those htpasswd -B makes.
+func BcryptMatcher(hash string) (PasswordMatcher, error) {
+	hashed := []byte(hash)
+	if _, err := bcrypt.Cost(hashed); err != nil {
+		return nil, fmt.Errorf("invalid bcrypt hash: %v", err)
+	}
+	return func(pw string) bool {
+		return bcrypt.CompareHashAndPassword(hashed, []byte(pw)) == nil
+	}, nil
+}
+
+// HashPassword hashes passw with bcrypt and returns it in the
+// form the basicauth directive takes instead of a plaintext
+// password, i.e. with BcryptPrefix.
+func HashPassword(passw []byte) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword(passw, bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return BcryptPrefix + string(hashed), nil
+}
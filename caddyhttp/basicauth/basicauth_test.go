@@ -174,7 +174,8 @@ func contentHandler(w http.ResponseWriter, r *http.Request) (int, error) {
 func TestHtpasswd(t *testing.T) {
 	htpasswdPasswd := "IedFOuGmTpT8"
 	htpasswdFile := `sha1:{SHA}dcAUljwz99qFjYR0YLTXx0RqLww=
-md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
+md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61
+bcrypt:$2y$04$8HmQNoK9BQY183QG3dHxI.XT1dx2FttQXdYEQRhXr7W3qQBacHzn2`
 
 	htfh, err := ioutil.TempFile("", "basicauth-")
 	if err != nil {
@@ -187,7 +188,7 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 	}
 	htfh.Close()
 
-	for i, username := range []string{"sha1", "md5"} {
+	for i, username := range []string{"sha1", "md5", "bcrypt"} {
 		rule := Rule{Username: username, Resources: []string{"/testing"}}
 
 		siteRoot := filepath.Dir(htfh.Name())
@@ -228,3 +229,23 @@ func TestOptionsMethod(t *testing.T) {
 		t.Errorf("Expected status code %d but was %d", http.StatusOK, result)
 	}
 }
+
+func TestHashPassword(t *testing.T) {
+	hashed, err := HashPassword([]byte("pwd"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(hashed, BcryptPrefix) {
+		t.Fatalf("Expected hash with prefix %q, got %q", BcryptPrefix, hashed)
+	}
+	match, err := BcryptMatcher(hashed[len(BcryptPrefix):])
+	if err != nil {
+		t.Fatalf("Expected valid bcrypt hash, got: %v", err)
+	}
+	if !match("pwd") || match("pwd!") {
+		t.Errorf("Expected hash to match only the hashed password")
+	}
+	if _, err := BcryptMatcher("pwd"); err == nil {
+		t.Errorf("Expected an error for a password that is not a bcrypt hash")
+	}
+}
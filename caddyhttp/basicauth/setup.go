@@ -25,6 +25,7 @@ func init() {
 	caddy.RegisterPlugin("basicauth", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -105,6 +106,9 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 }
 
 func passwordMatcher(username, passw, siteRoot string) (PasswordMatcher, error) {
+	if strings.HasPrefix(passw, BcryptPrefix) {
+		return BcryptMatcher(passw[len(BcryptPrefix):])
+	}
 	htpasswdPrefix := "htpasswd="
 	if !strings.HasPrefix(passw, htpasswdPrefix) {
 		return PlainMatcher(passw), nil
@@ -123,6 +123,10 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		{`basicauth`, true, "", []Rule{}},
 		{`basicauth /resource user pwd asdf`, true, "", []Rule{}},
 
+		{`basicauth /resource user bcrypt=$2a$04$u/p1kPZl91a0ova8g7tUJ.iYzIuo7pALyEvBHMsgC5DAbNwA2E4wi`, false, "pwd", []Rule{
+			{Username: "user", Resources: []string{"/resource"}},
+		}},
+		{`basicauth /resource user bcrypt=pwd`, true, "", []Rule{}},
 		{`basicauth sha1 htpasswd=` + htfh.Name(), false, htpasswdPasswd, []Rule{
 			{Username: "sha1"},
 		}},
@@ -252,7 +252,7 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, config
 	for _, f := range files {
 		name := f.Name()
 
-		for _, indexName := range config.Fs.IndexPages {
+		for _, indexName := range staticfiles.IndexPagesFor(urlPath, config.Fs.IndexPages, config.Fs.PathIndexPages) {
 			if name == indexName {
 				hasIndexFile = true
 				break
@@ -268,7 +268,7 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, config
 			fileCount++
 		}
 
-		if config.Fs.IsHidden(f) {
+		if config.Fs.IsHidden(f) || config.Fs.IsHiddenPath(path.Join(urlPath, f.Name())) {
 			continue
 		}
 
@@ -336,6 +336,11 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		return b.Next.ServeHTTP(w, r)
 	}
 
+	// Hidden directories are not listed, nor is their existence revealed
+	if bc.Fs.IsHiddenPath(r.URL.Path) {
+		return http.StatusNotFound, nil
+	}
+
 	// Browse works on existing directories; delegate everything else
 	requestedFilepath, err := bc.Fs.Root.Open(r.URL.Path)
 	if err != nil {
@@ -488,6 +493,9 @@ func (b Browse) ServeListing(w http.ResponseWriter, r *http.Request, requestedFi
 	}
 
 	var buf *bytes.Buffer
+	// the format depends on the Accept header, so caches must not
+	// serve a JSON listing to a browser or vice versa
+	w.Header().Add("Vary", "Accept")
 	acceptHeader := strings.ToLower(strings.Join(r.Header["Accept"], ","))
 	switch {
 	case strings.Contains(acceptHeader, "application/json"):
@@ -364,6 +364,9 @@ func TestBrowseJson(t *testing.T) {
 		if rec.HeaderMap.Get("Content-Type") != "application/json; charset=utf-8" {
 			t.Fatalf("Expected Content type to be application/json; charset=utf-8, but got %s ", rec.HeaderMap.Get("Content-Type"))
 		}
+		if rec.HeaderMap.Get("Vary") != "Accept" {
+			t.Errorf("Test %d: Expected Vary header to be Accept, but got %s", i, rec.HeaderMap.Get("Vary"))
+		}
 
 		actualJSONResponse := rec.Body.String()
 		copyOfListing := listing
@@ -623,3 +626,98 @@ func TestDirSymlink(t *testing.T) {
 		}()
 	}
 }
+
+func TestBrowseHidePatterns(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatalf("failed to create test directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	for _, dir := range []string{".git", "public"} {
+		if err := os.MkdirAll(filepath.Join(tmpdir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, ".env"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			t.Fatalf("Next shouldn't be called")
+			return 0, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/",
+				Fs: staticfiles.FileServer{
+					Root:         http.Dir(tmpdir),
+					HidePatterns: []string{".*"},
+				},
+			},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	if code, _ := b.ServeHTTP(rec, req); code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	var entries []struct{ Name string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to parse json: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "public" {
+		t.Errorf("Expected only public to be listed, got %v", entries)
+	}
+
+	req = httptest.NewRequest("GET", "/.git/", nil)
+	if code, _ := b.ServeHTTP(httptest.NewRecorder(), req); code != http.StatusNotFound {
+		t.Errorf("Expected hidden directory to be %d, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestBrowsePathIndexPages(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatalf("failed to create test directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	for _, dir := range []string{"legacy", "other"} {
+		if err := os.MkdirAll(filepath.Join(tmpdir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, dir, "default.asp"), []byte("index"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/",
+				Fs: staticfiles.FileServer{
+					Root:           http.Dir(tmpdir),
+					IndexPages:     staticfiles.DefaultIndexPages,
+					PathIndexPages: map[string][]string{"/legacy": {"default.asp"}},
+				},
+			},
+		},
+	}
+
+	// a directory with an index page of its path is left to the file server
+	req := httptest.NewRequest("GET", "/legacy/", nil)
+	if code, _ := b.ServeHTTP(httptest.NewRecorder(), req); code != http.StatusTeapot {
+		t.Errorf("Expected /legacy/ to be passed on, got %d", code)
+	}
+
+	req = httptest.NewRequest("GET", "/other/", nil)
+	req.Header.Add("Accept", "application/json")
+	if code, _ := b.ServeHTTP(httptest.NewRecorder(), req); code != http.StatusOK {
+		t.Errorf("Expected /other/ to be listed, got %d", code)
+	}
+}
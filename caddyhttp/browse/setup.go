@@ -17,7 +17,6 @@ package browse
 import (
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"text/template"
 
 	"github.com/mholt/caddy"
@@ -29,6 +28,7 @@ func init() {
 	caddy.RegisterPlugin("browse", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -78,9 +78,11 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 		}
 
 		bc.Fs = staticfiles.FileServer{
-			Root:       http.Dir(cfg.Root),
-			Hide:       cfg.HiddenFiles,
-			IndexPages: cfg.IndexPages,
+			Root:           cfg.SiteFileSystem(),
+			Hide:           cfg.HiddenFiles,
+			HidePatterns:   cfg.HiddenPatterns,
+			IndexPages:     cfg.IndexPages,
+			PathIndexPages: cfg.PathIndexPages,
 		}
 
 		// Second argument would be the template file to use
@@ -96,11 +98,13 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 		}
 
 		// Build the template
-		tpl, err := template.New("listing").Parse(tplText)
+		tpl, err := caddy.CachedCompile("template:browse", tplText, func() (interface{}, error) {
+			return template.New("listing").Parse(tplText)
+		})
 		if err != nil {
 			return configs, err
 		}
-		bc.Template = tpl
+		bc.Template = tpl.(*template.Template)
 
 		// Save configuration
 		err = appendCfg(bc)
@@ -0,0 +1,458 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache implements an HTTP response cache middleware.
+// Responses are stored according to their Cache-Control headers
+// (or a configured default lifetime) and may be served stale
+// while they are revalidated in the background.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Cache is middleware that serves responses from a cache.
+type Cache struct {
+	Next   httpserver.Handler
+	Config *Config
+}
+
+// Config configures a response cache, which is shared by
+// the requests to the site it is configured for.
+type Config struct {
+	// Paths are the path prefixes of cached requests.
+	Paths []string
+
+	// Methods and Statuses are the request methods and
+	// response status codes that may be cached.
+	Methods  []string
+	Statuses []int
+
+	// DefaultTTL is how long responses that don't say are
+	// fresh; 0 means that such responses aren't cached.
+	DefaultTTL time.Duration
+
+	// Stale is how long a response may be served after it
+	// expired while it is revalidated, unless the response
+	// sets stale-while-revalidate itself.
+	Stale time.Duration
+
+	// MaxEntrySize is the size of the largest body cached.
+	MaxEntrySize int64
+
+	// PurgeFrom are the networks allowed to remove responses
+	// from the cache with PURGE requests. If empty, PURGE
+	// requests are passed on like any other.
+	PurgeFrom []*net.IPNet
+
+	Storage Storage
+
+	mu           sync.Mutex
+	varies       map[string][]string // base key -> request headers the response varies by
+	revalidating map[string]bool
+}
+
+// cacheStatusHeader tells clients how the cache handled a request.
+const cacheStatusHeader = "X-Cache-Status"
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (c Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := c.Config
+	if !cfg.matchesPath(r.URL.Path) {
+		return c.Next.ServeHTTP(w, r)
+	}
+	if r.Method == "PURGE" && len(cfg.PurgeFrom) > 0 {
+		if !cfg.purgeAllowed(r) {
+			return http.StatusForbidden, nil
+		}
+		cfg.purge(r)
+		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent, nil
+	}
+	if !cfg.cacheableRequest(r) {
+		w.Header().Set(cacheStatusHeader, "skip")
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	key := cfg.key(r)
+	reqDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, noCache := reqDirectives["no-cache"]; !noCache {
+		if entry, ok := cfg.Storage.Get(key); ok {
+			now := time.Now()
+			if entry.fresh(now) {
+				return serveEntry(w, r, entry, "hit")
+			}
+			if entry.usable(now) {
+				cfg.revalidate(c.Next, r, key)
+				return serveEntry(w, r, entry, "stale")
+			}
+		}
+	}
+
+	w.Header().Set(cacheStatusHeader, "miss")
+	rec := &recorder{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		status:                http.StatusOK,
+		limit:                 cfg.MaxEntrySize,
+	}
+	status, err := c.Next.ServeHTTP(rec, r)
+	if err == nil && rec.wroteHeader && !rec.overflow {
+		cfg.store(r, rec.status, rec.Header(), rec.body.Bytes())
+	}
+	return status, err
+}
+
+// matchesPath reports whether requests for p are cached.
+func (cfg *Config) matchesPath(p string) bool {
+	for _, prefix := range cfg.Paths {
+		if httpserver.Path(p).Matches(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheableRequest reports whether the response to r
+// may be served from or stored in the cache.
+func (cfg *Config) cacheableRequest(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if _, noStore := parseCacheControl(r.Header.Get("Cache-Control"))["no-store"]; noStore {
+		return false
+	}
+	for _, m := range cfg.Methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	return false
+}
+
+// baseKey identifies the resource requested by r.
+func baseKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.RequestURI()
+}
+
+// key identifies the cached response for r, which includes
+// the values of the request headers that the last response
+// for the same resource varied by.
+func (cfg *Config) key(r *http.Request) string {
+	base := baseKey(r)
+	cfg.mu.Lock()
+	fields := cfg.varies[base]
+	cfg.mu.Unlock()
+	return variantKey(base, fields, r)
+}
+
+func variantKey(base string, fields []string, r *http.Request) string {
+	if len(fields) == 0 {
+		return base
+	}
+	var buf bytes.Buffer
+	buf.WriteString(base)
+	for _, field := range fields {
+		buf.WriteByte(0)
+		buf.WriteString(strings.Join(r.Header[http.CanonicalHeaderKey(field)], ","))
+	}
+	return buf.String()
+}
+
+// store caches the response to r if it is cacheable.
+func (cfg *Config) store(r *http.Request, status int, header http.Header, body []byte) {
+	if !cfg.cacheableStatus(status) || header.Get("Set-Cookie") != "" {
+		return
+	}
+	var fields []string
+	for _, v := range header["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field == "*" {
+				return
+			} else if field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	now := time.Now()
+	ttl, stale, ok := cfg.lifetime(header, now, r.Header.Get("Cookie") != "")
+	if !ok {
+		return
+	}
+
+	base := baseKey(r)
+	cfg.mu.Lock()
+	cfg.varies[base] = fields
+	cfg.mu.Unlock()
+
+	header = cloneHeader(header)
+	header.Del(cacheStatusHeader)
+	cfg.Storage.Set(variantKey(base, fields, r), &Entry{
+		Status:  status,
+		Header:  header,
+		Body:    append([]byte(nil), body...),
+		Stored:  now,
+		Expires: now.Add(ttl),
+		Stale:   stale,
+	})
+}
+
+func (cfg *Config) cacheableStatus(status int) bool {
+	for _, s := range cfg.Statuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lifetime returns how long a response with header is fresh and
+// how long it may be served stale after that, or ok=false if it
+// must not be cached. If the request carried cookies, the response
+// may be personalized, so the default TTL only applies if the
+// response is explicitly public.
+func (cfg *Config) lifetime(header http.Header, now time.Time, cookies bool) (ttl, stale time.Duration, ok bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, has := directives[d]; has {
+			return 0, 0, false
+		}
+	}
+
+	stale = cfg.Stale
+	if v, has := directives["stale-while-revalidate"]; has {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			stale = time.Duration(secs) * time.Second
+		}
+	}
+
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, has := directives[d]; has {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs <= 0 {
+				return 0, 0, false
+			}
+			return time.Duration(secs) * time.Second, stale, true
+		}
+	}
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil || !expires.After(now) {
+			return 0, 0, false
+		}
+		return expires.Sub(now), stale, true
+	}
+	if _, public := directives["public"]; cookies && !public {
+		return 0, 0, false
+	}
+	if cfg.DefaultTTL > 0 {
+		return cfg.DefaultTTL, stale, true
+	}
+	return 0, 0, false
+}
+
+// revalidate refreshes the entry under key in the background by
+// passing a copy of r on to next. Only one revalidation per key
+// runs at a time.
+func (cfg *Config) revalidate(next httpserver.Handler, r *http.Request, key string) {
+	cfg.mu.Lock()
+	if cfg.revalidating[key] {
+		cfg.mu.Unlock()
+		return
+	}
+	cfg.revalidating[key] = true
+	cfg.mu.Unlock()
+
+	// the request ends before the revalidation does, so its
+	// context can't be used; but keep its values (like the
+	// original URL) for the handlers down the chain
+	req := r.WithContext(detachedContext{r.Context()})
+	req.Header = cloneHeader(r.Header)
+	go func() {
+		defer func() {
+			cfg.mu.Lock()
+			delete(cfg.revalidating, key)
+			cfg.mu.Unlock()
+		}()
+		buf := &bufferWriter{header: make(http.Header), status: http.StatusOK}
+		status, err := next.ServeHTTP(buf, req)
+		if err != nil || (!buf.wroteHeader && status >= 400) {
+			return
+		}
+		cfg.store(req, buf.status, buf.header, buf.body.Bytes())
+	}()
+}
+
+// purgeAllowed reports whether r comes from a network
+// that may purge cached responses.
+func (cfg *Config) purgeAllowed(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range cfg.PurgeFrom {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// purge removes the cached responses to the resource of r,
+// for every method that is cached.
+func (cfg *Config) purge(r *http.Request) {
+	for _, m := range cfg.Methods {
+		req := *r
+		req.Method = m
+		base := baseKey(&req)
+		cfg.mu.Lock()
+		fields := cfg.varies[base]
+		delete(cfg.varies, base)
+		cfg.mu.Unlock()
+		cfg.Storage.Delete(base)
+		if len(fields) > 0 {
+			cfg.Storage.Delete(variantKey(base, fields, &req))
+		}
+	}
+}
+
+// serveEntry writes the cached entry as the response to r.
+func serveEntry(w http.ResponseWriter, r *http.Request, e *Entry, cacheStatus string) (int, error) {
+	h := w.Header()
+	for field, values := range e.Header {
+		h[field] = append([]string(nil), values...)
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(e.Stored).Seconds())))
+	h.Set(cacheStatusHeader, cacheStatus)
+	w.WriteHeader(e.Status)
+	if r.Method != "HEAD" {
+		w.Write(e.Body)
+	}
+	if e.Status >= 400 {
+		// the response is written already; don't let
+		// the error handlers up the chain write another
+		return 0, nil
+	}
+	return e.Status, nil
+}
+
+// parseCacheControl parses the directives of a Cache-Control
+// header value into a map of names to (unquoted) values.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, val = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = val
+	}
+	return directives
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for field, values := range h {
+		clone[field] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// recorder passes a response through while keeping a copy
+// of its body, unless that grows beyond limit.
+type recorder struct {
+	*httpserver.ResponseWriterWrapper
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	limit       int64
+	overflow    bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+	rec.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if int64(rec.body.Len()+len(p)) > rec.limit {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	return rec.ResponseWriterWrapper.Write(p)
+}
+
+// bufferWriter is a ResponseWriter that only buffers
+// the response, for revalidations in the background.
+type bufferWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferWriter) Header() http.Header { return b.header }
+
+func (b *bufferWriter) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status, b.wroteHeader = status, true
+	}
+}
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	return b.body.Write(p)
+}
+
+// detachedContext keeps the values of a context but
+// is never canceled and has no deadline.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*recorder)(nil)
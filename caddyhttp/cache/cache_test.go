@@ -0,0 +1,291 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// countingHandler responds with the number of times it was
+// called, with the response headers set by header.
+type countingHandler struct {
+	calls  int32
+	status int
+	header func(r *http.Request, h http.Header)
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	n := atomic.AddInt32(&h.calls, 1)
+	if h.header != nil {
+		h.header(r, w.Header())
+	}
+	status := h.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(strconv.Itoa(int(n))))
+	return status, nil
+}
+
+func newTestConfig() *Config {
+	return &Config{
+		Paths:        []string{"/"},
+		Methods:      []string{"GET", "HEAD"},
+		Statuses:     []int{200},
+		MaxEntrySize: 1024,
+		Storage:      newMemoryStorage(100),
+		varies:       make(map[string][]string),
+		revalidating: make(map[string]bool),
+	}
+}
+
+func get(t *testing.T, h httpserver.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for field, values := range header {
+		req.Header[field] = values
+	}
+	rec := httptest.NewRecorder()
+	if _, err := h.ServeHTTP(rec, req); err != nil {
+		t.Fatalf("%s %s: unexpected error: %v", method, path, err)
+	}
+	return rec
+}
+
+func TestCache(t *testing.T) {
+	for i, test := range []struct {
+		responseHeader http.Header
+		requestHeader  http.Header
+		status         int
+		expectedBodies []string
+		expectedStatus []string
+	}{
+		// cached with a lifetime from max-age
+		{http.Header{"Cache-Control": {"max-age=60"}}, nil, 0,
+			[]string{"1", "1"}, []string{"miss", "hit"}},
+		// ...or from Expires
+		{http.Header{"Expires": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}, nil, 0,
+			[]string{"1", "1"}, []string{"miss", "hit"}},
+		// no lifetime and no default_ttl
+		{nil, nil, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		// not cacheable responses
+		{http.Header{"Cache-Control": {"no-store"}}, nil, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		{http.Header{"Cache-Control": {"private, max-age=60"}}, nil, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, nil, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, nil, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		{http.Header{"Cache-Control": {"max-age=60"}}, nil, http.StatusInternalServerError,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+		// requests that bypass the cache
+		{http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Cache-Control": {"no-store"}}, 0,
+			[]string{"1", "2"}, []string{"skip", "skip"}},
+		{http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Authorization": {"Basic Zm9vOmJhcg=="}}, 0,
+			[]string{"1", "2"}, []string{"skip", "skip"}},
+		{http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Cache-Control": {"no-cache"}}, 0,
+			[]string{"1", "2"}, []string{"miss", "miss"}},
+	} {
+		responseHeader := test.responseHeader
+		c := Cache{
+			Next: &countingHandler{status: test.status, header: func(r *http.Request, h http.Header) {
+				for field, values := range responseHeader {
+					h[field] = values
+				}
+			}},
+			Config: newTestConfig(),
+		}
+		for j := range test.expectedBodies {
+			rec := get(t, c, "GET", "/page", test.requestHeader)
+			if body := rec.Body.String(); body != test.expectedBodies[j] {
+				t.Errorf("Test %d, request %d: Expected body %s, got %s", i, j, test.expectedBodies[j], body)
+			}
+			if got := rec.Header().Get(cacheStatusHeader); got != test.expectedStatus[j] {
+				t.Errorf("Test %d, request %d: Expected %s %s, got %s", i, j, cacheStatusHeader, test.expectedStatus[j], got)
+			}
+		}
+	}
+}
+
+func TestCacheDefaultTTL(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.DefaultTTL = time.Minute
+	c := Cache{Next: &countingHandler{}, Config: cfg}
+
+	if body := get(t, c, "GET", "/a", nil).Body.String(); body != "1" {
+		t.Fatalf("Expected body 1, got %s", body)
+	}
+	rec := get(t, c, "GET", "/a", nil)
+	if body := rec.Body.String(); body != "1" {
+		t.Errorf("Expected cached body 1, got %s", body)
+	}
+	if rec.Header().Get("Age") == "" {
+		t.Error("Expected an Age header on a cached response")
+	}
+	// paths, query strings and methods are cached separately
+	if body := get(t, c, "GET", "/a?b", nil).Body.String(); body != "2" {
+		t.Errorf("Expected body 2, got %s", body)
+	}
+	get(t, c, "HEAD", "/a", nil)
+	if body := get(t, c, "HEAD", "/a", nil).Body.String(); body != "" {
+		t.Errorf("Expected no body for a cached HEAD response, got %s", body)
+	}
+	// methods that are not cached
+	if body := get(t, c, "POST", "/a", nil).Body.String(); body != "4" {
+		t.Errorf("Expected body 4, got %s", body)
+	}
+}
+
+func TestCacheDefaultTTLWithCookies(t *testing.T) {
+	cookie := http.Header{"Cookie": {"session=abc"}}
+	for i, test := range []struct {
+		responseHeader http.Header
+		expectedBody   string
+	}{
+		// a response to a request with cookies may be personalized
+		{nil, "2"},
+		{http.Header{"Cache-Control": {"public"}}, "1"},
+		{http.Header{"Cache-Control": {"max-age=60"}}, "1"},
+	} {
+		responseHeader := test.responseHeader
+		cfg := newTestConfig()
+		cfg.DefaultTTL = time.Minute
+		c := Cache{
+			Next: &countingHandler{header: func(r *http.Request, h http.Header) {
+				for field, values := range responseHeader {
+					h[field] = values
+				}
+			}},
+			Config: cfg,
+		}
+		get(t, c, "GET", "/page", cookie)
+		if body := get(t, c, "GET", "/page", nil).Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %s, got %s", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	c := Cache{
+		Next: &countingHandler{header: func(r *http.Request, h http.Header) {
+			h.Set("Cache-Control", "max-age=60")
+			h.Set("Vary", "Accept-Language")
+		}},
+		Config: newTestConfig(),
+	}
+	en := http.Header{"Accept-Language": {"en"}}
+	de := http.Header{"Accept-Language": {"de"}}
+	for i, test := range []struct {
+		header       http.Header
+		expectedBody string
+	}{
+		{en, "1"},
+		{en, "1"},
+		{de, "2"},
+		{de, "2"},
+	} {
+		if body := get(t, c, "GET", "/", test.header).Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %s, got %s", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	next := &countingHandler{header: func(r *http.Request, h http.Header) {
+		h.Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+	}}
+	cfg := newTestConfig()
+	c := Cache{Next: next, Config: cfg}
+
+	get(t, c, "GET", "/", nil)
+
+	// age the entry so that it is stale
+	entry, _ := cfg.Storage.Get("GET example.com/")
+	entry.Expires = time.Now().Add(-time.Second)
+
+	rec := get(t, c, "GET", "/", nil)
+	if body := rec.Body.String(); body != "1" {
+		t.Errorf("Expected the stale body 1, got %s", body)
+	}
+	if got := rec.Header().Get(cacheStatusHeader); got != "stale" {
+		t.Errorf("Expected %s stale, got %s", cacheStatusHeader, got)
+	}
+
+	// wait for the revalidation in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entry, _ := cfg.Storage.Get("GET example.com/")
+		if string(entry.Body) == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the entry to be revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if body := get(t, c, "GET", "/", nil).Body.String(); body != "2" {
+		t.Errorf("Expected the revalidated body 2, got %s", body)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.DefaultTTL = time.Minute
+	_, local, _ := net.ParseCIDR("192.0.2.0/24")
+	cfg.PurgeFrom = []*net.IPNet{local}
+	c := Cache{Next: &countingHandler{}, Config: cfg}
+
+	get(t, c, "GET", "/a", nil)
+
+	req := httptest.NewRequest("PURGE", "/a", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	if status, _ := c.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusForbidden {
+		t.Errorf("Expected PURGE from elsewhere to be forbidden, got %d", status)
+	}
+	if body := get(t, c, "GET", "/a", nil).Body.String(); body != "1" {
+		t.Errorf("Expected the cached body 1, got %s", body)
+	}
+
+	req = httptest.NewRequest("PURGE", "/a", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if status, _ := c.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusNoContent {
+		t.Errorf("Expected PURGE to succeed, got %d", status)
+	}
+	if body := get(t, c, "GET", "/a", nil).Body.String(); body != "2" {
+		t.Errorf("Expected a fresh body 2 after purging, got %s", body)
+	}
+}
+
+func TestCacheMaxEntrySize(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.DefaultTTL = time.Minute
+	cfg.MaxEntrySize = 0
+	c := Cache{Next: &countingHandler{}, Config: cfg}
+
+	get(t, c, "GET", "/", nil)
+	if body := get(t, c, "GET", "/", nil).Body.String(); body != "2" {
+		t.Errorf("Expected a body larger than MaxEntrySize not to be cached, got %s", body)
+	}
+}
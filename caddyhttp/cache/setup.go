@@ -0,0 +1,177 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cache", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+const (
+	// DefaultMaxEntries is how many responses are
+	// kept in memory by default.
+	DefaultMaxEntries = 10000
+
+	// DefaultMaxEntrySize is the size of the largest
+	// response body cached by default: 1 MB.
+	DefaultMaxEntrySize = 1024 * 1024
+)
+
+// setup configures a new Cache middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg, err := cacheParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Cache{Next: next, Config: cfg}
+	})
+
+	return nil
+}
+
+func cacheParse(c *caddy.Controller) (*Config, error) {
+	cfg := &Config{
+		Methods:      []string{http.MethodGet, http.MethodHead},
+		Statuses:     []int{http.StatusOK, http.StatusMovedPermanently},
+		MaxEntrySize: DefaultMaxEntrySize,
+		varies:       make(map[string][]string),
+		revalidating: make(map[string]bool),
+	}
+	maxEntries := DefaultMaxEntries
+	var diskPath string
+	var parsed bool
+
+	for c.Next() {
+		if parsed {
+			return nil, c.Err("cache already configured for this site")
+		}
+		parsed = true
+
+		cfg.Paths = c.RemainingArgs()
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "methods":
+				cfg.Methods = nil
+				for _, m := range args {
+					cfg.Methods = append(cfg.Methods, strings.ToUpper(m))
+				}
+			case "status":
+				cfg.Statuses = nil
+				for _, arg := range args {
+					status, err := strconv.Atoi(arg)
+					if err != nil || status < 100 || status > 599 {
+						return nil, c.Errf("invalid status code: %s", arg)
+					}
+					cfg.Statuses = append(cfg.Statuses, status)
+				}
+			case "default_ttl", "stale":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return nil, c.Errf("invalid duration: %s", args[0])
+				}
+				if what == "default_ttl" {
+					cfg.DefaultTTL = d
+				} else {
+					cfg.Stale = d
+				}
+			case "max_entries":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return nil, c.Errf("max_entries must be a positive integer: %s", args[0])
+				}
+				maxEntries = n
+			case "max_entry_size":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				size := httpserver.ParseSize(args[0])
+				if size <= 0 {
+					return nil, c.Errf("invalid size: %s", args[0])
+				}
+				cfg.MaxEntrySize = size
+			case "storage":
+				switch {
+				case args[0] == "memory" && len(args) == 1:
+					diskPath = ""
+				case args[0] == "disk" && len(args) == 2:
+					diskPath = args[1]
+				default:
+					return nil, c.Errf("storage must be 'memory' or 'disk <path>'")
+				}
+			case "purge_from":
+				for _, arg := range args {
+					if !strings.Contains(arg, "/") {
+						if ip := net.ParseIP(arg); ip != nil && ip.To4() != nil {
+							arg += "/32"
+						} else {
+							arg += "/128"
+						}
+					}
+					_, network, err := net.ParseCIDR(arg)
+					if err != nil {
+						return nil, c.Errf("invalid network for purge_from: %v", err)
+					}
+					cfg.PurgeFrom = append(cfg.PurgeFrom, network)
+				}
+			default:
+				return nil, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+	}
+
+	if len(cfg.Paths) == 0 {
+		cfg.Paths = []string{"/"}
+	}
+	if diskPath != "" {
+		storage, err := newDiskStorage(diskPath)
+		if err != nil {
+			return nil, c.Errf("setting up cache storage: %v", err)
+		}
+		cfg.Storage = storage
+	} else {
+		cfg.Storage = newMemoryStorage(maxEntries)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `cache`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Cache)
+	if !ok {
+		t.Fatalf("Expected handler to be type Cache, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestCacheParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	diskDir := filepath.Join(dir, "responses")
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		check     func(*Config) bool
+	}{
+		{`cache`, false, func(cfg *Config) bool {
+			_, memory := cfg.Storage.(*memoryStorage)
+			return memory && reflect.DeepEqual(cfg.Paths, []string{"/"}) &&
+				reflect.DeepEqual(cfg.Methods, []string{"GET", "HEAD"}) &&
+				reflect.DeepEqual(cfg.Statuses, []int{200, 301}) &&
+				cfg.MaxEntrySize == DefaultMaxEntrySize
+		}},
+		{`cache /api /blog {
+			methods get
+			status 200 404
+			default_ttl 5m
+			stale 30s
+			max_entries 10
+			max_entry_size 64KB
+			purge_from 127.0.0.1 10.0.0.0/8 ::1
+		}`, false, func(cfg *Config) bool {
+			memory, ok := cfg.Storage.(*memoryStorage)
+			return ok && memory.maxEntries == 10 &&
+				reflect.DeepEqual(cfg.Paths, []string{"/api", "/blog"}) &&
+				reflect.DeepEqual(cfg.Methods, []string{"GET"}) &&
+				reflect.DeepEqual(cfg.Statuses, []int{200, 404}) &&
+				cfg.DefaultTTL == 5*time.Minute && cfg.Stale == 30*time.Second &&
+				cfg.MaxEntrySize == 64*1024 && len(cfg.PurgeFrom) == 3 &&
+				cfg.PurgeFrom[0].String() == "127.0.0.1/32" &&
+				cfg.PurgeFrom[2].String() == "::1/128"
+		}},
+		{`cache {
+			storage disk ` + diskDir + `
+		}`, false, func(cfg *Config) bool {
+			disk, ok := cfg.Storage.(*diskStorage)
+			_, err := os.Stat(diskDir)
+			return ok && disk.dir == diskDir && err == nil
+		}},
+		{`cache {
+			status
+		}`, true, nil},
+		{`cache {
+			status ok
+		}`, true, nil},
+		{`cache {
+			default_ttl forever
+		}`, true, nil},
+		{`cache {
+			max_entries 0
+		}`, true, nil},
+		{`cache {
+			max_entry_size big
+		}`, true, nil},
+		{`cache {
+			storage tape
+		}`, true, nil},
+		{`cache {
+			purge_from nowhere
+		}`, true, nil},
+		{`cache {
+			stale_if_error 1m
+		}`, true, nil},
+		{`cache
+		cache`, true, nil},
+	}
+	for i, test := range tests {
+		cfg, err := cacheParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.check != nil && err == nil && !test.check(cfg) {
+			t.Errorf("Test %d: unexpected config %+v", i, cfg)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+
+	// Stored is when the response was stored, and
+	// Expires when it stops being fresh.
+	Stored  time.Time
+	Expires time.Time
+
+	// Stale is how long after Expires the response
+	// may still be served while it is revalidated.
+	Stale time.Duration
+}
+
+// fresh reports whether e may be served as it is at t.
+func (e *Entry) fresh(t time.Time) bool {
+	return t.Before(e.Expires)
+}
+
+// usable reports whether e may be served at t, while
+// it is being revalidated if it is not fresh.
+func (e *Entry) usable(t time.Time) bool {
+	return t.Before(e.Expires.Add(e.Stale))
+}
+
+// Storage stores cached responses by key. Implementations
+// must be safe for concurrent use.
+type Storage interface {
+	// Get returns the entry stored under key, if any.
+	Get(key string) (*Entry, bool)
+
+	// Set stores e under key, replacing any previous entry.
+	Set(key string, e *Entry)
+
+	// Delete removes the entry stored under key, if any.
+	Delete(key string)
+}
+
+// memoryStorage keeps up to maxEntries entries in memory,
+// evicting the least recently used ones first.
+type memoryStorage struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	entry *Entry
+}
+
+func newMemoryStorage(maxEntries int) *memoryStorage {
+	return &memoryStorage{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (s *memoryStorage) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).entry, true
+}
+
+func (s *memoryStorage) Set(key string, e *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*memoryEntry).entry = e
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, entry: e})
+	for s.lru.Len() > s.maxEntries {
+		me := s.lru.Remove(s.lru.Back()).(*memoryEntry)
+		delete(s.entries, me.key)
+	}
+}
+
+func (s *memoryStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+	}
+}
+
+// diskStorage keeps entries as files in a directory, one
+// per key. Entries that can no longer be served are removed
+// when they are next looked up.
+type diskStorage struct {
+	dir string
+}
+
+func newDiskStorage(dir string) (*diskStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &diskStorage{dir: dir}, nil
+}
+
+// path returns the file name of the entry for key.
+func (s *diskStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *diskStorage) Get(key string) (*Entry, bool) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var e Entry
+	if err := gob.NewDecoder(f).Decode(&e); err != nil {
+		log.Printf("[ERROR] Reading cache entry %s: %v", f.Name(), err)
+		os.Remove(f.Name())
+		return nil, false
+	}
+	if !e.usable(time.Now()) {
+		os.Remove(f.Name())
+		return nil, false
+	}
+	return &e, true
+}
+
+func (s *diskStorage) Set(key string, e *Entry) {
+	// write to a temporary file first so that readers
+	// never see a partially written entry
+	tmp, err := ioutil.TempFile(s.dir, ".tmp")
+	if err != nil {
+		log.Printf("[ERROR] Storing cache entry: %v", err)
+		return
+	}
+	err = gob.NewEncoder(tmp).Encode(e)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		log.Printf("[ERROR] Storing cache entry: %v", err)
+		os.Remove(tmp.Name())
+	}
+}
+
+func (s *diskStorage) Delete(key string) {
+	os.Remove(s.path(key))
+}
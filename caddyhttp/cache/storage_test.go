@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorageEviction(t *testing.T) {
+	s := newMemoryStorage(2)
+	s.Set("a", &Entry{Status: 1})
+	s.Set("b", &Entry{Status: 2})
+	s.Get("a") // a is now the most recently used
+	s.Set("c", &Entry{Status: 3})
+
+	if _, ok := s.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := s.Get(key); !ok {
+			t.Errorf("Expected entry %s to be kept", key)
+		}
+	}
+	s.Delete("a")
+	if _, ok := s.Get("a"); ok {
+		t.Error("Expected entry a to be deleted")
+	}
+}
+
+func TestDiskStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Round(0)
+	entry := &Entry{
+		Status:  http.StatusOK,
+		Header:  http.Header{"Content-Type": {"text/plain"}},
+		Body:    []byte("hello"),
+		Stored:  now,
+		Expires: now.Add(time.Minute),
+	}
+	s.Set("GET example.com/", entry)
+	got, ok := s.Get("GET example.com/")
+	if !ok {
+		t.Fatal("Expected the entry to be stored")
+	}
+	if !reflect.DeepEqual(got, entry) {
+		t.Errorf("Expected %+v, got %+v", entry, got)
+	}
+
+	s.Delete("GET example.com/")
+	if _, ok := s.Get("GET example.com/"); ok {
+		t.Error("Expected the entry to be deleted")
+	}
+
+	// entries that can't be served anymore are removed
+	for i := 0; i < 3; i++ {
+		s.Set(strconv.Itoa(i), &Entry{Stored: now, Expires: now.Add(-time.Minute)})
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := s.Get(strconv.Itoa(i)); ok {
+			t.Errorf("Expected expired entry %d not to be served", i)
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected expired entries to be removed, found %d files", len(files))
+	}
+}
@@ -19,31 +19,55 @@ import (
 	_ "github.com/mholt/caddy/caddyhttp/httpserver"
 
 	// plug in the standard directives
+	_ "github.com/mholt/caddy/caddyhttp/assets"
 	_ "github.com/mholt/caddy/caddyhttp/basicauth"
 	_ "github.com/mholt/caddy/caddyhttp/bind"
 	_ "github.com/mholt/caddy/caddyhttp/browse"
+	_ "github.com/mholt/caddy/caddyhttp/cache"
+	_ "github.com/mholt/caddy/caddyhttp/cgi"
+	_ "github.com/mholt/caddy/caddyhttp/chain"
+	_ "github.com/mholt/caddy/caddyhttp/clientlimits"
+	_ "github.com/mholt/caddy/caddyhttp/csp"
 	_ "github.com/mholt/caddy/caddyhttp/errors"
+	_ "github.com/mholt/caddy/caddyhttp/expires"
 	_ "github.com/mholt/caddy/caddyhttp/expvar"
 	_ "github.com/mholt/caddy/caddyhttp/extensions"
 	_ "github.com/mholt/caddy/caddyhttp/fastcgi"
+	_ "github.com/mholt/caddy/caddyhttp/filecache"
+	_ "github.com/mholt/caddy/caddyhttp/filesystem"
+	_ "github.com/mholt/caddy/caddyhttp/geoip"
+	_ "github.com/mholt/caddy/caddyhttp/git"
 	_ "github.com/mholt/caddy/caddyhttp/gzip"
 	_ "github.com/mholt/caddy/caddyhttp/header"
+	_ "github.com/mholt/caddy/caddyhttp/hide"
 	_ "github.com/mholt/caddy/caddyhttp/index"
 	_ "github.com/mholt/caddy/caddyhttp/internalsrv"
+	_ "github.com/mholt/caddy/caddyhttp/language"
 	_ "github.com/mholt/caddy/caddyhttp/limits"
 	_ "github.com/mholt/caddy/caddyhttp/log"
+	_ "github.com/mholt/caddy/caddyhttp/maintenance"
 	_ "github.com/mholt/caddy/caddyhttp/markdown"
 	_ "github.com/mholt/caddy/caddyhttp/mime"
 	_ "github.com/mholt/caddy/caddyhttp/pprof"
 	_ "github.com/mholt/caddy/caddyhttp/proxy"
 	_ "github.com/mholt/caddy/caddyhttp/push"
+	_ "github.com/mholt/caddy/caddyhttp/realip"
 	_ "github.com/mholt/caddy/caddyhttp/redirect"
 	_ "github.com/mholt/caddy/caddyhttp/requestid"
+	_ "github.com/mholt/caddy/caddyhttp/respond"
 	_ "github.com/mholt/caddy/caddyhttp/rewrite"
 	_ "github.com/mholt/caddy/caddyhttp/root"
+	_ "github.com/mholt/caddy/caddyhttp/s3"
+	_ "github.com/mholt/caddy/caddyhttp/secureheaders"
+	_ "github.com/mholt/caddy/caddyhttp/split"
+	_ "github.com/mholt/caddy/caddyhttp/startupshutdown"
 	_ "github.com/mholt/caddy/caddyhttp/status"
+	_ "github.com/mholt/caddy/caddyhttp/subfilter"
+	_ "github.com/mholt/caddy/caddyhttp/symlinks"
 	_ "github.com/mholt/caddy/caddyhttp/templates"
 	_ "github.com/mholt/caddy/caddyhttp/timeouts"
+	_ "github.com/mholt/caddy/caddyhttp/useragent"
+	_ "github.com/mholt/caddy/caddyhttp/webdav"
 	_ "github.com/mholt/caddy/caddyhttp/websocket"
 	_ "github.com/mholt/caddy/onevent"
 )
@@ -0,0 +1,164 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cgi is middleware that runs CGI programs and scripts
+// to answer requests. Each request starts a new process with the
+// standard CGI environment; the request body is passed to it on
+// stdin and its output is streamed back as the response.
+package cgi
+
+import (
+	"net/http"
+	stdcgi "net/http/cgi"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Rule is a set of requests to answer with a CGI program.
+type Rule struct {
+	// Match are the glob patterns (see path.Match) of request
+	// paths that run Exec; a pattern ending in "/*" matches
+	// everything under its directory.
+	Match []string
+
+	// Exts are the extensions of scripts under the site root
+	// that are run, either directly or with Exec as their
+	// interpreter.
+	Exts []string
+
+	// Exec is the program to run, with Args.
+	Exec string
+	Args []string
+
+	// Dir is the working directory of the program; the
+	// directory of the program or script if empty.
+	Dir string
+
+	// Env are extra "KEY=value" environment variables, where
+	// values may have placeholders, and PassEnv are the names
+	// of variables of the server's environment to pass on.
+	Env     []string
+	PassEnv []string
+}
+
+// CGI is middleware that answers requests with CGI programs.
+type CGI struct {
+	Next  httpserver.Handler
+	Rules []Rule
+	Root  string
+
+	// Roots of specific paths, which take precedence over Root
+	PathRoots []httpserver.PathRoot
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (c CGI) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	c.Root = httpserver.RootFor(r.URL.Path, c.Root, c.PathRoots)
+	for _, rule := range c.Rules {
+		inv, ok := c.match(rule, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		// programs without a path are looked up like in a shell
+		if filepath.Base(inv.exe) == inv.exe {
+			if exe, err := exec.LookPath(inv.exe); err == nil {
+				inv.exe = exe
+			}
+		}
+
+		env := []string{"DOCUMENT_ROOT=" + c.Root}
+		if inv.scriptFile != "" {
+			env = append(env, "SCRIPT_FILENAME="+inv.scriptFile)
+		}
+		repl := httpserver.NewReplacer(r, nil, "")
+		for _, e := range rule.Env {
+			env = append(env, repl.Replace(e))
+		}
+
+		h := &stdcgi.Handler{
+			Path:       inv.exe,
+			Root:       inv.scriptName,
+			Dir:        rule.Dir,
+			Env:        env,
+			InheritEnv: rule.PassEnv,
+			Args:       inv.args,
+		}
+		h.ServeHTTP(w, r)
+		return 0, nil
+	}
+	return c.Next.ServeHTTP(w, r)
+}
+
+// invocation is how a CGI program is run for a request.
+type invocation struct {
+	exe        string
+	args       []string
+	scriptName string // SCRIPT_NAME of the request
+	scriptFile string // script under the site root, if any
+}
+
+// match returns how to run the program of rule for requests
+// for urlPath, or false if rule does not match the request.
+func (c CGI) match(rule Rule, urlPath string) (invocation, bool) {
+	urlPath = path.Clean("/" + urlPath)
+
+	for _, pattern := range rule.Match {
+		if dir := strings.TrimSuffix(pattern, "/*"); dir != pattern {
+			if httpserver.Path(urlPath).Matches(dir + "/") {
+				return invocation{exe: rule.Exec, args: rule.Args, scriptName: dir}, true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return invocation{exe: rule.Exec, args: rule.Args, scriptName: urlPath}, true
+		}
+	}
+
+	// scripts may be followed by extra path info, like
+	// /cgi-bin/script.py/extra; find the script part
+	for i := 0; i < len(urlPath); {
+		end := strings.Index(urlPath[i+1:], "/")
+		if end < 0 {
+			end = len(urlPath)
+		} else {
+			end += i + 1
+		}
+		scriptName := urlPath[:end]
+		for _, ext := range rule.Exts {
+			if !strings.HasSuffix(scriptName, ext) {
+				continue
+			}
+			script := httpserver.SafePath(c.Root, scriptName)
+			info, err := os.Stat(script)
+			if err != nil || !info.Mode().IsRegular() {
+				return invocation{}, false
+			}
+			inv := invocation{exe: script, scriptName: scriptName, scriptFile: script}
+			if rule.Exec != "" {
+				inv.exe = rule.Exec
+				inv.args = append(append([]string{}, rule.Args...), script)
+			}
+			return inv, true
+		}
+		i = end
+	}
+
+	return invocation{}, false
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+const testScript = `#!/bin/sh
+echo "Content-Type: text/plain"
+echo
+echo "$SCRIPT_NAME|$PATH_INFO|$QUERY_STRING|$GREETING|$(cat)"
+`
+
+func TestCGI(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	root, err := ioutil.TempDir("", "caddy_cgi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "cgi-bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(root, "cgi-bin", "hello.sh")
+	if err := ioutil.WriteFile(script, []byte(testScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// not executable; run with an interpreter
+	if err := ioutil.WriteFile(filepath.Join(root, "cgi-bin", "hello.cgi"), []byte(testScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := CGI{
+		Root: root,
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Rules: []Rule{
+			{Match: []string{"/report/*"}, Exec: script, Env: []string{"GREETING=hi {host}"}},
+			{Match: []string{"/exact"}, Exec: script},
+			{Exts: []string{".sh"}},
+			{Exts: []string{".cgi"}, Exec: "sh"},
+		},
+	}
+
+	for i, test := range []struct {
+		method       string
+		url          string
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{"GET", "/report/monthly?year=2019", "", 0, "/report|/monthly|year=2019|hi example.com|"},
+		{"GET", "/exact", "", 0, "/exact||||"},
+		{"POST", "/cgi-bin/hello.sh/extra", "posted", 0, "/cgi-bin/hello.sh|/extra|||posted"},
+		{"GET", "/cgi-bin/hello.cgi", "", 0, "/cgi-bin/hello.cgi||||"},
+		{"GET", "/cgi-bin/missing.sh", "", http.StatusTeapot, ""},
+		{"GET", "/reports", "", http.StatusTeapot, ""},
+		{"GET", "/exact/more", "", http.StatusTeapot, ""},
+	} {
+		r := httptest.NewRequest(test.method, "http://example.com"+test.url, strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		status, err := c.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if status != 0 {
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Test %d: expected response status 200, got %d", i, w.Code)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != test.expectBody {
+			t.Errorf("Test %d: expected body '%s', got '%s'", i, test.expectBody, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgi
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cgi", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new CGI middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := cgiParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return CGI{Next: next, Rules: rules, Root: cfg.Root, PathRoots: cfg.PathRoots}
+	})
+
+	return nil
+}
+
+// cgiParse parses the cgi directive:
+//
+//	cgi <match> <exec> [<args...>]
+//	cgi {
+//		match    <pattern...>
+//		ext      <.ext...>
+//		exec     <exec> [<args...>]
+//		dir      <dir>
+//		env      <key=value...>
+//		pass_env <key...>
+//	}
+func cgiParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		var rule Rule
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			return nil, c.ArgErr()
+		default:
+			rule.Match = []string{args[0]}
+			rule.Exec, rule.Args = args[1], args[2:]
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "match":
+				for _, pattern := range args {
+					if !strings.HasPrefix(pattern, "/") {
+						return nil, c.Errf("match pattern must begin with '/', got '%s'", pattern)
+					}
+				}
+				rule.Match = append(rule.Match, args...)
+			case "ext":
+				for _, ext := range args {
+					if !strings.HasPrefix(ext, ".") {
+						return nil, c.Errf("extension must begin with '.', got '%s'", ext)
+					}
+				}
+				rule.Exts = append(rule.Exts, args...)
+			case "exec":
+				rule.Exec, rule.Args = args[0], args[1:]
+			case "dir":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Dir = args[0]
+			case "env":
+				for _, env := range args {
+					if !strings.Contains(env, "=") {
+						return nil, c.Errf("environment variable must be key=value, got '%s'", env)
+					}
+				}
+				rule.Env = append(rule.Env, args...)
+			case "pass_env":
+				rule.PassEnv = append(rule.PassEnv, args...)
+			default:
+				return nil, c.Errf("unknown cgi property '%s'", what)
+			}
+		}
+
+		if len(rule.Match) == 0 && len(rule.Exts) == 0 {
+			return nil, c.Err("cgi: nothing to match; use match or ext")
+		}
+		if len(rule.Match) > 0 && rule.Exec == "" {
+			return nil, c.Err("cgi: match requires exec")
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
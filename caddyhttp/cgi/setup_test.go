@@ -0,0 +1,114 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `cgi /report /usr/local/bin/report`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(CGI)
+	if !ok {
+		t.Fatalf("Expected handler to be type CGI, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestCGIParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`cgi /report /usr/local/bin/report --format html`, false, []Rule{
+			{Match: []string{"/report"}, Exec: "/usr/local/bin/report", Args: []string{"--format", "html"}},
+		}},
+		{`cgi {
+			match /report/* /stats
+			exec /usr/local/bin/report
+			dir /tmp
+			env APP=test USER={user}
+			pass_env PATH HOME
+		}`, false, []Rule{
+			{Match: []string{"/report/*", "/stats"}, Exec: "/usr/local/bin/report", Args: []string{},
+				Dir: "/tmp", Env: []string{"APP=test", "USER={user}"}, PassEnv: []string{"PATH", "HOME"}},
+		}},
+		{`cgi {
+			ext .pl .py
+		}
+		cgi {
+			ext .php
+			exec php-cgi
+		}`, false, []Rule{
+			{Exts: []string{".pl", ".py"}},
+			{Exts: []string{".php"}, Exec: "php-cgi", Args: []string{}},
+		}},
+		{`cgi /report`, true, nil},
+		{`cgi {
+			match /report
+		}`, true, nil},
+		{`cgi {
+			exec /usr/local/bin/report
+		}`, true, nil},
+		{`cgi {
+			match report
+			exec /usr/local/bin/report
+		}`, true, nil},
+		{`cgi {
+			ext pl
+		}`, true, nil},
+		{`cgi {
+			ext .pl
+			env APP
+		}`, true, nil},
+		{`cgi {
+			ext .pl
+			dir a b
+		}`, true, nil},
+		{`cgi {
+			ext .pl
+			timeout 10s
+		}`, true, nil},
+	} {
+		rules, err := cgiParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chain implements a debug endpoint describing a site's
+// handler chain: which directives set the site up, in what order,
+// and with which configuration. The chains of all sites are also
+// described by the admin API, if it is enabled.
+package chain
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Chain is a middleware that describes the handler chain
+// of its site at a configured path.
+type Chain struct {
+	Next     httpserver.Handler
+	Resource string
+	Site     *httpserver.SiteConfig
+}
+
+// chainInfo is the JSON description of a site's handler chain.
+type chainInfo struct {
+	Site       string                      `json:"site"`
+	Directives []httpserver.DirectiveSetup `json:"directives"`
+}
+
+// ServeHTTP handles requests to the configured resource by
+// describing the site's handler chain, or passes all other
+// requests up the chain.
+func (c Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(c.Resource) {
+		return c.Next.ServeHTTP(w, r)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return http.StatusMethodNotAllowed, nil
+	}
+	return writeJSON(w, describe(c.Site))
+}
+
+// AdminHandler returns the handler of the admin API that
+// describes the handler chains of all sites of the running
+// instances.
+func AdminHandler() http.Handler {
+	return sitesHandler(runningSites)
+}
+
+// runningSites returns the sites of all running instances.
+func runningSites() []*httpserver.SiteConfig {
+	var sites []*httpserver.SiteConfig
+	for _, inst := range caddy.Instances() {
+		sites = append(sites, httpserver.InstanceSites(inst)...)
+	}
+	return sites
+}
+
+// sitesHandler describes the handler chains of the sites
+// it returns.
+type sitesHandler func() []*httpserver.SiteConfig
+
+func (h sitesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	infos := []chainInfo{}
+	for _, site := range h() {
+		infos = append(infos, describe(site))
+	}
+	if status, err := writeJSON(w, infos); err != nil {
+		http.Error(w, err.Error(), status)
+	}
+}
+
+// describe returns the description of the handler chain of site.
+func describe(site *httpserver.SiteConfig) chainInfo {
+	info := chainInfo{
+		Site:       site.Addr.String(),
+		Directives: site.DirectiveSetups(),
+	}
+	if info.Directives == nil {
+		info.Directives = []httpserver.DirectiveSetup{}
+	}
+	return info
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) (int, error) {
+	body, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(body, '\n'))
+	return 0, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestChain(t *testing.T) {
+	c := caddy.NewTestController("http", "gzip {\n\tlevel 5\n}")
+	cfg := httpserver.GetConfig(c)
+	c.Context().(caddy.SetupObserver).DirectiveSetUp(c)
+
+	ch := Chain{
+		Next:     httpserver.HandlerFunc(nextHandler),
+		Resource: "/debug/chain",
+		Site:     cfg,
+	}
+
+	for i, test := range []struct {
+		method, path   string
+		expectedStatus int
+	}{
+		{"GET", "/debug/chain", 0},
+		{"GET", "/other", http.StatusTeapot},
+		{"POST", "/debug/chain", http.StatusMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rec := httptest.NewRecorder()
+		status, err := ch.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status != 0 {
+			continue
+		}
+		var info chainInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatalf("Test %d: Invalid JSON: %v", i, err)
+		}
+		if len(info.Directives) != 1 {
+			t.Fatalf("Test %d: Expected 1 directive, got %#v", i, info.Directives)
+		}
+		if got := info.Directives[0]; got.Directive != "gzip" || got.Config != "gzip {\nlevel 5\n}" {
+			t.Errorf("Test %d: Unexpected directive description: %#v", i, got)
+		}
+	}
+}
+
+func TestSitesHandler(t *testing.T) {
+	c := caddy.NewTestController("http", "gzip")
+	cfg := httpserver.GetConfig(c)
+	c.Context().(caddy.SetupObserver).DirectiveSetUp(c)
+	h := sitesHandler(func() []*httpserver.SiteConfig { return []*httpserver.SiteConfig{cfg, {}} })
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/chain", nil))
+	var infos []chainInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("Expected 2 sites, got %#v", infos)
+	}
+	if len(infos[0].Directives) != 1 || infos[0].Directives[0].Directive != "gzip" {
+		t.Errorf("Expected the gzip directive in the first site, got %#v", infos[0].Directives)
+	}
+	if infos[1].Directives == nil || len(infos[1].Directives) != 0 {
+		t.Errorf("Expected no directives in the second site, got %#v", infos[1].Directives)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/chain", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func nextHandler(w http.ResponseWriter, r *http.Request) (int, error) {
+	return http.StatusTeapot, nil
+}
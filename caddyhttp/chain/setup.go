@@ -0,0 +1,67 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("chain", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultPath is where the handler chain is described
+// if no path is given.
+const defaultPath = "/debug/chain"
+
+// setup configures a new Chain middleware instance.
+func setup(c *caddy.Controller) error {
+	resource, err := chainParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	ch := Chain{Resource: resource, Site: cfg}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		ch.Next = next
+		return ch
+	})
+
+	return nil
+}
+
+func chainParse(c *caddy.Controller) (string, error) {
+	resource := defaultPath
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			resource = args[0]
+		default:
+			return "", c.ArgErr()
+		}
+		if c.NextBlock() {
+			return "", c.ArgErr()
+		}
+	}
+	return resource, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input       string
+		shouldErr   bool
+		expectedRes string
+	}{
+		{`chain`, false, defaultPath},
+		{`chain /c`, false, "/c"},
+		{`chain /c /d`, true, ""},
+		{"chain /c {\n\tfoo\n}", true, ""},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		mids := httpserver.GetConfig(c).Middleware()
+		if len(mids) != 1 {
+			t.Fatalf("Test %d: Expected 1 middleware, got %d", i, len(mids))
+		}
+		handler, ok := mids[0](httpserver.EmptyNext).(Chain)
+		if !ok {
+			t.Fatalf("Test %d: Expected handler to be type Chain, got: %#v", i, handler)
+		}
+		if handler.Resource != test.expectedRes {
+			t.Errorf("Test %d: Expected resource %s, got %s", i, test.expectedRes, handler.Resource)
+		}
+		if handler.Site != httpserver.GetConfig(c) {
+			t.Errorf("Test %d: Expected handler to describe the site of the controller", i)
+		}
+		if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clientlimits provides middleware that caps how many
+// connections and in-flight requests a single client IP may
+// have at once.
+//
+// Connections are limited by the IP of the peer, which behind
+// a CDN or load balancer is the proxy's, so such proxies must
+// be exempted. Requests are limited by the remote address of
+// the request, which the realip directive can set to the IP
+// of the client behind trusted proxies.
+package clientlimits
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// ClientLimits is middleware that refuses requests from clients
+// that already have too many requests in flight.
+type ClientLimits struct {
+	Next httpserver.Handler
+
+	// MaxRequests is how many requests one client IP may
+	// have in flight. If zero, requests are not limited.
+	MaxRequests int
+
+	// MaxConns is how many connections one client IP may
+	// have open. If zero, connections are not limited.
+	MaxConns int
+
+	// Status is the status code of refused requests.
+	Status int
+
+	// Exempt are the networks of clients that are not
+	// limited, such as trusted proxies.
+	Exempt []*net.IPNet
+
+	requests *counter
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (cl ClientLimits) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if cl.MaxRequests == 0 {
+		return cl.Next.ServeHTTP(w, r)
+	}
+
+	// the remote address is the client's as far as trusted
+	// proxies are concerned, if realip has rewritten it
+	ip := hostOnly(r.RemoteAddr)
+	if exempt(cl.Exempt, ip) {
+		return cl.Next.ServeHTTP(w, r)
+	}
+	if !cl.requests.acquire(ip, cl.MaxRequests) {
+		w.Header().Set("Retry-After", "1")
+		return cl.Status, nil
+	}
+	defer cl.requests.release(ip)
+	return cl.Next.ServeHTTP(w, r)
+}
+
+// counter counts things per client IP.
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCounter() *counter {
+	return &counter{counts: make(map[string]int)}
+}
+
+// acquire increments the count of ip and returns true, unless
+// it is already at max.
+func (c *counter) acquire(ip string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip] >= max {
+		return false
+	}
+	c.counts[ip]++
+	return true
+}
+
+// release decrements the count of ip.
+func (c *counter) release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip] <= 1 {
+		delete(c.counts, ip)
+		return
+	}
+	c.counts[ip]--
+}
+
+// limitListener closes new connections from clients that
+// already have max connections open.
+type limitListener struct {
+	caddy.Listener
+	max    int
+	exempt []*net.IPNet
+	conns  *counter
+}
+
+// Accept returns the next connection from a client that is
+// under the limit.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := hostOnly(conn.RemoteAddr().String())
+		if exempt(l.exempt, ip) {
+			return conn, nil
+		}
+		if !l.conns.acquire(ip, l.max) {
+			conn.Close()
+			continue
+		}
+		return &limitConn{Conn: conn, ip: ip, conns: l.conns}, nil
+	}
+}
+
+// limitConn releases its slot when it is closed.
+type limitConn struct {
+	net.Conn
+	ip    string
+	conns *counter
+	once  sync.Once
+}
+
+// Close closes the connection and releases its slot.
+func (c *limitConn) Close() error {
+	c.once.Do(func() { c.conns.release(c.ip) })
+	return c.Conn.Close()
+}
+
+// exempt returns whether ip is in one of networks.
+func exempt(networks []*net.IPNet, ip string) bool {
+	if len(networks) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOnly returns addr without its port.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientlimits
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestClientLimitsRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	cl := ClientLimits{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			started <- struct{}{}
+			<-release
+			return http.StatusOK, nil
+		}),
+		MaxRequests: 2,
+		Status:      http.StatusTooManyRequests,
+		requests:    newCounter(),
+	}
+
+	serve := func(remoteAddr string) (int, http.Header) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		status, _ := cl.ServeHTTP(w, r)
+		return status, w.Header()
+	}
+
+	done := make(chan int, 2)
+	for _, addr := range []string{"10.0.0.1:1000", "10.0.0.1:1001"} {
+		go func(addr string) {
+			status, _ := serve(addr)
+			done <- status
+		}(addr)
+		<-started
+	}
+
+	// a third request from the same IP is refused
+	status, header := serve("10.0.0.1:1002")
+	if status != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", status)
+	}
+	if header.Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// another client is unaffected
+	go func() {
+		status, _ := serve("10.0.0.2:1000")
+		done <- status
+	}()
+	<-started
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if status := <-done; status != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+	}
+
+	// once the requests are done, the client may make more
+	if status, _ := serve("10.0.0.1:1003"); status != http.StatusOK {
+		t.Errorf("Expected status 200 after requests finished, got %d", status)
+	}
+	if len(cl.requests.counts) != 0 {
+		t.Errorf("Expected counts to be released, got %v", cl.requests.counts)
+	}
+}
+
+func TestClientLimitsExempt(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.1.0.0/16")
+	release := make(chan struct{})
+	defer close(release)
+	cl := ClientLimits{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			<-release
+			return http.StatusOK, nil
+		}),
+		MaxRequests: 1,
+		Status:      http.StatusTooManyRequests,
+		Exempt:      []*net.IPNet{proxies},
+		requests:    newCounter(),
+	}
+
+	// requests in flight from an exempt network are not counted
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.1.2.3:1000"
+		go cl.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:1001"
+	done := make(chan int)
+	go func() {
+		status, _ := cl.ServeHTTP(httptest.NewRecorder(), r)
+		done <- status
+	}()
+	select {
+	case status := <-done:
+		t.Errorf("Expected request from exempt network to be served, got status %d", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cl.requests.mu.Lock()
+	defer cl.requests.mu.Unlock()
+	if len(cl.requests.counts) != 0 {
+		t.Errorf("Expected no counts for an exempt network, got %v", cl.requests.counts)
+	}
+}
+
+type testListener struct {
+	net.Listener
+}
+
+func (testListener) File() (*os.File, error) { return nil, nil }
+
+func TestLimitListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lln := &limitListener{Listener: testListener{ln}, max: 1, conns: newCounter()}
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := lln.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	first, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	serverSide := <-accepted
+
+	// the second connection is closed right away
+	second, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected the connection over the limit to be closed")
+	}
+
+	// closing the first frees the slot
+	serverSide.Close()
+	serverSide.Close()
+	third, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Error("Expected a connection to be accepted after a slot was freed")
+	}
+}
+
+func TestLimitListenerExempt(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	lln := &limitListener{Listener: testListener{ln}, max: 1, exempt: []*net.IPNet{loopback}, conns: newCounter()}
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		conn, err := lln.Accept()
+		if err != nil {
+			t.Fatalf("Connection %d: Expected it to be accepted, got error: %v", i, err)
+		}
+		defer conn.Close()
+	}
+	if len(lln.conns.counts) != 0 {
+		t.Errorf("Expected no counts for an exempt network, got %v", lln.conns.counts)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientlimits
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("client_limits", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new ClientLimits middleware instance.
+func setup(c *caddy.Controller) error {
+	cl, err := clientLimitsParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	if cl.MaxConns > 0 {
+		conns := newCounter()
+		cfg.AddListenerMiddleware(func(ln caddy.Listener) caddy.Listener {
+			return &limitListener{Listener: ln, max: cl.MaxConns, exempt: cl.Exempt, conns: conns}
+		})
+	}
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		cl.Next = next
+		return cl
+	})
+
+	return nil
+}
+
+func clientLimitsParse(c *caddy.Controller) (ClientLimits, error) {
+	cl := ClientLimits{
+		Status:   http.StatusTooManyRequests,
+		requests: newCounter(),
+	}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			// client_limits <requests>
+			n, err := parseLimit(c, args[0])
+			if err != nil {
+				return cl, err
+			}
+			cl.MaxRequests = n
+		default:
+			return cl, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) != 1 && !(what == "exempt" && len(args) > 0) {
+				return cl, c.ArgErr()
+			}
+
+			switch what {
+			case "requests":
+				n, err := parseLimit(c, args[0])
+				if err != nil {
+					return cl, err
+				}
+				cl.MaxRequests = n
+			case "connections":
+				n, err := parseLimit(c, args[0])
+				if err != nil {
+					return cl, err
+				}
+				cl.MaxConns = n
+			case "status":
+				status, err := strconv.Atoi(args[0])
+				if err != nil || (status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable) {
+					return cl, c.Errf("status must be 429 or 503, got '%s'", args[0])
+				}
+				cl.Status = status
+			case "exempt":
+				for _, arg := range args {
+					if !strings.Contains(arg, "/") {
+						if ip := net.ParseIP(arg); ip != nil && ip.To4() != nil {
+							arg += "/32"
+						} else {
+							arg += "/128"
+						}
+					}
+					_, network, err := net.ParseCIDR(arg)
+					if err != nil {
+						return cl, c.Err(err.Error())
+					}
+					cl.Exempt = append(cl.Exempt, network)
+				}
+			default:
+				return cl, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+	}
+
+	if cl.MaxRequests == 0 && cl.MaxConns == 0 {
+		return cl, c.Err("client_limits needs a requests or connections limit")
+	}
+
+	return cl, nil
+}
+
+// parseLimit parses a limit, which must be a positive number.
+func parseLimit(c *caddy.Controller, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, c.Errf("limit must be a positive number, got '%s'", s)
+	}
+	return n, nil
+}
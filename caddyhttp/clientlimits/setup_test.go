@@ -0,0 +1,129 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientlimits
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `client_limits {
+		requests 10
+		connections 20
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	cfg := httpserver.GetConfig(c)
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	if len(cfg.ListenerMiddleware()) != 1 {
+		t.Errorf("Expected 1 listener middleware, had %d", len(cfg.ListenerMiddleware()))
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(ClientLimits)
+	if !ok {
+		t.Fatalf("Expected handler to be type ClientLimits, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSetupWithoutConnections(t *testing.T) {
+	c := caddy.NewTestController("http", `client_limits 5`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if n := len(httpserver.GetConfig(c).ListenerMiddleware()); n != 0 {
+		t.Errorf("Expected no listener middleware, had %d", n)
+	}
+}
+
+func TestClientLimitsParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		maxRequests int
+		maxConns    int
+		status      int
+	}{
+		{`client_limits 5`, false, 5, 0, http.StatusTooManyRequests},
+		{`client_limits {
+			requests 8
+			connections 16
+			status 503
+		}`, false, 8, 16, http.StatusServiceUnavailable},
+		{`client_limits {
+			connections 4
+		}`, false, 0, 4, http.StatusTooManyRequests},
+		{`client_limits`, true, 0, 0, 0},
+		{`client_limits 0`, true, 0, 0, 0},
+		{`client_limits 5 6`, true, 0, 0, 0},
+		{`client_limits {
+			requests many
+		}`, true, 0, 0, 0},
+		{`client_limits {
+			requests 1
+			status 404
+		}`, true, 0, 0, 0},
+		{`client_limits {
+			requests
+		}`, true, 0, 0, 0},
+		{`client_limits {
+			bogus 1
+		}`, true, 0, 0, 0},
+		{`client_limits {
+			connections 4
+			exempt 10.0.0.0/8 192.168.1.1 ::1
+		}`, false, 0, 4, http.StatusTooManyRequests},
+		{`client_limits {
+			connections 4
+			exempt
+		}`, true, 0, 0, 0},
+		{`client_limits {
+			connections 4
+			exempt 10.0.0.0/33
+		}`, true, 0, 0, 0},
+	}
+
+	for i, test := range tests {
+		cl, err := clientLimitsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, but got: %v", i, err)
+			continue
+		}
+		if cl.MaxRequests != test.maxRequests || cl.MaxConns != test.maxConns || cl.Status != test.status {
+			t.Errorf("Test %d: Expected requests=%d connections=%d status=%d, got requests=%d connections=%d status=%d",
+				i, test.maxRequests, test.maxConns, test.status, cl.MaxRequests, cl.MaxConns, cl.Status)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csp provides middleware that sends a Content-Security-Policy
+// with a fresh nonce for every request.
+package csp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// NoncePlaceholder is the placeholder that holds the nonce of the
+// current request. It can be used in the policy itself, in templates
+// with {{.Placeholder "csp_nonce"}}, and by any other middleware
+// that replaces placeholders.
+const NoncePlaceholder = "{csp_nonce}"
+
+// CSP is middleware that generates a nonce per request and sends
+// it in the Content-Security-Policy of the matching rule.
+type CSP struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the policy for requests under Path.
+type Rule struct {
+	Path string
+
+	// Policy is the header value; NoncePlaceholder and any
+	// other placeholders in it are replaced per request.
+	Policy string
+
+	// ReportOnly sends the policy in the
+	// Content-Security-Policy-Report-Only header instead.
+	ReportOnly bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (p CSP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range p.Rules {
+		if httpserver.Path(r.URL.Path).Matches(p.Rules[i].Path) &&
+			(rule == nil || len(p.Rules[i].Path) > len(rule.Path)) {
+			rule = &p.Rules[i]
+		}
+	}
+	if rule == nil {
+		return p.Next.ServeHTTP(w, r)
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	repl, ok := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer)
+	if !ok {
+		repl = httpserver.NewReplacer(r, nil, "")
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, repl))
+	}
+	repl.Set("csp_nonce", nonce)
+
+	header := "Content-Security-Policy"
+	if rule.ReportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+	// added rather than set, so that it is enforced
+	// together with any policy set before this one
+	w.Header().Add(header, repl.Replace(rule.Policy))
+
+	return p.Next.ServeHTTP(w, r)
+}
+
+// newNonce returns 128 random bits, base64-encoded.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
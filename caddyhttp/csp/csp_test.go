@@ -0,0 +1,75 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCSP(t *testing.T) {
+	var nonce string
+	p := CSP{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			nonce = httpserver.NewReplacer(r, nil, "").Replace(NoncePlaceholder)
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Policy: "script-src 'nonce-{csp_nonce}'"},
+			{Path: "/report", Policy: "style-src 'nonce-{csp_nonce}'", ReportOnly: true},
+		},
+	}
+
+	seen := make(map[string]bool)
+	for i, test := range []struct {
+		path, header, prefix string
+	}{
+		{"/", "Content-Security-Policy", "script-src 'nonce-"},
+		{"/page", "Content-Security-Policy", "script-src 'nonce-"},
+		{"/report/x", "Content-Security-Policy-Report-Only", "style-src 'nonce-"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		nonce = ""
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if len(nonce) != 24 {
+			t.Fatalf("Test %d: Expected a nonce placeholder, got '%s'", i, nonce)
+		}
+		if seen[nonce] {
+			t.Errorf("Test %d: Nonce '%s' was reused", i, nonce)
+		}
+		seen[nonce] = true
+		if got, want := w.Header().Get(test.header), test.prefix+nonce+"'"; got != want {
+			t.Errorf("Test %d: Expected %s '%s', got '%s'", i, test.header, want, got)
+		}
+	}
+
+	// paths outside any rule get no policy and no nonce
+	p.Rules = p.Rules[1:]
+	w := httptest.NewRecorder()
+	nonce = ""
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("Expected no policy, got '%s'", got)
+	}
+	if nonce != "" {
+		t.Errorf("Expected no nonce, got '%s'", nonce)
+	}
+}
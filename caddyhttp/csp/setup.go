@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("csp", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// DefaultPolicy is a strict policy that only allows scripts
+// carrying the nonce, and scripts loaded by them.
+const DefaultPolicy = "script-src 'nonce-" + NoncePlaceholder + "' 'strict-dynamic'; object-src 'none'; base-uri 'none'"
+
+// setup configures a new CSP middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := cspParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return CSP{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func cspParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/", Policy: DefaultPolicy}
+
+		// a single argument is the path if it looks
+		// like one; policies never start with a slash
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if strings.HasPrefix(args[0], "/") {
+				rule.Path = args[0]
+			} else {
+				rule.Policy = args[0]
+			}
+		case 2:
+			rule.Path, rule.Policy = args[0], args[1]
+		default:
+			return rules, c.ArgErr()
+		}
+		for _, r := range rules {
+			if r.Path == rule.Path {
+				return rules, c.Errf("duplicate csp path '%s'", rule.Path)
+			}
+		}
+		if !strings.Contains(rule.Policy, NoncePlaceholder) {
+			return rules, c.Errf("csp policy must contain %s", NoncePlaceholder)
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "report_only":
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				rule.ReportOnly = true
+			default:
+				return rules, c.Errf("unknown subdirective: %s", c.Val())
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -32,6 +32,7 @@ func init() {
 	caddy.RegisterPlugin("errors", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -0,0 +1,118 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expires provides middleware that sets the Cache-Control
+// and Expires headers of responses by request path or by the
+// value of a response header such as Content-Type.
+package expires
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Expires is middleware that sets caching headers on responses
+// according to the first rule that matches.
+type Expires struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule sets the lifetime of matching responses. A rule matches
+// by request path if Header is empty, or else by the value of
+// the response header named Header.
+type Rule struct {
+	Header   string
+	Pattern  *regexp.Regexp
+	Duration time.Duration
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e Expires) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rww := &responseWriterWrapper{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		path:                  r.URL.Path,
+		rules:                 e.Rules,
+	}
+	return e.Next.ServeHTTP(rww, r)
+}
+
+// match returns the rule for a response to path with
+// header h, or nil if no rule matches.
+func match(rules []Rule, path string, h http.Header) *Rule {
+	for i, rule := range rules {
+		value := path
+		if rule.Header != "" {
+			value = h.Get(rule.Header)
+		}
+		if rule.Pattern.MatchString(value) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// responseWriterWrapper sets the caching headers once the
+// response headers are final, so that rules can look at them.
+type responseWriterWrapper struct {
+	*httpserver.ResponseWriterWrapper
+	path        string
+	rules       []Rule
+	wroteHeader bool
+}
+
+func (rww *responseWriterWrapper) Write(d []byte) (int, error) {
+	if !rww.wroteHeader {
+		rww.WriteHeader(http.StatusOK)
+	}
+	return rww.ResponseWriterWrapper.Write(d)
+}
+
+// ReadFrom sets the caching headers like Write does and
+// passes the body through as it is.
+func (rww *responseWriterWrapper) ReadFrom(src io.Reader) (int64, error) {
+	if !rww.wroteHeader {
+		rww.WriteHeader(http.StatusOK)
+	}
+	return httpserver.ReadFrom(rww.ResponseWriterWrapper.ResponseWriter, src)
+}
+
+func (rww *responseWriterWrapper) WriteHeader(status int) {
+	if rww.wroteHeader {
+		return
+	}
+	rww.wroteHeader = true
+
+	// a handler that sets its own caching policy knows better
+	h := rww.Header()
+	if h.Get("Cache-Control") == "" && h.Get("Expires") == "" {
+		if rule := match(rww.rules, rww.path, h); rule != nil {
+			h.Set("Cache-Control", "max-age="+strconv.Itoa(int(rule.Duration.Seconds())))
+			h.Set("Expires", time.Now().Add(rule.Duration).UTC().Format(http.TimeFormat))
+		}
+	}
+
+	rww.ResponseWriterWrapper.WriteHeader(status)
+}
+
+// Interface guards
+var (
+	_ httpserver.HTTPInterfaces = (*responseWriterWrapper)(nil)
+	_ io.ReaderFrom             = (*responseWriterWrapper)(nil)
+)
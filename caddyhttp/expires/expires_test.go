@@ -0,0 +1,85 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expires
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestExpires(t *testing.T) {
+	e := Expires{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			switch r.URL.Path {
+			case "/logo":
+				w.Header().Set("Content-Type", "image/png")
+			case "/own.css":
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			w.Write([]byte("ok"))
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Pattern: regexp.MustCompile(`\.css$`), Duration: 30 * 24 * time.Hour},
+			{Pattern: regexp.MustCompile(`\.html$`), Duration: 5 * time.Minute},
+			{Header: "Content-Type", Pattern: regexp.MustCompile(`^image/`), Duration: time.Hour},
+		},
+	}
+
+	for i, test := range []struct {
+		path         string
+		cacheControl string
+		expires      time.Duration
+	}{
+		{"/style.css", "max-age=2592000", 30 * 24 * time.Hour},
+		{"/index.html", "max-age=300", 5 * time.Minute},
+		{"/logo", "max-age=3600", time.Hour},
+		{"/own.css", "no-cache", 0},
+		{"/data.json", "", 0},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		rec := httptest.NewRecorder()
+		before := time.Now()
+		if _, err := e.ServeHTTP(rec, req); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+
+		if got := rec.Header().Get("Cache-Control"); got != test.cacheControl {
+			t.Errorf("Test %d: Expected Cache-Control %q, got %q", i, test.cacheControl, got)
+		}
+		expires := rec.Header().Get("Expires")
+		if test.expires == 0 {
+			if expires != "" {
+				t.Errorf("Test %d: Expected no Expires header, got %q", i, expires)
+			}
+			continue
+		}
+		when, err := http.ParseTime(expires)
+		if err != nil {
+			t.Fatalf("Test %d: Invalid Expires header %q: %v", i, expires, err)
+		}
+		if want := before.Add(test.expires).Truncate(time.Second); when.Before(want) || when.After(want.Add(2*time.Second)) {
+			t.Errorf("Test %d: Expected Expires around %v, got %v", i, want, when)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expires
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("expires", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new Expires middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := expiresParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Expires{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func expiresParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		if len(c.RemainingArgs()) != 0 {
+			return nil, c.ArgErr()
+		}
+		for c.NextBlock() {
+			var rule Rule
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "match":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+			case "match_header":
+				if len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				rule.Header = args[0]
+				args = args[1:]
+			default:
+				return nil, c.Errf("unknown subdirective: %s", what)
+			}
+
+			// paths are matched by glob, so that a pattern
+			// like *.css doesn't match /success.html too; a
+			// bare extension like .css matches as a suffix
+			expr := args[0]
+			if what == "match" {
+				if strings.HasPrefix(expr, ".") {
+					expr = "*" + expr
+				}
+				expr = globExpr(expr)
+			}
+			re, err := caddy.CompileRegexp(expr)
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			rule.Pattern = re
+
+			rule.Duration, err = parseDuration(args[1])
+			if err != nil {
+				return nil, c.Errf("invalid duration %s: %v", args[1], err)
+			}
+
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// globExpr returns a regular expression that matches a whole
+// path against glob, where * matches any characters, slashes
+// included, and ? matches any one character but a slash.
+func globExpr(glob string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, ch := range glob {
+		switch ch {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+// durationUnits are the units of parseDuration
+// beyond those understood by time.ParseDuration.
+var durationUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// parseDuration parses a Go duration like "5m" or "1h30m", or
+// a whole number of days, weeks or years like "30d" or "1y".
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil && len(s) > 1 {
+		unit, ok := durationUnits[s[len(s)-1]]
+		if !ok {
+			return 0, err
+		}
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(n) * unit
+	} else if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, strconv.ErrRange
+	}
+	return d, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expires
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `expires {
+		match *.css 30d
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Expires)
+	if !ok {
+		t.Fatalf("Expected handler to be type Expires, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestExpiresParse(t *testing.T) {
+	type expectedRule struct {
+		header   string
+		pattern  string
+		duration time.Duration
+	}
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []expectedRule
+	}{
+		{`expires {
+			match *.css 30d
+			match /pages/?.html 5m
+			match_header Content-Type ^image/ 1y
+		}`, false, []expectedRule{
+			{"", `^.*\.css$`, 30 * 24 * time.Hour},
+			{"", `^/pages/[^/]\.html$`, 5 * time.Minute},
+			{"Content-Type", "^image/", 365 * 24 * time.Hour},
+		}},
+		{`expires {
+			match /static/* 1h30m
+		}`, false, []expectedRule{
+			{"", `^/static/.*$`, 90 * time.Minute},
+		}},
+		{`expires {
+			match .css 30d
+		}`, false, []expectedRule{
+			{"", `^.*\.css$`, 30 * 24 * time.Hour},
+		}},
+		{`expires`, false, nil},
+		{`expires /foo`, true, nil},
+		{`expires {
+			match .css
+		}`, true, nil},
+		{`expires {
+			match .css forever
+		}`, true, nil},
+		{`expires {
+			match .css -1d
+		}`, true, nil},
+		{`expires {
+			match_header Content-Type ( 1d
+		}`, true, nil},
+		{`expires {
+			match_header Content-Type 1d
+		}`, true, nil},
+		{`expires {
+			max_age 1d
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := expiresParse(caddy.NewTestController("http", test.input))
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d rules, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, rule := range actual {
+			expected := test.expected[j]
+			if rule.Header != expected.header {
+				t.Errorf("Test %d, rule %d: expected header %q, got %q", i, j, expected.header, rule.Header)
+			}
+			if rule.Pattern.String() != expected.pattern {
+				t.Errorf("Test %d, rule %d: expected pattern %q, got %q", i, j, expected.pattern, rule.Pattern)
+			}
+			if rule.Duration != expected.duration {
+				t.Errorf("Test %d, rule %d: expected duration %v, got %v", i, j, expected.duration, rule.Duration)
+			}
+		}
+	}
+}
+
+func TestExpiresGlob(t *testing.T) {
+	rules, err := expiresParse(caddy.NewTestController("http", `expires {
+		match *.css 30d
+		match /static/* 1h
+		match .woff2 1y
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for i, test := range []struct {
+		path     string
+		expected time.Duration
+	}{
+		{"/style.css", 30 * 24 * time.Hour},
+		{"/assets/site.css", 30 * 24 * time.Hour},
+		{"/success.html", 0},
+		{"/style.css.map", 0},
+		{"/static/js/app.js", time.Hour},
+		{"/other/static/app.js", 0},
+		{"/fonts/a.woff2", 365 * 24 * time.Hour},
+		{"/fonts/a.woff2x", 0},
+	} {
+		var got time.Duration
+		if rule := match(rules, test.path, nil); rule != nil {
+			got = rule.Duration
+		}
+		if got != test.expected {
+			t.Errorf("Test %d: Expected %v for %s, got %v", i, test.expected, test.path, got)
+		}
+	}
+}
@@ -38,6 +38,9 @@ type Ext struct {
 	// Path to site root
 	Root string
 
+	// Roots of specific paths, which take precedence over Root
+	PathRoots []httpserver.PathRoot
+
 	// List of extensions to try
 	Extensions []string
 }
@@ -46,9 +49,12 @@ type Ext struct {
 func (e Ext) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	urlpath := strings.TrimSuffix(r.URL.Path, "/")
 	if len(r.URL.Path) > 0 && path.Ext(urlpath) == "" && r.URL.Path[len(r.URL.Path)-1] != '/' {
+		root := httpserver.RootFor(urlpath, e.Root, e.PathRoots)
 		for _, ext := range e.Extensions {
-			_, err := os.Stat(httpserver.SafePath(e.Root, urlpath) + ext)
-			if err == nil {
+			// only regular files count; a directory named
+			// like "about.html" is not a page
+			info, err := os.Stat(httpserver.SafePath(root, urlpath) + ext)
+			if err == nil && !info.IsDir() {
 				r.URL.Path = urlpath + ext
 				break
 			}
@@ -0,0 +1,109 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extensions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestExt(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"about.html", "docs.md"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "blog.html"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ext := Ext{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			fmt.Fprint(w, r.URL.Path)
+			return 0, nil
+		}),
+		Root:       root,
+		Extensions: []string{".html", ".htm", ".md"},
+	}
+
+	for i, test := range []struct {
+		path, expected string
+	}{
+		{"/about", "/about.html"},
+		{"/docs", "/docs.md"},
+		{"/blog", "/blog"}, // directory, not a file
+		{"/missing", "/missing"},
+		{"/about/", "/about/"},
+		{"/about.txt", "/about.txt"},
+	} {
+		rec := httptest.NewRecorder()
+		ext.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if got := rec.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected path %s to be served as %s, got %s", i, test.path, test.expected, got)
+		}
+	}
+}
+
+func TestExtPathRoots(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"public/docs/faq.html", "build/docs/guide.html"} {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ext := Ext{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			fmt.Fprint(w, r.URL.Path)
+			return 0, nil
+		}),
+		Root:       filepath.Join(root, "public"),
+		PathRoots:  []httpserver.PathRoot{{Path: "/docs", Root: filepath.Join(root, "build")}},
+		Extensions: []string{".html"},
+	}
+
+	for i, test := range []struct {
+		path, expected string
+	}{
+		{"/docs/guide", "/docs/guide.html"},
+		{"/docs/faq", "/docs/faq"}, // only in the site root
+	} {
+		rec := httptest.NewRecorder()
+		ext.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if got := rec.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected path %s to be served as %s, got %s", i, test.path, test.expected, got)
+		}
+	}
+}
@@ -23,13 +23,14 @@ func init() {
 	caddy.RegisterPlugin("ext", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
 // setup configures a new instance of 'extensions' middleware for clean URLs.
 func setup(c *caddy.Controller) error {
 	cfg := httpserver.GetConfig(c)
-	root := cfg.Root
+	root, pathRoots := cfg.Root, cfg.PathRoots
 
 	exts, err := extParse(c)
 	if err != nil {
@@ -41,6 +42,7 @@ func setup(c *caddy.Controller) error {
 			Next:       next,
 			Extensions: exts,
 			Root:       root,
+			PathRoots:  pathRoots,
 		}
 	})
 
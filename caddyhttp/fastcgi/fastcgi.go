@@ -47,6 +47,10 @@ type Handler struct {
 	Root    string
 	FileSys http.FileSystem
 
+	// Roots of specific paths, which take precedence over
+	// Root and FileSys
+	PathRoots []httpserver.PathRoot
+
 	// These are sent to CGI scripts in env variables
 	SoftwareName    string
 	SoftwareVersion string
@@ -56,7 +60,12 @@ type Handler struct {
 
 // ServeHTTP satisfies the httpserver.Handler interface.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if root := httpserver.RootFor(r.URL.Path, h.Root, h.PathRoots); root != h.Root {
+		h.Root, h.FileSys = root, http.Dir(root)
+	}
 	for _, rule := range h.Rules {
+		rule.Root = httpserver.RootFor(r.URL.Path, rule.Root, rule.PathRoots)
+
 		// First requirement: Base path must match request path. If it doesn't,
 		// we check to make sure the leading slash is not missing, and if so,
 		// we check again with it prepended. This is in case people forget
@@ -174,7 +183,7 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 			writeHeader(w, resp)
 
 			// Write the response body
-			_, err = io.Copy(w, resp.Body)
+			_, err = httpserver.ReadFrom(w, resp.Body)
 			if err != nil {
 				return http.StatusBadGateway, err
 			}
@@ -377,6 +386,10 @@ type Rule struct {
 	// directory of the parent virtual host.
 	Root string
 
+	// Roots of specific paths, which take precedence over Root. Defaults
+	// to those of the parent virtual host, unless Root is set.
+	PathRoots []httpserver.PathRoot
+
 	// The path in the URL will be split into two, with the first piece ending
 	// with the value of SplitPath. The first piece will be assumed as the
 	// actual resource (CGI script) name, and the second piece will be set to
@@ -51,6 +51,7 @@ func setup(c *caddy.Controller) error {
 			Rules:           rules,
 			Root:            cfg.Root,
 			FileSys:         http.Dir(cfg.Root),
+			PathRoots:       cfg.PathRoots,
 			SoftwareName:    caddy.AppName,
 			SoftwareVersion: caddy.AppVersion,
 			ServerName:      cfg.Addr.Host,
@@ -69,6 +70,14 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 	if err != nil {
 		return nil, err
 	}
+	var absPathRoots []httpserver.PathRoot
+	for _, pr := range cfg.PathRoots {
+		root, err := filepath.Abs(pr.Root)
+		if err != nil {
+			return nil, err
+		}
+		absPathRoots = append(absPathRoots, httpserver.PathRoot{Path: pr.Path, Root: root})
+	}
 
 	for c.Next() {
 		args := c.RemainingArgs()
@@ -79,6 +88,7 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 
 		rule := Rule{
 			Root:           absRoot,
+			PathRoots:      absPathRoots,
 			Path:           args[0],
 			ConnectTimeout: defaultTimeout,
 			ReadTimeout:    defaultTimeout,
@@ -107,6 +117,7 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 					return rules, c.ArgErr()
 				}
 				rule.Root = c.Val()
+				rule.PathRoots = nil
 
 			case "ext":
 				if !c.NextArg() {
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -68,6 +69,30 @@ func TestSetup(t *testing.T) {
 	}
 }
 
+func TestSetupPathRoots(t *testing.T) {
+	c := caddy.NewTestController("http", `fastcgi / 127.0.0.1:9000
+	fastcgi /app 127.0.0.1:9001 {
+		root /srv/app
+	}`)
+	cfg := httpserver.GetConfig(c)
+	cfg.PathRoots = []httpserver.PathRoot{{Path: "/static", Root: "build"}}
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	handler := cfg.Middleware()[0](httpserver.EmptyNext).(Handler)
+
+	if len(handler.PathRoots) != 1 || handler.PathRoots[0].Root != "build" {
+		t.Errorf("Expected the path roots of the site, got %v", handler.PathRoots)
+	}
+	abs, _ := filepath.Abs("build")
+	if pr := handler.Rules[0].PathRoots; len(pr) != 1 || pr[0].Path != "/static" || pr[0].Root != abs {
+		t.Errorf("Expected the absolute path roots of the site, got %v", pr)
+	}
+	if pr := handler.Rules[1].PathRoots; pr != nil {
+		t.Errorf("Expected no path roots with a root of its own, got %v", pr)
+	}
+}
+
 func TestFastcgiParse(t *testing.T) {
 	tests := []struct {
 		inputFastcgiConfig    string
@@ -0,0 +1,88 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filecache implements the filecache directive, which
+// keeps small static files in memory.
+package filecache
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func init() {
+	caddy.RegisterPlugin("filecache", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+const (
+	// DefaultMaxFileSize is the size of the largest file
+	// cached by default: 256 KB.
+	DefaultMaxFileSize = 256 * 1024
+
+	// DefaultMaxSize is the default total size of the
+	// cached files of a site: 64 MB.
+	DefaultMaxSize = 64 * 1024 * 1024
+)
+
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	for c.Next() {
+		if cfg.FileCache != nil {
+			return c.Err("filecache already configured for this site")
+		}
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+
+		maxFileSize, maxSize := int64(DefaultMaxFileSize), int64(DefaultMaxSize)
+		var fileSizeSet bool
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			size := httpserver.ParseSize(c.Val())
+			if size <= 0 {
+				return c.Errf("invalid size: %s", c.Val())
+			}
+			if c.NextArg() {
+				return c.ArgErr()
+			}
+
+			switch what {
+			case "max_file_size":
+				maxFileSize, fileSizeSet = size, true
+			case "max_size":
+				maxSize = size
+			default:
+				return c.Errf("unknown subdirective: %s", what)
+			}
+		}
+		if maxFileSize > maxSize {
+			if fileSizeSet {
+				return c.Err("max_file_size must not exceed max_size")
+			}
+			maxFileSize = maxSize
+		}
+
+		cfg.FileCache = staticfiles.NewFileCache(maxFileSize, maxSize)
+	}
+
+	return nil
+}
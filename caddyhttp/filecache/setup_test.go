@@ -0,0 +1,78 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filecache
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input               string
+		shouldErr           bool
+		expectedMaxFileSize int64
+		expectedMaxSize     int64
+	}{
+		{`filecache`, false, DefaultMaxFileSize, DefaultMaxSize},
+		{`filecache {
+			max_file_size 64kb
+			max_size 10MB
+		}`, false, 64 * 1024, 10 * 1024 * 1024},
+		{`filecache {
+			max_size 2048
+		}`, false, 2048, 2048},
+		{`filecache 1MB`, true, 0, 0},
+		{`filecache {
+			max_size
+		}`, true, 0, 0},
+		{`filecache {
+			max_size lots
+		}`, true, 0, 0},
+		{`filecache {
+			max_file_size 2MB
+			max_size 1MB
+		}`, true, 0, 0},
+		{`filecache {
+			max_entries 10
+		}`, true, 0, 0},
+		{`filecache
+		filecache`, true, 0, 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		fc := httpserver.GetConfig(c).FileCache
+		if fc == nil {
+			t.Fatalf("Test %d: Expected a file cache to be configured", i)
+		}
+		if fc.MaxFileSize != test.expectedMaxFileSize {
+			t.Errorf("Test %d: Expected MaxFileSize %d, got %d", i, test.expectedMaxFileSize, fc.MaxFileSize)
+		}
+		if fc.MaxSize != test.expectedMaxSize {
+			t.Errorf("Test %d: Expected MaxSize %d, got %d", i, test.expectedMaxSize, fc.MaxSize)
+		}
+	}
+}
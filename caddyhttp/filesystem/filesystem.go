@@ -0,0 +1,68 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filesystem lets plugins provide the file system that a site
+// serves its static files from, such as SFTP servers, archives or
+// encrypted stores, without forking the file server. Providers are
+// registered by name and selected per site with the filesystem
+// directive.
+package filesystem
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/mholt/caddy"
+)
+
+// Provider creates a file system for a site. It is called with the
+// dispenser positioned on the type name of the filesystem directive,
+// so providers read their own arguments with c.RemainingArgs and
+// their own options with c.NextBlock. The site config is available
+// through httpserver.GetConfig(c), for example to resolve paths
+// relative to the site root.
+type Provider func(c *caddy.Controller) (http.FileSystem, error)
+
+var (
+	providers   = make(map[string]Provider)
+	providersMu sync.RWMutex
+)
+
+func init() {
+	Register("local", localProvider)
+	Register("tar", tarProvider)
+}
+
+// Register makes p available to the filesystem directive as
+// the type name. It is meant to be called from init functions
+// of plugins. Registering the same name twice panics.
+func Register(name string, p Provider) {
+	if name == "" {
+		panic("file system provider must have a name")
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, dup := providers[name]; dup {
+		panic("file system provider named " + name + " already registered")
+	}
+	providers[name] = p
+}
+
+// lookup returns the provider registered as name.
+func lookup(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("filesystem", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup selects the file system the site serves files from.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	var fs http.FileSystem
+	for c.Next() {
+		if fs != nil {
+			return c.Err("filesystem can only be used once per site")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		name := c.Val()
+		p, ok := lookup(name)
+		if !ok {
+			return c.Errf("unknown file system type '%s'; is the plugin providing it plugged in?", name)
+		}
+		var err error
+		fs, err = p(c)
+		if err != nil {
+			return err
+		}
+		if fs == nil {
+			return c.Errf("file system type '%s' provided no file system", name)
+		}
+	}
+
+	cfg.FileSystem = fs
+	return nil
+}
+
+// localProvider serves files from a directory on disk, which
+// defaults to the site root; relative paths are relative to it.
+func localProvider(c *caddy.Controller) (http.FileSystem, error) {
+	root := httpserver.GetConfig(c).Root
+	args := c.RemainingArgs()
+	if len(args) > 1 {
+		return nil, c.ArgErr()
+	}
+	if c.NextBlock() {
+		return nil, c.Errf("unknown subdirective: %s", c.Val())
+	}
+	if len(args) == 1 {
+		return http.Dir(sitePath(root, args[0])), nil
+	}
+	return http.Dir(root), nil
+}
+
+// sitePath resolves name relative to the site root
+// unless it is absolute.
+func sitePath(root, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(root, name)
+}
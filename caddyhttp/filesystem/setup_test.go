@@ -0,0 +1,87 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_filesystem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "site.tar"), tarball(t, map[string]string{"index.html": "tar"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Register("test-null", func(c *caddy.Controller) (http.FileSystem, error) {
+		c.RemainingArgs()
+		return nil, nil
+	})
+	defer func() {
+		providersMu.Lock()
+		delete(providers, "test-null")
+		providersMu.Unlock()
+	}()
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  http.FileSystem
+	}{
+		{input: `filesystem local`, expected: http.Dir(root)},
+		{input: `filesystem local public`, expected: http.Dir(filepath.Join(root, "public"))},
+		{input: `filesystem local /srv/www`, expected: http.Dir("/srv/www")},
+		{input: `filesystem tar site.tar`},
+		{input: `filesystem`, shouldErr: true},
+		{input: `filesystem sftp host`, shouldErr: true},
+		{input: `filesystem local a b`, shouldErr: true},
+		{input: "filesystem local {\n\tfoo\n}", shouldErr: true},
+		{input: `filesystem tar missing.tar`, shouldErr: true},
+		{input: `filesystem tar site.tar nodir`, shouldErr: true},
+		{input: `filesystem test-null`, shouldErr: true},
+		{input: "filesystem local\nfilesystem local", shouldErr: true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		cfg := httpserver.GetConfig(c)
+		cfg.Root = root
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if test.expected != nil && cfg.FileSystem != test.expected {
+			t.Errorf("Test %d: Expected file system %v, got %v", i, test.expected, cfg.FileSystem)
+		}
+		if _, ok := cfg.FileSystem.(*TarFS); test.expected == nil && !ok {
+			t.Errorf("Test %d: Expected a tar file system, got %T", i, cfg.FileSystem)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// tarProvider serves files from a tar archive, optionally gzipped,
+// which is read into memory when the site is set up:
+//
+//	filesystem tar <archive> [dir]
+//
+// where dir is the directory within the archive to serve.
+func tarProvider(c *caddy.Controller) (http.FileSystem, error) {
+	args := c.RemainingArgs()
+	if len(args) == 0 || len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	if c.NextBlock() {
+		return nil, c.Errf("unknown subdirective: %s", c.Val())
+	}
+	f, err := os.Open(sitePath(httpserver.GetConfig(c).Root, args[0]))
+	if err != nil {
+		return nil, c.Errf("opening tar archive: %v", err)
+	}
+	defer f.Close()
+	fs, err := ReadTar(f)
+	if err != nil {
+		return nil, c.Errf("reading tar archive %s: %v", args[0], err)
+	}
+	if len(args) == 2 {
+		dir := path.Clean("/" + args[1])
+		if e, ok := fs.entries[dir]; !ok || !e.dir {
+			return nil, c.Errf("tar archive %s has no directory %s", args[0], dir)
+		}
+		fs = fs.sub(dir)
+	}
+	return fs, nil
+}
+
+// TarFS is a read-only, in-memory file system
+// holding the regular files of a tar archive.
+type TarFS struct {
+	entries map[string]*tarEntry
+}
+
+type tarEntry struct {
+	name     string
+	dir      bool
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	children []string
+}
+
+// ReadTar reads a tar archive, which may be gzipped, from r.
+// Only regular files and directories are kept; parent
+// directories missing from the archive are made up.
+func ReadTar(r io.Reader) (*TarFS, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var ar io.Reader = bytes.NewReader(buf)
+	if len(buf) > 2 && buf[0] == 0x1f && buf[1] == 0x8b {
+		gz, err := gzip.NewReader(ar)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		ar = gz
+	}
+
+	fs := &TarFS{entries: map[string]*tarEntry{
+		"/": {name: "/", dir: true, mode: os.ModeDir | 0555},
+	}}
+	tr := tar.NewReader(ar)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean("/" + hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e := fs.mkdirAll(name)
+			e.modTime = hdr.ModTime
+		case tar.TypeReg, tar.TypeRegA:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if e, ok := fs.entries[name]; ok && e.dir {
+				return nil, fmt.Errorf("%s is both a file and a directory", name)
+			}
+			parent := fs.mkdirAll(path.Dir(name))
+			if parent == nil {
+				return nil, fmt.Errorf("%s is inside a file", name)
+			}
+			if _, ok := fs.entries[name]; !ok {
+				parent.children = append(parent.children, name)
+			}
+			fs.entries[name] = &tarEntry{
+				name:    name,
+				mode:    os.FileMode(hdr.Mode).Perm(),
+				modTime: hdr.ModTime,
+				data:    data,
+			}
+		}
+	}
+	for _, e := range fs.entries {
+		sort.Strings(e.children)
+	}
+	return fs, nil
+}
+
+// mkdirAll returns the directory entry of name, creating
+// it and its parents if needed, or nil if a file is in
+// the way.
+func (fs *TarFS) mkdirAll(name string) *tarEntry {
+	if e, ok := fs.entries[name]; ok {
+		if !e.dir {
+			return nil
+		}
+		return e
+	}
+	parent := fs.mkdirAll(path.Dir(name))
+	if parent == nil {
+		return nil
+	}
+	e := &tarEntry{name: name, dir: true, mode: os.ModeDir | 0555}
+	fs.entries[name] = e
+	parent.children = append(parent.children, name)
+	return e
+}
+
+// sub returns the file system rooted at the directory dir.
+func (fs *TarFS) sub(dir string) *TarFS {
+	sub := &TarFS{entries: make(map[string]*tarEntry)}
+	for name, e := range fs.entries {
+		if name != dir && !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+		rel := func(n string) string { return path.Clean("/" + strings.TrimPrefix(n, dir)) }
+		moved := *e
+		moved.name = rel(name)
+		moved.children = make([]string, len(e.children))
+		for i, child := range e.children {
+			moved.children[i] = rel(child)
+		}
+		sub.entries[moved.name] = &moved
+	}
+	return sub
+}
+
+// Open implements http.FileSystem.
+func (fs *TarFS) Open(name string) (http.File, error) {
+	e, ok := fs.entries[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &tarFile{Reader: bytes.NewReader(e.data), fs: fs, entry: e}, nil
+}
+
+// tarFile is an open file or directory of a TarFS.
+type tarFile struct {
+	*bytes.Reader
+	fs    *TarFS
+	entry *tarEntry
+	read  int
+}
+
+func (f *tarFile) Close() error { return nil }
+
+func (f *tarFile) Stat() (os.FileInfo, error) { return tarFileInfo{f.entry}, nil }
+
+func (f *tarFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.entry.dir {
+		return nil, &os.PathError{Op: "readdir", Path: f.entry.name, Err: os.ErrInvalid}
+	}
+	rest := f.entry.children[f.read:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if len(rest) > count {
+			rest = rest[:count]
+		}
+	}
+	infos := make([]os.FileInfo, len(rest))
+	for i, name := range rest {
+		infos[i] = tarFileInfo{f.fs.entries[name]}
+	}
+	f.read += len(rest)
+	return infos, nil
+}
+
+// tarFileInfo implements os.FileInfo for entries of a TarFS.
+type tarFileInfo struct{ e *tarEntry }
+
+func (fi tarFileInfo) Name() string       { return path.Base(fi.e.name) }
+func (fi tarFileInfo) Size() int64        { return int64(len(fi.e.data)) }
+func (fi tarFileInfo) Mode() os.FileMode  { return fi.e.mode }
+func (fi tarFileInfo) ModTime() time.Time { return fi.e.modTime }
+func (fi tarFileInfo) IsDir() bool        { return fi.e.dir }
+func (fi tarFileInfo) Sys() interface{}   { return nil }
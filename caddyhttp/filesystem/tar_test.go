@@ -0,0 +1,133 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+// tarball returns a tar archive of files.
+func tarball(t *testing.T, files map[string]string) []byte {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarFS(t *testing.T) {
+	files := map[string]string{
+		"./index.html":      "index",
+		"css/site.css":      "body{}",
+		"blog/2019/a.html":  "a",
+		"blog/2019/b.html":  "b",
+		"blog/../evil.html": "evil",
+	}
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(tarball(t, files))
+	gz.Close()
+
+	for _, archive := range [][]byte{tarball(t, files), gzipped.Bytes()} {
+		fs, err := ReadTar(bytes.NewReader(archive))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		for name, expected := range map[string]string{
+			"/index.html":       "index",
+			"css/site.css":      "body{}",
+			"/blog/2019/b.html": "b",
+			"/evil.html":        "evil",
+			"/../index.html":    "index",
+		} {
+			f, err := fs.Open(name)
+			if err != nil {
+				t.Errorf("Opening %s: expected no error, got: %v", name, err)
+				continue
+			}
+			b, _ := ioutil.ReadAll(f)
+			f.Close()
+			if string(b) != expected {
+				t.Errorf("Opening %s: expected '%s', got '%s'", name, expected, b)
+			}
+		}
+		if _, err := fs.Open("/missing.html"); err == nil {
+			t.Error("Expected error opening missing file")
+		}
+
+		d, err := fs.Open("/blog/2019")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, err := d.Readdir(1)
+		if err != nil || len(first) != 1 || first[0].Name() != "a.html" {
+			t.Errorf("Expected first entry a.html, got %v (%v)", first, err)
+		}
+		rest, err := d.Readdir(0)
+		if err != nil || len(rest) != 1 || rest[0].Name() != "b.html" {
+			t.Errorf("Expected remaining entry b.html, got %v (%v)", rest, err)
+		}
+		if _, err := d.Readdir(1); err != io.EOF {
+			t.Errorf("Expected io.EOF after last entry, got %v", err)
+		}
+
+		sub := fs.sub("/blog")
+		if f, err := sub.Open("/2019/a.html"); err != nil {
+			t.Errorf("Expected sub file system to open /2019/a.html, got: %v", err)
+		} else {
+			f.Close()
+		}
+		if _, err := sub.Open("/index.html"); err == nil {
+			t.Error("Expected sub file system to hide files outside it")
+		}
+		root, _ := sub.Open("/")
+		if infos, _ := root.Readdir(-1); len(infos) != 1 || infos[0].Name() != "2019" {
+			t.Errorf("Expected sub root to list 2019, got %v", infos)
+		}
+
+		// the file server must be able to serve it
+		rec := httptest.NewRecorder()
+		http.FileServer(fs).ServeHTTP(rec, httptest.NewRequest("GET", "/css/site.css", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "body{}" {
+			t.Errorf("Expected file server to serve site.css, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+}
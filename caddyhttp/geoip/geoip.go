@@ -0,0 +1,141 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geoip provides middleware that looks up the location
+// of clients in a MaxMind DB (GeoIP2 or GeoLite2) database. The
+// location is exposed as placeholders and, optionally, request
+// headers for upstream applications, and requests can be allowed
+// or denied by country.
+package geoip
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// GeoIP is middleware that adds the location of the client
+// to requests and filters them by country.
+type GeoIP struct {
+	Next httpserver.Handler
+
+	db *reader
+
+	// Headers makes the location be set in request headers
+	// (X-GeoIP-Country-Code and so on) for upstreams.
+	Headers bool
+
+	// Allow, if not empty, are the only countries (ISO 3166-1
+	// codes) requests are allowed from. Deny are countries
+	// requests are not allowed from.
+	Allow map[string]bool
+	Deny  map[string]bool
+}
+
+// location is what is known about where a client is.
+type location struct {
+	countryCode string
+	countryName string
+	regionCode  string
+	regionName  string
+	city        string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (g GeoIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	loc := g.locate(r)
+
+	if len(g.Allow) > 0 && !g.Allow[loc.countryCode] {
+		return http.StatusForbidden, nil
+	}
+	if g.Deny[loc.countryCode] {
+		return http.StatusForbidden, nil
+	}
+
+	if repl, ok := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer); ok {
+		repl.Set("geoip_country_code", loc.countryCode)
+		repl.Set("geoip_country_name", loc.countryName)
+		repl.Set("geoip_region_code", loc.regionCode)
+		repl.Set("geoip_region_name", loc.regionName)
+		repl.Set("geoip_city", loc.city)
+	}
+
+	if g.Headers {
+		for header, value := range map[string]string{
+			"X-GeoIP-Country-Code": loc.countryCode,
+			"X-GeoIP-Country-Name": loc.countryName,
+			"X-GeoIP-Region-Code":  loc.regionCode,
+			"X-GeoIP-Region-Name":  loc.regionName,
+			"X-GeoIP-City":         loc.city,
+		} {
+			// never pass on what the client claims
+			r.Header.Del(header)
+			if value != "" {
+				r.Header.Set(header, value)
+			}
+		}
+	}
+
+	return g.Next.ServeHTTP(w, r)
+}
+
+// locate looks up the location of the client of r.
+func (g GeoIP) locate(r *http.Request) location {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return location{}
+	}
+	record, err := g.db.lookup(ip)
+	if err != nil {
+		log.Printf("[ERROR] Looking up %s in GeoIP database: %v", ip, err)
+		return location{}
+	}
+	return location{
+		countryCode: field(record, "country", "iso_code"),
+		countryName: field(record, "country", "names", "en"),
+		regionCode:  field(record, "subdivisions", 0, "iso_code"),
+		regionName:  field(record, "subdivisions", 0, "names", "en"),
+		city:        field(record, "city", "names", "en"),
+	}
+}
+
+// field returns the string found in record by following
+// path, made of map keys and array indices, or "".
+func field(record interface{}, path ...interface{}) string {
+	v := record
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			v = m[p]
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || p >= len(a) {
+				return ""
+			}
+			v = a[p]
+		}
+	}
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+var testRecords = map[string]interface{}{
+	"81.2.69.0/24": map[string]interface{}{
+		"city": map[string]interface{}{
+			"names": map[string]interface{}{"en": "London"},
+		},
+		"country": map[string]interface{}{
+			"iso_code": "GB",
+			"names":    map[string]interface{}{"en": "United Kingdom"},
+		},
+		"subdivisions": []interface{}{
+			map[string]interface{}{
+				"iso_code": "ENG",
+				"names":    map[string]interface{}{"en": "England"},
+			},
+		},
+	},
+	"89.160.20.0/24": map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "SE",
+			"names":    map[string]interface{}{"en": "Sweden"},
+		},
+	},
+}
+
+// writeTestDB writes a database of testRecords to a
+// temporary file and returns its path.
+func writeTestDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "caddy_geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.mmdb")
+	if err := ioutil.WriteFile(path, buildDB(t, 6, testRecords), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestGeoIP(t *testing.T) {
+	db, err := newReader(buildDB(t, 6, testRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		geoip          GeoIP
+		remoteAddr     string
+		clientHeader   string
+		expectedStatus int
+		expectedRepl   string
+		expectedHeader string
+	}{
+		{
+			geoip:          GeoIP{},
+			remoteAddr:     "81.2.69.142:1234",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "GB United Kingdom ENG England London",
+		},
+		{
+			geoip:          GeoIP{},
+			remoteAddr:     "89.160.20.112:1234",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "SE Sweden   ",
+		},
+		{
+			geoip:          GeoIP{},
+			remoteAddr:     "127.0.0.1:1234",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "    ",
+		},
+		{
+			geoip:          GeoIP{Headers: true},
+			remoteAddr:     "81.2.69.142:1234",
+			clientHeader:   "US",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "GB United Kingdom ENG England London",
+			expectedHeader: "GB",
+		},
+		{
+			geoip:          GeoIP{Headers: true},
+			remoteAddr:     "127.0.0.1:1234",
+			clientHeader:   "US",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "    ",
+		},
+		{
+			geoip:          GeoIP{Allow: map[string]bool{"GB": true}},
+			remoteAddr:     "81.2.69.142:1234",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "GB United Kingdom ENG England London",
+		},
+		{
+			geoip:          GeoIP{Allow: map[string]bool{"GB": true}},
+			remoteAddr:     "89.160.20.112:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			geoip:          GeoIP{Allow: map[string]bool{"GB": true}},
+			remoteAddr:     "127.0.0.1:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			geoip:          GeoIP{Deny: map[string]bool{"SE": true}},
+			remoteAddr:     "89.160.20.112:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			geoip:          GeoIP{Deny: map[string]bool{"SE": true}},
+			remoteAddr:     "127.0.0.1:1234",
+			expectedStatus: http.StatusOK,
+			expectedRepl:   "    ",
+		},
+	} {
+		var gotRepl, gotHeader string
+		g := test.geoip
+		g.db = db
+		g.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			repl := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer)
+			gotRepl = repl.Replace("{geoip_country_code} {geoip_country_name} {geoip_region_code} {geoip_region_name} {geoip_city}")
+			gotHeader = r.Header.Get("X-GeoIP-Country-Code")
+			return http.StatusOK, nil
+		})
+
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: could not create request: %v", i, err)
+		}
+		req.RemoteAddr = test.remoteAddr
+		if test.clientHeader != "" {
+			req.Header.Set("X-GeoIP-Country-Code", test.clientHeader)
+		}
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(req.Context(), httpserver.ReplacerCtxKey, httpserver.NewReplacer(req, nil, ""))
+		req = req.WithContext(ctx)
+
+		status, err := g.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if gotRepl != test.expectedRepl {
+			t.Errorf("Test %d: expected placeholders %q, got %q", i, test.expectedRepl, gotRepl)
+		}
+		if test.geoip.Headers && gotHeader != test.expectedHeader {
+			t.Errorf("Test %d: expected header %q, got %q", i, test.expectedHeader, gotHeader)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// metadataStart marks the beginning of the metadata
+// section at the end of a MaxMind DB file.
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the size of the zeros between
+// the search tree and the data section.
+const dataSectionSeparator = 16
+
+// reader looks up records in a database in the MaxMind DB
+// format, as used by GeoIP2 and GeoLite2. The whole file is
+// kept in memory. See https://maxmind.github.io/MaxMind-DB/.
+type reader struct {
+	buf         []byte
+	nodeCount   uint
+	recordSize  uint
+	ipVersion   uint
+	ipv4Start   uint
+	dataSection []byte
+}
+
+// openReader loads the database at path.
+func openReader(path string) (*reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(buf)
+}
+
+func newReader(buf []byte) (*reader, error) {
+	i := bytes.LastIndex(buf, metadataStart)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata not found")
+	}
+	meta, _, err := decoder{buf[i+len(metadataStart):]}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata: %v", err)
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("reading metadata: not a map")
+	}
+	r := &reader{buf: buf}
+	for key, dst := range map[string]*uint{
+		"node_count":  &r.nodeCount,
+		"record_size": &r.recordSize,
+		"ip_version":  &r.ipVersion,
+	} {
+		v, ok := m[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("reading metadata: missing %s", key)
+		}
+		*dst = uint(v)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	r.dataSection = buf[treeSize+dataSectionSeparator : i]
+
+	// IPv4 addresses are looked up under ::/96 in IPv6 trees
+	if r.ipVersion == 6 {
+		for bit := 0; bit < 96 && r.ipv4Start < r.nodeCount; bit++ {
+			r.ipv4Start, err = r.record(r.ipv4Start, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// lookup returns the record for ip, or nil if there is none.
+func (r *reader) lookup(ip net.IP) (interface{}, error) {
+	node, bits := uint(0), 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, node, bits = ip4, r.ipv4Start, 32
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	var err error
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node, err = r.record(node, bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("invalid search tree")
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	v, _, err := decoder{r.dataSection}.decode(offset)
+	return v, err
+}
+
+// record reads the left (bit 0) or right (bit 1) record of node.
+func (r *reader) record(node, bit uint) (uint, error) {
+	size := r.recordSize / 4
+	off := node * size
+	if off+size > uint(len(r.buf)) {
+		return 0, errors.New("invalid search tree")
+	}
+	b := r.buf[off : off+size]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errTruncated = errors.New("truncated data section")
+
+// decoder decodes values of the data section buf into
+// map[string]interface{}, []interface{}, string, []byte,
+// uint64, int64, float64 and bool values. Integers too
+// big for uint64 are returned as []byte.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset and returns it
+// along with the offset of the value that follows.
+func (d decoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		var extra uint
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			m[k], offset, err = d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			var err error
+			a[i], offset, err = d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case typeUint128:
+		if size <= 8 {
+			var v uint64
+			for _, c := range b {
+				v = v<<8 | uint64(c)
+			}
+			return v, offset, nil
+		}
+		return append([]byte(nil), b...), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
+
+// pointer decodes the pointer whose control byte is ctrl
+// and returns the offset it points to, as well as the
+// offset of the value that follows it.
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	var ptr uint
+	if n < 4 {
+		ptr = uint(ctrl & 7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		ptr = ptr<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		ptr += 2048
+	case 3:
+		ptr += 526336
+	}
+	return ptr, offset + n, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// buildDB returns a MaxMind DB with 24-bit records where
+// each of the CIDR networks in records maps to its value.
+// IPv4 networks are stored under ::/96 if ipVersion is 6.
+func buildDB(t *testing.T, ipVersion int, records map[string]interface{}) []byte {
+	// children of nodes are node indexes, or -1 when empty,
+	// or -2-i for the record of network i
+	type node [2]int
+	nodes := []node{{-1, -1}}
+	var data []byte
+	var offsets []int
+
+	var cidrs []string
+	for cidr := range records {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := network.IP
+		ones, _ := network.Mask.Size()
+		if ipVersion == 6 && len(ip) == net.IPv4len {
+			ip = append(make(net.IP, 12), ip...)
+			ones += 96
+		}
+		n := 0
+		for bit := 0; bit < ones; bit++ {
+			b := int(ip[bit/8]>>(7-uint(bit%8))) & 1
+			if bit == ones-1 {
+				nodes[n][b] = -2 - i
+				break
+			}
+			if child := nodes[n][b]; child < 0 {
+				// more specific networks inherit the record
+				nodes = append(nodes, node{child, child})
+				nodes[n][b] = len(nodes) - 1
+			}
+			n = nodes[n][b]
+		}
+		offsets = append(offsets, len(data))
+		data = append(data, encode(records[cidr])...)
+	}
+
+	var buf []byte
+	for _, n := range nodes {
+		for _, child := range n {
+			v := child
+			switch {
+			case child == -1:
+				v = len(nodes)
+			case child < -1:
+				v = len(nodes) + dataSectionSeparator + offsets[-2-child]
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataStart...)
+	buf = append(buf, encode(map[string]interface{}{
+		"node_count":                  uint64(len(nodes)),
+		"record_size":                 uint64(24),
+		"ip_version":                  uint64(ipVersion),
+		"binary_format_major_version": uint64(2),
+		"database_type":               "Test-City",
+	})...)
+	return buf
+}
+
+// encode encodes v in the data section format.
+func encode(v interface{}) []byte {
+	ctrl := func(typ, size int) []byte {
+		var b []byte
+		switch {
+		case size < 29:
+			b = []byte{byte(size)}
+		case size < 285:
+			b = []byte{29, byte(size - 29)}
+		default:
+			size -= 285
+			b = []byte{30, byte(size >> 8), byte(size)}
+		}
+		if typ > 7 {
+			return append([]byte{b[0], byte(typ - 7)}, b[1:]...)
+		}
+		b[0] |= byte(typ << 5)
+		return b
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(v)), v...)
+	case uint64:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		trimmed := bytes.TrimLeft(b[:], "\x00")
+		return append(ctrl(typeUint64, len(trimmed)), trimmed...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return ctrl(typeBool, size)
+	case []interface{}:
+		b := ctrl(typeArray, len(v))
+		for _, e := range v {
+			b = append(b, encode(e)...)
+		}
+		return b
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := ctrl(typeMap, len(v))
+		for _, k := range keys {
+			b = append(b, encode(k)...)
+			b = append(b, encode(v[k])...)
+		}
+		return b
+	}
+	panic("cannot encode value")
+}
+
+func TestReaderLookup(t *testing.T) {
+	records := map[string]interface{}{
+		"10.0.0.0/8":     map[string]interface{}{"n": uint64(1)},
+		"10.1.0.0/16":    map[string]interface{}{"n": uint64(2)},
+		"192.168.1.0/24": map[string]interface{}{"n": uint64(3)},
+	}
+	for _, ipVersion := range []int{4, 6} {
+		r, err := newReader(buildDB(t, ipVersion, records))
+		if err != nil {
+			t.Fatalf("IPv%d: unexpected error: %v", ipVersion, err)
+		}
+		for i, test := range []struct {
+			ip       string
+			expected interface{}
+		}{
+			{"10.2.3.4", map[string]interface{}{"n": uint64(1)}},
+			{"10.1.3.4", map[string]interface{}{"n": uint64(2)}},
+			{"192.168.1.200", map[string]interface{}{"n": uint64(3)}},
+			{"192.168.2.1", nil},
+			{"8.8.8.8", nil},
+			{"2001:db8::1", nil},
+		} {
+			v, err := r.lookup(net.ParseIP(test.ip))
+			if err != nil {
+				t.Errorf("IPv%d test %d: unexpected error: %v", ipVersion, i, err)
+			}
+			if !reflect.DeepEqual(v, test.expected) {
+				t.Errorf("IPv%d test %d: expected %v, got %v", ipVersion, i, test.expected, v)
+			}
+		}
+	}
+}
+
+func TestNewReaderInvalid(t *testing.T) {
+	if _, err := newReader([]byte("not a database")); err == nil {
+		t.Error("expected error for missing metadata")
+	}
+	buf := append([]byte(nil), metadataStart...)
+	buf = append(buf, encode(map[string]interface{}{"node_count": uint64(1)})...)
+	if _, err := newReader(buf); err == nil {
+		t.Error("expected error for incomplete metadata")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	long := string(bytes.Repeat([]byte("a"), 300))
+	for i, test := range []struct {
+		buf      []byte
+		expected interface{}
+	}{
+		{encode("hello"), "hello"},
+		{encode(long), long},
+		{encode(uint64(70000)), uint64(70000)},
+		{encode(true), true},
+		{encode([]interface{}{"a", uint64(1)}), []interface{}{"a", uint64(1)}},
+		// int32 -1
+		{[]byte{0x04, 0x01, 0xFF, 0xFF, 0xFF, 0xFF}, int64(-1)},
+		// double 1.5
+		{[]byte{0x68, 0x3F, 0xF8, 0, 0, 0, 0, 0, 0}, 1.5},
+		// map whose value is a pointer to the string after it
+		{append([]byte{0xE1, 0x41, 'k', 0x20, 0x05}, encode("v")...), map[string]interface{}{"k": "v"}},
+	} {
+		v, _, err := decoder{test.buf}.decode(0)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expected, v)
+		}
+	}
+
+	if _, _, err := (decoder{encode("hello")[:3]}).decode(0); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
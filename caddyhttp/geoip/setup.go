@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("geoip", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new GeoIP middleware instance.
+func setup(c *caddy.Controller) error {
+	g, err := geoipParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		g.Next = next
+		return g
+	})
+
+	return nil
+}
+
+func geoipParse(c *caddy.Controller) (GeoIP, error) {
+	var g GeoIP
+
+	for c.Next() {
+		if g.db != nil {
+			return g, c.Err("geoip already configured for this site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return g, c.ArgErr()
+		}
+		db, err := openReader(args[0])
+		if err != nil {
+			return g, c.Errf("loading GeoIP database: %v", err)
+		}
+		g.db = db
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "headers":
+				if len(args) != 0 {
+					return g, c.ArgErr()
+				}
+				g.Headers = true
+			case "allow", "deny":
+				if len(args) == 0 {
+					return g, c.ArgErr()
+				}
+				countries := make(map[string]bool)
+				for _, country := range args {
+					countries[strings.ToUpper(country)] = true
+				}
+				if what == "allow" {
+					g.Allow = countries
+				} else {
+					g.Deny = countries
+				}
+			default:
+				return g, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+		if g.Allow != nil && g.Deny != nil {
+			return g, c.Err("use either allow or deny, not both")
+		}
+	}
+
+	return g, nil
+}
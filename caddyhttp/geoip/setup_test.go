@@ -0,0 +1,118 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	path, cleanup := writeTestDB(t)
+	defer cleanup()
+
+	c := caddy.NewTestController("http", "geoip "+path)
+	err := setup(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(GeoIP)
+	if !ok {
+		t.Fatalf("Expected handler to be type GeoIP, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestGeoIPParse(t *testing.T) {
+	path, cleanup := writeTestDB(t)
+	defer cleanup()
+
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectHeaders bool
+		expectAllow   []string
+		expectDeny    []string
+	}{
+		{"geoip " + path, false, false, nil, nil},
+		{"geoip " + path + ` {
+			headers
+		}`, false, true, nil, nil},
+		{"geoip " + path + ` {
+			allow gb se
+		}`, false, false, []string{"GB", "SE"}, nil},
+		{"geoip " + path + ` {
+			deny CN
+		}`, false, false, nil, []string{"CN"}},
+		{"geoip " + path + ` {
+			allow GB
+			deny CN
+		}`, true, false, nil, nil},
+		{"geoip " + path + ` {
+			allow
+		}`, true, false, nil, nil},
+		{"geoip " + path + ` {
+			headers yes
+		}`, true, false, nil, nil},
+		{"geoip " + path + ` {
+			country
+		}`, true, false, nil, nil},
+		{"geoip", true, false, nil, nil},
+		{"geoip " + path + " extra", true, false, nil, nil},
+		{"geoip /does/not/exist.mmdb", true, false, nil, nil},
+		{"geoip " + path + "\ngeoip " + path, true, false, nil, nil},
+	} {
+		g, err := geoipParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if g.Headers != test.expectHeaders {
+			t.Errorf("Test %d: expected headers %v, got %v", i, test.expectHeaders, g.Headers)
+		}
+		if len(g.Allow) != len(test.expectAllow) {
+			t.Errorf("Test %d: expected allow %v, got %v", i, test.expectAllow, g.Allow)
+		}
+		for _, country := range test.expectAllow {
+			if !g.Allow[country] {
+				t.Errorf("Test %d: expected %s to be allowed", i, country)
+			}
+		}
+		if len(g.Deny) != len(test.expectDeny) {
+			t.Errorf("Test %d: expected deny %v, got %v", i, test.expectDeny, g.Deny)
+		}
+		for _, country := range test.expectDeny {
+			if !g.Deny[country] {
+				t.Errorf("Test %d: expected %s to be denied", i, country)
+			}
+		}
+	}
+}
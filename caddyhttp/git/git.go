@@ -0,0 +1,211 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package git is middleware that deploys a site from a git
+// repository: it clones the repository into the site root and
+// keeps it up to date by pulling on an interval or when a
+// webhook is called, optionally running commands after updates.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitBinary is the git executable to run.
+var gitBinary = "git"
+
+// Command is a command to run after the repository is updated.
+type Command struct {
+	Command    string
+	Args       []string
+	Background bool
+}
+
+// String returns the command line.
+func (c Command) String() string {
+	return strings.TrimSpace(c.Command + " " + strings.Join(c.Args, " "))
+}
+
+// Repo is a git repository checked out for a site.
+type Repo struct {
+	// URL of the repository to clone
+	URL string
+
+	// Path is where the repository is checked out
+	Path string
+
+	// Branch to check out; the default branch if empty
+	Branch string
+
+	// Interval for pulling; 0 means no pulling on an interval
+	Interval time.Duration
+
+	// Then are the commands to run after each update
+	Then []Command
+
+	// HookPath, if set, is the path of the webhook that
+	// makes the repository be pulled, and HookSecret
+	// authenticates calls to it
+	HookPath   string
+	HookSecret string
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// Update clones the repository if it is not checked out yet,
+// or pulls the latest changes. The commands to run after
+// updates are run if anything changed.
+func (r *Repo) Update() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(r.Path, ".git")); os.IsNotExist(err) {
+		if err := r.clone(); err != nil {
+			return err
+		}
+		log.Printf("[INFO] git: Cloned %s into %s", r.URL, r.Path)
+		return r.runThen()
+	}
+
+	before, err := r.head()
+	if err != nil {
+		return err
+	}
+	args := []string{"pull", "--ff-only"}
+	if r.Branch != "" {
+		args = append(args, "origin", r.Branch)
+	}
+	if _, err := r.git(r.Path, args...); err != nil {
+		return err
+	}
+	after, err := r.head()
+	if err != nil {
+		return err
+	}
+	if before == after {
+		return nil
+	}
+	log.Printf("[INFO] git: Updated %s to %s", r.Path, after)
+	return r.runThen()
+}
+
+func (r *Repo) clone() error {
+	args := []string{"clone"}
+	if r.Branch != "" {
+		args = append(args, "--branch", r.Branch)
+	}
+	args = append(args, "--", r.URL, r.Path)
+
+	// the site root may already exist, but git
+	// only clones into empty directories
+	if infos, err := readDirNames(r.Path); err == nil && len(infos) > 0 {
+		return fmt.Errorf("git: cannot clone %s into %s: directory is not empty", r.URL, r.Path)
+	}
+	_, err := r.git("", args...)
+	return err
+}
+
+// head returns the commit that is checked out.
+func (r *Repo) head() (string, error) {
+	out, err := r.git(r.Path, "rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+// git runs git with args in dir and returns its output.
+func (r *Repo) git(dir string, args ...string) (string, error) {
+	cmd := exec.Command(gitBinary, args...)
+	cmd.Dir = dir
+	// never wait for credentials on a terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// runThen runs the commands to run after updates, in the
+// repository, stopping at the first one that fails.
+func (r *Repo) runThen() error {
+	for _, then := range r.Then {
+		cmd := exec.Command(then.Command, then.Args...)
+		cmd.Dir = r.Path
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if then.Background {
+			log.Printf("[INFO] git: Nonblocking Command \"%s\"", then)
+			if err := cmd.Start(); err != nil {
+				return err
+			}
+			go cmd.Wait()
+			continue
+		}
+		log.Printf("[INFO] git: Blocking Command \"%s\"", then)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git: running \"%s\": %v", then, err)
+		}
+	}
+	return nil
+}
+
+// Start pulls the repository every Interval
+// in the background, until Stop is called.
+func (r *Repo) Start() {
+	if r.Interval <= 0 {
+		return
+	}
+	r.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Update(); err != nil {
+					log.Printf("[ERROR] %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(r.stop)
+}
+
+// Stop stops pulling on an interval.
+func (r *Repo) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newOrigin creates a repository with a commit to clone
+// from in a temporary directory, which it returns.
+func newOrigin(t *testing.T) string {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "caddy_git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := filepath.Join(dir, "origin")
+	run(t, "", "init", "-q", origin)
+	commit(t, origin, "index.html", "first")
+	return origin
+}
+
+// commit commits a file with content in repo.
+func commit(t *testing.T, repo, file, content string) {
+	if err := ioutil.WriteFile(filepath.Join(repo, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, repo, "add", file)
+	run(t, repo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", content)
+}
+
+func run(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command(gitBinary, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func TestRepoUpdate(t *testing.T) {
+	origin := newOrigin(t)
+	defer os.RemoveAll(filepath.Dir(origin))
+	site := filepath.Join(filepath.Dir(origin), "site")
+
+	repo := &Repo{
+		URL:  origin,
+		Path: site,
+		Then: []Command{{Command: gitBinary, Args: []string{"tag", "-f", "deployed"}}},
+	}
+
+	// clone
+	if err := repo.Update(); err != nil {
+		t.Fatalf("Expected no error cloning, got: %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(site, "index.html")); err != nil || string(b) != "first" {
+		t.Errorf("Expected cloned index.html to be 'first', got '%s' (error: %v)", b, err)
+	}
+	deployed, err := repo.git(site, "rev-parse", "deployed")
+	if err != nil {
+		t.Errorf("Expected command to run after cloning, got: %v", err)
+	}
+
+	// nothing to pull runs nothing
+	if err := repo.Update(); err != nil {
+		t.Fatalf("Expected no error pulling, got: %v", err)
+	}
+
+	// pull
+	commit(t, origin, "index.html", "second")
+	if err := repo.Update(); err != nil {
+		t.Fatalf("Expected no error pulling, got: %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(site, "index.html")); err != nil || string(b) != "second" {
+		t.Errorf("Expected pulled index.html to be 'second', got '%s' (error: %v)", b, err)
+	}
+	redeployed, err := repo.git(site, "rev-parse", "deployed")
+	if err != nil || redeployed == deployed {
+		t.Errorf("Expected command to run after pulling, got tag at %s (error: %v)", redeployed, err)
+	}
+}
+
+func TestRepoCloneNotEmpty(t *testing.T) {
+	origin := newOrigin(t)
+	defer os.RemoveAll(filepath.Dir(origin))
+	site := filepath.Join(filepath.Dir(origin), "site")
+	if err := os.Mkdir(site, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(site, "stray"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repo{URL: origin, Path: site}
+	if err := repo.Update(); err == nil {
+		t.Error("Expected error cloning into a directory that is not empty")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("git", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures repositories to deploy the site from.
+func setup(c *caddy.Controller) error {
+	repos, err := gitParse(c)
+	if err != nil {
+		return err
+	}
+
+	var hooked []*Repo
+	for _, repo := range repos {
+		repo := repo
+		c.OnStartup(func() error {
+			if err := repo.Update(); err != nil {
+				return err
+			}
+			repo.Start()
+			return nil
+		})
+		c.OnShutdown(func() error {
+			repo.Stop()
+			return nil
+		})
+		if repo.HookPath != "" {
+			hooked = append(hooked, repo)
+		}
+	}
+
+	if len(hooked) > 0 {
+		httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+			return Git{Next: next, Repos: hooked}
+		})
+	}
+
+	return nil
+}
+
+// gitParse parses the git directive:
+//
+//	git [<repo> [<path>]] {
+//		repo     <repo>
+//		path     <path>
+//		branch   <branch>
+//		interval <duration>
+//		hook     <path> [<secret>]
+//		then     <command> [<args...>] [&]
+//	}
+func gitParse(c *caddy.Controller) ([]*Repo, error) {
+	config := httpserver.GetConfig(c)
+	var repos []*Repo
+
+	for c.Next() {
+		repo := &Repo{}
+		var path string
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 2:
+			path = args[1]
+			fallthrough
+		case 1:
+			repo.URL = args[0]
+		case 0:
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "repo", "path", "branch", "interval":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch what {
+				case "repo":
+					repo.URL = args[0]
+				case "path":
+					path = args[0]
+				case "branch":
+					repo.Branch = args[0]
+				case "interval":
+					dur, err := time.ParseDuration(args[0])
+					if err != nil {
+						return nil, c.Errf("invalid interval '%s': %v", args[0], err)
+					}
+					if dur < time.Second {
+						return nil, c.Errf("interval must be at least a second, got %s", dur)
+					}
+					repo.Interval = dur
+				}
+			case "hook":
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				if !strings.HasPrefix(args[0], "/") {
+					return nil, c.Errf("hook path must begin with '/', got '%s'", args[0])
+				}
+				repo.HookPath = args[0]
+				if len(args) == 2 {
+					repo.HookSecret = args[1]
+				}
+			case "then":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				command, cmdArgs, err := caddy.SplitCommandAndArgs(strings.Join(args, " "))
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				then := Command{Command: command, Args: cmdArgs}
+				if n := len(then.Args); n > 0 && then.Args[n-1] == "&" {
+					then.Background = true
+					then.Args = then.Args[:n-1]
+				}
+				repo.Then = append(repo.Then, then)
+			default:
+				return nil, c.Errf("unknown git property '%s'", what)
+			}
+		}
+
+		if repo.URL == "" {
+			return nil, c.Err("git: no repository given")
+		}
+
+		// the repository is checked out in the site root
+		// by default, or under it if path is relative
+		repo.Path = config.Root
+		if filepath.IsAbs(path) {
+			repo.Path = path
+		} else if path != "" {
+			repo.Path = filepath.Join(config.Root, path)
+		}
+		repo.Path = filepath.Clean(repo.Path)
+
+		for _, other := range repos {
+			if other.Path == repo.Path {
+				return nil, c.Errf("git: more than one repository for '%s'", repo.Path)
+			}
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, nil
+}
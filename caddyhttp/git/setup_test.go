@@ -0,0 +1,144 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `git https://example.com/site.git {
+		hook /deploy secret
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Git)
+	if !ok {
+		t.Fatalf("Expected handler to be type Git, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	// without a hook, there is nothing to serve
+	c = caddy.NewTestController("http", `git https://example.com/site.git`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if mids := httpserver.GetConfig(c).Middleware(); len(mids) != 0 {
+		t.Errorf("Expected no middleware, got %d", len(mids))
+	}
+}
+
+func TestGitParse(t *testing.T) {
+	root := filepath.Clean("/srv/www")
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []*Repo
+	}{
+		{`git https://example.com/site.git`, false, []*Repo{
+			{URL: "https://example.com/site.git", Path: root},
+		}},
+		{`git https://example.com/site.git public`, false, []*Repo{
+			{URL: "https://example.com/site.git", Path: filepath.Join(root, "public")},
+		}},
+		{`git {
+			repo https://example.com/site.git
+			path /opt/site
+			branch production
+			interval 10m
+			hook /deploy secret
+		}`, false, []*Repo{
+			{URL: "https://example.com/site.git", Path: filepath.Clean("/opt/site"), Branch: "production",
+				Interval: 10 * time.Minute, HookPath: "/deploy", HookSecret: "secret"},
+		}},
+		{`git https://example.com/site.git {
+			then hugo --minify
+			then ./watch.sh &
+		}`, false, []*Repo{
+			{URL: "https://example.com/site.git", Path: root, Then: []Command{
+				{Command: "hugo", Args: []string{"--minify"}},
+				{Command: "./watch.sh", Args: []string{}, Background: true},
+			}},
+		}},
+		{`git https://example.com/a.git a
+		git https://example.com/b.git b`, false, []*Repo{
+			{URL: "https://example.com/a.git", Path: filepath.Join(root, "a")},
+			{URL: "https://example.com/b.git", Path: filepath.Join(root, "b")},
+		}},
+		{`git https://example.com/a.git
+		git https://example.com/b.git`, true, nil},
+		{`git`, true, nil},
+		{`git a b c`, true, nil},
+		{`git https://example.com/site.git {
+			interval soon
+		}`, true, nil},
+		{`git https://example.com/site.git {
+			interval 10ms
+		}`, true, nil},
+		{`git https://example.com/site.git {
+			hook deploy
+		}`, true, nil},
+		{`git https://example.com/site.git {
+			then
+		}`, true, nil},
+		{`git https://example.com/site.git {
+			key id_rsa
+		}`, true, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		httpserver.GetConfig(c).Root = root
+		repos, err := gitParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(repos) != len(test.expected) {
+			t.Errorf("Test %d: expected %d repos, got %d", i, len(test.expected), len(repos))
+			continue
+		}
+		for j, expected := range test.expected {
+			got := repos[j]
+			if got.URL != expected.URL || got.Path != expected.Path || got.Branch != expected.Branch ||
+				got.Interval != expected.Interval || got.HookPath != expected.HookPath ||
+				got.HookSecret != expected.HookSecret || len(got.Then) != len(expected.Then) {
+				t.Errorf("Test %d, repo %d: expected %+v, got %+v", i, j, expected, got)
+				continue
+			}
+			for k, then := range expected.Then {
+				if got.Then[k].String() != then.String() || got.Then[k].Background != then.Background {
+					t.Errorf("Test %d, repo %d: expected command %d to be %+v, got %+v", i, j, k, then, got.Then[k])
+				}
+			}
+		}
+	}
+}
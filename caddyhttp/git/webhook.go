@@ -0,0 +1,104 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// maxPayloadSize is the most of a webhook payload that is read.
+const maxPayloadSize = 1 << 20
+
+// Git is middleware that answers the webhooks of repos.
+type Git struct {
+	Next  httpserver.Handler
+	Repos []*Repo
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (g Git) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, repo := range g.Repos {
+		if repo.HookPath == "" || r.URL.Path != repo.HookPath {
+			continue
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			return http.StatusMethodNotAllowed, nil
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+		if err != nil {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		if !repo.authorized(r.Header, body) {
+			return http.StatusForbidden, nil
+		}
+
+		// pulling can take a while, so don't keep the caller waiting
+		go func() {
+			if err := repo.Update(); err != nil {
+				log.Printf("[ERROR] %v", err)
+			}
+		}()
+		w.WriteHeader(http.StatusOK)
+		return 0, nil
+	}
+	return g.Next.ServeHTTP(w, r)
+}
+
+// authorized reports whether the webhook call with header and
+// body is made with the secret of the repo. The signatures of
+// GitHub, Gitea and Gogs and the token of GitLab are supported.
+func (r *Repo) authorized(header http.Header, body []byte) bool {
+	if r.HookSecret == "" {
+		return true
+	}
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(r.HookSecret)) == 1
+	}
+	if sig := header.Get("X-Hub-Signature-256"); sig != "" {
+		return validMAC(sha256.New, strings.TrimPrefix(sig, "sha256="), r.HookSecret, body)
+	}
+	if sig := header.Get("X-Hub-Signature"); sig != "" {
+		return validMAC(sha1.New, strings.TrimPrefix(sig, "sha1="), r.HookSecret, body)
+	}
+	for _, name := range []string{"X-Gitea-Signature", "X-Gogs-Signature"} {
+		if sig := header.Get(name); sig != "" {
+			return validMAC(sha256.New, sig, r.HookSecret, body)
+		}
+	}
+	return false
+}
+
+// validMAC reports whether sig is the hex-encoded HMAC of body.
+func validMAC(h func() hash.Hash, sig, secret string, body []byte) bool {
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestWebhookAuthorized(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/master"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	for i, test := range []struct {
+		secret string
+		header http.Header
+		expect bool
+	}{
+		{"", http.Header{}, true},
+		{"secret", http.Header{}, false},
+		{"secret", http.Header{"X-Hub-Signature-256": {"sha256=" + sig}}, true},
+		{"secret", http.Header{"X-Hub-Signature-256": {"sha256=00" + sig[2:]}}, false},
+		{"secret", http.Header{"X-Gitea-Signature": {sig}}, true},
+		{"secret", http.Header{"X-Gitlab-Token": {"secret"}}, true},
+		{"secret", http.Header{"X-Gitlab-Token": {"guess"}}, false},
+	} {
+		repo := &Repo{HookSecret: test.secret}
+		if got := repo.authorized(test.header, body); got != test.expect {
+			t.Errorf("Test %d: expected authorized to be %v, got %v", i, test.expect, got)
+		}
+	}
+}
+
+func TestWebhookServeHTTP(t *testing.T) {
+	g := Git{
+		Next:  httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) { return http.StatusTeapot, nil }),
+		Repos: []*Repo{{HookPath: "/deploy", HookSecret: "secret"}},
+	}
+
+	for i, test := range []struct {
+		method string
+		path   string
+		token  string
+		expect int
+	}{
+		{"GET", "/", "", http.StatusTeapot},
+		{"GET", "/deploy", "", http.StatusMethodNotAllowed},
+		{"POST", "/deploy", "guess", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader("{}"))
+		if test.token != "" {
+			r.Header.Set("X-Gitlab-Token", test.token)
+		}
+		status, err := g.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if status != test.expect {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expect, status)
+		}
+	}
+}
@@ -30,6 +30,7 @@ func init() {
 	caddy.RegisterPlugin("gzip", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 
 	initWriterPool()
@@ -151,6 +152,13 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom copies src through Write with a pooled buffer;
+// io.Copy would allocate a new one for every response, such
+// as each file served by the file server.
+func (w *gzipResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return copyBufPool.Copy(writerOnly{w}, src)
+}
+
 //Writer use a lazy way to initialize Writer
 func (w *gzipResponseWriter) Writer() io.Writer {
 	if w.internalWriter == nil {
@@ -159,5 +167,16 @@ func (w *gzipResponseWriter) Writer() io.Writer {
 	return w.internalWriter
 }
 
+// copyBufPool holds the buffers response bodies are copied
+// to the compressor with. The compressor buffers what it is
+// given by itself, so larger buffers would only cost memory.
+var copyBufPool = httpserver.NewBufferPool(16 * 1024)
+
+// writerOnly hides the ReadFrom method of the Writer it
+// embeds, so ReadFrom can copy through Write.
+type writerOnly struct {
+	io.Writer
+}
+
 // Interface guards
 var _ httpserver.HTTPInterfaces = (*gzipResponseWriter)(nil)
@@ -41,6 +41,10 @@ func DefaultExtFilter() ExtFilter {
 	return m
 }
 
+// defaultExtFilter is shared by every config that doesn't
+// set extensions, since it is never modified.
+var defaultExtFilter = DefaultExtFilter()
+
 // ExtFilter is RequestFilter for file name extensions.
 type ExtFilter struct {
 	// Exts is the file name extensions to accept
@@ -16,8 +16,11 @@ package gzip
 
 import (
 	"compress/gzip"
+	"io"
 	"net/http"
 	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 // ResponseFilter determines if the response should be gzipped.
@@ -105,3 +108,16 @@ func (r *ResponseFilterWriter) Write(b []byte) (int, error) {
 	}
 	return r.ResponseWriter.Write(b)
 }
+
+// ReadFrom copies src through the compressor if filters are
+// satisfied, or else lets the underlying ResponseWriter copy it,
+// which may send a file without copying it at all.
+func (r *ResponseFilterWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !r.statusCodeWritten {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.shouldCompress {
+		return r.gzipResponseWriter.ReadFrom(src)
+	}
+	return httpserver.ReadFrom(r.ResponseWriter, src)
+}
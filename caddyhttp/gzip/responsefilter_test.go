@@ -17,9 +17,12 @@ package gzip
 import (
 	"compress/gzip"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -107,6 +110,55 @@ func TestResponseFilterWriter(t *testing.T) {
 	}
 }
 
+func TestResponseFilterWriterReadFrom(t *testing.T) {
+	for i, ts := range []struct {
+		body           string
+		shouldCompress bool
+	}{
+		{"Hello gzip\n", false},
+		{strings.Repeat("Hello the world is great\n", 2000), true},
+	} {
+		server := Gzip{Configs: []Config{
+			{ResponseFilters: []ResponseFilter{LengthFilter(15)}},
+		}}
+		server.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Length", fmt.Sprint(len(ts.body)))
+			// copy like http.ServeContent does, from a reader without WriteTo
+			if _, err := io.Copy(w, struct{ io.Reader }{strings.NewReader(ts.body)}); err != nil {
+				t.Errorf("Test %d: Copying body: %v", i, err)
+			}
+			return 200, nil
+		})
+
+		r := urlRequest("/")
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if _, err := server.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Serving: %v", i, err)
+		}
+
+		if !ts.shouldCompress {
+			if w.Body.String() != ts.body {
+				t.Errorf("Test %d: No compression expected, found %q", i, w.Body.String())
+			}
+			continue
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+			t.Errorf("Test %d: Expected gzip Content-Encoding, got %q", i, enc)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("Test %d: Expected sniffed Content-Type, got %q", i, ct)
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Test %d: Reading gzipped body: %v", i, err)
+		}
+		if body, err := ioutil.ReadAll(gz); err != nil || string(body) != ts.body {
+			t.Errorf("Test %d: Expected body to decompress to the original (%v)", i, err)
+		}
+	}
+}
+
 func TestResponseGzippedOutput(t *testing.T) {
 	server := Gzip{Configs: []Config{
 		{ResponseFilters: []ResponseFilter{SkipCompressedFilter{}}},
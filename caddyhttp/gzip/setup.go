@@ -120,7 +120,7 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 		if len(extFilter.Exts) > 0 {
 			config.RequestFilters = append(config.RequestFilters, extFilter)
 		} else {
-			config.RequestFilters = append(config.RequestFilters, DefaultExtFilter())
+			config.RequestFilters = append(config.RequestFilters, defaultExtFilter)
 		}
 
 		config.ResponseFilters = append(config.ResponseFilters, SkipCompressedFilter{})
@@ -18,6 +18,7 @@
 package header
 
 import (
+	"io"
 	"net/http"
 	"strings"
 
@@ -92,6 +93,15 @@ func (rww *responseWriterWrapper) Write(d []byte) (int, error) {
 	return rww.ResponseWriterWrapper.Write(d)
 }
 
+// ReadFrom applies the header changes, then hands the body,
+// which this wrapper never alters, to httpserver.ReadFrom.
+func (rww *responseWriterWrapper) ReadFrom(src io.Reader) (int64, error) {
+	if !rww.wroteHeader {
+		rww.WriteHeader(http.StatusOK)
+	}
+	return httpserver.ReadFrom(rww.ResponseWriterWrapper.ResponseWriter, src)
+}
+
 func (rww *responseWriterWrapper) WriteHeader(status int) {
 	if rww.wroteHeader {
 		return
@@ -121,4 +131,7 @@ func (rww *responseWriterWrapper) delHeader(key string) {
 }
 
 // Interface guards
-var _ httpserver.HTTPInterfaces = (*responseWriterWrapper)(nil)
+var (
+	_ httpserver.HTTPInterfaces = (*responseWriterWrapper)(nil)
+	_ io.ReaderFrom             = (*responseWriterWrapper)(nil)
+)
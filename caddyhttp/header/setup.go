@@ -25,6 +25,7 @@ func init() {
 	caddy.RegisterPlugin("header", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
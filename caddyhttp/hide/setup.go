@@ -0,0 +1,64 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hide implements the hide directive, which keeps files
+// that should never be public, such as dotfiles and version
+// control directories, out of the file server and directory
+// listings.
+package hide
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("hide", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// DefaultPatterns are hidden when hide is given no patterns:
+// dotfiles and dot directories (among them .git, .hg, .svn
+// and .htaccess) except for /.well-known, the directories of
+// other version control systems, and Caddyfiles.
+var DefaultPatterns = []string{".*", "!/.well-known", "CVS", "_darcs", "Caddyfile"}
+
+// setup adds the hide patterns to the site; see
+// staticfiles.FileServer.IsHiddenPath for their syntax.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	for c.Next() {
+		patterns := c.RemainingArgs()
+		if len(patterns) == 0 {
+			patterns = DefaultPatterns
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil || pattern == "!" {
+				return c.Errf("invalid hide pattern '%s'", pattern)
+			}
+		}
+		cfg.HiddenPatterns = append(cfg.HiddenPatterns, patterns...)
+		if c.NextBlock() {
+			return c.Errf("unknown subdirective: %s", c.Val())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hide
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{input: `hide`, expected: DefaultPatterns},
+		{input: `hide /private *.bak`, expected: []string{"/private", "*.bak"}},
+		{input: "hide\nhide !/.public", expected: append(append([]string{}, DefaultPatterns...), "!/.public")},
+		{input: `hide [`, shouldErr: true},
+		{input: `hide !`, shouldErr: true},
+		{input: "hide /private {\n\tfoo\n}", shouldErr: true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if got := httpserver.GetConfig(c).HiddenPatterns; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected patterns %v, got %v", i, test.expected, got)
+		}
+	}
+}
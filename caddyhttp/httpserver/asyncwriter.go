@@ -0,0 +1,179 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLogFlushInterval is how often a buffered log
+// is flushed if no flush interval is configured.
+const DefaultLogFlushInterval = time.Second
+
+// asyncWriter is an io.Writer that queues writes in memory
+// and hands them to the underlying writer from a background
+// goroutine, so that callers never wait on a slow disk or
+// network connection. The queue holds at most max entries;
+// when it is full, the oldest entry is dropped to make room,
+// or, if block is set, writers wait for the queue to be
+// flushed instead.
+type asyncWriter struct {
+	out      io.Writer
+	max      int
+	interval time.Duration
+	block    bool
+
+	mu     sync.Mutex
+	queue  [][]byte
+	space  *sync.Cond // signaled when the queue is taken to be flushed
+	closed bool
+
+	dropped  uint64 // accessed atomically
+	reported uint64 // only accessed by the flushing goroutine
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// newAsyncWriter returns a writer that buffers up to max
+// entries and flushes them to out every interval, or sooner
+// if the queue becomes half full. If block is set, writes wait
+// when the queue is full rather than dropping entries.
+func newAsyncWriter(out io.Writer, max int, interval time.Duration, block bool) *asyncWriter {
+	if interval <= 0 {
+		interval = DefaultLogFlushInterval
+	}
+	w := &asyncWriter{
+		out:      out,
+		max:      max,
+		interval: interval,
+		block:    block,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	w.space = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// Write queues a copy of p. It never blocks on the underlying
+// writer, only on the queue being full if w blocks, and always
+// reports success.
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	entry := make([]byte, len(p))
+	copy(entry, p)
+
+	w.mu.Lock()
+	for w.block && len(w.queue) >= w.max && !w.closed {
+		w.wakeUp()
+		w.space.Wait()
+	}
+	if len(w.queue) >= w.max {
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	w.queue = append(w.queue, entry)
+	n := len(w.queue)
+	w.mu.Unlock()
+
+	if n >= w.max/2 {
+		w.wakeUp()
+	}
+	return len(p), nil
+}
+
+// wakeUp makes the background goroutine flush
+// the queue if it isn't already about to.
+func (w *asyncWriter) wakeUp() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Dropped returns how many entries have been discarded
+// because the queue was full. Blocking writers drop
+// entries only when written to after Close.
+func (w *asyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close flushes all queued entries and stops the background
+// goroutine. It does not close the underlying writer.
+func (w *asyncWriter) Close() error {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.space.Broadcast()
+		w.mu.Unlock()
+		close(w.done)
+	})
+	<-w.stopped
+	return nil
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.done:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush writes every queued entry to the underlying writer
+// in a single call.
+func (w *asyncWriter) flush() {
+	w.mu.Lock()
+	queue := w.queue
+	w.queue = nil
+	w.space.Broadcast()
+	w.mu.Unlock()
+
+	if dropped := w.Dropped(); dropped != w.reported {
+		log.Printf("[WARNING] Log buffer full; dropped %d entries", dropped-w.reported)
+		w.reported = dropped
+	}
+	if len(queue) == 0 {
+		return
+	}
+
+	size := 0
+	for _, entry := range queue {
+		size += len(entry)
+	}
+	buf := make([]byte, 0, size)
+	for _, entry := range queue {
+		buf = append(buf, entry...)
+	}
+	if _, err := w.out.Write(buf); err != nil {
+		log.Printf("[ERROR] Writing buffered log entries: %v", err)
+	}
+}
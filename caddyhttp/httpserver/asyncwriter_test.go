@@ -0,0 +1,179 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriterFlushesOnClose(t *testing.T) {
+	out := new(lockedBuffer)
+	w := newAsyncWriter(out, 100, time.Hour, false)
+	w.Write([]byte("one\n"))
+	w.Write([]byte("two\n"))
+	if got := out.String(); got != "" {
+		t.Errorf("Expected nothing written before flush, got %q", got)
+	}
+	w.Close()
+	if got, expect := out.String(), "one\ntwo\n"; got != expect {
+		t.Errorf("Expected %q after close, got %q", expect, got)
+	}
+}
+
+func TestAsyncWriterFlushInterval(t *testing.T) {
+	out := new(lockedBuffer)
+	w := newAsyncWriter(out, 100, 10*time.Millisecond, false)
+	defer w.Close()
+	w.Write([]byte("entry\n"))
+	for i := 0; i < 100 && out.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, expect := out.String(), "entry\n"; got != expect {
+		t.Errorf("Expected %q to be flushed, got %q", expect, got)
+	}
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	lockedBuffer
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return b.lockedBuffer.Write(p)
+}
+
+func TestAsyncWriterDropsOldest(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	w := newAsyncWriter(out, 2, time.Hour, false)
+
+	// first entry wakes the writer, which then blocks on it
+	w.Write([]byte("a\n"))
+	for i := 0; i < 100; i++ {
+		w.mu.Lock()
+		n := len(w.queue)
+		w.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.Write([]byte("b\n"))
+	w.Write([]byte("c\n"))
+	w.Write([]byte("d\n"))
+	if got := w.Dropped(); got != 1 {
+		t.Errorf("Expected 1 dropped entry, got %d", got)
+	}
+
+	close(out.release)
+	w.Close()
+	if got, expect := out.String(), "a\nc\nd\n"; got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+}
+
+func TestAsyncWriterBlocksWhenFull(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	w := newAsyncWriter(out, 2, time.Hour, true)
+
+	// first entry wakes the writer, which then blocks on it
+	w.Write([]byte("a\n"))
+	for i := 0; i < 100; i++ {
+		w.mu.Lock()
+		n := len(w.queue)
+		w.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.Write([]byte("b\n"))
+	w.Write([]byte("c\n"))
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte("d\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Expected write to a full queue to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(out.release)
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected blocked write to proceed once the queue was flushed")
+	}
+	w.Close()
+	if got, expect := out.String(), "a\nb\nc\nd\n"; got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+	if got := w.Dropped(); got != 0 {
+		t.Errorf("Expected no dropped entries, got %d", got)
+	}
+}
+
+func TestAsyncWriterBlockingAfterClose(t *testing.T) {
+	out := new(lockedBuffer)
+	w := newAsyncWriter(out, 1, time.Hour, true)
+	w.Close()
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if got := w.Dropped(); got != 1 {
+		t.Errorf("Expected writes after close to drop rather than block, got %d dropped", got)
+	}
+}
+
+func TestBufferedLogger(t *testing.T) {
+	l := &Logger{Output: "stdout", BufferSize: 10}
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	out := new(lockedBuffer)
+	l.buffer.out = out
+	l.Println("hello")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := out.String(), "hello\n"; got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+	if l.Dropped() != 0 {
+		t.Errorf("Expected no dropped entries, got %d", l.Dropped())
+	}
+}
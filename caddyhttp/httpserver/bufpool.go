@@ -0,0 +1,71 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"io"
+	"sync"
+)
+
+// BufferPool is a pool of copy buffers of one size. Copying a
+// body with io.Copy allocates a new buffer each time; copying
+// it with a BufferPool reuses buffers across requests instead.
+// Since the best size depends on what is copied, each use
+// should have its own pool.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool returns a pool of buffers of size bytes.
+func NewBufferPool(size int) *BufferPool {
+	bp := &BufferPool{size: size}
+	bp.pool.New = func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return bp
+}
+
+// Size returns the length of the buffers in bp.
+func (bp *BufferPool) Size() int {
+	return bp.size
+}
+
+// Get returns a buffer from bp. It is returned as a
+// pointer so that putting it back does not allocate.
+func (bp *BufferPool) Get() *[]byte {
+	return bp.pool.Get().(*[]byte)
+}
+
+// Put returns buf, obtained from Get, to bp. Buffers
+// that have been resliced to another length are dropped.
+func (bp *BufferPool) Put(buf *[]byte) {
+	if len(*buf) != bp.size {
+		return
+	}
+	bp.pool.Put(buf)
+}
+
+// Copy copies src to dst like io.CopyBuffer does, with a
+// buffer from bp. Like io.CopyBuffer, it uses src's WriteTo or
+// dst's ReadFrom method if there is one, so a ReadFrom method
+// must not call Copy with its own receiver as dst.
+func (bp *BufferPool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := bp.Get()
+	n, err := io.CopyBuffer(dst, src, *buf)
+	bp.Put(buf)
+	return n, err
+}
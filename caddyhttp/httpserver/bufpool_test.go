@@ -0,0 +1,58 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	bp := NewBufferPool(16)
+	if bp.Size() != 16 {
+		t.Errorf("Expected size 16, got %d", bp.Size())
+	}
+
+	buf := bp.Get()
+	if len(*buf) != 16 {
+		t.Errorf("Expected buffer of 16 bytes, got %d", len(*buf))
+	}
+	bp.Put(buf)
+
+	short := (*bp.Get())[:4]
+	bp.Put(&short)
+	for i := 0; i < 10; i++ {
+		if buf := bp.Get(); len(*buf) != 16 {
+			t.Fatalf("Expected resliced buffers to be dropped, got one of %d bytes", len(*buf))
+		}
+	}
+}
+
+func TestBufferPoolCopy(t *testing.T) {
+	bp := NewBufferPool(4)
+	body := strings.Repeat("0123456789", 10)
+
+	var dst bytes.Buffer
+	// hide the WriteTo method of strings.Reader so the buffer is used
+	n, err := bp.Copy(&dst, struct{ io.Reader }{strings.NewReader(body)})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if n != int64(len(body)) || dst.String() != body {
+		t.Errorf("Expected %d bytes %q, got %d bytes %q", len(body), body, n, dst.String())
+	}
+}
@@ -108,7 +108,7 @@ func newIfCond(a, op, b string) (ifCond, error) {
 	case matchOp:
 		// It does regexp matching of a against pattern in b and returns if they match.
 		var err error
-		if i.rex, err = regexp.Compile(i.b); err != nil {
+		if i.rex, err = caddy.CompileRegexp(i.b); err != nil {
 			return ifCond{}, fmt.Errorf("Invalid regular expression: '%s', %v", i.b, err)
 		}
 		i.f = i.matchFunc
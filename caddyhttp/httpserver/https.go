@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddytls"
@@ -37,6 +38,7 @@ func activateHTTPS(cctx caddy.Context) error {
 	markQualifiedForAutoHTTPS(ctx.siteConfigs)
 
 	// place certificates and keys on disk
+	wildcards := managedWildcards(ctx.siteConfigs)
 	for _, c := range ctx.siteConfigs {
 		if !c.TLS.Managed {
 			continue
@@ -44,6 +46,12 @@ func activateHTTPS(cctx caddy.Context) error {
 		if c.TLS.Manager.OnDemand != nil {
 			continue // obtain these certificates on-demand instead
 		}
+		if coveredByWildcard(c.TLS.Hostname, wildcards) {
+			continue // served with the certificate of the wildcard site
+		}
+		if strings.HasPrefix(c.TLS.Hostname, "*.") && c.TLS.Manager.DNSProvider == nil {
+			return fmt.Errorf("%s: wildcard certificates can only be obtained with the DNS challenge; configure a DNS provider with the dns subdirective of tls", c.TLS.Hostname)
+		}
 		err := c.TLS.Manager.ObtainCert(c.TLS.Hostname, operatorPresent)
 		if err != nil {
 			return err
@@ -103,6 +111,7 @@ func markQualifiedForAutoHTTPS(configs []*SiteConfig) {
 // but no certificates will be parsed loaded into the cache, and the returned error
 // value will always be nil.
 func enableAutoHTTPS(configs []*SiteConfig, loadCertificates bool) error {
+	wildcards := managedWildcards(configs)
 	for _, cfg := range configs {
 		if cfg == nil || cfg.TLS == nil || !cfg.TLS.Managed ||
 			cfg.TLS.Manager == nil || cfg.TLS.Manager.OnDemand != nil {
@@ -110,7 +119,8 @@ func enableAutoHTTPS(configs []*SiteConfig, loadCertificates bool) error {
 		}
 		cfg.TLS.Enabled = true
 		cfg.Addr.Scheme = "https"
-		if loadCertificates && certmagic.HostQualifies(cfg.TLS.Hostname) {
+		if loadCertificates && certmagic.HostQualifies(cfg.TLS.Hostname) &&
+			!coveredByWildcard(cfg.TLS.Hostname, wildcards) {
 			_, err := cfg.TLS.Manager.CacheManagedCertificate(cfg.TLS.Hostname)
 			if err != nil {
 				return err
@@ -131,6 +141,37 @@ func enableAutoHTTPS(configs []*SiteConfig, loadCertificates bool) error {
 	return nil
 }
 
+// managedWildcards returns the wildcard hostnames, like
+// *.example.com, of the configs whose certificates are
+// managed and obtained at startup.
+func managedWildcards(configs []*SiteConfig) map[string]bool {
+	wildcards := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg == nil || cfg.TLS == nil || !cfg.TLS.Managed ||
+			cfg.TLS.Manager == nil || cfg.TLS.Manager.OnDemand != nil {
+			continue
+		}
+		if strings.HasPrefix(cfg.TLS.Hostname, "*.") {
+			wildcards[strings.ToLower(cfg.TLS.Hostname)] = true
+		}
+	}
+	return wildcards
+}
+
+// coveredByWildcard reports whether a certificate for one of
+// wildcards is valid for hostname, so that hostname needs no
+// certificate of its own; a wildcard replaces exactly one
+// label. During the handshake, the certificate cache finds
+// the wildcard certificate for such names by itself.
+func coveredByWildcard(hostname string, wildcards map[string]bool) bool {
+	hostname = strings.ToLower(hostname)
+	if strings.HasPrefix(hostname, "*.") {
+		return false
+	}
+	i := strings.Index(hostname, ".")
+	return i > 0 && wildcards["*"+hostname[i:]]
+}
+
 // makePlaintextRedirects sets up redirects from port 80 to the relevant HTTPS
 // hosts. You must pass in all configs, not just configs that qualify, since
 // we must know whether the same host already exists on port 80, and those would
@@ -232,3 +232,26 @@ func TestMarkQualifiedForAutoHTTPS(t *testing.T) {
 func newManagedConfig() *caddytls.Config {
 	return &caddytls.Config{Manager: &certmagic.Config{}}
 }
+
+func TestCoveredByWildcard(t *testing.T) {
+	configs := []*SiteConfig{
+		{Addr: Address{Host: "*.example.com"}, TLS: &caddytls.Config{Managed: true, Hostname: "*.example.com", Manager: &certmagic.Config{}}},
+		{Addr: Address{Host: "*.ondemand.com"}, TLS: &caddytls.Config{Managed: true, Hostname: "*.ondemand.com", Manager: &certmagic.Config{OnDemand: &certmagic.OnDemandConfig{}}}},
+		{Addr: Address{Host: "*.manual.com"}, TLS: &caddytls.Config{Hostname: "*.manual.com", Manager: &certmagic.Config{}}},
+		{},
+	}
+	wildcards := managedWildcards(configs)
+	for hostname, expected := range map[string]bool{
+		"a.example.com":   true,
+		"B.Example.com":   true,
+		"a.b.example.com": false,
+		"example.com":     false,
+		"*.example.com":   false,
+		"a.ondemand.com":  false,
+		"a.manual.com":    false,
+	} {
+		if got := coveredByWildcard(hostname, wildcards); got != expected {
+			t.Errorf("%s: expected covered=%v, got %v", hostname, expected, got)
+		}
+	}
+}
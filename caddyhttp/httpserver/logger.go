@@ -22,6 +22,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	gsyslog "github.com/hashicorp/go-syslog"
 	"github.com/mholt/caddy"
@@ -33,8 +34,24 @@ var remoteSyslogPrefixes = map[string]string{
 	"syslog://":     "udp",
 }
 
+// rfc5424SyslogPrefixes select remote syslog outputs that
+// send messages in the newer RFC 5424 format.
+var rfc5424SyslogPrefixes = map[string]string{
+	"syslog5424+tcp://": "tcp",
+	"syslog5424+udp://": "udp",
+	"syslog5424://":     "udp",
+}
+
+// networkPrefixes select outputs that write plain
+// log lines to a generic UDP or TCP endpoint.
+var networkPrefixes = map[string]string{
+	"tcp://": "tcp",
+	"udp://": "udp",
+}
+
 // Logger is shared between errors and log plugins and supports both logging to
-// a file (with an optional file roller), local and remote syslog servers.
+// a file (with an optional file roller), local and remote syslog servers, and
+// plain UDP or TCP endpoints.
 type Logger struct {
 	Output string
 	*log.Logger
@@ -45,6 +62,17 @@ type Logger struct {
 	V6ipMask     net.IPMask
 	IPMaskExists bool
 	Exceptions   []string
+
+	// BufferSize, if positive, makes writes asynchronous:
+	// up to this many entries are queued in memory and
+	// written out every FlushInterval. When the queue is
+	// full, the oldest entries are dropped, unless
+	// BlockWhenFull is set; then requests wait to log
+	// until the queue has been written out.
+	BufferSize    int
+	FlushInterval time.Duration
+	BlockWhenFull bool
+	buffer        *asyncWriter
 }
 
 // NewTestLogger creates logger suitable for testing purposes
@@ -108,9 +136,20 @@ func (l *Logger) Attach(controller *caddy.Controller) {
 	}
 }
 
+// Dropped returns the number of entries discarded because the
+// log buffer was full. It is always 0 for unbuffered loggers,
+// and for ones that block when full until they are closed.
+func (l Logger) Dropped() uint64 {
+	if l.buffer == nil {
+		return 0
+	}
+	return l.buffer.Dropped()
+}
+
 type syslogAddress struct {
 	network string
 	address string
+	rfc5424 bool
 }
 
 func parseSyslogAddress(location string) *syslogAddress {
@@ -122,10 +161,30 @@ func parseSyslogAddress(location string) *syslogAddress {
 			}
 		}
 	}
+	for prefix, network := range rfc5424SyslogPrefixes {
+		if strings.HasPrefix(location, prefix) {
+			return &syslogAddress{
+				network: network,
+				address: strings.TrimPrefix(location, prefix),
+				rfc5424: true,
+			}
+		}
+	}
 
 	return nil
 }
 
+// parseNetworkAddress returns the network and address of a
+// generic network output, or ok=false if location is not one.
+func parseNetworkAddress(location string) (network, address string, ok bool) {
+	for prefix, network := range networkPrefixes {
+		if strings.HasPrefix(location, prefix) {
+			return network, strings.TrimPrefix(location, prefix), true
+		}
+	}
+	return "", "", false
+}
+
 // Start initializes logger opening files or local/remote syslog connections
 func (l *Logger) Start() error {
 	// initialize mutex on start
@@ -146,11 +205,31 @@ selectwriter:
 		}
 	default:
 		if address := parseSyslogAddress(l.Output); address != nil {
-			l.writer, err = gsyslog.DialLogger(address.network, address.address, gsyslog.LOG_ERR, "LOCAL0", "caddy")
+			if address.rfc5424 {
+				var nw *netWriter
+				nw, err = dialNetWriter(address.network, address.address, true)
+				if err != nil {
+					return err
+				}
+				l.writer = nw
+			} else {
+				l.writer, err = gsyslog.DialLogger(address.network, address.address, gsyslog.LOG_ERR, "LOCAL0", "caddy")
+			}
+
+			if err != nil {
+				return err
+			}
+
+			break selectwriter
+		}
 
+		if network, address, ok := parseNetworkAddress(l.Output); ok {
+			var nw *netWriter
+			nw, err = dialNetWriter(network, address, false)
 			if err != nil {
 				return err
 			}
+			l.writer = nw
 
 			break selectwriter
 		}
@@ -171,7 +250,12 @@ selectwriter:
 		}
 	}
 
-	l.Logger = log.New(l.writer, "", 0)
+	if l.BufferSize > 0 {
+		l.buffer = newAsyncWriter(l.writer, l.BufferSize, l.FlushInterval, l.BlockWhenFull)
+		l.Logger = log.New(l.buffer, "", 0)
+	} else {
+		l.Logger = log.New(l.writer, "", 0)
+	}
 
 	return nil
 
@@ -179,6 +263,11 @@ selectwriter:
 
 // Close closes open log files or connections to syslog.
 func (l *Logger) Close() error {
+	// flush anything still buffered before closing the writer
+	if l.buffer != nil {
+		l.buffer.Close()
+	}
+
 	// don't close stdout or stderr
 	if l.writer == os.Stdout || l.writer == os.Stderr {
 		return nil
@@ -17,15 +17,18 @@
 package httpserver
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	syslog "gopkg.in/mcuadros/go-syslog.v2"
 	"gopkg.in/mcuadros/go-syslog.v2/format"
@@ -134,6 +137,14 @@ func TestLoggingToSyslog(t *testing.T) {
 			Output:         "syslog+udp://127.0.0.1:5662",
 			ExpectedOutput: "Hello world! Test #3 over udp",
 		},
+		{
+			Output:         "syslog5424+tcp://127.0.0.1:5663",
+			ExpectedOutput: "Hello world! Test #4 over tcp in RFC 5424",
+		},
+		{
+			Output:         "syslog5424+udp://127.0.0.1:5664",
+			ExpectedOutput: "Hello world! Test #5 over udp in RFC 5424",
+		},
 	}
 
 	for i, testCase := range testCases {
@@ -158,7 +169,12 @@ func TestLoggingToSyslog(t *testing.T) {
 
 		actual := <-ch
 
-		if content, ok := actual["content"].(string); ok {
+		// RFC 5424 messages carry their text under another key
+		content, ok := actual["content"].(string)
+		if !ok {
+			content, ok = actual["message"].(string)
+		}
+		if ok {
 			if !strings.Contains(content, testCase.ExpectedOutput) {
 				t.Errorf("Test #%d: expected server to capture content: %s, but got: %s", i, testCase.ExpectedOutput, content)
 			}
@@ -168,6 +184,105 @@ func TestLoggingToSyslog(t *testing.T) {
 	}
 }
 
+func TestLoggingToNetwork(t *testing.T) {
+	for i, network := range []string{"tcp", "udp"} {
+		var addr string
+		lines := make(chan string, 1)
+		if network == "tcp" {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			addr = ln.Addr().String()
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				lines <- line
+			}()
+		} else {
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+			addr = pc.LocalAddr().String()
+			go func() {
+				buf := make([]byte, 1024)
+				n, _, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				lines <- string(buf[:n])
+			}()
+		}
+
+		logger := Logger{Output: network + "://" + addr, fileMu: new(sync.RWMutex)}
+		if err := logger.Start(); err != nil {
+			t.Fatalf("Test #%d: expected no error during logger start, got: %v", i, err)
+		}
+		logger.Print("Hello world!")
+
+		select {
+		case line := <-lines:
+			if line != "Hello world!\n" {
+				t.Errorf("Test #%d: expected endpoint to receive 'Hello world!', got: %q", i, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("Test #%d: timed out waiting for log line over %s", i, network)
+		}
+		logger.Close()
+	}
+}
+
+func TestNetWriterStalledEndpoint(t *testing.T) {
+	defer func(timeout time.Duration) { netWriteTimeout = timeout }(netWriteTimeout)
+	netWriteTimeout = 50 * time.Millisecond
+
+	// the endpoint accepts connections but never reads from them
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	w, err := dialNetWriter("tcp", ln.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// large enough to fill the socket buffers
+	msg := bytes.Repeat([]byte("x"), 64<<20)
+	start := time.Now()
+	if _, err := w.Write(msg); err == nil {
+		t.Error("Expected writing to a stalled endpoint to fail")
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("Expected the write to time out quickly, took %v", took)
+	}
+	if len(accepted) != 2 {
+		t.Errorf("Expected the stalled connection to be replaced, got %d connections", len(accepted))
+	}
+	for len(accepted) > 0 {
+		(<-accepted).Close()
+	}
+}
+
 func bootServer(location string, ch chan format.LogParts) (*syslog.Server, error) {
 	address := parseSyslogAddress(location)
 
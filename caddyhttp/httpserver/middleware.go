@@ -225,4 +225,8 @@ const (
 
 	// RequestIDCtxKey is the key for the U4 UUID value
 	RequestIDCtxKey caddy.CtxKey = "request_id"
+
+	// UpstreamTimeoutCtxKey is the key for how long a proxy may
+	// wait for the upstream's response to the request (timeouts)
+	UpstreamTimeoutCtxKey caddy.CtxKey = "upstream_timeout"
 )
@@ -0,0 +1,122 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// rfc5424Priority is the PRI of RFC 5424 messages: facility
+// LOCAL0 and severity ERR, the same as the other syslog outputs.
+const rfc5424Priority = 16*8 + 3
+
+// rfc5424Timestamp is the TIMESTAMP layout of RFC 5424, which
+// allows at most microsecond precision.
+const rfc5424Timestamp = "2006-01-02T15:04:05.000000Z07:00"
+
+// netDialTimeout and netWriteTimeout bound how long a log entry
+// may wait for a remote endpoint, so that a stalled endpoint does
+// not hold up the requests that are being logged.
+var (
+	netDialTimeout  = 5 * time.Second
+	netWriteTimeout = 5 * time.Second
+)
+
+// netWriter writes log entries to a UDP or TCP endpoint, either
+// as they are or framed as RFC 5424 syslog messages. A broken
+// or stalled connection is re-established on the next write.
+type netWriter struct {
+	network  string
+	address  string
+	rfc5424  bool
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// dialNetWriter connects to address on network and returns a
+// writer for it. It fails if the endpoint cannot be reached so
+// that misconfigured outputs are reported at startup.
+func dialNetWriter(network, address string, rfc5424 bool) (*netWriter, error) {
+	w := &netWriter{network: network, address: address, rfc5424: rfc5424, hostname: "-"}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		w.hostname = host
+	}
+	conn, err := net.DialTimeout(network, address, netDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	return w, nil
+}
+
+// Write sends p as one message. It is retried once over
+// a new connection if the current one fails or times out.
+func (w *netWriter) Write(p []byte) (int, error) {
+	msg := p
+	if w.rfc5424 {
+		msg = w.frame(p)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			w.conn, err = net.DialTimeout(w.network, w.address, netDialTimeout)
+			if err != nil {
+				return 0, err
+			}
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+		if _, err = w.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// frame formats p as an RFC 5424 message. Over TCP, messages
+// are prefixed with their length (RFC 6587 octet counting).
+func (w *netWriter) frame(p []byte) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s caddy %d - - %s", rfc5424Priority,
+		time.Now().Format(rfc5424Timestamp), w.hostname, os.Getpid(),
+		bytes.TrimRight(p, "\n"))
+	if w.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+// Close closes the connection.
+func (w *netWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
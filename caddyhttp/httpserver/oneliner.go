@@ -0,0 +1,152 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/caddy"
+)
+
+// proxyCaddyfileLoader loads the Caddyfile made for the -proxy
+// flag, taking the upstreams from the arguments of the program.
+func proxyCaddyfileLoader(serverType string) (caddy.Input, error) {
+	if Proxy == "" {
+		return nil, nil
+	}
+	if serverType != "http" {
+		return nil, fmt.Errorf("-proxy requires the http server type, not %s", serverType)
+	}
+	contents, err := proxyCaddyfile(Proxy, flag.Args())
+	if err != nil {
+		return nil, err
+	}
+	return caddy.CaddyfileInput{
+		Contents:       contents,
+		Filepath:       "-proxy",
+		ServerTypeName: serverType,
+	}, nil
+}
+
+// proxyCaddyfile returns a Caddyfile with a single site that
+// listens on listen and reverse proxies every request to the
+// upstreams, passing along the original Host and client address
+// and allowing websockets, and that logs requests to stdout.
+func proxyCaddyfile(listen string, upstreams []string) ([]byte, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("-proxy needs the addresses to proxy to as arguments, e.g. -proxy :8080 http://localhost:3000")
+	}
+	for _, upstream := range upstreams {
+		if err := checkOneLinerToken(upstream); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	err := writeOneLinerSite(&buf, listen)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "proxy / %s {\n\ttransparent\n\twebsocket\n}\n", strings.Join(upstreams, " "))
+	buf.WriteString("log stdout\n")
+	return buf.Bytes(), nil
+}
+
+// serveCaddyfileLoader loads the Caddyfile made for the -serve flag.
+func serveCaddyfileLoader(serverType string) (caddy.Input, error) {
+	if Serve == "" {
+		return nil, nil
+	}
+	if serverType != "http" {
+		return nil, fmt.Errorf("-serve requires the http server type, not %s", serverType)
+	}
+	listen := Listen
+	if listen == "" {
+		listen = Port
+	}
+	contents, err := serveCaddyfile(Serve, listen, Browse)
+	if err != nil {
+		return nil, err
+	}
+	return caddy.CaddyfileInput{
+		Contents:       contents,
+		Filepath:       "-serve",
+		ServerTypeName: serverType,
+	}, nil
+}
+
+// serveCaddyfile returns a Caddyfile with a single site that
+// listens on listen and serves the files in dir, listing the
+// directories if browse is true, and that logs requests to stdout.
+func serveCaddyfile(dir, listen string, browse bool) ([]byte, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+	var buf bytes.Buffer
+	err = writeOneLinerSite(&buf, listen)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "root \"%s\"\n", strings.Replace(root, `"`, `\"`, -1))
+	if browse {
+		buf.WriteString("browse\n")
+	}
+	buf.WriteString("log stdout\n")
+	return buf.Bytes(), nil
+}
+
+// writeOneLinerSite writes to buf the address and bind directive
+// of a plaintext HTTP site that accepts requests for any host on
+// listen, which is a port or a host:port to bind to.
+func writeOneLinerSite(buf *bytes.Buffer, listen string) error {
+	if err := checkOneLinerToken(listen); err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		// only a port
+		host, port = "", listen
+	}
+	if port == "" {
+		return fmt.Errorf("%s: missing port to listen on", listen)
+	}
+	fmt.Fprintf(buf, "http://:%s\n", port)
+	if host != "" {
+		fmt.Fprintf(buf, "bind %s\n", host)
+	}
+	return nil
+}
+
+// checkOneLinerToken returns an error if val, which is given on
+// the command line, would not be a single token in the Caddyfile.
+func checkOneLinerToken(val string) error {
+	if val == "" || strings.ContainsAny(val, " \t\r\n{}\"#`") {
+		return fmt.Errorf("invalid address: %q", val)
+	}
+	return nil
+}
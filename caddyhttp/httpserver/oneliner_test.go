@@ -0,0 +1,129 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestProxyCaddyfile(t *testing.T) {
+	for i, test := range []struct {
+		listen    string
+		upstreams []string
+		expect    string
+		shouldErr bool
+	}{
+		{":8080", []string{"http://localhost:3000"}, "http://:8080\nproxy / http://localhost:3000 {\n\ttransparent\n\twebsocket\n}\nlog stdout\n", false},
+		{"8080", []string{"localhost:3000", "localhost:3001"}, "http://:8080\nproxy / localhost:3000 localhost:3001 {\n\ttransparent\n\twebsocket\n}\nlog stdout\n", false},
+		{"127.0.0.1:8080", []string{"http://localhost:3000"}, "http://:8080\nbind 127.0.0.1\nproxy / http://localhost:3000 {\n\ttransparent\n\twebsocket\n}\nlog stdout\n", false},
+		{":8080", nil, "", true},
+		{"127.0.0.1:", []string{"http://localhost:3000"}, "", true},
+		{":8080", []string{"http://localhost:3000 {"}, "", true},
+	} {
+		contents, err := proxyCaddyfile(test.listen, test.upstreams)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got Caddyfile:\n%s", i, contents)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if string(contents) != test.expect {
+			t.Errorf("Test %d: Expected Caddyfile:\n%s\ngot:\n%s", i, test.expect, contents)
+		}
+		sblocks, err := caddyfile.Parse("-proxy", bytes.NewReader(contents), directives)
+		if err != nil {
+			t.Errorf("Test %d: Expected Caddyfile to parse, got: %v", i, err)
+		} else if len(sblocks) != 1 {
+			t.Errorf("Test %d: Expected 1 server block, got %d", i, len(sblocks))
+		}
+	}
+}
+
+func TestServeCaddyfile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "oneliner_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, `my "public" files`)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmpdir, "file.txt")
+	if err := ioutil.WriteFile(file, []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		dir       string
+		listen    string
+		browse    bool
+		expect    []string // tokens of the server block
+		shouldErr bool
+	}{
+		{dir, ":8080", false, []string{"root", dir, "log", "stdout"}, false},
+		{dir, "2015", true, []string{"root", dir, "browse", "log", "stdout"}, false},
+		{file, ":8080", false, nil, true},
+		{filepath.Join(tmpdir, "missing"), ":8080", false, nil, true},
+		{dir, "", false, nil, true},
+	} {
+		contents, err := serveCaddyfile(test.dir, test.listen, test.browse)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got Caddyfile:\n%s", i, contents)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		sblocks, err := caddyfile.Parse("-serve", bytes.NewReader(contents), directives)
+		if err != nil {
+			t.Errorf("Test %d: Expected Caddyfile to parse, got: %v", i, err)
+			continue
+		}
+		if len(sblocks) != 1 {
+			t.Errorf("Test %d: Expected 1 server block, got %d", i, len(sblocks))
+			continue
+		}
+		var tokens []string
+		for _, dir := range []string{"root", "browse", "log"} {
+			for _, tkn := range sblocks[0].Tokens[dir] {
+				tokens = append(tokens, tkn.Text)
+			}
+		}
+		if len(tokens) != len(test.expect) {
+			t.Errorf("Test %d: Expected tokens %q, got %q", i, test.expect, tokens)
+			continue
+		}
+		for j := range tokens {
+			if tokens[j] != test.expect[j] {
+				t.Errorf("Test %d: Expected tokens %q, got %q", i, test.expect, tokens)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PathRoot is a directory from which the files of
+// requests to Path and paths below it are served, instead
+// of the site root. Request paths are not stripped
+// of Path, so /static/app.js is found at
+// static/app.js in Root.
+type PathRoot struct {
+	Path string
+	Root string
+}
+
+// pathRootFS serves files from the root of the
+// longest matching path root, or from Base.
+type pathRootFS struct {
+	Roots []PathRoot
+	Dirs  []http.FileSystem
+	Base  http.FileSystem
+}
+
+// Open implements http.FileSystem.
+func (fs pathRootFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if i := matchPathRoot(fs.Roots, name); i >= 0 {
+		return fs.Dirs[i].Open(name)
+	}
+	return fs.Base.Open(name)
+}
+
+// RootFor returns the directory that the file of reqPath
+// is in: the root of the longest of pathRoots that reqPath
+// is in, or else root. Middleware that looks up request
+// files on disk by itself, rather than through
+// SiteConfig.SiteFileSystem, uses it to find the same
+// files as the file server.
+func RootFor(reqPath, root string, pathRoots []PathRoot) string {
+	if i := matchPathRoot(pathRoots, path.Clean("/"+reqPath)); i >= 0 {
+		return pathRoots[i].Root
+	}
+	return root
+}
+
+// matchPathRoot returns the index of the longest of roots
+// that the clean path name is in, or -1 if there is none.
+func matchPathRoot(roots []PathRoot, name string) int {
+	longest, longestLen := -1, 0
+	for i, pr := range roots {
+		base := strings.TrimSuffix(pr.Path, "/")
+		if len(pr.Path) > longestLen && (name == base || strings.HasPrefix(name, base+"/")) {
+			longest, longestLen = i, len(pr.Path)
+		}
+	}
+	return longest
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathRoots(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "caddy_pathroots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for name, content := range map[string]string{
+		"public/index.html":             "public index",
+		"public/static/app.js":          "stale app",
+		"build/static/app.js":           "built app",
+		"build/static/vendor/lib.js":    "built lib",
+		"vendor/static/vendor/lib.js":   "vendored lib",
+		"public/staticky/not-static.js": "public",
+	} {
+		fpath := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := SiteConfig{
+		Root: filepath.Join(tmp, "public"),
+		PathRoots: []PathRoot{
+			{Path: "/static/vendor", Root: filepath.Join(tmp, "vendor")},
+			{Path: "/static", Root: filepath.Join(tmp, "build")},
+		},
+	}
+	fs := cfg.SiteFileSystem()
+	for name, expected := range map[string]string{
+		"/index.html":                "public index",
+		"/static/app.js":             "built app",
+		"/static/vendor/lib.js":      "vendored lib",
+		"/staticky/not-static.js":    "public",
+		"/static/../index.html":      "public index",
+		"/../../build/static/app.js": "",
+	} {
+		f, err := fs.Open(name)
+		if expected == "" {
+			if err == nil {
+				f.Close()
+				t.Errorf("Opening %s: Expected error, got none", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Opening %s: Expected no error, got: %v", name, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(b) != expected {
+			t.Errorf("Opening %s: Expected '%s', got '%s'", name, expected, b)
+		}
+	}
+}
+
+func TestRootFor(t *testing.T) {
+	pathRoots := []PathRoot{
+		{Path: "/static/vendor", Root: "vendor"},
+		{Path: "/static", Root: "build"},
+	}
+	for reqPath, expected := range map[string]string{
+		"/index.html":         "public",
+		"/static":             "build",
+		"/static/app.js":      "build",
+		"/static/vendor/a.js": "vendor",
+		"/staticky/a.js":      "public",
+		"/static/../a.js":     "public",
+		"static/app.js":       "build",
+	} {
+		if got := RootFor(reqPath, "public", pathRoots); got != expected {
+			t.Errorf("RootFor(%s): Expected %s, got %s", reqPath, expected, got)
+		}
+	}
+}
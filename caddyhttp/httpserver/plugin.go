@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -43,9 +44,14 @@ func init() {
 	flag.StringVar(&Host, "host", DefaultHost, "Default host")
 	flag.StringVar(&Port, "port", DefaultPort, "Default port")
 	flag.StringVar(&Root, "root", DefaultRoot, "Root path of default site")
+	flag.StringVar(&Serve, "serve", "", "Without a Caddyfile, serve the files in this directory")
+	flag.StringVar(&Listen, "listen", "", "Address to listen on with -serve (default the -port)")
+	flag.BoolVar(&Browse, "browse", false, "List the files of directories served with -serve")
+	flag.StringVar(&Proxy, "proxy", "", "Without a Caddyfile, listen on this address and reverse proxy to the addresses given as arguments")
 	flag.DurationVar(&GracefulTimeout, "grace", 5*time.Second, "Maximum duration of graceful shutdown")
 	flag.BoolVar(&HTTP2, "http2", true, "Use HTTP/2")
 	flag.BoolVar(&QUIC, "quic", false, "Use experimental QUIC")
+	flag.BoolVar(&ReusePort, "reuseport", false, "Bind listeners with SO_REUSEPORT so multiple processes can share a port")
 
 	caddy.RegisterServerType(serverType, caddy.ServerType{
 		Directives: func() []string { return directives },
@@ -66,6 +72,8 @@ func init() {
 		NewContext: newContext,
 	})
 	caddy.RegisterCaddyfileLoader("short", caddy.LoaderFunc(shortCaddyfileLoader))
+	caddy.RegisterCaddyfileLoader("proxy", caddy.LoaderFunc(proxyCaddyfileLoader))
+	caddy.RegisterCaddyfileLoader("serve", caddy.LoaderFunc(serveCaddyfileLoader))
 	caddy.RegisterParsingCallback(serverType, "root", hideCaddyfile)
 	caddy.RegisterParsingCallback(serverType, "tls", activateHTTPS)
 	caddytls.RegisterConfigGetter(serverType, func(c *caddy.Controller) *caddytls.Config { return GetConfig(c).TLS })
@@ -102,7 +110,27 @@ func hideCaddyfile(cctx caddy.Context) error {
 }
 
 func newContext(inst *caddy.Instance) caddy.Context {
-	return &httpContext{instance: inst, keysToSiteConfigs: make(map[string]*SiteConfig)}
+	ctx := &httpContext{instance: inst, keysToSiteConfigs: make(map[string]*SiteConfig)}
+	inst.StorageMu.Lock()
+	inst.Storage[contextInstStorageKey] = ctx
+	inst.StorageMu.Unlock()
+	return ctx
+}
+
+// contextInstStorageKey is the key of the HTTP context
+// of an instance in its Storage.
+const contextInstStorageKey = "httpserver_context"
+
+// InstanceSites returns the sites that inst serves, or
+// nil if it is not an instance of the HTTP server type.
+func InstanceSites(inst *caddy.Instance) []*SiteConfig {
+	inst.StorageMu.RLock()
+	ctx, _ := inst.Storage[contextInstStorageKey].(*httpContext)
+	inst.StorageMu.RUnlock()
+	if ctx == nil {
+		return nil
+	}
+	return ctx.siteConfigs
 }
 
 type httpContext struct {
@@ -116,6 +144,11 @@ type httpContext struct {
 
 	// siteConfigs is the master list of all site configs.
 	siteConfigs []*SiteConfig
+
+	// reusedConfigs are the site configs taken over from
+	// the instance being replaced; they join siteConfigs
+	// in MakeServers, after the parsing callbacks ran
+	reusedConfigs []*SiteConfig
 }
 
 func (h *httpContext) saveConfig(key string, cfg *SiteConfig) {
@@ -225,9 +258,71 @@ func (h *httpContext) InspectServerBlocks(sourceFile string, serverBlocks []cadd
 	return serverBlocks, nil
 }
 
+// ReuseServerBlocks takes over the sites of sblocks from old,
+// the context of the instance being replaced, so that their
+// middleware keeps its state, like caches and rate limits,
+// across the restart. Sites that use TLS are set up again,
+// since each instance manages its own certificates, and so
+// are blocks with directives that reach beyond their sites.
+func (h *httpContext) ReuseServerBlocks(old caddy.Context, sblocks []caddyfile.ServerBlock) []caddyfile.ServerBlock {
+	oldCtx, ok := old.(*httpContext)
+	if !ok {
+		return nil
+	}
+
+	var taken []caddyfile.ServerBlock
+	replaced := make(map[*SiteConfig]bool)
+	for _, sb := range sblocks {
+		if !reusableServerBlock(sb) {
+			continue
+		}
+		keys := make([]string, len(sb.Keys))
+		cfgs := make([]*SiteConfig, len(sb.Keys))
+		for i, key := range sb.Keys {
+			keys[i] = normalizedKey(key)
+			cfgs[i] = oldCtx.keysToSiteConfigs[keys[i]]
+			if cfgs[i] == nil || cfgs[i].TLS.Enabled {
+				cfgs = nil
+				break
+			}
+		}
+		if cfgs == nil {
+			continue
+		}
+		for i, key := range keys {
+			replaced[h.keysToSiteConfigs[key]] = true
+			h.keysToSiteConfigs[key] = cfgs[i]
+		}
+		h.reusedConfigs = append(h.reusedConfigs, cfgs...)
+		taken = append(taken, sb)
+	}
+
+	if len(replaced) > 0 {
+		configs := h.siteConfigs[:0]
+		for _, cfg := range h.siteConfigs {
+			if !replaced[cfg] {
+				configs = append(configs, cfg)
+			}
+		}
+		h.siteConfigs = configs
+	}
+	return taken
+}
+
+// reusableServerBlock returns false if sb uses a directive
+// whose setup does not only affect the sites of sb: the
+// event hooks that on registers are dropped on restart.
+func reusableServerBlock(sb caddyfile.ServerBlock) bool {
+	_, hasOn := sb.Tokens["on"]
+	return !hasOn
+}
+
 // MakeServers uses the newly-created siteConfigs to
 // create and return a list of server instances.
 func (h *httpContext) MakeServers() ([]caddy.Server, error) {
+	h.siteConfigs = append(h.siteConfigs, h.reusedConfigs...)
+	h.reusedConfigs = nil
+
 	// make a rough estimate as to whether we're in a "production
 	// environment/system" - start by assuming that most production
 	// servers will set their default CA endpoint to a public,
@@ -277,7 +372,7 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 			// is incorrect for this site.
 			cfg.Addr.Scheme = "https"
 		}
-		if cfg.Addr.Port == "" && ((!cfg.TLS.Manual && !cfg.TLS.SelfSigned) || cfg.TLS.Manager.OnDemand != nil) {
+		if cfg.Addr.Port == "" && defaultsToHTTPSPort(cfg) {
 			// this is vital, otherwise the function call below that
 			// sets the listener address will use the default port
 			// instead of 443 because it doesn't know about TLS.
@@ -327,6 +422,55 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 	return servers, nil
 }
 
+// defaultsToHTTPSPort returns true if cfg, which must have TLS
+// enabled, should listen on HTTPSPort when no port is given.
+func defaultsToHTTPSPort(cfg *SiteConfig) bool {
+	return (!cfg.TLS.Manual && !cfg.TLS.SelfSigned && !cfg.TLS.Internal) ||
+		cfg.TLS.Manager.OnDemand != nil
+}
+
+// DescribeSites returns the addresses of the sites in this
+// context keyed by the listener address they will be served
+// on, including the HTTP->HTTPS redirects that automatic HTTPS
+// would add. Unlike MakeServers, no certificates are loaded and
+// no servers are created, so it is safe to call when the
+// directives were only validated. It changes the site configs
+// the same way activateHTTPS would, so the context should not
+// be used to make servers afterwards.
+func (h *httpContext) DescribeSites() (map[string][]string, error) {
+	markQualifiedForAutoHTTPS(h.siteConfigs)
+	err := enableAutoHTTPS(h.siteConfigs, false)
+	if err != nil {
+		return nil, err
+	}
+	h.siteConfigs = makePlaintextRedirects(h.siteConfigs)
+
+	for _, cfg := range h.siteConfigs {
+		if !cfg.TLS.Enabled || cfg.Addr.Port == HTTPPort || cfg.Addr.Scheme == "http" {
+			continue
+		}
+		if cfg.Addr.Scheme == "" {
+			cfg.Addr.Scheme = "https"
+		}
+		if cfg.Addr.Port == "" && defaultsToHTTPSPort(cfg) {
+			cfg.Addr.Port = HTTPSPort
+		}
+	}
+
+	groups, err := groupSiteConfigsByListenAddr(h.siteConfigs)
+	if err != nil {
+		return nil, err
+	}
+	sites := make(map[string][]string, len(groups))
+	for addr, group := range groups {
+		for _, cfg := range group {
+			sites[addr] = append(sites[addr], cfg.Addr.String())
+		}
+		sort.Strings(sites[addr])
+	}
+	return sites, nil
+}
+
 // normalizedKey returns "normalized" key representation:
 //  scheme and host names are lowered, everything else stays the same
 func normalizedKey(key string) string {
@@ -358,13 +502,22 @@ func GetConfig(c *caddy.Controller) *SiteConfig {
 	return cfg
 }
 
+// DirectiveSetUp records on the site of c that c's directive
+// has been set up, so the handler chain can be inspected later.
+func (h *httpContext) DirectiveSetUp(c *caddy.Controller) {
+	if cfg, ok := h.keysToSiteConfigs[normalizedKey(c.Key)]; ok {
+		cfg.recordSetup(c)
+	}
+}
+
 // shortCaddyfileLoader loads a Caddyfile if positional arguments are
 // detected, or, in other words, if un-named arguments are provided to
 // the program. A "short Caddyfile" is one in which each argument
 // is a line of the Caddyfile. The default host and port are prepended
-// according to the Host and Port values.
+// according to the Host and Port values. With -proxy, the arguments
+// are the upstreams instead.
 func shortCaddyfileLoader(serverType string) (caddy.Input, error) {
-	if flag.NArg() > 0 && serverType == "http" {
+	if flag.NArg() > 0 && serverType == "http" && Proxy == "" {
 		confBody := fmt.Sprintf("%s:%s\n%s", Host, Port, strings.Join(flag.Args(), "\n"))
 		return caddy.CaddyfileInput{
 			Contents:       []byte(confBody),
@@ -563,7 +716,9 @@ func standardizeAddress(str string) (Address, error) {
 // convenient when developing a plugin, but it does not
 // guarantee absolute ordering. Multiple plugins registering
 // directives with this function will lead to non-
-// deterministic builds and buggy software.
+// deterministic builds and buggy software. To order a
+// directive that is not in the list, set the After or
+// Before fields of its caddy.Plugin instead.
 //
 // Directive names must be lower-cased and unique. Any errors
 // here are fatal, and even successful calls print a message
@@ -614,44 +769,60 @@ func RegisterDevDirective(name, before string) {
 var directives = []string{
 	// primitive actions that set up the fundamental vitals of each config
 	"root",
+	"filesystem",
+	"s3",
+	"assets",
+	"hide",
+	"symlinks",
 	"index",
+	"filecache",
 	"bind",
 	"limits",
 	"timeouts",
 	"tls",
 
 	// services/utilities, or other directives that don't necessarily inject handlers
-	"startup",  // TODO: Deprecate this directive
-	"shutdown", // TODO: Deprecate this directive
+	"startup",
+	"shutdown",
 	"on",
 	"supervisor", // github.com/lucaslorentz/caddy-supervisor
 	"request_id",
-	"realip", // github.com/captncraig/caddy-realip
-	"git",    // github.com/abiosoft/caddy-git
+	"realip",
+	"git",
 
 	// directives that add listener middleware to the stack
 	"proxyprotocol", // github.com/mastercactapus/caddy-proxyprotocol
+	"client_limits",
 
 	// directives that add middleware to the stack
 	"locale", // github.com/simia-tech/caddy-locale
 	"log",
-	"cache", // github.com/nicolasazrak/caddy-cache
+	"maintenance",
+	"cache",
 	"rewrite",
+	"language",
+	"split",
+	"try_files",
 	"ext",
 	"minify", // github.com/hacdias/caddy-minify
 	"gzip",
+	"sub_filter",
+	"secure_headers",
+	"csp",
 	"header",
-	"geoip", // github.com/kodnaplakal/caddy-geoip
+	"geoip",
 	"errors",
-	"authz",        // github.com/casbin/caddy-authz
-	"filter",       // github.com/echocat/caddy-filter
-	"ipfilter",     // github.com/pyed/ipfilter
-	"ratelimit",    // github.com/xuqingfeng/caddy-rate-limit
-	"expires",      // github.com/epicagency/caddy-expires
+	"authz",     // github.com/casbin/caddy-authz
+	"filter",    // github.com/echocat/caddy-filter
+	"ipfilter",  // github.com/pyed/ipfilter
+	"ratelimit", // github.com/xuqingfeng/caddy-rate-limit
+	"user_agent",
+	"expires",
 	"forwardproxy", // github.com/caddyserver/forwardproxy
 	"basicauth",
 	"redir",
 	"status",
+	"respond",
 	"cors",      // github.com/captncraig/cors/caddy
 	"s3browser", // github.com/techknowlogick/caddy-s3browser
 	"nobots",    // github.com/Xumeiquer/nobots
@@ -666,6 +837,7 @@ var directives = []string{
 	"internal",
 	"pprof",
 	"expvar",
+	"chain",
 	"push",
 	"datadog",    // github.com/payintech/caddy-datadog
 	"prometheus", // github.com/miekg/caddy-prometheus
@@ -673,10 +845,10 @@ var directives = []string{
 	"proxy",
 	"pubsub", // github.com/jung-kurt/caddy-pubsub
 	"fastcgi",
-	"cgi", // github.com/jung-kurt/caddy-cgi
+	"cgi",
 	"websocket",
 	"filebrowser", // github.com/filebrowser/caddy
-	"webdav",      // github.com/hacdias/caddy-webdav
+	"webdav",
 	"markdown",
 	"browse",
 	"mailout",   // github.com/SchumacherFM/mailout
@@ -714,6 +886,16 @@ var (
 	// Port is the site port
 	Port = DefaultPort
 
+	// Proxy is the address to listen on to reverse proxy
+	// to the upstreams given as arguments, without a Caddyfile.
+	Proxy string
+
+	// Serve is a directory to serve without a Caddyfile, on
+	// the address Listen, listing directories if Browse is set.
+	Serve  string
+	Listen string
+	Browse bool
+
 	// GracefulTimeout is the maximum duration of a graceful shutdown.
 	GracefulTimeout time.Duration
 
@@ -723,6 +905,11 @@ var (
 	// QUIC indicates whether QUIC is enabled or not.
 	QUIC bool
 
+	// ReusePort indicates whether listeners are bound
+	// with SO_REUSEPORT, allowing multiple processes to
+	// listen on the same address (where supported).
+	ReusePort bool
+
 	// HTTPPort is the port to use for HTTP.
 	HTTPPort = DefaultHTTPPort
 
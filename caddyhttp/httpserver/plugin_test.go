@@ -347,3 +347,15 @@ func TestHideCaddyfile(t *testing.T) {
 	}
 	t.Fatal("Caddyfile missing from HiddenFiles")
 }
+
+func TestInstanceSites(t *testing.T) {
+	inst := &caddy.Instance{Storage: make(map[interface{}]interface{})}
+	if sites := InstanceSites(inst); sites != nil {
+		t.Errorf("Expected no sites before the context is made, got %v", sites)
+	}
+	ctx := newContext(inst).(*httpContext)
+	ctx.saveConfig("example.com", &SiteConfig{})
+	if sites := InstanceSites(inst); len(sites) != 1 || sites[0] != ctx.siteConfigs[0] {
+		t.Errorf("Expected the site of the instance, got %v", sites)
+	}
+}
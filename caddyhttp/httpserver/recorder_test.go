@@ -15,8 +15,10 @@
 package httpserver
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -52,3 +54,42 @@ func TestWrite(t *testing.T) {
 		t.Fatalf("Expected Response Body to be %s , but found %s\n", responseTestString, w.Body.String())
 	}
 }
+
+// readerFromRecorder is a ResponseWriter that, like the
+// standard lib's, implements io.ReaderFrom.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFromCalled bool
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.readFromCalled = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestReadFrom(t *testing.T) {
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	recordRequest := NewResponseRecorder(w)
+	n, err := recordRequest.ReadFrom(strings.NewReader("test"))
+	if err != nil || n != 4 {
+		t.Fatalf("Expected 4 bytes to be copied without error, but got %d, %v", n, err)
+	}
+	if !w.readFromCalled {
+		t.Error("Expected the underlying ReadFrom to be used")
+	}
+	if recordRequest.size != 4 {
+		t.Errorf("Expected the bytes written counter to be 4, but instead found %d", recordRequest.size)
+	}
+	if w.Body.String() != "test" {
+		t.Errorf("Expected Response Body to be test, but found %s", w.Body.String())
+	}
+
+	// without io.ReaderFrom, the body is just copied
+	plain := httptest.NewRecorder()
+	if _, err := ReadFrom(plain, strings.NewReader("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if plain.Body.String() != "plain" {
+		t.Errorf("Expected Response Body to be plain, but found %s", plain.Body.String())
+	}
+}
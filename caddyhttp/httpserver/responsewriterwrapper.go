@@ -16,6 +16,7 @@ package httpserver
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
 )
@@ -26,6 +27,12 @@ type ResponseWriterWrapper struct {
 	http.ResponseWriter
 }
 
+// Unwrap returns the underlying ResponseWriter, so that
+// http.ResponseController can reach the connection.
+func (rww *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rww.ResponseWriter
+}
+
 // Hijack implements http.Hijacker. It simply wraps the underlying
 // ResponseWriter's Hijack method if there is one, or returns an error.
 func (rww *ResponseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -66,6 +73,22 @@ func (rww *ResponseWriterWrapper) Push(target string, opts *http.PushOptions) er
 	return NonPusherError{Underlying: rww.ResponseWriter}
 }
 
+// ReadFrom copies src to w. If w implements io.ReaderFrom, as the
+// standard lib's own ResponseWriter does, the copy is left to it so
+// that files can be sent with sendfile(2) or its equivalent instead
+// of through user space; otherwise a pooled buffer is used.
+//
+// ResponseWriterWrapper deliberately does not implement io.ReaderFrom
+// itself: wrappers that embed it and override Write (to compress or
+// transform the body) would be bypassed. A wrapper that passes the
+// body through unchanged can implement ReadFrom with this function.
+func ReadFrom(w http.ResponseWriter, src io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return respBufPool.Copy(w, src)
+}
+
 // HTTPInterfaces mix all the interfaces that middleware ResponseWriters need to support.
 type HTTPInterfaces interface {
 	http.ResponseWriter
@@ -19,6 +19,7 @@ import (
 	"io"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
@@ -90,11 +91,16 @@ func ParseRoller(l *LogRoller, what string, where ...string) error {
 		value int
 		err   error
 	)
-	if what != directiveRotateCompress && what != directiveRotateDisable {
+	switch what {
+	case directiveRotateSize:
+		value, err = parseRotateSize(where[0])
+	case directiveRotateAge:
+		value, err = parseUnitValue(where[0], ageUnits)
+	case directiveRotateKeep:
 		value, err = strconv.Atoi(where[0])
-		if err != nil {
-			return err
-		}
+	}
+	if err != nil {
+		return err
 	}
 
 	switch what {
@@ -112,6 +118,50 @@ func ParseRoller(l *LogRoller, what string, where ...string) error {
 	return nil
 }
 
+// parseRotateSize parses s as a size like ParseSize, in
+// whole megabytes, rounded up; a plain number is in
+// megabytes already.
+func parseRotateSize(s string) (int, error) {
+	if mb, err := strconv.Atoi(s); err == nil {
+		if mb < 0 {
+			return 0, errInvalidRollParameter
+		}
+		return mb, nil
+	}
+	size := ParseSize(s)
+	if size < 0 {
+		return 0, errInvalidRollParameter
+	}
+	const megabyte = 1024 * 1024
+	return int((size + megabyte - 1) / megabyte), nil
+}
+
+// ageUnits are the suffixes rotate_age accepts,
+// as multiples of its base unit, the day.
+var ageUnits = map[string]int{"d": 1, "w": 7}
+
+// parseUnitValue parses s as a non-negative integer
+// that is optionally followed by one of the units.
+// Without a unit, s is in the base unit.
+func parseUnitValue(s string, units map[string]int) (int, error) {
+	num, mult := s, 1
+	lower := strings.ToLower(s)
+	for unit, m := range units {
+		if strings.HasSuffix(lower, unit) {
+			num, mult = s[:len(s)-len(unit)], m
+			break
+		}
+	}
+	value, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, errInvalidRollParameter
+	}
+	return value * mult, nil
+}
+
 // DefaultLogRoller will roll logs by default.
 func DefaultLogRoller() *LogRoller {
 	return &LogRoller{
@@ -0,0 +1,49 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import "testing"
+
+func TestParseRollerRotateSize(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  int
+		shouldErr bool
+	}{
+		{"2", 2, false},
+		{"2MB", 2, false},
+		{"1gb", 1024, false},
+		{"512KB", 1, false},
+		{"1536kb", 2, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"10TB", 0, true},
+		{"lots", 0, true},
+	} {
+		l := DefaultLogRoller()
+		err := ParseRoller(l, directiveRotateSize, test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error for %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error for %s, got: %v", i, test.input, err)
+		} else if l.MaxSize != test.expected {
+			t.Errorf("Test %d: Expected %s to be %d MB, got %d", i, test.input, test.expected, l.MaxSize)
+		}
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/h2quic"
@@ -138,19 +139,43 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		}
 	}
 
-	// Compile custom middleware for every site (enables virtual hosting)
+	// Index every site (enables virtual hosting); their middleware
+	// is compiled when they get their first request, so that
+	// configs with thousands of sites start quickly and only
+	// spend memory on the chains of sites that are visited;
+	// sites taken over in a restart keep the chain they have
 	for _, site := range group {
-		stack := Handler(staticfiles.FileServer{Root: http.Dir(site.Root), Hide: site.HiddenFiles, IndexPages: site.IndexPages})
-		for i := len(site.middleware) - 1; i >= 0; i-- {
-			stack = site.middleware[i](stack)
+		if site.compileOnce == nil {
+			site.compileOnce = new(sync.Once)
 		}
-		site.middlewareChain = stack
 		s.vhosts.Insert(site.Addr.VHost(), site)
 	}
 
 	return s, nil
 }
 
+// handler returns the middleware chain of site, compiling
+// it first if site has not been served before.
+func (site *SiteConfig) handler() Handler {
+	if site.compileOnce != nil {
+		site.compileOnce.Do(func() {
+			stack := Handler(staticfiles.FileServer{
+				Root:           site.SiteFileSystem(),
+				Hide:           site.HiddenFiles,
+				HidePatterns:   site.HiddenPatterns,
+				IndexPages:     site.IndexPages,
+				PathIndexPages: site.PathIndexPages,
+				Cache:          site.FileCache,
+			})
+			for i := len(site.middleware) - 1; i >= 0; i-- {
+				stack = site.middleware[i](stack)
+			}
+			site.middlewareChain = stack
+		})
+	}
+	return site.middlewareChain
+}
+
 // makeHTTPServerWithHeaderLimit apply minimum header limit within a group to given http.Server
 func makeHTTPServerWithHeaderLimit(s *http.Server, group []*SiteConfig) *http.Server {
 	var min int64
@@ -248,7 +273,7 @@ func (s *Server) Listen() (net.Listener, error) {
 		return nil, fmt.Errorf("server field is nil")
 	}
 
-	ln, err := net.Listen("tcp", s.Server.Addr)
+	ln, err := listenTCP(s.Server.Addr)
 	if err != nil {
 		var succeeded bool
 		if runtime.GOOS == "windows" {
@@ -257,7 +282,7 @@ func (s *Server) Listen() (net.Listener, error) {
 			// in succession. TODO: Better way to handle this? And why limit this to Windows?
 			for i := 0; i < 20; i++ {
 				time.Sleep(100 * time.Millisecond)
-				ln, err = net.Listen("tcp", s.Server.Addr)
+				ln, err = listenTCP(s.Server.Addr)
 				if err == nil {
 					succeeded = true
 					break
@@ -280,6 +305,17 @@ func (s *Server) Listen() (net.Listener, error) {
 	return cln.(caddy.Listener), nil
 }
 
+// listenTCP creates a TCP listener on addr. If ReusePort is
+// enabled, the socket is bound with SO_REUSEPORT so that other
+// processes may listen on the same address.
+func listenTCP(addr string) (net.Listener, error) {
+	if !ReusePort {
+		return net.Listen("tcp", addr)
+	}
+	lc := net.ListenConfig{Control: reusePortControl}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
 // WrapListener wraps ln in the listener middlewares configured
 // for this server.
 func (s *Server) WrapListener(ln net.Listener) net.Listener {
@@ -298,6 +334,10 @@ func (s *Server) WrapListener(ln net.Listener) net.Listener {
 // ListenPacket creates udp connection for QUIC if it is enabled,
 func (s *Server) ListenPacket() (net.PacketConn, error) {
 	if QUIC {
+		if ReusePort {
+			lc := net.ListenConfig{Control: reusePortControl}
+			return lc.ListenPacket(context.Background(), "udp", s.Server.Addr)
+		}
 		udpAddr, err := net.ResolveUDPAddr("udp", s.Server.Addr)
 		if err != nil {
 			return nil, err
@@ -454,7 +494,7 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		return http.StatusForbidden, nil
 	}
 
-	return vhost.middlewareChain.ServeHTTP(w, r)
+	return vhost.handler().ServeHTTP(w, r)
 }
 
 func trimPathPrefix(u *url.URL, prefix string) *url.URL {
@@ -16,9 +16,16 @@ package httpserver
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/mholt/caddy/caddytls"
+	"github.com/mholt/certmagic"
 )
 
 func TestAddress(t *testing.T) {
@@ -267,3 +274,68 @@ func TestMakeHTTPServerWithHeaderLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestListenReusePort(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "dragonfly", "freebsd", "netbsd", "openbsd":
+	default:
+		t.Skipf("SO_REUSEPORT not supported on %s", runtime.GOOS)
+	}
+
+	ReusePort = true
+	defer func() { ReusePort = false }()
+
+	ln1, err := listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error listening, got: %v", err)
+	}
+	defer ln1.Close()
+
+	ln2, err := listenTCP(ln1.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected second listener on %s to succeed with SO_REUSEPORT, got: %v", ln1.Addr(), err)
+	}
+	ln2.Close()
+}
+
+func TestNewServerCompilesChainsLazily(t *testing.T) {
+	var compiled int32
+	site := func(host string) *SiteConfig {
+		cfg := &SiteConfig{
+			Addr: Address{Original: host, Host: host, Port: "80"},
+			TLS:  &caddytls.Config{Manager: certmagic.NewDefault()},
+		}
+		cfg.AddMiddleware(func(next Handler) Handler {
+			atomic.AddInt32(&compiled, 1)
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusTeapot, nil
+			})
+		})
+		return cfg
+	}
+	s, err := NewServer(":80", []*SiteConfig{site("a.example.com"), site("b.example.com")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&compiled); n != 0 {
+		t.Fatalf("Expected no chain to be compiled before the first request, got %d", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "http://a.example.com/", nil)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if w.Code != http.StatusTeapot {
+				t.Errorf("Expected status %d, got %d", http.StatusTeapot, w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&compiled); n != 1 {
+		t.Errorf("Expected only the requested site's chain to be compiled once, got %d compilations", n)
+	}
+}
@@ -15,8 +15,14 @@
 package httpserver
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
 	"github.com/mholt/caddy/caddytls"
 )
 
@@ -29,6 +35,10 @@ type SiteConfig struct {
 	// The list of viable index page names of the site
 	IndexPages []string
 
+	// Index page names for requests under specific base
+	// paths, which take precedence over IndexPages
+	PathIndexPages map[string][]string
+
 	// The hostname to bind listener to;
 	// defaults to Addr.Host
 	ListenHost string
@@ -49,15 +59,42 @@ type SiteConfig struct {
 	// Uncompiled middleware stack
 	middleware []Middleware
 
-	// Compiled middleware stack
+	// Compiled middleware stack; compiled by handler
+	// at most once, when the site is first served
 	middlewareChain Handler
+	compileOnce     *sync.Once
 
 	// listener middleware stack
 	listenerMiddleware []ListenerMiddleware
 
+	// The directives that set up this site, in the
+	// order they were executed
+	setups []DirectiveSetup
+
+	// How many middleware the recorded setups added
+	setupMiddleware int
+
 	// Directory from which to serve files
 	Root string
 
+	// FileSystem, if not nil, is where the file server
+	// and browse get files from instead of Root, such
+	// as an object storage bucket.
+	FileSystem http.FileSystem
+
+	// Directories to serve the files of
+	// specific paths from instead of Root.
+	// Middleware that gets request files
+	// through SiteFileSystem or RootFor honors
+	// them; webdav has a root of its own, and
+	// files named in directive arguments, such
+	// as error pages, are relative to Root.
+	PathRoots []PathRoot
+
+	// Which symlinks under Root to follow when
+	// serving files from it
+	Symlinks SymlinkPolicy
+
 	// A list of files to hide (for example, the
 	// source Caddyfile). TODO: Enforcing this
 	// should be centralized, for example, a
@@ -65,6 +102,15 @@ type SiteConfig struct {
 	// for a request.
 	HiddenFiles []string
 
+	// Patterns of request paths to hide from the
+	// file server and directory listings, as set
+	// by the hide directive.
+	HiddenPatterns []string
+
+	// In-memory cache of small static files,
+	// if enabled with the filecache directive
+	FileCache *staticfiles.FileCache
+
 	// Max request's header/body size
 	Limits Limits
 
@@ -125,6 +171,54 @@ func (s *SiteConfig) AddListenerMiddleware(l ListenerMiddleware) {
 	s.listenerMiddleware = append(s.listenerMiddleware, l)
 }
 
+// DirectiveSetup describes what one directive set up
+// for a site.
+type DirectiveSetup struct {
+	// The name of the directive
+	Directive string `json:"directive"`
+
+	// The configuration the directive parsed,
+	// one line per line of the Caddyfile
+	Config string `json:"config"`
+
+	// How many handlers the directive added to
+	// the site's middleware chain
+	Handlers int `json:"handlers"`
+}
+
+// DirectiveSetups returns the directives that set up s,
+// in the order they were executed. Since directives are
+// executed in the order their handlers are chained, this
+// also describes the site's handler chain.
+func (s *SiteConfig) DirectiveSetups() []DirectiveSetup {
+	return s.setups
+}
+
+// recordSetup records that the directive of c has been set up
+// for s, along with how many middleware it added.
+func (s *SiteConfig) recordSetup(c *caddy.Controller) {
+	var lines []string
+	line := -1
+	for _, tkn := range c.Tokens() {
+		text := tkn.Text
+		if text == "" || strings.ContainsAny(text, " \t\"") {
+			text = strconv.Quote(text)
+		}
+		if len(lines) == 0 || tkn.Line != line {
+			lines = append(lines, text)
+		} else {
+			lines[len(lines)-1] += " " + text
+		}
+		line = tkn.Line
+	}
+	s.setups = append(s.setups, DirectiveSetup{
+		Directive: c.Directive,
+		Config:    strings.Join(lines, "\n"),
+		Handlers:  len(s.middleware) - s.setupMiddleware,
+	})
+	s.setupMiddleware = len(s.middleware)
+}
+
 // TLSConfig returns s.TLS.
 func (s SiteConfig) TLSConfig() *caddytls.Config {
 	return s.TLS
@@ -149,3 +243,29 @@ func (s SiteConfig) Middleware() []Middleware {
 func (s SiteConfig) ListenerMiddleware() []ListenerMiddleware {
 	return s.listenerMiddleware
 }
+
+// SiteFileSystem returns the file system that static
+// files of the site are served from.
+func (s SiteConfig) SiteFileSystem() http.FileSystem {
+	base := s.FileSystem
+	if base == nil {
+		base = s.dir(s.Root)
+	}
+	if len(s.PathRoots) == 0 {
+		return base
+	}
+	fs := pathRootFS{Roots: s.PathRoots, Base: base}
+	for _, pr := range s.PathRoots {
+		fs.Dirs = append(fs.Dirs, s.dir(pr.Root))
+	}
+	return fs
+}
+
+// dir returns the file system of the directory root
+// on disk, following the symlink policy of the site.
+func (s SiteConfig) dir(root string) http.FileSystem {
+	if s.Symlinks != SymlinksAlways {
+		return SymlinkDir{Root: root, Policy: s.Symlinks}
+	}
+	return http.Dir(root)
+}
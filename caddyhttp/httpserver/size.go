@@ -0,0 +1,52 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the units ParseSize understands,
+// longest first so that "B" does not shadow "KB".
+var byteUnits = []struct {
+	symbol     string
+	multiplier int64
+}{
+	{"KB", 1024},
+	{"MB", 1024 * 1024},
+	{"GB", 1024 * 1024 * 1024},
+	{"B", 1},
+}
+
+// ParseSize parses a size in bytes, optionally followed by
+// one of the units B, KB, MB or GB (case insensitive), as
+// directives accept them. It returns -1 if s is not a valid
+// size.
+func ParseSize(s string) int64 {
+	s = strings.ToUpper(s)
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.symbol) {
+			s, multiplier = strings.TrimSuffix(s, unit.symbol), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return -1
+	}
+	return size * multiplier
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for i, test := range []struct {
+		input    string
+		expected int64
+	}{
+		{"100", 100},
+		{"100b", 100},
+		{"4KB", 4 * 1024},
+		{"10mb", 10 * 1024 * 1024},
+		{"1GB", 1024 * 1024 * 1024},
+		{"ten", -1},
+		{"-5MB", -1},
+		{"", -1},
+	} {
+		if got := ParseSize(test.input); got != test.expected {
+			t.Errorf("Test %d: Expected %d for %q, got %d", i, test.expected, test.input, got)
+		}
+	}
+}
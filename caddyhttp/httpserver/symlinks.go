@@ -0,0 +1,108 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy controls which symbolic links under the
+// site root are followed when serving files from it.
+type SymlinkPolicy int
+
+// Symlink policies.
+const (
+	// SymlinksAlways follows all symlinks (the default).
+	SymlinksAlways SymlinkPolicy = iota
+
+	// SymlinksWithinRoot follows symlinks only if the
+	// file they lead to is inside the site root.
+	SymlinksWithinRoot
+
+	// SymlinksNever follows no symlinks below the site
+	// root; the root itself may still be one.
+	SymlinksNever
+)
+
+// SymlinkDir is like http.Dir, but only follows the
+// symlinks that its Policy allows. Files reached through
+// other symlinks do not exist, as far as clients can tell.
+type SymlinkDir struct {
+	Root   string
+	Policy SymlinkPolicy
+}
+
+// Open implements http.FileSystem.
+func (d SymlinkDir) Open(name string) (http.File, error) {
+	if d.Policy != SymlinksAlways && !d.allowed(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return http.Dir(d.Root).Open(name)
+}
+
+// allowed reports whether opening name may follow the
+// symlinks on its way. Paths that cannot be resolved are
+// allowed, so that opening them fails like it otherwise
+// would.
+func (d SymlinkDir) allowed(name string) bool {
+	root := d.Root
+	if root == "" {
+		root = "."
+	}
+	full := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+
+	switch d.Policy {
+	case SymlinksNever:
+		rel, err := filepath.Rel(root, full)
+		if err != nil || rel == "." {
+			return true
+		}
+		p := root
+		for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+			p = filepath.Join(p, elem)
+			info, err := os.Lstat(p)
+			if err != nil {
+				return true
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return false
+			}
+		}
+		return true
+
+	case SymlinksWithinRoot:
+		resolved, err := filepath.EvalSymlinks(full)
+		if err != nil {
+			// a dangling symlink leads nowhere, so
+			// don't reveal its existence either
+			_, lerr := os.Lstat(full)
+			return lerr != nil
+		}
+		resolvedRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return false
+		}
+		if resolved == resolvedRoot {
+			return true
+		}
+		return strings.HasPrefix(resolved, strings.TrimSuffix(resolvedRoot, string(filepath.Separator))+string(filepath.Separator))
+	}
+
+	return true
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSymlinkDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "caddy_symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "root")
+	for _, dir := range []string{filepath.Join(root, "dir"), filepath.Join(tmp, "outside")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "dir", "file.txt"), filepath.Join(tmp, "outside", "secret.txt")} {
+		if err := ioutil.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"inside":   "dir",
+		"escape":   filepath.Join(tmp, "outside"),
+		"dangling": "nowhere",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the root itself may be a symlink under every policy
+	linkedRoot := filepath.Join(tmp, "linkedroot")
+	if err := os.Symlink(root, linkedRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		policy   SymlinkPolicy
+		name     string
+		expectOK bool
+	}{
+		{SymlinksAlways, "/dir/file.txt", true},
+		{SymlinksAlways, "/inside/file.txt", true},
+		{SymlinksAlways, "/escape/secret.txt", true},
+		{SymlinksWithinRoot, "/dir/file.txt", true},
+		{SymlinksWithinRoot, "/inside/file.txt", true},
+		{SymlinksWithinRoot, "/escape/secret.txt", false},
+		{SymlinksWithinRoot, "/escape", false},
+		{SymlinksWithinRoot, "/dangling", false},
+		{SymlinksNever, "/", true},
+		{SymlinksNever, "/dir/file.txt", true},
+		{SymlinksNever, "/inside/file.txt", false},
+		{SymlinksNever, "/escape/secret.txt", false},
+		{SymlinksNever, "/../escape/secret.txt", false},
+	} {
+		for _, r := range []string{root, linkedRoot} {
+			f, err := SymlinkDir{Root: r, Policy: test.policy}.Open(test.name)
+			if err == nil {
+				f.Close()
+			}
+			if test.expectOK && err != nil {
+				t.Errorf("Test %d (%s): Expected to open, got error: %v", i, r, err)
+			}
+			if !test.expectOK {
+				if err == nil {
+					t.Errorf("Test %d (%s): Expected not to open", i, r)
+				} else if !os.IsNotExist(err) {
+					t.Errorf("Test %d (%s): Expected not-exist error, got: %v", i, r, err)
+				}
+			}
+		}
+	}
+}
@@ -158,6 +158,17 @@ func (c Context) URI() string {
 	return c.Req.RequestURI
 }
 
+// Path returns the path portion of the request URL.
+func (c Context) Path() string {
+	return c.Req.URL.Path
+}
+
+// Query returns the first value of the query string
+// parameter with the given key, or "" if it is absent.
+func (c Context) Query(key string) string {
+	return c.Req.URL.Query().Get(key)
+}
+
 // Host returns the hostname portion of the Host header
 // from the HTTP request.
 func (c Context) Host() (string, error) {
@@ -442,6 +453,16 @@ func (c Context) RandomString(minLen, maxLen int) string {
 	return string(result)
 }
 
+// Placeholder returns the value of the placeholder with the given
+// name, without braces, such as one set by another middleware.
+func (c Context) Placeholder(name string) string {
+	key := "{" + name + "}"
+	if v := NewReplacer(c.Req, nil, "").Replace(key); v != key {
+		return v
+	}
+	return ""
+}
+
 // AddLink adds a link header in response
 // see https://www.w3.org/wiki/LinkHeader
 func (c Context) AddLink(link string) string {
@@ -16,6 +16,7 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
@@ -512,6 +513,25 @@ func TestMethod(t *testing.T) {
 
 }
 
+func TestPathAndQuery(t *testing.T) {
+	context := getContextOrFail(t)
+
+	u, err := url.Parse("http://localhost/blog/post?id=42&tag=a&tag=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	context.Req.URL = u
+
+	if path := context.Path(); path != "/blog/post" {
+		t.Errorf("Expected path %s, found %s", "/blog/post", path)
+	}
+	for key, expected := range map[string]string{"id": "42", "tag": "a", "missing": ""} {
+		if actual := context.Query(key); actual != expected {
+			t.Errorf("Expected query value %q for %s, found %q", expected, key, actual)
+		}
+	}
+}
+
 func TestContextPathMatches(t *testing.T) {
 	context := getContextOrFail(t)
 
@@ -960,3 +980,17 @@ func TestTlsVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestPlaceholder(t *testing.T) {
+	ctx := getContextOrFail(t)
+	repl := NewReplacer(ctx.Req, nil, "")
+	ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), ReplacerCtxKey, repl))
+	repl.Set("csp_nonce", "abc123")
+
+	if got := ctx.Placeholder("csp_nonce"); got != "abc123" {
+		t.Errorf("Expected placeholder value 'abc123', got '%s'", got)
+	}
+	if got := ctx.Placeholder("unknown"); got != "" {
+		t.Errorf("Expected empty value for unknown placeholder, got '%s'", got)
+	}
+}
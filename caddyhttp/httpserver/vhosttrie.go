@@ -40,12 +40,18 @@ func newVHostTrie() *vhostTrie {
 	return &vhostTrie{edges: make(map[string]*vhostTrie), fallbackHosts: []string{"0.0.0.0", "[::]", ""}}
 }
 
+// newVHostNode returns a node for t's host and path edges,
+// which unlike the root does not need fallback hosts.
+func newVHostNode() *vhostTrie {
+	return &vhostTrie{edges: make(map[string]*vhostTrie)}
+}
+
 // Insert adds stack to t keyed by key. The key should be
 // a valid "host/path" combination (or just host).
 func (t *vhostTrie) Insert(key string, site *SiteConfig) {
 	host, path := t.splitHostPath(key)
 	if _, ok := t.edges[host]; !ok {
-		t.edges[host] = newVHostTrie()
+		t.edges[host] = newVHostNode()
 	}
 	t.edges[host].insertPath(path, path, site)
 }
@@ -60,7 +66,7 @@ func (t *vhostTrie) insertPath(remainingPath, originalPath string, site *SiteCon
 	}
 	ch := string(remainingPath[0])
 	if _, ok := t.edges[ch]; !ok {
-		t.edges[ch] = newVHostTrie()
+		t.edges[ch] = newVHostNode()
 	}
 	t.edges[ch].insertPath(remainingPath[1:], originalPath, site)
 }
@@ -15,6 +15,8 @@
 package index
 
 import (
+	"strings"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -38,6 +40,15 @@ func setupIndex(c *caddy.Controller) error {
 			return c.Errf("Expected at least one index")
 		}
 
+		// index /basepath file1 file2...
+		if len(args) > 1 && strings.HasPrefix(args[0], "/") {
+			if cfg.PathIndexPages == nil {
+				cfg.PathIndexPages = make(map[string][]string)
+			}
+			cfg.PathIndexPages[args[0]] = args[1:]
+			continue
+		}
+
 		for _, in := range args {
 			index = append(index, in)
 		}
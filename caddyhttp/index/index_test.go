@@ -123,3 +123,22 @@ func TestPerSiteIndexPageIsolation(t *testing.T) {
 		t.Errorf("Expected different index pages for both sites, got %s for first and %s for second", firstSiteConfig.IndexPages[0], secondSiteConfig.IndexPages[0])
 	}
 }
+
+func TestPathIndex(t *testing.T) {
+	c := caddy.NewTestController("http", `index a.html
+	index /legacy default.asp index.htm`)
+
+	err := setupIndex(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+
+	siteConfig := httpserver.GetConfig(c)
+	if len(siteConfig.IndexPages) != 1 || siteConfig.IndexPages[0] != "a.html" {
+		t.Errorf("Expected site index pages to be [a.html], got %v", siteConfig.IndexPages)
+	}
+	pages := siteConfig.PathIndexPages["/legacy"]
+	if len(pages) != 2 || pages[0] != "default.asp" || pages[1] != "index.htm" {
+		t.Errorf("Expected index pages for /legacy to be [default.asp index.htm], got %v", pages)
+	}
+}
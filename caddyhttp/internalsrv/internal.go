@@ -35,13 +35,23 @@ type Internal struct {
 
 const (
 	redirectHeader        string = "X-Accel-Redirect"
+	altRedirectHeader     string = "X-Internal-Redirect"
 	contentLengthHeader   string = "Content-Length"
 	contentEncodingHeader string = "Content-Encoding"
 	maxRedirectCount      int    = 10
 )
 
 func isInternalRedirect(w http.ResponseWriter) bool {
-	return w.Header().Get(redirectHeader) != ""
+	return redirectTarget(w) != ""
+}
+
+// redirectTarget returns the internal location the response asks to be
+// served from, preferring X-Accel-Redirect over X-Internal-Redirect.
+func redirectTarget(w http.ResponseWriter) string {
+	if target := w.Header().Get(redirectHeader); target != "" {
+		return target
+	}
+	return w.Header().Get(altRedirectHeader)
 }
 
 // ServeHTTP implements the httpserver.Handler interface.
@@ -61,7 +71,7 @@ func (i Internal) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	for c := 0; c < maxRedirectCount && isInternalRedirect(iw); c++ {
 		// Redirect - adapt request URL path and send it again
 		// "down the chain"
-		r.URL.Path = iw.Header().Get(redirectHeader)
+		r.URL.Path = redirectTarget(iw)
 		iw.ClearHeader()
 		status, err = i.Next.ServeHTTP(iw, r)
 	}
@@ -86,6 +96,7 @@ type internalResponseWriter struct {
 // redirect requests.
 func (w internalResponseWriter) ClearHeader() {
 	w.Header().Del(redirectHeader)
+	w.Header().Del(altRedirectHeader)
 	w.Header().Del(contentLengthHeader)
 	w.Header().Del(contentEncodingHeader)
 }
@@ -48,6 +48,7 @@ func TestInternal(t *testing.T) {
 		{"/public/internal", 0, "/public/internal"},
 
 		{"/redirect", 0, "/internal"},
+		{"/redirect-alt", 0, "/internal"},
 
 		{"/cycle", http.StatusInternalServerError, ""},
 	}
@@ -114,6 +115,9 @@ func internalTestHandlerFunc(w http.ResponseWriter, r *http.Request) (int, error
 	case "/redirect":
 		w.Header().Set("X-Accel-Redirect", "/internal")
 
+	case "/redirect-alt":
+		w.Header().Set("X-Internal-Redirect", "/internal")
+
 	case "/cycle":
 		w.Header().Set("X-Accel-Redirect", "/cycle")
 
@@ -0,0 +1,167 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package language provides middleware that picks the language
+// of a response from the Accept-Language header of the request.
+package language
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Language is middleware that negotiates the language of
+// responses. The chosen language is in the {language}
+// placeholder.
+type Language struct {
+	Next httpserver.Handler
+
+	// Languages are the available languages; the
+	// first one is used if none of them is accepted.
+	Languages []string
+
+	// Files rewrites requests for a file like about.html to
+	// a variant like about.de.html, if it exists.
+	Files bool
+
+	// Redirect redirects requests whose path does not start
+	// with a language, like /about, to one that does, like
+	// /de/about.
+	Redirect bool
+
+	FileSys http.FileSystem
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (l Language) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	lang := l.negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Add("Vary", "Accept-Language")
+
+	if l.Redirect {
+		if prefix := l.pathLanguage(r.URL.Path); prefix != "" {
+			lang = prefix
+		} else {
+			to := "/" + lang + r.URL.Path
+			if r.URL.RawQuery != "" {
+				to += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, to, http.StatusFound)
+			return 0, nil
+		}
+	}
+
+	if repl, ok := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer); ok {
+		repl.Set("language", lang)
+	}
+
+	if l.Files {
+		if variant := l.variant(r.URL.Path, lang); variant != "" {
+			r.URL.Path = variant
+			w.Header().Set("Content-Language", lang)
+		}
+	}
+
+	return l.Next.ServeHTTP(w, r)
+}
+
+// negotiate returns the available language the client
+// prefers, going by the Accept-Language header value.
+func (l Language) negotiate(header string) string {
+	type accepted struct {
+		tag string
+		q   float64
+	}
+	var prefs []accepted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, accepted{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, pref := range prefs {
+		if pref.tag == "*" {
+			break
+		}
+		// a range matches its own tag and the tags it
+		// is a prefix of, and also falls back to its
+		// primary language: de-at matches de
+		for _, lang := range l.Languages {
+			if lang == pref.tag || strings.HasPrefix(lang, pref.tag+"-") {
+				return lang
+			}
+		}
+		if i := strings.Index(pref.tag, "-"); i > 0 {
+			for _, lang := range l.Languages {
+				if lang == pref.tag[:i] {
+					return lang
+				}
+			}
+		}
+	}
+	return l.Languages[0]
+}
+
+// pathLanguage returns the language the path starts
+// with, or "" if it does not start with one.
+func (l Language) pathLanguage(p string) string {
+	first := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)[0]
+	for _, lang := range l.Languages {
+		if strings.EqualFold(first, lang) {
+			return lang
+		}
+	}
+	return ""
+}
+
+// variant returns the path of the file for lang that
+// stands in for p, or "" if there is none.
+func (l Language) variant(p, lang string) string {
+	if strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	ext := path.Ext(p)
+	if ext == "" {
+		return ""
+	}
+	variant := strings.TrimSuffix(p, ext) + "." + lang + ext
+	f, err := l.FileSys.Open(variant)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if stat, err := f.Stat(); err != nil || stat.IsDir() {
+		return ""
+	}
+	return variant
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package language
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestNegotiate(t *testing.T) {
+	l := Language{Languages: []string{"en", "de", "pt-br"}}
+	for i, test := range []struct {
+		header, expected string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"DE-at", "de"},
+		{"fr, de;q=0.8, en;q=0.9", "en"},
+		{"fr;q=1.0, de;q=0.5", "de"},
+		{"pt", "pt-br"},
+		{"pt-PT, de;q=0.1", "de"},
+		{"de;q=0, en;q=0.1", "en"},
+		{"*", "en"},
+		{"fr, *;q=0.5, de;q=0.1", "en"},
+		{"garbage;;q=x", "en"},
+	} {
+		if got := l.negotiate(test.header); got != test.expected {
+			t.Errorf("Test %d: Expected %s for '%s', got %s", i, test.expected, test.header, got)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_language")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"about.html", "about.de.html", "index.de.html"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var path, lang string
+	l := Language{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			path = r.URL.Path
+			return http.StatusOK, nil
+		}),
+		Languages: []string{"en", "de"},
+		FileSys:   http.Dir(dir),
+	}
+	serve := func(l Language, target, acceptLanguage string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		repl := httpserver.NewReplacer(r, nil, "")
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, repl))
+		w := httptest.NewRecorder()
+		path = ""
+		if _, err := l.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		lang = repl.Replace("{language}")
+		return w
+	}
+
+	// only the placeholder is set by default
+	if w := serve(l, "/about.html", "de"); path != "/about.html" || lang != "de" || w.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("Expected /about.html in de, got %s in %s", path, lang)
+	}
+
+	l.Files = true
+	for i, test := range []struct {
+		target, acceptLanguage, path, contentLanguage string
+	}{
+		{"/about.html", "de-DE", "/about.de.html", "de"},
+		{"/about.html", "en", "/about.html", ""},
+		{"/", "de", "/index.de.html", "de"},
+		{"/", "en", "/", ""},
+		{"/about", "de", "/about", ""},
+	} {
+		w := serve(l, test.target, test.acceptLanguage)
+		if path != test.path {
+			t.Errorf("Test %d: Expected path %s, got %s", i, test.path, path)
+		}
+		if got := w.Header().Get("Content-Language"); got != test.contentLanguage {
+			t.Errorf("Test %d: Expected Content-Language '%s', got '%s'", i, test.contentLanguage, got)
+		}
+	}
+
+	l.Files = false
+	l.Redirect = true
+	w := serve(l, "/blog/post?page=2", "de")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/de/blog/post?page=2" {
+		t.Errorf("Expected redirect to /de/blog/post?page=2, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	// the language in the path wins over the header
+	serve(l, "/en/blog/post", "de")
+	if path != "/en/blog/post" || lang != "en" {
+		t.Errorf("Expected /en/blog/post in en, got %s in %s", path, lang)
+	}
+}
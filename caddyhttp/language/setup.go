@@ -0,0 +1,79 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package language
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("language", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new Language middleware instance.
+func setup(c *caddy.Controller) error {
+	l, err := languageParse(c)
+	if err != nil {
+		return err
+	}
+	l.FileSys = httpserver.GetConfig(c).SiteFileSystem()
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		l.Next = next
+		return l
+	})
+
+	return nil
+}
+
+func languageParse(c *caddy.Controller) (Language, error) {
+	var l Language
+
+	for c.Next() {
+		if len(l.Languages) > 0 {
+			return l, c.Err("language can only be used once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return l, c.ArgErr()
+		}
+		for _, arg := range args {
+			l.Languages = append(l.Languages, strings.ToLower(arg))
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "files":
+				l.Files = true
+			case "redirect":
+				l.Redirect = true
+			default:
+				return l, c.Errf("unknown subdirective: %s", c.Val())
+			}
+			if c.NextArg() {
+				return l, c.ArgErr()
+			}
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package language
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `language en de`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Language)
+	if !ok {
+		t.Fatalf("Expected handler to be type Language, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestLanguageParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  Language
+	}{
+		{`language en`, false, Language{Languages: []string{"en"}}},
+		{`language en DE pt-BR {
+			files
+			redirect
+		}`, false, Language{Languages: []string{"en", "de", "pt-br"}, Files: true, Redirect: true}},
+		{`language`, true, Language{}},
+		{`language en {
+			files yes
+		}`, true, Language{}},
+		{`language en {
+			unknown
+		}`, true, Language{}},
+		{`language en
+		language de`, true, Language{}},
+	}
+
+	for i, test := range tests {
+		actual, err := languageParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, actual)
+		}
+	}
+}
@@ -17,17 +17,37 @@ package limits
 import (
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 // Limit is a middleware to control request body size
+// and the methods allowed for paths
 type Limit struct {
-	Next       httpserver.Handler
-	BodyLimits []httpserver.PathLimit
+	Next         httpserver.Handler
+	BodyLimits   []httpserver.PathLimit
+	MethodLimits []MethodLimit
+}
+
+// MethodLimit is the list of methods allowed for a path
+type MethodLimit struct {
+	Path    string
+	Methods []string
 }
 
 func (l Limit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// apply the path-based method restriction, longest path first.
+	for _, ml := range l.MethodLimits {
+		if httpserver.Path(r.URL.Path).Matches(ml.Path) {
+			if !ml.allows(r.Method) {
+				w.Header().Set("Allow", strings.Join(ml.Methods, ", "))
+				return http.StatusMethodNotAllowed, nil
+			}
+			break
+		}
+	}
+
 	if r.Body == nil {
 		return l.Next.ServeHTTP(w, r)
 	}
@@ -43,6 +63,15 @@ func (l Limit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	return l.Next.ServeHTTP(w, r)
 }
 
+func (ml MethodLimit) allows(method string) bool {
+	for _, m := range ml.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // MaxBytesReader and its associated methods are borrowed from the
 // Go Standard library (comments intact). The only difference is that
 // it returns a ErrMaxBytesExceeded error instead of a generic error message
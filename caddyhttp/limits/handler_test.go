@@ -50,3 +50,40 @@ func TestBodySizeLimit(t *testing.T) {
 		t.Errorf("expect error %v, got %v", httpserver.ErrMaxBytesExceeded, gotError)
 	}
 }
+
+func TestMethodLimit(t *testing.T) {
+	l := Limit{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		MethodLimits: []MethodLimit{
+			{Path: "/upload", Methods: []string{"POST", "PUT"}},
+			{Path: "/", Methods: []string{"GET", "HEAD"}},
+		},
+	}
+
+	for i, c := range []struct {
+		method       string
+		path         string
+		expectStatus int
+		expectAllow  string
+	}{
+		{"GET", "/", http.StatusOK, ""},
+		{"HEAD", "/index.html", http.StatusOK, ""},
+		{"POST", "/index.html", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"POST", "/upload/file", http.StatusOK, ""},
+		{"GET", "/upload/file", http.StatusMethodNotAllowed, "POST, PUT"},
+	} {
+		rec := httptest.NewRecorder()
+		status, err := l.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+		if err != nil {
+			t.Errorf("Case %d: unexpected error: %v", i, err)
+		}
+		if status != c.expectStatus {
+			t.Errorf("Case %d: expected status %d, got %d", i, c.expectStatus, status)
+		}
+		if got := rec.Header().Get("Allow"); got != c.expectAllow {
+			t.Errorf("Case %d: expected Allow header %q, got %q", i, c.expectAllow, got)
+		}
+	}
+}
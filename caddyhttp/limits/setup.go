@@ -17,7 +17,6 @@ package limits
 import (
 	"errors"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -43,22 +42,24 @@ type pathLimitUnparsed struct {
 }
 
 func setupLimits(c *caddy.Controller) error {
-	bls, err := parseLimits(c)
+	l, err := parseLimits(c)
 	if err != nil {
 		return err
 	}
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Limit{Next: next, BodyLimits: bls}
+		l.Next = next
+		return l
 	})
 	return nil
 }
 
-func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
+func parseLimits(c *caddy.Controller) (Limit, error) {
 	config := httpserver.GetConfig(c)
+	var l Limit
 
 	if !c.Next() {
-		return nil, c.ArgErr()
+		return l, c.ArgErr()
 	}
 
 	args := c.RemainingArgs()
@@ -71,6 +72,8 @@ func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
 		//	header <limit>
 		//	body <path> <limit>
 		//	body <limit>
+		//	methods <path> <method...>
+		//	methods <method...>
 		//	...
 		// }
 		for c.NextBlock() {
@@ -79,9 +82,18 @@ func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
 			switch kind {
 			case "header":
 				if len(pathOrLimit) != 1 {
-					return nil, c.ArgErr()
+					return l, c.ArgErr()
 				}
 				headerLimit = pathOrLimit[0]
+			case "methods":
+				path := "/"
+				if len(pathOrLimit) > 0 && strings.HasPrefix(pathOrLimit[0], "/") {
+					path, pathOrLimit = pathOrLimit[0], pathOrLimit[1:]
+				}
+				if len(pathOrLimit) == 0 {
+					return l, c.ArgErr()
+				}
+				l.MethodLimits = addMethodLimit(l.MethodLimits, path, pathOrLimit)
 			case "body":
 				if len(pathOrLimit) == 1 {
 					argList = append(argList, pathLimitUnparsed{
@@ -101,7 +113,7 @@ func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
 
 				fallthrough
 			default:
-				return nil, c.ArgErr()
+				return l, c.ArgErr()
 			}
 		}
 	case 1:
@@ -112,13 +124,13 @@ func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
 			Limit: args[0],
 		}}
 	default:
-		return nil, c.ArgErr()
+		return l, c.ArgErr()
 	}
 
 	if headerLimit != "" {
-		size := parseSize(headerLimit)
+		size := httpserver.ParseSize(headerLimit)
 		if size < 1 { // also disallow size = 0
-			return nil, c.ArgErr()
+			return l, c.ArgErr()
 		}
 		config.Limits.MaxRequestHeaderSize = size
 	}
@@ -126,20 +138,25 @@ func parseLimits(c *caddy.Controller) ([]httpserver.PathLimit, error) {
 	if len(argList) > 0 {
 		pathLimit, err := parseArguments(argList)
 		if err != nil {
-			return nil, c.ArgErr()
+			return l, c.ArgErr()
 		}
 		SortPathLimits(pathLimit)
 		config.Limits.MaxRequestBodySizes = pathLimit
 	}
 
-	return config.Limits.MaxRequestBodySizes, nil
+	sort.SliceStable(l.MethodLimits, func(i, j int) bool {
+		return len(l.MethodLimits[i].Path) > len(l.MethodLimits[j].Path)
+	})
+	l.BodyLimits = config.Limits.MaxRequestBodySizes
+
+	return l, nil
 }
 
 func parseArguments(args []pathLimitUnparsed) ([]httpserver.PathLimit, error) {
 	pathLimit := []httpserver.PathLimit{}
 
 	for _, pair := range args {
-		size := parseSize(pair.Limit)
+		size := httpserver.ParseSize(pair.Limit)
 		if size < 1 { // also disallow size = 0
 			return pathLimit, errors.New("Parse failed")
 		}
@@ -148,39 +165,6 @@ func parseArguments(args []pathLimitUnparsed) ([]httpserver.PathLimit, error) {
 	return pathLimit, nil
 }
 
-var validUnits = []struct {
-	symbol     string
-	multiplier int64
-}{
-	{"KB", 1024},
-	{"MB", 1024 * 1024},
-	{"GB", 1024 * 1024 * 1024},
-	{"B", 1},
-	{"", 1}, // defaulting to "B"
-}
-
-// parseSize parses the given string as size limit
-// Size are positive numbers followed by a unit (case insensitive)
-// Allowed units: "B" (bytes), "KB" (kilo), "MB" (mega), "GB" (giga)
-// If the unit is omitted, "b" is assumed
-// Returns the parsed size in bytes, or -1 if cannot parse
-func parseSize(sizeStr string) int64 {
-	sizeStr = strings.ToUpper(sizeStr)
-
-	for _, unit := range validUnits {
-		if strings.HasSuffix(sizeStr, unit.symbol) {
-			size, err := strconv.ParseInt(sizeStr[0:len(sizeStr)-len(unit.symbol)], 10, 64)
-			if err != nil {
-				return -1
-			}
-			return size * unit.multiplier
-		}
-	}
-
-	// Unreachable code
-	return -1
-}
-
 // addPathLimit appends the path-to-request body limit mapping to pathLimit
 // Slashes are checked and added to path if necessary. Duplicates are ignored.
 func addPathLimit(pathLimit []httpserver.PathLimit, path string, limit int64) []httpserver.PathLimit {
@@ -200,6 +184,23 @@ func addPathLimit(pathLimit []httpserver.PathLimit, path string, limit int64) []
 	return append(pathLimit, httpserver.PathLimit{Path: path, Limit: limit})
 }
 
+// addMethodLimit appends the path-to-allowed methods mapping to
+// methodLimits. Like addPathLimit, the last value of a path wins.
+func addMethodLimit(methodLimits []MethodLimit, path string, methods []string) []MethodLimit {
+	for i := range methods {
+		methods[i] = strings.ToUpper(methods[i])
+	}
+
+	for i, m := range methodLimits {
+		if m.Path == path {
+			methodLimits[i].Methods = methods
+			return methodLimits
+		}
+	}
+
+	return append(methodLimits, MethodLimit{Path: path, Methods: methods})
+}
+
 // SortPathLimits sort pathLimits by their paths length, longest first
 func SortPathLimits(pathLimits []httpserver.PathLimit) {
 	sorter := &pathLimitSorter{
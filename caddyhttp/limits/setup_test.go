@@ -123,6 +123,56 @@ func TestParseLimits(t *testing.T) {
 	}
 }
 
+func TestParseMethodLimits(t *testing.T) {
+	for name, c := range map[string]struct {
+		input     string
+		shouldErr bool
+		expect    []MethodLimit
+	}{
+		"none": {
+			input: `limits 2kb`,
+		},
+		"catchAll": {
+			input: `limits {
+				methods get head
+			}`,
+			expect: []MethodLimit{{Path: "/", Methods: []string{"GET", "HEAD"}}},
+		},
+		"withPaths": {
+			input: `limits {
+				methods GET HEAD
+				methods /upload POST
+				body /upload 100mb
+				methods /upload PUT
+			}`,
+			expect: []MethodLimit{
+				{Path: "/upload", Methods: []string{"PUT"}},
+				{Path: "/", Methods: []string{"GET", "HEAD"}},
+			},
+		},
+		"noMethods": {
+			input: `limits {
+				methods /upload
+			}`,
+			shouldErr: true,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			l, err := parseLimits(caddy.NewTestController("", c.input))
+			if c.shouldErr && err == nil {
+				t.Error("failed to get expected error")
+			}
+			if !c.shouldErr && err != nil {
+				t.Errorf("got unexpected error: %v", err)
+			}
+			if !c.shouldErr && !reflect.DeepEqual(l.MethodLimits, c.expect) {
+				t.Errorf("expect %#v, but got %#v", c.expect, l.MethodLimits)
+			}
+		})
+	}
+}
+
 func TestParseArguments(t *testing.T) {
 	cases := []struct {
 		arguments []pathLimitUnparsed
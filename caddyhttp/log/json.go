@@ -0,0 +1,85 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// JSONLogFormat is the shorthand that selects JSON-encoded
+// access log entries instead of a text format.
+const JSONLogFormat = "{json}"
+
+// Field is an extra key added to JSON log entries. Its
+// value is the placeholder-expanded Value.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// jsonFieldNames are the keys every JSON log entry has.
+var jsonFieldNames = []string{"ts", "host", "method", "uri", "status", "duration", "size", "remote_ip", "user_agent"}
+
+// jsonEntry holds the standard keys of a JSON log entry. The
+// field names are part of the log format; do not change them.
+type jsonEntry struct {
+	Timestamp float64 `json:"ts"`
+	Host      string  `json:"host"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Status    int     `json:"status"`
+	Duration  float64 `json:"duration"`
+	Size      int     `json:"size"`
+	RemoteIP  string  `json:"remote_ip"`
+	UserAgent string  `json:"user_agent"`
+}
+
+// encodeJSON renders a JSON log entry for a request that started at
+// start and whose response was recorded by rr. Placeholders are
+// expanded with rep so that masked IPs and custom values apply.
+func encodeJSON(rep httpserver.Replacer, rr *httpserver.ResponseRecorder, start time.Time, fields []Field) ([]byte, error) {
+	entry := jsonEntry{
+		Timestamp: float64(start.UnixNano()) / float64(time.Second),
+		Host:      rep.Replace("{host}"),
+		Method:    rep.Replace("{method}"),
+		URI:       rep.Replace("{uri}"),
+		Status:    rr.Status(),
+		Duration:  time.Since(start).Seconds(),
+		Size:      rr.Size(),
+		RemoteIP:  rep.Replace("{remote}"),
+		UserAgent: rep.Replace("{>User-Agent}"),
+	}
+	if len(fields) == 0 {
+		return json.Marshal(entry)
+	}
+
+	// custom fields are merged into the standard ones; setup
+	// makes sure they have names of their own
+	std, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(jsonFieldNames)+len(fields))
+	if err := json.Unmarshal(std, &m); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		m[f.Name] = rep.Replace(f.Value)
+	}
+	return json.Marshal(m)
+}
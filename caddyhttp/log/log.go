@@ -17,8 +17,10 @@ package log
 
 import (
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -28,6 +30,7 @@ func init() {
 	caddy.RegisterPlugin("log", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -42,6 +45,7 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, rule := range l.Rules {
 		if httpserver.Path(r.URL.Path).Matches(rule.PathScope) {
 			// Record the response
+			start := time.Now()
 			responseRecorder := httpserver.NewResponseRecorder(w)
 
 			// Attach the Replacer we'll use so that other middlewares can
@@ -81,6 +85,15 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 						rep.Set("remote", maskedIP)
 					}
 				}
+				if e.Format == JSONLogFormat {
+					entry, err := encodeJSON(rep, responseRecorder, start, e.Fields)
+					if err != nil {
+						log.Printf("[ERROR] Encoding JSON log entry: %v", err)
+						continue
+					}
+					e.Log.Println(string(entry))
+					continue
+				}
 				e.Log.Println(rep.Replace(e.Format))
 
 			}
@@ -95,6 +108,9 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 type Entry struct {
 	Format string
 	Log    *httpserver.Logger
+
+	// Fields are extra keys for entries in JSONLogFormat.
+	Fields []Field
 }
 
 // Rule configures the logging middleware.
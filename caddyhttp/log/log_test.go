@@ -16,6 +16,8 @@ package log
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -78,6 +80,57 @@ func TestLoggedStatus(t *testing.T) {
 	}
 }
 
+func TestJSONLog(t *testing.T) {
+	var f bytes.Buffer
+	logger := Logger{
+		Rules: []*Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Format: JSONLogFormat,
+				Log:    httpserver.NewTestLogger(&f),
+				Fields: []Field{{Name: "custom", Value: "{testval}"}},
+			}},
+		}},
+		Next: erroringMiddleware{},
+	}
+
+	r, err := http.NewRequest("GET", "http://example.com/a?b=c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.OriginalURLCtxKey, *r.URL))
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("User-Agent", "tester")
+
+	if _, err := logger.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(f.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, got '%s': %v", f.String(), err)
+	}
+	for key, expected := range map[string]interface{}{
+		"host":       "example.com",
+		"method":     "GET",
+		"uri":        "/a?b=c",
+		"status":     float64(404),
+		"size":       float64(13),
+		"remote_ip":  "192.0.2.1",
+		"user_agent": "tester",
+		"custom":     "foobar",
+	} {
+		if entry[key] != expected {
+			t.Errorf("Expected %s to be %v, got %v", key, expected, entry[key])
+		}
+	}
+	for _, key := range []string{"ts", "duration"} {
+		if _, ok := entry[key].(float64); !ok {
+			t.Errorf("Expected %s to be a number, got %v", key, entry[key])
+		}
+	}
+}
+
 func TestLogRequestBody(t *testing.T) {
 	var got bytes.Buffer
 	logger := Logger{
@@ -16,7 +16,9 @@ package log
 
 import (
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -55,6 +57,12 @@ func logParse(c *caddy.Controller) ([]*Rule, error) {
 		var logRoller *httpserver.LogRoller
 		logRoller = httpserver.DefaultLogRoller()
 
+		var bufferSize int
+		var blockWhenFull bool
+		var flushInterval time.Duration
+		var blockFormat string
+		var fields []Field
+
 		for c.NextBlock() {
 			what := c.Val()
 			where := c.RemainingArgs()
@@ -97,6 +105,62 @@ func logParse(c *caddy.Controller) ([]*Rule, error) {
 					logExceptions = append(logExceptions, where[i])
 				}
 
+			} else if what == "format" {
+
+				if len(where) != 1 {
+					return nil, c.ArgErr()
+				}
+				blockFormat = where[0]
+
+			} else if what == "field" {
+
+				if len(where) != 2 {
+					return nil, c.ArgErr()
+				}
+				for _, name := range jsonFieldNames {
+					if where[0] == name {
+						return nil, c.Errf("field %s is already part of every entry", name)
+					}
+				}
+				for _, f := range fields {
+					if where[0] == f.Name {
+						return nil, c.Errf("duplicate field %s", f.Name)
+					}
+				}
+				fields = append(fields, Field{Name: where[0], Value: where[1]})
+
+			} else if what == "buffer" {
+
+				if len(where) != 1 && len(where) != 2 {
+					return nil, c.ArgErr()
+				}
+				size, err := strconv.Atoi(where[0])
+				if err != nil || size <= 0 {
+					return nil, c.Errf("buffer size must be a positive integer: %s", where[0])
+				}
+				bufferSize = size
+				if len(where) == 2 {
+					switch where[1] {
+					case "drop":
+						blockWhenFull = false
+					case "block":
+						blockWhenFull = true
+					default:
+						return nil, c.Errf("buffer policy must be drop or block: %s", where[1])
+					}
+				}
+
+			} else if what == "flush_interval" {
+
+				if len(where) != 1 {
+					return nil, c.ArgErr()
+				}
+				interval, err := time.ParseDuration(where[0])
+				if err != nil || interval <= 0 {
+					return nil, c.Errf("invalid flush_interval: %s", where[0])
+				}
+				flushInterval = interval
+
 			} else if httpserver.IsLogRollerSubdirective(what) {
 
 				if err := httpserver.ParseRoller(logRoller, what, where...); err != nil {
@@ -109,6 +173,10 @@ func logParse(c *caddy.Controller) ([]*Rule, error) {
 
 		}
 
+		if flushInterval > 0 && bufferSize == 0 {
+			return nil, c.Err("flush_interval requires buffer")
+		}
+
 		path := "/"
 		format := DefaultLogFormat
 		output := DefaultLogFilename
@@ -124,14 +192,23 @@ func logParse(c *caddy.Controller) ([]*Rule, error) {
 			path = args[0]
 			output = args[1]
 			if len(args) > 2 {
-				format = strings.Replace(args[2], "{common}", CommonLogFormat, -1)
-				format = strings.Replace(format, "{combined}", CombinedLogFormat, -1)
+				if blockFormat != "" {
+					return nil, c.Err("log format specified twice")
+				}
+				format = expandFormat(args[2])
 			}
 		default:
 			// Maximum number of args in log directive is 3.
 			return nil, c.ArgErr()
 		}
 
+		if blockFormat != "" {
+			format = expandFormat(blockFormat)
+		}
+		if len(fields) > 0 && format != JSONLogFormat {
+			return nil, c.Errf("fields require the %s format", JSONLogFormat)
+		}
+
 		rules = appendEntry(rules, path, &Entry{
 			Log: &httpserver.Logger{
 				Output:       output,
@@ -140,14 +217,26 @@ func logParse(c *caddy.Controller) ([]*Rule, error) {
 				V6ipMask:     ip6Mask,
 				IPMaskExists: ipMaskExists,
 				Exceptions:   logExceptions,
+
+				BufferSize:    bufferSize,
+				FlushInterval: flushInterval,
+				BlockWhenFull: blockWhenFull,
 			},
 			Format: format,
+			Fields: fields,
 		})
 	}
 
 	return rules, nil
 }
 
+// expandFormat replaces the {common} and {combined}
+// shorthands in format with the formats they stand for.
+func expandFormat(format string) string {
+	format = strings.Replace(format, "{common}", CommonLogFormat, -1)
+	return strings.Replace(format, "{combined}", CombinedLogFormat, -1)
+}
+
 func appendEntry(rules []*Rule, pathScope string, entry *Entry) []*Rule {
 	for _, rule := range rules {
 		if rule.PathScope == pathScope {
@@ -18,6 +18,7 @@ import (
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -238,6 +239,26 @@ func TestLogParse(t *testing.T) {
 				Format: "{when}",
 			}},
 		}}},
+		{`log access.log {
+			rotate_size 1GB
+			rotate_age 2w
+		}`, false, []Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Log: &httpserver.Logger{
+					Output: "access.log",
+					Roller: &httpserver.LogRoller{
+						MaxSize:    1024,
+						MaxAge:     14,
+						MaxBackups: 10,
+						LocalTime:  true,
+					},
+					V4ipMask: net.IPMask(net.ParseIP(DefaultIP4Mask).To4()),
+					V6ipMask: net.IPMask(net.ParseIP(DefaultIP6Mask)),
+				},
+				Format: DefaultLogFormat,
+			}},
+		}}},
 		{`log access.log {
 			rotate_size 2
 			rotate_age 10
@@ -331,9 +352,106 @@ func TestLogParse(t *testing.T) {
 				Format: "{when}",
 			}},
 		}}},
+		{`log access.log {
+			buffer 1000
+			flush_interval 500ms
+		}`, false, []Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Log: &httpserver.Logger{
+					Output:        "access.log",
+					Roller:        httpserver.DefaultLogRoller(),
+					V4ipMask:      net.IPMask(net.ParseIP(DefaultIP4Mask).To4()),
+					V6ipMask:      net.IPMask(net.ParseIP(DefaultIP6Mask)),
+					BufferSize:    1000,
+					FlushInterval: 500 * time.Millisecond,
+				},
+				Format: DefaultLogFormat,
+			}},
+		}}},
+		{`log access.log {
+			buffer 1000 block
+		}`, false, []Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Log: &httpserver.Logger{
+					Output:        "access.log",
+					Roller:        httpserver.DefaultLogRoller(),
+					V4ipMask:      net.IPMask(net.ParseIP(DefaultIP4Mask).To4()),
+					V6ipMask:      net.IPMask(net.ParseIP(DefaultIP6Mask)),
+					BufferSize:    1000,
+					BlockWhenFull: true,
+				},
+				Format: DefaultLogFormat,
+			}},
+		}}},
+		{`log stdout {
+			format "{combined} {latency_ms}"
+		}`, false, []Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Log: &httpserver.Logger{
+					Output:   "stdout",
+					Roller:   httpserver.DefaultLogRoller(),
+					V4ipMask: net.IPMask(net.ParseIP(DefaultIP4Mask).To4()),
+					V6ipMask: net.IPMask(net.ParseIP(DefaultIP6Mask)),
+				},
+				Format: CombinedLogFormat + " {latency_ms}",
+			}},
+		}}},
+		{`log / stdout {host} {
+			format {when}
+		}`, true, nil},
+		{`log stdout {
+			format
+		}`, true, nil},
+		{`log access.log {
+			format {json}
+			field proto {proto}
+			field req_id {>X-Request-ID}
+		}`, false, []Rule{{
+			PathScope: "/",
+			Entries: []*Entry{{
+				Log: &httpserver.Logger{
+					Output:   "access.log",
+					Roller:   httpserver.DefaultLogRoller(),
+					V4ipMask: net.IPMask(net.ParseIP(DefaultIP4Mask).To4()),
+					V6ipMask: net.IPMask(net.ParseIP(DefaultIP6Mask)),
+				},
+				Format: JSONLogFormat,
+				Fields: []Field{{"proto", "{proto}"}, {"req_id", "{>X-Request-ID}"}},
+			}},
+		}}},
+		{`log access.log {
+			field proto {proto}
+		}`, true, nil},
+		{`log access.log {
+			format {json}
+			field status {status}
+		}`, true, nil},
+		{`log access.log {
+			format {json}
+			field a {proto}
+			field a {host}
+		}`, true, nil},
+		{`log access.log { buffer 0 }`, true, nil},
+		{`log access.log { buffer }`, true, nil},
+		{`log access.log { buffer 10 wait }`, true, nil},
+		{`log access.log { buffer 10 block drop }`, true, nil},
+		{`log access.log { flush_interval 1s }`, true, nil},
+		{`log access.log {
+			buffer 10
+			flush_interval nope
+		}`, true, nil},
 		{`log access.log { rotate_size 2 rotate_age 10 rotate_keep 3 }`, true, nil},
 		{`log access.log { rotate_compress invalid }`, true, nil},
 		{`log access.log { rotate_size }`, true, nil},
+		{`log access.log {
+			rotate_size 10TB
+		}`, true, nil},
+		{`log access.log {
+			rotate_age -1d
+		}`, true, nil},
 		{`log access.log { ipmask }`, true, nil},
 		{`log access.log { invalid_option 1 }`, true, nil},
 		{`log / access.log "{remote} - [{when}] "{method} {port}" {scheme} {mitm} "`, true, nil},
@@ -369,6 +487,11 @@ func TestLogParse(t *testing.T) {
 						i, j, test.expectedLogRules[j].Entries[k].Log, actualEntry.Log)
 				}
 
+				if !reflect.DeepEqual(actualEntry.Fields, test.expectedLogRules[j].Entries[k].Fields) {
+					t.Errorf("Test %d expected %dth LogRule Fields to be %v, but got %v",
+						i, j, test.expectedLogRules[j].Entries[k].Fields, actualEntry.Fields)
+				}
+
 				if actualEntry.Format != test.expectedLogRules[j].Entries[k].Format {
 					t.Errorf("Test %d expected %dth LogRule Format to be  %s  , but got %s",
 						i, j, test.expectedLogRules[j].Entries[k].Format, actualEntry.Format)
@@ -0,0 +1,175 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maintenance provides middleware that takes a site down
+// for maintenance while a trigger file exists.
+package maintenance
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Maintenance is middleware that responds with 503 Service
+// Unavailable while maintenance mode is on, except to allowed
+// clients and paths.
+type Maintenance struct {
+	Next httpserver.Handler
+
+	// Trigger is the file whose existence turns maintenance
+	// mode on, so that deploy scripts can simply touch it.
+	Trigger string
+
+	// Page is the body of the 503 response. If empty, the
+	// status is returned for the errors middleware to handle.
+	Page []byte
+
+	// RetryAfter is sent in the Retry-After header.
+	RetryAfter time.Duration
+
+	// AllowIPs and AllowPaths are served as usual during
+	// maintenance.
+	AllowIPs   []*net.IPNet
+	AllowPaths []string
+
+	// Endpoint, if set, is a path where clients in AllowIPs
+	// can turn maintenance mode on with PUT and off with
+	// DELETE, and see if it is on with GET.
+	Endpoint string
+
+	trigger *trigger
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	allowedIP := m.allowedIP(r)
+
+	if m.Endpoint != "" && httpserver.Path(r.URL.Path).Matches(m.Endpoint) {
+		if !allowedIP {
+			return http.StatusNotFound, nil
+		}
+		return m.serveEndpoint(w, r)
+	}
+
+	if allowedIP || !m.trigger.on() {
+		return m.Next.ServeHTTP(w, r)
+	}
+	for _, path := range m.AllowPaths {
+		if httpserver.Path(r.URL.Path).Matches(path) {
+			return m.Next.ServeHTTP(w, r)
+		}
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.RetryAfter.Seconds())))
+	w.Header().Set("Cache-Control", "no-store")
+	if len(m.Page) == 0 {
+		return http.StatusServiceUnavailable, nil
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(m.Page)
+	return 0, nil
+}
+
+// serveEndpoint turns maintenance mode on or off.
+func (m Maintenance) serveEndpoint(w http.ResponseWriter, r *http.Request) (int, error) {
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		if err := m.trigger.set(true); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	case http.MethodDelete:
+		if err := m.trigger.set(false); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	case http.MethodGet, http.MethodHead:
+	default:
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if m.trigger.on() {
+		w.Write([]byte("on\n"))
+	} else {
+		w.Write([]byte("off\n"))
+	}
+	return 0, nil
+}
+
+func (m Maintenance) allowedIP(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range m.AllowIPs {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerCheckInterval is how often the trigger file is
+// looked for, at most.
+const triggerCheckInterval = time.Second
+
+// trigger keeps track of whether a trigger file exists.
+type trigger struct {
+	file string
+
+	mu      sync.Mutex
+	checked time.Time
+	exists  bool
+}
+
+func (t *trigger) on() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.checked) >= triggerCheckInterval {
+		_, err := os.Stat(t.file)
+		t.exists = err == nil
+		t.checked = time.Now()
+	}
+	return t.exists
+}
+
+// set creates or removes the trigger file.
+func (t *trigger) set(on bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var err error
+	if on {
+		err = ioutil.WriteFile(t.file, nil, 0644)
+	} else if err = os.Remove(t.file); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	t.exists = on
+	t.checked = time.Now()
+	return nil
+}
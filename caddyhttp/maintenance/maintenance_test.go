@@ -0,0 +1,112 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMaintenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "down")
+	_, admins, _ := net.ParseCIDR("10.0.0.0/8")
+	m := Maintenance{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Trigger:    file,
+		Page:       []byte("be right back"),
+		RetryAfter: 2 * time.Minute,
+		AllowIPs:   []*net.IPNet{admins},
+		AllowPaths: []string{"/health"},
+		Endpoint:   "/_maintenance",
+		trigger:    &trigger{file: file},
+	}
+
+	serve := func(method, path, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		status, err := m.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("%s %s: Expected no error, got %v", method, path, err)
+		}
+		if status != 0 {
+			w.Code = status
+		}
+		return w
+	}
+
+	if w := serve("GET", "/", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected site to be up, got %d", w.Code)
+	}
+
+	// only allowed clients can use the endpoint
+	if w := serve("PUT", "/_maintenance", "192.0.2.1:1234"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected endpoint to be hidden, got %d", w.Code)
+	}
+	if w := serve("PUT", "/_maintenance", "10.1.2.3:1234"); w.Code != http.StatusOK || w.Body.String() != "on\n" {
+		t.Errorf("Expected maintenance to be turned on, got %d '%s'", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected trigger file to be created: %v", err)
+	}
+
+	w := serve("GET", "/", "192.0.2.1:1234")
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "be right back" {
+		t.Errorf("Expected maintenance page, got %d '%s'", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "120" {
+		t.Errorf("Expected Retry-After 120, got '%s'", got)
+	}
+	if w := serve("GET", "/health", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected allowed path to be served, got %d", w.Code)
+	}
+	if w := serve("GET", "/", "10.1.2.3:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected allowed client to be served, got %d", w.Code)
+	}
+
+	if w := serve("DELETE", "/_maintenance", "10.1.2.3:1234"); w.Body.String() != "off\n" {
+		t.Errorf("Expected maintenance to be turned off, got '%s'", w.Body.String())
+	}
+	if w := serve("GET", "/", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected site to be up again, got %d", w.Code)
+	}
+
+	// the file can also be created by hand; it is noticed
+	// within the check interval
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.trigger.checked = time.Time{}
+	m.Page = nil
+	if w := serve("GET", "/", "192.0.2.1:1234"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected maintenance status without a page, got %d", w.Code)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("maintenance", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// DefaultRetryAfter is the Retry-After of maintenance responses.
+const DefaultRetryAfter = 5 * time.Minute
+
+// setup configures a new Maintenance middleware instance.
+func setup(c *caddy.Controller) error {
+	m, err := maintenanceParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		m.Next = next
+		return m
+	})
+
+	return nil
+}
+
+func maintenanceParse(c *caddy.Controller) (Maintenance, error) {
+	cfg := httpserver.GetConfig(c)
+	m := Maintenance{RetryAfter: DefaultRetryAfter}
+
+	for c.Next() {
+		if m.trigger != nil {
+			return m, c.Err("maintenance can only be used once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return m, c.ArgErr()
+		}
+		m.Trigger = args[0]
+		m.trigger = &trigger{file: m.Trigger}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return m, c.ArgErr()
+			}
+
+			switch what {
+			case "page":
+				if len(args) != 1 {
+					return m, c.ArgErr()
+				}
+				where := args[0]
+				if !filepath.IsAbs(where) {
+					where = filepath.Join(cfg.Root, where)
+				}
+				page, err := ioutil.ReadFile(where)
+				if err != nil {
+					return m, c.Errf("reading maintenance page: %v", err)
+				}
+				m.Page = page
+			case "retry_after":
+				if len(args) != 1 {
+					return m, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < time.Second {
+					return m, c.Errf("invalid retry_after '%s'", args[0])
+				}
+				m.RetryAfter = d
+			case "allow_ip":
+				for _, arg := range args {
+					if !strings.Contains(arg, "/") {
+						if ip := net.ParseIP(arg); ip != nil && ip.To4() != nil {
+							arg += "/32"
+						} else {
+							arg += "/128"
+						}
+					}
+					_, network, err := net.ParseCIDR(arg)
+					if err != nil {
+						return m, c.Err(err.Error())
+					}
+					m.AllowIPs = append(m.AllowIPs, network)
+				}
+			case "allow_path":
+				m.AllowPaths = append(m.AllowPaths, args...)
+			case "endpoint":
+				if len(args) != 1 {
+					return m, c.ArgErr()
+				}
+				m.Endpoint = args[0]
+			default:
+				return m, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+	}
+
+	// anyone could take the site down otherwise
+	if m.Endpoint != "" && len(m.AllowIPs) == 0 {
+		return m, c.Err("maintenance endpoint requires allow_ip")
+	}
+
+	return m, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `maintenance /tmp/maintenance`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Maintenance)
+	if !ok {
+		t.Fatalf("Expected handler to be type Maintenance, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestMaintenanceParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "503.html"), []byte("be right back"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("http", `maintenance /var/run/site.down {
+		page 503.html
+		retry_after 10m
+		allow_ip 10.0.0.0/8 192.168.1.1 ::1
+		allow_path /health /status
+		endpoint /_maintenance
+	}`)
+	httpserver.GetConfig(c).Root = dir
+	m, err := maintenanceParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.Trigger != "/var/run/site.down" || m.trigger == nil {
+		t.Errorf("Expected trigger /var/run/site.down, got '%s'", m.Trigger)
+	}
+	if string(m.Page) != "be right back" {
+		t.Errorf("Expected the page to be read relative to the root, got '%s'", m.Page)
+	}
+	if m.RetryAfter != 10*time.Minute {
+		t.Errorf("Expected retry_after 10m, got %v", m.RetryAfter)
+	}
+	if len(m.AllowIPs) != 3 || m.AllowIPs[1].String() != "192.168.1.1/32" || m.AllowIPs[2].String() != "::1/128" {
+		t.Errorf("Expected 3 networks, got %v", m.AllowIPs)
+	}
+	if len(m.AllowPaths) != 2 || m.Endpoint != "/_maintenance" {
+		t.Errorf("Expected 2 paths and an endpoint, got %v and '%s'", m.AllowPaths, m.Endpoint)
+	}
+
+	m, err = maintenanceParse(caddy.NewTestController("http", `maintenance down`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.RetryAfter != DefaultRetryAfter || len(m.Page) != 0 {
+		t.Errorf("Expected defaults, got %#v", m)
+	}
+
+	for i, input := range []string{
+		`maintenance`,
+		`maintenance a b`,
+		`maintenance a
+		maintenance b`,
+		`maintenance down {
+			page /nonexistent/503.html
+		}`,
+		`maintenance down {
+			retry_after soon
+		}`,
+		`maintenance down {
+			allow_ip 10.0.0.0/33
+		}`,
+		`maintenance down {
+			endpoint /_maintenance
+		}`,
+		`maintenance down {
+			unknown x
+		}`,
+	} {
+		if _, err := maintenanceParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
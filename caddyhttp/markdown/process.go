@@ -15,9 +15,11 @@
 package markdown
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 	"github.com/mholt/caddy/caddyhttp/markdown/metadata"
@@ -38,6 +40,23 @@ var recognizedMetaTags = []string{
 	"subject",
 }
 
+// metaString formats a front matter value as the content of a
+// meta tag; lists (e.g. several authors) are comma-separated.
+func metaString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 // Summarize returns an abbreviated string representation of the markdown stored in this file.
 // wordcount is the number of words returned in the summary.
 func (f FileInfo) Summarize(wordcount int) (string, error) {
@@ -88,7 +107,7 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 	meta := make(map[string]string)
 	for _, val := range recognizedMetaTags {
 		if mVal, ok := mdata.Variables[val]; ok {
-			meta[val] = mVal.(string)
+			meta[val] = metaString(mVal)
 		}
 	}
 
@@ -55,3 +55,23 @@ func TestConfig_Markdown(t *testing.T) {
 		}
 	}
 }
+
+func TestConfig_MarkdownNonStringMeta(t *testing.T) {
+	config := &Config{
+		Template: GetDefaultTemplate(),
+	}
+	toml := "+++\nauthor = [\"Ann\", \"Bob\"]\nsubject = 42\n+++"
+
+	res, err := config.Markdown("Test title", strings.NewReader(toml), []os.FileInfo{}, httpserver.Context{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, expect := range []string{
+		`<meta name="author" content="Ann, Bob">`,
+		`<meta name="subject" content="42">`,
+	} {
+		if !strings.Contains(string(res), expect) {
+			t.Errorf("Expected output to contain %s, got: %s", expect, res)
+		}
+	}
+}
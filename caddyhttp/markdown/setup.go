@@ -15,7 +15,6 @@
 package markdown
 
 import (
-	"net/http"
 	"path/filepath"
 
 	"github.com/mholt/caddy"
@@ -27,6 +26,7 @@ func init() {
 	caddy.RegisterPlugin("markdown", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -41,7 +41,7 @@ func setup(c *caddy.Controller) error {
 
 	md := Markdown{
 		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		FileSys: cfg.SiteFileSystem(),
 		Configs: mdconfigs,
 	}
 
@@ -17,11 +17,12 @@ package mime
 import (
 	"net/http"
 	"path"
+	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
-// Config represent a mime config. Map from extension to mime-type.
+// Config represent a mime config. Map from lower-case extension to mime-type.
 // Note, this should be safe with concurrent read access, as this is
 // not modified concurrently.
 type Config map[string]string
@@ -35,7 +36,7 @@ type Mime struct {
 // ServeHTTP implements the httpserver.Handler interface.
 func (e Mime) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// Get a clean /-path, grab the extension
-	ext := path.Ext(path.Clean(r.URL.Path))
+	ext := strings.ToLower(path.Ext(path.Clean(r.URL.Path)))
 
 	if contentType, ok := e.Configs[ext]; ok {
 		w.Header().Set("Content-Type", contentType)
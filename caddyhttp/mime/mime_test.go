@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -34,7 +35,7 @@ func TestMimeHandler(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	exts := []string{
-		".html", ".txt", ".swf",
+		".html", ".txt", ".swf", ".HTML",
 	}
 	for _, e := range exts {
 		url := "/file" + e
@@ -42,7 +43,7 @@ func TestMimeHandler(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		m.Next = nextFunc(true, mimes[e])
+		m.Next = nextFunc(true, mimes[strings.ToLower(e)])
 		_, err = m.ServeHTTP(w, r)
 		if err != nil {
 			t.Error(err)
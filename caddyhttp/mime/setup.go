@@ -26,6 +26,7 @@ func init() {
 	caddy.RegisterPlugin("mime", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -51,23 +52,28 @@ func mimeParse(c *caddy.Controller) (Config, error) {
 
 		args := c.RemainingArgs()
 		switch len(args) {
-		case 2:
-			if err := validateExt(configs, args[0]); err != nil {
-				return configs, err
-			}
-			configs[args[0]] = args[1]
-		case 1:
-			return configs, c.ArgErr()
 		case 0:
 			for c.NextBlock() {
-				ext := c.Val()
-				if err := validateExt(configs, ext); err != nil {
+				// extensions, up to the mime-type
+				line := []string{c.Val()}
+				if err := validateExt(configs, c.Val()); err != nil {
 					return configs, err
 				}
-				if !c.NextArg() {
-					return configs, c.ArgErr()
+				for strings.HasPrefix(c.Val(), ".") {
+					if !c.NextArg() {
+						return configs, c.ArgErr()
+					}
+					line = append(line, c.Val())
+				}
+				if err := addExts(configs, line); err != nil {
+					return configs, err
 				}
-				configs[ext] = c.Val()
+			}
+		case 1:
+			return configs, c.ArgErr()
+		default:
+			if err := addExts(configs, args); err != nil {
+				return configs, err
 			}
 		}
 
@@ -76,6 +82,20 @@ func mimeParse(c *caddy.Controller) (Config, error) {
 	return configs, nil
 }
 
+// addExts maps the extensions in args, all but the
+// last, to the mime-type that is last.
+func addExts(configs Config, args []string) error {
+	contentType := args[len(args)-1]
+	for _, ext := range args[:len(args)-1] {
+		ext = strings.ToLower(ext)
+		if err := validateExt(configs, ext); err != nil {
+			return err
+		}
+		configs[ext] = contentType
+	}
+	return nil
+}
+
 // validateExt checks for valid file name extension.
 func validateExt(configs Config, ext string) error {
 	if !strings.HasPrefix(ext, ".") {
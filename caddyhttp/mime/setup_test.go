@@ -65,6 +65,13 @@ func TestSetup(t *testing.T) {
 		{`mime { .html
 		} `, true},
 		{`mime .txt text/plain`, false},
+		{`mime .js .mjs text/javascript`, false},
+		{`mime .js txt text/javascript`, true},
+		{`mime .js .JS text/javascript`, true},
+		{`mime {
+		 .wasm application/wasm
+		 .js .mjs text/javascript
+		} `, false},
 	}
 	for i, test := range tests {
 		m, err := mimeParse(caddy.NewTestController("http", test.input))
@@ -75,3 +82,26 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestMimeParseExtensions(t *testing.T) {
+	m, err := mimeParse(caddy.NewTestController("http", `mime {
+		.WASM application/wasm
+		.js .mjs text/javascript
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := Config{
+		".wasm": "application/wasm",
+		".js":   "text/javascript",
+		".mjs":  "text/javascript",
+	}
+	if len(m) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, m)
+	}
+	for ext, contentType := range expected {
+		if m[ext] != contentType {
+			t.Errorf("Expected %s to be %s, got %s", ext, contentType, m[ext])
+		}
+	}
+}
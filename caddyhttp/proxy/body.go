@@ -16,10 +16,17 @@ package proxy
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"log"
+	"os"
 )
 
+// errBodyTooLarge is returned when a request body does not
+// fit in the configured buffer.
+var errBodyTooLarge = errors.New("request body exceeds buffer size")
+
 type bufferedBody struct {
 	*bytes.Reader
 }
@@ -52,3 +59,102 @@ func newBufferedBody(src io.ReadCloser) (*bufferedBody, error) {
 		Reader: bytes.NewReader(b),
 	}, nil
 }
+
+// newLimitedBufferedBody is like newBufferedBody, but returns
+// errBodyTooLarge if src holds more than max bytes.
+func newLimitedBufferedBody(src io.ReadCloser, max int64) (*bufferedBody, error) {
+	if src == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(src, max+1))
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, errBodyTooLarge
+	}
+	return &bufferedBody{
+		Reader: bytes.NewReader(b),
+	}, nil
+}
+
+// spooledBody is a request body that was too large to buffer
+// in memory and was written to a temporary file instead.
+type spooledBody struct {
+	*os.File
+}
+
+// Close does nothing, so that the body can be sent again after
+// a failed attempt; call remove once the request is done.
+func (*spooledBody) Close() error {
+	return nil
+}
+
+// rewind allows spooledBody to be read again.
+func (b *spooledBody) rewind() error {
+	_, err := b.Seek(0, io.SeekStart)
+	return err
+}
+
+// remove closes and deletes the temporary file.
+func (b *spooledBody) remove() {
+	name := b.Name()
+	if err := b.File.Close(); err != nil {
+		log.Printf("[ERROR] closing spooled request body %s: %v", name, err)
+	}
+	if err := os.Remove(name); err != nil {
+		log.Printf("[ERROR] removing spooled request body %s: %v", name, err)
+	}
+}
+
+// newSpooledBody buffers src like newLimitedBufferedBody with a
+// limit of memMax, but if src holds more than that, spools all of
+// it to a temporary file in dir instead. It returns
+// errBodyTooLarge if src holds more than diskMax bytes. The
+// returned body is either a *bufferedBody or a *spooledBody.
+func newSpooledBody(src io.ReadCloser, memMax, diskMax int64, dir string) (io.ReadCloser, int64, error) {
+	if src == nil {
+		return nil, 0, nil
+	}
+	defer src.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(src, memMax+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(b)) <= memMax {
+		return &bufferedBody{Reader: bytes.NewReader(b)}, int64(len(b)), nil
+	}
+
+	f, err := ioutil.TempFile(dir, "caddy_proxy_body_")
+	if err != nil {
+		return nil, 0, err
+	}
+	body := &spooledBody{File: f}
+	n, err := io.Copy(f, io.LimitReader(io.MultiReader(bytes.NewReader(b), src), diskMax+1))
+	if err == nil && n > diskMax {
+		err = errBodyTooLarge
+	}
+	if err == nil {
+		err = body.rewind()
+	}
+	if err != nil {
+		body.remove()
+		return nil, 0, err
+	}
+	return body, n, nil
+}
+
+// rewindableBody is a request body that can be sent again.
+type rewindableBody interface {
+	rewind() error
+}
+
+// requestBufferer is implemented by upstreams that read
+// request bodies fully before sending them upstream. Bodies
+// larger than memory are spooled to files in dir, up to disk
+// bytes; if disk is zero, they are rejected instead.
+type requestBufferer interface {
+	requestBuffering() (memory, disk int64, dir string)
+}
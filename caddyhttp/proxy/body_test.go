@@ -21,6 +21,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 )
 
@@ -90,3 +91,69 @@ func TestBodyRetry(t *testing.T) {
 		t.Fatalf("result = %s, want %s", result, testCase)
 	}
 }
+
+func TestLimitedBufferedBody(t *testing.T) {
+	body, err := newLimitedBufferedBody(ioutil.NopCloser(bytes.NewBufferString("12345")), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Len() != 5 {
+		t.Errorf("Expected 5 buffered bytes, got %d", body.Len())
+	}
+
+	if _, err := newLimitedBufferedBody(ioutil.NopCloser(bytes.NewBufferString("123456")), 5); err != errBodyTooLarge {
+		t.Errorf("Expected errBodyTooLarge, got %v", err)
+	}
+}
+
+func TestSpooledBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// small bodies stay in memory
+	body, n, err := newSpooledBody(ioutil.NopCloser(bytes.NewBufferString("1234")), 4, 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body.(*bufferedBody); !ok || n != 4 {
+		t.Errorf("Expected 4 bytes buffered in memory, got %T with %d bytes", body, n)
+	}
+
+	// larger ones go to disk and can be read repeatedly
+	body, n, err = newSpooledBody(ioutil.NopCloser(bytes.NewBufferString("0123456789")), 4, 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, ok := body.(*spooledBody)
+	if !ok || n != 10 {
+		t.Fatalf("Expected 10 bytes spooled to disk, got %T with %d bytes", body, n)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sb.rewind(); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(sb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "0123456789" {
+			t.Errorf("Read %d: Expected spooled body, got %q", i, b)
+		}
+		sb.Close()
+	}
+	sb.remove()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected spool file to be removed, found %d files", len(files))
+	}
+
+	// too large bodies are rejected and leave nothing behind
+	if _, _, err := newSpooledBody(ioutil.NopCloser(bytes.NewBufferString("0123456789a")), 4, 10, dir); err != errBodyTooLarge {
+		t.Errorf("Expected errBodyTooLarge, got %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected no spool files after rejecting a body, found %d files", len(files))
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// CircuitBreaker tracks the outcome of requests sent to an
+// upstream host over a window of time, and ejects the host
+// for a while when too many of them fail or are too slow.
+type CircuitBreaker struct {
+	// Window is how long outcomes are counted before
+	// the counters start over.
+	Window time.Duration
+
+	// MinRequests is how many requests must be seen in
+	// a window before the breaker may trip.
+	MinRequests int
+
+	// ErrorRate is the fraction of failed requests, from
+	// 0 to 1, at which the breaker trips. Zero disables it.
+	ErrorRate float64
+
+	// Latency is the average time to response headers at
+	// which the breaker trips. Zero disables it.
+	Latency time.Duration
+
+	// OpenDuration is how long the host is ejected
+	// after the breaker trips.
+	OpenDuration time.Duration
+
+	mu        sync.Mutex
+	start     time.Time
+	requests  int
+	failures  int
+	latency   time.Duration
+	openUntil time.Time
+}
+
+// newCircuitBreaker returns a breaker with the same settings
+// as cb but with its own, empty state.
+func (cb *CircuitBreaker) newCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		Window:       cb.Window,
+		MinRequests:  cb.MinRequests,
+		ErrorRate:    cb.ErrorRate,
+		Latency:      cb.Latency,
+		OpenDuration: cb.OpenDuration,
+	}
+}
+
+// Open returns true if the breaker has tripped and
+// the host should not receive requests.
+func (cb *CircuitBreaker) Open() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return time.Now().Before(cb.openUntil)
+}
+
+// Record counts the outcome of one request that took
+// latency to get a response, and trips the breaker if
+// the thresholds are exceeded.
+func (cb *CircuitBreaker) Record(latency time.Duration, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(cb.start) >= cb.Window {
+		cb.reset(now)
+	}
+
+	cb.requests++
+	cb.latency += latency
+	if failed {
+		cb.failures++
+	}
+	if cb.requests < cb.MinRequests {
+		return
+	}
+
+	tooManyErrors := cb.ErrorRate > 0 && float64(cb.failures)/float64(cb.requests) >= cb.ErrorRate
+	tooSlow := cb.Latency > 0 && cb.latency/time.Duration(cb.requests) >= cb.Latency
+	if tooManyErrors || tooSlow {
+		cb.openUntil = now.Add(cb.OpenDuration)
+		cb.reset(cb.openUntil)
+	}
+}
+
+func (cb *CircuitBreaker) reset(start time.Time) {
+	cb.start = start
+	cb.requests = 0
+	cb.failures = 0
+	cb.latency = 0
+}
+
+// fallbackResponse is sent downstream instead of an
+// error when no upstream host is available.
+type fallbackResponse struct {
+	status int
+	body   string
+}
+
+// fallbackUpstream is implemented by upstreams that have
+// a fallback response configured.
+type fallbackUpstream interface {
+	fallback() *fallbackResponse
+}
+
+// parseCircuitBreaker parses the circuit_breaker block
+// of the proxy directive into u.
+func parseCircuitBreaker(c *caddyfile.Dispenser, u *staticUpstream) error {
+	cb := &CircuitBreaker{
+		Window:       10 * time.Second,
+		MinRequests:  10,
+		OpenDuration: 30 * time.Second,
+	}
+	if !c.NextArg() || c.Val() != "{" {
+		return c.ArgErr()
+	}
+	for c.Next() {
+		if c.Val() == "}" {
+			break
+		}
+		prop := c.Val()
+		args := c.RemainingArgs()
+		switch prop {
+		case "window", "latency", "open_duration":
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+			dur, err := time.ParseDuration(args[0])
+			if err != nil {
+				return err
+			}
+			if dur <= 0 {
+				return c.Errf("%s must be positive", prop)
+			}
+			switch prop {
+			case "window":
+				cb.Window = dur
+			case "latency":
+				cb.Latency = dur
+			case "open_duration":
+				cb.OpenDuration = dur
+			}
+		case "min_requests":
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return err
+			}
+			if n < 1 {
+				return c.Err("min_requests must be at least 1")
+			}
+			cb.MinRequests = n
+		case "error_rate":
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+			rate, err := strconv.ParseFloat(args[0], 64)
+			if err != nil {
+				return err
+			}
+			if rate <= 0 || rate > 1 {
+				return c.Err("error_rate must be greater than 0 and at most 1")
+			}
+			cb.ErrorRate = rate
+		case "fallback":
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+			status, err := strconv.Atoi(args[0])
+			if err != nil {
+				return c.Errf("invalid fallback status code '%s'", args[0])
+			}
+			if status < 100 || status > 999 {
+				return c.Errf("invalid fallback status code %d", status)
+			}
+			u.breakerFallback = &fallbackResponse{status: status}
+			if len(args) == 2 {
+				u.breakerFallback.body = args[1]
+			}
+		default:
+			return c.Errf("unknown circuit_breaker property '%s'", prop)
+		}
+	}
+	if cb.ErrorRate == 0 && cb.Latency == 0 {
+		return c.Err("circuit_breaker needs an error_rate or latency threshold")
+	}
+	u.CircuitBreaker = cb
+	return nil
+}
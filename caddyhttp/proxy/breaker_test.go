@@ -0,0 +1,181 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	cb := &CircuitBreaker{
+		Window:       time.Minute,
+		MinRequests:  4,
+		ErrorRate:    0.5,
+		OpenDuration: time.Minute,
+	}
+	cb.Record(0, true)
+	cb.Record(0, true)
+	cb.Record(0, false)
+	if cb.Open() {
+		t.Fatal("Expected breaker to stay closed below min_requests")
+	}
+	cb.Record(0, false)
+	if !cb.Open() {
+		t.Fatal("Expected breaker to open at an error rate of 0.5")
+	}
+}
+
+func TestCircuitBreakerLatency(t *testing.T) {
+	cb := &CircuitBreaker{
+		Window:       time.Minute,
+		MinRequests:  2,
+		Latency:      time.Second,
+		OpenDuration: time.Minute,
+	}
+	cb.Record(100*time.Millisecond, false)
+	cb.Record(500*time.Millisecond, false)
+	if cb.Open() {
+		t.Fatal("Expected breaker to stay closed for fast responses")
+	}
+	cb.Record(3*time.Second, false)
+	cb.Record(3*time.Second, false)
+	if !cb.Open() {
+		t.Fatal("Expected breaker to open for slow responses")
+	}
+}
+
+func TestCircuitBreakerCloses(t *testing.T) {
+	cb := &CircuitBreaker{
+		Window:       time.Minute,
+		MinRequests:  1,
+		ErrorRate:    1,
+		OpenDuration: 20 * time.Millisecond,
+	}
+	cb.Record(0, true)
+	if !cb.Open() {
+		t.Fatal("Expected breaker to open")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if cb.Open() {
+		t.Fatal("Expected breaker to close after open_duration")
+	}
+}
+
+func TestParseCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  *CircuitBreaker
+		fallback  *fallbackResponse
+	}{
+		{"circuit_breaker {\n error_rate 0.25 \n}", false,
+			&CircuitBreaker{Window: 10 * time.Second, MinRequests: 10, ErrorRate: 0.25, OpenDuration: 30 * time.Second}, nil},
+		{"circuit_breaker {\n window 1m \n min_requests 3 \n latency 2s \n open_duration 5s \n fallback 503 \"Try again later\" \n}", false,
+			&CircuitBreaker{Window: time.Minute, MinRequests: 3, Latency: 2 * time.Second, OpenDuration: 5 * time.Second}, &fallbackResponse{503, "Try again later"}},
+		{"circuit_breaker", true, nil, nil},
+		{"circuit_breaker {\n window 1m \n}", true, nil, nil},
+		{"circuit_breaker {\n error_rate 2 \n}", true, nil, nil},
+		{"circuit_breaker {\n error_rate 0.5 \n min_requests 0 \n}", true, nil, nil},
+		{"circuit_breaker {\n error_rate 0.5 \n fallback abc \n}", true, nil, nil},
+		{"circuit_breaker {\n error_rate 0.5 \n bogus 1 \n}", true, nil, nil},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		cb := u.CircuitBreaker
+		if cb.Window != test.expected.Window || cb.MinRequests != test.expected.MinRequests ||
+			cb.ErrorRate != test.expected.ErrorRate || cb.Latency != test.expected.Latency ||
+			cb.OpenDuration != test.expected.OpenDuration {
+			t.Errorf("Test %d: Expected breaker %+v, got %+v", i, test.expected, cb)
+		}
+		if test.fallback == nil {
+			if u.breakerFallback != nil {
+				t.Errorf("Test %d: Expected no fallback, got %+v", i, *u.breakerFallback)
+			}
+		} else if u.breakerFallback == nil || *u.breakerFallback != *test.fallback {
+			t.Errorf("Test %d: Expected fallback %+v, got %v", i, *test.fallback, u.breakerFallback)
+		}
+	}
+}
+
+func TestReverseProxyCircuitBreaker(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		circuit_breaker {
+			min_requests 2
+			error_rate 1
+			fallback 503 "{host} is unavailable"
+		}
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com/", nil)
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Request %d: Expected no error, got %v", i, err)
+		}
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("Request %d: Expected upstream status 500, got %d", i, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	status, err := p.ServeHTTP(w, r)
+	if status != 0 || err != nil {
+		t.Fatalf("Expected fallback to be written, got status %d and error %v", status, err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected fallback status 503, got %d", w.Code)
+	}
+	if got, want := w.Body.String(), "example.com is unavailable"; got != want {
+		t.Errorf("Expected fallback body %q, got %q", want, got)
+	}
+}
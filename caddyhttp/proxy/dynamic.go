@@ -0,0 +1,218 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dynamicSource is an external list of upstream hosts, kept
+// in a file or served at a URL, that is re-read periodically.
+type dynamicSource struct {
+	// Location is a file path or an http(s) URL.
+	Location string
+
+	// Interval is how often the source is checked for changes.
+	Interval time.Duration
+
+	client  http.Client
+	modTime time.Time
+	last    []byte
+}
+
+// dynamicHost is one entry of a dynamic upstream list.
+type dynamicHost struct {
+	Address string `json:"address"`
+	Weight  *int   `json:"weight"`
+}
+
+// isURL returns true if the source is fetched over HTTP.
+func (ds *dynamicSource) isURL() bool {
+	return strings.HasPrefix(ds.Location, "http://") || strings.HasPrefix(ds.Location, "https://")
+}
+
+// read returns the contents of the source, or nil if
+// they have not changed since the last read.
+func (ds *dynamicSource) read() ([]byte, error) {
+	var body []byte
+	if ds.isURL() {
+		resp, err := ds.client.Get(ds.Location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: unexpected status %d", ds.Location, resp.StatusCode)
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		info, err := os.Stat(ds.Location)
+		if err != nil {
+			return nil, err
+		}
+		if ds.last != nil && info.ModTime().Equal(ds.modTime) {
+			return nil, nil
+		}
+		body, err = ioutil.ReadFile(ds.Location)
+		if err != nil {
+			return nil, err
+		}
+		ds.modTime = info.ModTime()
+	}
+	if ds.last != nil && bytes.Equal(body, ds.last) {
+		return nil, nil
+	}
+	ds.last = body
+	return body, nil
+}
+
+// parseDynamicHosts parses an upstream list, which is either a
+// JSON array of addresses or of {"address", "weight"} objects,
+// or one "address [weight]" per line with # starting a comment.
+func parseDynamicHosts(body []byte) ([]dynamicHost, error) {
+	var hosts []dynamicHost
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			var host dynamicHost
+			if err := json.Unmarshal(entry, &host.Address); err != nil {
+				if err := json.Unmarshal(entry, &host); err != nil {
+					return nil, err
+				}
+			}
+			if host.Address == "" {
+				return nil, fmt.Errorf("upstream entry without an address: %s", entry)
+			}
+			hosts = append(hosts, host)
+		}
+		return hosts, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			hosts = append(hosts, dynamicHost{Address: fields[0]})
+		case 2:
+			weight, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight '%s'", lineNum, fields[1])
+			}
+			hosts = append(hosts, dynamicHost{Address: fields[0], Weight: &weight})
+		default:
+			return nil, fmt.Errorf("line %d: expected an address and optional weight", lineNum)
+		}
+	}
+	return hosts, scanner.Err()
+}
+
+// refreshHosts re-reads the dynamic source and, if it changed,
+// replaces the host pool.
+func (u *staticUpstream) refreshHosts() error {
+	body, err := u.dynamic.read()
+	if err != nil || body == nil {
+		return err
+	}
+	entries, err := parseDynamicHosts(body)
+	if err != nil {
+		return fmt.Errorf("%s: %v", u.dynamic.Location, err)
+	}
+
+	var pool HostPool
+	for _, entry := range entries {
+		if entry.Weight != nil && *entry.Weight < 0 {
+			return fmt.Errorf("%s: invalid weight %d for %s", u.dynamic.Location, *entry.Weight, entry.Address)
+		}
+		addrs, err := parseUpstream(entry.Address)
+		if err != nil {
+			return fmt.Errorf("%s: %v", u.dynamic.Location, err)
+		}
+		for _, addr := range addrs {
+			uh, err := u.NewHost(addr)
+			if err != nil {
+				return fmt.Errorf("%s: %v", u.dynamic.Location, err)
+			}
+			if entry.Weight != nil {
+				uh.Weight = *entry.Weight
+			}
+			pool = append(pool, uh)
+		}
+	}
+	if len(pool) == 0 {
+		return fmt.Errorf("%s: no upstream hosts", u.dynamic.Location)
+	}
+
+	u.replaceHosts(pool)
+	return nil
+}
+
+// replaceHosts makes pool the host pool. Hosts that were already
+// in the pool with the same weight are kept in place of their new
+// copies, along with their connection counts and health.
+func (u *staticUpstream) replaceHosts(pool HostPool) {
+	existing := make(map[string]*UpstreamHost)
+	for _, host := range u.hosts() {
+		existing[host.Name] = host
+	}
+	for i, uh := range pool {
+		if old, ok := existing[uh.Name]; ok && old.Weight == uh.Weight {
+			pool[i] = old
+		}
+	}
+
+	u.hostsMu.Lock()
+	u.Hosts = pool
+	u.hostsMu.Unlock()
+}
+
+// DynamicHostsWorker re-reads the dynamic upstream source
+// every interval until stop is closed.
+func (u *staticUpstream) DynamicHostsWorker(stop chan struct{}) {
+	ticker := time.NewTicker(u.dynamic.Interval)
+	for {
+		select {
+		case <-ticker.C:
+			if err := u.refreshHosts(); err != nil {
+				log.Printf("[ERROR] Reloading upstreams for %s: %v", u.from, err)
+			}
+		case <-stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestParseDynamicHosts(t *testing.T) {
+	weight := func(n int) *int { return &n }
+	tests := []struct {
+		body      string
+		shouldErr bool
+		expected  []dynamicHost
+	}{
+		{"localhost:8080\n# comment\n\nlocalhost:8081 5 # canary\n", false,
+			[]dynamicHost{{"localhost:8080", nil}, {"localhost:8081", weight(5)}}},
+		{`["localhost:8080", {"address": "localhost:8081", "weight": 0}]`, false,
+			[]dynamicHost{{"localhost:8080", nil}, {"localhost:8081", weight(0)}}},
+		{"localhost:8080 heavy", true, nil},
+		{"localhost:8080 1 2", true, nil},
+		{`[{"weight": 1}]`, true, nil},
+		{`["localhost:8080"`, true, nil},
+		{"", false, nil},
+	}
+
+	for i, test := range tests {
+		hosts, err := parseDynamicHosts([]byte(test.body))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(hosts) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d hosts, got %d", i, len(test.expected), len(hosts))
+			continue
+		}
+		for j, host := range hosts {
+			want := test.expected[j]
+			if host.Address != want.Address || (host.Weight == nil) != (want.Weight == nil) ||
+				(host.Weight != nil && *host.Weight != *want.Weight) {
+				t.Errorf("Test %d: Expected host %d to be %+v, got %+v", i, j, want, host)
+			}
+		}
+	}
+}
+
+func TestDynamicUpstreamsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_dynamic_upstreams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "upstreams")
+	if err := ioutil.WriteFile(file, []byte("localhost:8080\nlocalhost:8081\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := "proxy / {\n dynamic_upstreams " + file + " 1h \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	defer u.Stop()
+	if u.GetHostCount() != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", u.GetHostCount())
+	}
+	kept := u.hosts()[1]
+
+	// an unchanged file leaves the pool alone
+	if err := u.refreshHosts(); err != nil {
+		t.Fatal(err)
+	}
+	if u.hosts()[1] != kept {
+		t.Error("Expected the pool to be unchanged")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("localhost:8081\nlocalhost:8082 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u.dynamic.modTime = time.Time{}
+	if err := u.refreshHosts(); err != nil {
+		t.Fatal(err)
+	}
+	hosts := u.hosts()
+	if len(hosts) != 2 || hosts[0].Name != "http://localhost:8081" || hosts[1].Name != "http://localhost:8082" {
+		t.Fatalf("Unexpected hosts after refresh: %v", hosts)
+	}
+	if hosts[0] != kept {
+		t.Error("Expected the remaining host to be kept")
+	}
+	if hosts[1].Weight != 3 {
+		t.Errorf("Expected weight 3, got %d", hosts[1].Weight)
+	}
+
+	// a broken list keeps the previous pool
+	if err := ioutil.WriteFile(file, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u.dynamic.modTime = time.Time{}
+	if err := u.refreshHosts(); err == nil {
+		t.Error("Expected an error for an empty list")
+	}
+	if u.GetHostCount() != 2 {
+		t.Errorf("Expected the previous 2 hosts to be kept, got %d", u.GetHostCount())
+	}
+}
+
+func TestDynamicUpstreamsURL(t *testing.T) {
+	list := `["localhost:8080"]`
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list))
+	}))
+	defer source.Close()
+
+	config := "proxy / {\n dynamic_upstreams " + source.URL + " \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	defer u.Stop()
+	if u.GetHostCount() != 1 {
+		t.Fatalf("Expected 1 host, got %d", u.GetHostCount())
+	}
+
+	list = `["localhost:8080", "localhost:8081-8082"]`
+	if err := u.refreshHosts(); err != nil {
+		t.Fatal(err)
+	}
+	if u.GetHostCount() != 3 {
+		t.Errorf("Expected 3 hosts, got %d", u.GetHostCount())
+	}
+}
+
+func TestParseDynamicUpstreams(t *testing.T) {
+	for i, config := range []string{
+		"proxy / {\n dynamic_upstreams \n}",
+		"proxy / {\n dynamic_upstreams /nonexistent/upstreams \n}",
+		"proxy / {\n dynamic_upstreams /tmp/upstreams 0s \n}",
+		"proxy / {\n dynamic_upstreams /tmp/upstreams soon \n}",
+		"proxy / srv://example.com {\n dynamic_upstreams /tmp/upstreams \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), ""); err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
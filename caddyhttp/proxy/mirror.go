@@ -0,0 +1,170 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// Mirror sends copies of proxied requests to a shadow upstream,
+// whose responses are discarded, so that a new version of a
+// backend can be tried with production traffic.
+type Mirror struct {
+	// URL is the shadow upstream.
+	URL *url.URL
+
+	// Percent is the percentage of requests that are mirrored.
+	Percent float64
+
+	// MaxBody is the largest request body that is mirrored;
+	// requests with larger bodies are not mirrored at all.
+	MaxBody int64
+
+	client *http.Client
+	slots  chan struct{}
+}
+
+// Defaults for request mirroring.
+const (
+	defaultMirrorMaxBody  = 1 << 20
+	defaultMirrorTimeout  = 30 * time.Second
+	defaultMirrorInFlight = 100
+)
+
+func newMirror(u *url.URL, percent float64) *Mirror {
+	return &Mirror{
+		URL:     u,
+		Percent: percent,
+		MaxBody: defaultMirrorMaxBody,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   10 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				MaxIdleConnsPerHost: 32,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			Timeout: defaultMirrorTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		slots: make(chan struct{}, defaultMirrorInFlight),
+	}
+}
+
+// send mirrors outreq, if it is sampled, in the background. As the
+// body is read to be mirrored, outreq.Body is replaced by one that
+// yields the same bytes.
+func (m *Mirror) send(outreq *http.Request) {
+	if m.Percent < 100 && rand.Float64()*100 >= m.Percent {
+		return
+	}
+
+	// the shadow upstream must never slow down real traffic,
+	// so requests are dropped when too many are in flight,
+	// before their bodies are read
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return
+	}
+	if outreq.ContentLength > m.MaxBody {
+		<-m.slots
+		return
+	}
+
+	var body []byte
+	if outreq.Body != nil {
+		buf, err := ioutil.ReadAll(io.LimitReader(outreq.Body, m.MaxBody+1))
+		if int64(len(buf)) > m.MaxBody || err != nil {
+			// a truncated body would make a different request
+			outreq.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buf), outreq.Body), outreq.Body}
+			<-m.slots
+			return
+		}
+		outreq.Body.Close()
+		outreq.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		body = buf
+	}
+
+	target := *m.URL
+	target.Path = singleJoiningSlash(m.URL.Path, outreq.URL.Path)
+	target.RawQuery = outreq.URL.RawQuery
+	req, err := http.NewRequest(outreq.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		<-m.slots
+		return
+	}
+	copyHeader(req.Header, outreq.Header)
+	if body == nil {
+		req.Body = nil
+	}
+
+	go func() {
+		defer func() { <-m.slots }()
+		resp, err := m.client.Do(req.WithContext(context.Background()))
+		if err != nil {
+			log.Printf("[WARNING] Mirroring request to %s: %v", m.URL.Host, err)
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// parseMirror parses the arguments of the mirror subdirective,
+// which are the address of the shadow upstream and optionally
+// the percentage of requests to mirror.
+func parseMirror(c *caddyfile.Dispenser, u *staticUpstream) error {
+	args := c.RemainingArgs()
+	if len(args) == 0 || len(args) > 2 {
+		return c.ArgErr()
+	}
+	addr := args[0]
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	target, err := url.Parse(addr)
+	if err != nil || target.Host == "" {
+		return c.Errf("invalid mirror address '%s'", args[0])
+	}
+	percent := 100.0
+	if len(args) == 2 {
+		percent, err = strconv.ParseFloat(strings.TrimSuffix(args[1], "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return c.Errf("invalid mirror percentage '%s'", args[1])
+		}
+	}
+	u.Mirror = newMirror(target, percent)
+	return nil
+}
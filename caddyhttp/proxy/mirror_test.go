@@ -0,0 +1,171 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+type mirroredRequest struct {
+	method, uri, body, header string
+}
+
+func TestMirror(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer backend.Close()
+
+	mirrored := make(chan mirroredRequest, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mirrored <- mirroredRequest{r.Method, r.RequestURI, string(b), r.Header.Get("X-Test")}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("shadow"))
+	}))
+	defer shadow.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		mirror `+shadow.URL+`/v2
+		mirror_max_body 8
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	for i, test := range []struct {
+		body     string
+		expected *mirroredRequest
+	}{
+		{"hello", &mirroredRequest{"POST", "/v2/path?q=1", "hello", "yes"}},
+		{"", &mirroredRequest{"POST", "/v2/path?q=1", "", "yes"}},
+		{"larger than the limit", nil},
+	} {
+		r := httptest.NewRequest("POST", "/path?q=1", strings.NewReader(test.body))
+		r.Header.Set("X-Test", "yes")
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		// the real response is unaffected by the shadow
+		if w.Code != http.StatusOK || w.Body.String() != test.body {
+			t.Errorf("Test %d: Expected the backend response, got %d '%s'", i, w.Code, w.Body.String())
+		}
+
+		select {
+		case got := <-mirrored:
+			if test.expected == nil {
+				t.Errorf("Test %d: Expected request not to be mirrored, got %v", i, got)
+			} else if got != *test.expected {
+				t.Errorf("Test %d: Expected mirrored request %v, got %v", i, *test.expected, got)
+			}
+		case <-time.After(time.Second):
+			if test.expected != nil {
+				t.Errorf("Test %d: Expected request to be mirrored", i)
+			}
+		}
+	}
+}
+
+func TestMirrorSampling(t *testing.T) {
+	m := newMirror(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}, 0.000001)
+	// nothing is read from a request that is not sampled
+	r := httptest.NewRequest("POST", "/", strings.NewReader("body"))
+	body := r.Body
+	m.send(r)
+	if r.Body != body {
+		t.Error("Expected the body of an unsampled request to be left alone")
+	}
+}
+
+func TestMirrorSaturated(t *testing.T) {
+	m := newMirror(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}, 100)
+	for i := 0; i < cap(m.slots); i++ {
+		m.slots <- struct{}{}
+	}
+	// nothing is read from a request there is no slot for
+	r := httptest.NewRequest("POST", "/", strings.NewReader("body"))
+	body := r.Body
+	m.send(r)
+	if r.Body != body {
+		t.Error("Expected the body of a request that is dropped to be left alone")
+	}
+
+	// a slot is given back when the body is too large
+	for len(m.slots) > 0 {
+		<-m.slots
+	}
+	m.MaxBody = 2
+	m.send(httptest.NewRequest("POST", "/", strings.NewReader("body")))
+	if len(m.slots) != 0 {
+		t.Errorf("Expected the slot to be released, %d are taken", len(m.slots))
+	}
+}
+
+func TestParseBlockMirror(t *testing.T) {
+	for i, test := range []struct {
+		config    string
+		shouldErr bool
+		host      string
+		percent   float64
+		maxBody   int64
+	}{
+		{"proxy / localhost:8080 {\n mirror localhost:9090 \n}", false, "localhost:9090", 100, defaultMirrorMaxBody},
+		{"proxy / localhost:8080 {\n mirror https://shadow 12.5% \n mirror_max_body 64kb \n}", false, "shadow", 12.5, 64 << 10},
+		{"proxy / localhost:8080 {\n mirror \n}", true, "", 0, 0},
+		{"proxy / localhost:8080 {\n mirror localhost:9090 0 \n}", true, "", 0, 0},
+		{"proxy / localhost:8080 {\n mirror localhost:9090 101 \n}", true, "", 0, 0},
+		{"proxy / localhost:8080 {\n mirror_max_body 1kb \n}", true, "", 0, 0},
+		{"proxy / localhost:8080 {\n mirror localhost:9090 \n mirror_max_body lots \n}", true, "", 0, 0},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)), "")
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d: Expected an error, got none", i)
+			continue
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: Expected no error, got %v", i, err)
+			}
+			continue
+		}
+		m := upstreams[0].(*staticUpstream).Mirror
+		if m.URL.Host != test.host || m.Percent != test.percent || m.MaxBody != test.maxBody {
+			t.Errorf("Test %d: Expected mirror to %s at %v%% up to %d bytes, got %s at %v%% up to %d",
+				i, test.host, test.percent, test.maxBody, m.URL.Host, m.Percent, m.MaxBody)
+		}
+	}
+}
@@ -15,13 +15,19 @@
 package proxy
 
 import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"hash/fnv"
 	"log"
 	"math"
 	"math/rand"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 )
 
 // HostPool is a collection of UpstreamHosts.
@@ -40,6 +46,15 @@ func init() {
 	RegisterPolicy("first", func(arg string) Policy { return &First{} })
 	RegisterPolicy("uri_hash", func(arg string) Policy { return &URIHash{} })
 	RegisterPolicy("header", func(arg string) Policy { return &Header{arg} })
+	RegisterPolicy("cookie", func(arg string) Policy { return NewCookie(arg) })
+	RegisterPolicy("weighted_round_robin", func(arg string) Policy { return &WeightedRoundRobin{} })
+}
+
+// ResponsePolicy is a Policy that also needs to act on the
+// response once a host has been selected for a request.
+type ResponsePolicy interface {
+	Policy
+	Selected(host *UpstreamHost, w http.ResponseWriter, r *http.Request)
 }
 
 // Random is a policy that selects up hosts from a pool at random.
@@ -123,6 +138,40 @@ func (r *RoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost
 	return nil
 }
 
+// WeightedRoundRobin is a policy that selects hosts round-robin in
+// proportion to their weights, interleaving them smoothly.
+type WeightedRoundRobin struct {
+	mutex   sync.Mutex
+	current map[*UpstreamHost]int
+}
+
+// Select selects the available host that is furthest behind its
+// share of requests, as in nginx's smooth weighted round-robin.
+func (r *WeightedRoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.current == nil {
+		r.current = make(map[*UpstreamHost]int)
+	}
+
+	var best *UpstreamHost
+	total := 0
+	for _, host := range pool {
+		if host.Weight <= 0 || !host.Available() {
+			continue
+		}
+		r.current[host] += host.Weight
+		total += host.Weight
+		if best == nil || r.current[host] > r.current[best] {
+			best = host
+		}
+	}
+	if best != nil {
+		r.current[best] -= total
+	}
+	return best
+}
+
 // hostByHashing returns an available host from pool based on a hashable string
 func hostByHashing(pool HostPool, s string) *UpstreamHost {
 	poolLen := uint32(len(pool))
@@ -200,3 +249,112 @@ func (r *Header) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	}
 	return hostByHashing(pool, val)
 }
+
+// Cookie is a policy that pins a client to the host first selected
+// for it, by means of a signed cookie. Requests without a valid
+// cookie, or whose pinned host is unavailable, are balanced
+// round-robin and pinned to the newly selected host.
+type Cookie struct {
+	// Name is the name of the cookie.
+	Name string
+
+	// TTL is how long the cookie lasts. If zero, the
+	// cookie lasts until the browser session ends.
+	TTL time.Duration
+
+	// Secret is the key used to sign cookie values.
+	Secret []byte
+
+	robin RoundRobin
+}
+
+// NewCookie returns a cookie policy that uses the named cookie,
+// or "caddy_upstream" if name is empty. It signs cookies with a
+// random secret, so pins do not survive a restart unless the
+// Secret is set.
+func NewCookie(name string) *Cookie {
+	if name == "" {
+		name = "caddy_upstream"
+	}
+	secret := make([]byte, 32)
+	if _, err := crand.Read(secret); err != nil {
+		log.Println("[ERROR] failed to generate cookie secret: ", err)
+	}
+	return &Cookie{Name: name, Secret: secret}
+}
+
+// Select selects the host named by the request's cookie if it
+// is available, or else the next available host.
+func (r *Cookie) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	if cookie, err := request.Cookie(r.Name); err == nil {
+		if name, ok := r.verify(cookie.Value); ok {
+			for _, host := range pool {
+				if host.Name == name && host.Available() {
+					return host
+				}
+			}
+		}
+	}
+	return r.robin.Select(pool, request)
+}
+
+// Selected sets the cookie that pins the client to host,
+// unless the request already carries it.
+func (r *Cookie) Selected(host *UpstreamHost, w http.ResponseWriter, request *http.Request) {
+	value := r.sign(host.Name)
+	if cookie, err := request.Cookie(r.Name); err == nil && cookie.Value == value {
+		return
+	}
+
+	// a retry selects another host; only the last one counts
+	prefix := r.Name + "="
+	var kept []string
+	for _, c := range w.Header()["Set-Cookie"] {
+		if !strings.HasPrefix(c, prefix) {
+			kept = append(kept, c)
+		}
+	}
+	if kept == nil {
+		w.Header().Del("Set-Cookie")
+	} else {
+		w.Header()["Set-Cookie"] = kept
+	}
+
+	cookie := &http.Cookie{
+		Name:     r.Name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   request.TLS != nil,
+	}
+	if r.TTL > 0 {
+		cookie.MaxAge = int(r.TTL.Seconds())
+		cookie.Expires = time.Now().Add(r.TTL)
+	}
+	http.SetCookie(w, cookie)
+}
+
+// sign returns the cookie value for the host name.
+func (r *Cookie) sign(name string) string {
+	mac := hmac.New(sha256.New, r.Secret)
+	mac.Write([]byte(name))
+	return base64.RawURLEncoding.EncodeToString([]byte(name)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the host name in the cookie value, and
+// whether the value carries a valid signature.
+func (r *Cookie) verify(value string) (string, bool) {
+	dot := strings.IndexByte(value, '.')
+	if dot < 0 {
+		return "", false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(value[:dot])
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal([]byte(r.sign(string(name))), []byte(value)) {
+		return "", false
+	}
+	return string(name), true
+}
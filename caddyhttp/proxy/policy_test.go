@@ -15,10 +15,12 @@
 package proxy
 
 import (
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var workableServer *httptest.Server
@@ -359,3 +361,96 @@ func TestHeaderPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestCookiePolicy(t *testing.T) {
+	pool := testPool()
+	cookiePolicy := NewCookie("")
+	cookiePolicy.TTL = time.Hour
+
+	// without a cookie, hosts are selected round-robin and pinned
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	h := cookiePolicy.Select(pool, req)
+	if h != pool[1] {
+		t.Fatal("Expected cookie policy host to be the second host.")
+	}
+	w := httptest.NewRecorder()
+	cookiePolicy.Selected(h, w, req)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "caddy_upstream" || cookies[0].MaxAge != 3600 {
+		t.Fatalf("Expected one caddy_upstream cookie with a max age of 3600, got %v", cookies)
+	}
+
+	// the cookie keeps selecting the same host
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	for i := 0; i < 3; i++ {
+		if h := cookiePolicy.Select(pool, req); h != pool[1] {
+			t.Fatalf("Expected pinned host to be the second host, got %s", h.Name)
+		}
+	}
+	w = httptest.NewRecorder()
+	cookiePolicy.Selected(pool[1], w, req)
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected no new cookie when the client is already pinned")
+	}
+
+	// when the pinned host is down, another one is pinned
+	pool[1].Unhealthy = 1
+	h = cookiePolicy.Select(pool, req)
+	if h == pool[1] || h == nil {
+		t.Fatal("Expected a different host when the pinned host is down")
+	}
+	w = httptest.NewRecorder()
+	cookiePolicy.Selected(pool[0], w, req)
+	cookiePolicy.Selected(h, w, req)
+	if n := len(w.Header()["Set-Cookie"]); n != 1 {
+		t.Errorf("Expected only the last selection to set a cookie, got %d", n)
+	}
+	pool[1].Unhealthy = 0
+
+	// tampered cookies are ignored
+	name := base64.RawURLEncoding.EncodeToString([]byte(pool[2].Name))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "caddy_upstream", Value: name + ".forged"})
+	if h := cookiePolicy.Select(pool, req); h == pool[2] {
+		t.Error("Expected a forged cookie to be ignored")
+	}
+}
+
+func TestWeightedRoundRobinPolicy(t *testing.T) {
+	pool := testPool()
+	pool[0].Weight = 5
+	pool[1].Weight = 1
+	pool[2].Weight = 0
+	wrrPolicy := &WeightedRoundRobin{}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	counts := make(map[*UpstreamHost]int)
+	for i := 0; i < 60; i++ {
+		counts[wrrPolicy.Select(pool, request)]++
+	}
+	if counts[pool[0]] != 50 || counts[pool[1]] != 10 || counts[pool[2]] != 0 {
+		t.Errorf("Expected 50/10/0 selections, got %d/%d/%d", counts[pool[0]], counts[pool[1]], counts[pool[2]])
+	}
+
+	// the heavier host must not be picked more than
+	// its share times in a row
+	pool[0].Weight = 1
+	pool[1].Weight = 1
+	wrrPolicy = &WeightedRoundRobin{}
+	first := wrrPolicy.Select(pool, request)
+	if second := wrrPolicy.Select(pool, request); second == first {
+		t.Error("Expected equally weighted hosts to alternate")
+	}
+
+	pool[0].Unhealthy = 1
+	for i := 0; i < 3; i++ {
+		if h := wrrPolicy.Select(pool, request); h != pool[1] {
+			t.Error("Expected the only available weighted host to be selected")
+		}
+	}
+	pool[1].Unhealthy = 1
+	if h := wrrPolicy.Select(pool, request); h != nil {
+		t.Error("Expected no host when no weighted host is available")
+	}
+}
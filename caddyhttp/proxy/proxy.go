@@ -18,6 +18,7 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
@@ -26,6 +27,7 @@ import (
 	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddylog"
 )
 
 // Proxy represents a middleware instance that can proxy requests.
@@ -82,6 +84,7 @@ type UpstreamHost struct {
 	Conns             int64 // must be first field to be 64-bit aligned on 32-bit systems
 	MaxConns          int64
 	Name              string // hostname of this upstream host
+	Weight            int    // share of traffic under the weighted_round_robin policy
 	UpstreamHeaders   http.Header
 	DownstreamHeaders http.Header
 	FailTimeout       time.Duration
@@ -96,6 +99,8 @@ type UpstreamHost struct {
 	HealthCheckResult            atomic.Value
 	UpstreamHeaderReplacements   headerReplacements
 	DownstreamHeaderReplacements headerReplacements
+	RetryIdempotentOnly          bool
+	CircuitBreaker               *CircuitBreaker
 }
 
 // Down checks whether the upstream host is down or not.
@@ -134,6 +139,12 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	outreq, cancel := createUpstreamRequest(w, r)
 	defer cancel()
 
+	// a copy of the request may go to a shadow upstream; this
+	// happens first, while the body has not been read yet
+	if mu, ok := upstream.(mirroringUpstream); ok && mu.mirror() != nil {
+		mu.mirror().send(outreq)
+	}
+
 	// If we have more than one upstream host defined and if retrying is enabled
 	// by setting try_duration to a non-zero value, caddy will try to
 	// retry the request at a different host if the first one failed.
@@ -146,7 +157,44 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// HTTP streaming applications like gRPC for instance.
 	requiresBuffering := upstream.GetHostCount() > 1 && upstream.GetTryDuration() != 0
 
-	if requiresBuffering {
+	// The upstream may also ask for request bodies to be read
+	// in full before connecting, to shield it from slow clients.
+	var memBuffer, diskBuffer int64
+	var spoolDir string
+	if rb, ok := upstream.(requestBufferer); ok {
+		memBuffer, diskBuffer, spoolDir = rb.requestBuffering()
+	}
+
+	if memBuffer > 0 && diskBuffer > 0 {
+		body, size, err := newSpooledBody(outreq.Body, memBuffer, diskBuffer, spoolDir)
+		if err == errBodyTooLarge {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		if err != nil {
+			return http.StatusBadRequest, errors.New("failed to read downstream request body: " + err.Error())
+		}
+		if body != nil {
+			if sb, ok := body.(*spooledBody); ok {
+				defer sb.remove()
+			}
+			outreq.Body = body
+			outreq.ContentLength = size
+			outreq.TransferEncoding = nil
+		}
+	} else if memBuffer > 0 {
+		body, err := newLimitedBufferedBody(outreq.Body, memBuffer)
+		if err == errBodyTooLarge {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		if err != nil {
+			return http.StatusBadRequest, errors.New("failed to read downstream request body")
+		}
+		if body != nil {
+			outreq.Body = body
+			outreq.ContentLength = int64(body.Len())
+			outreq.TransferEncoding = nil
+		}
+	} else if requiresBuffering {
 		body, err := newBufferedBody(outreq.Body)
 		if err != nil {
 			return http.StatusBadRequest, errors.New("failed to read downstream request body")
@@ -184,6 +232,9 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 				backendErr = errors.New("no hosts available upstream")
 			}
 			if !keepRetrying(backendErr) {
+				if fu, ok := upstream.(fallbackUpstream); ok && fu.fallback() != nil {
+					return serveFallback(w, fu.fallback(), replacer)
+				}
 				break
 			}
 			continue
@@ -191,6 +242,9 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		if rr, ok := w.(*httpserver.ResponseRecorder); ok && rr.Replacer != nil {
 			rr.Replacer.Set("upstream", host.Name)
 		}
+		if sn, ok := upstream.(selectionNotifier); ok {
+			sn.selected(host, w, r)
+		}
 
 		proxy := host.ReverseProxy
 
@@ -235,9 +289,26 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			downHeaderUpdateFn = createRespHeaderUpdateFn(host.DownstreamHeaders, replacer, host.DownstreamHeaderReplacements)
 		}
 
+		// when a circuit breaker watches this host, note
+		// how long it took to get the response headers
+		// and whether the response was a server error
+		attemptStart := time.Now()
+		var latency time.Duration
+		var serverError bool
+		if host.CircuitBreaker != nil {
+			updateFn := downHeaderUpdateFn
+			downHeaderUpdateFn = func(resp *http.Response) {
+				latency = time.Since(attemptStart)
+				serverError = resp.StatusCode >= 500
+				if updateFn != nil {
+					updateFn(resp)
+				}
+			}
+		}
+
 		// Before we retry the request we have to make sure
 		// that the body is rewound to it's beginning.
-		if bb, ok := outreq.Body.(*bufferedBody); ok {
+		if bb, ok := outreq.Body.(rewindableBody); ok {
 			if err := bb.rewind(); err != nil {
 				return http.StatusInternalServerError, errors.New("unable to rewind downstream request body")
 			}
@@ -255,12 +326,19 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			backendErr = proxy.ServeHTTP(w, outreq, downHeaderUpdateFn)
 		}()
 
+		if host.CircuitBreaker != nil && backendErr != context.Canceled && backendErr != httpserver.ErrMaxBytesExceeded && backendErr != errBodyTooLarge {
+			if latency == 0 {
+				latency = time.Since(attemptStart)
+			}
+			host.CircuitBreaker.Record(latency, backendErr != nil || serverError)
+		}
+
 		// if no errors, we're done here
 		if backendErr == nil {
 			return 0, nil
 		}
 
-		if backendErr == httpserver.ErrMaxBytesExceeded {
+		if backendErr == httpserver.ErrMaxBytesExceeded || backendErr == errBodyTooLarge {
 			return http.StatusRequestEntityTooLarge, backendErr
 		}
 
@@ -268,6 +346,17 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			return CustomStatusContextCancelled, backendErr
 		}
 
+		// the time the request may wait is used up,
+		// so don't start over with another upstream
+		if backendErr == errUpstreamTimeout {
+			return http.StatusGatewayTimeout, backendErr
+		}
+
+		if caddylog.Enabled(caddylog.DebugLevel) {
+			caddylog.Debug("Upstream request failed", "upstream", host.Name,
+				"method", outreq.Method, "uri", outreq.URL.RequestURI(), "error", backendErr)
+		}
+
 		// failover; remember this failure for some time if
 		// request failure counting is enabled
 		timeout := host.FailTimeout
@@ -279,15 +368,78 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			}(host, timeout)
 		}
 
+		// requests that are not safe to replay are only
+		// retried if they never reached the upstream host
+		if host.RetryIdempotentOnly && !isIdempotent(outreq.Method) && !isDialError(backendErr) {
+			break
+		}
+
 		// if we've tried long enough, break
 		if !keepRetrying(backendErr) {
 			break
 		}
 	}
 
+	if code, ok := backendErr.(upstreamStatusError); ok {
+		return int(code), backendErr
+	}
 	return http.StatusBadGateway, backendErr
 }
 
+// serveFallback writes the fallback response fb to w.
+func serveFallback(w http.ResponseWriter, fb *fallbackResponse, repl httpserver.Replacer) (int, error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(fb.status)
+	if fb.body != "" {
+		if _, err := w.Write([]byte(repl.Replace(fb.body))); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// mirroringUpstream is implemented by upstreams that may
+// mirror requests to a shadow upstream.
+type mirroringUpstream interface {
+	mirror() *Mirror
+}
+
+// selectionNotifier is implemented by upstreams that need
+// to know which host was selected for a request.
+type selectionNotifier interface {
+	selected(host *UpstreamHost, w http.ResponseWriter, r *http.Request)
+}
+
+// upstreamStatusError is returned when an upstream host
+// responds with a status code that is configured to be
+// retried.
+type upstreamStatusError int
+
+func (e upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream responded with status %d", int(e))
+}
+
+// isIdempotent returns true if a request with the given
+// method can safely be sent more than once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isDialError returns true if err was caused by failing to
+// connect to the upstream, in which case the request was
+// never sent.
+func isDialError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		return opErr.Op == "dial"
+	}
+	return false
+}
+
 // match finds the best match for a proxy config based on r.
 func (p Proxy) match(r *http.Request) Upstream {
 	var u Upstream
@@ -365,6 +517,15 @@ func createUpstreamRequest(rw http.ResponseWriter, r *http.Request) (*http.Reque
 		}
 	}
 
+	// "TE: trailers" is the one hop-by-hop value that must reach
+	// the backend, because gRPC servers refuse requests without it.
+	for _, te := range r.Header["Te"] {
+		if strings.Contains(strings.ToLower(te), "trailers") {
+			outreq.Header.Set("Te", "trailers")
+			break
+		}
+	}
+
 	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 		// If we aren't the first proxy, retain prior
 		// X-Forwarded-For information as a comma+space
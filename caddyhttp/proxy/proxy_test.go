@@ -43,6 +43,8 @@ import (
 	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/net/websocket"
 )
 
@@ -328,6 +330,154 @@ func TestReverseProxyTimeout(t *testing.T) {
 	}
 }
 
+func TestReverseProxyUpstreamTimeout(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: []Upstream{newFakeUpstream(backend.URL, false, 30*time.Second, 300*time.Millisecond)},
+	}
+
+	for i, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/slow", http.StatusGatewayTimeout},
+		{"/fast", 0},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.UpstreamTimeoutCtxKey, 50*time.Millisecond))
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		status, _ := p.ServeHTTP(w, r)
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		if took := time.Since(start); took > 150*time.Millisecond {
+			t.Errorf("Test %d: Expected the upstream timeout to cut the wait short, took %v", i, took)
+		}
+	}
+}
+
+func TestReverseProxyH2C(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Expected backend request over HTTP/2, got %s", r.Proto)
+		}
+		if te := r.Header.Get("Te"); te != "trailers" {
+			t.Errorf("Expected TE: trailers to reach the backend, got %q", te)
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("message")); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{newFakeUpstream("h2c://"+backend.Listener.Addr().String(), false, 30*time.Second, 300*time.Millisecond)},
+	}
+
+	r := httptest.NewRequest("POST", "/pkg.Service/Method", strings.NewReader("request"))
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Te", "trailers")
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, r); err != nil {
+		t.Fatalf("Failed to serve HTTP: %v", err)
+	}
+
+	res := w.Result()
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "message" {
+		t.Errorf("Expected response body %q, got %q", "message", body)
+	}
+	if !w.Flushed {
+		t.Error("Expected gRPC response to be flushed")
+	}
+	if status := res.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("Expected Grpc-Status trailer to be proxied, got %q", status)
+	}
+}
+
+func TestReverseProxyH2CTransport(t *testing.T) {
+	target, _ := url.Parse("h2c://localhost:50051")
+	rp := NewSingleHostReverseProxy(target, "", http.DefaultMaxIdleConnsPerHost, 5*time.Second, 0)
+	transport, ok := rp.Transport.(*http2.Transport)
+	if !ok {
+		t.Fatalf("Expected an HTTP/2 transport, got %T", rp.Transport)
+	}
+	if transport.PingTimeout != 5*time.Second {
+		t.Errorf("Expected ping timeout of 5s, got %v", transport.PingTimeout)
+	}
+	if transport.ReadIdleTimeout != defaultDialer.KeepAlive {
+		t.Errorf("Expected read idle timeout of %v, got %v", defaultDialer.KeepAlive, transport.ReadIdleTimeout)
+	}
+
+	rp.UseConnectionPool(0, 0, 10*time.Second)
+	if transport.ReadIdleTimeout != 10*time.Second {
+		t.Errorf("Expected read idle timeout of 10s, got %v", transport.ReadIdleTimeout)
+	}
+	rp.UseConnectionPool(0, 0, -1)
+	if transport.ReadIdleTimeout != 0 {
+		t.Errorf("Expected no read idle timeout, got %v", transport.ReadIdleTimeout)
+	}
+}
+
+func TestReverseProxyFlushInterval(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for i, test := range []struct {
+		contentType     string
+		flushInterval   time.Duration
+		expectedFlushed bool
+	}{
+		{"text/plain", 0, false},
+		{"text/plain", -1, true},
+		{"text/event-stream", 0, true},
+		{"text/event-stream; charset=utf-8", time.Hour, true},
+	} {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write([]byte("data: hello\n\n"))
+		}))
+
+		upstream := newFakeUpstream(backend.URL, false, 30*time.Second, 300*time.Millisecond)
+		upstream.host.ReverseProxy.FlushInterval = test.flushInterval
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: []Upstream{upstream},
+		}
+
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatalf("Test %d: Failed to serve HTTP: %v", i, err)
+		}
+		if body := w.Body.String(); body != "data: hello\n\n" {
+			t.Errorf("Test %d: Expected body to be proxied, got %q", i, body)
+		}
+		if w.Flushed != test.expectedFlushed {
+			t.Errorf("Test %d: Expected flushed to be %v, got %v", i, test.expectedFlushed, w.Flushed)
+		}
+		backend.Close()
+	}
+}
+
 func TestWebSocketReverseProxyNonHijackerPanic(t *testing.T) {
 	// Capture the expected panic
 	defer func() {
@@ -497,6 +647,58 @@ func TestWebSocketReverseProxyFromWSClient(t *testing.T) {
 	}
 }
 
+func TestWebSocketReverseProxyIdleTimeout(t *testing.T) {
+	wsEcho := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		if _, err := io.Copy(ws, ws); err != nil {
+			log.Println("[ERROR] failed to copy: ", err)
+		}
+	}))
+	defer wsEcho.Close()
+
+	p := &Proxy{
+		Next: httpserver.EmptyNext,
+		Upstreams: []Upstream{&fakeWsUpstream{
+			name:        wsEcho.URL,
+			timeout:     30 * time.Second,
+			idleTimeout: 100 * time.Millisecond,
+		}},
+	}
+	echoProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			log.Println("[ERROR] failed to serve HTTP: ", err)
+		}
+	}))
+	defer echoProxy.Close()
+
+	u := strings.Replace(echoProxy.URL, "http://", "ws://", 1)
+	ws, err := websocket.Dial(u, "", echoProxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// traffic keeps the connection open past the timeout
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err := websocket.Message.Send(ws, "ping"); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive %d: %v", i, err)
+		}
+	}
+
+	// and going quiet gets it closed
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err == nil {
+		t.Error("Expected idle connection to be closed, but received a message")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Error("Expected idle connection to be closed by the proxy, but it stayed open")
+	}
+}
+
 func TestWebSocketReverseProxyFromWSSClient(t *testing.T) {
 	wsEcho := newTLSServer(websocket.Handler(func(ws *websocket.Conn) {
 		if _, err := io.Copy(ws, ws); err != nil {
@@ -1356,6 +1558,260 @@ func TestReverseProxyRetry(t *testing.T) {
 	}
 }
 
+func TestReverseProxyRetryStatus(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	for i, test := range []struct {
+		config         string
+		method         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		// a 503 is retried on the next host
+		{"retry_status 503", "GET", http.StatusOK, "ok"},
+		// without retry_status the 503 is passed through
+		{"", "GET", http.StatusServiceUnavailable, ""},
+		// non-idempotent requests that reached the upstream are not retried
+		{"retry_status 503\nretry_idempotent_only", "POST", http.StatusServiceUnavailable, ""},
+		// idempotent requests still are
+		{"retry_status 503\nretry_idempotent_only", "PUT", http.StatusOK, "ok"},
+	} {
+		su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+		proxy / `+unavailable.URL+` `+backend.URL+` {
+			policy first
+			try_duration 1s
+			try_interval 0
+			fail_timeout 5s
+			`+test.config+`
+		}
+		`)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext,
+			Upstreams: su,
+		}
+
+		r := httptest.NewRequest(test.method, "/", nil)
+		w := httptest.NewRecorder()
+		status, _ := p.ServeHTTP(w, r)
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if got := w.Body.String(); got != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, got)
+		}
+	}
+}
+
+func TestReverseProxyRetryIdempotentOnlyDialError(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / localhost:65535 `+backend.URL+` {
+		policy first
+		try_duration 1s
+		try_interval 0
+		fail_timeout 5s
+		retry_idempotent_only
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	// the first host refuses the connection, so even a
+	// POST is safe to send to the next one
+	r := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, r); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := w.Body.String(); got != "ok" {
+		t.Errorf("Expected body %q, got %q", "ok", got)
+	}
+}
+
+func TestReverseProxyBufferRequests(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var contentLength int64
+	var transferEncoding []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		transferEncoding = r.TransferEncoding
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		buffer_requests 10b
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	// a chunked body is sent upstream with a length
+	r := httptest.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader("0123456789")))
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != "0123456789" {
+		t.Errorf("Expected body to be proxied, got %q", w.Body.String())
+	}
+	if contentLength != 10 || len(transferEncoding) != 0 {
+		t.Errorf("Expected a Content-Length of 10 and no Transfer-Encoding, got %d and %v", contentLength, transferEncoding)
+	}
+
+	// too large a body is rejected
+	r = httptest.NewRequest("POST", "/", strings.NewReader("0123456789a"))
+	status, err := p.ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusRequestEntityTooLarge || err == nil {
+		t.Errorf("Expected status 413 and an error, got %d and %v", status, err)
+	}
+}
+
+func TestReverseProxySpoolRequests(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "caddy_spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var contentLength int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		buffer_requests 4
+		spool_requests 1kb `+dir+`
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	payload := strings.Repeat("x", 1000)
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(payload))); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != payload || contentLength != 1000 {
+		t.Errorf("Expected the spooled body with a Content-Length of 1000, got %d bytes and %d", w.Body.Len(), contentLength)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected spool files to be cleaned up, found %d", len(files))
+	}
+
+	status, _ := p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(payload+strings.Repeat("x", 25))))
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a body over the spool limit, got %d", status)
+	}
+
+	for i, config := range []string{
+		"proxy / localhost:8080 {\n spool_requests 1gb \n}",
+		"proxy / localhost:8080 {\n buffer_requests 1mb \n spool_requests \n}",
+		"proxy / localhost:8080 {\n buffer_requests 1mb \n spool_requests huge \n}",
+		"proxy / localhost:8080 {\n buffer_requests 1mb \n spool_requests 1gb /nonexistent/dir \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), ""); err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
+
+func TestReverseProxyBufferResponses(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		buffer_responses 4
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	// bodies that fit and that overflow the buffer are both passed on whole
+	for _, body := range []string{"abc", "abcdefghij"} {
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/?body="+body, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if w.Body.String() != body {
+			t.Errorf("Expected body %q, got %q", body, w.Body.String())
+		}
+	}
+
+	for i, config := range []string{"buffer_requests", "buffer_requests 0", "buffer_responses lots"} {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
+
 func TestReverseProxyLargeBody(t *testing.T) {
 	log.SetOutput(ioutil.Discard)
 	defer log.SetOutput(os.Stderr)
@@ -1569,10 +2025,11 @@ func newPrefixedWebSocketTestProxy(backendAddr string, prefix string) *Proxy {
 }
 
 type fakeWsUpstream struct {
-	name     string
-	without  string
-	insecure bool
-	timeout  time.Duration
+	name        string
+	without     string
+	insecure    bool
+	timeout     time.Duration
+	idleTimeout time.Duration
 }
 
 func (u *fakeWsUpstream) From() string {
@@ -1591,6 +2048,7 @@ func (u *fakeWsUpstream) Select(r *http.Request) *UpstreamHost {
 	if u.insecure {
 		host.ReverseProxy.UseInsecureTransport()
 	}
+	host.ReverseProxy.WebSocketIdleTimeout = u.idleTimeout
 	return host
 }
 
@@ -0,0 +1,135 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// proxyProtocolSignature starts every PROXY protocol v2 header.
+var proxyProtocolSignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolHeader returns the PROXY protocol header of the
+// given version that tells the upstream about the client of r.
+// If the addresses are not known, the header says so, and the
+// upstream uses those of the connection.
+func proxyProtocolHeader(version int, r *http.Request) []byte {
+	src := tcpAddr(r.RemoteAddr)
+	var dst *net.TCPAddr
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		dst = tcpAddr(addr.String())
+	}
+
+	if src != nil && dst != nil {
+		// both addresses must be of the same family
+		if src.IP.To4() == nil || dst.IP.To4() == nil {
+			src.IP, dst.IP = src.IP.To16(), dst.IP.To16()
+		} else {
+			src.IP, dst.IP = src.IP.To4(), dst.IP.To4()
+		}
+	}
+
+	if version == 1 {
+		if src == nil || dst == nil {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		if len(src.IP) == net.IPv4len {
+			return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", src.IP, dst.IP, src.Port, dst.Port))
+		}
+		return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", ipv6String(src.IP), ipv6String(dst.IP), src.Port, dst.Port))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(proxyProtocolSignature)
+	if src == nil || dst == nil {
+		// LOCAL command, no addresses
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+	family := byte(0x11) // TCP over IPv4
+	if len(src.IP) == net.IPv6len {
+		family = 0x21 // TCP over IPv6
+	}
+	buf.Write([]byte{0x21, family})
+	binary.Write(&buf, binary.BigEndian, uint16(2*len(src.IP)+4))
+	buf.Write(src.IP)
+	buf.Write(dst.IP)
+	binary.Write(&buf, binary.BigEndian, uint16(src.Port))
+	binary.Write(&buf, binary.BigEndian, uint16(dst.Port))
+	return buf.Bytes()
+}
+
+// ipv6String formats ip as an IPv6 address, even if it is
+// an IPv4-mapped one, which net.IP prints as IPv4.
+func ipv6String(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return "::ffff:" + v4.String()
+	}
+	return ip.String()
+}
+
+// tcpAddr parses addr, which is an IP and port, or
+// returns nil if it is not one.
+func tcpAddr(addr string) *net.TCPAddr {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	p, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: ip, Port: p}
+}
+
+// newProxyProtocolTransport returns a transport like base that
+// sends header on every new connection before anything else.
+// Since the header is about one client, connections are not
+// reused, so a new transport is made for each request. Only
+// *http.Transport is supported; others are returned as is.
+func newProxyProtocolTransport(base http.RoundTripper, header []byte) http.RoundTripper {
+	b, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t := &http.Transport{
+		Proxy:                 b.Proxy,
+		TLSClientConfig:       b.TLSClientConfig,
+		TLSHandshakeTimeout:   b.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: b.ResponseHeaderTimeout,
+		ExpectContinueTimeout: b.ExpectContinueTimeout,
+		DisableCompression:    b.DisableCompression,
+		DisableKeepAlives:     true,
+	}
+	dial := getTransportDial(b)
+	t.Dial = func(network, addr string) (net.Conn, error) {
+		c, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Write(header); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	return t
+}
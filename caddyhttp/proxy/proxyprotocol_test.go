@@ -0,0 +1,145 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	request := func(remoteAddr, localAddr string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		if localAddr != "" {
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tcpAddr(localAddr)))
+		}
+		return r
+	}
+
+	for i, test := range []struct {
+		version           int
+		remoteAddr, local string
+		expected          []byte
+	}{
+		{1, "192.0.2.1:5000", "10.0.0.1:443", []byte("PROXY TCP4 192.0.2.1 10.0.0.1 5000 443\r\n")},
+		{1, "[2001:db8::1]:5000", "[2001:db8::2]:443", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 5000 443\r\n")},
+		{1, "192.0.2.1:5000", "[2001:db8::2]:443", []byte("PROXY TCP6 ::ffff:192.0.2.1 2001:db8::2 5000 443\r\n")},
+		{1, "192.0.2.1:5000", "", []byte("PROXY UNKNOWN\r\n")},
+		{1, "@", "10.0.0.1:443", []byte("PROXY UNKNOWN\r\n")},
+		{2, "192.0.2.1:5000", "10.0.0.1:443", append(append([]byte{}, proxyProtocolSignature...),
+			0x21, 0x11, 0, 12, 192, 0, 2, 1, 10, 0, 0, 1, 0x13, 0x88, 0x01, 0xbb)},
+		{2, "192.0.2.1:5000", "", append(append([]byte{}, proxyProtocolSignature...), 0x20, 0, 0, 0)},
+	} {
+		got := proxyProtocolHeader(test.version, request(test.remoteAddr, test.local))
+		if !bytes.Equal(got, test.expected) {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+
+	got := proxyProtocolHeader(2, request("[2001:db8::1]:5000", "[2001:db8::2]:443"))
+	if len(got) != 16+36 || got[13] != 0x21 || got[15] != 36 {
+		t.Errorf("Expected an IPv6 v2 header of 52 bytes, got %q", got)
+	}
+}
+
+// proxyProtocolListener reads the PROXY protocol v1 line of
+// each accepted connection and sends it on lines.
+type proxyProtocolListener struct {
+	net.Listener
+	lines chan string
+}
+
+func (l proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(c)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	l.lines <- line
+	return bufferedConn{c, br}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func TestReverseProxyProxyProtocol(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	lines := make(chan string, 10)
+	backend.Listener = proxyProtocolListener{backend.Listener, lines}
+	backend.Start()
+	defer backend.Close()
+
+	su, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`
+	proxy / `+backend.URL+` {
+		proxy_protocol v1
+	}
+	`)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: su,
+	}
+
+	// every request gets its own connection, since the
+	// header is about the client of that request
+	for _, remoteAddr := range []string{"192.0.2.1:5000", "192.0.2.2:6000"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tcpAddr("10.0.0.1:80")))
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if w.Body.String() != "ok" {
+			t.Errorf("Expected response 'ok', got '%s'", w.Body.String())
+		}
+		host, port, _ := net.SplitHostPort(remoteAddr)
+		if line, want := <-lines, "PROXY TCP4 "+host+" 10.0.0.1 "+port+" 80\r\n"; line != want {
+			t.Errorf("Expected header %q, got %q", want, line)
+		}
+	}
+
+	for i, config := range []string{
+		"proxy / localhost:8080 {\n proxy_protocol \n}",
+		"proxy / localhost:8080 {\n proxy_protocol v3 \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), ""); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
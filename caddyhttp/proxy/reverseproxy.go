@@ -26,17 +26,22 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -53,28 +58,41 @@ var (
 		DualStack: true,
 	}
 
+	// bufferPool holds the buffers that the responses to
+	// upgrade requests are recorded in to be replayed
 	bufferPool = sync.Pool{New: createBuffer}
 
+	// responseBufPool holds the buffers response bodies
+	// are copied to the client with
+	responseBufPool = httpserver.NewBufferPool(32 * 1024)
+
+	// tunnelBufPool holds the buffers the data of upgraded
+	// connections, such as websockets, is copied with; each
+	// connection holds two of them for as long as it is open,
+	// and messages are usually small, so they are smaller
+	tunnelBufPool = httpserver.NewBufferPool(8 * 1024)
+
 	defaultCryptoHandshakeTimeout = 10 * time.Second
+
+	// errUpstreamTimeout is returned when the upstream did not
+	// respond within the upstream timeout of the request
+	errUpstreamTimeout = errors.New("timeout awaiting upstream response")
 )
 
 func createBuffer() interface{} {
 	return make([]byte, 0, 32*1024)
 }
 
-func pooledIoCopy(dst io.Writer, src io.Reader) {
-	buf := bufferPool.Get().([]byte)
-	defer bufferPool.Put(buf)
-
-	// CopyBuffer only uses buf up to its length and panics if it's 0.
-	// Due to that we extend buf's length to its capacity here and
-	// ensure it's always non-zero.
-	bufCap := cap(buf)
-	if _, err := io.CopyBuffer(dst, src, buf[0:bufCap:bufCap]); err != nil {
+func pooledIoCopy(dst io.Writer, src io.Reader, pool *httpserver.BufferPool) {
+	if _, err := pool.Copy(dst, src); err != nil {
 		log.Println("[ERROR] failed to copy buffer: ", err)
 	}
 }
 
+// defaultFlushInterval is how often proxied response bodies are
+// flushed to the client by default; flushing is good for streaming.
+const defaultFlushInterval = 250 * time.Millisecond
+
 // onExitFlushLoop is a callback set by tests to detect the state of the
 // flushLoop() goroutine.
 var onExitFlushLoop func()
@@ -96,8 +114,34 @@ type ReverseProxy struct {
 	// to flush to the client while copying the
 	// response body.
 	// If zero, no periodic flushing is done.
+	// A negative value means to flush immediately
+	// after each write to the client.
 	FlushInterval time.Duration
 
+	// WebSocketIdleTimeout is how long a proxied websocket
+	// connection may go without traffic in either direction
+	// before it is closed. If zero, it is never closed for
+	// being idle.
+	WebSocketIdleTimeout time.Duration
+
+	// RetryStatuses lists upstream response status codes
+	// that are treated as a failed attempt, so that the
+	// request can be retried on another upstream host.
+	// Responses with these codes are discarded.
+	RetryStatuses []int
+
+	// BufferResponses is how many bytes of a response body are
+	// read from the upstream before anything is written to the
+	// client, so that the upstream is freed early from slow
+	// clients. Larger bodies are streamed after that. If zero,
+	// responses are streamed.
+	BufferResponses int64
+
+	// ProxyProtocol is the version of the PROXY protocol,
+	// 1 or 2, spoken to the upstream so that it learns the
+	// address of the client. If zero, it is not used.
+	ProxyProtocol int
+
 	// dialer is used when values from the
 	// defaultDialer need to be overridden per Proxy
 	dialer *net.Dialer
@@ -130,7 +174,19 @@ func (rp *ReverseProxy) srvDialerFunc(locator string, timeout time.Duration) fun
 		if err != nil {
 			return nil, err
 		}
-		return net.DialTimeout("tcp", fmt.Sprintf("%s:%d", addrs[0].Target, addrs[0].Port), timeout)
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no SRV records found for %s", service)
+		}
+
+		// records come ordered by priority and weight, so
+		// fail over to the next target if one is down
+		for _, addr := range addrs {
+			conn, err = net.DialTimeout("tcp", net.JoinHostPort(strings.TrimSuffix(addr.Target, "."), strconv.Itoa(int(addr.Port))), timeout)
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
 	}
 }
 
@@ -153,6 +209,16 @@ func singleJoiningSlash(a, b string) string {
 // Without logic: target's path is "/", incoming is "/api/messages",
 // without is "/api", then the target request will be for /messages.
 func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int, timeout, fallbackDelay time.Duration) *ReverseProxy {
+	// uwsgi upstreams are reached with their own transport; the
+	// path of a uwsgi socket must not become part of request URLs
+	var uwsgi *uwsgiTransport
+	if target.Scheme == "uwsgi" {
+		uwsgi = &uwsgiTransport{network: "tcp", address: target.Host}
+	} else if target.Scheme == "uwsgi+unix" {
+		uwsgi = &uwsgiTransport{network: "unix", address: target.Path}
+		target = &url.URL{Scheme: "uwsgi", Host: "socket"}
+	}
+
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
 		if target.Scheme == "unix" {
@@ -166,6 +232,9 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int, t
 		} else if target.Scheme == "srv+https" {
 			req.URL.Scheme = "https"
 			req.URL.Host = target.Host
+		} else if target.Scheme == "h2c" {
+			req.URL.Scheme = "http"
+			req.URL.Host = target.Host
 		} else {
 			req.URL.Scheme = target.Scheme
 			req.URL.Host = target.Host
@@ -244,15 +313,31 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int, t
 
 	rp := &ReverseProxy{
 		Director:      director,
-		FlushInterval: 250 * time.Millisecond, // flushing good for streaming & server-sent events
+		FlushInterval: defaultFlushInterval,
 		srvResolver:   net.DefaultResolver,
 		dialer:        &dialer,
 	}
 
-	if target.Scheme == "unix" {
+	if uwsgi != nil {
+		uwsgi.dialer = rp.dialer
+		rp.Transport = uwsgi
+	} else if target.Scheme == "unix" {
 		rp.Transport = &http.Transport{
 			Dial: socketDial(target.String(), timeout),
 		}
+	} else if target.Scheme == "h2c" {
+		// HTTP/2 without TLS, as spoken by most gRPC servers
+		rp.Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return rp.dialer.Dial(network, addr)
+			},
+			// a connection that has been silent for a TCP
+			// keep-alive period is checked with a ping, which
+			// has to be answered within the dial timeout
+			ReadIdleTimeout: rp.dialer.KeepAlive,
+			PingTimeout:     rp.dialer.Timeout,
+		}
 	} else if target.Scheme == "quic" {
 		rp.Transport = &h2quic.RoundTripper{
 			QuicConfig: &quic.Config{
@@ -318,6 +403,32 @@ func (rp *ReverseProxy) UseInsecureTransport() {
 	}
 }
 
+// UseConnectionPool tunes how connections to the upstream host
+// are kept: idleTimeout is how long an idle connection stays open,
+// maxConns caps the number of connections to the host, and
+// tcpKeepAlive is the TCP keep-alive period of new connections
+// (negative disables it); h2c connections that are silent for
+// that long are pinged. Zero values keep the defaults.
+func (rp *ReverseProxy) UseConnectionPool(idleTimeout time.Duration, maxConns int, tcpKeepAlive time.Duration) {
+	if tcpKeepAlive != 0 {
+		rp.dialer.KeepAlive = tcpKeepAlive
+	}
+	if transport, ok := rp.Transport.(*http2.Transport); ok && tcpKeepAlive != 0 {
+		transport.ReadIdleTimeout = tcpKeepAlive
+		if tcpKeepAlive < 0 {
+			transport.ReadIdleTimeout = 0
+		}
+	}
+	if transport, ok := rp.Transport.(*http.Transport); ok {
+		if idleTimeout > 0 {
+			transport.IdleConnTimeout = idleTimeout
+		}
+		if maxConns > 0 {
+			transport.MaxConnsPerHost = maxConns
+		}
+	}
+}
+
 // UseOwnCertificate is used to facilitate HTTPS proxying
 // with locally provided certificate.
 func (rp *ReverseProxy) UseOwnCACertificates(CaCertPool *x509.CertPool) {
@@ -337,10 +448,48 @@ func (rp *ReverseProxy) UseOwnCACertificates(CaCertPool *x509.CertPool) {
 	}
 }
 
+// UseClientCertificates is used to present a client certificate
+// to upstreams that require one.
+func (rp *ReverseProxy) UseClientCertificates(certs []tls.Certificate) {
+	if cfg := rp.tlsClientConfig(); cfg != nil {
+		cfg.Certificates = certs
+	}
+}
+
+// UseServerName sets the server name that is sent with SNI and
+// checked against the upstream's certificate, for upstreams that
+// are addressed by IP or by a name not on their certificate.
+func (rp *ReverseProxy) UseServerName(name string) {
+	if cfg := rp.tlsClientConfig(); cfg != nil {
+		cfg.ServerName = name
+	}
+}
+
+// tlsClientConfig returns the TLS config of the transport,
+// creating it if needed, or nil if the transport has none.
+func (rp *ReverseProxy) tlsClientConfig() *tls.Config {
+	switch transport := rp.Transport.(type) {
+	case *http.Transport:
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		return transport.TLSClientConfig
+	case *h2quic.RoundTripper:
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		return transport.TLSClientConfig
+	}
+	return nil
+}
+
 // ServeHTTP serves the proxied request to the upstream by performing a roundtrip.
 // It is designed to handle websocket connection upgrades as well.
 func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request, respUpdateFn respUpdateFn) error {
 	transport := rp.Transport
+	if rp.ProxyProtocol != 0 {
+		transport = newProxyProtocolTransport(transport, proxyProtocolHeader(rp.ProxyProtocol, outreq))
+	}
 	if requestIsWebsocket(outreq) {
 		transport = newConnHijackerTransport(transport)
 	}
@@ -351,11 +500,34 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		outreq.URL.Scheme = "https" // Change scheme back to https for QUIC RoundTripper
 	}
 
+	// an upstream timeout bounds the wait for the response
+	// headers, but not how long the body takes to stream
+	var timer *time.Timer
+	if timeout, ok := outreq.Context().Value(httpserver.UpstreamTimeoutCtxKey).(time.Duration); ok && timeout > 0 {
+		ctx, cancel := context.WithCancel(outreq.Context())
+		defer cancel()
+		timer = time.AfterFunc(timeout, cancel)
+		outreq = outreq.WithContext(ctx)
+	}
+
 	res, err := transport.RoundTrip(outreq)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			res.Body.Close()
+		}
+		return errUpstreamTimeout
+	}
 	if err != nil {
 		return err
 	}
 
+	for _, code := range rp.RetryStatuses {
+		if res.StatusCode == code {
+			res.Body.Close()
+			return upstreamStatusError(code)
+		}
+	}
+
 	isWebsocket := res.StatusCode == http.StatusSwitchingProtocols && strings.EqualFold(res.Header.Get("Upgrade"), "websocket")
 
 	// Remove hop-by-hop headers listed in the
@@ -407,11 +579,18 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		}
 		defer backendConn.Close()
 
+		var fromBackend, fromClient io.Reader = backendConn, conn
+		if rp.WebSocketIdleTimeout > 0 {
+			idle := newIdleTracker(rp.WebSocketIdleTimeout, conn, backendConn)
+			defer idle.stop()
+			fromBackend, fromClient = idle.reader(backendConn), idle.reader(conn)
+		}
+
 		proxyDone := make(chan struct{}, 2)
 
 		// Proxy backend -> frontend.
 		go func() {
-			pooledIoCopy(conn, backendConn)
+			pooledIoCopy(conn, fromBackend, tunnelBufPool)
 			proxyDone <- struct{}{}
 		}()
 
@@ -431,7 +610,7 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 			}
 		}
 		go func() {
-			pooledIoCopy(backendConn, conn)
+			pooledIoCopy(backendConn, fromClient, tunnelBufPool)
 			proxyDone <- struct{}{}
 		}()
 
@@ -451,6 +630,15 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		}
 		defer closeBody()
 
+		var body io.Reader = res.Body
+		if rp.BufferResponses > 0 && !isStreamingResponse(res) {
+			buf, err := ioutil.ReadAll(io.LimitReader(res.Body, rp.BufferResponses))
+			if err != nil {
+				return err
+			}
+			body = io.MultiReader(bytes.NewReader(buf), res.Body)
+		}
+
 		// Copy all headers over.
 		// res.Header does not include the "Trailer" header,
 		// which means we will have to do that manually below.
@@ -481,7 +669,12 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 				fl.Flush()
 			}
 		}
-		rp.copyResponse(rw, res.Body)
+		flushInterval := rp.FlushInterval
+		if isStreamingResponse(res) {
+			// streams must not be held back by buffering
+			flushInterval = -1
+		}
+		rp.copyResponse(rw, body, flushInterval)
 
 		// Now close the body to fully populate res.Trailer.
 		closeBody()
@@ -498,12 +691,16 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 	return nil
 }
 
-func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
-	if rp.FlushInterval != 0 {
+func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader, flushInterval time.Duration) {
+	if flushInterval < 0 {
+		if wf, ok := dst.(writeFlusher); ok {
+			dst = immediateFlushWriter{wf}
+		}
+	} else if flushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
 			mlw := &maxLatencyWriter{
 				dst:     wf,
-				latency: rp.FlushInterval,
+				latency: flushInterval,
 				done:    make(chan bool),
 			}
 			go mlw.flushLoop()
@@ -511,7 +708,79 @@ func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 			dst = mlw
 		}
 	}
-	pooledIoCopy(dst, src)
+	pooledIoCopy(dst, src, responseBufPool)
+}
+
+// idleTracker closes connections once no data has
+// been read from any of them for a while.
+type idleTracker struct {
+	timeout time.Duration
+	last    int64 // unix nanoseconds of the last read
+	done    chan struct{}
+}
+
+// newIdleTracker starts closing conns after timeout
+// without reads through the readers of the tracker.
+func newIdleTracker(timeout time.Duration, conns ...net.Conn) *idleTracker {
+	t := &idleTracker{
+		timeout: timeout,
+		last:    time.Now().UnixNano(),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if now.Sub(time.Unix(0, atomic.LoadInt64(&t.last))) < timeout {
+					continue
+				}
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// reader returns r, counting its reads as activity.
+func (t *idleTracker) reader(r io.Reader) io.Reader {
+	return activityReader{r, t}
+}
+
+func (t *idleTracker) stop() {
+	close(t.done)
+}
+
+type activityReader struct {
+	io.Reader
+	t *idleTracker
+}
+
+func (r activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&r.t.last, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// isGRPCResponse returns true if res is a gRPC response,
+// which is streamed and must be flushed as it arrives.
+func isGRPCResponse(res *http.Response) bool {
+	return res.ProtoMajor == 2 && strings.HasPrefix(res.Header.Get("Content-Type"), "application/grpc")
+}
+
+// isStreamingResponse returns true if res is a gRPC response or
+// a stream of server-sent events, which the client expects to
+// get each part of as soon as it is sent.
+func isStreamingResponse(res *http.Response) bool {
+	return isGRPCResponse(res) || strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream")
 }
 
 // skip these headers if they already exist.
@@ -774,3 +1043,14 @@ func (m *maxLatencyWriter) flushLoop() {
 }
 
 func (m *maxLatencyWriter) stop() { m.done <- true }
+
+// immediateFlushWriter flushes after every write.
+type immediateFlushWriter struct {
+	dst writeFlusher
+}
+
+func (w immediateFlushWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.dst.Flush()
+	return n, err
+}
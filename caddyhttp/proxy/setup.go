@@ -23,6 +23,7 @@ func init() {
 	caddy.RegisterPlugin("proxy", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
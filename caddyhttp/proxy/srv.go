@@ -0,0 +1,97 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSRVRefresh is how often the targets of a service
+// locator are looked up again if srv_refresh is not set.
+const defaultSRVRefresh = 30 * time.Second
+
+// srvSource is a service locator upstream, whose SRV records
+// are resolved periodically into the upstream's host pool.
+type srvSource struct {
+	// Locator is the srv:// or srv+https:// upstream.
+	Locator string
+
+	// Interval is how often the records are looked up.
+	Interval time.Duration
+}
+
+// service returns the name whose SRV records are looked up
+// and the scheme of the hosts they point to.
+func (s *srvSource) service() (name, scheme string) {
+	if strings.HasPrefix(s.Locator, "srv+https://") {
+		return strings.TrimPrefix(s.Locator, "srv+https://"), "https"
+	}
+	return strings.TrimPrefix(s.Locator, "srv://"), "http"
+}
+
+// refreshSRVHosts looks up the SRV records of the service
+// locator and makes their targets the host pool, so that they
+// are health checked, weighted and failed over like any other
+// host. Records come ordered by priority; their weights become
+// host weights. Until a lookup succeeds, the locator itself is
+// the only host and picks a target on every dial.
+func (u *staticUpstream) refreshSRVHosts() error {
+	name, scheme := u.srv.service()
+	_, addrs, err := u.resolver.LookupSRV(context.Background(), "", "", name)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no SRV records found for %s", name)
+	}
+
+	var pool HostPool
+	for _, addr := range addrs {
+		hostPort := net.JoinHostPort(strings.TrimSuffix(addr.Target, "."), strconv.Itoa(int(addr.Port)))
+		uh, err := u.NewHost(scheme + "://" + hostPort)
+		if err != nil {
+			return err
+		}
+		if addr.Weight > 0 {
+			uh.Weight = int(addr.Weight)
+		}
+		pool = append(pool, uh)
+	}
+	u.replaceHosts(pool)
+	return nil
+}
+
+// SRVHostsWorker resolves the service locator right away and
+// then every interval until stop is closed.
+func (u *staticUpstream) SRVHostsWorker(stop chan struct{}) {
+	ticker := time.NewTicker(u.srv.Interval)
+	for {
+		if err := u.refreshSRVHosts(); err != nil {
+			log.Printf("[ERROR] Resolving upstreams for %s: %v", u.from, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestSRVHosts(t *testing.T) {
+	upstream := &staticUpstream{
+		Hosts:  HostPool{{Name: "srv+https://api.service.consul"}},
+		srv:    &srvSource{Locator: "srv+https://api.service.consul", Interval: time.Minute},
+		stop:   make(chan struct{}),
+		Policy: &Random{},
+		resolver: testResolver{
+			errOn: "api.service.consul",
+		},
+	}
+
+	// a failed lookup leaves the locator in place
+	if err := upstream.refreshSRVHosts(); err == nil {
+		t.Error("Expected an error when the lookup fails")
+	}
+	if hosts := upstream.hosts(); len(hosts) != 1 || hosts[0].Name != "srv+https://api.service.consul" {
+		t.Errorf("Expected the locator to remain the only host, got %v", hosts)
+	}
+
+	upstream.resolver = testResolver{
+		result: []*net.SRV{
+			{Target: "target-1.fqdn.", Port: 8443, Priority: 1, Weight: 3},
+			{Target: "target-2.fqdn.", Port: 8443, Priority: 2, Weight: 0},
+		},
+	}
+	if err := upstream.refreshSRVHosts(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	hosts := upstream.hosts()
+	if len(hosts) != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", len(hosts))
+	}
+	for i, expected := range []struct {
+		name   string
+		weight int
+	}{
+		{"https://target-1.fqdn:8443", 3},
+		{"https://target-2.fqdn:8443", 1},
+	} {
+		if hosts[i].Name != expected.name || hosts[i].Weight != expected.weight {
+			t.Errorf("Host %d: Expected %s with weight %d, got %s with weight %d",
+				i, expected.name, expected.weight, hosts[i].Name, hosts[i].Weight)
+		}
+		if hosts[i].ReverseProxy == nil {
+			t.Errorf("Host %d: Expected a reverse proxy", i)
+		}
+	}
+
+	// targets that are still published keep their state
+	hosts[0].Unhealthy = 1
+	upstream.resolver = testResolver{
+		result: []*net.SRV{
+			{Target: "target-1.fqdn.", Port: 8443, Priority: 1, Weight: 3},
+			{Target: "target-3.fqdn.", Port: 8443, Priority: 1, Weight: 1},
+		},
+	}
+	if err := upstream.refreshSRVHosts(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	refreshed := upstream.hosts()
+	if len(refreshed) != 2 || refreshed[0] != hosts[0] || refreshed[1].Name != "https://target-3.fqdn:8443" {
+		t.Errorf("Expected target-1 to be kept and target-2 replaced by target-3, got %v", refreshed)
+	}
+}
+
+func TestParseSRVRefresh(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / srv://bogus.service {\n srv_refresh 5m \n}")), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	defer upstream.Stop()
+	if upstream.srv == nil || upstream.srv.Interval != 5*time.Minute {
+		t.Errorf("Expected SRV records to be looked up every 5m, got %+v", upstream.srv)
+	}
+
+	for i, config := range []string{
+		"proxy / localhost:8080 {\n srv_refresh 5m \n}",
+		"proxy / srv://bogus.service {\n srv_refresh \n}",
+		"proxy / srv://bogus.service {\n srv_refresh 0s \n}",
+		"proxy / srv://bogus.service {\n srv_refresh soon \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), ""); err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
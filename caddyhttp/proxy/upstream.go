@@ -26,6 +26,7 @@ import (
 	"net/http"
 	"net/textproto"
 	"net/url"
+	"os"
 	"path"
 	"regexp"
 	"strconv"
@@ -36,8 +37,10 @@ import (
 
 	"crypto/tls"
 
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddylog"
 )
 
 var (
@@ -50,9 +53,13 @@ type staticUpstream struct {
 	downstreamHeaders http.Header
 	stop              chan struct{}  // Signals running goroutines to stop.
 	wg                sync.WaitGroup // Used to wait for running goroutines to stop.
+	hostsMu           sync.RWMutex   // Guards Hosts when they are loaded dynamically.
 	Hosts             HostPool
 	Policy            Policy
 	KeepAlive         int
+	IdleConnTimeout   time.Duration
+	MaxTransportConns int
+	TCPKeepAlive      time.Duration
 	FallbackDelay     time.Duration
 	Timeout           time.Duration
 	FailTimeout       time.Duration
@@ -70,10 +77,26 @@ type staticUpstream struct {
 	}
 	WithoutPathPrefix            string
 	IgnoredSubPaths              []string
+	WebSocketIdleTimeout         time.Duration
+	FlushInterval                time.Duration
+	RetryStatuses                []int
+	RetryIdempotentOnly          bool
+	CircuitBreaker               *CircuitBreaker
+	breakerFallback              *fallbackResponse
+	dynamic                      *dynamicSource
+	srv                          *srvSource
+	BufferRequests               int64
+	BufferResponses              int64
+	SpoolRequests                int64
+	SpoolDir                     string
+	Mirror                       *Mirror
+	ProxyProtocol                int
 	insecureSkipVerify           bool
 	MaxFails                     int32
 	resolver                     srvResolver
 	CaCertPool                   *x509.CertPool
+	ClientCertificates           []tls.Certificate
+	ServerName                   string
 	upstreamHeaderReplacements   headerReplacements
 	downstreamHeaderReplacements headerReplacements
 }
@@ -121,6 +144,7 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			MaxConns:                     0,
 			KeepAlive:                    http.DefaultMaxIdleConnsPerHost,
 			Timeout:                      30 * time.Second,
+			FlushInterval:                defaultFlushInterval,
 			resolver:                     net.DefaultResolver,
 			upstreamHeaderReplacements:   make(headerReplacements),
 			downstreamHeaderReplacements: make(headerReplacements),
@@ -131,6 +155,7 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 		}
 
 		var to []string
+		weights := make(map[string]int)
 		hasSrv := false
 
 		for _, t := range c.RemainingArgs() {
@@ -153,6 +178,10 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			to = append(to, parsed...)
 		}
 
+		if hasSrv {
+			upstream.srv = &srvSource{Locator: to[0], Interval: defaultSRVRefresh}
+		}
+
 		for c.NextBlock() {
 			switch c.Val() {
 			case "upstream":
@@ -169,6 +198,20 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 					return upstreams, err
 				}
 				to = append(to, parsed...)
+
+				args := c.RemainingArgs()
+				if len(args) > 0 {
+					if len(args) != 2 || args[0] != "weight" {
+						return upstreams, c.ArgErr()
+					}
+					weight, err := strconv.Atoi(args[1])
+					if err != nil || weight < 0 {
+						return upstreams, c.Errf("invalid upstream weight '%s'", args[1])
+					}
+					for _, host := range parsed {
+						weights[host] = weight
+					}
+				}
 			default:
 				if err := parseBlock(&c, upstream, hasSrv); err != nil {
 					return upstreams, err
@@ -176,7 +219,11 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			}
 		}
 
-		if len(to) == 0 {
+		if upstream.SpoolRequests > 0 && upstream.BufferRequests == 0 {
+			return upstreams, c.Err("spool_requests requires buffer_requests")
+		}
+
+		if len(to) == 0 && upstream.dynamic == nil {
 			return upstreams, c.ArgErr()
 		}
 
@@ -186,14 +233,41 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			if err != nil {
 				return upstreams, err
 			}
+			if weight, ok := weights[host]; ok {
+				uh.Weight = weight
+			}
 			upstream.Hosts[i] = uh
 		}
 
+		if upstream.dynamic != nil {
+			if err := upstream.refreshHosts(); err != nil {
+				return upstreams, c.Err(err.Error())
+			}
+			upstream.wg.Add(1)
+			go func() {
+				defer upstream.wg.Done()
+				upstream.DynamicHostsWorker(upstream.stop)
+			}()
+		}
+
+		if upstream.srv != nil {
+			upstream.wg.Add(1)
+			go func() {
+				defer upstream.wg.Done()
+				upstream.SRVHostsWorker(upstream.stop)
+			}()
+		}
+
 		if upstream.HealthCheck.Path != "" {
 			upstream.HealthCheck.Client = http.Client{
 				Timeout: upstream.HealthCheck.Timeout,
 				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: upstream.insecureSkipVerify},
+					TLSClientConfig: &tls.Config{
+						InsecureSkipVerify: upstream.insecureSkipVerify,
+						RootCAs:            upstream.CaCertPool,
+						Certificates:       upstream.ClientCertificates,
+						ServerName:         upstream.ServerName,
+					},
 				},
 			}
 
@@ -223,6 +297,8 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 	if !strings.HasPrefix(host, "http") &&
 		!strings.HasPrefix(host, "unix:") &&
 		!strings.HasPrefix(host, "quic:") &&
+		!strings.HasPrefix(host, "uwsgi") &&
+		!strings.HasPrefix(host, "h2c://") &&
 		!strings.HasPrefix(host, "srv://") &&
 		!strings.HasPrefix(host, "srv+https://") {
 		host = "http://" + host
@@ -233,6 +309,7 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		Fails:             0,
 		FailTimeout:       u.FailTimeout,
 		Unhealthy:         0,
+		Weight:            1,
 		UpstreamHeaders:   u.upstreamHeaders,
 		DownstreamHeaders: u.downstreamHeaders,
 		CheckDown: func(u *staticUpstream) UpstreamHostDownFunc {
@@ -243,6 +320,9 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 				if atomic.LoadInt32(&uh.Fails) >= u.MaxFails {
 					return true
 				}
+				if uh.CircuitBreaker != nil && uh.CircuitBreaker.Open() {
+					return true
+				}
 				return false
 			}
 		}(u),
@@ -251,6 +331,10 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		HealthCheckResult:            atomic.Value{},
 		UpstreamHeaderReplacements:   u.upstreamHeaderReplacements,
 		DownstreamHeaderReplacements: u.downstreamHeaderReplacements,
+		RetryIdempotentOnly:          u.RetryIdempotentOnly,
+	}
+	if u.CircuitBreaker != nil {
+		uh.CircuitBreaker = u.CircuitBreaker.newCircuitBreaker()
 	}
 
 	baseURL, err := url.Parse(uh.Name)
@@ -259,6 +343,12 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 	}
 
 	uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix, u.KeepAlive, u.Timeout, u.FallbackDelay)
+	uh.ReverseProxy.WebSocketIdleTimeout = u.WebSocketIdleTimeout
+	uh.ReverseProxy.FlushInterval = u.FlushInterval
+	uh.ReverseProxy.RetryStatuses = u.RetryStatuses
+	uh.ReverseProxy.BufferResponses = u.BufferResponses
+	uh.ReverseProxy.ProxyProtocol = u.ProxyProtocol
+	uh.ReverseProxy.UseConnectionPool(u.IdleConnTimeout, u.MaxTransportConns, u.TCPKeepAlive)
 	if u.insecureSkipVerify {
 		uh.ReverseProxy.UseInsecureTransport()
 	}
@@ -267,11 +357,19 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		uh.ReverseProxy.UseOwnCACertificates(u.CaCertPool)
 	}
 
+	if len(u.ClientCertificates) > 0 {
+		uh.ReverseProxy.UseClientCertificates(u.ClientCertificates)
+	}
+
+	if u.ServerName != "" {
+		uh.ReverseProxy.UseServerName(u.ServerName)
+	}
+
 	return uh, nil
 }
 
 func parseUpstream(u string) ([]string, error) {
-	if strings.HasPrefix(u, "unix:") {
+	if strings.HasPrefix(u, "unix:") || strings.HasPrefix(u, "uwsgi+unix:") {
 		return []string{u}, nil
 	}
 
@@ -346,6 +444,31 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 			arg = c.Val()
 		}
 		u.Policy = policyCreateFunc(arg)
+	case "cookie_ttl":
+		cookie, ok := u.Policy.(*Cookie)
+		if !ok {
+			return c.Err("cookie_ttl must follow 'policy cookie'")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return c.Err("cookie_ttl must not be negative")
+		}
+		cookie.TTL = dur
+	case "cookie_secret":
+		cookie, ok := u.Policy.(*Cookie)
+		if !ok {
+			return c.Err("cookie_secret must follow 'policy cookie'")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		cookie.Secret = []byte(c.Val())
 	case "fallback_delay":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -355,6 +478,23 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 			return err
 		}
 		u.FallbackDelay = dur
+	case "flush_interval":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() == "-1" {
+			// flush after every write
+			u.FlushInterval = -1
+			break
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return c.Errf("unable to parse flush interval duration '%s'", c.Val())
+		}
+		if dur < 0 {
+			return c.Err("flush interval must be -1 or a non-negative duration")
+		}
+		u.FlushInterval = dur
 	case "fail_timeout":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -394,6 +534,130 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 			return err
 		}
 		u.TryInterval = interval
+	case "retry_status":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, arg := range args {
+			code, err := strconv.Atoi(arg)
+			if err != nil {
+				return c.Errf("invalid retry status code '%s'", arg)
+			}
+			if code < 400 || code > 599 {
+				return c.Errf("retry status code must be between 400 and 599, got %d", code)
+			}
+			u.RetryStatuses = append(u.RetryStatuses, code)
+		}
+	case "dynamic_upstreams":
+		if hasSrv {
+			return c.Err("dynamic_upstreams is not supported when backend is service locator")
+		}
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		u.dynamic = &dynamicSource{
+			Location: args[0],
+			Interval: 10 * time.Second,
+			client:   http.Client{Timeout: 10 * time.Second},
+		}
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur <= 0 {
+				return c.Err("dynamic_upstreams interval must be positive")
+			}
+			u.dynamic.Interval = dur
+		}
+	case "srv_refresh":
+		if !hasSrv {
+			return c.Err("srv_refresh requires a service locator upstream")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Err("srv_refresh interval must be positive")
+		}
+		u.srv.Interval = dur
+	case "buffer_requests", "buffer_responses":
+		prop := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size := httpserver.ParseSize(c.Val())
+		if size <= 0 {
+			return c.Errf("invalid %s size '%s'", prop, c.Val())
+		}
+		if prop == "buffer_requests" {
+			u.BufferRequests = size
+		} else {
+			u.BufferResponses = size
+		}
+	case "spool_requests":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		size := httpserver.ParseSize(args[0])
+		if size <= 0 {
+			return c.Errf("invalid spool_requests size '%s'", args[0])
+		}
+		u.SpoolRequests = size
+		if len(args) == 2 {
+			info, err := os.Stat(args[1])
+			if err != nil {
+				return c.Errf("spool_requests directory: %v", err)
+			}
+			if !info.IsDir() {
+				return c.Errf("spool_requests: %s is not a directory", args[1])
+			}
+			u.SpoolDir = args[1]
+		}
+	case "proxy_protocol":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case "v1":
+			u.ProxyProtocol = 1
+		case "v2":
+			u.ProxyProtocol = 2
+		default:
+			return c.Errf("proxy_protocol must be v1 or v2, got '%s'", c.Val())
+		}
+	case "mirror":
+		if err := parseMirror(c, u); err != nil {
+			return err
+		}
+	case "mirror_max_body":
+		if u.Mirror == nil {
+			return c.Err("mirror_max_body must follow mirror")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size := httpserver.ParseSize(c.Val())
+		if size < 0 {
+			return c.Errf("invalid mirror_max_body size '%s'", c.Val())
+		}
+		u.Mirror.MaxBody = size
+	case "circuit_breaker":
+		if err := parseCircuitBreaker(c, u); err != nil {
+			return err
+		}
+	case "retry_idempotent_only":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		u.RetryIdempotentOnly = true
 	case "max_conns":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -460,17 +724,17 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 			return c.ArgErr()
 		}
 		u.HealthCheck.ContentString = c.Val()
-	case "header_upstream":
+	case "header_upstream", "header_up":
 		isUpstream = true
 		fallthrough
-	case "header_downstream":
+	case "header_downstream", "header_down":
 		var header, value, replaced string
 		if c.Args(&header, &value, &replaced) {
 			// Don't allow - or + in replacements
 			if strings.HasPrefix(header, "-") || strings.HasPrefix(header, "+") {
 				return c.ArgErr()
 			}
-			r, err := regexp.Compile(value)
+			r, err := caddy.CompileRegexp(value)
 			if err != nil {
 				return err
 			}
@@ -496,12 +760,25 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 		// Note: X-Forwarded-For header is always being appended for proxy connections
 		// See implementation of createUpstreamRequest in proxy.go
 		u.upstreamHeaders.Add("Host", "{host}")
+		u.upstreamHeaders.Add("X-Forwarded-Host", "{host}")
 		u.upstreamHeaders.Add("X-Real-IP", "{remote}")
 		u.upstreamHeaders.Add("X-Forwarded-Proto", "{scheme}")
 		u.upstreamHeaders.Add("X-Forwarded-Port", "{server_port}")
 	case "websocket":
 		u.upstreamHeaders.Add("Connection", "{>Connection}")
 		u.upstreamHeaders.Add("Upgrade", "{>Upgrade}")
+	case "websocket_idle_timeout":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return c.Errf("unable to parse websocket idle timeout duration '%s'", c.Val())
+		}
+		if dur < 0 {
+			return c.Err("non-negative duration required for websocket idle timeout")
+		}
+		u.WebSocketIdleTimeout = dur
 	case "without":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -543,6 +820,21 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 		}
 
 		u.CaCertPool = pool
+	case "tls_client_certificate":
+		var certFile, keyFile string
+		if !c.Args(&certFile, &keyFile) || c.NextArg() {
+			return c.ArgErr()
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return c.Errf("loading client certificate: %v", err)
+		}
+		u.ClientCertificates = append(u.ClientCertificates, cert)
+	case "tls_server_name":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u.ServerName = c.Val()
 	case "keepalive":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -555,6 +847,46 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream, hasSrv bool) error {
 			return c.ArgErr()
 		}
 		u.KeepAlive = n
+	case "keepalive_idle_timeout":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Err("keepalive_idle_timeout must be positive")
+		}
+		u.IdleConnTimeout = dur
+	case "max_transport_conns":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return c.Err("max_transport_conns must be at least 1")
+		}
+		u.MaxTransportConns = n
+	case "tcp_keepalive":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() == "off" {
+			u.TCPKeepAlive = -1
+			break
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Err("tcp_keepalive must be positive or off")
+		}
+		u.TCPKeepAlive = dur
 	case "timeout":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -601,7 +933,7 @@ func (u *staticUpstream) resolveHost(h string) ([]string, bool, error) {
 }
 
 func (u *staticUpstream) healthCheck() {
-	for _, host := range u.Hosts {
+	for _, host := range u.hosts() {
 		candidates, isSrv, err := u.resolveHost(host.Name)
 		if err != nil {
 			host.HealthCheckResult.Store(err.Error())
@@ -662,10 +994,16 @@ func (u *staticUpstream) healthCheck() {
 		}
 
 		if unhealthyCount == len(candidates) {
-			atomic.StoreInt32(&host.Unhealthy, 1)
+			if atomic.SwapInt32(&host.Unhealthy, 1) == 0 {
+				caddylog.Warn("Upstream failed health check", "upstream", host.Name, "path", u.HealthCheck.Path)
+				caddy.EmitEvent(caddy.UpstreamDownEvent, host.Name)
+			}
 			host.HealthCheckResult.Store("Failed")
 		} else {
-			atomic.StoreInt32(&host.Unhealthy, 0)
+			if atomic.SwapInt32(&host.Unhealthy, 0) == 1 {
+				caddylog.Info("Upstream passed health check", "upstream", host.Name, "path", u.HealthCheck.Path)
+				caddy.EmitEvent(caddy.UpstreamUpEvent, host.Name)
+			}
 			host.HealthCheckResult.Store("OK")
 		}
 	}
@@ -686,7 +1024,7 @@ func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 }
 
 func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
-	pool := u.Hosts
+	pool := u.hosts()
 	if len(pool) == 1 {
 		if !pool[0].Available() {
 			return nil
@@ -738,6 +1076,24 @@ func (u *staticUpstream) GetTryDuration() time.Duration {
 	return u.TryDuration
 }
 
+func (u *staticUpstream) selected(host *UpstreamHost, w http.ResponseWriter, r *http.Request) {
+	if policy, ok := u.Policy.(ResponsePolicy); ok {
+		policy.Selected(host, w, r)
+	}
+}
+
+func (u *staticUpstream) requestBuffering() (int64, int64, string) {
+	return u.BufferRequests, u.SpoolRequests, u.SpoolDir
+}
+
+func (u *staticUpstream) mirror() *Mirror {
+	return u.Mirror
+}
+
+func (u *staticUpstream) fallback() *fallbackResponse {
+	return u.breakerFallback
+}
+
 // GetTryInterval returns u.TryInterval.
 func (u *staticUpstream) GetTryInterval() time.Duration {
 	return u.TryInterval
@@ -749,7 +1105,14 @@ func (u *staticUpstream) GetTimeout() time.Duration {
 }
 
 func (u *staticUpstream) GetHostCount() int {
-	return len(u.Hosts)
+	return len(u.hosts())
+}
+
+// hosts returns the current host pool.
+func (u *staticUpstream) hosts() HostPool {
+	u.hostsMu.RLock()
+	defer u.hostsMu.RUnlock()
+	return u.Hosts
 }
 
 // Stop sends a signal to all goroutines started by this staticUpstream to exit
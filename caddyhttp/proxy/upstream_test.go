@@ -16,6 +16,7 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
@@ -32,6 +33,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/h2quic"
 	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func TestNewHost(t *testing.T) {
@@ -221,6 +223,264 @@ func TestParseBlockCACertificates(t *testing.T) {
 	}
 }
 
+func TestUpstreamClientCertificateAndServerName(t *testing.T) {
+	var serverName string
+	var peerCerts int
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+		peerCerts = len(r.TLS.PeerCertificates)
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	config := "proxy / " + backend.URL + " {\n insecure_skip_verify \n tls_client_certificate ./testdata/fullchain.pem ./testdata/privkey.pem \n tls_server_name internal.example \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error. Got: %s", err.Error())
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext,
+		Upstreams: upstreams,
+	}
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("Expected no error proxying, got %v", err)
+	}
+	if serverName != "internal.example" {
+		t.Errorf("Expected SNI server name internal.example, got %q", serverName)
+	}
+	if peerCerts == 0 {
+		t.Error("Expected the client certificate to be presented")
+	}
+
+	for i, config := range []string{
+		"tls_client_certificate ./testdata/fullchain.pem",
+		"tls_client_certificate ./testdata/fullchain.pem ./testdata/missing.pem",
+		"tls_client_certificate ./testdata/fullchain.pem ./testdata/privkey.pem extra",
+		"tls_server_name",
+	} {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
+
+func TestParseBlockWebSocketIdleTimeout(t *testing.T) {
+	tests := []struct {
+		config     string
+		shouldPass bool
+		expected   time.Duration
+	}{
+		{"websocket_idle_timeout 5m", true, 5 * time.Minute},
+		{"websocket_idle_timeout", false, 0},
+		{"websocket_idle_timeout soon", false, 0},
+		{"websocket_idle_timeout -1s", false, 0},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if test.shouldPass != (err == nil) {
+			t.Errorf("Test %d: expected passing to be %v, got error: %v", i+1, test.shouldPass, err)
+		}
+		if u.WebSocketIdleTimeout != test.expected {
+			t.Errorf("Test %d: expected websocket idle timeout %v, got %v", i+1, test.expected, u.WebSocketIdleTimeout)
+		}
+	}
+}
+
+func TestParseBlockFlushInterval(t *testing.T) {
+	tests := []struct {
+		config     string
+		shouldPass bool
+		expected   time.Duration
+	}{
+		{"flush_interval 1s", true, time.Second},
+		{"flush_interval 0", true, 0},
+		{"flush_interval -1", true, -1},
+		{"flush_interval", false, 0},
+		{"flush_interval often", false, 0},
+		{"flush_interval -1s", false, 0},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if test.shouldPass != (err == nil) {
+			t.Errorf("Test %d: expected passing to be %v, got error: %v", i+1, test.shouldPass, err)
+		}
+		if u.FlushInterval != test.expected {
+			t.Errorf("Test %d: expected flush interval %v, got %v", i+1, test.expected, u.FlushInterval)
+		}
+	}
+}
+
+func TestParseBlockRetryStatus(t *testing.T) {
+	tests := []struct {
+		config     string
+		shouldPass bool
+		expected   []int
+	}{
+		{"retry_status 502 503", true, []int{502, 503}},
+		{"retry_status", false, nil},
+		{"retry_status bad", false, nil},
+		{"retry_status 200", false, nil},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if test.shouldPass != (err == nil) {
+			t.Errorf("Test %d: expected passing to be %v, got error: %v", i+1, test.shouldPass, err)
+		}
+		if !reflect.DeepEqual(u.RetryStatuses, test.expected) {
+			t.Errorf("Test %d: expected retry statuses %v, got %v", i+1, test.expected, u.RetryStatuses)
+		}
+	}
+}
+
+func TestParseBlockConnectionPool(t *testing.T) {
+	config := "proxy / localhost:8080 {\n keepalive 64 \n keepalive_idle_timeout 2m \n max_transport_conns 128 \n tcp_keepalive 15s \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error. Got: %s", err.Error())
+	}
+	rp := upstreams[0].(*staticUpstream).Hosts[0].ReverseProxy
+	transport, ok := rp.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected *http.Transport, got %T", rp.Transport)
+	}
+	if transport.MaxIdleConnsPerHost != 64 {
+		t.Errorf("Expected 64 idle connections per host, got %d", transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 2*time.Minute {
+		t.Errorf("Expected idle timeout of 2m, got %v", transport.IdleConnTimeout)
+	}
+	if transport.MaxConnsPerHost != 128 {
+		t.Errorf("Expected 128 connections per host, got %d", transport.MaxConnsPerHost)
+	}
+	if rp.dialer.KeepAlive != 15*time.Second {
+		t.Errorf("Expected TCP keep-alive of 15s, got %v", rp.dialer.KeepAlive)
+	}
+
+	for i, config := range []string{
+		"keepalive_idle_timeout",
+		"keepalive_idle_timeout 0s",
+		"max_transport_conns 0",
+		"max_transport_conns many",
+		"tcp_keepalive -1s",
+		"tcp_keepalive never",
+	} {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(config))
+		var err error
+		for c.Next() {
+			err = parseBlock(&c, &u, false)
+		}
+		if err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+
+	u := staticUpstream{}
+	c := caddyfile.NewDispenser("Testfile", strings.NewReader("tcp_keepalive off"))
+	for c.Next() {
+		if err := parseBlock(&c, &u, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if u.TCPKeepAlive >= 0 {
+		t.Errorf("Expected tcp_keepalive off to disable keep-alive, got %v", u.TCPKeepAlive)
+	}
+}
+
+func TestParseBlockCookiePolicy(t *testing.T) {
+	u := staticUpstream{}
+	c := caddyfile.NewDispenser("Testfile", strings.NewReader("policy cookie backend\ncookie_ttl 1h\ncookie_secret s3cret"))
+	for c.Next() {
+		if err := parseBlock(&c, &u, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cookie, ok := u.Policy.(*Cookie)
+	if !ok {
+		t.Fatalf("Expected cookie policy, got %T", u.Policy)
+	}
+	if cookie.Name != "backend" || cookie.TTL != time.Hour || string(cookie.Secret) != "s3cret" {
+		t.Errorf("Unexpected cookie policy settings: %+v", cookie)
+	}
+
+	for i, config := range []string{
+		"cookie_ttl 1h",
+		"cookie_secret s3cret",
+		"policy cookie\ncookie_ttl",
+		"policy cookie\ncookie_ttl -1h",
+		"policy cookie\ncookie_secret",
+	} {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(config))
+		var err error
+		for c.Next() {
+			if err = parseBlock(&c, &u, false); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
+
+func TestParseBlockUpstreamWeight(t *testing.T) {
+	config := "proxy / {\n policy weighted_round_robin \n upstream localhost:8080 weight 19 \n upstream localhost:8081-8082 weight 0 \n upstream localhost:8083 \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error. Got: %s", err.Error())
+	}
+	u := upstreams[0].(*staticUpstream)
+	if _, ok := u.Policy.(*WeightedRoundRobin); !ok {
+		t.Errorf("Expected weighted_round_robin policy, got %T", u.Policy)
+	}
+	expected := []int{19, 0, 0, 1}
+	if len(u.Hosts) != len(expected) {
+		t.Fatalf("Expected %d hosts, got %d", len(expected), len(u.Hosts))
+	}
+	for i, host := range u.Hosts {
+		if host.Weight != expected[i] {
+			t.Errorf("Host %s: expected weight %d, got %d", host.Name, expected[i], host.Weight)
+		}
+	}
+
+	for i, config := range []string{
+		"proxy / {\n upstream localhost:8080 weight \n}",
+		"proxy / {\n upstream localhost:8080 weight -1 \n}",
+		"proxy / {\n upstream localhost:8080 heavy 5 \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), ""); err == nil {
+			t.Errorf("Test %d: Expected an error for %q", i, config)
+		}
+	}
+}
+
 func TestParseBlockHealthCheck(t *testing.T) {
 	tests := []struct {
 		config   string
@@ -370,6 +630,10 @@ func TestParseBlockTransparent(t *testing.T) {
 				t.Errorf("Test %d: Could not find the Host header", i+1)
 			}
 
+			if _, ok := headers["X-Forwarded-Host"]; !ok {
+				t.Errorf("Test %d: Could not find the X-Forwarded-Host header", i+1)
+			}
+
 			if _, ok := headers["X-Real-Ip"]; !ok {
 				t.Errorf("Test %d: Could not find the X-Real-Ip header", i+1)
 			}
@@ -389,6 +653,32 @@ func TestParseBlockTransparent(t *testing.T) {
 	}
 }
 
+func TestParseBlockHeaderShorthand(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	config := "proxy / localhost:8080 {\n header_up X-Auth {>X-User} \n header_up -X-Internal \n header_up Host (.*) NewHost \n header_down -Server \n header_down X-Frame-Options (.*) DENY \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatalf("Expected no error. Got: %s", err.Error())
+	}
+	host := upstreams[0].Select(r)
+
+	if got := host.UpstreamHeaders.Get("X-Auth"); got != "{>X-User}" {
+		t.Errorf("Expected upstream X-Auth header to be {>X-User}, got %q", got)
+	}
+	if _, ok := host.UpstreamHeaders["-X-Internal"]; !ok {
+		t.Error("Expected upstream header removal rule for X-Internal")
+	}
+	if len(host.UpstreamHeaderReplacements["Host"]) != 1 {
+		t.Errorf("Expected 1 upstream replacement for Host, got %d", len(host.UpstreamHeaderReplacements["Host"]))
+	}
+	if _, ok := host.DownstreamHeaders["-Server"]; !ok {
+		t.Error("Expected downstream header removal rule for Server")
+	}
+	if len(host.DownstreamHeaderReplacements["X-Frame-Options"]) != 1 {
+		t.Errorf("Expected 1 downstream replacement for X-Frame-Options, got %d", len(host.DownstreamHeaderReplacements["X-Frame-Options"]))
+	}
+}
+
 func TestParseBlockRegex(t *testing.T) {
 	// tests for regex replacement of headers
 	r, _ := http.NewRequest("GET", "/", nil)
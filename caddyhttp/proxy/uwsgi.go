@@ -0,0 +1,226 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Request bodies of unknown length are spooled before they are
+// sent to a uwsgi application server: up to uwsgiMaxMemBody bytes
+// in memory, and up to uwsgiMaxBody bytes in a temporary file.
+// Larger bodies are rejected with errBodyTooLarge.
+var (
+	uwsgiMaxMemBody int64 = 1 << 20
+	uwsgiMaxBody    int64 = 100 << 20
+)
+
+// uwsgiTransport is an http.RoundTripper that speaks the
+// uwsgi protocol to an application server (such as uWSGI
+// serving a Python WSGI app) instead of HTTP. One
+// connection is used per request.
+type uwsgiTransport struct {
+	network string // "tcp" or "unix"
+	address string
+	dialer  *net.Dialer
+}
+
+// RoundTrip sends req to the application server as a uwsgi
+// packet followed by the request body, and reads back the
+// HTTP response the application server writes.
+func (t *uwsgiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request body has to be preceded by its length,
+	// so spool it if the length is not known in advance;
+	// buffer_requests does this before the transport is
+	// reached, with limits of its own
+	body := req.Body
+	contentLength := req.ContentLength
+	if body != nil && body != http.NoBody && contentLength < 0 {
+		spooled, n, err := newSpooledBody(body, uwsgiMaxMemBody, uwsgiMaxBody, "")
+		if err != nil {
+			return nil, err
+		}
+		if sb, ok := spooled.(*spooledBody); ok {
+			defer sb.remove()
+		}
+		body = spooled
+		contentLength = n
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	packet, err := uwsgiPacket(req, contentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := t.dialer
+	if dialer == nil {
+		dialer = defaultDialer
+	}
+	conn, err := dialer.DialContext(req.Context(), t.network, t.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// close the connection if the request is canceled
+	// before the response body has been read completely
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-req.Context().Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	closeConn := func() error {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+		return conn.Close()
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		closeConn()
+		return nil, err
+	}
+	if body != nil && contentLength > 0 {
+		if _, err := io.CopyN(conn, body, contentLength); err != nil {
+			closeConn()
+			return nil, err
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		closeConn()
+		return nil, err
+	}
+	resp.Body = &uwsgiBody{ReadCloser: resp.Body, closeConn: closeConn}
+	return resp, nil
+}
+
+// uwsgiBody is a response body which also closes the
+// connection to the application server when closed.
+type uwsgiBody struct {
+	io.ReadCloser
+	closeConn func() error
+}
+
+func (b *uwsgiBody) Close() error {
+	err := b.ReadCloser.Close()
+	if connErr := b.closeConn(); err == nil {
+		err = connErr
+	}
+	return err
+}
+
+// uwsgiPacket encodes the request variables of req as a uwsgi
+// packet: a 4-byte header (modifier1, little-endian datasize,
+// modifier2) followed by length-prefixed key/value pairs.
+func uwsgiPacket(req *http.Request, contentLength int64) ([]byte, error) {
+	var vars bytes.Buffer
+	for _, kv := range uwsgiVars(req, contentLength) {
+		for _, s := range kv {
+			if len(s) > 0xffff {
+				return nil, errors.New("uwsgi: request variable too long")
+			}
+			var size [2]byte
+			binary.LittleEndian.PutUint16(size[:], uint16(len(s)))
+			vars.Write(size[:])
+			vars.WriteString(s)
+		}
+	}
+	if vars.Len() > 0xffff {
+		return nil, errors.New("uwsgi: request variables exceed 64 KiB")
+	}
+
+	packet := make([]byte, 4, 4+vars.Len())
+	packet[0] = 0 // modifier1: WSGI request
+	binary.LittleEndian.PutUint16(packet[1:3], uint16(vars.Len()))
+	packet[3] = 0 // modifier2
+	return append(packet, vars.Bytes()...), nil
+}
+
+// uwsgiVars returns the CGI-style variables describing req,
+// in the order they are to be sent.
+func uwsgiVars(req *http.Request, contentLength int64) [][2]string {
+	serverName, serverPort, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		serverName = req.Host
+		serverPort = "80"
+		if req.TLS != nil {
+			serverPort = "443"
+		}
+	}
+	remoteAddr, remotePort, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteAddr = req.RemoteAddr
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	requestURI := req.URL.RequestURI()
+
+	vars := [][2]string{
+		{"REQUEST_METHOD", req.Method},
+		{"REQUEST_URI", requestURI},
+		{"PATH_INFO", req.URL.Path},
+		{"QUERY_STRING", req.URL.RawQuery},
+		{"SCRIPT_NAME", ""},
+		{"SERVER_NAME", serverName},
+		{"SERVER_PORT", serverPort},
+		{"SERVER_PROTOCOL", req.Proto},
+		{"REMOTE_ADDR", remoteAddr},
+		{"REMOTE_PORT", remotePort},
+		{"UWSGI_SCHEME", scheme},
+		{"CONTENT_TYPE", req.Header.Get("Content-Type")},
+	}
+	if contentLength > 0 {
+		vars = append(vars, [2]string{"CONTENT_LENGTH", strconv.FormatInt(contentLength, 10)})
+	}
+	if req.TLS != nil {
+		vars = append(vars, [2]string{"HTTPS", "on"})
+	}
+	if req.Host != "" {
+		vars = append(vars, [2]string{"HTTP_HOST", req.Host})
+	}
+	for field, values := range req.Header {
+		if field == "Content-Type" || field == "Content-Length" || field == "Host" {
+			continue
+		}
+		// a client could pass Foo_Bar to override the HTTP_FOO_BAR
+		// of Foo-Bar, and HTTP_PROXY is taken for a proxy setting
+		// by many applications (httpoxy)
+		if strings.Contains(field, "_") || field == "Proxy" {
+			continue
+		}
+		key := "HTTP_" + strings.ToUpper(strings.Replace(field, "-", "_", -1))
+		vars = append(vars, [2]string{key, strings.Join(values, ", ")})
+	}
+	return vars
+}
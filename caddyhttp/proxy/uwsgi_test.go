@@ -0,0 +1,206 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveFakeUWSGI accepts uwsgi requests on ln and answers each
+// with the request variables it received and the request body.
+func serveFakeUWSGI(t *testing.T, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			br := bufio.NewReader(conn)
+
+			var header [4]byte
+			if _, err := io.ReadFull(br, header[:]); err != nil {
+				t.Errorf("Reading uwsgi header: %v", err)
+				return
+			}
+			vars := make([]byte, binary.LittleEndian.Uint16(header[1:3]))
+			if _, err := io.ReadFull(br, vars); err != nil {
+				t.Errorf("Reading uwsgi vars: %v", err)
+				return
+			}
+			env := make(map[string]string)
+			for len(vars) > 0 {
+				klen := binary.LittleEndian.Uint16(vars)
+				key := string(vars[2 : 2+klen])
+				vars = vars[2+klen:]
+				vlen := binary.LittleEndian.Uint16(vars)
+				env[key] = string(vars[2 : 2+vlen])
+				vars = vars[2+vlen:]
+			}
+			n, _ := strconv.Atoi(env["CONTENT_LENGTH"])
+			body := make([]byte, n)
+			if _, err := io.ReadFull(br, body); err != nil {
+				t.Errorf("Reading uwsgi body: %v", err)
+				return
+			}
+
+			fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n")
+			for _, key := range []string{"REQUEST_METHOD", "PATH_INFO", "QUERY_STRING", "HTTP_X_TEST"} {
+				fmt.Fprintf(conn, "%s=%s\n", key, env[key])
+			}
+			fmt.Fprintf(conn, "body=%s\n", body)
+		}(conn)
+	}
+}
+
+func TestUWSGIProxy(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddy_uwsgi_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	socketPath := filepath.Join(tmpdir, "uwsgi.sock")
+
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer tcpLn.Close()
+	go serveFakeUWSGI(t, tcpLn)
+
+	unixLn, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer unixLn.Close()
+	go serveFakeUWSGI(t, unixLn)
+
+	for i, upstream := range []string{
+		"uwsgi://" + tcpLn.Addr().String(),
+		"uwsgi+unix:" + socketPath,
+	} {
+		p := &Proxy{
+			Next:      nil, // Unused in this test
+			Upstreams: []Upstream{newFakeUpstream(upstream, false, 30*time.Second, 300*time.Millisecond)},
+		}
+
+		r := httptest.NewRequest("POST", "/app/path?foo=bar", strings.NewReader("hello"))
+		r.Header.Set("X-Test", "yes")
+		w := httptest.NewRecorder()
+
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error proxying to %s, got: %v", i, upstream, err)
+		}
+		expected := "REQUEST_METHOD=POST\nPATH_INFO=/app/path\nQUERY_STRING=foo=bar\nHTTP_X_TEST=yes\nbody=hello\n"
+		if got := w.Body.String(); got != expected {
+			t.Errorf("Test %d: Expected response body %q, got %q", i, expected, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("Test %d: Expected Content-Type text/plain, got %q", i, got)
+		}
+	}
+}
+
+func TestUWSGIProxyChunked(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+	go serveFakeUWSGI(t, ln)
+
+	defer func(mem, max int64) {
+		uwsgiMaxMemBody, uwsgiMaxBody = mem, max
+	}(uwsgiMaxMemBody, uwsgiMaxBody)
+	uwsgiMaxMemBody, uwsgiMaxBody = 2, 8
+
+	p := &Proxy{
+		Next:      nil, // Unused in this test
+		Upstreams: []Upstream{newFakeUpstream("uwsgi://"+ln.Addr().String(), false, 30*time.Second, 300*time.Millisecond)},
+	}
+	for i, test := range []struct {
+		body           string
+		expectedStatus int
+	}{
+		{"hello", 0},
+		{"longer than the limit", http.StatusRequestEntityTooLarge},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+
+		status, _ := p.ServeHTTP(w, r)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if test.expectedStatus == 0 && !strings.Contains(w.Body.String(), "body="+test.body+"\n") {
+			t.Errorf("Test %d: Expected body %q to reach the application, got %q", i, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestUWSGIPacket(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	r.URL, _ = url.Parse("/")
+	packet, err := uwsgiPacket(r, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if packet[0] != 0 || packet[3] != 0 {
+		t.Errorf("Expected modifiers to be 0, got %d and %d", packet[0], packet[3])
+	}
+	if size := int(binary.LittleEndian.Uint16(packet[1:3])); size != len(packet)-4 {
+		t.Errorf("Expected datasize %d, got %d", len(packet)-4, size)
+	}
+
+	r.Header.Set("X-Huge", strings.Repeat("a", 70000))
+	if _, err := uwsgiPacket(r, 0); err == nil {
+		t.Error("Expected error for oversized request variables, got none")
+	}
+}
+
+func TestUWSGIVarsHeaders(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	r.Header["Foo-Bar"] = []string{"dash"}
+	r.Header["Foo_bar"] = []string{"underscore"}
+	r.Header.Set("Proxy", "http://attacker.example:8080")
+
+	vars := make(map[string][]string)
+	for _, kv := range uwsgiVars(r, 0) {
+		vars[kv[0]] = append(vars[kv[0]], kv[1])
+	}
+	if got := vars["HTTP_FOO_BAR"]; len(got) != 1 || got[0] != "dash" {
+		t.Errorf("Expected HTTP_FOO_BAR to be only 'dash', got %v", got)
+	}
+	if got, ok := vars["HTTP_PROXY"]; ok {
+		t.Errorf("Expected no HTTP_PROXY, got %v", got)
+	}
+}
+
+var _ http.RoundTripper = (*uwsgiTransport)(nil)
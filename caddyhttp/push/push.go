@@ -40,6 +40,9 @@ type (
 		Rules      []Rule
 		Root       http.FileSystem
 		indexPages []string // will be injected from SiteConfig on setup
+
+		// index pages of paths, also injected from SiteConfig
+		pathIndexPages map[string][]string
 	}
 
 	ruleOp func([]Resource)
@@ -28,6 +28,7 @@ func init() {
 	caddy.RegisterPlugin("push", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -50,7 +51,8 @@ func setup(c *caddy.Controller) error {
 
 	cfg := httpserver.GetConfig(c)
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Middleware{Next: next, Rules: rules, Root: http.Dir(cfg.Root), indexPages: cfg.IndexPages}
+		return Middleware{Next: next, Rules: rules, Root: cfg.SiteFileSystem(),
+			indexPages: cfg.IndexPages, pathIndexPages: cfg.PathIndexPages}
 	})
 
 	return nil
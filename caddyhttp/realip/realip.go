@@ -0,0 +1,104 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package realip provides middleware that takes the client IP
+// address from a header set by a trusted proxy, so that logs and
+// everything else keyed on the client IP see the real client.
+//
+// Connections accepted through the PROXY protocol already carry
+// the client address and need no further handling here.
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RealIP is middleware that replaces the remote address of
+// requests from trusted proxies with the client address
+// they report.
+type RealIP struct {
+	Next httpserver.Handler
+
+	// From are the networks of the trusted proxies.
+	From []*net.IPNet
+
+	// Header is the request header that holds the client
+	// address, like X-Forwarded-For or X-Real-IP. It may be
+	// a comma-separated list with the nearest proxy last.
+	Header string
+
+	// Strict makes requests from trusted proxies whose header
+	// has no valid address fail instead of passing unchanged.
+	Strict bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (rip RealIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host, port = r.RemoteAddr, ""
+	}
+	if ip := net.ParseIP(host); ip == nil || !rip.trusted(ip) {
+		return rip.Next.ServeHTTP(w, r)
+	}
+
+	client := rip.clientIP(r.Header[http.CanonicalHeaderKey(rip.Header)])
+	if client == nil {
+		if rip.Strict {
+			return http.StatusForbidden, nil
+		}
+		return rip.Next.ServeHTTP(w, r)
+	}
+
+	if port == "" {
+		r.RemoteAddr = client.String()
+	} else {
+		r.RemoteAddr = net.JoinHostPort(client.String(), port)
+	}
+	return rip.Next.ServeHTTP(w, r)
+}
+
+// clientIP returns the address of the client that reached the
+// nearest trusted proxy: the last address in values, skipping
+// those of other trusted proxies. Addresses before it could have
+// been made up by the client, so they are not honored.
+func (rip RealIP) clientIP(values []string) net.IP {
+	var addrs []string
+	for _, v := range values {
+		addrs = append(addrs, strings.Split(v, ",")...)
+	}
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+		if ip == nil {
+			return nil
+		}
+		if i == 0 || !rip.trusted(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+func (rip RealIP) trusted(ip net.IP) bool {
+	for _, network := range rip.From {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
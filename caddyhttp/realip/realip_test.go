@@ -0,0 +1,78 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for i, test := range []struct {
+		remoteAddr     string
+		header         []string
+		strict         bool
+		expectedAddr   string
+		expectedStatus int
+	}{
+		// untrusted peers can't set their address
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, false, "192.0.2.1:1234", 0},
+		// trusted proxies can
+		{"10.0.0.1:1234", []string{"198.51.100.7"}, false, "198.51.100.7:1234", 0},
+		// the address nearest to the proxy that isn't another proxy wins;
+		// the ones before it could have been sent by the client
+		{"10.0.0.1:1234", []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, false, "198.51.100.7:1234", 0},
+		{"10.0.0.1:1234", []string{"203.0.113.9", "198.51.100.7"}, false, "198.51.100.7:1234", 0},
+		// only proxies: the first one is the client
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, false, "10.0.0.3:1234", 0},
+		{"10.0.0.1:1234", []string{"2001:db8::1"}, false, "[2001:db8::1]:1234", 0},
+		// missing or invalid addresses
+		{"10.0.0.1:1234", nil, false, "10.0.0.1:1234", 0},
+		{"10.0.0.1:1234", []string{"unknown"}, false, "10.0.0.1:1234", 0},
+		{"10.0.0.1:1234", []string{"unknown"}, true, "", http.StatusForbidden},
+	} {
+		var gotAddr string
+		rip := RealIP{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				gotAddr = r.RemoteAddr
+				return 0, nil
+			}),
+			From:   []*net.IPNet{proxies},
+			Header: "X-Forwarded-For",
+			Strict: test.strict,
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header["X-Forwarded-For"] = test.header
+
+		status, err := rip.ServeHTTP(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if gotAddr != test.expectedAddr {
+			t.Errorf("Test %d: Expected remote address %s, got %s", i, test.expectedAddr, gotAddr)
+		}
+	}
+}
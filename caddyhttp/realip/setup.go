@@ -0,0 +1,112 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("realip", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// DefaultHeader is the header the client address is taken from.
+const DefaultHeader = "X-Forwarded-For"
+
+// setup configures a new RealIP middleware instance.
+func setup(c *caddy.Controller) error {
+	rip, err := realIPParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		rip.Next = next
+		return rip
+	})
+
+	return nil
+}
+
+func realIPParse(c *caddy.Controller) (RealIP, error) {
+	rip := RealIP{Header: DefaultHeader}
+
+	for c.Next() {
+		if err := addNetworks(&rip, c.RemainingArgs()); err != nil {
+			return rip, c.Err(err.Error())
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "from":
+				if len(args) == 0 {
+					return rip, c.ArgErr()
+				}
+				if err := addNetworks(&rip, args); err != nil {
+					return rip, c.Err(err.Error())
+				}
+			case "header":
+				if len(args) != 1 {
+					return rip, c.ArgErr()
+				}
+				rip.Header = args[0]
+			case "strict":
+				if len(args) != 0 {
+					return rip, c.ArgErr()
+				}
+				rip.Strict = true
+			default:
+				return rip, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+	}
+
+	if len(rip.From) == 0 {
+		return rip, c.Err("realip needs at least one trusted network")
+	}
+
+	return rip, nil
+}
+
+// addNetworks adds the CIDRs (or single addresses) in
+// args to the trusted networks of rip.
+func addNetworks(rip *RealIP, args []string) error {
+	for _, arg := range args {
+		if !strings.Contains(arg, "/") {
+			if ip := net.ParseIP(arg); ip != nil && ip.To4() != nil {
+				arg += "/32"
+			} else {
+				arg += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(arg)
+		if err != nil {
+			return err
+		}
+		rip.From = append(rip.From, network)
+	}
+	return nil
+}
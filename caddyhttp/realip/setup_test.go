@@ -0,0 +1,102 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realip
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `realip 10.0.0.0/8`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(RealIP)
+	if !ok {
+		t.Fatalf("Expected handler to be type RealIP, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestRealIPParse(t *testing.T) {
+	tests := []struct {
+		input          string
+		shouldErr      bool
+		expectedFrom   []string
+		expectedHeader string
+		expectedStrict bool
+	}{
+		{`realip 10.0.0.0/8 192.168.1.1`, false, []string{"10.0.0.0/8", "192.168.1.1/32"}, DefaultHeader, false},
+		{`realip {
+			from 173.245.48.0/20 2400:cb00::/32
+			from ::1
+			header X-Real-IP
+			strict
+		}`, false, []string{"173.245.48.0/20", "2400:cb00::/32", "::1/128"}, "X-Real-IP", true},
+		{`realip`, true, nil, "", false},
+		{`realip 10.0.0.0/33`, true, nil, "", false},
+		{`realip {
+			from
+		}`, true, nil, "", false},
+		{`realip 10.0.0.0/8 {
+			header
+		}`, true, nil, "", false},
+		{`realip 10.0.0.0/8 {
+			strict yes
+		}`, true, nil, "", false},
+		{`realip 10.0.0.0/8 {
+			recursive
+		}`, true, nil, "", false},
+	}
+	for i, test := range tests {
+		rip, err := realIPParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(rip.From) != len(test.expectedFrom) {
+			t.Fatalf("Test %d: Expected %d networks, got %d", i, len(test.expectedFrom), len(rip.From))
+		}
+		for j, network := range rip.From {
+			if network.String() != test.expectedFrom[j] {
+				t.Errorf("Test %d: Expected network %s, got %s", i, test.expectedFrom[j], network)
+			}
+		}
+		if rip.Header != test.expectedHeader {
+			t.Errorf("Test %d: Expected header %s, got %s", i, test.expectedHeader, rip.Header)
+		}
+		if rip.Strict != test.expectedStrict {
+			t.Errorf("Test %d: Expected strict %v, got %v", i, test.expectedStrict, rip.Strict)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redirect
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mapCheckInterval is how often, at most, a map file is
+// checked for changes.
+const mapCheckInterval = 5 * time.Second
+
+// Map is a table of redirects loaded from a CSV or TSV file,
+// for when there are too many to list in the Caddyfile. Each
+// record is a from path, a to URL and optionally a code. The
+// file is reloaded when it changes.
+type Map struct {
+	File string
+	Code int
+
+	mu       sync.RWMutex
+	targets  map[string]mapTarget
+	modTime  time.Time
+	checked  time.Time
+	checking bool
+}
+
+type mapTarget struct {
+	to   string
+	code int
+}
+
+// NewMap loads the redirect map in file. Redirects without
+// a code of their own use code.
+func NewMap(file string, code int) (*Map, error) {
+	m := &Map{File: file, Code: code}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Lookup returns the target and code of the redirect
+// from path, if there is one.
+func (m *Map) Lookup(path string) (to string, code int, ok bool) {
+	m.reloadIfChanged()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.targets[path]
+	if !ok && len(path) > 1 && strings.HasSuffix(path, "/") {
+		t, ok = m.targets[strings.TrimSuffix(path, "/")]
+	}
+	return t.to, t.code, ok
+}
+
+// reloadIfChanged reloads the file if it was modified. Only
+// one request at a time does the check, while the others
+// keep using the current table.
+func (m *Map) reloadIfChanged() {
+	m.mu.Lock()
+	if m.checking || time.Since(m.checked) < mapCheckInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.checking = true
+	m.mu.Unlock()
+
+	info, err := os.Stat(m.File)
+	if err == nil && !info.ModTime().Equal(m.modTimeLocked()) {
+		if err := m.load(); err != nil {
+			log.Printf("[ERROR] Reloading redirect map: %v", err)
+		}
+	}
+
+	m.mu.Lock()
+	m.checking = false
+	m.checked = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *Map) modTimeLocked() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.modTime
+}
+
+// load reads the file into a new table and swaps it in.
+func (m *Map) load() error {
+	f, err := os.Open(m.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if !strings.HasSuffix(strings.ToLower(m.File), ".csv") {
+		r.Comma = '\t'
+	}
+
+	targets := make(map[string]mapTarget)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", m.File, err)
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return fmt.Errorf("%s: expected from, to and optionally a code, got %q", m.File, record)
+		}
+		t := mapTarget{to: record[1], code: m.Code}
+		if len(record) == 3 {
+			code, ok := httpRedirs[strings.TrimSpace(record[2])]
+			if !ok {
+				return fmt.Errorf("%s: invalid redirect code '%s' for %s", m.File, record[2], record[0])
+			}
+			t.code = code
+		}
+		targets[strings.TrimSpace(record[0])] = t
+	}
+
+	m.mu.Lock()
+	m.targets = targets
+	m.modTime = info.ModTime()
+	m.mu.Unlock()
+	return nil
+}
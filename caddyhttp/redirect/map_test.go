@@ -0,0 +1,159 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redirect
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_redirmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tsv := filepath.Join(dir, "legacy.tsv")
+	if err := ioutil.WriteFile(tsv, []byte("# legacy URLs\n/old\t/new\n/gone\thttps://example.com/{path}\t302\n/dir\t/folder\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMap(tsv, http.StatusMovedPermanently)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		path, to string
+		code     int
+		ok       bool
+	}{
+		{"/old", "/new", 301, true},
+		{"/gone", "https://example.com/{path}", 302, true},
+		{"/dir/", "/folder", 301, true},
+		{"/", "", 0, false},
+		{"/other", "", 0, false},
+	} {
+		to, code, ok := m.Lookup(test.path)
+		if to != test.to || code != test.code || ok != test.ok {
+			t.Errorf("Test %d: Expected %s %d %v for %s, got %s %d %v", i, test.to, test.code, test.ok, test.path, to, code, ok)
+		}
+	}
+
+	// changes are picked up after the check interval,
+	// and a broken file leaves the table alone
+	newModTime := time.Now().Add(time.Minute)
+	if err := ioutil.WriteFile(tsv, []byte("/old\t/newer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(tsv, newModTime, newModTime)
+	if to, _, _ := m.Lookup("/old"); to != "/new" {
+		t.Errorf("Expected the table to be kept within the check interval, got %s", to)
+	}
+	m.checked = time.Time{}
+	if to, _, _ := m.Lookup("/old"); to != "/newer" {
+		t.Errorf("Expected the table to be reloaded, got %s", to)
+	}
+	if _, _, ok := m.Lookup("/gone"); ok {
+		t.Error("Expected removed redirects to be gone")
+	}
+	if err := ioutil.WriteFile(tsv, []byte("/old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(tsv, newModTime.Add(time.Minute), newModTime.Add(time.Minute))
+	m.checked = time.Time{}
+	if to, _, _ := m.Lookup("/old"); to != "/newer" {
+		t.Errorf("Expected a broken file to be ignored, got %s", to)
+	}
+
+	csvFile := filepath.Join(dir, "legacy.csv")
+	if err := ioutil.WriteFile(csvFile, []byte("/a,/b\n\"/with,comma\",/c,308\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewMap(csvFile, http.StatusFound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to, code, _ := m.Lookup("/with,comma"); to != "/c" || code != 308 {
+		t.Errorf("Expected CSV to be parsed, got %s %d", to, code)
+	}
+
+	for i, content := range []string{"/a\n", "/a\t/b\t999\n", "/a\t/b\t301\textra\n"} {
+		if err := ioutil.WriteFile(tsv, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewMap(tsv, http.StatusFound); err == nil {
+			t.Errorf("Test %d: Expected an error for '%s'", i, content)
+		}
+	}
+}
+
+func TestRedirectMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_redirmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "map.tsv")
+	if err := ioutil.WriteFile(file, []byte("/old\t/new\n/temp\t/elsewhere\t307\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("http", "redir 302 {\n map "+file+" \n /catch /all \n}")
+	rules, err := redirParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 2 || rules[0].Map == nil || rules[0].Map.Code != http.StatusFound {
+		t.Fatalf("Expected a map rule with code 302 and a plain rule, got %#v", rules)
+	}
+
+	rd := Redirect{Next: httpserver.EmptyNext, Rules: rules}
+	for i, test := range []struct {
+		path, location string
+		code           int
+	}{
+		{"/old", "/new", 302},
+		{"/temp", "/elsewhere", 307},
+		{"/catch", "/all", 302},
+		{"/other", "", 200},
+	} {
+		w := httptest.NewRecorder()
+		rd.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("Test %d: Expected %d to '%s', got %d to '%s'", i, test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	for i, input := range []string{
+		"redir {\n map \n}",
+		"redir {\n map " + file + " 999 \n}",
+		"redir {\n map " + filepath.Join(dir, "missing.tsv") + " \n}",
+	} {
+		if _, err := redirParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		} else if i == 2 && !strings.Contains(err.Error(), "missing.tsv") {
+			t.Errorf("Test %d: Expected the error to name the file, got %v", i, err)
+		}
+	}
+}
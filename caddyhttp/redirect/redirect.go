@@ -33,6 +33,13 @@ type Redirect struct {
 // ServeHTTP implements the httpserver.Handler interface.
 func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, rule := range rd.Rules {
+		if rule.Map != nil {
+			if to, code, ok := rule.Map.Lookup(r.URL.Path); ok && schemeMatches(rule, r) && rule.Match(r) {
+				http.Redirect(w, r, httpserver.NewReplacer(r, nil, "").Replace(to), code)
+				return 0, nil
+			}
+			continue
+		}
 		if (rule.FromPath == "/" || r.URL.Path == rule.FromPath) && schemeMatches(rule, r) && rule.Match(r) {
 			to := httpserver.NewReplacer(r, nil, "").Replace(rule.To)
 			if rule.Meta {
@@ -58,6 +65,11 @@ type Rule struct {
 	FromPath, To string
 	Code         int
 	Meta         bool
+
+	// Map, if not nil, holds the redirects of this rule
+	// instead of FromPath and To.
+	Map *Map
+
 	httpserver.RequestMatcher
 }
 
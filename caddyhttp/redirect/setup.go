@@ -25,6 +25,7 @@ func init() {
 	caddy.RegisterPlugin("redir", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -141,6 +142,15 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 				defaultCode = args[0]
 			}
 
+			// a map loads many redirects from a file
+			if c.Val() == "map" {
+				if err := initMapRule(c, &rule, defaultCode); err != nil {
+					return redirects, err
+				}
+				redirects = append(redirects, rule)
+				continue
+			}
+
 			// RemainingArgs only gets the values after the current token, but in our
 			// case we want to include the current token to get an accurate count.
 			insideArgs := append([]string{c.Val()}, c.RemainingArgs()...)
@@ -174,6 +184,35 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 	return redirects, nil
 }
 
+// initMapRule sets up rule with the map in the file given
+// as argument, optionally followed by a default code.
+func initMapRule(c *caddy.Controller, rule *Rule, defaultCode string) error {
+	args := c.RemainingArgs()
+	if len(args) == 0 || len(args) > 2 {
+		return c.ArgErr()
+	}
+	if len(args) == 2 {
+		defaultCode = args[1]
+	}
+	code, ok := httpRedirs[defaultCode]
+	if !ok {
+		return c.Errf("Invalid redirect code '%v'", defaultCode)
+	}
+	m, err := NewMap(args[0], code)
+	if err != nil {
+		return c.Errf("Loading redirect map: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	rule.FromScheme = func() string {
+		if cfg.TLS.Enabled {
+			return "https"
+		}
+		return "http"
+	}
+	rule.Map = m
+	return nil
+}
+
 // httpRedirs is a list of supported HTTP redirect codes.
 var httpRedirs = map[string]int{
 	"300": http.StatusMultipleChoices,
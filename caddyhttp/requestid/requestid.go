@@ -23,6 +23,10 @@ import (
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
+// DefaultHeaderName is the request header the ID is forwarded
+// upstream in, unless a header to read it from is configured.
+const DefaultHeaderName = "X-Request-ID"
+
 // Handler is a middleware handler
 type Handler struct {
 	Next       httpserver.Handler
@@ -50,5 +54,14 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	c := context.WithValue(r.Context(), httpserver.RequestIDCtxKey, reqid.String())
 	r = r.WithContext(c)
 
+	// forward it in the request headers, so that proxied and
+	// FastCGI applications see the same ID as the logs; this
+	// also replaces any untrusted ID sent by the client
+	headerName := h.HeaderName
+	if headerName == "" {
+		headerName = DefaultHeaderName
+	}
+	r.Header.Set(headerName, reqid.String())
+
 	return h.Next.ServeHTTP(w, r)
 }
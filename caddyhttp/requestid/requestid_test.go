@@ -30,6 +30,9 @@ func TestRequestIDHandler(t *testing.T) {
 			if value == "" {
 				t.Error("Request ID should not be empty")
 			}
+			if forwarded := r.Header.Get(DefaultHeaderName); forwarded != value {
+				t.Errorf("Request ID should be forwarded in %s as '%s' but got '%s'", DefaultHeaderName, value, forwarded)
+			}
 			return 0, nil
 		}),
 	}
@@ -38,6 +41,8 @@ func TestRequestIDHandler(t *testing.T) {
 	if err != nil {
 		t.Fatal("Could not create HTTP request:", err)
 	}
+	// without a trusted header, a client's ID is replaced
+	req.Header.Set(DefaultHeaderName, "spoofed")
 	rec := httptest.NewRecorder()
 
 	if _, err := handler.ServeHTTP(rec, req); err != nil {
@@ -0,0 +1,98 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package respond is middleware for answering requests with
+// responses written inline in the Caddyfile.
+package respond
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Rule describes a static response.
+type Rule struct {
+	// Base path. Requests to this path and sub-paths will be answered with the response
+	Base string
+
+	// Status code of the response
+	StatusCode int
+
+	// Body of the response, which may have placeholders
+	Body string
+
+	// Content-Type of the response
+	ContentType string
+
+	// Request matcher
+	httpserver.RequestMatcher
+}
+
+// NewRule creates new Rule.
+func NewRule(basePath string) *Rule {
+	return &Rule{
+		Base:           basePath,
+		StatusCode:     http.StatusOK,
+		RequestMatcher: httpserver.PathMatcher(basePath),
+	}
+}
+
+// BasePath implements httpserver.HandlerConfig interface
+func (rule *Rule) BasePath() string {
+	return rule.Base
+}
+
+// Respond is a middleware to answer requests with static responses
+type Respond struct {
+	Rules []httpserver.HandlerConfig
+	Next  httpserver.Handler
+}
+
+// ServeHTTP implements the httpserver.Handler interface
+func (respond Respond) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := httpserver.ConfigSelector(respond.Rules).Select(r)
+	if cfg == nil {
+		return respond.Next.ServeHTTP(w, r)
+	}
+	rule := cfg.(*Rule)
+
+	body := rule.Body
+	if body != "" {
+		body = httpserver.NewReplacer(r, nil, "").Replace(body)
+		contentType := rule.ContentType
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+	} else if rule.ContentType != "" {
+		w.Header().Set("Content-Type", rule.ContentType)
+	}
+	// some status codes do not allow a body at all
+	noBody := rule.StatusCode < 200 ||
+		rule.StatusCode == http.StatusNoContent ||
+		rule.StatusCode == http.StatusNotModified
+	if !noBody {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(rule.StatusCode)
+
+	if !noBody && r.Method != http.MethodHead {
+		if _, err := w.Write([]byte(body)); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
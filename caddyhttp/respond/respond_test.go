@@ -0,0 +1,80 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRespond(t *testing.T) {
+	robots := NewRule("/robots.txt")
+	robots.Body = "User-agent: *\nDisallow: /"
+
+	maintenance := NewRule("/")
+	maintenance.StatusCode = http.StatusServiceUnavailable
+	maintenance.Body = "{host} is down for maintenance"
+	maintenance.ContentType = "text/html"
+
+	empty := NewRule("/.well-known/empty")
+	empty.StatusCode = http.StatusNoContent
+	empty.Body = "ignored"
+
+	for i, test := range []struct {
+		rules        []httpserver.HandlerConfig
+		method       string
+		path         string
+		expectStatus int
+		expectBody   string
+		expectType   string
+	}{
+		{[]httpserver.HandlerConfig{robots}, "GET", "/robots.txt", http.StatusOK, "User-agent: *\nDisallow: /", "text/plain; charset=utf-8"},
+		{[]httpserver.HandlerConfig{robots}, "HEAD", "/robots.txt", http.StatusOK, "", "text/plain; charset=utf-8"},
+		{[]httpserver.HandlerConfig{robots}, "GET", "/index.html", http.StatusOK, "/index.html", "text/plain; charset=utf-8"},
+		{[]httpserver.HandlerConfig{robots, maintenance}, "GET", "/robots.txt", http.StatusOK, "User-agent: *\nDisallow: /", "text/plain; charset=utf-8"},
+		{[]httpserver.HandlerConfig{robots, maintenance}, "GET", "/index.html", http.StatusServiceUnavailable, "example.com is down for maintenance", "text/html"},
+		{[]httpserver.HandlerConfig{empty}, "GET", "/.well-known/empty", http.StatusNoContent, "", "text/plain; charset=utf-8"},
+	} {
+		respond := Respond{Rules: test.rules, Next: httpserver.HandlerFunc(urlPrinter)}
+
+		req, err := http.NewRequest(test.method, "http://example.com"+test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		rec := httptest.NewRecorder()
+		if _, err := respond.ServeHTTP(rec, req); err != nil {
+			t.Fatalf("Test %d: Serving request failed with error %v", i, err)
+		}
+
+		if rec.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status code %d, got %d", i, test.expectStatus, rec.Code)
+		}
+		if rec.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != test.expectType {
+			t.Errorf("Test %d: Expected Content-Type '%s', got '%s'", i, test.expectType, got)
+		}
+	}
+}
+
+func urlPrinter(w http.ResponseWriter, r *http.Request) (int, error) {
+	fmt.Fprint(w, r.URL.Path)
+	return 0, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// init registers Respond plugin
+func init() {
+	caddy.RegisterPlugin("respond", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures new Respond middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := respondParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	mid := func(next httpserver.Handler) httpserver.Handler {
+		return Respond{Rules: rules, Next: next}
+	}
+	cfg.AddMiddleware(mid)
+
+	return nil
+}
+
+// respondParse parses respond directive:
+//
+//	respond <path> [<body> [<status>]] {
+//		status <code>
+//		type   <content-type>
+//		body   <body>
+//	}
+func respondParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 3 {
+			return rules, c.ArgErr()
+		}
+
+		basePath := args[0]
+		for _, cfg := range rules {
+			rule := cfg.(*Rule)
+			if rule.Base == basePath {
+				return rules, c.Errf("Duplicate path: '%s'", basePath)
+			}
+		}
+
+		rule := NewRule(basePath)
+		if len(args) > 1 {
+			rule.Body = args[1]
+		}
+		if len(args) > 2 {
+			status, err := parseStatus(c, args[2])
+			if err != nil {
+				return rules, err
+			}
+			rule.StatusCode = status
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return rules, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return rules, c.ArgErr()
+			}
+
+			switch what {
+			case "status":
+				status, err := parseStatus(c, val)
+				if err != nil {
+					return rules, err
+				}
+				rule.StatusCode = status
+			case "type":
+				rule.ContentType = val
+			case "body":
+				rule.Body = val
+			default:
+				return rules, c.Errf("Unknown respond property '%s'", what)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseStatus(c *caddy.Controller, val string) (int, error) {
+	status, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, c.Errf("Expecting a numeric status code, got '%s'", val)
+	}
+	if status < 100 || status > 999 {
+		return 0, c.Errf("Status code out of range: %d", status)
+	}
+	return status, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `respond /robots.txt "User-agent: *"`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Respond)
+	if !ok {
+		t.Fatalf("Expected handler to be type Respond, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	if len(myHandler.Rules) != 1 {
+		t.Errorf("Expected handler to have %d rule, has %d instead", 1, len(myHandler.Rules))
+	}
+}
+
+func TestRespondParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`respond`, true, nil},
+		{`respond /foo`, false, []Rule{
+			{Base: "/foo", StatusCode: 200},
+		}},
+		{`respond /foo "hello there"`, false, []Rule{
+			{Base: "/foo", StatusCode: 200, Body: "hello there"},
+		}},
+		{`respond /foo gone 410`, false, []Rule{
+			{Base: "/foo", StatusCode: 410, Body: "gone"},
+		}},
+		{`respond /foo gone abc`, true, nil},
+		{`respond /foo gone 42`, true, nil},
+		{`respond /foo gone 410 extra`, true, nil},
+		{`respond / {
+			status 503
+			type text/html
+			body "<h1>Back soon</h1>"
+		}`, false, []Rule{
+			{Base: "/", StatusCode: 503, Body: "<h1>Back soon</h1>", ContentType: "text/html"},
+		}},
+		{`respond / {
+			status
+		}`, true, nil},
+		{`respond / {
+			type text/html text/plain
+		}`, true, nil},
+		{`respond / {
+			color blue
+		}`, true, nil},
+		{`respond /foo a
+		respond /bar b`, false, []Rule{
+			{Base: "/foo", StatusCode: 200, Body: "a"},
+			{Base: "/bar", StatusCode: 200, Body: "b"},
+		}},
+		{`respond /foo a
+		respond /foo b`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := respondParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+			continue
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d rules, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, expected := range test.expected {
+			rule := actual[j].(*Rule)
+			if rule.Base != expected.Base || rule.StatusCode != expected.StatusCode ||
+				rule.Body != expected.Body || rule.ContentType != expected.ContentType {
+				t.Errorf("Test %d, rule %d: expected %+v, got %+v", i, j, expected, *rule)
+			}
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -70,7 +71,7 @@ type SimpleRule struct {
 
 // NewSimpleRule creates a new Simple Rule
 func NewSimpleRule(from, to string, negate bool) (*SimpleRule, error) {
-	r, err := regexp.Compile(from)
+	r, err := caddy.CompileRegexp(from)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +125,7 @@ func NewComplexRule(base, pattern, to string, ext []string, matcher httpserver.R
 	var r *regexp.Regexp
 	if pattern != "" {
 		var err error
-		r, err = regexp.Compile(pattern)
+		r, err = caddy.CompileRegexp(pattern)
 		if err != nil {
 			return ComplexRule{}, err
 		}
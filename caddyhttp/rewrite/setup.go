@@ -15,7 +15,6 @@
 package rewrite
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -26,6 +25,7 @@ func init() {
 	caddy.RegisterPlugin("rewrite", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -41,7 +41,7 @@ func setup(c *caddy.Controller) error {
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return Rewrite{
 			Next:    next,
-			FileSys: http.Dir(cfg.Root),
+			FileSys: cfg.SiteFileSystem(),
 			Rules:   rewrites,
 		}
 	})
@@ -0,0 +1,118 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("try_files", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupTryFiles,
+		Concurrent: true,
+	})
+}
+
+// setupTryFiles configures a Rewrite middleware that rewrites
+// requests to the first of a list of candidate paths that
+// exists, or to the last candidate if none do. It is mostly
+// sugar for rewrite's "to", which behaves the same way.
+func setupTryFiles(c *caddy.Controller) error {
+	rules, err := tryFilesParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Rewrite{
+			Next:    next,
+			FileSys: cfg.SiteFileSystem(),
+			Rules:   rules,
+		}
+	})
+
+	return nil
+}
+
+func tryFilesParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		base := "/"
+		var except exceptMatcher
+
+		candidates := c.RemainingArgs()
+		if len(candidates) == 0 {
+			return nil, c.ArgErr()
+		}
+
+		// Integrate request matcher for 'if' conditions.
+		matcher, err := httpserver.SetupIfMatcher(c)
+		if err != nil {
+			return nil, err
+		}
+
+		for c.NextBlock() {
+			if httpserver.IfMatcherKeyword(c) {
+				continue
+			}
+			switch c.Val() {
+			case "base":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				base = c.Val()
+			case "except":
+				paths := c.RemainingArgs()
+				if len(paths) == 0 {
+					return nil, c.ArgErr()
+				}
+				except = append(except, paths...)
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+
+		rule, err := NewComplexRule(base, "", strings.Join(candidates, " "), nil,
+			httpserver.MergeRequestMatchers(matcher, except))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// exceptMatcher matches requests whose path is not
+// under any of its base paths.
+type exceptMatcher []string
+
+// Match satisfies httpserver.RequestMatcher.
+func (e exceptMatcher) Match(r *http.Request) bool {
+	for _, p := range e {
+		if httpserver.Path(r.URL.Path).Matches(p) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTryFilesSetup(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		numRules  int
+	}{
+		{`try_files {path} /index.html`, false, 1},
+		{`try_files {path} {path}/ /index.html {
+			base /app
+			except /app/api /app/static
+		}`, false, 1},
+		{`try_files {path} /index.html
+		  try_files {path} /other.html`, false, 2},
+		{`try_files`, true, 0},
+		{`try_files {path} {
+			base
+		}`, true, 0},
+		{`try_files {path} {
+			except
+		}`, true, 0},
+		{`try_files {path} {
+			unknown
+		}`, true, 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupTryFiles(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		mids := httpserver.GetConfig(c).Middleware()
+		if len(mids) != 1 {
+			t.Fatalf("Test %d: Expected 1 middleware, got %d", i, len(mids))
+		}
+		handler, ok := mids[0](httpserver.EmptyNext).(Rewrite)
+		if !ok {
+			t.Fatalf("Test %d: Expected handler to be type Rewrite", i)
+		}
+		if len(handler.Rules) != test.numRules {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, test.numRules, len(handler.Rules))
+		}
+	}
+}
+
+func TestTryFiles(t *testing.T) {
+	c := caddy.NewTestController("http", `try_files {path} {path}/ /index.html {
+		except /api
+	}`)
+	rules, err := tryFilesParse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := Rewrite{
+		Next:    httpserver.HandlerFunc(urlPrinter),
+		Rules:   rules,
+		FileSys: http.Dir("testdata"),
+	}
+
+	for i, test := range []struct {
+		url, expectedTo string
+	}{
+		{"/testfile", "/testfile"},
+		{"/testdir", "/testdir/"},
+		{"/some/app/route", "/index.html"},
+		{"/api/users", "/api/users"},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		ctx := context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL)
+		req = req.WithContext(ctx)
+
+		rec := httptest.NewRecorder()
+		rw.ServeHTTP(rec, req)
+
+		if got := rec.Body.String(); got != test.expectedTo {
+			t.Errorf("Test %d: Expected URL to be %q but was %q", i, test.expectedTo, got)
+		}
+	}
+}
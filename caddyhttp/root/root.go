@@ -15,8 +15,10 @@
 package root
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -33,34 +35,61 @@ func setupRoot(c *caddy.Controller) error {
 	config := httpserver.GetConfig(c)
 
 	for c.Next() {
-		if !c.NextArg() {
-			return c.ArgErr()
-		}
-		config.Root = c.Val()
-		if c.NextArg() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
 			// only one argument allowed
 			return c.ArgErr()
 		}
+		config.Root = args[0]
+
+		// roots for requests to specific paths
+		for c.NextBlock() {
+			basePath := c.Val()
+			args := c.RemainingArgs()
+			if len(args) != 1 || !strings.HasPrefix(basePath, "/") {
+				return c.ArgErr()
+			}
+			for _, pr := range config.PathRoots {
+				if pr.Path == basePath {
+					return c.Errf("duplicate root for path %s", basePath)
+				}
+			}
+			config.PathRoots = append(config.PathRoots, httpserver.PathRoot{Path: basePath, Root: args[0]})
+		}
+	}
+
+	if err := checkRoot(config.Root); err != nil {
+		return c.Err(err.Error())
 	}
+	for _, pr := range config.PathRoots {
+		if err := checkRoot(pr.Root); err != nil {
+			return c.Err(err.Error())
+		}
+	}
+
+	return nil
+}
+
+// checkRoot makes sure root is accessible, if it exists.
+func checkRoot(root string) error {
 	//first check that the path is not a symlink, os.Stat panics when this is true
-	info, _ := os.Lstat(config.Root)
+	info, _ := os.Lstat(root)
 	if info != nil && info.Mode()&os.ModeSymlink == os.ModeSymlink {
 		//just print out info, delegate responsibility for symlink validity to
 		//underlying Go framework, no need to test / verify twice
-		log.Printf("[INFO] Root path is symlink: %s", config.Root)
+		log.Printf("[INFO] Root path is symlink: %s", root)
 	} else {
 		// Check if root path exists
-		_, err := os.Stat(config.Root)
+		_, err := os.Stat(root)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// Allow this, because the folder might appear later.
 				// But make sure the user knows!
-				log.Printf("[WARNING] Root path does not exist: %s", config.Root)
+				log.Printf("[WARNING] Root path does not exist: %s", root)
 			} else {
-				return c.Errf("Unable to access root path '%s': %v", config.Root, err)
+				return fmt.Errorf("Unable to access root path '%s': %v", root, err)
 			}
 		}
 	}
-
 	return nil
 }
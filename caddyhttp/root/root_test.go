@@ -154,3 +154,39 @@ func TestSymlinkRoot(t *testing.T) {
 		t.Errorf("Test Symlink Root: Expected no error but found one for input %s. Error was: %v", input, err)
 	}
 }
+
+func TestPathRoots(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []httpserver.PathRoot
+	}{
+		{input: "root /srv/app/public {\n\t/static /srv/app/build\n\t/docs/api /srv/api-docs\n}", expected: []httpserver.PathRoot{
+			{Path: "/static", Root: "/srv/app/build"},
+			{Path: "/docs/api", Root: "/srv/api-docs"},
+		}},
+		{input: "root /srv/app/public {\n\t/static\n}", shouldErr: true},
+		{input: "root /srv/app/public {\n\tstatic /srv/app/build\n}", shouldErr: true},
+		{input: "root /srv/app/public {\n\t/static /a\n\t/static /b\n}", shouldErr: true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupRoot(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		cfg := httpserver.GetConfig(c)
+		if cfg.Root != "/srv/app/public" {
+			t.Errorf("Test %d: Expected site root /srv/app/public, got %s", i, cfg.Root)
+		}
+		if fmt.Sprint(cfg.PathRoots) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: Expected path roots %v, got %v", i, test.expected, cfg.PathRoots)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3 serves site content from an S3-compatible
+// object storage bucket instead of the local file system.
+package s3
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bucket is an http.FileSystem of the objects in a bucket
+// whose keys start with Prefix. Key separators are slashes,
+// and "directories" are the common prefixes of keys.
+type Bucket struct {
+	// Endpoint is the base URL of the storage service.
+	Endpoint *url.URL
+
+	// Name is the name of the bucket.
+	Name string
+
+	// Prefix is prepended to request paths to make keys.
+	Prefix string
+
+	// Region is the region requests are signed for.
+	Region string
+
+	// Credentials, if the access key is set, sign requests.
+	Credentials Credentials
+
+	// PathStyle addresses the bucket as a path of the
+	// endpoint rather than as a subdomain of it.
+	PathStyle bool
+
+	// Cache, if not nil, keeps fetched objects on disk.
+	Cache *Cache
+
+	Client *http.Client
+}
+
+// Open implements http.FileSystem.
+func (b *Bucket) Open(name string) (http.File, error) {
+	key := strings.TrimPrefix(path.Clean("/"+name), "/")
+	fullKey := b.Prefix + key
+	if key == "" {
+		return b.openDir(name, b.Prefix)
+	}
+
+	if b.Cache != nil {
+		if f, err := b.Cache.open(fullKey, path.Base(key)); err == nil {
+			return f, nil
+		}
+	}
+
+	resp, err := b.do("HEAD", fullKey, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// objects that do not exist may be directories; a
+		// bucket that cannot be listed anonymously says
+		// forbidden instead of not found
+		return b.openDir(name, fullKey+"/")
+	default:
+		return nil, fmt.Errorf("s3: HEAD %s: %s", fullKey, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("s3: HEAD %s: no Content-Length", fullKey)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if b.Cache != nil && b.Cache.fits(resp.ContentLength) {
+		resp, err := b.do("GET", fullKey, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("s3: GET %s: %s", fullKey, resp.Status)
+		}
+		return b.Cache.store(fullKey, path.Base(key), resp.Body, modTime)
+	}
+	return &object{
+		bucket: b,
+		key:    fullKey,
+		etag:   resp.Header.Get("ETag"),
+		info:   fileInfo{name: path.Base(key), size: resp.ContentLength, modTime: modTime},
+	}, nil
+}
+
+// openDir lists the keys under prefix, returning
+// os.ErrNotExist if there are none.
+func (b *Bucket) openDir(name, prefix string) (http.File, error) {
+	var entries []os.FileInfo
+	query := url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {prefix}}
+	for {
+		resp, err := b.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound {
+			return nil, os.ErrNotExist
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("s3: listing %s: %s", prefix, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("s3: listing %s: %v", prefix, err)
+		}
+		for _, p := range list.CommonPrefixes {
+			entries = append(entries, fileInfo{name: path.Base(p.Prefix), isDir: true})
+		}
+		for _, c := range list.Contents {
+			if c.Key == prefix {
+				continue // the "directory" placeholder object
+			}
+			modTime, _ := time.Parse(time.RFC3339, c.LastModified)
+			entries = append(entries, fileInfo{name: path.Base(c.Key), size: c.Size, modTime: modTime})
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+	if len(entries) == 0 && prefix != b.Prefix {
+		return nil, os.ErrNotExist
+	}
+	return &directory{info: fileInfo{name: path.Base("/" + name), isDir: true}, entries: entries}, nil
+}
+
+// do sends a request for key, or for the bucket itself
+// if key is empty, with the given query and header.
+func (b *Bucket) do(method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u := *b.Endpoint
+	p := "/" + key
+	if b.PathStyle {
+		p = "/" + b.Name + p
+	} else {
+		u.Host = b.Name + "." + u.Host
+	}
+	u.Path = singleJoiningSlash(u.Path, p)
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if b.Credentials.AccessKey != "" {
+		b.Credentials.sign(req, b.Region, time.Now())
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func singleJoiningSlash(a, b string) string {
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified string
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// object is an object of the bucket that is read with
+// ranged GETs from where it is seeked to, so that only the
+// parts that are read are fetched.
+type object struct {
+	bucket *Bucket
+	key    string
+	etag   string
+	info   fileInfo
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		header := http.Header{"Range": {"bytes=" + strconv.FormatInt(o.offset, 10) + "-"}}
+		if o.etag != "" {
+			// fail rather than mix parts of different versions
+			header.Set("If-Match", o.etag)
+		}
+		resp, err := o.bucket.do("GET", o.key, nil, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent &&
+			(resp.StatusCode != http.StatusOK || o.offset != 0) {
+			resp.Body.Close()
+			return 0, fmt.Errorf("s3: GET %s: %s", o.key, resp.Status)
+		}
+		o.body = resp.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if err == io.EOF && o.offset < o.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.info.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+func (o *object) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (o *object) Stat() (os.FileInfo, error)         { return o.info, nil }
+
+// directory is a listing of keys under a prefix.
+type directory struct {
+	info    fileInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *directory) Close() error                   { return nil }
+func (d *directory) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (d *directory) Seek(int64, int) (int64, error) { return 0, os.ErrInvalid }
+func (d *directory) Stat() (os.FileInfo, error)     { return d.info, nil }
+func (d *directory) Readdir(count int) ([]os.FileInfo, error) {
+	if d.read {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.read = true
+	return d.entries, nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.isDir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// Cache keeps objects fetched from a bucket in a local
+// directory for TTL, so that they are not fetched again
+// for every request. When it holds more than MaxSize bytes
+// or MaxEntries objects, the least recently used ones are
+// removed; objects larger than MaxSize are not cached. A
+// limit of 0 means no limit.
+type Cache struct {
+	Dir        string
+	TTL        time.Duration
+	MaxSize    int64
+	MaxEntries int
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element // of *cacheEntry
+	lru     *list.List               // most recently used first
+}
+
+type cacheEntry struct {
+	key     string
+	file    string
+	size    int64
+	modTime time.Time
+	fetched time.Time
+}
+
+// fits reports whether an object of size bytes may be cached.
+func (c *Cache) fits(size int64) bool {
+	return c.MaxSize <= 0 || size <= c.MaxSize
+}
+
+// open opens the cached copy of key, if it is fresh.
+func (c *Cache) open(key, name string) (http.File, error) {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	var e cacheEntry
+	if ok {
+		e = *el.Value.(*cacheEntry)
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok || time.Since(e.fetched) > c.TTL {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(e.file)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedFile{File: f, name: name, modTime: e.modTime}, nil
+}
+
+// store writes the object key read from r to the cache
+// and opens it.
+func (c *Cache) store(key, name string, r io.Reader, modTime time.Time) (http.File, error) {
+	sum := sha256.Sum256([]byte(key))
+	file := filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+
+	// written to a temporary file first, so that requests
+	// reading the previous copy are not disturbed
+	tmp, err := ioutil.TempFile(c.Dir, "tmp")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	// opened before it is accounted for, since it may be
+	// evicted as soon as it is
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.lru = list.New()
+	}
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, file: file, size: size, modTime: modTime, fetched: time.Now()})
+	c.size += size
+	for c.lru.Len() > 1 && ((c.MaxSize > 0 && c.size > c.MaxSize) ||
+		(c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries)) {
+		e := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.entries, e.key)
+		c.size -= e.size
+		os.Remove(e.file)
+	}
+	c.mu.Unlock()
+
+	return &cachedFile{File: f, name: name, modTime: modTime}, nil
+}
+
+// cachedFile is a cached object, which has the name and
+// modification time of the object rather than the file.
+type cachedFile struct {
+	*os.File
+	name    string
+	modTime time.Time
+}
+
+func (f *cachedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: f.name, size: info.Size(), modTime: f.modTime}, nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStorage serves objects of the bucket "site" at path-style
+// URLs and counts the GET requests for each object.
+func fakeStorage(objects map[string]string) (*httptest.Server, map[string]int) {
+	gets := make(map[string]int)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/site/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/site/")
+		if key == "" && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			w.Write([]byte("<ListBucketResult>"))
+			seen := make(map[string]bool)
+			for k := range objects {
+				if !strings.HasPrefix(k, prefix) {
+					continue
+				}
+				rest := strings.TrimPrefix(k, prefix)
+				if i := strings.Index(rest, "/"); i >= 0 {
+					if !seen[rest[:i]] {
+						seen[rest[:i]] = true
+						w.Write([]byte("<CommonPrefixes><Prefix>" + prefix + rest[:i+1] + "</Prefix></CommonPrefixes>"))
+					}
+					continue
+				}
+				w.Write([]byte("<Contents><Key>" + k + "</Key><LastModified>2018-01-02T03:04:05.000Z</LastModified><Size>" +
+					"3</Size></Contents>"))
+			}
+			w.Write([]byte("</ListBucketResult>"))
+			return
+		}
+		body, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "GET" {
+			gets[key]++
+		}
+		w.Header().Set("ETag", `"v1"`)
+		modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+		http.ServeContent(w, r, key, modTime, strings.NewReader(body))
+	})), gets
+}
+
+func TestBucket(t *testing.T) {
+	storage, gets := fakeStorage(map[string]string{
+		"www/index.html":     "home",
+		"www/docs/guide.txt": "abc",
+		"www/docs/faq.txt":   "def",
+		"other/secret.txt":   "nope",
+	})
+	defer storage.Close()
+
+	endpoint, _ := url.Parse(storage.URL)
+	b := &Bucket{
+		Endpoint:    endpoint,
+		Name:        "site",
+		Prefix:      "www/",
+		Region:      "us-east-1",
+		Credentials: Credentials{AccessKey: "key", SecretKey: "secret"},
+		PathStyle:   true,
+	}
+
+	f, err := b.Open("/index.html")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	info, _ := f.Stat()
+	f.Close()
+	if string(data) != "home" || info.Name() != "index.html" || info.Size() != 4 || info.IsDir() {
+		t.Errorf("Expected index.html with 'home', got '%s' and %v", data, info)
+	}
+	if want := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("Expected modification time %v, got %v", want, info.ModTime())
+	}
+
+	d, err := b.Open("/docs")
+	if err != nil {
+		t.Fatalf("Expected a directory, got %v", err)
+	}
+	info, _ = d.Stat()
+	entries, _ := d.Readdir(-1)
+	if !info.IsDir() || len(entries) != 2 {
+		t.Errorf("Expected a directory with 2 entries, got %v with %v", info, entries)
+	}
+
+	root, err := b.Open("/")
+	if err != nil {
+		t.Fatalf("Expected the root directory, got %v", err)
+	}
+	entries, _ = root.Readdir(-1)
+	if len(entries) != 2 {
+		t.Errorf("Expected docs and index.html in the root, got %v", entries)
+	}
+
+	for _, name := range []string{"/missing.txt", "/../other/secret.txt"} {
+		if _, err := b.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to exist, got %v", name, err)
+		}
+	}
+
+	// with a cache, objects are fetched once while fresh
+	dir, err := ioutil.TempDir("", "caddy_s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b.Cache = &Cache{Dir: dir, TTL: time.Minute}
+	before := gets["www/docs/guide.txt"]
+	for i := 0; i < 3; i++ {
+		f, err := b.Open("/docs/guide.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(f)
+		info, _ := f.Stat()
+		f.Close()
+		if string(data) != "abc" || info.Name() != "guide.txt" || info.ModTime().Year() != 2018 {
+			t.Errorf("Expected cached guide.txt, got '%s' and %v", data, info)
+		}
+	}
+	if got := gets["www/docs/guide.txt"] - before; got != 1 {
+		t.Errorf("Expected 1 fetch with the cache, got %d", got)
+	}
+}
+
+func TestBucketRangedReads(t *testing.T) {
+	storage, gets := fakeStorage(map[string]string{"big.bin": "0123456789"})
+	defer storage.Close()
+
+	endpoint, _ := url.Parse(storage.URL)
+	b := &Bucket{
+		Endpoint:    endpoint,
+		Name:        "site",
+		Credentials: Credentials{AccessKey: "key", SecretKey: "secret"},
+		PathStyle:   true,
+	}
+
+	f, err := b.Open("/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if info, _ := f.Stat(); info.Size() != 10 {
+		t.Errorf("Expected size 10 from the HEAD request, got %d", info.Size())
+	}
+	if gets["big.bin"] != 0 {
+		t.Errorf("Expected nothing to be fetched by Open, got %d GETs", gets["big.bin"])
+	}
+
+	if n, err := f.Seek(0, io.SeekEnd); n != 10 || err != nil {
+		t.Errorf("Expected to seek to the end at 10, got %d, %v", n, err)
+	}
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "678" {
+		t.Errorf("Expected '678' at offset 6, got '%s', %v", buf, err)
+	}
+	if _, err := f.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil || string(data) != "23456789" {
+		t.Errorf("Expected '23456789' from offset 2, got '%s', %v", data, err)
+	}
+	if gets["big.bin"] != 2 {
+		t.Errorf("Expected one GET per seek, got %d", gets["big.bin"])
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	storage, gets := fakeStorage(map[string]string{
+		"a.txt":   "aaa",
+		"b.txt":   "bbb",
+		"big.txt": "0123456789",
+	})
+	defer storage.Close()
+
+	dir, err := ioutil.TempDir("", "caddy_s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	endpoint, _ := url.Parse(storage.URL)
+	b := &Bucket{
+		Endpoint:    endpoint,
+		Name:        "site",
+		Credentials: Credentials{AccessKey: "key", SecretKey: "secret"},
+		PathStyle:   true,
+		Cache:       &Cache{Dir: dir, TTL: time.Minute, MaxSize: 5, MaxEntries: 10},
+	}
+	read := func(name string) string {
+		f, err := b.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, _ := ioutil.ReadAll(f)
+		return string(data)
+	}
+
+	// the second object pushes the first out of the cache
+	read("/a.txt")
+	read("/b.txt")
+	read("/b.txt")
+	read("/a.txt")
+	if gets["a.txt"] != 2 || gets["b.txt"] != 1 {
+		t.Errorf("Expected a.txt to be evicted and fetched again, got %v", gets)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected 1 file in the cache, got %d", len(files))
+	}
+
+	// objects larger than the cache are read without it
+	if got := read("/big.txt"); got != "0123456789" {
+		t.Errorf("Expected big.txt, got '%s'", got)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected big.txt not to be cached, got %d files", len(files))
+	}
+
+	b.Cache.MaxSize, b.Cache.MaxEntries = 0, 1
+	read("/b.txt")
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected at most 1 cached object, got %d files", len(files))
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("s3", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// Defaults of the s3 directive.
+const (
+	DefaultRegion          = "us-east-1"
+	DefaultCacheTTL        = 5 * time.Minute
+	DefaultCacheMaxSize    = 1 << 30 // 1 GB
+	DefaultCacheMaxEntries = 10000
+)
+
+// setup makes the site serve files from a bucket.
+func setup(c *caddy.Controller) error {
+	b, err := s3Parse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).FileSystem = b
+	return nil
+}
+
+func s3Parse(c *caddy.Controller) (*Bucket, error) {
+	var b *Bucket
+
+	for c.Next() {
+		if b != nil {
+			return nil, c.Err("s3 can only be used once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+		b = &Bucket{
+			Name:   args[0],
+			Region: os.Getenv("AWS_REGION"),
+			Credentials: Credentials{
+				AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			Client: &http.Client{Timeout: 30 * time.Second},
+		}
+		if len(args) == 2 {
+			if prefix := strings.Trim(args[1], "/"); prefix != "" {
+				b.Prefix = prefix + "/"
+			}
+		}
+
+		var endpoint string
+		var limit []string
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "endpoint", "region", "access_key", "secret_key", "session_token":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch what {
+				case "endpoint":
+					endpoint = args[0]
+				case "region":
+					b.Region = args[0]
+				case "access_key":
+					b.Credentials.AccessKey = args[0]
+				case "secret_key":
+					b.Credentials.SecretKey = args[0]
+				case "session_token":
+					b.Credentials.SessionToken = args[0]
+				}
+			case "path_style":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				b.PathStyle = true
+			case "cache":
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				b.Cache = &Cache{
+					Dir:        args[0],
+					TTL:        DefaultCacheTTL,
+					MaxSize:    DefaultCacheMaxSize,
+					MaxEntries: DefaultCacheMaxEntries,
+				}
+				if len(args) == 2 {
+					ttl, err := time.ParseDuration(args[1])
+					if err != nil || ttl <= 0 {
+						return nil, c.Errf("invalid cache ttl '%s'", args[1])
+					}
+					b.Cache.TTL = ttl
+				}
+				if err := os.MkdirAll(b.Cache.Dir, 0700); err != nil {
+					return nil, c.Errf("s3 cache directory: %v", err)
+				}
+			case "cache_limit":
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				limit = args
+			default:
+				return nil, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+
+		if limit != nil {
+			if b.Cache == nil {
+				return nil, c.Err("s3 cache_limit needs a cache")
+			}
+			size := httpserver.ParseSize(limit[0])
+			if size <= 0 {
+				return nil, c.Errf("invalid cache size '%s'", limit[0])
+			}
+			b.Cache.MaxSize = size
+			if len(limit) == 2 {
+				n, err := strconv.Atoi(limit[1])
+				if err != nil || n <= 0 {
+					return nil, c.Errf("invalid number of cached objects '%s'", limit[1])
+				}
+				b.Cache.MaxEntries = n
+			}
+		}
+
+		if b.Region == "" {
+			b.Region = DefaultRegion
+		}
+		if endpoint == "" {
+			endpoint = "https://s3." + b.Region + ".amazonaws.com"
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, c.Errf("invalid s3 endpoint '%s'", endpoint)
+		}
+		b.Endpoint = u
+		if (b.Credentials.AccessKey == "") != (b.Credentials.SecretKey == "") {
+			return nil, c.Err("s3 needs both access_key and secret_key, or neither")
+		}
+	}
+
+	return b, nil
+}
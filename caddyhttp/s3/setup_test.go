@@ -0,0 +1,118 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `s3 site`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if _, ok := httpserver.GetConfig(c).FileSystem.(*Bucket); !ok {
+		t.Errorf("Expected the site to be served from the bucket, got %#v", httpserver.GetConfig(c).FileSystem)
+	}
+}
+
+func TestS3Parse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"AWS_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	b, err := s3Parse(caddy.NewTestController("http", `s3 site /www/ {
+		endpoint http://minio:9000
+		region eu-west-1
+		access_key key
+		secret_key secret
+		path_style
+		cache `+filepath.Join(dir, "cache")+` 1m
+		cache_limit 10MB 100
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if b.Name != "site" || b.Prefix != "www/" || b.Region != "eu-west-1" || !b.PathStyle {
+		t.Errorf("Expected bucket site with prefix www/ in eu-west-1, got %#v", b)
+	}
+	if b.Endpoint.String() != "http://minio:9000" || b.Credentials.AccessKey != "key" || b.Credentials.SecretKey != "secret" {
+		t.Errorf("Expected endpoint and credentials, got %v and %#v", b.Endpoint, b.Credentials)
+	}
+	if b.Cache == nil || b.Cache.TTL != time.Minute || b.Cache.MaxSize != 10<<20 || b.Cache.MaxEntries != 100 {
+		t.Errorf("Expected a cache of 10MB and 100 objects with a TTL of 1m, got %#v", b.Cache)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cache")); err != nil {
+		t.Errorf("Expected the cache directory to be created: %v", err)
+	}
+
+	b, err = s3Parse(caddy.NewTestController("http", `s3 site`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if b.Region != DefaultRegion || b.Endpoint.String() != "https://s3.us-east-1.amazonaws.com" || b.Prefix != "" {
+		t.Errorf("Expected defaults, got %#v", b)
+	}
+
+	for i, input := range []string{
+		`s3`,
+		`s3 a b c`,
+		`s3 a
+		s3 b`,
+		`s3 site {
+			endpoint ftp://host
+		}`,
+		`s3 site {
+			access_key key
+		}`,
+		`s3 site {
+			cache /tmp forever
+		}`,
+		`s3 site {
+			path_style yes
+		}`,
+		`s3 site {
+			cache_limit 10MB
+		}`,
+		`s3 site {
+			cache /tmp
+			cache_limit lots
+		}`,
+		`s3 site {
+			cache /tmp
+			cache_limit 10MB none
+		}`,
+		`s3 site {
+			unknown x
+		}`,
+	} {
+		if _, err := s3Parse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
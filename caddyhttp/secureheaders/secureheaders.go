@@ -0,0 +1,66 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secureheaders provides middleware that sets a curated
+// set of security-related response headers.
+package secureheaders
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// SecureHeaders is middleware that sets security headers on
+// responses for requests matching a rule's path.
+type SecureHeaders struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the set of headers for requests under Path.
+type Rule struct {
+	Path string
+
+	// Headers are set on every response.
+	Headers http.Header
+
+	// HSTS is the Strict-Transport-Security value, which is
+	// only sent over HTTPS. If empty, it is not sent.
+	HSTS string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (sh SecureHeaders) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range sh.Rules {
+		if httpserver.Path(r.URL.Path).Matches(sh.Rules[i].Path) &&
+			(rule == nil || len(sh.Rules[i].Path) > len(rule.Path)) {
+			rule = &sh.Rules[i]
+		}
+	}
+	if rule == nil {
+		return sh.Next.ServeHTTP(w, r)
+	}
+
+	// headers are set before the request is handled, so
+	// that the header directive and the site can override them
+	for name, values := range rule.Headers {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	if rule.HSTS != "" && r.TLS != nil {
+		w.Header().Set("Strict-Transport-Security", rule.HSTS)
+	}
+	return sh.Next.ServeHTTP(w, r)
+}
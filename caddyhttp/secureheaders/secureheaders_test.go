@@ -0,0 +1,73 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secureheaders
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSecureHeaders(t *testing.T) {
+	sh := SecureHeaders{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/embed" {
+				// the site can still override a header
+				w.Header().Set("X-Frame-Options", "DENY")
+			}
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Headers: http.Header{"X-Frame-Options": {"SAMEORIGIN"}}, HSTS: "max-age=300"},
+			{Path: "/api", Headers: http.Header{"Referrer-Policy": {"no-referrer"}}},
+		},
+	}
+
+	for i, test := range []struct {
+		path     string
+		https    bool
+		expected map[string]string
+	}{
+		{"/", true, map[string]string{"X-Frame-Options": "SAMEORIGIN", "Strict-Transport-Security": "max-age=300"}},
+		{"/", false, map[string]string{"X-Frame-Options": "SAMEORIGIN", "Strict-Transport-Security": ""}},
+		{"/api/users", true, map[string]string{"X-Frame-Options": "", "Referrer-Policy": "no-referrer", "Strict-Transport-Security": ""}},
+		{"/embed", false, map[string]string{"X-Frame-Options": "DENY"}},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.https {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		if _, err := sh.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		for name, value := range test.expected {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("Test %d: Expected %s to be %q, got %q", i, name, value, got)
+			}
+		}
+	}
+
+	// values must not be shared between responses
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	w.Header()["X-Frame-Options"][0] = "changed"
+	if sh.Rules[0].Headers.Get("X-Frame-Options") != "SAMEORIGIN" {
+		t.Error("Expected rule headers to be unaffected by changes to a response")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secureheaders
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("secure_headers", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// Defaults of the headers set by secure_headers.
+const (
+	DefaultHSTSMaxAge         = 31536000 // one year
+	DefaultContentTypeOptions = "nosniff"
+	DefaultFrameOptions       = "SAMEORIGIN"
+	DefaultReferrerPolicy     = "strict-origin-when-cross-origin"
+)
+
+// setup configures a new SecureHeaders middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := secureHeadersParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SecureHeaders{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func secureHeadersParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{
+			Path: "/",
+			Headers: http.Header{
+				"X-Content-Type-Options": {DefaultContentTypeOptions},
+				"X-Frame-Options":        {DefaultFrameOptions},
+				"Referrer-Policy":        {DefaultReferrerPolicy},
+			},
+			HSTS: "max-age=" + strconv.Itoa(DefaultHSTSMaxAge),
+		}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+		for _, r := range rules {
+			if r.Path == rule.Path {
+				return rules, c.Errf("duplicate secure_headers path '%s'", rule.Path)
+			}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return rules, c.ArgErr()
+			}
+
+			switch what {
+			case "hsts":
+				hsts, err := parseHSTS(c, args)
+				if err != nil {
+					return rules, err
+				}
+				rule.HSTS = hsts
+			case "content_type_options":
+				setOrRemove(rule.Headers, "X-Content-Type-Options", args)
+			case "frame_options":
+				if len(args) == 1 && args[0] != "off" {
+					args[0] = strings.ToUpper(args[0])
+					if args[0] != "DENY" && args[0] != "SAMEORIGIN" {
+						return rules, c.Errf("frame_options must be DENY, SAMEORIGIN or off, got '%s'", args[0])
+					}
+				}
+				setOrRemove(rule.Headers, "X-Frame-Options", args)
+			case "frame_ancestors":
+				// frame-ancestors supersedes X-Frame-Options in
+				// browsers that support it; both are sent for
+				// those that do not
+				if len(args) == 1 && args[0] == "off" {
+					rule.Headers.Del("Content-Security-Policy")
+				} else {
+					rule.Headers.Set("Content-Security-Policy", "frame-ancestors "+strings.Join(args, " "))
+				}
+			case "referrer_policy":
+				setOrRemove(rule.Headers, "Referrer-Policy", args)
+			case "permissions_policy":
+				setOrRemove(rule.Headers, "Permissions-Policy", args)
+			default:
+				return rules, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// setOrRemove sets the header name to the space-separated args,
+// or removes it from the set if args is just "off".
+func setOrRemove(h http.Header, name string, args []string) {
+	if len(args) == 1 && args[0] == "off" {
+		h.Del(name)
+		return
+	}
+	h.Set(name, strings.Join(args, " "))
+}
+
+// parseHSTS parses the arguments of the hsts subdirective:
+// "off", or a max-age in seconds optionally followed by
+// includeSubDomains and preload.
+func parseHSTS(c *caddy.Controller, args []string) (string, error) {
+	if len(args) == 1 && args[0] == "off" {
+		return "", nil
+	}
+	maxAge, err := strconv.Atoi(args[0])
+	if err != nil || maxAge < 0 {
+		return "", c.Errf("invalid hsts max-age '%s'", args[0])
+	}
+	hsts := "max-age=" + strconv.Itoa(maxAge)
+	var subdomains, preload bool
+	for _, arg := range args[1:] {
+		switch strings.ToLower(arg) {
+		case "includesubdomains":
+			subdomains = true
+		case "preload":
+			preload = true
+		default:
+			return "", c.Errf("unknown hsts option '%s'", arg)
+		}
+	}
+	if subdomains {
+		hsts += "; includeSubDomains"
+	}
+	if preload {
+		// the preload list requires subdomains and at least a year
+		if !subdomains || maxAge < DefaultHSTSMaxAge {
+			return "", c.Err("hsts preload needs includeSubDomains and a max-age of at least 31536000")
+		}
+		hsts += "; preload"
+	}
+	return hsts, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secureheaders
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `secure_headers`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SecureHeaders)
+	if !ok {
+		t.Fatalf("Expected handler to be type SecureHeaders, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSecureHeadersParse(t *testing.T) {
+	defaults := http.Header{
+		"X-Content-Type-Options": {"nosniff"},
+		"X-Frame-Options":        {"SAMEORIGIN"},
+		"Referrer-Policy":        {"strict-origin-when-cross-origin"},
+	}
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`secure_headers`, false, []Rule{
+			{Path: "/", Headers: defaults, HSTS: "max-age=31536000"},
+		}},
+		{`secure_headers /app {
+			hsts 63072000 includeSubDomains preload
+			content_type_options off
+			frame_options deny
+			frame_ancestors 'self' https://example.com
+			referrer_policy no-referrer
+			permissions_policy camera=(), microphone=()
+		}`, false, []Rule{
+			{Path: "/app", Headers: http.Header{
+				"X-Frame-Options":         {"DENY"},
+				"Content-Security-Policy": {"frame-ancestors 'self' https://example.com"},
+				"Referrer-Policy":         {"no-referrer"},
+				"Permissions-Policy":      {"camera=(), microphone=()"},
+			}, HSTS: "max-age=63072000; includeSubDomains; preload"},
+		}},
+		{`secure_headers {
+			hsts off
+			frame_options off
+			referrer_policy off
+		}
+		secure_headers /api {
+			hsts 300 includesubdomains
+		}`, false, []Rule{
+			{Path: "/", Headers: http.Header{"X-Content-Type-Options": {"nosniff"}}, HSTS: ""},
+			{Path: "/api", Headers: defaults, HSTS: "max-age=300; includeSubDomains"},
+		}},
+		{`secure_headers / /extra`, true, nil},
+		{`secure_headers
+		secure_headers /`, true, nil},
+		{`secure_headers {
+			hsts
+		}`, true, nil},
+		{`secure_headers {
+			hsts soon
+		}`, true, nil},
+		{`secure_headers {
+			hsts 300 preload
+		}`, true, nil},
+		{`secure_headers {
+			hsts 300 sometimes
+		}`, true, nil},
+		{`secure_headers {
+			frame_options ALLOW-FROM
+		}`, true, nil},
+		{`secure_headers {
+			bogus value
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		rules, err := secureHeadersParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, but got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package split
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("split", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// DefaultCookie is the name of the cookie of sticky cookie.
+const DefaultCookie = "caddy_split"
+
+// setup configures a new Split middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := splitParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Split{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func splitParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+		for _, r := range rules {
+			if r.Path == rule.Path {
+				return rules, c.Errf("duplicate split path '%s'", rule.Path)
+			}
+		}
+
+		var total float64
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "branch":
+				if len(args) < 2 || len(args) > 3 {
+					return rules, c.ArgErr()
+				}
+				b := Branch{Name: args[0], Prefix: "/" + args[0]}
+				if b.Name == DefaultBranch {
+					return rules, c.Errf("branch name '%s' is reserved", DefaultBranch)
+				}
+				for _, other := range rule.Branches {
+					if other.Name == b.Name {
+						return rules, c.Errf("duplicate branch '%s'", b.Name)
+					}
+				}
+				percent, err := strconv.ParseFloat(strings.TrimSuffix(args[1], "%"), 64)
+				if err != nil || percent <= 0 {
+					return rules, c.Errf("invalid branch percentage '%s'", args[1])
+				}
+				b.Percent = percent
+				total += percent
+				if total > 100 {
+					return rules, c.Err("branch percentages add up to more than 100")
+				}
+				if len(args) == 3 {
+					b.Prefix = strings.TrimSuffix(args[2], "/")
+					if b.Prefix != "" && !strings.HasPrefix(b.Prefix, "/") {
+						return rules, c.Errf("branch prefix must start with /, got '%s'", args[2])
+					}
+				}
+				rule.Branches = append(rule.Branches, b)
+			case "sticky":
+				if len(args) == 0 {
+					return rules, c.ArgErr()
+				}
+				switch args[0] {
+				case "cookie":
+					if len(args) > 2 {
+						return rules, c.ArgErr()
+					}
+					rule.Cookie = DefaultCookie
+					if len(args) == 2 {
+						rule.Cookie = args[1]
+					}
+				case "ip":
+					if len(args) != 1 {
+						return rules, c.ArgErr()
+					}
+				default:
+					return rules, c.Errf("sticky must be cookie or ip, got '%s'", args[0])
+				}
+				rule.Sticky = args[0]
+			default:
+				return rules, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+
+		if len(rule.Branches) == 0 {
+			return rules, c.Err("split needs at least one branch")
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package split
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `split {
+		branch canary 5
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Split)
+	if !ok {
+		t.Fatalf("Expected handler to be type Split, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSplitParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`split {
+			branch canary 5
+		}`, false, []Rule{{Path: "/", Branches: []Branch{{"canary", 5, "/canary"}}}}},
+		{`split /app {
+			branch a 50% /_a/
+			branch b 12.5 /
+			sticky cookie
+		}`, false, []Rule{{Path: "/app", Branches: []Branch{{"a", 50, "/_a"}, {"b", 12.5, ""}}, Sticky: "cookie", Cookie: DefaultCookie}}},
+		{`split {
+			branch canary 1
+			sticky cookie version
+		}
+		split /api {
+			branch canary 10
+			sticky ip
+		}`, false, []Rule{
+			{Path: "/", Branches: []Branch{{"canary", 1, "/canary"}}, Sticky: "cookie", Cookie: "version"},
+			{Path: "/api", Branches: []Branch{{"canary", 10, "/canary"}}, Sticky: "ip"},
+		}},
+		{`split`, true, nil},
+		{`split {
+			branch canary
+		}`, true, nil},
+		{`split {
+			branch canary 0
+		}`, true, nil},
+		{`split {
+			branch a 60
+			branch b 50
+		}`, true, nil},
+		{`split {
+			branch a 5
+			branch a 5
+		}`, true, nil},
+		{`split {
+			branch default 5
+		}`, true, nil},
+		{`split {
+			branch a 5 nope
+		}`, true, nil},
+		{`split {
+			branch a 5
+			sticky header
+		}`, true, nil},
+		{`split {
+			branch a 5
+			sticky ip extra
+		}`, true, nil},
+		{`split {
+			branch a 5
+			unknown
+		}`, true, nil},
+		{`split / /x {
+			branch a 5
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := splitParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, actual)
+		}
+	}
+}
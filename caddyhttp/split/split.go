@@ -0,0 +1,127 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package split provides middleware that sends a percentage of
+// requests down alternate branches, for canary releases and A/B
+// tests.
+package split
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultBranch is the name of the branch taken by requests
+// that were not sent down any other.
+const DefaultBranch = "default"
+
+// Split is middleware that assigns requests to branches.
+type Split struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule splits the requests under Path.
+type Rule struct {
+	Path     string
+	Branches []Branch
+
+	// Sticky is how clients are kept on the same branch:
+	// "cookie", "ip" or empty for not at all.
+	Sticky string
+
+	// Cookie is the name of the cookie for sticky cookie.
+	Cookie string
+}
+
+// Branch is where Percent of the requests go. Their path is
+// prefixed with Prefix, so that other directives, like proxy,
+// can handle them differently.
+type Branch struct {
+	Name    string
+	Percent float64
+	Prefix  string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Split) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range s.Rules {
+		if httpserver.Path(r.URL.Path).Matches(s.Rules[i].Path) &&
+			(rule == nil || len(s.Rules[i].Path) > len(rule.Path)) {
+			rule = &s.Rules[i]
+		}
+	}
+	if rule == nil {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	branch := rule.branch(w, r)
+	if repl, ok := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer); ok {
+		repl.Set("split_branch", branch.Name)
+	}
+	if branch.Prefix != "" {
+		r.URL.Path = branch.Prefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			r.URL.RawPath = branch.Prefix + r.URL.RawPath
+		}
+	}
+
+	return s.Next.ServeHTTP(w, r)
+}
+
+// branch returns the branch r goes down, which is the
+// default one if it is not sent down any other.
+func (rule Rule) branch(w http.ResponseWriter, r *http.Request) Branch {
+	switch rule.Sticky {
+	case "cookie":
+		if c, err := r.Cookie(rule.Cookie); err == nil {
+			if c.Value == DefaultBranch {
+				return Branch{Name: DefaultBranch}
+			}
+			for _, b := range rule.Branches {
+				if b.Name == c.Value {
+					return b
+				}
+			}
+		}
+		b := rule.pick(rand.Float64() * 100)
+		http.SetCookie(w, &http.Cookie{Name: rule.Cookie, Value: b.Name, Path: "/", HttpOnly: true})
+		return b
+	case "ip":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		h := fnv.New32a()
+		h.Write([]byte(host))
+		return rule.pick(float64(h.Sum32()%10000) / 100)
+	}
+	return rule.pick(rand.Float64() * 100)
+}
+
+// pick returns the branch that n, in [0, 100), falls in.
+func (rule Rule) pick(n float64) Branch {
+	for _, b := range rule.Branches {
+		if n < b.Percent {
+			return b
+		}
+		n -= b.Percent
+	}
+	return Branch{Name: DefaultBranch}
+}
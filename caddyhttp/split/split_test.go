@@ -0,0 +1,134 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package split
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// serve runs r through s and returns the path and
+// branch placeholder seen by the next handler.
+func serve(s Split, w http.ResponseWriter, r *http.Request) (path, branch string) {
+	repl := httpserver.NewReplacer(r, nil, "")
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, repl))
+	s.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		path = r.URL.Path
+		return http.StatusOK, nil
+	})
+	s.ServeHTTP(w, r)
+	return path, repl.Replace("{split_branch}")
+}
+
+func TestSplit(t *testing.T) {
+	s := Split{Rules: []Rule{{
+		Path:     "/",
+		Branches: []Branch{{"canary", 20, "/_canary"}, {"beta", 30, ""}},
+	}}}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		path, branch := serve(s, httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil))
+		counts[branch]++
+		want := "/page"
+		if branch == "canary" {
+			want = "/_canary/page"
+		}
+		if path != want {
+			t.Fatalf("Expected path %s for branch %s, got %s", want, branch, path)
+		}
+	}
+	for branch, percent := range map[string]int{"canary": 20, "beta": 30, DefaultBranch: 50} {
+		if got := counts[branch] / 100; got < percent-3 || got > percent+3 {
+			t.Errorf("Expected about %d%% of requests on %s, got %d%%", percent, branch, got)
+		}
+	}
+
+	// requests outside the rule are left alone
+	s.Rules[0].Path = "/app"
+	if path, branch := serve(s, httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil)); path != "/page" || branch != "" {
+		t.Errorf("Expected request to be left alone, got %s on '%s'", path, branch)
+	}
+}
+
+func TestSplitStickyIP(t *testing.T) {
+	s := Split{Rules: []Rule{{
+		Path:     "/",
+		Branches: []Branch{{"canary", 50, "/canary"}},
+		Sticky:   "ip",
+	}}}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		addr := "192.0.2." + strconv.Itoa(i) + ":1234"
+		var first string
+		for j := 0; j < 5; j++ {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = addr
+			_, branch := serve(s, httptest.NewRecorder(), r)
+			if j == 0 {
+				first = branch
+			} else if branch != first {
+				t.Fatalf("Expected %s to stay on %s, got %s", addr, first, branch)
+			}
+		}
+		seen[first] = true
+	}
+	if !seen["canary"] || !seen[DefaultBranch] {
+		t.Errorf("Expected clients on both branches, got %v", seen)
+	}
+}
+
+func TestSplitStickyCookie(t *testing.T) {
+	s := Split{Rules: []Rule{{
+		Path:     "/",
+		Branches: []Branch{{"canary", 50, "/canary"}},
+		Sticky:   "cookie",
+		Cookie:   "version",
+	}}}
+
+	w := httptest.NewRecorder()
+	_, branch := serve(s, w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "version" || cookies[0].Value != branch {
+		t.Fatalf("Expected cookie with branch %s, got %v", branch, cookies)
+	}
+
+	for i := 0; i < 20; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		if _, got := serve(s, w, r); got != branch {
+			t.Fatalf("Expected to stay on %s, got %s", branch, got)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Fatal("Expected no new cookie")
+		}
+	}
+
+	// cookies of branches that are gone are replaced
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "version", Value: "removed"})
+	w = httptest.NewRecorder()
+	serve(s, w, r)
+	if len(w.Result().Cookies()) != 1 {
+		t.Error("Expected a new cookie for an unknown branch")
+	}
+}
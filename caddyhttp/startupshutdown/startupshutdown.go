@@ -0,0 +1,138 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package startupshutdown provides the startup and shutdown
+// directives, which run commands when the server of a site is
+// first started and when it finally stops, for example to
+// launch a companion process alongside it.
+package startupshutdown
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("startup", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupStartup,
+	})
+	caddy.RegisterPlugin("shutdown", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupShutdown,
+	})
+}
+
+// Command is a command to run, with the environment of the site.
+type Command struct {
+	Command    string
+	Args       []string
+	Background bool
+	Env        []string
+}
+
+// setupStartup registers commands to run when the server first
+// starts; reloads leave processes started by earlier ones alone.
+func setupStartup(c *caddy.Controller) error {
+	return registerCallback(c, c.OnFirstStartup)
+}
+
+// setupShutdown registers commands to run when the server
+// finally stops, but not when it is reloaded.
+func setupShutdown(c *caddy.Controller) error {
+	return registerCallback(c, c.OnFinalShutdown)
+}
+
+// registerCallback parses the commands of the directive and
+// registers them to be run with registerFunc, once for the
+// whole server block.
+func registerCallback(c *caddy.Controller, registerFunc func(func() error)) error {
+	commands, err := parseCommands(c)
+	if err != nil {
+		return err
+	}
+
+	return c.OncePerServerBlock(func() error {
+		for _, command := range commands {
+			command := command
+			registerFunc(command.Run)
+		}
+		return nil
+	})
+}
+
+func parseCommands(c *caddy.Controller) ([]Command, error) {
+	var commands []Command
+	env := siteEnv(httpserver.GetConfig(c))
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+
+		command, args, err := caddy.SplitCommandAndArgs(strings.Join(args, " "))
+		if err != nil {
+			return nil, c.Err(err.Error())
+		}
+
+		cmd := Command{Command: command, Args: args, Env: env}
+		if n := len(cmd.Args); n > 0 && cmd.Args[n-1] == "&" {
+			// Run command in background; non-blocking
+			cmd.Background = true
+			cmd.Args = cmd.Args[:n-1]
+		}
+		commands = append(commands, cmd)
+	}
+
+	return commands, nil
+}
+
+// siteEnv returns the environment variables describing the
+// site of cfg to pass to commands.
+func siteEnv(cfg *httpserver.SiteConfig) []string {
+	return []string{
+		"CADDY_SITE_ADDRESS=" + cfg.Addr.String(),
+		"CADDY_SITE_HOST=" + cfg.Addr.Host,
+		"CADDY_SITE_PORT=" + cfg.Addr.Port,
+		"CADDY_SITE_ROOT=" + cfg.Root,
+	}
+}
+
+// Run runs the command, waiting for it to finish unless it
+// runs in the background.
+func (cmd Command) Run() error {
+	c := exec.Command(cmd.Command, cmd.Args...)
+	c.Env = append(os.Environ(), cmd.Env...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	line := strings.TrimSpace(cmd.Command + " " + strings.Join(cmd.Args, " "))
+	if cmd.Background {
+		log.Printf("[INFO] Nonblocking Command \"%s\"", line)
+		if err := c.Start(); err != nil {
+			return err
+		}
+		go c.Wait()
+		return nil
+	}
+	log.Printf("[INFO] Blocking Command \"%s\"", line)
+	return c.Run()
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startupshutdown
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseCommands(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Command
+	}{
+		{"startup php-fpm", false, []Command{
+			{Command: "php-fpm"},
+		}},
+		{"startup php-fpm --nodaemonize &", false, []Command{
+			{Command: "php-fpm", Args: []string{"--nodaemonize"}, Background: true},
+		}},
+		{"startup first\nstartup second arg", false, []Command{
+			{Command: "first"},
+			{Command: "second", Args: []string{"arg"}},
+		}},
+		{"startup", true, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		cfg := httpserver.GetConfig(c)
+		cfg.Addr = httpserver.Address{Host: "example.com", Port: "8080"}
+		cfg.Root = "/srv"
+
+		commands, err := parseCommands(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(commands) != len(test.expected) {
+			t.Fatalf("Test %d: expected %d commands, got %d", i, len(test.expected), len(commands))
+		}
+		for j, expected := range test.expected {
+			expected.Env = []string{
+				"CADDY_SITE_ADDRESS=http://example.com:8080",
+				"CADDY_SITE_HOST=example.com",
+				"CADDY_SITE_PORT=8080",
+				"CADDY_SITE_ROOT=/srv",
+			}
+			if !reflect.DeepEqual(commands[j], expected) {
+				t.Errorf("Test %d, command %d: expected %+v, got %+v", i, j, expected, commands[j])
+			}
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	for _, input := range []string{"startup echo hi", "shutdown echo bye"} {
+		c := caddy.NewTestController("http", input)
+		var err error
+		if strings.HasPrefix(input, "startup") {
+			err = setupStartup(c)
+		} else {
+			err = setupShutdown(c)
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", input, err)
+		}
+	}
+}
+
+func TestCommandRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir, err := ioutil.TempDir("", "caddy_startupshutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	cmd := Command{
+		Command: "sh",
+		Args:    []string{"-c", "echo $CADDY_SITE_HOST:$CADDY_SITE_PORT > " + out},
+		Env:     []string{"CADDY_SITE_HOST=example.com", "CADDY_SITE_PORT=8080"},
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "example.com:8080" {
+		t.Errorf("Expected the command to see the site in its environment, got '%s'", got)
+	}
+
+	cmd = Command{Command: "sh", Args: []string{"-c", "exit 1"}}
+	if err := cmd.Run(); err == nil {
+		t.Error("Expected error for failing command")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticfiles
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileCache keeps the contents of small files in memory so that
+// they need not be read from disk on every request. The least
+// recently used files are evicted first once the cache is full.
+// Entries are invalidated when the modification time or size
+// of the file on disk changes. It is safe for concurrent use.
+type FileCache struct {
+	// MaxFileSize is the size of the largest file to cache.
+	MaxFileSize int64
+
+	// MaxSize is the total size of the cached contents.
+	MaxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *cachedFile, most recently used first
+	entries map[string]*list.Element
+}
+
+// cachedFile is the contents of one file in a FileCache.
+type cachedFile struct {
+	key     string
+	modTime time.Time
+	data    []byte
+}
+
+// NewFileCache returns a cache for files of up to maxFileSize
+// bytes that holds at most maxSize bytes in total.
+func NewFileCache(maxFileSize, maxSize int64) *FileCache {
+	return &FileCache{
+		MaxFileSize: maxFileSize,
+		MaxSize:     maxSize,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+// load returns the contents of the file at key, which is described
+// by info and readable from r. If the file is not cached yet, it is
+// read from r and added to the cache. load returns false if the file
+// is too big to cache or cannot be read, in which case r may have to
+// be rewound before it is used.
+func (fc *FileCache) load(key string, info os.FileInfo, r io.Reader) ([]byte, bool) {
+	if info.Size() > fc.MaxFileSize || info.Size() > fc.MaxSize {
+		return nil, false
+	}
+
+	fc.mu.Lock()
+	if el, ok := fc.entries[key]; ok {
+		cf := el.Value.(*cachedFile)
+		if cf.modTime.Equal(info.ModTime()) && int64(len(cf.data)) == info.Size() {
+			fc.lru.MoveToFront(el)
+			fc.mu.Unlock()
+			return cf.data, true
+		}
+		fc.remove(el)
+	}
+	fc.mu.Unlock()
+
+	// read outside the lock; concurrent misses for the
+	// same file just read it more than once
+	data := make([]byte, info.Size())
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, false
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if el, ok := fc.entries[key]; ok {
+		fc.remove(el)
+	}
+	fc.entries[key] = fc.lru.PushFront(&cachedFile{key: key, modTime: info.ModTime(), data: data})
+	fc.size += int64(len(data))
+	for fc.size > fc.MaxSize {
+		fc.remove(fc.lru.Back())
+	}
+	return data, true
+}
+
+// remove evicts el from the cache. fc.mu must be held.
+func (fc *FileCache) remove(el *list.Element) {
+	cf := fc.lru.Remove(el).(*cachedFile)
+	delete(fc.entries, cf.key)
+	fc.size -= int64(len(cf.data))
+}
+
+// Len returns the number of cached files.
+func (fc *FileCache) Len() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.lru.Len()
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticfiles
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileCacheEviction(t *testing.T) {
+	fc := NewFileCache(4, 8)
+	now := time.Now()
+	load := func(key, content string) bool {
+		info := fileInfo{name: key, size: int64(len(content)), modTime: now}
+		data, ok := fc.load(key, info, strings.NewReader(content))
+		if ok && string(data) != content {
+			t.Errorf("Expected %s to load as %q, got %q", key, content, data)
+		}
+		return ok
+	}
+
+	if load("big", "12345") {
+		t.Error("Expected a file larger than MaxFileSize not to be cached")
+	}
+	load("a", "aaaa")
+	load("b", "bbbb")
+	load("a", "aaaa") // a is now the most recently used
+	load("c", "cccc")
+	if fc.Len() != 2 {
+		t.Fatalf("Expected 2 cached files, got %d", fc.Len())
+	}
+	if _, ok := fc.entries["b"]; ok {
+		t.Error("Expected the least recently used file to be evicted")
+	}
+	if fc.size != 8 {
+		t.Errorf("Expected cached size of 8, got %d", fc.size)
+	}
+}
+
+func TestServeHTTPFileCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_filecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	fpath := filepath.Join(root, "file.txt")
+	write := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fpath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewFileCache(1024, 4096)
+	get := func() string {
+		rec := httptest.NewRecorder()
+		if _, err := (FileServer{Root: http.Dir(root), Cache: cache}).ServeHTTP(rec, httptest.NewRequest("GET", "/file.txt", nil)); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Body.String()
+	}
+
+	modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	write("first", modTime)
+	if body := get(); body != "first" {
+		t.Fatalf("Expected body 'first', got %q", body)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("Expected the file to be cached")
+	}
+
+	// same size and time: the cached copy is served
+	write("FIRST", modTime)
+	if body := get(); body != "first" {
+		t.Errorf("Expected the cached body 'first', got %q", body)
+	}
+
+	// a new modification time invalidates the cached copy
+	write("second", modTime.Add(time.Second))
+	if body := get(); body != "second" {
+		t.Errorf("Expected body 'second', got %q", body)
+	}
+}
@@ -19,6 +19,8 @@
 package staticfiles
 
 import (
+	"bytes"
+	"io"
 	"math/rand"
 	"net/http"
 	"os"
@@ -46,9 +48,22 @@ type FileServer struct {
 	Root http.FileSystem // jailed access to the file system
 	Hide []string        // list of files for which to respond with "Not Found"
 
+	// Patterns of request paths for which to respond with
+	// "Not Found"; see IsHiddenPath. Injected from *SiteConfig.
+	HidePatterns []string
+
 	// A list of pages that may be understood as the "index" files to directories.
 	// Injected from *SiteConfig.
 	IndexPages []string
+
+	// Index pages for directories under specific base paths;
+	// the longest matching base path is used instead of
+	// IndexPages. Injected from *SiteConfig.
+	PathIndexPages map[string][]string
+
+	// Cache, if not nil, holds the contents of small
+	// files in memory. Injected from *SiteConfig.
+	Cache *FileCache
 }
 
 // ServeHTTP serves static files for r according to fs's configuration.
@@ -70,6 +85,11 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 		return http.StatusNotFound, nil
 	}
 
+	// don't even reveal whether hidden files exist
+	if fs.IsHiddenPath(reqPath) {
+		return http.StatusNotFound, nil
+	}
+
 	// open the requested file
 	f, err := fs.Root.Open(reqPath)
 	if err != nil {
@@ -129,7 +149,7 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 		// if an index file was explicitly requested, strip file name from the request
 		// ("/foo/index.html" -> "/foo/")
 		var requestPage = path.Base(urlCopy.Path)
-		for _, indexPage := range fs.IndexPages {
+		for _, indexPage := range fs.indexPagesFor(path.Dir(urlCopy.Path)) {
 			if requestPage == indexPage {
 				urlCopy.Path = urlCopy.Path[:len(urlCopy.Path)-len(indexPage)]
 				redir = true
@@ -149,7 +169,7 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 
 	// use contents of an index file, if present, for directory requests
 	if d.IsDir() {
-		for _, indexPage := range fs.IndexPages {
+		for _, indexPage := range fs.indexPagesFor(reqPath) {
 			indexPath := path.Join(reqPath, indexPage)
 			indexFile, err := fs.Root.Open(indexPath)
 			if err != nil {
@@ -180,12 +200,19 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 
 	// return Not Found if we either did not find an index file (and thus are
 	// still a directory) or if this file is supposed to be hidden
-	if d.IsDir() || fs.IsHidden(d) {
+	if d.IsDir() || fs.IsHidden(d) || fs.IsHiddenPath(reqPath) {
 		return http.StatusNotFound, nil
 	}
 
+	// the ETag always describes the file being served, since
+	// conditional requests are checked against it; an ETag set
+	// earlier in the chain may not match the file (it can still
+	// be removed with the header directive: -ETag)
 	etag := calculateEtag(d)
 
+	// the file that will be served and what to cache it under
+	servedPath, servedInfo := reqPath, d
+
 	// look for compressed versions of the file on disk, if the client supports that encoding
 	for _, encoding := range staticEncodingPriority {
 		// see if the client accepts a compressed encoding we offer
@@ -222,10 +249,16 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 
 		// the encoded file is now what we're serving
 		f = encodedFile
+		servedPath, servedInfo = reqPath+staticEncoding[encoding], encodedFileInfo
 		etag = calculateEtag(encodedFileInfo)
 		w.Header().Add("Vary", "Accept-Encoding")
 		w.Header().Set("Content-Encoding", encoding)
-		w.Header().Set("Content-Length", strconv.FormatInt(encodedFileInfo.Size(), 10))
+		// http.ServeContent may leave Content-Length alone for encoded
+		// content, so set it here; but not for range requests, whose
+		// partial bodies are trimmed by ServeContent
+		if r.Header.Get("Range") == "" {
+			w.Header().Set("Content-Length", strconv.FormatInt(encodedFileInfo.Size(), 10))
+		}
 		break
 	}
 
@@ -237,7 +270,13 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 	// to the response. This usually only happens if seeking fails (rare).
 	// Its signature does not bubble the error up to us, so we cannot
 	// return it for any logging middleware to record. Oh well.
-	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	var content io.ReadSeeker = f
+	if fs.Cache != nil {
+		if data, ok := fs.Cache.load(servedPath, servedInfo, f); ok {
+			content = bytes.NewReader(data)
+		}
+	}
+	http.ServeContent(w, r, d.Name(), d.ModTime(), content)
 
 	return http.StatusOK, nil
 }
@@ -257,6 +296,55 @@ func (fs FileServer) IsHidden(d os.FileInfo) bool {
 	return false
 }
 
+// IsHiddenPath checks if the request path name matches the
+// hide patterns. A pattern starting with "/" is matched, with
+// path.Match, against the path and each of its parent
+// directories; any other pattern is matched against each path
+// element, so ".*" hides dotfiles and everything inside dot
+// directories. A pattern starting with "!" shows paths that
+// match the rest of it again. The last matching pattern wins.
+func (fs FileServer) IsHiddenPath(name string) bool {
+	if len(fs.HidePatterns) == 0 {
+		return false
+	}
+	name = path.Clean("/" + name)
+	hidden := false
+	for _, pattern := range fs.HidePatterns {
+		show := strings.HasPrefix(pattern, "!")
+		if show {
+			pattern = pattern[1:]
+		}
+		if hidePatternMatches(pattern, name) {
+			hidden = !show
+		}
+	}
+	return hidden
+}
+
+// hidePatternMatches reports whether pattern, as described
+// at IsHiddenPath, matches the clean path name.
+func hidePatternMatches(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		for p := name; ; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if p == "/" {
+				return false
+			}
+		}
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, elem); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // calculateEtag produces a strong etag by default, although, for
 // efficiency reasons, it does not actually consume the contents
 // of the file to make a hash of all the bytes. ¯\_(ツ)_/¯
@@ -268,6 +356,28 @@ func calculateEtag(d os.FileInfo) string {
 	return `"` + t + s + `"`
 }
 
+// indexPagesFor returns the index pages to try for the
+// directory at reqPath.
+func (fs FileServer) indexPagesFor(reqPath string) []string {
+	return IndexPagesFor(reqPath, fs.IndexPages, fs.PathIndexPages)
+}
+
+// IndexPagesFor returns the index pages to try for the
+// directory at reqPath: those of the longest path in
+// pathPages that reqPath is in, or else pages. Middleware
+// that looks for index files uses it so that they all
+// agree with the file server.
+func IndexPagesFor(reqPath string, pages []string, pathPages map[string][]string) []string {
+	longest := -1
+	for base, basePages := range pathPages {
+		base = strings.TrimSuffix(base, "/")
+		if len(base) > longest && (reqPath == base || strings.HasPrefix(reqPath, base+"/")) {
+			pages, longest = basePages, len(base)
+		}
+	}
+	return pages
+}
+
 // DefaultIndexPages is a list of pages that may be understood as
 // the "index" files to directories.
 var DefaultIndexPages = []string{
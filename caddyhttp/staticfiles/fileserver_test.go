@@ -537,6 +537,227 @@ func TestServeHTTPFailingStat(t *testing.T) {
 	}
 }
 
+func TestServeHTTPConditional(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_conditional")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "file.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "file.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(root, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := calculateEtag(info)
+
+	fileServer := FileServer{Root: http.Dir(root)}
+	for i, test := range []struct {
+		headers        map[string]string
+		presetEtag     string
+		expectedStatus int
+		expectedBody   string
+		expectedEtag   string
+	}{
+		{nil, "", http.StatusOK, "0123456789", etag},
+		{map[string]string{"If-None-Match": etag}, "", http.StatusNotModified, "", etag},
+		{map[string]string{"If-None-Match": `"other"`}, "", http.StatusOK, "0123456789", etag},
+		{map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, "", http.StatusNotModified, "", etag},
+		{map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, "", http.StatusOK, "0123456789", etag},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": etag}, "", http.StatusPartialContent, "234", etag},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": `"stale"`}, "", http.StatusOK, "0123456789", etag},
+		// an ETag set earlier in the chain is replaced by the file's
+		{nil, `"earlier"`, http.StatusOK, "0123456789", etag},
+		{map[string]string{"If-None-Match": `"earlier"`}, `"earlier"`, http.StatusOK, "0123456789", etag},
+	} {
+		request := httptest.NewRequest("GET", "/file.txt", nil)
+		for name, value := range test.headers {
+			request.Header.Set(name, value)
+		}
+		responseRecorder := httptest.NewRecorder()
+		if test.presetEtag != "" {
+			responseRecorder.Header().Set("ETag", test.presetEtag)
+		}
+		if _, err := fileServer.ServeHTTP(responseRecorder, request); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if responseRecorder.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, responseRecorder.Code)
+		}
+		if body := responseRecorder.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if got := responseRecorder.Header().Get("ETag"); got != test.expectedEtag {
+			t.Errorf("Test %d: Expected ETag %s, got %s", i, test.expectedEtag, got)
+		}
+	}
+}
+
+func TestServeHTTPRanges(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ranges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"file.txt":    "0123456789",
+		"file.txt.gz": "abcdefghij",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fileServer := FileServer{Root: http.Dir(root)}
+	for i, test := range []struct {
+		rangeHeader    string
+		acceptEncoding string
+		expectedStatus int
+		expectedBody   []string
+		expectedRange  string
+	}{
+		{"bytes=0-2", "", http.StatusPartialContent, []string{"012"}, "bytes 0-2/10"},
+		{"bytes=-3", "", http.StatusPartialContent, []string{"789"}, "bytes 7-9/10"},
+		{"bytes=0-1,5-6", "", http.StatusPartialContent, []string{"01", "56", "bytes 0-1/10", "bytes 5-6/10"}, ""},
+		{"bytes=1-3", "gzip", http.StatusPartialContent, []string{"bcd"}, "bytes 1-3/10"},
+		{"bytes=20-30", "", http.StatusRequestedRangeNotSatisfiable, nil, "bytes */10"},
+	} {
+		request := httptest.NewRequest("GET", "/file.txt", nil)
+		request.Header.Set("Range", test.rangeHeader)
+		request.Header.Set("Accept-Encoding", test.acceptEncoding)
+		responseRecorder := httptest.NewRecorder()
+		if _, err := fileServer.ServeHTTP(responseRecorder, request); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if responseRecorder.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, responseRecorder.Code)
+		}
+		body := responseRecorder.Body.String()
+		for _, part := range test.expectedBody {
+			if !strings.Contains(body, part) {
+				t.Errorf("Test %d: Expected body to contain %q, got %q", i, part, body)
+			}
+		}
+		if got := responseRecorder.Header().Get("Content-Range"); got != test.expectedRange {
+			t.Errorf("Test %d: Expected Content-Range %q, got %q", i, test.expectedRange, got)
+		}
+		if length := responseRecorder.Header().Get("Content-Length"); length != "" && length != strconv.Itoa(len(body)) {
+			t.Errorf("Test %d: Content-Length %s does not match body length %d", i, length, len(body))
+		}
+	}
+}
+
+func TestServeHTTPPathIndexPages(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_pathindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"index.html":             "site index",
+		"legacy/default.asp":     "legacy index",
+		"legacy/index.html":      "not used",
+		"legacy/sub/default.asp": "legacy sub index",
+		"legacyish/index.html":   "not legacy",
+		"legacyish/default.asp":  "not used",
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fileServer := FileServer{
+		Root:           http.Dir(root),
+		IndexPages:     DefaultIndexPages,
+		PathIndexPages: map[string][]string{"/legacy": {"default.asp"}},
+	}
+	for i, test := range []struct {
+		url          string
+		expectedBody string
+	}{
+		{"/", "site index"},
+		{"/legacy/", "legacy index"},
+		{"/legacy/sub/", "legacy sub index"},
+		{"/legacyish/", "not legacy"},
+	} {
+		request := httptest.NewRequest("GET", test.url, nil)
+		responseRecorder := httptest.NewRecorder()
+		status, err := fileServer.ServeHTTP(responseRecorder, request)
+		if err != nil || status != http.StatusOK {
+			t.Errorf("Test %d: Expected status 200 and no error, got %d and %v", i, status, err)
+		}
+		if body := responseRecorder.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestServeHTTPHidePatterns(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_hide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"index.html":                 "index",
+		".env":                       "secret",
+		".git/config":                "secret",
+		".well-known/security.txt":   "contact",
+		"private/notes.txt":          "secret",
+		"public/private/notes.txt":   "public",
+		"backup.html.bak":            "secret",
+		"sub/.htaccess":              "secret",
+		"hiddenidx/index.html":       "secret",
+		"hiddenidx/.keep/index.html": "secret",
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fileServer := FileServer{
+		Root:         http.Dir(root),
+		IndexPages:   DefaultIndexPages,
+		HidePatterns: []string{".*", "!/.well-known", "/private", "*.bak", "/hiddenidx/index.html"},
+	}
+	for i, test := range []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/", http.StatusOK},
+		{"/.env", http.StatusNotFound},
+		{"/.git/config", http.StatusNotFound},
+		{"/.git", http.StatusNotFound},
+		{"/.well-known/security.txt", http.StatusOK},
+		{"/private/notes.txt", http.StatusNotFound},
+		{"/private", http.StatusNotFound},
+		{"/public/private/notes.txt", http.StatusOK},
+		{"/backup.html.bak", http.StatusNotFound},
+		{"/sub/.htaccess", http.StatusNotFound},
+		{"/hiddenidx/", http.StatusNotFound},
+	} {
+		request := httptest.NewRequest("GET", test.url, nil)
+		responseRecorder := httptest.NewRecorder()
+		status, _ := fileServer.ServeHTTP(responseRecorder, request)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d for %s, got %d", i, test.expectedStatus, test.url, status)
+		}
+	}
+}
+
 // Paths for the fake site used temporarily during testing.
 var (
 	webrootFile1HTML                   = filepath.Join(webrootName, "file1.html")
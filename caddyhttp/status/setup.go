@@ -26,6 +26,7 @@ func init() {
 	caddy.RegisterPlugin("status", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -49,56 +50,60 @@ func setup(c *caddy.Controller) error {
 func statusParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
 	var rules []httpserver.HandlerConfig
 
-	for c.Next() {
-		hadBlock := false
-		args := c.RemainingArgs()
+	addRule := func(status int, args []string) error {
+		basePath := args[0]
+		for _, cfg := range rules {
+			rule := cfg.(*Rule)
+			if rule.Base == basePath {
+				return c.Errf("Duplicate path: '%s'", basePath)
+			}
+		}
 
+		rule := NewRule(basePath, status)
 		switch len(args) {
 		case 1:
-			status, err := strconv.Atoi(args[0])
-			if err != nil {
-				return rules, c.Errf("Expecting a numeric status code, got '%s'", args[0])
+		case 2:
+			if args[1] != "empty" {
+				return c.ArgErr()
 			}
+			rule.Empty = true
+		default:
+			return c.ArgErr()
+		}
+		rules = append(rules, rule)
+		return nil
+	}
 
-			for c.NextBlock() {
-				hadBlock = true
-				basePath := c.Val()
-
-				for _, cfg := range rules {
-					rule := cfg.(*Rule)
-					if rule.Base == basePath {
-						return rules, c.Errf("Duplicate path: '%s'", basePath)
-					}
-				}
-
-				rule := NewRule(basePath, status)
-				rules = append(rules, rule)
+	for c.Next() {
+		hadBlock := false
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 3 {
+			return rules, c.ArgErr()
+		}
 
-				if c.NextArg() {
-					return rules, c.ArgErr()
-				}
-			}
+		status, err := strconv.Atoi(args[0])
+		if err != nil {
+			return rules, c.Errf("Expecting a numeric status code, got '%s'", args[0])
+		}
+		if status < 100 || status > 999 {
+			return rules, c.Errf("Status code out of range: %d", status)
+		}
 
-			if !hadBlock {
-				return rules, c.ArgErr()
-			}
-		case 2:
-			status, err := strconv.Atoi(args[0])
-			if err != nil {
-				return rules, c.Errf("Expecting a numeric status code, got '%s'", args[0])
+		if len(args) > 1 {
+			if err := addRule(status, args[1:]); err != nil {
+				return rules, err
 			}
+			continue
+		}
 
-			basePath := args[1]
-			for _, cfg := range rules {
-				rule := cfg.(*Rule)
-				if rule.Base == basePath {
-					return rules, c.Errf("Duplicate path: '%s'", basePath)
-				}
+		for c.NextBlock() {
+			hadBlock = true
+			if err := addRule(status, append([]string{c.Val()}, c.RemainingArgs()...)); err != nil {
+				return rules, err
 			}
+		}
 
-			rule := NewRule(basePath, status)
-			rules = append(rules, rule)
-		default:
+		if !hadBlock {
 			return rules, c.ArgErr()
 		}
 	}
@@ -59,6 +59,12 @@ func TestStatusParse(t *testing.T) {
 		{`status /foo`, true, []*Rule{}},
 		{`status bar /foo`, true, []*Rule{}},
 		{`status 404 /foo bar`, true, []*Rule{}},
+		{`status 42 /foo`, true, []*Rule{}},
+		{`status 404 /foo empty extra`, true, []*Rule{}},
+		{`status 410 /foo empty`, false, []*Rule{
+			{Base: "/foo", StatusCode: 410, Empty: true},
+		},
+		},
 		{`status 404 /foo`, false, []*Rule{
 			{Base: "/foo", StatusCode: 404},
 		},
@@ -96,6 +102,16 @@ func TestStatusParse(t *testing.T) {
 				{Base: "/bar", StatusCode: 404},
 			},
 		},
+		{`status 403 {
+			/foo empty
+			/bar
+		 }`,
+			false,
+			[]*Rule{
+				{Base: "/foo", StatusCode: 403, Empty: true},
+				{Base: "/bar", StatusCode: 403},
+			},
+		},
 	}
 
 	for i, test := range tests {
@@ -140,6 +156,11 @@ func TestStatusParse(t *testing.T) {
 				t.Errorf("Test %d: Expected status code %d for path '%s'. Got %d",
 					i, expectedRule.StatusCode, expectedRule.Base, actualRule.StatusCode)
 			}
+
+			if actualRule.Empty != expectedRule.Empty {
+				t.Errorf("Test %d: Expected empty %v for path '%s'. Got %v",
+					i, expectedRule.Empty, expectedRule.Base, actualRule.Empty)
+			}
 		}
 	}
 }
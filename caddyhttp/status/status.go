@@ -29,6 +29,10 @@ type Rule struct {
 	// Status code to return
 	StatusCode int
 
+	// Empty makes error status codes be answered with an
+	// empty body instead of going to the error handlers
+	Empty bool
+
 	// Request matcher
 	httpserver.RequestMatcher
 }
@@ -58,7 +62,7 @@ func (status Status) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, err
 	if cfg := httpserver.ConfigSelector(status.Rules).Select(r); cfg != nil {
 		rule := cfg.(*Rule)
 
-		if rule.StatusCode < 400 {
+		if rule.StatusCode < 400 || rule.Empty {
 			// There's no ability to return response body --
 			// write the response status code in header and signal
 			// to other handlers that response is already handled
@@ -24,12 +24,16 @@ import (
 )
 
 func TestStatus(t *testing.T) {
+	gone := NewRule("/gone", http.StatusGone)
+	gone.Empty = true
+
 	status := Status{
 		Rules: []httpserver.HandlerConfig{
 			NewRule("/foo", http.StatusNotFound),
 			NewRule("/teapot", http.StatusTeapot),
 			NewRule("/foo/bar1", http.StatusInternalServerError),
 			NewRule("/temporary-redirected", http.StatusTemporaryRedirect),
+			gone,
 		},
 		Next: httpserver.HandlerFunc(urlPrinter),
 	}
@@ -45,6 +49,7 @@ func TestStatus(t *testing.T) {
 		{"/foo/bar1", true, http.StatusInternalServerError},
 		{"/someotherpath", false, 0},
 		{"/temporary-redirected", false, http.StatusTemporaryRedirect},
+		{"/gone", false, http.StatusGone},
 	}
 
 	for i, test := range tests {
@@ -0,0 +1,133 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subfilter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("sub_filter", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// Defaults of sub_filter.
+const (
+	DefaultType    = "text/html"
+	DefaultMaxSize = 10 << 20
+)
+
+// setup configures a new SubFilter middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := subFilterParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SubFilter{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func subFilterParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/", MaxSize: DefaultMaxSize}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		case 2:
+			rule.Replacements = append(rule.Replacements, Replacement{From: args[0], To: args[1]})
+		case 3:
+			rule.Path = args[0]
+			rule.Replacements = append(rule.Replacements, Replacement{From: args[1], To: args[2]})
+		default:
+			return rules, c.ArgErr()
+		}
+		for _, r := range rules {
+			if r.Path == rule.Path {
+				return rules, c.Errf("duplicate sub_filter path '%s'", rule.Path)
+			}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "types":
+				if len(args) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, t := range args {
+					rule.Types = append(rule.Types, strings.ToLower(t))
+				}
+			case "replace":
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				if args[0] == "" {
+					return rules, c.Err("cannot replace an empty string")
+				}
+				rule.Replacements = append(rule.Replacements, Replacement{From: args[0], To: args[1]})
+			case "regex":
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				re, err := regexp.Compile(args[0])
+				if err != nil {
+					return rules, c.Errf("invalid regex '%s': %v", args[0], err)
+				}
+				rule.Replacements = append(rule.Replacements, Replacement{Regexp: re, To: args[1]})
+			case "max_size":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				size, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil || size <= 0 {
+					return rules, c.Errf("invalid max_size '%s'", args[0])
+				}
+				rule.MaxSize = size
+			default:
+				return rules, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+
+		if len(rule.Replacements) == 0 {
+			return rules, c.Err("sub_filter needs at least one replacement")
+		}
+		if len(rule.Types) == 0 {
+			rule.Types = []string{DefaultType}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subfilter
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `sub_filter http://old https://new`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SubFilter)
+	if !ok {
+		t.Fatalf("Expected handler to be type SubFilter, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSubFilterParse(t *testing.T) {
+	rules, err := subFilterParse(caddy.NewTestController("http", `sub_filter /app http://legacy {scheme}://{host} {
+		types text/html Application/JavaScript
+		replace foo bar
+		regex "href=\"/([a-z]+)\"" "href=\"/app/$1\""
+		max_size 1024
+	}
+	sub_filter a b`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+
+	rule := rules[0]
+	if rule.Path != "/app" || rule.MaxSize != 1024 {
+		t.Errorf("Expected path /app and max size 1024, got %s and %d", rule.Path, rule.MaxSize)
+	}
+	if len(rule.Types) != 2 || rule.Types[1] != "application/javascript" {
+		t.Errorf("Expected 2 lowercase types, got %v", rule.Types)
+	}
+	if len(rule.Replacements) != 3 {
+		t.Fatalf("Expected 3 replacements, got %d", len(rule.Replacements))
+	}
+	if r := rule.Replacements[0]; r.From != "http://legacy" || r.To != "{scheme}://{host}" || r.Regexp != nil {
+		t.Errorf("Expected the replacement from the arguments first, got %#v", r)
+	}
+	if r := rule.Replacements[2]; r.Regexp == nil || r.Regexp.String() != regexp.MustCompile(`href="/([a-z]+)"`).String() {
+		t.Errorf("Expected a regex replacement, got %#v", r)
+	}
+
+	if rules[1].Path != "/" || len(rules[1].Types) != 1 || rules[1].Types[0] != DefaultType || rules[1].MaxSize != DefaultMaxSize {
+		t.Errorf("Expected defaults, got %#v", rules[1])
+	}
+
+	for i, input := range []string{
+		`sub_filter`,
+		`sub_filter /app`,
+		`sub_filter / a b c`,
+		`sub_filter {
+			replace a
+		}`,
+		`sub_filter {
+			replace "" a
+		}`,
+		`sub_filter {
+			regex ( a
+		}`,
+		`sub_filter a b {
+			types
+		}`,
+		`sub_filter a b {
+			max_size big
+		}`,
+		`sub_filter a b {
+			unknown
+		}`,
+		`sub_filter a b
+		sub_filter c d`,
+	} {
+		if _, err := subFilterParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
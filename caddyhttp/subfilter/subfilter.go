@@ -0,0 +1,201 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package subfilter provides middleware that substitutes
+// strings in response bodies.
+package subfilter
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// SubFilter is middleware that performs replacements in the
+// bodies of responses.
+type SubFilter struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the set of replacements for responses to requests
+// under Path.
+type Rule struct {
+	Path string
+
+	// Types are the media types of the responses that are
+	// filtered, like text/html.
+	Types []string
+
+	// Replacements are performed in order.
+	Replacements []Replacement
+
+	// MaxSize is the largest body that is filtered; larger
+	// ones are passed through unchanged since they have to
+	// be held in memory.
+	MaxSize int64
+}
+
+// Replacement replaces From, or matches of Regexp if it is
+// not nil, with To. To may contain placeholders and, for
+// regular expressions, references to submatches like $1.
+type Replacement struct {
+	From   string
+	Regexp *regexp.Regexp
+	To     string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SubFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range s.Rules {
+		if httpserver.Path(r.URL.Path).Matches(s.Rules[i].Path) &&
+			(rule == nil || len(s.Rules[i].Path) > len(rule.Path)) {
+			rule = &s.Rules[i]
+		}
+	}
+	if rule == nil {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	// ask for the whole, uncompressed body, since compressed
+	// or partial bodies cannot be filtered
+	r.Header.Del("Accept-Encoding")
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+
+	fw := &filterWriter{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		rule:                  rule,
+		head:                  r.Method == "HEAD",
+	}
+	status, err := s.Next.ServeHTTP(fw, r)
+	if !fw.filtering {
+		return status, err
+	}
+
+	body := fw.body.Bytes()
+	repl := httpserver.NewReplacer(r, nil, "")
+	for _, rep := range rule.Replacements {
+		to := repl.Replace(rep.To)
+		if rep.Regexp != nil {
+			body = rep.Regexp.ReplaceAll(body, []byte(to))
+		} else {
+			body = bytes.Replace(body, []byte(rep.From), []byte(to), -1)
+		}
+	}
+
+	// the new body is a different representation
+	fw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	fw.Header().Del("ETag")
+	fw.ResponseWriterWrapper.WriteHeader(fw.status)
+	if _, err := fw.ResponseWriterWrapper.Write(body); err != nil {
+		return 0, err
+	}
+	return 0, err
+}
+
+// filterWriter holds back the body of responses that are to be
+// filtered, and passes the others through.
+type filterWriter struct {
+	*httpserver.ResponseWriterWrapper
+	rule        *Rule
+	head        bool
+	status      int
+	wroteHeader bool
+	filtering   bool
+	body        bytes.Buffer
+}
+
+func (fw *filterWriter) WriteHeader(status int) {
+	if fw.wroteHeader {
+		return
+	}
+	fw.status = status
+	fw.wroteHeader = true
+	fw.filtering = fw.filterable(status)
+	if fw.filtering && fw.head {
+		// there is no body to filter, so the length
+		// of the filtered one is not known
+		fw.filtering = false
+		fw.Header().Del("Content-Length")
+		fw.Header().Del("ETag")
+	}
+	if !fw.filtering {
+		fw.ResponseWriterWrapper.WriteHeader(status)
+	}
+}
+
+// filterable reports whether a response with status and the
+// headers as they are now can be filtered.
+func (fw *filterWriter) filterable(status int) bool {
+	if status < 200 || status == http.StatusNoContent || status == http.StatusPartialContent ||
+		status == http.StatusNotModified {
+		return false
+	}
+	h := fw.Header()
+	if enc := h.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+	if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && cl > fw.rule.MaxSize {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range fw.rule.Types {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (fw *filterWriter) Write(p []byte) (int, error) {
+	if fw.Header().Get("Content-Type") == "" {
+		fw.Header().Set("Content-Type", http.DetectContentType(p))
+	}
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if !fw.filtering {
+		return fw.ResponseWriterWrapper.Write(p)
+	}
+	if int64(fw.body.Len()+len(p)) > fw.rule.MaxSize {
+		// too large after all; send what we have as it is
+		fw.filtering = false
+		fw.ResponseWriterWrapper.WriteHeader(fw.status)
+		if _, err := fw.ResponseWriterWrapper.Write(fw.body.Bytes()); err != nil {
+			return 0, err
+		}
+		fw.body.Reset()
+		return fw.ResponseWriterWrapper.Write(p)
+	}
+	return fw.body.Write(p)
+}
+
+// Flush does nothing while the body is held back.
+func (fw *filterWriter) Flush() {
+	if fw.wroteHeader && !fw.filtering {
+		fw.ResponseWriterWrapper.Flush()
+	}
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*filterWriter)(nil)
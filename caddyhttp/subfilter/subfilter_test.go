@@ -0,0 +1,129 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSubFilter(t *testing.T) {
+	var acceptEncoding string
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		switch r.URL.Path {
+		case "/missing":
+			return http.StatusNotFound, nil
+		case "/gzipped":
+			w.Header().Set("Content-Encoding", "gzip")
+		case "/js":
+			w.Header().Set("Content-Type", "application/javascript")
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			for i := 0; i < 10; i++ {
+				w.Write([]byte("http://legacy/ "))
+			}
+			return 0, nil
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		body := `<a href="http://legacy/page">link</a> <script nonce="NONCE">`
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+		return 0, nil
+	})
+	s := SubFilter{
+		Next: next,
+		Rules: []Rule{{
+			Path:  "/",
+			Types: []string{"text/html"},
+			Replacements: []Replacement{
+				{From: "http://legacy", To: "https://{host}"},
+				{Regexp: regexp.MustCompile(`href="([^"]+)/page"`), To: `href="$1/new"`},
+				{From: "NONCE", To: "{csp_nonce}"},
+			},
+			MaxSize: 100,
+		}},
+	}
+
+	for i, test := range []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{"/", http.StatusOK, `<a href="https://example.com/new">link</a> <script nonce="abc123">`},
+		{"/js", http.StatusOK, `<a href="http://legacy/page">link</a> <script nonce="NONCE">`},
+		{"/gzipped", http.StatusOK, `<a href="http://legacy/page">link</a> <script nonce="NONCE">`},
+		{"/large", http.StatusOK, strings.Repeat("http://legacy/ ", 10)},
+		{"/missing", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest("GET", "http://example.com"+test.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		repl := httpserver.NewReplacer(r, nil, "")
+		repl.Set("csp_nonce", "abc123")
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, repl))
+		w := httptest.NewRecorder()
+
+		status, err := s.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		if got := w.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expected, got)
+		}
+		if acceptEncoding != "" {
+			t.Errorf("Test %d: Expected Accept-Encoding to be removed, got '%s'", i, acceptEncoding)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("Test %d: Expected Content-Length %d, got %s", i, w.Body.Len(), cl)
+		}
+	}
+
+	// filtered responses lose their ETag
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if etag := w.Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected ETag to be removed, got '%s'", etag)
+	}
+
+	// HEAD responses have no body to filter, so they don't
+	// claim the length of the unfiltered one
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("HEAD", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for HEAD, got %d", http.StatusOK, w.Code)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Expected no Content-Length for HEAD, got '%s'", cl)
+	}
+	if etag := w.Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected ETag to be removed for HEAD, got '%s'", etag)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package symlinks implements the symlinks directive, which
+// controls whether symbolic links under the site root are
+// followed, to keep files outside of it from being served.
+package symlinks
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("symlinks", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+var policies = map[string]httpserver.SymlinkPolicy{
+	"always":      httpserver.SymlinksAlways,
+	"within_root": httpserver.SymlinksWithinRoot,
+	"never":       httpserver.SymlinksNever,
+}
+
+// setup sets the symlink policy of the site.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		policy, ok := policies[args[0]]
+		if !ok {
+			return c.Errf("unknown symlink policy '%s'; must be always, within_root or never", args[0])
+		}
+		cfg.Symlinks = policy
+	}
+
+	return nil
+}
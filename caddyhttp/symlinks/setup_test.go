@@ -0,0 +1,57 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package symlinks
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.SymlinkPolicy
+	}{
+		{input: `symlinks always`, expected: httpserver.SymlinksAlways},
+		{input: `symlinks within_root`, expected: httpserver.SymlinksWithinRoot},
+		{input: `symlinks never`, expected: httpserver.SymlinksNever},
+		{input: `symlinks`, shouldErr: true},
+		{input: `symlinks sometimes`, shouldErr: true},
+		{input: `symlinks never always`, shouldErr: true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		cfg := httpserver.GetConfig(c)
+		if cfg.Symlinks != test.expected {
+			t.Errorf("Test %d: Expected policy %v, got %v", i, test.expected, cfg.Symlinks)
+		}
+		if _, ok := cfg.SiteFileSystem().(httpserver.SymlinkDir); ok != (test.expected != httpserver.SymlinksAlways) {
+			t.Errorf("Test %d: Unexpected site file system %T", i, cfg.SiteFileSystem())
+		}
+	}
+}
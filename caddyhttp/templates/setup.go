@@ -16,7 +16,6 @@ package templates
 
 import (
 	"bytes"
-	"net/http"
 	"sync"
 
 	"github.com/mholt/caddy"
@@ -27,6 +26,7 @@ func init() {
 	caddy.RegisterPlugin("templates", caddy.Plugin{
 		ServerType: "http",
 		Action:     setup,
+		Concurrent: true,
 	})
 }
 
@@ -42,7 +42,7 @@ func setup(c *caddy.Controller) error {
 	tmpls := Templates{
 		Rules:   rules,
 		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		FileSys: cfg.SiteFileSystem(),
 		BufPool: &sync.Pool{
 			New: func() interface{} {
 				return new(bytes.Buffer)
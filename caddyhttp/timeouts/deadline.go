@@ -0,0 +1,34 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.20
+
+package timeouts
+
+import (
+	"net/http"
+	"time"
+)
+
+// setReadDeadline sets the read deadline of the
+// connection the response w is written to.
+func setReadDeadline(w http.ResponseWriter, t time.Time) error {
+	return http.NewResponseController(w).SetReadDeadline(t)
+}
+
+// setWriteDeadline sets the write deadline of the
+// connection the response w is written to.
+func setWriteDeadline(w http.ResponseWriter, t time.Time) error {
+	return http.NewResponseController(w).SetWriteDeadline(t)
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.20
+
+package timeouts
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTimeoutsDeadlines(t *testing.T) {
+	handler := Timeouts{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/export", Write: 10 * time.Second, WriteSet: true},
+			{Path: "/", Write: 20 * time.Millisecond, WriteSet: true},
+		},
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(httpserver.NewResponseRecorder(w), r)
+	}))
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	// the longer timeout for the path outlasts the server's
+	resp, err := http.Get(ts.URL + "/export/all")
+	if err != nil {
+		t.Fatalf("Expected response for /export, got error: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "done" {
+		t.Errorf("Expected body 'done' for /export, got '%s' (error: %v)", body, err)
+	}
+
+	// and the shorter one elsewhere cuts the response off
+	resp, err = http.Get(ts.URL + "/")
+	if err == nil {
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Errorf("Expected write timeout for /, got body '%s'", body)
+	}
+}
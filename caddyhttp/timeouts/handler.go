@@ -0,0 +1,79 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeouts
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Rule overrides the read and write timeouts of
+// the server for requests for a path, and how long
+// a proxy waits for the response of its upstream.
+type Rule struct {
+	Path        string
+	Read        time.Duration
+	ReadSet     bool
+	Write       time.Duration
+	WriteSet    bool
+	Upstream    time.Duration
+	UpstreamSet bool
+}
+
+// Timeouts is middleware that applies per-path timeouts
+// to requests. Rules are matched longest path first.
+type Timeouts struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// ServeHTTP implements the httpserver.Handler interface. The
+// deadlines only last for this request; the server resets them
+// before reading the next request on the connection.
+func (t Timeouts) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range t.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		if rule.ReadSet {
+			if err := setReadDeadline(w, deadline(rule.Read)); err != nil {
+				log.Printf("[WARNING] Setting read timeout for %s: %v", r.URL.Path, err)
+			}
+		}
+		if rule.WriteSet {
+			if err := setWriteDeadline(w, deadline(rule.Write)); err != nil {
+				log.Printf("[WARNING] Setting write timeout for %s: %v", r.URL.Path, err)
+			}
+		}
+		if rule.UpstreamSet {
+			r = r.WithContext(context.WithValue(r.Context(), httpserver.UpstreamTimeoutCtxKey, rule.Upstream))
+		}
+		break
+	}
+	return t.Next.ServeHTTP(w, r)
+}
+
+// deadline returns the deadline for a timeout of dur
+// from now, where 0 means no deadline at all.
+func deadline(dur time.Duration) time.Time {
+	if dur == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(dur)
+}
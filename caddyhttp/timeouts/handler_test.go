@@ -0,0 +1,52 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeouts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTimeoutsUpstream(t *testing.T) {
+	var got time.Duration
+	handler := Timeouts{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			got, _ = r.Context().Value(httpserver.UpstreamTimeoutCtxKey).(time.Duration)
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/export", Upstream: 10 * time.Minute, UpstreamSet: true},
+			{Path: "/", Read: time.Minute},
+		},
+	}
+
+	for i, test := range []struct {
+		path     string
+		expected time.Duration
+	}{
+		{"/export/all", 10 * time.Minute},
+		{"/", 0},
+	} {
+		got = 0
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if got != test.expected {
+			t.Errorf("Test %d: Expected upstream timeout %v, got %v", i, test.expected, got)
+		}
+	}
+}
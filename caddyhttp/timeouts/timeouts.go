@@ -15,6 +15,9 @@
 package timeouts
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/mholt/caddy"
@@ -30,39 +33,33 @@ func init() {
 
 func setupTimeouts(c *caddy.Controller) error {
 	config := httpserver.GetConfig(c)
+	var rules []Rule
 
 	for c.Next() {
-		var hasOptionalBlock bool
-		for c.NextBlock() {
-			hasOptionalBlock = true
-
-			// ensure the kind of timeout is recognized
-			kind := c.Val()
-			if kind != "read" && kind != "header" && kind != "write" && kind != "idle" {
-				return c.Errf("unknown timeout '%s': must be read, header, write, or idle", kind)
-			}
+		args := c.RemainingArgs()
 
-			// parse the timeout duration
-			if !c.NextArg() {
-				return c.ArgErr()
-			}
-			if c.NextArg() {
-				// only one value permitted
-				return c.ArgErr()
-			}
-			var dur time.Duration
-			if c.Val() != "none" {
-				var err error
-				dur, err = time.ParseDuration(c.Val())
-				if err != nil {
-					return c.Errf("%v", err)
-				}
-				if dur < 0 {
-					return c.Err("non-negative duration required for timeout value")
+		// a leading path scopes the timeouts to requests
+		// for that path instead of the whole site
+		var rule *Rule
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule = &Rule{Path: args[0]}
+			args = args[1:]
+		}
+
+		set := func(kind string, dur time.Duration) error {
+			if rule != nil {
+				switch kind {
+				case "read":
+					rule.Read, rule.ReadSet = dur, true
+				case "write":
+					rule.Write, rule.WriteSet = dur, true
+				case "upstream":
+					rule.Upstream, rule.UpstreamSet = dur, true
+				default:
+					return c.Errf("timeout '%s' cannot be set for a path: must be read, write, or upstream", kind)
 				}
+				return nil
 			}
-
-			// set this timeout's duration
 			switch kind {
 			case "read":
 				config.Timeouts.ReadTimeout = dur
@@ -76,45 +73,97 @@ func setupTimeouts(c *caddy.Controller) error {
 			case "idle":
 				config.Timeouts.IdleTimeout = dur
 				config.Timeouts.IdleTimeoutSet = true
+			case "upstream":
+				return c.Err("timeout 'upstream' can only be set for a path")
 			}
+			return nil
 		}
-		if !hasOptionalBlock {
-			// set all timeouts to the same value
 
-			if !c.NextArg() {
-				return c.ArgErr()
+		switch len(args) {
+		case 0:
+			var hasOptionalBlock bool
+			for c.NextBlock() {
+				hasOptionalBlock = true
+
+				// ensure the kind of timeout is recognized
+				kind := c.Val()
+				if kind != "read" && kind != "header" && kind != "write" && kind != "idle" && kind != "upstream" {
+					return c.Errf("unknown timeout '%s': must be read, header, write, idle, or upstream", kind)
+				}
+
+				// parse the timeout duration
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				if c.NextArg() {
+					// only one value permitted
+					return c.ArgErr()
+				}
+				dur, err := parseTimeout(c.Val())
+				if err != nil {
+					return c.Err(err.Error())
+				}
+
+				// set this timeout's duration
+				if err := set(kind, dur); err != nil {
+					return err
+				}
 			}
-			if c.NextArg() {
-				// only one value permitted
+			if !hasOptionalBlock {
 				return c.ArgErr()
 			}
-			val := c.Val()
-
-			config.Timeouts.ReadTimeoutSet = true
-			config.Timeouts.ReadHeaderTimeoutSet = true
-			config.Timeouts.WriteTimeoutSet = true
-			config.Timeouts.IdleTimeoutSet = true
-
-			if val == "none" {
-				config.Timeouts.ReadTimeout = 0
-				config.Timeouts.ReadHeaderTimeout = 0
-				config.Timeouts.WriteTimeout = 0
-				config.Timeouts.IdleTimeout = 0
-			} else {
-				dur, err := time.ParseDuration(val)
-				if err != nil {
-					return c.Errf("unknown timeout duration: %v", err)
+		case 1:
+			// set all timeouts to the same value
+			dur, err := parseTimeout(args[0])
+			if err != nil {
+				return c.Errf("unknown timeout duration: %v", err)
+			}
+			for _, kind := range []string{"read", "header", "write", "idle", "upstream"} {
+				if rule != nil && (kind == "header" || kind == "idle") {
+					continue
 				}
-				if dur < 0 {
-					return c.Err("non-negative duration required for timeout value")
+				if rule == nil && kind == "upstream" {
+					continue
+				}
+				if err := set(kind, dur); err != nil {
+					return err
 				}
-				config.Timeouts.ReadTimeout = dur
-				config.Timeouts.ReadHeaderTimeout = dur
-				config.Timeouts.WriteTimeout = dur
-				config.Timeouts.IdleTimeout = dur
 			}
+		default:
+			// only one value permitted
+			return c.ArgErr()
+		}
+
+		if rule != nil {
+			rules = append(rules, *rule)
 		}
 	}
 
+	if len(rules) > 0 {
+		// the longest path matches first
+		sort.SliceStable(rules, func(i, j int) bool {
+			return len(rules[i].Path) > len(rules[j].Path)
+		})
+		config.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+			return Timeouts{Next: next, Rules: rules}
+		})
+	}
+
 	return nil
 }
+
+// parseTimeout parses a timeout duration, where "none"
+// means no timeout.
+func parseTimeout(val string) (time.Duration, error) {
+	if val == "none" {
+		return 0, nil
+	}
+	dur, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if dur < 0 {
+		return 0, errors.New("non-negative duration required for timeout value")
+	}
+	return dur, nil
+}
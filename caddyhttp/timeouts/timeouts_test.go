@@ -40,6 +40,13 @@ func TestSetupTimeouts(t *testing.T) {
 		{input: "timeouts { \n read \n }", shouldErr: true},
 		{input: "timeouts { \n read 1s 2s \n }", shouldErr: true},
 		{input: "timeouts { \n foo \n }", shouldErr: true},
+		{input: "timeouts /export 10m", shouldErr: false},
+		{input: "timeouts /export { \n write 10m \n read none \n }", shouldErr: false},
+		{input: "timeouts /export { \n idle 10m \n }", shouldErr: true},
+		{input: "timeouts /export { \n upstream 10m \n }", shouldErr: false},
+		{input: "timeouts { \n upstream 10m \n }", shouldErr: true},
+		{input: "timeouts /export", shouldErr: true},
+		{input: "timeouts /export 1s 2s", shouldErr: true},
 	}
 	for i, tc := range testCases {
 		controller := caddy.NewTestController("", tc.input)
@@ -159,3 +166,40 @@ func TestTimeoutsSetProperly(t *testing.T) {
 		}
 	}
 }
+
+func TestTimeoutsForPath(t *testing.T) {
+	controller := caddy.NewTestController("", `timeouts 30s
+	timeouts /export/all {
+		read none
+	}
+	timeouts /export 10m`)
+	if err := setupTimeouts(controller); err != nil {
+		t.Fatalf("Did not expect error, but got: %v", err)
+	}
+	cfg := httpserver.GetConfig(controller)
+	if got, want := cfg.Timeouts.WriteTimeout, 30*time.Second; got != want {
+		t.Errorf("Expected site WriteTimeout=%v, got %v", want, got)
+	}
+
+	mids := cfg.Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Timeouts)
+	if !ok {
+		t.Fatalf("Expected handler to be type Timeouts, got: %#v", handler)
+	}
+	expected := []Rule{
+		{Path: "/export/all", Read: 0, ReadSet: true},
+		{Path: "/export", Read: 10 * time.Minute, ReadSet: true, Write: 10 * time.Minute, WriteSet: true,
+			Upstream: 10 * time.Minute, UpstreamSet: true},
+	}
+	if len(handler.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(handler.Rules))
+	}
+	for i, rule := range handler.Rules {
+		if rule != expected[i] {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, expected[i], rule)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package useragent
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("user_agent", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new UserAgent middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := userAgentParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return UserAgent{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func userAgentParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{
+			Path:            "/",
+			BlockStatus:     http.StatusForbidden,
+			ChallengeStatus: http.StatusTooManyRequests,
+		}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+		for _, r := range rules {
+			if r.Path == rule.Path {
+				return rules, c.Errf("duplicate user_agent path '%s'", rule.Path)
+			}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return rules, c.ArgErr()
+			}
+
+			switch what {
+			case "allow":
+				pattern, err := compile(c, args[0])
+				if err != nil {
+					return rules, err
+				}
+				bot := GoodBot{Pattern: pattern, verified: new(verifyCache)}
+				for _, d := range args[1:] {
+					bot.Domains = append(bot.Domains, strings.ToLower(strings.Trim(d, ".")))
+				}
+				rule.Allow = append(rule.Allow, bot)
+			case "block", "challenge":
+				for _, arg := range args {
+					pattern, err := compile(c, arg)
+					if err != nil {
+						return rules, err
+					}
+					if what == "block" {
+						rule.Block = append(rule.Block, pattern)
+					} else {
+						rule.Challenge = append(rule.Challenge, pattern)
+					}
+				}
+			case "tag":
+				if len(args) < 2 {
+					return rules, c.ArgErr()
+				}
+				for _, arg := range args[1:] {
+					pattern, err := compile(c, arg)
+					if err != nil {
+						return rules, err
+					}
+					rule.Tags = append(rule.Tags, Tag{Name: args[0], Pattern: pattern})
+				}
+			case "block_status", "challenge_status":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				status, err := strconv.Atoi(args[0])
+				if err != nil || status < 400 || status > 599 {
+					return rules, c.Errf("%s must be an error status code, got '%s'", what, args[0])
+				}
+				if what == "block_status" {
+					rule.BlockStatus = status
+				} else {
+					rule.ChallengeStatus = status
+				}
+			default:
+				return rules, c.Errf("unknown subdirective: %s", what)
+			}
+		}
+
+		if len(rule.Block) == 0 && len(rule.Challenge) == 0 && len(rule.Tags) == 0 && len(rule.Allow) == 0 {
+			return rules, c.Err("user_agent needs at least one of allow, block, challenge or tag")
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// compile compiles a user agent pattern, which is a
+// case-insensitive regular expression.
+func compile(c *caddy.Controller, pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, c.Errf("invalid user agent pattern '%s': %v", pattern, err)
+	}
+	return re, nil
+}
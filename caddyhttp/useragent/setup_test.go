@@ -0,0 +1,131 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package useragent
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `user_agent {
+		block curl
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(UserAgent)
+	if !ok {
+		t.Fatalf("Expected handler to be type UserAgent, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestUserAgentParse(t *testing.T) {
+	rules, err := userAgentParse(caddy.NewTestController("http", `user_agent /blog {
+		allow Googlebot googlebot.com. Google.com
+		allow "Uptime Monitor"
+		block GPTBot ^$
+		challenge python-requests
+		tag ai GPTBot ClaudeBot
+		block_status 404
+		challenge_status 503
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 rule, got %d", len(rules))
+	}
+	rule := rules[0]
+	if rule.Path != "/blog" {
+		t.Errorf("Expected path /blog, got %s", rule.Path)
+	}
+	if len(rule.Allow) != 2 || len(rule.Allow[1].Domains) != 0 {
+		t.Fatalf("Expected 2 good bots, the second unverified, got %#v", rule.Allow)
+	}
+	if got := rule.Allow[0].Domains; len(got) != 2 || got[0] != "googlebot.com" || got[1] != "google.com" {
+		t.Errorf("Expected normalized domains, got %v", got)
+	}
+	if !rule.Allow[0].Pattern.MatchString("Mozilla/5.0 (compatible; googlebot/2.1)") {
+		t.Error("Expected patterns to be case-insensitive")
+	}
+	if len(rule.Block) != 2 || !rule.Block[1].MatchString("") {
+		t.Errorf("Expected 2 block patterns, the second matching empty user agents, got %v", rule.Block)
+	}
+	if len(rule.Challenge) != 1 || len(rule.Tags) != 2 || rule.Tags[1].Name != "ai" {
+		t.Errorf("Expected 1 challenge pattern and 2 tags, got %v and %v", rule.Challenge, rule.Tags)
+	}
+	if rule.BlockStatus != 404 || rule.ChallengeStatus != 503 {
+		t.Errorf("Expected statuses 404 and 503, got %d and %d", rule.BlockStatus, rule.ChallengeStatus)
+	}
+
+	rules, err = userAgentParse(caddy.NewTestController("http", `user_agent {
+		block curl
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rules[0].Path != "/" || rules[0].BlockStatus != http.StatusForbidden || rules[0].ChallengeStatus != http.StatusTooManyRequests {
+		t.Errorf("Expected defaults, got %#v", rules[0])
+	}
+
+	for i, input := range []string{
+		`user_agent`,
+		`user_agent / /extra {
+			block curl
+		}`,
+		`user_agent {
+			block (
+		}`,
+		`user_agent {
+			tag ai
+		}`,
+		`user_agent {
+			block curl
+			block_status 200
+		}`,
+		`user_agent {
+			block
+		}`,
+		`user_agent {
+			unknown curl
+		}`,
+		`user_agent {
+			block curl
+		}
+		user_agent {
+			block wget
+		}`,
+	} {
+		if _, err := userAgentParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
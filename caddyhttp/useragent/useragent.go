@@ -0,0 +1,212 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package useragent provides middleware that blocks, challenges
+// or tags requests by their User-Agent, letting good bots through
+// after verifying them by reverse DNS.
+package useragent
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// UserAgent is middleware that filters requests by User-Agent.
+type UserAgent struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the filter for requests under Path. Good bots are
+// checked first, then Block and then Challenge patterns.
+type Rule struct {
+	Path string
+
+	// Allow are good bots, which are never blocked or
+	// challenged; a request claiming to be one but failing
+	// its verification is blocked.
+	Allow []GoodBot
+
+	// Block and Challenge are patterns of user agents that
+	// get BlockStatus or ChallengeStatus as a response.
+	Block           []*regexp.Regexp
+	Challenge       []*regexp.Regexp
+	BlockStatus     int
+	ChallengeStatus int
+
+	// Tags name the user agents they match in the
+	// {user_agent_tag} placeholder; the first match wins.
+	Tags []Tag
+}
+
+// GoodBot is a user agent allowed through a Rule.
+type GoodBot struct {
+	Pattern *regexp.Regexp
+
+	// Domains, if not empty, are where the client IP must
+	// reverse resolve to, with the name resolving back to
+	// the same IP, for the user agent to be believed.
+	Domains []string
+
+	verified *verifyCache
+}
+
+// Tag is a name for the user agents matching Pattern.
+type Tag struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (u UserAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range u.Rules {
+		if httpserver.Path(r.URL.Path).Matches(u.Rules[i].Path) &&
+			(rule == nil || len(u.Rules[i].Path) > len(rule.Path)) {
+			rule = &u.Rules[i]
+		}
+	}
+	if rule == nil {
+		return u.Next.ServeHTTP(w, r)
+	}
+
+	ua := r.UserAgent()
+	for _, tag := range rule.Tags {
+		if tag.Pattern.MatchString(ua) {
+			if repl, ok := r.Context().Value(httpserver.ReplacerCtxKey).(httpserver.Replacer); ok {
+				repl.Set("user_agent_tag", tag.Name)
+			}
+			break
+		}
+	}
+
+	for _, bot := range rule.Allow {
+		if bot.Pattern.MatchString(ua) {
+			if len(bot.Domains) > 0 && !bot.verify(hostOnly(r.RemoteAddr)) {
+				return rule.BlockStatus, nil
+			}
+			return u.Next.ServeHTTP(w, r)
+		}
+	}
+	if matchAny(rule.Block, ua) {
+		return rule.BlockStatus, nil
+	}
+	if matchAny(rule.Challenge, ua) {
+		return rule.ChallengeStatus, nil
+	}
+
+	return u.Next.ServeHTTP(w, r)
+}
+
+func matchAny(patterns []*regexp.Regexp, ua string) bool {
+	for _, p := range patterns {
+		if p.MatchString(ua) {
+			return true
+		}
+	}
+	return false
+}
+
+// These are variables so tests can replace them.
+var (
+	lookupAddr = net.LookupAddr
+	lookupHost = net.LookupHost
+)
+
+// verify reports whether ip belongs to one of the bot's
+// domains: its reverse DNS name must be in one of them and
+// resolve back to ip. Results are cached for a while, since
+// bots come back often and the lookups are slow.
+func (b GoodBot) verify(ip string) bool {
+	if ok, cached := b.verified.get(ip); cached {
+		return ok
+	}
+	ok := false
+	names, _ := lookupAddr(ip)
+Names:
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !inDomains(name, b.Domains) {
+			continue
+		}
+		addrs, _ := lookupHost(name)
+		for _, addr := range addrs {
+			if addr == ip {
+				ok = true
+				break Names
+			}
+		}
+	}
+	b.verified.put(ip, ok)
+	return ok
+}
+
+func inDomains(name string, domains []string) bool {
+	for _, d := range domains {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCacheTTL is how long verification results are kept,
+// and verifyCacheMax how many before all are dropped.
+const (
+	verifyCacheTTL = 10 * time.Minute
+	verifyCacheMax = 10000
+)
+
+type verifyCache struct {
+	mu      sync.Mutex
+	results map[string]verification
+}
+
+type verification struct {
+	ok      bool
+	expires time.Time
+}
+
+func (c *verifyCache) get(ip string) (ok, cached bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, cached := c.results[ip]
+	if !cached || time.Now().After(v.expires) {
+		return false, false
+	}
+	return v.ok, true
+}
+
+func (c *verifyCache) put(ip string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil || len(c.results) >= verifyCacheMax {
+		c.results = make(map[string]verification)
+	}
+	c.results[ip] = verification{ok: ok, expires: time.Now().Add(verifyCacheTTL)}
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package useragent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestUserAgent(t *testing.T) {
+	defer func(addr, host func(string) ([]string, error)) {
+		lookupAddr, lookupHost = addr, host
+	}(lookupAddr, lookupHost)
+
+	lookups := 0
+	lookupAddr = func(ip string) ([]string, error) {
+		lookups++
+		switch ip {
+		case "66.249.66.1":
+			return []string{"crawl-66-249-66-1.googlebot.com."}, nil
+		case "10.0.0.1":
+			// claims the domain, but does not resolve back
+			return []string{"fake.googlebot.com."}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	lookupHost = func(name string) ([]string, error) {
+		if name == "crawl-66-249-66-1.googlebot.com" {
+			return []string{"66.249.66.1"}, nil
+		}
+		return []string{"192.0.2.1"}, nil
+	}
+
+	rules, err := userAgentParse(caddy.NewTestController("http", `user_agent {
+		allow Googlebot googlebot.com
+		allow Monitor
+		block GPTBot Googlebot ^$
+		challenge python
+		tag ai GPTBot
+		tag search Googlebot
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := UserAgent{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Rules: rules,
+	}
+
+	for i, test := range []struct {
+		ua, remoteAddr string
+		status         int
+		tag            string
+	}{
+		{"Mozilla/5.0", "192.0.2.1:1234", http.StatusOK, ""},
+		{"", "192.0.2.1:1234", http.StatusForbidden, ""},
+		{"Mozilla/5.0 (compatible; GPTBot/1.0)", "192.0.2.1:1234", http.StatusForbidden, "ai"},
+		{"python-requests/2.0", "192.0.2.1:1234", http.StatusTooManyRequests, ""},
+		{"Googlebot/2.1", "66.249.66.1:1234", http.StatusOK, "search"},
+		{"Googlebot/2.1", "66.249.66.1:1234", http.StatusOK, "search"},
+		{"Googlebot/2.1", "10.0.0.1:1234", http.StatusForbidden, "search"},
+		{"Googlebot/2.1", "192.0.2.1:1234", http.StatusForbidden, "search"},
+		{"Uptime Monitor python", "192.0.2.1:1234", http.StatusOK, ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", test.ua)
+		r.RemoteAddr = test.remoteAddr
+		repl := httpserver.NewReplacer(r, nil, "")
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, repl))
+
+		status, err := u.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		tag := repl.Replace("{user_agent_tag}")
+		if tag != test.tag {
+			t.Errorf("Test %d: Expected tag '%s', got '%s'", i, test.tag, tag)
+		}
+	}
+
+	// the second request from the real bot is served from the cache
+	if lookups != 3 {
+		t.Errorf("Expected 3 reverse lookups, got %d", lookups)
+	}
+}
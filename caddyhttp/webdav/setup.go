@@ -0,0 +1,119 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("webdav", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+		Concurrent: true,
+	})
+}
+
+// setup configures a new WebDAV middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := webdavParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return WebDAV{Next: next, Configs: configs}
+	})
+
+	return nil
+}
+
+// webdavParse parses the webdav directive:
+//
+//	webdav [<prefix>] {
+//		root       <dir>
+//		read_only  [<path...>]
+//		read_write [<path...>]
+//	}
+func webdavParse(c *caddy.Controller) ([]*Config, error) {
+	siteConfig := httpserver.GetConfig(c)
+	var configs []*Config
+
+	for c.Next() {
+		config := &Config{Prefix: "/", Root: siteConfig.Root}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return nil, c.Errf("webdav prefix must begin with '/', got '%s'", args[0])
+			}
+			config.Prefix = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "root":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				config.Root = args[0]
+			case "read_only", "read_write":
+				readOnly := what == "read_only"
+				if len(args) == 0 {
+					config.ReadOnly = readOnly
+					break
+				}
+				for _, path := range args {
+					if !strings.HasPrefix(path, "/") {
+						return nil, c.Errf("path must begin with '/', got '%s'", path)
+					}
+					config.Paths = append(config.Paths, PathAccess{Path: path, ReadOnly: readOnly})
+				}
+			default:
+				return nil, c.Errf("unknown webdav property '%s'", what)
+			}
+		}
+
+		for _, other := range configs {
+			if other.Prefix == config.Prefix {
+				return nil, c.Errf("webdav: duplicate prefix '%s'", config.Prefix)
+			}
+		}
+
+		sort.SliceStable(config.Paths, func(i, j int) bool {
+			return len(config.Paths[i].Path) > len(config.Paths[j].Path)
+		})
+		config.handler = newHandler(config)
+		configs = append(configs, config)
+	}
+
+	// the longest prefix matches first
+	sort.SliceStable(configs, func(i, j int) bool {
+		return len(configs[i].Prefix) > len(configs[j].Prefix)
+	})
+
+	return configs, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `webdav /dav`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(WebDAV)
+	if !ok {
+		t.Fatalf("Expected handler to be type WebDAV, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestWebDAVParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`webdav`, false, []Config{
+			{Prefix: "/", Root: "/srv"},
+		}},
+		{`webdav /dav {
+			root /data
+			read_only
+			read_write /dav/uploads /dav/shared
+			read_only /dav/shared/archive
+		}`, false, []Config{
+			{Prefix: "/dav", Root: "/data", ReadOnly: true, Paths: []PathAccess{
+				{Path: "/dav/shared/archive", ReadOnly: true},
+				{Path: "/dav/uploads", ReadOnly: false},
+				{Path: "/dav/shared", ReadOnly: false},
+			}},
+		}},
+		{`webdav /a
+		webdav /a/b`, false, []Config{
+			{Prefix: "/a/b", Root: "/srv"},
+			{Prefix: "/a", Root: "/srv"},
+		}},
+		{`webdav /a
+		webdav /a`, true, nil},
+		{`webdav dav`, true, nil},
+		{`webdav /a /b`, true, nil},
+		{`webdav {
+			root
+		}`, true, nil},
+		{`webdav {
+			read_only uploads
+		}`, true, nil},
+		{`webdav {
+			users bob
+		}`, true, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		httpserver.GetConfig(c).Root = "/srv"
+		configs, err := webdavParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(configs) != len(test.expected) {
+			t.Errorf("Test %d: expected %d configs, got %d", i, len(test.expected), len(configs))
+			continue
+		}
+		for j, expected := range test.expected {
+			got := *configs[j]
+			if got.handler == nil {
+				t.Errorf("Test %d, config %d: expected handler to be set", i, j)
+			}
+			got.handler = nil
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Test %d, config %d: expected %+v, got %+v", i, j, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webdav is middleware that serves a directory over
+// WebDAV, with read-only or read-write access set per path.
+package webdav
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	dav "golang.org/x/net/webdav"
+)
+
+// Config is a directory served over WebDAV under a URL prefix.
+type Config struct {
+	// Prefix is the URL path the directory is served at
+	Prefix string
+
+	// Root is the directory served
+	Root string
+
+	// ReadOnly is the access for paths not in Paths
+	ReadOnly bool
+
+	// Paths set the access for URL paths and what is under
+	// them, longest path first
+	Paths []PathAccess
+
+	handler *dav.Handler
+}
+
+// PathAccess is the access allowed to a URL path.
+type PathAccess struct {
+	Path     string
+	ReadOnly bool
+}
+
+// readOnly reports whether urlPath can only be read.
+func (c *Config) readOnly(urlPath string) bool {
+	for _, p := range c.Paths {
+		if httpserver.Path(urlPath).Matches(p.Path) {
+			return p.ReadOnly
+		}
+	}
+	return c.ReadOnly
+}
+
+// WebDAV is middleware that serves directories over WebDAV.
+type WebDAV struct {
+	Next    httpserver.Handler
+	Configs []*Config
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (d WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, c := range d.Configs {
+		if !httpserver.Path(r.URL.Path).Matches(c.Prefix) {
+			continue
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			// WebDAV can't list directories for browsers,
+			// so leave them to the rest of the chain
+			name := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(c.Prefix, "/"))
+			if info, err := c.handler.FileSystem.Stat(r.Context(), name); err == nil && info.IsDir() {
+				return d.Next.ServeHTTP(w, r)
+			}
+		case http.MethodOptions, "PROPFIND":
+		case "COPY":
+			// copying only reads the source
+			if !c.writable(r) {
+				return http.StatusForbidden, nil
+			}
+		case "MOVE":
+			if c.readOnly(r.URL.Path) || !c.writable(r) {
+				return http.StatusForbidden, nil
+			}
+		default:
+			if c.readOnly(r.URL.Path) {
+				return http.StatusForbidden, nil
+			}
+		}
+
+		c.handler.ServeHTTP(w, r)
+		return 0, nil
+	}
+	return d.Next.ServeHTTP(w, r)
+}
+
+// writable reports whether the destination of the COPY or
+// MOVE request r can be written to.
+func (c *Config) writable(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil {
+		return false
+	}
+	return !c.readOnly(u.Path)
+}
+
+// newHandler returns the WebDAV handler for c.
+func newHandler(c *Config) *dav.Handler {
+	return &dav.Handler{
+		Prefix:     strings.TrimSuffix(c.Prefix, "/"),
+		FileSystem: dav.Dir(c.Root),
+		LockSystem: dav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("[ERROR] webdav: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webdav
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestWebDAV(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "readme.txt"), []byte("read me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Prefix:   "/dav",
+		Root:     root,
+		ReadOnly: true,
+		Paths:    []PathAccess{{Path: "/dav/uploads", ReadOnly: false}},
+	}
+	config.handler = newHandler(config)
+	d := WebDAV{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []*Config{config},
+	}
+
+	for i, test := range []struct {
+		method       string
+		path         string
+		body         string
+		header       map[string]string
+		expectStatus int
+		expectCode   int
+	}{
+		{"GET", "/other", "", nil, http.StatusTeapot, 0},
+		{"GET", "/dav/readme.txt", "", nil, 0, http.StatusOK},
+		{"GET", "/dav/uploads/", "", nil, http.StatusTeapot, 0},
+		{"PROPFIND", "/dav/", "", map[string]string{"Depth": "1"}, 0, http.StatusMultiStatus},
+		{"PUT", "/dav/new.txt", "new", nil, http.StatusForbidden, 0},
+		{"DELETE", "/dav/readme.txt", "", nil, http.StatusForbidden, 0},
+		{"PUT", "/dav/uploads/new.txt", "new", nil, 0, http.StatusCreated},
+		{"MKCOL", "/dav/uploads/dir", "", nil, 0, http.StatusCreated},
+		{"COPY", "/dav/readme.txt", "", map[string]string{"Destination": "http://example.com/dav/uploads/readme.txt"}, 0, http.StatusCreated},
+		{"MOVE", "/dav/uploads/new.txt", "", map[string]string{"Destination": "http://example.com/dav/moved.txt"}, http.StatusForbidden, 0},
+		{"DELETE", "/dav/uploads/new.txt", "", nil, 0, http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(test.method, "http://example.com"+test.path, strings.NewReader(test.body))
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		status, err := d.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if status == 0 && w.Code != test.expectCode {
+			t.Errorf("Test %d: expected response code %d, got %d", i, test.expectCode, w.Code)
+		}
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(root, "uploads", "readme.txt")); err != nil || string(b) != "read me" {
+		t.Errorf("Expected copied file, got '%s' (error: %v)", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "moved.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file moved into read-only path, got: %v", err)
+	}
+}
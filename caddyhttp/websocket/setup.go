@@ -15,6 +15,9 @@
 package websocket
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -91,6 +94,18 @@ func webSocketParse(c *caddy.Controller) ([]Config, error) {
 			}
 		}
 
+		// A WebSocket URL means relay to a backend instead of running a command
+		if strings.HasPrefix(command, "ws://") || strings.HasPrefix(command, "wss://") {
+			if _, err := url.Parse(command); err != nil {
+				return nil, c.Errf("invalid websocket backend %s: %v", command, err)
+			}
+			websocks = append(websocks, Config{
+				Path:    path,
+				Backend: command,
+			})
+			continue
+		}
+
 		// Split command into the actual command and its arguments
 		cmd, args, err := caddy.SplitCommandAndArgs(command)
 		if err != nil {
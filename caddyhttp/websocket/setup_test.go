@@ -81,6 +81,17 @@ func TestWebSocketParse(t *testing.T) {
 			Command: "cat",
 		}}},
 
+		// relay to a backend
+		{`websocket /api8 ws://localhost:8080/socket`, false, []Config{{
+			Path:    "/api8",
+			Backend: "ws://localhost:8080/socket",
+		}}},
+
+		{`websocket wss://example.com/socket`, false, []Config{{
+			Path:    "/",
+			Backend: "wss://example.com/socket",
+		}}},
+
 		// invalid configuration
 		{`websocket /api7 cat {
 			invalid
@@ -111,6 +122,11 @@ func TestWebSocketParse(t *testing.T) {
 					i, j, test.expectedWebSocketConfig[j].Command, actualWebSocketConfig.Command)
 			}
 
+			if actualWebSocketConfig.Backend != test.expectedWebSocketConfig[j].Backend {
+				t.Errorf("Test %d expected %dth WebSocket Config Backend to be  %s  , but got %s",
+					i, j, test.expectedWebSocketConfig[j].Backend, actualWebSocketConfig.Backend)
+			}
+
 		}
 	}
 
@@ -14,7 +14,7 @@
 
 // Package websocket implements a WebSocket server by executing
 // a command and piping its input and output through the WebSocket
-// connection.
+// connection, or by relaying messages to a backend WebSocket URL.
 package websocket
 
 import (
@@ -76,6 +76,10 @@ type (
 		Command   string
 		Arguments []string
 		Respawn   bool // TODO: Not used, but parser supports it until we decide on it
+
+		// Backend, if set, is a ws:// or wss:// URL that
+		// connections are relayed to instead of a command.
+		Backend string
 	}
 )
 
@@ -94,6 +98,10 @@ func (ws WebSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, erro
 // serveWS is used for setting and upgrading the HTTP connection to a websocket connection.
 // It also spawns the child process that is associated with matched HTTP path/url.
 func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error) {
+	if config.Backend != "" {
+		return serveRelay(w, r, config)
+	}
+
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -163,6 +171,74 @@ func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error
 	return 0, nil
 }
 
+// serveRelay dials the configured backend WebSocket, upgrades the
+// client connection, and copies messages between the two until
+// either side closes.
+func serveRelay(w http.ResponseWriter, r *http.Request, config *Config) (int, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: writeWait,
+		Subprotocols:     websocket.Subprotocols(r),
+	}
+	header := make(http.Header)
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		header.Set("X-Forwarded-For", clientIP)
+	}
+	backend, _, err := dialer.Dial(config.Backend, header)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	defer backend.Close()
+
+	var respHeader http.Header
+	if proto := backend.Subprotocol(); proto != "" {
+		respHeader = http.Header{"Sec-Websocket-Protocol": {proto}}
+	}
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, respHeader)
+	if err != nil {
+		// the connection has been "handled" -- WriteHeader was called with Upgrade,
+		// so don't return an error status code; just return an error
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxMessageSize)
+	backend.SetReadLimit(maxMessageSize)
+
+	done := make(chan struct{}, 2)
+	go relayMessages(conn, backend, done)
+	go relayMessages(backend, conn, done)
+	<-done
+
+	return 0, nil
+}
+
+// relayMessages copies messages from src to dst, preserving their
+// type, and forwards the close frame when src is closed.
+func relayMessages(dst, src *websocket.Conn, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	for {
+		msgType, message, err := src.ReadMessage()
+		if err != nil {
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+			if e, ok := err.(*websocket.CloseError); ok && e.Code != websocket.CloseNoStatusReceived {
+				closeMsg = websocket.FormatCloseMessage(e.Code, e.Text)
+			}
+			_ = dst.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait))
+			return
+		}
+		if err := dst.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+			log.Println("[ERROR] failed to set write deadline: ", err)
+		}
+		if err := dst.WriteMessage(msgType, message); err != nil {
+			return
+		}
+	}
+}
+
 // buildEnv creates the meta-variables for the child process according
 // to the CGI 1.1 specification: http://tools.ietf.org/html/rfc3875#section-4.1
 // cmdPath should be the path of the command being run.
@@ -16,7 +16,12 @@ package websocket
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func TestBuildEnv(t *testing.T) {
@@ -34,3 +39,61 @@ func TestBuildEnv(t *testing.T) {
 		t.Fatalf("Expected non-empty environment; got %#v", env)
 	}
 }
+
+func TestRelay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{Subprotocols: []string{"echo"}}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Backend upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		for {
+			msgType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(msgType, message); err != nil {
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+
+	ws := WebSocket{
+		Next: httpserver.EmptyNext,
+		Sockets: []Config{{
+			Path:    "/relay",
+			Backend: "ws" + strings.TrimPrefix(backend.URL, "http"),
+		}},
+	}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeHTTP(w, r)
+	}))
+	defer front.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"echo"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/relay", nil)
+	if err != nil {
+		t.Fatalf("Dialing relay failed: %v", err)
+	}
+	defer conn.Close()
+
+	if proto := conn.Subprotocol(); proto != "echo" {
+		t.Errorf("Expected subprotocol %q, got %q", "echo", proto)
+	}
+
+	for _, msgType := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		if err := conn.WriteMessage(msgType, []byte("hello")); err != nil {
+			t.Fatalf("Writing message failed: %v", err)
+		}
+		gotType, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Reading message failed: %v", err)
+		}
+		if gotType != msgType || string(message) != "hello" {
+			t.Errorf("Expected message type %d with %q, got type %d with %q", msgType, "hello", gotType, message)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddylog implements the leveled, structured logger for
+// Caddy's own messages, such as those about startup, reloads, TLS
+// and upstreams; it is not for access logs. Messages have a level
+// and optional fields given as alternating keys and values:
+//
+//	caddylog.Info("reloaded", "sites", 3)
+//
+// They are written as text, like the standard logger does, or as
+// one JSON object per line. The Logger is also an io.Writer, so the
+// standard logger can be pointed at it: then the many messages that
+// are logged with log.Printf("[LEVEL] ...") get their level from
+// that prefix and are filtered and formatted like the others.
+package caddylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a message.
+type Level int
+
+// The levels of messages, from least to most severe.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String returns the name of the level as it appears in the
+// "[LEVEL]" prefix of text messages.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARNING"
+	case ErrorLevel:
+		return "ERROR"
+	}
+	return "LEVEL" + strconv.Itoa(int(l))
+}
+
+// ParseLevel returns the level named s, case-insensitively;
+// "warn" and "warning" are the same.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("unknown log level: %s (must be debug, info, warn or error)", s)
+}
+
+// prefixLevels maps the prefixes used with the standard logger
+// throughout Caddy to levels.
+var prefixLevels = map[string]Level{
+	"DEBUG":   DebugLevel,
+	"INFO":    InfoLevel,
+	"NOTICE":  InfoLevel,
+	"WARNING": WarnLevel,
+	"WARN":    WarnLevel,
+	"ERROR":   ErrorLevel,
+	"PANIC":   ErrorLevel,
+	"FATAL":   ErrorLevel,
+}
+
+// Logger writes leveled messages to an output. It is safe
+// for concurrent use.
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level Level
+	json  bool
+	now   func() time.Time
+	buf   []byte
+}
+
+// New returns a logger that writes text messages of InfoLevel
+// and above to out, or through the standard logger if out is nil.
+func New(out io.Writer) *Logger {
+	return &Logger{out: out, level: InfoLevel, now: time.Now}
+}
+
+// SetOutput sets where the logger writes; see New.
+func (l *Logger) SetOutput(out io.Writer) {
+	l.mu.Lock()
+	l.out = out
+	l.mu.Unlock()
+}
+
+// SetLevel sets the least severe level that is written.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
+// SetFormat sets the format of the messages, which is
+// either "text" (the default) or "json".
+func (l *Logger) SetFormat(format string) error {
+	var isJSON bool
+	switch format {
+	case "", "text":
+	case "json":
+		isJSON = true
+	default:
+		return fmt.Errorf("unknown log format: %s (must be text or json)", format)
+	}
+	l.mu.Lock()
+	l.json = isJSON
+	l.mu.Unlock()
+	return nil
+}
+
+// Enabled returns true if messages of level are written,
+// so that expensive fields need not be computed otherwise.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// Log writes msg with level and the fields in keyvals, which
+// alternate between keys and values, if level is enabled.
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+	if l.out == nil {
+		// the standard logger adds the timestamp
+		l.buf = appendText(l.buf[:0], time.Time{}, level, msg, keyvals)
+		log.Output(3, string(l.buf))
+		return
+	}
+	if l.json {
+		l.buf = appendJSON(l.buf[:0], l.now(), level, msg, keyvals)
+	} else {
+		l.buf = appendText(l.buf[:0], l.now(), level, msg, keyvals)
+	}
+	l.out.Write(l.buf)
+}
+
+// Debug logs msg at DebugLevel.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.Log(DebugLevel, msg, keyvals...) }
+
+// Info logs msg at InfoLevel.
+func (l *Logger) Info(msg string, keyvals ...interface{}) { l.Log(InfoLevel, msg, keyvals...) }
+
+// Warn logs msg at WarnLevel.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) { l.Log(WarnLevel, msg, keyvals...) }
+
+// Error logs msg at ErrorLevel.
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.Log(ErrorLevel, msg, keyvals...) }
+
+// Write logs p, which is one message of the standard logger,
+// taking its level from a "[LEVEL]" prefix; messages without
+// one are logged at InfoLevel. The standard logger should have
+// no flags set, since the logger adds its own timestamp, and the
+// output of l must not be the standard logger itself.
+func (l *Logger) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	level := InfoLevel
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.IndexByte(msg, ']'); end > 0 {
+			if lvl, ok := prefixLevels[msg[1:end]]; ok {
+				level = lvl
+				msg = strings.TrimPrefix(msg[end+1:], " ")
+			}
+		}
+	}
+	l.Log(level, msg)
+	return len(p), nil
+}
+
+// appendText appends a message formatted like the standard
+// logger would, with the fields after it as key=value. The
+// timestamp is left out if ts is zero.
+func appendText(buf []byte, ts time.Time, level Level, msg string, keyvals []interface{}) []byte {
+	if !ts.IsZero() {
+		buf = ts.AppendFormat(buf, "2006/01/02 15:04:05 ")
+	}
+	buf = append(buf, '[')
+	buf = append(buf, level.String()...)
+	buf = append(buf, "] "...)
+	buf = append(buf, msg...)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, val := keyval(keyvals, i)
+		buf = append(buf, ' ')
+		buf = append(buf, key...)
+		buf = append(buf, '=')
+		str := fmt.Sprint(val)
+		if err, ok := val.(error); ok {
+			str = err.Error()
+		}
+		if str == "" || strings.ContainsAny(str, " \t\r\n\"=") {
+			buf = strconv.AppendQuote(buf, str)
+		} else {
+			buf = append(buf, str...)
+		}
+	}
+	return append(buf, '\n')
+}
+
+// appendJSON appends a message as a JSON object on one line,
+// with the fields as members after ts, level and msg.
+func appendJSON(buf []byte, ts time.Time, level Level, msg string, keyvals []interface{}) []byte {
+	buf = append(buf, `{"ts":`...)
+	buf = appendJSONValue(buf, ts.Format(time.RFC3339Nano))
+	buf = append(buf, `,"level":`...)
+	buf = appendJSONValue(buf, strings.ToLower(level.String()))
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONValue(buf, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, val := keyval(keyvals, i)
+		if err, ok := val.(error); ok {
+			val = err.Error()
+		}
+		buf = append(buf, ',')
+		buf = appendJSONValue(buf, key)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, val)
+	}
+	return append(buf, "}\n"...)
+}
+
+// appendJSONValue appends val encoded as JSON, or as a JSON
+// string of its default format if it cannot be encoded.
+func appendJSONValue(buf []byte, val interface{}) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		b.Reset()
+		enc.Encode(fmt.Sprint(val))
+	}
+	return append(buf, bytes.TrimRight(b.Bytes(), "\n")...)
+}
+
+// keyval returns the key and value of the field at index i of
+// keyvals; a key without a value gets the key "EXTRA" instead.
+func keyval(keyvals []interface{}, i int) (string, interface{}) {
+	if i+1 >= len(keyvals) {
+		return "EXTRA", keyvals[i]
+	}
+	return fmt.Sprint(keyvals[i]), keyvals[i+1]
+}
+
+// std is the logger used by the package-level functions. Until
+// its output is set, it writes through the standard logger, so
+// that messages go wherever the rest of the process log goes.
+var std = New(nil)
+
+// Default returns the logger used by the package-level functions.
+func Default() *Logger { return std }
+
+// SetOutput sets where the default logger writes.
+func SetOutput(out io.Writer) { std.SetOutput(out) }
+
+// SetLevel sets the least severe level the default logger writes.
+func SetLevel(level Level) { std.SetLevel(level) }
+
+// SetFormat sets the format of the default logger; see Logger.SetFormat.
+func SetFormat(format string) error { return std.SetFormat(format) }
+
+// Enabled returns true if the default logger writes messages of level.
+func Enabled(level Level) bool { return std.Enabled(level) }
+
+// Debug logs msg at DebugLevel with the default logger.
+func Debug(msg string, keyvals ...interface{}) { std.Log(DebugLevel, msg, keyvals...) }
+
+// Info logs msg at InfoLevel with the default logger.
+func Info(msg string, keyvals ...interface{}) { std.Log(InfoLevel, msg, keyvals...) }
+
+// Warn logs msg at WarnLevel with the default logger.
+func Warn(msg string, keyvals ...interface{}) { std.Log(WarnLevel, msg, keyvals...) }
+
+// Error logs msg at ErrorLevel with the default logger.
+func Error(msg string, keyvals ...interface{}) { std.Log(ErrorLevel, msg, keyvals...) }
@@ -0,0 +1,116 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddylog
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(buf *bytes.Buffer) *Logger {
+	l := New(buf)
+	l.now = func() time.Time { return time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC) }
+	return l
+}
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+
+	l.Debug("not written")
+	l.Info("Reloaded certificate", "names", []string{"example.com"}, "file", "/etc/my certs/a.pem")
+	l.Warn("Upstream failed health check", "upstream", "http://localhost:3000", "error", errors.New("EOF"))
+	l.Error("odd fields", "key")
+
+	expect := `2019/03/14 15:09:26 [INFO] Reloaded certificate names=[example.com] file="/etc/my certs/a.pem"
+2019/03/14 15:09:26 [WARNING] Upstream failed health check upstream=http://localhost:3000 error=EOF
+2019/03/14 15:09:26 [ERROR] odd fields EXTRA=key
+`
+	if buf.String() != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+	l.SetLevel(DebugLevel)
+	if err := l.SetFormat("json"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Debug("Upstream request failed", "upstream", "http://localhost:3000", "status", 502, "error", errors.New("dial <tcp>"))
+
+	expect := `{"ts":"2019-03-14T15:09:26Z","level":"debug","msg":"Upstream request failed","upstream":"http://localhost:3000","status":502,"error":"dial <tcp>"}
+`
+	if buf.String() != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+
+	if err := l.SetFormat("xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestLoggerStandardLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+	l.SetLevel(WarnLevel)
+	std := log.New(l, "", 0)
+
+	std.Printf("[INFO] Reloading")
+	std.Printf("[WARNING] Unable to traverse into %s; skipping", "/tmp")
+	std.Printf("[ERROR][cache:0x1] Renewing certificate")
+	std.Printf("no level")
+	std.Printf("[PANIC] Restart: oops")
+
+	expect := `2019/03/14 15:09:26 [WARNING] Unable to traverse into /tmp; skipping
+2019/03/14 15:09:26 [ERROR] [cache:0x1] Renewing certificate
+2019/03/14 15:09:26 [ERROR] Restart: oops
+`
+	if buf.String() != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expect    Level
+		shouldErr bool
+	}{
+		{"debug", DebugLevel, false},
+		{"INFO", InfoLevel, false},
+		{"warn", WarnLevel, false},
+		{"warning", WarnLevel, false},
+		{"error", ErrorLevel, false},
+		{"fatal", 0, true},
+	} {
+		level, err := ParseLevel(test.input)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got: %v", i, test.shouldErr, err)
+		}
+		if level != test.expect {
+			t.Errorf("Test %d: Expected level %v, got %v", i, test.expect, level)
+		}
+	}
+	if !strings.HasPrefix(Level(7).String(), "LEVEL") {
+		t.Errorf("Expected unknown level to be named LEVEL7, got %s", Level(7))
+	}
+}
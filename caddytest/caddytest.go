@@ -0,0 +1,267 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddytest helps test Caddy plugins end-to-end. It starts
+// an instance from a Caddyfile, sends it requests, makes assertions
+// on the responses and on what was logged, and stops it again.
+//
+// Sites should use port 0 so that each test gets ephemeral ports
+// instead of colliding with other servers on the machine:
+//
+//	tester := caddytest.Start(t, `localhost:0 {
+//		status 404 /missing
+//	}`)
+//	defer tester.Stop()
+//	tester.AssertGetResponse("http://localhost:0/missing", 404, "")
+//
+// Requests for port 0 are sent to the listener the instance got
+// from the operating system; when there is more than one such
+// listener, use Addrs to pick one explicitly. Since the standard
+// logger is global, only one Tester runs at a time; Start blocks
+// until the previous Tester is stopped.
+package caddytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	// the HTTP server type is the one being tested
+	_ "github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Timeout is how long requests made by a Tester may take.
+var Timeout = 10 * time.Second
+
+// logMu serializes the capturing of the standard logger,
+// which is global to the process.
+var logMu sync.Mutex
+
+// Tester is a running Caddy instance under test.
+type Tester struct {
+	t     testing.TB
+	inst  *caddy.Instance
+	addrs []string
+
+	// Client sends requests to the instance; it does
+	// not follow redirects.
+	Client *http.Client
+
+	logs *logBuffer
+}
+
+// Start starts a Caddy instance of the HTTP server type from
+// caddyfile, failing t if it does not start. The returned Tester
+// records everything written to the standard logger until it is
+// stopped. Always call Stop when done with it.
+func Start(t testing.TB, caddyfile string) *Tester {
+	t.Helper()
+	return StartType(t, caddyfile, "http")
+}
+
+// StartType is like Start, but for the server type serverType.
+func StartType(t testing.TB, caddyfile, serverType string) *Tester {
+	t.Helper()
+
+	tester := &Tester{t: t, logs: new(logBuffer)}
+	logMu.Lock()
+	log.SetOutput(io.MultiWriter(tester.logs, os.Stderr))
+
+	inst, err := caddy.Start(caddy.CaddyfileInput{
+		Filepath:       "Caddyfile",
+		Contents:       []byte(caddyfile),
+		ServerTypeName: serverType,
+	})
+	tester.inst = inst
+	if err != nil {
+		tester.Stop()
+		t.Fatalf("Starting Caddy: %v", err)
+	}
+
+	for _, s := range inst.Servers() {
+		if addr := s.Addr(); addr != nil {
+			tester.addrs = append(tester.addrs, addr.String())
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: Timeout}
+	tester.Client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				addr, err := tester.dialAddr(addr)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: Timeout,
+	}
+
+	return tester
+}
+
+// dialAddr returns the address to actually dial for addr,
+// which is the address of the instance's listener if the
+// port of addr is 0.
+func (tester *Tester) dialAddr(addr string) (string, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port != "0" {
+		return addr, err
+	}
+	switch len(tester.addrs) {
+	case 0:
+		return "", fmt.Errorf("no listener for %s", addr)
+	case 1:
+		return tester.addrs[0], nil
+	default:
+		return "", fmt.Errorf("%d listeners could serve %s; use Addrs to choose one", len(tester.addrs), addr)
+	}
+}
+
+// Addrs returns the addresses the instance is listening on,
+// in the order its servers were started.
+func (tester *Tester) Addrs() []string {
+	return tester.addrs
+}
+
+// Instance returns the running Caddy instance.
+func (tester *Tester) Instance() *caddy.Instance {
+	return tester.inst
+}
+
+// Stop stops the instance, runs its shutdown callbacks and
+// stops recording the standard logger. It is safe to call
+// Stop more than once.
+func (tester *Tester) Stop() {
+	if tester.inst != nil {
+		if err := tester.inst.Stop(); err != nil {
+			tester.t.Errorf("Stopping Caddy: %v", err)
+		}
+		for _, err := range tester.inst.ShutdownCallbacks() {
+			tester.t.Errorf("Shutdown callback: %v", err)
+		}
+		tester.inst = nil
+	}
+	if tester.Client != nil {
+		tester.Client.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	if tester.logs != nil {
+		log.SetOutput(os.Stderr)
+		tester.logs = nil
+		logMu.Unlock()
+	}
+}
+
+// AssertResponse sends req and checks that the response has the
+// expected status code and, unless expectedBody is empty, the
+// expected body. It returns the response and its body.
+func (tester *Tester) AssertResponse(req *http.Request, expectedStatus int, expectedBody string) (*http.Response, string) {
+	tester.t.Helper()
+	resp, err := tester.Client.Do(req)
+	if err != nil {
+		tester.t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		tester.t.Fatalf("%s %s: reading body: %v", req.Method, req.URL, err)
+	}
+	if resp.StatusCode != expectedStatus {
+		tester.t.Errorf("%s %s: expected status %d, got %d", req.Method, req.URL, expectedStatus, resp.StatusCode)
+	}
+	if expectedBody != "" && string(body) != expectedBody {
+		tester.t.Errorf("%s %s: expected body %q, got %q", req.Method, req.URL, expectedBody, body)
+	}
+	return resp, string(body)
+}
+
+// AssertGetResponse is like AssertResponse for a GET request
+// to rawurl.
+func (tester *Tester) AssertGetResponse(rawurl string, expectedStatus int, expectedBody string) (*http.Response, string) {
+	tester.t.Helper()
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		tester.t.Fatalf("Making request: %v", err)
+	}
+	return tester.AssertResponse(req, expectedStatus, expectedBody)
+}
+
+// AssertHeader checks that resp has the header key with the
+// value expectedValue; an empty expectedValue means that the
+// header must not be set.
+func (tester *Tester) AssertHeader(resp *http.Response, key, expectedValue string) {
+	tester.t.Helper()
+	if got := resp.Header.Get(key); got != expectedValue {
+		tester.t.Errorf("Expected header %s to be %q, got %q", key, expectedValue, got)
+	}
+}
+
+// AssertLog checks that substr has been written to the
+// standard logger since the instance was started. Since
+// some lines are logged asynchronously, it waits up to
+// Timeout for the line to appear.
+func (tester *Tester) AssertLog(substr string) {
+	tester.t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !strings.Contains(tester.Logs(), substr) {
+		if time.Now().After(deadline) {
+			tester.t.Errorf("Expected log to contain %q, got:\n%s", substr, tester.Logs())
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Logs returns everything written to the standard logger
+// since the instance was started.
+func (tester *Tester) Logs() string {
+	if tester.logs == nil {
+		return ""
+	}
+	return tester.logs.String()
+}
+
+// logBuffer is a bytes.Buffer safe for concurrent use.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
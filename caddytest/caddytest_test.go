@@ -0,0 +1,75 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	_ "github.com/mholt/caddy/caddyhttp"
+)
+
+func TestTester(t *testing.T) {
+	tester := Start(t, `localhost:0 {
+		status 404 /missing
+		header / X-Test yes
+		redir /old /new
+	}`)
+	defer tester.Stop()
+
+	if len(tester.Addrs()) != 1 {
+		t.Fatalf("Expected 1 listener, got %v", tester.Addrs())
+	}
+	if strings.HasSuffix(tester.Addrs()[0], ":0") {
+		t.Errorf("Expected an ephemeral port, got %s", tester.Addrs()[0])
+	}
+
+	resp, _ := tester.AssertGetResponse("http://localhost:0/missing", http.StatusNotFound, "")
+	tester.AssertHeader(resp, "X-Test", "yes")
+
+	resp, _ = tester.AssertGetResponse("http://localhost:0/old", http.StatusMovedPermanently, "")
+	tester.AssertHeader(resp, "Location", "/new")
+
+	tester.AssertLog("localhost:0")
+}
+
+func TestTesterMultipleListeners(t *testing.T) {
+	tester := Start(t, `localhost:0 {
+	}
+	127.0.0.1:0 {
+		bind 127.0.0.1
+	}`)
+	defer tester.Stop()
+
+	if len(tester.Addrs()) != 2 {
+		t.Fatalf("Expected 2 listeners, got %v", tester.Addrs())
+	}
+	if _, err := tester.dialAddr("localhost:0"); err == nil {
+		t.Error("Expected an error dialing port 0 with several listeners")
+	}
+	if addr, err := tester.dialAddr("localhost:1234"); err != nil || addr != "localhost:1234" {
+		t.Errorf("Expected other ports to be dialed as is, got %s (%v)", addr, err)
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	tester := Start(t, `localhost:0`)
+	tester.Stop()
+	tester.Stop()
+	if tester.Addrs() == nil {
+		t.Error("Expected addresses to remain available after stopping")
+	}
+}
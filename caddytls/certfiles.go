@@ -0,0 +1,309 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddylog"
+	"github.com/mholt/certmagic"
+	"golang.org/x/crypto/ocsp"
+)
+
+// certFilesCheckInterval is how often certificate files
+// loaded by the tls directive are checked for changes.
+var certFilesCheckInterval = 10 * time.Second
+
+// certFiles keeps the certificates loaded from files
+// up to date with the files, which other programs may
+// replace at any time. Certificates loaded again from
+// changed files are served instead of the ones loaded
+// at startup, which stay in the certificate cache. The
+// certificates of an instance are swapped all at once,
+// so a handshake sees either the old or the new ones.
+type certFiles struct {
+	mu      sync.RWMutex
+	files   []*watchedCertFile
+	watched map[certKeyFiles]bool
+	byName  map[string]*reloadedCert // managed like copy-on-write
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// certKeyFiles is a certificate and key file pair; for
+// bundles holding both, keyFile is empty.
+type certKeyFiles struct {
+	certFile, keyFile string
+}
+
+// watchedCertFile is a watched certificate and key file pair.
+type watchedCertFile struct {
+	certFile, keyFile string
+	modTime           time.Time
+	size              int64
+	reloaded          *reloadedCert
+}
+
+type reloadedCert struct {
+	tls.Certificate
+	names       []string
+	ocspRefresh time.Time // zero if not stapled
+}
+
+func newCertFiles() *certFiles {
+	return &certFiles{
+		watched: make(map[certKeyFiles]bool),
+		byName:  make(map[string]*reloadedCert),
+		stop:    make(chan struct{}),
+	}
+}
+
+// watch starts watching certFile and keyFile (empty for
+// bundles), as they are now, for changes.
+func (cf *certFiles) watch(certFile, keyFile string) error {
+	f := &watchedCertFile{certFile: certFile, keyFile: keyFile}
+	var err error
+	f.modTime, f.size, err = f.stat()
+	if err != nil {
+		return err
+	}
+	cf.mu.Lock()
+	cf.files = append(cf.files, f)
+	cf.watched[certKeyFiles{certFile, keyFile}] = true
+	cf.mu.Unlock()
+	cf.once.Do(func() { go cf.run() })
+	return nil
+}
+
+// watching returns whether certFile and keyFile are already
+// watched, which means that their certificate is in the cache
+// of the instance: sites sharing a certificate, like a wildcard
+// one, need to load it only once.
+func (cf *certFiles) watching(certFile, keyFile string) bool {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return cf.watched[certKeyFiles{certFile, keyFile}]
+}
+
+// Stop stops watching the files.
+func (cf *certFiles) Stop() {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	select {
+	case <-cf.stop:
+	default:
+		close(cf.stop)
+	}
+}
+
+func (cf *certFiles) run() {
+	ticker := time.NewTicker(certFilesCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cf.stop:
+			return
+		case <-ticker.C:
+			cf.check(time.Now())
+		}
+	}
+}
+
+// check reloads the certificates of changed files and
+// refreshes the OCSP staples of reloaded certificates.
+func (cf *certFiles) check(now time.Time) {
+	cf.mu.RLock()
+	files := cf.files
+	cf.mu.RUnlock()
+
+	var changed bool
+	for _, f := range files {
+		modTime, size, err := f.stat()
+		if err != nil {
+			log.Printf("[ERROR] Checking certificate file %s: %v", f.certFile, err)
+			continue
+		}
+		if modTime.Equal(f.modTime) && size == f.size {
+			if f.reloaded != nil && !f.reloaded.ocspRefresh.IsZero() && now.After(f.reloaded.ocspRefresh) {
+				refreshed := *f.reloaded
+				stapleReloadedCert(&refreshed, now)
+				f.reloaded = &refreshed
+				changed = true
+			}
+			continue
+		}
+		cert, err := f.load(now)
+		if err != nil {
+			// the files may be half-written, or the certificate
+			// replaced and its key not yet; try again next time
+			log.Printf("[ERROR] Reloading certificate from %s: %v", f.certFile, err)
+			continue
+		}
+		f.modTime, f.size, f.reloaded = modTime, size, cert
+		changed = true
+		caddylog.Info("Reloaded certificate", "names", cert.names, "file", f.certFile)
+	}
+	if !changed {
+		return
+	}
+
+	byName := make(map[string]*reloadedCert)
+	for _, f := range files {
+		if f.reloaded == nil {
+			continue
+		}
+		for _, name := range f.reloaded.names {
+			byName[name] = f.reloaded
+		}
+	}
+	cf.mu.Lock()
+	cf.byName = byName
+	cf.mu.Unlock()
+}
+
+// getCertificate returns a tls.Config.GetCertificate
+// function that serves reloaded certificates, falling
+// back to next for names without one.
+func (cf *certFiles) getCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := cf.lookup(certmagic.NormalizedName(hello.ServerName)); cert != nil {
+			return &cert.Certificate, nil
+		}
+		return next(hello)
+	}
+}
+
+func (cf *certFiles) lookup(name string) *reloadedCert {
+	if name == "" {
+		return nil
+	}
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	if cert, ok := cf.byName[name]; ok {
+		return cert
+	}
+	labels := strings.Split(name, ".")
+	labels[0] = "*"
+	return cf.byName[strings.Join(labels, ".")]
+}
+
+func (f *watchedCertFile) stat() (time.Time, int64, error) {
+	info, err := os.Stat(f.certFile)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	modTime, size := info.ModTime(), info.Size()
+	if f.keyFile != "" {
+		keyInfo, err := os.Stat(f.keyFile)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		if keyInfo.ModTime().After(modTime) {
+			modTime = keyInfo.ModTime()
+		}
+		size += keyInfo.Size()
+	}
+	return modTime, size, nil
+}
+
+func (f *watchedCertFile) load(now time.Time) (*reloadedCert, error) {
+	certPEM, err := ioutil.ReadFile(f.certFile)
+	if err != nil {
+		return nil, err
+	}
+	var keyPEM []byte
+	if f.keyFile != "" {
+		keyPEM, err = ioutil.ReadFile(f.keyFile)
+	} else {
+		certPEM, keyPEM, err = splitPEMBundle(certPEM)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter)
+	}
+	tlsCert.Leaf = leaf
+
+	cert := &reloadedCert{Certificate: tlsCert}
+	if leaf.Subject.CommonName != "" {
+		cert.names = append(cert.names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	for _, name := range leaf.DNSNames {
+		if name = strings.ToLower(name); name != strings.ToLower(leaf.Subject.CommonName) {
+			cert.names = append(cert.names, name)
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		cert.names = append(cert.names, ip.String())
+	}
+	stapleReloadedCert(cert, now)
+	return cert, nil
+}
+
+// stapleReloadedCert staples a fresh OCSP response to
+// cert, if its chain includes the issuer, and determines
+// when to refresh the staple, halfway to its expiry.
+// Without a fresh response, a staple that has expired is
+// removed, and the leaf is served without one.
+func stapleReloadedCert(cert *reloadedCert, now time.Time) {
+	cert.ocspRefresh = time.Time{}
+	if len(cert.Leaf.OCSPServer) == 0 || len(cert.Certificate.Certificate) < 2 {
+		return
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate.Certificate[1])
+	if err != nil {
+		return
+	}
+	raw, resp, err := fetchOCSP(nil, cert.Leaf, issuer)
+	if err != nil || resp.Status != ocsp.Good {
+		if err == nil {
+			err = fmt.Errorf("status is not good")
+		}
+		log.Printf("[WARNING] Stapling OCSP for %v: %v", cert.names, err)
+		if cert.OCSPStaple != nil {
+			if old, err := ocsp.ParseResponse(cert.OCSPStaple, issuer); err != nil || now.After(old.NextUpdate) {
+				cert.OCSPStaple = nil
+			}
+		}
+		cert.ocspRefresh = now.Add(time.Hour)
+		return
+	}
+	cert.OCSPStaple = raw
+	if resp.NextUpdate.IsZero() {
+		cert.ocspRefresh = now.Add(ocspDefaultMaxAge)
+	} else {
+		cert.ocspRefresh = resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+	}
+	if cert.ocspRefresh.Before(now) {
+		cert.ocspRefresh = now.Add(time.Hour)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a new self-signed certificate for
+// names and its key to certFile and keyFile; if keyFile
+// is empty, both are written to certFile. The files get
+// modTime, so that changes are noticed right away.
+func writeTestCert(t *testing.T, certFile, keyFile string, modTime time.Time, names ...string) tls.Certificate {
+	cert, err := newSelfSignedCertificate(selfSignedConfig{SAN: names})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if keyFile == "" {
+		certPEM = append(certPEM, keyPEM...)
+	} else if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if file != "" {
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return cert
+}
+
+func TestCertFilesWatching(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	certFile, keyFile := filepath.Join(tmpdir, "cert.pem"), filepath.Join(tmpdir, "key.pem")
+	writeTestCert(t, certFile, keyFile, time.Now().Add(-time.Hour), "*.example.com")
+
+	cf := newCertFiles()
+	defer cf.Stop()
+	if cf.watching(certFile, keyFile) {
+		t.Error("Expected files not to be watched before watch")
+	}
+	if err := cf.watch(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if !cf.watching(certFile, keyFile) {
+		t.Error("Expected files to be watched after watch")
+	}
+	if cf.watching(certFile, "") {
+		t.Error("Expected the certificate file alone not to count as watched")
+	}
+}
+
+func TestCertFilesReload(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	certFile, keyFile := filepath.Join(tmpdir, "cert.pem"), filepath.Join(tmpdir, "key.pem")
+	bundleFile := filepath.Join(tmpdir, "bundle.pem")
+
+	start := time.Now().Add(-time.Hour)
+	writeTestCert(t, certFile, keyFile, start, "example.com")
+	writeTestCert(t, bundleFile, "", start, "*.example.org")
+
+	cf := newCertFiles()
+	defer cf.Stop()
+	if err := cf.watch(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.watch(bundleFile, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var fallbacks int
+	getCertificate := cf.getCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		fallbacks++
+		return nil, nil
+	})
+	hello := func(name string) *tls.Certificate {
+		cert, err := getCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	cf.check(time.Now())
+	if cert := hello("example.com"); cert != nil || fallbacks != 1 {
+		t.Errorf("Expected unchanged files to be served from the cache")
+	}
+
+	newCert := writeTestCert(t, certFile, keyFile, start.Add(time.Minute), "example.com")
+	newBundle := writeTestCert(t, bundleFile, "", start.Add(time.Minute), "*.example.org")
+	cf.check(time.Now())
+	if cert := hello("EXAMPLE.com"); cert == nil || !bytes.Equal(cert.Certificate[0], newCert.Certificate[0]) {
+		t.Errorf("Expected reloaded certificate for example.com")
+	}
+	if cert := hello("sub.example.org"); cert == nil || !bytes.Equal(cert.Certificate[0], newBundle.Certificate[0]) {
+		t.Errorf("Expected reloaded wildcard certificate for sub.example.org")
+	}
+	fallbacks = 0
+	if cert := hello("other.com"); cert != nil || fallbacks != 1 {
+		t.Errorf("Expected other names to be served from the cache")
+	}
+
+	// a half-written certificate keeps the last one in place
+	if err := ioutil.WriteFile(certFile, []byte("-----BEGIN CERT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cf.check(time.Now())
+	if cert := hello("example.com"); cert == nil || !bytes.Equal(cert.Certificate[0], newCert.Certificate[0]) {
+		t.Errorf("Expected reloaded certificate to stay after failed reload")
+	}
+}
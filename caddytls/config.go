@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -65,6 +66,14 @@ type Config struct {
 	// client authentication is enabled
 	ClientCerts []string
 
+	// CRL files to check client certificates against,
+	// and whether to ask the OCSP responders of client
+	// certificates (rejecting them if the status is
+	// unknown, if strict)
+	ClientCRLs       []string
+	ClientOCSP       bool
+	ClientOCSPStrict bool
+
 	// Manual means user provides own certs and keys
 	Manual bool
 
@@ -75,11 +84,19 @@ type Config struct {
 	// Manager is how certificates are managed
 	Manager *certmagic.Config
 
+	// OnDemand, if not nil, decides which certificates
+	// Manager may obtain during TLS handshakes
+	OnDemand *OnDemandPolicy
+
 	// SelfSigned means that this hostname is
 	// served with a self-signed certificate
 	// that we generated in memory for convenience
 	SelfSigned bool
 
+	// Internal means that this hostname is served
+	// with a certificate issued by the local CA
+	Internal bool
+
 	// The email address to use when creating or
 	// using an ACME account (fun fact: if this
 	// is set to "off" then this config will not
@@ -90,9 +107,23 @@ type Config struct {
 	// Protocol Negotiation (ALPN).
 	ALPN []string
 
+	// If true, certificates that name an OCSP responder
+	// are not served without a valid OCSP staple; those
+	// requiring one (Must-Staple) never are
+	OCSPHardFail bool
+
+	// If set, TLS session secrets are appended to this
+	// file in the NSS key log format, for decrypting
+	// captured traffic; only for debugging!
+	KeyLogFile string
+
 	// The final tls.Config created with
 	// buildStandardTLSConfig()
 	tlsConfig *tls.Config
+
+	// The certificate files of the instance
+	// being watched for changes
+	certFiles *certFiles
 }
 
 // NewConfig returns a new Config with a pointer to the instance's
@@ -119,6 +150,9 @@ func NewConfig(inst *caddy.Instance) (*Config, error) {
 					return nil, fmt.Errorf("constructing cluster plugin %s: %v", clusterPluginName, err)
 				}
 				certmagic.Default.Storage = storage
+				if err := setupTicketKeySharing(); err != nil {
+					return nil, err
+				}
 			} else {
 				return nil, fmt.Errorf("unrecognized cluster plugin (was it included in the Caddy build?): %s", clusterPluginName)
 			}
@@ -148,18 +182,25 @@ func NewConfig(inst *caddy.Instance) (*Config, error) {
 				})
 			}
 		}()
+		certFiles := newCertFiles()
 		inst.OnShutdown = append(inst.OnShutdown, func() error {
 			certCache.Stop()
+			certFiles.Stop()
 			storageCleaningTicker.Stop()
 			return nil
 		})
 
 		inst.StorageMu.Lock()
 		inst.Storage[CertCacheInstStorageKey] = certCache
+		inst.Storage[certFilesInstStorageKey] = certFiles
 		inst.StorageMu.Unlock()
 	}
+	inst.StorageMu.RLock()
+	certFiles, _ := inst.Storage[certFilesInstStorageKey].(*certFiles)
+	inst.StorageMu.RUnlock()
 	return &Config{
-		Manager: certmagic.New(certCache, certmagic.Config{}),
+		Manager:   certmagic.New(certCache, certmagic.Config{}),
+		certFiles: certFiles,
 	}, nil
 }
 
@@ -194,23 +235,40 @@ func (c *Config) buildStandardTLSConfig() error {
 		}
 	}
 
-	// ensure ALPN includes the ACME TLS-ALPN protocol
-	var alpnFound bool
-	for _, a := range c.ALPN {
-		if a == tlsalpn01.ACMETLS1Protocol {
-			alpnFound = true
-			break
+	// ensure ALPN includes the ACME TLS-ALPN protocol if
+	// certificates may be obtained with its challenge; it
+	// is of no use otherwise, so it's not advertised then
+	nextProtos := c.ALPN
+	if c.usesTLSALPNChallenge() {
+		var alpnFound bool
+		for _, a := range c.ALPN {
+			if a == tlsalpn01.ACMETLS1Protocol {
+				alpnFound = true
+				break
+			}
+		}
+		if !alpnFound {
+			nextProtos = append(append([]string{}, c.ALPN...), tlsalpn01.ACMETLS1Protocol)
 		}
-	}
-	if !alpnFound {
-		c.ALPN = append(c.ALPN, tlsalpn01.ACMETLS1Protocol)
 	}
 
 	config.MinVersion = c.ProtocolMinVersion
 	config.MaxVersion = c.ProtocolMaxVersion
 	config.ClientAuth = c.ClientAuth
-	config.NextProtos = c.ALPN
+	config.NextProtos = nextProtos
+
+	if c.KeyLogFile != "" {
+		w, err := openKeyLog(c.KeyLogFile)
+		if err != nil {
+			return err
+		}
+		config.KeyLogWriter = w
+	}
 	config.GetCertificate = c.Manager.GetCertificate
+	if c.Manual && c.certFiles != nil {
+		config.GetCertificate = c.certFiles.getCertificate(c.Manager.GetCertificate)
+	}
+	config.GetCertificate = newStapleChecker(c.OCSPHardFail).getCertificate(config.GetCertificate)
 
 	// set up client authentication if enabled
 	if config.ClientAuth != tls.NoClientCert {
@@ -236,6 +294,17 @@ func (c *Config) buildStandardTLSConfig() error {
 		}
 
 		config.ClientCAs = pool
+
+		if len(c.ClientCRLs) > 0 || c.ClientOCSP {
+			revocation, err := NewClientRevocation(c.ClientCRLs, c.ClientOCSP, c.ClientOCSPStrict)
+			if err != nil {
+				return err
+			}
+			config.VerifyPeerCertificate = revocation.VerifyPeerCertificate
+			// resumed sessions skip verification, which would
+			// let a revoked certificate in until the ticket expires
+			config.SessionTicketsDisabled = true
+		}
 	}
 
 	// default cipher suites
@@ -254,6 +323,15 @@ func (c *Config) buildStandardTLSConfig() error {
 	return nil
 }
 
+// usesTLSALPNChallenge returns true if certificates for
+// c may be obtained using the ACME TLS-ALPN challenge.
+func (c *Config) usesTLSALPNChallenge() bool {
+	if c.Manager == nil || c.Manager.DisableTLSALPNChallenge {
+		return false
+	}
+	return c.Managed || c.Manager.OnDemand != nil
+}
+
 // MakeTLSConfig makes a tls.Config from configs. The returned
 // tls.Config is programmed to load the matching caddytls.Config
 // based on the hostname in SNI, but that's all. This is used
@@ -497,6 +575,46 @@ var SupportedCiphersMap = map[string]uint16{
 	"RSA-3DES-EDE-CBC-SHA":               tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
 }
 
+// ianaCipherNames maps the IANA names of the supported ciphers,
+// which audit tools usually report, to them; they may be used
+// in config instead of the names of SupportedCiphersMap.
+var ianaCipherNames = map[string]uint16{
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":                 tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+}
+
+// weakCiphers are supported for compatibility with old
+// clients only: they lack forward secrecy or use 3DES.
+var weakCiphers = map[uint16]bool{
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:        true,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:        true,
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA: true,
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:       true,
+}
+
+// lookupCipher returns the cipher with the given name, which
+// may be a key of SupportedCiphersMap or its IANA name.
+func lookupCipher(name string) (uint16, bool) {
+	name = strings.ToUpper(name)
+	if v, ok := SupportedCiphersMap[name]; ok {
+		return v, true
+	}
+	v, ok := ianaCipherNames[name]
+	return v, ok
+}
+
 // GetSupportedCipherName returns the cipher name
 func GetSupportedCipherName(cipher uint16) (string, error) {
 	for k, v := range SupportedCiphersMap {
@@ -562,6 +680,15 @@ var defaultCurves = []tls.CurveID{
 
 var clusterPluginSetup int32 // access atomically
 
+// shareTicketKeys is 1 if session ticket keys are shared with
+// the cluster through the storage of the clustering plugin.
+var shareTicketKeys int32 // access atomically
+
 // CertCacheInstStorageKey is the name of the key for
 // accessing the certificate storage on the *caddy.Instance.
 const CertCacheInstStorageKey = "tls_cert_cache"
+
+// certFilesInstStorageKey is the name of the key for
+// accessing the watched certificate files on the
+// *caddy.Instance.
+const certFilesInstStorageKey = "tls_cert_files"
@@ -16,10 +16,16 @@ package caddytls
 
 import (
 	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/klauspost/cpuid"
+	"github.com/mholt/certmagic"
 )
 
 func TestConvertTLSConfigProtocolVersions(t *testing.T) {
@@ -53,6 +59,80 @@ func TestConvertTLSConfigPreferServerCipherSuites(t *testing.T) {
 	}
 }
 
+func TestConvertTLSConfigALPN(t *testing.T) {
+	for i, test := range []struct {
+		config   Config
+		expected []string
+	}{
+		{Config{Enabled: true, ALPN: []string{"http/1.1"}}, []string{"http/1.1"}},
+		{Config{Enabled: true, ALPN: []string{"http/1.1"}, Manager: &certmagic.Config{}}, []string{"http/1.1"}},
+		{Config{Enabled: true, ALPN: []string{"h2", "http/1.1"}, Managed: true, Manager: &certmagic.Config{}},
+			[]string{"h2", "http/1.1", "acme-tls/1"}},
+		{Config{Enabled: true, ALPN: []string{"http/1.1"}, Manager: &certmagic.Config{OnDemand: &certmagic.OnDemandConfig{}}},
+			[]string{"http/1.1", "acme-tls/1"}},
+		{Config{Enabled: true, ALPN: []string{"http/1.1"}, Managed: true, Manager: &certmagic.Config{DisableTLSALPNChallenge: true}},
+			[]string{"http/1.1"}},
+		{Config{Enabled: true, ALPN: []string{"acme-tls/1", "http/1.1"}, Managed: true, Manager: &certmagic.Config{}},
+			[]string{"acme-tls/1", "http/1.1"}},
+	} {
+		alpn := append([]string{}, test.config.ALPN...)
+		if err := test.config.buildStandardTLSConfig(); err != nil {
+			t.Fatalf("Test %d: Did not expect an error, but got %v", i, err)
+		}
+		if !reflect.DeepEqual(test.config.tlsConfig.NextProtos, test.expected) {
+			t.Errorf("Test %d: Expected NextProtos %v, got %v", i, test.expected, test.config.tlsConfig.NextProtos)
+		}
+		if !reflect.DeepEqual(test.config.ALPN, alpn) {
+			t.Errorf("Test %d: Expected ALPN to stay %v, got %v", i, alpn, test.config.ALPN)
+		}
+	}
+}
+
+func TestConvertTLSConfigKeyLog(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	keyLog := filepath.Join(tmpdir, "keys.log")
+
+	// sites logging to the same file share its writer
+	config1 := Config{Enabled: true, KeyLogFile: keyLog}
+	config2 := Config{Enabled: true, KeyLogFile: filepath.Join(tmpdir, ".", "keys.log")}
+	for _, config := range []*Config{&config1, &config2} {
+		if err := config.buildStandardTLSConfig(); err != nil {
+			t.Fatalf("Did not expect an error, but got %v", err)
+		}
+	}
+	if config1.tlsConfig.KeyLogWriter == nil || config1.tlsConfig.KeyLogWriter != config2.tlsConfig.KeyLogWriter {
+		t.Fatalf("Expected both configs to write to the same key log")
+	}
+
+	cert, err := newSelfSignedCertificate(selfSignedConfig{SAN: []string{"localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := config1.tlsConfig.Clone()
+	serverConfig.GetCertificate = nil
+	serverConfig.Certificates = []tls.Certificate{cert}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go tls.Server(serverConn, serverConfig).Handshake()
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(keyLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "CLIENT_") {
+		t.Errorf("Expected session secrets in key log, got: %q", data)
+	}
+}
+
 func TestMakeTLSConfigTLSEnabledDisabledError(t *testing.T) {
 	// verify handling when Enabled is true and false
 	configs := []*Config{
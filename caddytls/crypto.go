@@ -15,11 +15,22 @@
 package caddytls
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/mholt/certmagic"
 )
 
 // RotateSessionTicketKeys rotates the TLS session ticket keys
@@ -28,9 +39,17 @@ import (
 // close when you are ready to stop the key rotation, like when the
 // server using cfg is no longer running.
 //
-// TODO: See about moving this into CertMagic and using its Storage
+// If sharing them is enabled with TicketKeysSecretEnv, the keys
+// are kept in the storage of the clustering plugin and rotated
+// by whichever instance notices first, so that all instances
+// can resume each other's sessions.
 func RotateSessionTicketKeys(cfg *tls.Config) chan struct{} {
 	ch := make(chan struct{})
+	if atomic.LoadInt32(&shareTicketKeys) == 1 {
+		ticker := time.NewTicker(TicketKeysPollInterval)
+		go distributedTLSTicketKeyRotation(cfg, certmagic.Default.Storage, ticketKeysAEAD, ticker, ch)
+		return ch
+	}
 	ticker := time.NewTicker(TicketRotateInterval)
 	go runTLSTicketKeyRotation(cfg, ticker, ch)
 	return ch
@@ -102,6 +121,201 @@ func standaloneTLSTicketKeyRotation(c *tls.Config, ticker *time.Ticker, exitChan
 	}
 }
 
+// TicketKeysSecretEnv is the environment variable that enables
+// sharing session ticket keys with the other instances of the
+// cluster, through storage. Anyone who can read the keys can
+// decrypt recorded sessions, so they are encrypted with its
+// value, a secret that all instances must have.
+const TicketKeysSecretEnv = "CADDY_SESSION_TICKET_SECRET"
+
+// ticketKeysAEAD encrypts the shared ticket keys in storage;
+// set before shareTicketKeys.
+var ticketKeysAEAD cipher.AEAD
+
+// setupTicketKeySharing enables sharing session ticket keys
+// if TicketKeysSecretEnv is set.
+func setupTicketKeySharing() error {
+	secret := os.Getenv(TicketKeysSecretEnv)
+	if secret == "" {
+		return nil
+	}
+	aead, err := newTicketKeysAEAD(secret)
+	if err != nil {
+		return fmt.Errorf("%s: %v", TicketKeysSecretEnv, err)
+	}
+	ticketKeysAEAD = aead
+	atomic.StoreInt32(&shareTicketKeys, 1)
+	return nil
+}
+
+// newTicketKeysAEAD returns the cipher that shared ticket
+// keys are encrypted with, derived from secret.
+func newTicketKeysAEAD(secret string) (cipher.AEAD, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("secret must be at least 16 characters long")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// distributedTLSTicketKeyRotation is like standaloneTLSTicketKeyRotation,
+// but uses the ticket keys in storage, encrypted with aead, checking them
+// on every tick. If they cannot be loaded the first time, it falls back
+// to rotating keys of its own.
+//
+// Stops the ticker when returning.
+func distributedTLSTicketKeyRotation(c *tls.Config, storage certmagic.Storage, aead cipher.AEAD, ticker *time.Ticker, exitChan chan struct{}) {
+	rng := c.Rand
+	if rng == nil {
+		rng = rand.Reader
+	}
+	keys, err := syncTicketKeys(storage, aead, rng, time.Now())
+	if err != nil {
+		log.Printf("[ERROR] Sharing TLS session ticket keys: %v; rotating them locally", err)
+		ticker.Stop()
+		runTLSTicketKeyRotation(c, time.NewTicker(TicketRotateInterval), exitChan)
+		return
+	}
+	defer ticker.Stop()
+
+	setSessionTicketKeysTestHookMu.Lock()
+	setSessionTicketKeysHook := setSessionTicketKeysTestHook
+	setSessionTicketKeysTestHookMu.Unlock()
+	c.SetSessionTicketKeys(setSessionTicketKeysHook(keys))
+
+	for {
+		select {
+		case _, isOpen := <-exitChan:
+			if !isOpen {
+				return
+			}
+		case <-ticker.C:
+			rng = c.Rand // could've changed since the start
+			if rng == nil {
+				rng = rand.Reader
+			}
+			newKeys, err := syncTicketKeys(storage, aead, rng, time.Now())
+			if err != nil {
+				log.Printf("[ERROR] Sharing TLS session ticket keys: %v", err)
+				continue
+			}
+			if !sameTicketKeys(keys, newKeys) {
+				keys = newKeys
+				c.SetSessionTicketKeys(setSessionTicketKeysHook(keys))
+			}
+		}
+	}
+}
+
+// sharedTicketKeys is how ticket keys are kept in storage.
+type sharedTicketKeys struct {
+	Rotated time.Time `json:"rotated"`
+	Keys    [][]byte  `json:"keys"`
+}
+
+// The storage key of the shared ticket keys, and the
+// name of the lock held while rotating them.
+const (
+	ticketKeysStorageKey = "session_tickets/keys.json"
+	ticketKeysLockName   = "session_ticket_key_rotation"
+)
+
+// syncTicketKeys returns the ticket keys in storage, after
+// rotating them if they were last rotated TicketRotateInterval
+// ago or more (or don't exist yet, or cannot be decrypted).
+func syncTicketKeys(storage certmagic.Storage, aead cipher.AEAD, rng io.Reader, now time.Time) ([][32]byte, error) {
+	if shared, err := loadTicketKeys(storage, aead); err == nil && now.Sub(shared.Rotated) < TicketRotateInterval {
+		return shared.keys()
+	}
+
+	if err := storage.Lock(ticketKeysLockName); err != nil {
+		return nil, err
+	}
+	defer storage.Unlock(ticketKeysLockName)
+
+	// another instance may have rotated them while we waited
+	shared, err := loadTicketKeys(storage, aead)
+	if err == nil && now.Sub(shared.Rotated) < TicketRotateInterval {
+		return shared.keys()
+	}
+	if err != nil {
+		shared = sharedTicketKeys{}
+	}
+
+	newKey := make([]byte, 32)
+	if _, err := io.ReadFull(rng, newKey); err != nil {
+		return nil, err
+	}
+	shared.Keys = append([][]byte{newKey}, shared.Keys...)
+	if len(shared.Keys) > NumTickets {
+		shared.Keys = shared.Keys[:NumTickets]
+	}
+	shared.Rotated = now
+
+	data, err := json.Marshal(shared)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rng, nonce); err != nil {
+		return nil, err
+	}
+	if err := storage.Store(ticketKeysStorageKey, aead.Seal(nonce, nonce, data, nil)); err != nil {
+		return nil, err
+	}
+	return shared.keys()
+}
+
+// loadTicketKeys loads the ticket keys from storage and
+// decrypts them with aead; they are stored as the nonce
+// followed by the sealed JSON.
+func loadTicketKeys(storage certmagic.Storage, aead cipher.AEAD) (sharedTicketKeys, error) {
+	var shared sharedTicketKeys
+	data, err := storage.Load(ticketKeysStorageKey)
+	if err != nil {
+		return shared, err
+	}
+	if len(data) < aead.NonceSize() {
+		return shared, errors.New("session ticket keys in storage are truncated")
+	}
+	data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return shared, fmt.Errorf("decrypting session ticket keys in storage: %v", err)
+	}
+	err = json.Unmarshal(data, &shared)
+	return shared, err
+}
+
+func (s sharedTicketKeys) keys() ([][32]byte, error) {
+	if len(s.Keys) == 0 {
+		return nil, fmt.Errorf("no session ticket keys in storage")
+	}
+	keys := make([][32]byte, len(s.Keys))
+	for i, k := range s.Keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("session ticket key %d in storage has %d bytes, expected 32", i, len(k))
+		}
+		copy(keys[i][:], k)
+	}
+	return keys, nil
+}
+
+func sameTicketKeys(a, b [][32]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 const (
 	// NumTickets is how many tickets to hold and consider
 	// to decrypt TLS sessions.
@@ -110,4 +324,8 @@ const (
 	// TicketRotateInterval is how often to generate
 	// new ticket for TLS PFS encryption
 	TicketRotateInterval = 10 * time.Hour
+
+	// TicketKeysPollInterval is how often instances of a
+	// cluster check the shared ticket keys for rotation
+	TicketKeysPollInterval = 1 * time.Minute
 )
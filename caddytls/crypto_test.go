@@ -15,9 +15,16 @@
 package caddytls
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/mholt/certmagic"
 )
 
 func TestStandaloneTLSTicketKeyRotation(t *testing.T) {
@@ -78,3 +85,83 @@ func TestStandaloneTLSTicketKeyRotation(t *testing.T) {
 		}
 	}
 }
+
+func TestSyncTicketKeys(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	storage := &certmagic.FileStorage{Path: tmpdir}
+	aead, err := newTicketKeysAEAD("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	first, err := syncTicketKeys(storage, aead, rand.Reader, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(first))
+	}
+
+	// the keys are not stored in the clear
+	data, err := storage.Load(ticketKeysStorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, first[0][:]) || bytes.Contains(data, []byte(base64.StdEncoding.EncodeToString(first[0][:]))) {
+		t.Error("Expected the stored ticket keys to be encrypted")
+	}
+
+	// an instance with another secret cannot read them
+	otherAEAD, err := newTicketKeysAEAD("another secret of some length")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTicketKeys(storage, otherAEAD); err == nil {
+		t.Error("Expected an error decrypting ticket keys with another secret")
+	}
+
+	// another instance within the interval gets the same keys
+	same, err := syncTicketKeys(storage, aead, rand.Reader, now.Add(TicketRotateInterval/2))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !sameTicketKeys(first, same) {
+		t.Errorf("Expected keys not to be rotated within the interval")
+	}
+
+	// once the interval passes, a new key is added in front
+	later := now
+	var keys [][32]byte
+	for i := 0; i < NumTickets+1; i++ {
+		later = later.Add(TicketRotateInterval)
+		keys, err = syncTicketKeys(storage, aead, rand.Reader, later)
+		if err != nil {
+			t.Fatalf("Rotation %d: expected no error, got: %v", i, err)
+		}
+		if keys[0] == first[0] {
+			t.Fatalf("Rotation %d: expected a new key in front", i)
+		}
+	}
+	if len(keys) != NumTickets {
+		t.Errorf("Expected %d keys after rotations, got %d", NumTickets, len(keys))
+	}
+	for _, k := range keys {
+		if k == first[0] {
+			t.Errorf("Expected the oldest key to be dropped")
+		}
+	}
+}
+
+func TestNewTicketKeysAEAD(t *testing.T) {
+	if _, err := newTicketKeysAEAD("short"); err == nil {
+		t.Error("Expected an error for a short secret")
+	}
+	if _, err := newTicketKeysAEAD("long enough secret"); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
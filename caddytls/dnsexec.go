@@ -0,0 +1,54 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-acme/lego/providers/dns/exec"
+)
+
+func init() {
+	RegisterDNSProvider("exec", newExecDNSProvider)
+}
+
+// newExecDNSProvider returns a DNS provider that solves the
+// challenge by running a program, which can call the API of
+// any DNS host without a dedicated provider being plugged in:
+//
+//	dns exec [program [raw]]
+//
+// The program is run as "program present|cleanup <fqdn> <value>",
+// or with "raw", as "program present|cleanup -- <domain> <token>
+// <key auth>". Without credentials, the EXEC_PATH and EXEC_MODE
+// environment variables are used.
+func newExecDNSProvider(credentials ...string) (ChallengeProvider, error) {
+	if len(credentials) == 0 {
+		return exec.NewDNSProvider()
+	}
+	if len(credentials) > 2 {
+		return nil, errors.New("expected a program and an optional mode")
+	}
+	config := exec.NewDefaultConfig()
+	config.Program = credentials[0]
+	if len(credentials) == 2 {
+		if !strings.EqualFold(credentials[1], "raw") {
+			return nil, errors.New("unknown mode " + credentials[1] + "; only raw is supported")
+		}
+		config.Mode = "RAW"
+	}
+	return exec.NewDNSProviderConfig(config)
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// keyLogs are the open key log files by path; they are
+// shared by the sites writing to the same file and stay
+// open for the life of the process.
+var (
+	keyLogs   = make(map[string]*keyLogFile)
+	keyLogsMu sync.Mutex
+)
+
+// keyLogFile serializes the writes of concurrent
+// handshakes, so their lines don't interleave.
+type keyLogFile struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (k *keyLogFile) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.f.Write(p)
+}
+
+// openKeyLog returns a writer that appends to the key
+// log file at path, opening it if it is not open yet.
+func openKeyLog(path string) (io.Writer, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	keyLogsMu.Lock()
+	defer keyLogsMu.Unlock()
+	if k, ok := keyLogs[abs]; ok {
+		return k, nil
+	}
+	f, err := os.OpenFile(abs, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[WARNING] Writing TLS session secrets to %s; anyone who can read it can decrypt "+
+		"traffic of these sites, so only use this for debugging", abs)
+	k := &keyLogFile{f: f}
+	keyLogs[abs] = k
+	return k, nil
+}
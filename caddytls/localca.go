@@ -0,0 +1,239 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/certcrypto"
+	"github.com/mholt/certmagic"
+)
+
+// Where the root of the local CA is kept in storage, and
+// the lock held while creating it.
+const (
+	localCARootCertKey = "pki/local/root.crt"
+	localCARootKeyKey  = "pki/local/root.key"
+	localCALockName    = "local_ca_root"
+)
+
+// How long roots of the local CA and the certificates
+// it issues are valid.
+var (
+	localCARootLifetime = 10 * 365 * 24 * time.Hour
+	localCALeafLifetime = 365 * 24 * time.Hour
+)
+
+// LocalCA is a certificate authority of our own, which
+// issues certificates for names that public CAs won't,
+// like myapp.localhost. Its root is kept in storage, so
+// it stays the same across restarts, and all instances
+// sharing the storage (or a copy of the root's files)
+// issue certificates that chain to the same root. Only
+// clients that trust the root accept its certificates.
+type LocalCA struct {
+	Root    *x509.Certificate
+	rootKey crypto.Signer
+}
+
+// LoadLocalCA loads the root of the local CA from storage,
+// creating and storing a new one if there is none yet.
+func LoadLocalCA(storage certmagic.Storage) (*LocalCA, error) {
+	if ca, err := loadLocalCA(storage); err == nil {
+		return ca, nil
+	}
+
+	if err := storage.Lock(localCALockName); err != nil {
+		return nil, err
+	}
+	defer storage.Unlock(localCALockName)
+
+	// another instance may have created it while we waited
+	if ca, err := loadLocalCA(storage); err == nil {
+		return ca, nil
+	}
+	if storage.Exists(localCARootCertKey) || storage.Exists(localCARootKeyKey) {
+		// don't replace a root that clients might trust
+		// already just because we can't read it
+		_, err := loadLocalCA(storage)
+		return nil, fmt.Errorf("loading root of local CA: %v", err)
+	}
+
+	ca, err := newLocalCA()
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(ca.rootKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Store(localCARootKeyKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Store(localCARootCertKey, ca.RootPEM())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] Created root certificate of local CA; to trust the certificates it issues, " +
+		"add it to the trust stores of your clients (caddy -local-ca-root=FILE exports it)")
+	return ca, nil
+}
+
+func loadLocalCA(storage certmagic.Storage) (*LocalCA, error) {
+	certPEM, err := storage.Load(localCARootCertKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := storage.Load(localCARootKeyKey)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	root, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported root key type %T", pair.PrivateKey)
+	}
+	return &LocalCA{Root: root, rootKey: key}, nil
+}
+
+func newLocalCA() (*LocalCA, error) {
+	key, err := generatePrivateKey(certcrypto.EC256)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	notBefore := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"Caddy Local CA"},
+			CommonName:   "Caddy Local CA Root (" + hostname + ")",
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(localCARootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create root certificate: %v", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalCA{Root: root, rootKey: key}, nil
+}
+
+// RootPEM returns the root certificate in PEM form, which
+// is what most trust stores import.
+func (ca *LocalCA) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+}
+
+// Issue issues a certificate for names with a new key of
+// the given type.
+func (ca *LocalCA) Issue(names []string, keyType certcrypto.KeyType) (tls.Certificate, error) {
+	privKey, err := generatePrivateKey(keyType)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	notBefore := time.Now()
+	notAfter := notBefore.Add(localCALeafLifetime)
+	if notAfter.After(ca.Root.NotAfter) {
+		notAfter = ca.Root.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{Organization: []string{"Caddy Local CA"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if len(names) > 0 {
+		tmpl.Subject.CommonName = names[0]
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, strings.ToLower(name))
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Root, privKey.Public(), ca.rootKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not issue certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, ca.Root.Raw},
+		PrivateKey:  privKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// ExportLocalCARoot returns the root certificate of the
+// local CA in PEM form, creating the CA if necessary.
+func ExportLocalCARoot() ([]byte, error) {
+	ca, err := LoadLocalCA(certmagic.Default.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return ca.RootPEM(), nil
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	return serialNumber, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/certmagic"
+)
+
+func TestLocalCA(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	storage := &certmagic.FileStorage{Path: tmpdir}
+
+	ca, err := LoadLocalCA(storage)
+	if err != nil {
+		t.Fatalf("Expected no error creating local CA, got: %v", err)
+	}
+	if !ca.Root.IsCA {
+		t.Errorf("Expected root to be a CA certificate")
+	}
+
+	// the root is the same once loaded again
+	again, err := LoadLocalCA(storage)
+	if err != nil {
+		t.Fatalf("Expected no error loading local CA, got: %v", err)
+	}
+	if !again.Root.Equal(ca.Root) {
+		t.Errorf("Expected the stored root to be loaded")
+	}
+
+	cert, err := again.Issue([]string{"myapp.localhost", "127.0.0.1"}, "")
+	if err != nil {
+		t.Fatalf("Expected no error issuing certificate, got: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.RootPEM())
+	for _, name := range []string{"myapp.localhost", "127.0.0.1"} {
+		_, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		if err != nil {
+			t.Errorf("Expected certificate for %s to chain to the root, got: %v", name, err)
+		}
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "other.localhost", Roots: roots}); err == nil {
+		t.Errorf("Expected certificate not to be valid for other names")
+	}
+
+	// a root that can't be read is not replaced
+	if err := storage.Store(localCARootKeyKey, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLocalCA(storage); err == nil {
+		t.Errorf("Expected an error loading a broken root")
+	}
+	if data, err := storage.Load(localCARootCertKey); err != nil || string(data) != string(ca.RootPEM()) {
+		t.Errorf("Expected broken root to be left in place")
+	}
+}
+
+func TestSetupParseWithInternal(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	storage := &certmagic.FileStorage{Path: tmpdir}
+
+	cfg := &Config{Hostname: "myapp.localhost", Manager: certmagic.NewDefault()}
+	cfg.Manager.Storage = storage
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	c := caddy.NewTestController("", `tls internal`)
+	if err := setupTLS(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if !cfg.Internal {
+		t.Errorf("Expected Internal to be true")
+	}
+	if cfg.Manager.Email != "" {
+		t.Errorf("Expected no ACME email, got '%s'", cfg.Manager.Email)
+	}
+
+	ca, err := LoadLocalCA(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	cert, err := cfg.Manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "myapp.localhost"})
+	if err != nil {
+		t.Fatalf("Expected a certificate, got error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "myapp.localhost", Roots: roots}); err != nil {
+		t.Errorf("Expected certificate issued by local CA, got: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/certmagic"
+)
+
+// How long answers of the ask endpoint are remembered.
+const (
+	askAllowedTTL = 1 * time.Hour
+	askDeniedTTL  = 1 * time.Minute
+)
+
+// askCacheSize is how many answers of the ask endpoint are
+// remembered at most. Clients choose the names they ask for,
+// so the least recently used answers are forgotten first.
+var askCacheSize = 10000
+
+// OnDemandPolicy decides whether a certificate may be
+// obtained during a TLS handshake for a name that no
+// certificate has been loaded for yet. All of its
+// configured checks must pass.
+type OnDemandPolicy struct {
+	// Names that certificates may be obtained for; a
+	// name starting with "*." matches any one label in
+	// its place. If empty, names are not restricted.
+	Allow []string
+
+	// If set, the name is passed as the domain query
+	// parameter to this endpoint, which must respond
+	// with a 2xx status for issuance to proceed. Answers
+	// are cached, so the endpoint is not asked during
+	// every handshake.
+	AskURL *url.URL
+
+	// If greater than 0, at most this many certificates
+	// are obtained in total.
+	MaxObtain int
+
+	// If Rate is greater than 0, at most Rate issuances
+	// are attempted within any period of RateWindow.
+	Rate       int
+	RateWindow time.Duration
+
+	mu       sync.Mutex
+	asked    map[string]*list.Element
+	askedLRU *list.List // of *askAnswer, most recently used first
+	obtained int
+	attempts []time.Time
+
+	// for tests
+	client *http.Client
+	now    func() time.Time
+}
+
+type askAnswer struct {
+	name    string
+	err     error
+	expires time.Time
+}
+
+// Decide implements certmagic.OnDemandConfig.DecisionFunc.
+// Every name it allows counts towards MaxObtain and Rate.
+func (p *OnDemandPolicy) Decide(name string) error {
+	name = certmagic.NormalizedName(name)
+	if len(p.Allow) > 0 && !p.allowed(name) {
+		return fmt.Errorf("%s: name is not allowed for on-demand TLS", name)
+	}
+	if p.AskURL != nil {
+		if err := p.ask(name); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.MaxObtain > 0 && p.obtained >= p.MaxObtain {
+		return fmt.Errorf("%s: maximum certificates issued (%d)", name, p.MaxObtain)
+	}
+	if p.Rate > 0 {
+		now := p.clock()
+		recent := p.attempts[:0]
+		for _, t := range p.attempts {
+			if now.Sub(t) < p.RateWindow {
+				recent = append(recent, t)
+			}
+		}
+		p.attempts = recent
+		if len(p.attempts) >= p.Rate {
+			return fmt.Errorf("%s: too many on-demand certificate issuances; at most %d per %s", name, p.Rate, p.RateWindow)
+		}
+		p.attempts = append(p.attempts, now)
+	}
+	p.obtained++
+	return nil
+}
+
+// allowed reports whether name is in the Allow list.
+func (p *OnDemandPolicy) allowed(name string) bool {
+	for _, allowed := range p.Allow {
+		allowed = certmagic.NormalizedName(allowed)
+		if allowed == name {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") {
+			i := strings.Index(name, ".")
+			if i > 0 && name[i:] == allowed[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ask asks the AskURL endpoint whether name is allowed,
+// if that has not been asked recently.
+func (p *OnDemandPolicy) ask(name string) error {
+	now := p.clock()
+	p.mu.Lock()
+	if el, ok := p.asked[name]; ok {
+		answer := el.Value.(*askAnswer)
+		if now.Before(answer.expires) {
+			p.askedLRU.MoveToFront(el)
+			p.mu.Unlock()
+			return answer.err
+		}
+		p.askedLRU.Remove(el)
+		delete(p.asked, name)
+	}
+	p.mu.Unlock()
+
+	err := p.askURL(name)
+	answer := &askAnswer{name: name, err: err, expires: now.Add(askAllowedTTL)}
+	if err != nil {
+		answer.expires = now.Add(askDeniedTTL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.asked == nil {
+		p.asked = make(map[string]*list.Element)
+		p.askedLRU = list.New()
+	}
+	if el, ok := p.asked[name]; ok {
+		// asked concurrently
+		p.askedLRU.Remove(el)
+	}
+	p.asked[name] = p.askedLRU.PushFront(answer)
+	for p.askedLRU.Len() > askCacheSize {
+		oldest := p.askedLRU.Remove(p.askedLRU.Back()).(*askAnswer)
+		delete(p.asked, oldest.name)
+	}
+	return err
+}
+
+func (p *OnDemandPolicy) askURL(name string) error {
+	client := p.client
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return fmt.Errorf("following http redirects is not allowed")
+			},
+		}
+	}
+
+	askURL := *p.AskURL
+	query := askURL.Query()
+	query.Set("domain", name)
+	askURL.RawQuery = query.Encode()
+
+	resp, err := client.Get(askURL.String())
+	if err != nil {
+		return fmt.Errorf("checking %v to determine if certificate for hostname '%s' should be allowed: %v", p.AskURL, name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("certificate for hostname '%s' not allowed, non-2xx status code %d returned from %v", name, resp.StatusCode, p.AskURL)
+	}
+	return nil
+}
+
+func (p *OnDemandPolicy) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
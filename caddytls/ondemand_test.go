@@ -0,0 +1,123 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnDemandPolicyAllow(t *testing.T) {
+	p := &OnDemandPolicy{Allow: []string{"example.com", "*.Example.NET"}}
+	for name, allowed := range map[string]bool{
+		"example.com":       true,
+		"EXAMPLE.com":       true,
+		"www.example.com":   false,
+		"a.example.net":     true,
+		"a.b.example.net":   false,
+		"example.net":       false,
+		"evilexample.net":   false,
+		"a.example.net.com": false,
+	} {
+		if err := p.Decide(name); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got error %v", name, allowed, err)
+		}
+	}
+}
+
+func TestOnDemandPolicyAsk(t *testing.T) {
+	var asked int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&asked, 1)
+		if r.URL.Query().Get("domain") != "customer.example" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	askURL, _ := url.Parse(srv.URL + "/check?token=x")
+
+	now := time.Now()
+	p := &OnDemandPolicy{AskURL: askURL, now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		if err := p.Decide("customer.example"); err != nil {
+			t.Fatalf("Expected customer.example to be allowed, got: %v", err)
+		}
+		if err := p.Decide("unknown.example"); err == nil {
+			t.Fatal("Expected unknown.example to be denied")
+		}
+	}
+	if n := atomic.LoadInt32(&asked); n != 2 {
+		t.Errorf("Expected answers to be cached, so 2 requests; got %d", n)
+	}
+
+	now = now.Add(askDeniedTTL)
+	p.Decide("unknown.example")
+	p.Decide("customer.example")
+	if n := atomic.LoadInt32(&asked); n != 3 {
+		t.Errorf("Expected only the denial to expire, so 3 requests; got %d", n)
+	}
+}
+
+func TestOnDemandPolicyAskCacheSize(t *testing.T) {
+	defer func(size int) { askCacheSize = size }(askCacheSize)
+	askCacheSize = 2
+
+	var asked int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&asked, 1)
+	}))
+	defer srv.Close()
+	askURL, _ := url.Parse(srv.URL)
+
+	p := &OnDemandPolicy{AskURL: askURL}
+	for _, name := range []string{"a.example", "b.example", "a.example", "c.example"} {
+		p.Decide(name)
+	}
+	if len(p.asked) != 2 || p.askedLRU.Len() != 2 {
+		t.Errorf("Expected 2 remembered answers, got %d (%d in LRU list)", len(p.asked), p.askedLRU.Len())
+	}
+	// b.example was the least recently used, so it was forgotten
+	if _, ok := p.asked["b.example"]; ok {
+		t.Error("Expected the answer for b.example to be evicted")
+	}
+	p.Decide("a.example")
+	if n := atomic.LoadInt32(&asked); n != 3 {
+		t.Errorf("Expected a.example to still be cached, so 3 requests; got %d", n)
+	}
+}
+
+func TestOnDemandPolicyLimits(t *testing.T) {
+	now := time.Now()
+	p := &OnDemandPolicy{MaxObtain: 4, Rate: 2, RateWindow: time.Minute, now: func() time.Time { return now }}
+	for i, expectAllowed := range []bool{true, true, false} {
+		if err := p.Decide("a.example"); (err == nil) != expectAllowed {
+			t.Errorf("Attempt %d: expected allowed=%v, got error %v", i, expectAllowed, err)
+		}
+	}
+	now = now.Add(time.Minute)
+	for i, expectAllowed := range []bool{true, true, false} {
+		if err := p.Decide("b.example"); (err == nil) != expectAllowed {
+			t.Errorf("Attempt %d after a minute: expected allowed=%v, got error %v", i, expectAllowed, err)
+		}
+	}
+	now = now.Add(time.Hour)
+	if err := p.Decide("c.example"); err == nil {
+		t.Error("Expected max_certs to be reached")
+	}
+}
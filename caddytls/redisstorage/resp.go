@@ -0,0 +1,194 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisstorage
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNil is returned for nil replies.
+var errNil = errors.New("redis: nil")
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// client is a minimal client of the Redis protocol (RESP)
+// with a small pool of connections.
+type client struct {
+	Addr     string
+	Password string
+	DB       int
+	TLS      *tls.Config
+	Timeout  time.Duration
+
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newClient(addr, password string, db int, tlsConfig *tls.Config) *client {
+	return &client{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+		TLS:      tlsConfig,
+		Timeout:  10 * time.Second,
+		pool:     make(chan *conn, 4),
+	}
+}
+
+// do sends a command and returns its reply: a string for
+// simple and bulk strings, an int64 for integers, and an
+// []interface{} for arrays. Nil replies return errNil.
+func (c *client) do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(c.Timeout, args...)
+	if _, ok := err.(redisError); err != nil && !ok && err != errNil {
+		// the connection may be out of sync; don't reuse it
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	if e, ok := err.(redisError); ok && (strings.HasPrefix(string(e), "MOVED ") || strings.HasPrefix(string(e), "ASK ")) {
+		// only a node of a Redis Cluster redirects
+		return nil, fmt.Errorf("redis: redirected to another cluster node (%s); Redis Cluster is not supported", string(e))
+	}
+	return reply, err
+}
+
+func (c *client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	var nc net.Conn
+	var err error
+	if c.TLS != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", c.Addr, c.TLS)
+	} else {
+		nc, err = dialer.Dial("tcp", c.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.Password != "" {
+		if _, err := cn.do(c.Timeout, "AUTH", c.Password); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.DB != 0 {
+		if _, err := cn.do(c.Timeout, "SELECT", strconv.Itoa(c.DB)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (cn *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	cn.SetDeadline(time.Now().Add(timeout))
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// readReply reads one reply from r.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i], err = readReply(r)
+			if err == errNil {
+				items[i], err = nil, nil
+			}
+			if _, ok := err.(redisError); err != nil && !ok {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
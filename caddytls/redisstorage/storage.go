@@ -0,0 +1,358 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redisstorage stores certificates, keys and ACME
+// account data in a single Redis server, so that a cluster of
+// Caddy instances shares them and coordinates their issuance
+// and renewal with locks. Redis Cluster is not supported: keys
+// are listed with SCAN on one node and redirects are not
+// followed, so a server in cluster mode is refused. It is
+// enabled by setting CADDY_CLUSTERING=redis and configured
+// with these environment variables:
+//
+//	REDIS_ADDRESS     host:port of the server (localhost:6379)
+//	REDIS_PASSWORD    password to authenticate with
+//	REDIS_DB          number of the database to use (0)
+//	REDIS_KEY_PREFIX  prefix of all keys (caddytls)
+//	REDIS_TLS         "true" to connect with TLS
+package redisstorage
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+	"github.com/mholt/certmagic"
+)
+
+func init() {
+	caddytls.RegisterClusterPlugin("redis", constructStorage)
+}
+
+// Lock timing.
+const (
+	// LockTTL is how long a lock outlives the instance holding
+	// it, if that instance crashes; while it runs, locks held by
+	// it are refreshed.
+	LockTTL = 1 * time.Minute
+
+	// LockPollInterval is how often a held lock is tried again.
+	LockPollInterval = 1 * time.Second
+)
+
+// unlockScript deletes a lock only if it is still ours.
+const unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// refreshScript extends a lock only if it is still ours.
+const refreshScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+func constructStorage() (certmagic.Storage, error) {
+	addr := os.Getenv("REDIS_ADDRESS")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	var db int
+	if v := os.Getenv("REDIS_DB"); v != "" {
+		var err error
+		db, err = strconv.Atoi(v)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid REDIS_DB '%s'", v)
+		}
+	}
+	var tlsConfig *tls.Config
+	if strings.EqualFold(os.Getenv("REDIS_TLS"), "true") {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+	s := newStorage(newClient(addr, os.Getenv("REDIS_PASSWORD"), db, tlsConfig), os.Getenv("REDIS_KEY_PREFIX"))
+	if _, err := s.client.do("PING"); err != nil {
+		return nil, fmt.Errorf("connecting to redis at %s: %v", addr, err)
+	}
+	if err := checkStandalone(s.client); err != nil {
+		return nil, fmt.Errorf("redis at %s: %v", addr, err)
+	}
+	return s, nil
+}
+
+// checkStandalone returns an error if the server c talks
+// to is a node of a Redis Cluster.
+func checkStandalone(c *client) error {
+	v, err := c.do("INFO", "cluster")
+	if err != nil {
+		return err
+	}
+	info, _ := v.(string)
+	for _, line := range strings.Split(info, "\n") {
+		if strings.TrimSpace(line) == "cluster_enabled:1" {
+			return fmt.Errorf("Redis Cluster is not supported; use a single server")
+		}
+	}
+	return nil
+}
+
+// Storage is a certmagic.Storage in Redis. Each value is
+// a hash holding the data and its modification time.
+type Storage struct {
+	client *client
+	prefix string
+
+	mu    sync.Mutex
+	locks map[string]*heldLock
+}
+
+type heldLock struct {
+	token string
+	done  chan struct{}
+}
+
+// newStorage returns storage that uses c with keys under
+// prefix, which defaults to "caddytls".
+func newStorage(c *client, prefix string) *Storage {
+	if prefix == "" {
+		prefix = "caddytls"
+	}
+	return &Storage{client: c, prefix: prefix, locks: make(map[string]*heldLock)}
+}
+
+func (s *Storage) dataKey(key string) string { return s.prefix + ":data:" + key }
+func (s *Storage) lockKey(key string) string { return s.prefix + ":lock:" + key }
+
+// Store implements certmagic.Storage.
+func (s *Storage) Store(key string, value []byte) error {
+	modified := strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err := s.client.do("HSET", s.dataKey(key), "value", string(value), "modified", modified)
+	return err
+}
+
+// Load implements certmagic.Storage.
+func (s *Storage) Load(key string) ([]byte, error) {
+	v, err := s.client.do("HGET", s.dataKey(key), "value")
+	if err == errNil {
+		return nil, certmagic.ErrNotExist(fmt.Errorf("key %s does not exist", key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	str, _ := v.(string)
+	return []byte(str), nil
+}
+
+// Delete implements certmagic.Storage.
+func (s *Storage) Delete(key string) error {
+	n, err := s.client.do("DEL", s.dataKey(key))
+	if err != nil {
+		return err
+	}
+	if n, _ := n.(int64); n == 0 {
+		return certmagic.ErrNotExist(fmt.Errorf("key %s does not exist", key))
+	}
+	return nil
+}
+
+// Exists implements certmagic.Storage.
+func (s *Storage) Exists(key string) bool {
+	n, err := s.client.do("EXISTS", s.dataKey(key))
+	if err != nil {
+		return false
+	}
+	n64, _ := n.(int64)
+	return n64 > 0
+}
+
+// List implements certmagic.Storage. Like directories in file
+// storage, keys that only prefix other keys are listed too.
+func (s *Storage) List(prefix string, recursive bool) ([]string, error) {
+	prefix = strings.Trim(prefix, "/")
+	base := s.dataKey("")
+	pattern := base + globEscape(prefix) + "*"
+	if prefix != "" {
+		pattern = base + globEscape(prefix) + "/*"
+	}
+
+	found := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply, err := s.client.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply")
+		}
+		cursor, _ = parts[0].(string)
+		keys, _ := parts[1].([]interface{})
+		for _, k := range keys {
+			name, _ := k.(string)
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, base+prefix), "/")
+			if rel == "" {
+				continue
+			}
+			elems := strings.Split(rel, "/")
+			if !recursive {
+				elems = elems[:1]
+			}
+			for i := range elems {
+				found[path.Join(prefix, strings.Join(elems[:i+1], "/"))] = true
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	if len(found) == 0 {
+		return nil, certmagic.ErrNotExist(fmt.Errorf("no keys with prefix %s", prefix))
+	}
+
+	list := make([]string, 0, len(found))
+	for k := range found {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Stat implements certmagic.Storage.
+func (s *Storage) Stat(key string) (certmagic.KeyInfo, error) {
+	reply, err := s.client.do("HMGET", s.dataKey(key), "value", "modified")
+	if err != nil {
+		return certmagic.KeyInfo{}, err
+	}
+	fields, _ := reply.([]interface{})
+	if len(fields) != 2 || fields[0] == nil {
+		if keys, err := s.List(key, false); err == nil && len(keys) > 0 {
+			return certmagic.KeyInfo{Key: key, IsTerminal: false}, nil
+		}
+		return certmagic.KeyInfo{}, certmagic.ErrNotExist(fmt.Errorf("key %s does not exist", key))
+	}
+	value, _ := fields[0].(string)
+	modified, _ := fields[1].(string)
+	nanos, _ := strconv.ParseInt(modified, 10, 64)
+	return certmagic.KeyInfo{
+		Key:        key,
+		Modified:   time.Unix(0, nanos),
+		Size:       int64(len(value)),
+		IsTerminal: true,
+	}, nil
+}
+
+// Lock implements certmagic.Locker. It blocks until no other
+// instance holds the lock for key. While held, the lock is
+// refreshed, so that only a crashed instance's lock expires.
+func (s *Storage) Lock(key string) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	ttl := strconv.FormatInt(int64(LockTTL/time.Millisecond), 10)
+	start := time.Now()
+	for {
+		reply, err := s.client.do("SET", s.lockKey(key), token, "NX", "PX", ttl)
+		if err != nil && err != errNil {
+			return fmt.Errorf("acquiring lock for %s: %v", key, err)
+		}
+		if reply == "OK" {
+			break
+		}
+		if time.Since(start) > lockWaitTimeout {
+			return fmt.Errorf("possible deadlock: %s passed trying to obtain lock for %s", time.Since(start), key)
+		}
+		time.Sleep(LockPollInterval)
+	}
+
+	held := &heldLock{token: token, done: make(chan struct{})}
+	s.mu.Lock()
+	s.locks[key] = held
+	s.mu.Unlock()
+
+	go s.keepLock(key, held, ttl)
+	return nil
+}
+
+// lockWaitTimeout is how long Lock waits for a lock, at most,
+// before assuming something is wrong.
+var lockWaitTimeout = 2 * time.Hour
+
+// keepLock refreshes a held lock until it is unlocked.
+func (s *Storage) keepLock(key string, held *heldLock, ttl string) {
+	ticker := time.NewTicker(LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-held.done:
+			return
+		case <-ticker.C:
+			reply, err := s.client.do("EVAL", refreshScript, "1", s.lockKey(key), held.token, ttl)
+			if err != nil {
+				log.Printf("[ERROR][redis] Refreshing lock for %s: %v", key, err)
+			} else if n, _ := reply.(int64); n == 0 {
+				log.Printf("[WARNING][redis] Lock for %s was lost", key)
+				return
+			}
+		}
+	}
+}
+
+// Unlock implements certmagic.Locker.
+func (s *Storage) Unlock(key string) error {
+	s.mu.Lock()
+	held, ok := s.locks[key]
+	delete(s.locks, key)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("lock for %s is not held", key)
+	}
+	close(held.done)
+	_, err := s.client.do("EVAL", unlockScript, "1", s.lockKey(key), held.token)
+	return err
+}
+
+// String returns a description of the storage for logs.
+func (s *Storage) String() string {
+	return "redis:" + s.client.Addr + "/" + s.prefix
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// globEscape escapes the special characters of SCAN patterns.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
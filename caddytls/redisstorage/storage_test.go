@@ -0,0 +1,393 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisstorage
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/certmagic"
+)
+
+// fakeRedis is an in-memory server of the few commands
+// the storage uses.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+	cluster  bool
+
+	mu      sync.Mutex
+	hashes  map[string]map[string]string
+	strings map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:       ln,
+		password: password,
+		hashes:   make(map[string]map[string]string),
+		strings:  make(map[string]string),
+		expires:  make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	authed := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range reply.([]interface{}) {
+			args = append(args, a.(string))
+		}
+		if strings.ToUpper(args[0]) == "AUTH" {
+			authed = len(args) == 2 && args[1] == f.password
+			if !authed {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+				w.Flush()
+				continue
+			}
+		}
+		if !authed {
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		} else {
+			f.mu.Lock()
+			w.WriteString(f.exec(args))
+			f.mu.Unlock()
+		}
+		w.Flush()
+	}
+}
+
+func bulk(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+		delete(f.strings, key)
+		delete(f.expires, key)
+	}
+	v, ok := f.strings[key]
+	return v, ok
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING", "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "HSET":
+		h := f.hashes[args[1]]
+		if h == nil {
+			h = make(map[string]string)
+			f.hashes[args[1]] = h
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			h[args[i]] = args[i+1]
+		}
+		return ":1\r\n"
+	case "HGET":
+		if v, ok := f.hashes[args[1]][args[2]]; ok {
+			return bulk(v)
+		}
+		return "$-1\r\n"
+	case "HMGET":
+		out := "*" + strconv.Itoa(len(args)-2) + "\r\n"
+		for _, field := range args[2:] {
+			if v, ok := f.hashes[args[1]][field]; ok {
+				out += bulk(v)
+			} else {
+				out += "$-1\r\n"
+			}
+		}
+		return out
+	case "DEL":
+		_, ok := f.hashes[args[1]]
+		_, sok := f.get(args[1])
+		delete(f.hashes, args[1])
+		delete(f.strings, args[1])
+		if ok || sok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "EXISTS":
+		if _, ok := f.hashes[args[1]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "INFO":
+		if f.cluster {
+			return bulk("# Cluster\r\ncluster_enabled:1\r\n")
+		}
+		return bulk("# Cluster\r\ncluster_enabled:0\r\n")
+	case "GET":
+		if f.cluster {
+			return "-MOVED 3999 127.0.0.1:6381\r\n"
+		}
+		v, ok := f.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "SCAN":
+		re := globRegexp(args[3])
+		var keys []string
+		for k := range f.hashes {
+			if re.MatchString(k) {
+				keys = append(keys, k)
+			}
+		}
+		out := "*2\r\n" + bulk("0") + "*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, k := range keys {
+			out += bulk(k)
+		}
+		return out
+	case "SET":
+		if _, held := f.get(args[1]); held {
+			return "$-1\r\n"
+		}
+		f.strings[args[1]] = args[2]
+		ms, _ := strconv.Atoi(args[5])
+		f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "EVAL":
+		key, token := args[3], args[4]
+		if v, ok := f.get(key); !ok || v != token {
+			return ":0\r\n"
+		}
+		if args[1] == unlockScript {
+			delete(f.strings, key)
+			delete(f.expires, key)
+		} else {
+			ms, _ := strconv.Atoi(args[5])
+			f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// globRegexp converts a Redis glob pattern with *, ? and
+// backslash escapes to a regular expression.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			i++
+			if i < len(pattern) {
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func TestStorage(t *testing.T) {
+	f := newFakeRedis(t, "hunter2")
+	defer f.ln.Close()
+
+	if _, err := newClient(f.ln.Addr().String(), "wrong", 0, nil).do("PING"); err == nil {
+		t.Error("Expected wrong password to fail")
+	}
+
+	s := newStorage(newClient(f.ln.Addr().String(), "hunter2", 1, nil), "")
+	var _ certmagic.Storage = s
+
+	if _, err := s.Load("acme/ca/sites/example.com/example.com.crt"); err == nil {
+		t.Error("Expected error loading missing key")
+	}
+	if s.Exists("acme/ca/sites/example.com/example.com.crt") {
+		t.Error("Expected missing key not to exist")
+	}
+
+	before := time.Now()
+	for _, key := range []string{
+		"acme/ca/sites/example.com/example.com.crt",
+		"acme/ca/sites/example.com/example.com.key",
+		"acme/ca/sites/ex*mple.net/ex*mple.net.crt",
+		"acme/ca/users/me@example.com/me@example.com.json",
+		"acmeother/x",
+	} {
+		if err := s.Store(key, []byte("data of "+key)); err != nil {
+			t.Fatalf("Storing %s: %v", key, err)
+		}
+	}
+
+	b, err := s.Load("acme/ca/sites/example.com/example.com.key")
+	if err != nil || string(b) != "data of acme/ca/sites/example.com/example.com.key" {
+		t.Errorf("Expected stored data, got %q (%v)", b, err)
+	}
+	if !s.Exists("acme/ca/sites/example.com/example.com.key") {
+		t.Error("Expected stored key to exist")
+	}
+
+	info, err := s.Stat("acme/ca/sites/example.com/example.com.crt")
+	if err != nil || !info.IsTerminal || info.Size != int64(len("data of acme/ca/sites/example.com/example.com.crt")) || info.Modified.Before(before.Add(-time.Second)) {
+		t.Errorf("Unexpected key info %+v (%v)", info, err)
+	}
+	if info, err := s.Stat("acme/ca/sites"); err != nil || info.IsTerminal {
+		t.Errorf("Expected a non-terminal key, got %+v (%v)", info, err)
+	}
+
+	list, err := s.List("acme/ca/sites", false)
+	if expected := []string{"acme/ca/sites/ex*mple.net", "acme/ca/sites/example.com"}; err != nil || !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected non-recursive list %v, got %v (%v)", expected, list, err)
+	}
+	list, err = s.List("acme/ca/sites/ex*mple.net", true)
+	if expected := []string{"acme/ca/sites/ex*mple.net/ex*mple.net.crt"}; err != nil || !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected pattern characters to be escaped in list %v, got %v (%v)", expected, list, err)
+	}
+	list, err = s.List("acme", true)
+	if err != nil || len(list) != 10 {
+		t.Errorf("Expected 10 keys and prefixes in recursive list, got %v (%v)", list, err)
+	}
+
+	if err := s.Delete("acme/ca/sites/example.com/example.com.key"); err != nil {
+		t.Errorf("Expected no error deleting, got: %v", err)
+	}
+	if s.Exists("acme/ca/sites/example.com/example.com.key") {
+		t.Error("Expected deleted key not to exist")
+	}
+	if err := s.Delete("acme/ca/sites/example.com/example.com.key"); err == nil {
+		t.Error("Expected error deleting missing key")
+	}
+}
+
+func TestStorageLock(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.ln.Close()
+
+	// two instances sharing the store
+	a := newStorage(newClient(f.ln.Addr().String(), "", 0, nil), "")
+	b := newStorage(newClient(f.ln.Addr().String(), "", 0, nil), "")
+
+	if err := a.Lock("issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan time.Time)
+	go func() {
+		if err := b.Lock("issue_cert_example.com"); err != nil {
+			t.Error(err)
+		}
+		locked <- time.Now()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	unlocked := time.Now()
+	if err := a.Unlock("issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case at := <-locked:
+		if at.Before(unlocked) {
+			t.Error("Expected second instance to get the lock only after it was released")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected second instance to get the lock")
+	}
+
+	if err := a.Unlock("issue_cert_example.com"); err == nil {
+		t.Error("Expected error unlocking a lock that is not held")
+	}
+	// the lock held by b must not have been released by a
+	f.mu.Lock()
+	_, held := f.get(a.lockKey("issue_cert_example.com"))
+	f.mu.Unlock()
+	if !held {
+		t.Error("Expected lock of second instance to still be held")
+	}
+	if err := b.Unlock("issue_cert_example.com"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckStandalone(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.ln.Close()
+	c := newClient(f.ln.Addr().String(), "", 0, nil)
+
+	if err := checkStandalone(c); err != nil {
+		t.Errorf("Expected standalone server to be accepted, got: %v", err)
+	}
+
+	f.mu.Lock()
+	f.cluster = true
+	f.mu.Unlock()
+	if err := checkStandalone(c); err == nil {
+		t.Error("Expected cluster node to be refused")
+	}
+	if _, err := c.do("GET", "foo"); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("Expected MOVED redirect to be reported as unsupported, got: %v", err)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	for i, test := range []struct {
+		input    string
+		expected interface{}
+		err      bool
+	}{
+		{"+OK\r\n", "OK", false},
+		{":42\r\n", int64(42), false},
+		{"$5\r\nhello\r\n", "hello", false},
+		{"*2\r\n$1\r\na\r\n$-1\r\n", []interface{}{"a", nil}, false},
+		{"-ERR nope\r\n", nil, true},
+		{"$-1\r\n", nil, true},
+		{"?\r\n", nil, true},
+	} {
+		got, err := readReply(bufio.NewReader(strings.NewReader(test.input)))
+		if (err != nil) != test.err {
+			t.Errorf("Test %d: Expected error=%v, got %v", i, test.err, err)
+		}
+		if !test.err && fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// How often CRL files are checked for changes, and how
+// long OCSP responses without a next update are cached.
+var (
+	crlCheckInterval  = 1 * time.Second
+	ocspDefaultMaxAge = 1 * time.Hour
+)
+
+// ClientRevocation rejects client certificates that have
+// been revoked. Each certificate in a verified chain is
+// looked up in the CRLs, which are reloaded when their
+// files change; the leaf can also be looked up with the
+// OCSP responder it names.
+type ClientRevocation struct {
+	// Files with CRLs in PEM or DER form
+	CRLFiles []string
+
+	// Whether to ask the OCSP responder of the leaf
+	OCSP bool
+
+	// If true, leaves whose OCSP status cannot be
+	// determined are rejected; otherwise they are
+	// allowed, since CRLs may still cover them
+	OCSPStrict bool
+
+	mu        sync.Mutex
+	crls      map[string]*loadedCRL
+	lastCheck time.Time
+	ocspCache map[string]ocspAnswer
+
+	// for tests
+	client *http.Client
+	now    func() time.Time
+}
+
+type loadedCRL struct {
+	list    *pkix.CertificateList
+	serials map[string]struct{}
+	modTime time.Time
+	size    int64
+}
+
+type ocspAnswer struct {
+	status  int
+	expires time.Time
+}
+
+// NewClientRevocation returns a ClientRevocation that has
+// loaded the CRLs in crlFiles.
+func NewClientRevocation(crlFiles []string, checkOCSP, ocspStrict bool) (*ClientRevocation, error) {
+	r := &ClientRevocation{
+		CRLFiles:   crlFiles,
+		OCSP:       checkOCSP,
+		OCSPStrict: ocspStrict,
+		crls:       make(map[string]*loadedCRL),
+		ocspCache:  make(map[string]ocspAnswer),
+	}
+	for _, file := range crlFiles {
+		crl, err := loadCRL(file)
+		if err != nil {
+			return nil, err
+		}
+		r.crls[file] = crl
+	}
+	r.lastCheck = r.currentTime()
+	return r, nil
+}
+
+// VerifyPeerCertificate has the signature of the
+// tls.Config field of the same name. It is only useful
+// if the client certificates are verified, since it
+// checks the verified chains.
+func (r *ClientRevocation) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	r.reloadCRLs()
+	for _, chain := range verifiedChains {
+		for i := 0; i+1 < len(chain); i++ {
+			if r.revokedByCRL(chain[i], chain[i+1]) {
+				return fmt.Errorf("client certificate %s (serial %s) has been revoked",
+					chain[i].Subject, chain[i].SerialNumber)
+			}
+		}
+		if r.OCSP && len(chain) > 1 {
+			if err := r.checkOCSP(chain[0], chain[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// revokedByCRL returns true if cert is listed in a CRL
+// signed by issuer.
+func (r *ClientRevocation) revokedByCRL(cert, issuer *x509.Certificate) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	serial := cert.SerialNumber.String()
+	for _, crl := range r.crls {
+		if _, ok := crl.serials[serial]; !ok {
+			continue
+		}
+		if issuer.CheckCRLSignature(crl.list) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadCRLs loads the CRL files again that changed since
+// they were loaded, at most once every crlCheckInterval.
+// If a file can't be loaded, the CRL loaded before is kept.
+func (r *ClientRevocation) reloadCRLs() {
+	if len(r.CRLFiles) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.currentTime()
+	if now.Sub(r.lastCheck) < crlCheckInterval {
+		return
+	}
+	r.lastCheck = now
+	for _, file := range r.CRLFiles {
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Printf("[ERROR] Checking CRL %s: %v", file, err)
+			continue
+		}
+		if old := r.crls[file]; old != nil && info.ModTime().Equal(old.modTime) && info.Size() == old.size {
+			continue
+		}
+		crl, err := loadCRL(file)
+		if err != nil {
+			log.Printf("[ERROR] Reloading CRL: %v", err)
+			continue
+		}
+		r.crls[file] = crl
+		log.Printf("[INFO] Reloaded CRL %s (%d revoked certificates)", file, len(crl.serials))
+	}
+}
+
+// checkOCSP asks the OCSP responder of cert, which is
+// issued by issuer, about its status. Answers are cached
+// until the responder's next update.
+func (r *ClientRevocation) checkOCSP(cert, issuer *x509.Certificate) error {
+	if len(cert.OCSPServer) == 0 {
+		if r.OCSPStrict {
+			return fmt.Errorf("client certificate %s names no OCSP responder", cert.Subject)
+		}
+		return nil
+	}
+
+	key := string(issuer.Raw) + cert.SerialNumber.String()
+	now := r.currentTime()
+	r.mu.Lock()
+	answer, ok := r.ocspCache[key]
+	r.mu.Unlock()
+
+	if !ok || now.After(answer.expires) {
+		resp, err := r.queryOCSP(cert, issuer)
+		if err != nil {
+			if r.OCSPStrict {
+				return fmt.Errorf("checking OCSP status of client certificate %s: %v", cert.Subject, err)
+			}
+			log.Printf("[WARNING] Checking OCSP status of client certificate %s: %v", cert.Subject, err)
+			return nil
+		}
+		answer = ocspAnswer{status: resp.Status, expires: resp.NextUpdate}
+		if resp.NextUpdate.IsZero() {
+			answer.expires = now.Add(ocspDefaultMaxAge)
+		}
+		r.mu.Lock()
+		r.ocspCache[key] = answer
+		r.mu.Unlock()
+	}
+
+	switch answer.status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("client certificate %s (serial %s) has been revoked",
+			cert.Subject, cert.SerialNumber)
+	default:
+		if r.OCSPStrict {
+			return fmt.Errorf("OCSP status of client certificate %s is unknown", cert.Subject)
+		}
+		return nil
+	}
+}
+
+func (r *ClientRevocation) queryOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	_, resp, err := fetchOCSP(r.client, cert, issuer)
+	return resp, err
+}
+
+// fetchOCSP asks the first OCSP responder named in cert,
+// which is issued by issuer, about its status. It returns
+// the raw response, which can be stapled, as well as the
+// parsed one. If client is nil, a default client is used.
+func fetchOCSP(client *http.Client, cert, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("no OCSP server specified in certificate")
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+	resp, err := client.Post(cert.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder %s: HTTP %d", cert.OCSPServer[0], resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 1024*1024))
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, parsed, nil
+}
+
+func (r *ClientRevocation) currentTime() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// loadCRL loads the CRL in file.
+func loadCRL(file string) (*loadedCRL, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	list, err := x509.ParseCRL(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL %s: %v", file, err)
+	}
+	crl := &loadedCRL{
+		list:    list,
+		serials: make(map[string]struct{}),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	for _, revoked := range list.TBSCertList.RevokedCertificates {
+		crl.serials[revoked.SerialNumber.String()] = struct{}{}
+	}
+	return crl, nil
+}
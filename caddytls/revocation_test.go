@@ -0,0 +1,237 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert, key}
+}
+
+func (ca testCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (ca testCA) writeCRL(t *testing.T, file string, revoked ...*x509.Certificate) {
+	var list []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		list = append(list, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+	}
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, list, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, der, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRevocationCRL(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "caddytls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	crlFile := filepath.Join(tmpdir, "ca.crl")
+
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	good, bad := ca.issue(t, 10, ""), ca.issue(t, 11, "")
+	ca.writeCRL(t, crlFile, bad)
+
+	r, err := NewClientRevocation([]string{crlFile}, false, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca.cert}}); err != nil {
+		t.Errorf("Expected good certificate to be allowed, got: %v", err)
+	}
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{bad, ca.cert}}); err == nil {
+		t.Errorf("Expected revoked certificate to be rejected")
+	}
+
+	// a certificate with the same serial from another CA is not revoked
+	other := otherCA.issue(t, 11, "")
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{other, otherCA.cert}}); err != nil {
+		t.Errorf("Expected certificate of other CA to be allowed, got: %v", err)
+	}
+
+	// the CRL is reloaded when it changes
+	ca.writeCRL(t, crlFile, bad, good)
+	now = now.Add(crlCheckInterval)
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca.cert}}); err == nil {
+		t.Errorf("Expected certificate revoked by reloaded CRL to be rejected")
+	}
+
+	// an unreadable CRL leaves the loaded one in place
+	if err := ioutil.WriteFile(crlFile, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(crlCheckInterval)
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca.cert}}); err == nil {
+		t.Errorf("Expected certificate to stay revoked after failed reload")
+	}
+
+	if _, err := NewClientRevocation([]string{crlFile}, false, false); err == nil {
+		t.Errorf("Expected an error loading an invalid CRL")
+	}
+}
+
+func TestClientRevocationOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	var status, queries int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       int(atomic.LoadInt32(&status)),
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now(),
+		}, ca.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	cert := ca.issue(t, 20, srv.URL)
+	chains := [][]*x509.Certificate{{cert, ca.cert}}
+
+	r, err := NewClientRevocation(nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.VerifyPeerCertificate(nil, chains); err != nil {
+		t.Errorf("Expected good certificate to be allowed, got: %v", err)
+	}
+	atomic.StoreInt32(&status, ocsp.Revoked)
+	if err := r.VerifyPeerCertificate(nil, chains); err != nil {
+		t.Errorf("Expected cached good status to be used, got: %v", err)
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("Expected 1 OCSP query, got %d", n)
+	}
+
+	// once the cached answer is stale, the responder is asked again
+	r.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := r.VerifyPeerCertificate(nil, chains); err == nil {
+		t.Errorf("Expected revoked certificate to be rejected")
+	}
+
+	// unknown status is only rejected if strict
+	atomic.StoreInt32(&status, ocsp.Unknown)
+	for _, strict := range []bool{false, true} {
+		r, err := NewClientRevocation(nil, true, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.VerifyPeerCertificate(nil, chains)
+		if strict && err == nil {
+			t.Errorf("Expected unknown status to be rejected when strict")
+		}
+		if !strict && err != nil {
+			t.Errorf("Expected unknown status to be allowed when not strict, got: %v", err)
+		}
+	}
+
+	// so are unreachable responders
+	noResponder := ca.issue(t, 21, "http://127.0.0.1:1/")
+	r, err = NewClientRevocation(nil, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.VerifyPeerCertificate(nil, [][]*x509.Certificate{{noResponder, ca.cert}}); err == nil {
+		t.Errorf("Expected unreachable responder to fail when strict")
+	}
+}
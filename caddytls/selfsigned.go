@@ -1,6 +1,7 @@
 package caddytls
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -20,24 +21,9 @@ import (
 // newSelfSignedCertificate returns a new self-signed certificate.
 func newSelfSignedCertificate(ssconfig selfSignedConfig) (tls.Certificate, error) {
 	// start by generating private key
-	var privKey interface{}
-	var err error
-	switch ssconfig.KeyType {
-	case "", certcrypto.EC256:
-		privKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	case certcrypto.EC384:
-		privKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-	case certcrypto.RSA2048:
-		privKey, err = rsa.GenerateKey(rand.Reader, 2048)
-	case certcrypto.RSA4096:
-		privKey, err = rsa.GenerateKey(rand.Reader, 4096)
-	case certcrypto.RSA8192:
-		privKey, err = rsa.GenerateKey(rand.Reader, 8192)
-	default:
-		return tls.Certificate{}, fmt.Errorf("cannot generate private key; unknown key type %v", ssconfig.KeyType)
-	}
+	privKey, err := generatePrivateKey(ssconfig.KeyType)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to generate private key: %v", err)
+		return tls.Certificate{}, err
 	}
 
 	// create certificate structure with proper values
@@ -46,6 +32,9 @@ func newSelfSignedCertificate(ssconfig selfSignedConfig) (tls.Certificate, error
 	if notAfter.IsZero() || notAfter.Before(notBefore) {
 		notAfter = notBefore.Add(24 * time.Hour * 7)
 	}
+	if len(ssconfig.SAN) == 0 {
+		ssconfig.SAN = []string{""}
+	}
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
@@ -53,15 +42,12 @@ func newSelfSignedCertificate(ssconfig selfSignedConfig) (tls.Certificate, error
 	}
 	cert := &x509.Certificate{
 		SerialNumber: serialNumber,
-		Subject:      pkix.Name{Organization: []string{"Caddy Self-Signed"}},
+		Subject:      pkix.Name{Organization: []string{"Caddy Self-Signed"}, CommonName: ssconfig.SAN[0]},
 		NotBefore:    notBefore,
 		NotAfter:     notAfter,
 		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 	}
-	if len(ssconfig.SAN) == 0 {
-		ssconfig.SAN = []string{""}
-	}
 	for _, san := range ssconfig.SAN {
 		if ip := net.ParseIP(san); ip != nil {
 			cert.IPAddresses = append(cert.IPAddresses, ip)
@@ -70,18 +56,7 @@ func newSelfSignedCertificate(ssconfig selfSignedConfig) (tls.Certificate, error
 		}
 	}
 
-	// generate the associated public key
-	publicKey := func(privKey interface{}) interface{} {
-		switch k := privKey.(type) {
-		case *rsa.PrivateKey:
-			return &k.PublicKey
-		case *ecdsa.PrivateKey:
-			return &k.PublicKey
-		default:
-			return fmt.Errorf("unknown key type")
-		}
-	}
-	derBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, publicKey(privKey), privKey)
+	derBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, privKey.Public(), privKey)
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("could not create certificate: %v", err)
 	}
@@ -95,6 +70,46 @@ func newSelfSignedCertificate(ssconfig selfSignedConfig) (tls.Certificate, error
 	}, nil
 }
 
+// generatePrivateKey generates a private key of the given type.
+func generatePrivateKey(keyType certcrypto.KeyType) (crypto.Signer, error) {
+	var privKey crypto.Signer
+	var err error
+	switch keyType {
+	case "", certcrypto.EC256:
+		privKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case certcrypto.EC384:
+		privKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case certcrypto.RSA2048:
+		privKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case certcrypto.RSA4096:
+		privKey, err = rsa.GenerateKey(rand.Reader, 4096)
+	case certcrypto.RSA8192:
+		privKey, err = rsa.GenerateKey(rand.Reader, 8192)
+	default:
+		return nil, fmt.Errorf("cannot generate private key; unknown key type %v", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+	return privKey, nil
+}
+
+// selfSignedSANs returns the names a self-signed certificate
+// for a site with the given hostname should be valid for. Sites
+// without a hostname and localhost sites are also served on the
+// loopback addresses, so those are included for them.
+func selfSignedSANs(hostname string) []string {
+	loopback := []string{"127.0.0.1", "::1"}
+	hostname = strings.ToLower(hostname)
+	switch {
+	case hostname == "" || hostname == "0.0.0.0" || hostname == "::":
+		return append([]string{"localhost"}, loopback...)
+	case hostname == "localhost" || strings.HasSuffix(hostname, ".localhost"):
+		return append([]string{hostname}, loopback...)
+	}
+	return []string{hostname}
+}
+
 // selfSignedConfig configures a self-signed certificate.
 type selfSignedConfig struct {
 	SAN     []string
@@ -27,6 +27,7 @@ import (
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/telemetry"
@@ -66,6 +67,9 @@ func setupTLS(c *caddy.Controller) error {
 				return fmt.Errorf("constructing cluster plugin %s: %v", clusterPluginName, err)
 			}
 			certmagic.Default.Storage = storage
+			if err := setupTicketKeySharing(); err != nil {
+				return err
+			}
 		} else {
 			return fmt.Errorf("unrecognized cluster plugin (was it included in the Caddy build?): %s", clusterPluginName)
 		}
@@ -109,6 +113,8 @@ func setupTLS(c *caddy.Controller) error {
 			go telemetry.Increment("tls_handshake_count")
 
 		case "acme_cert_obtained":
+			name := data.(string)
+			caddy.EmitEvent(caddy.CertObtainEvent, name)
 			go telemetry.Increment("tls_acme_certs_obtained")
 
 		case "acme_cert_renewed":
@@ -130,6 +136,9 @@ func setupTLS(c *caddy.Controller) error {
 	for c.Next() {
 		var certificateFile, keyFile, loadDir, maxCerts, askURL string
 		var onDemand bool
+		var onDemandAllow []string
+		var issueRate int
+		var issueRateWindow time.Duration
 
 		args := c.RemainingArgs()
 		switch len(args) {
@@ -147,6 +156,9 @@ func setupTLS(c *caddy.Controller) error {
 			// user might want a temporary, in-memory, self-signed cert
 			case "self_signed":
 				config.SelfSigned = true
+			// or one from the local CA, which clients can trust
+			case "internal":
+				config.Internal = true
 			default:
 				config.Manager.Email = args[0]
 			}
@@ -198,18 +210,26 @@ func setupTLS(c *caddy.Controller) error {
 					}
 				}
 			case "ciphers":
-				for c.NextArg() {
-					value, ok := SupportedCiphersMap[strings.ToUpper(c.Val())]
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					value, ok := lookupCipher(arg)
 					if !ok {
-						return c.Errf("Wrong cipher name or cipher not supported: '%s'", c.Val())
+						return c.Errf("Wrong cipher name or cipher not supported: '%s'", arg)
 					}
 					config.Ciphers = append(config.Ciphers, value)
 				}
 			case "curves":
-				for c.NextArg() {
-					value, ok := supportedCurvesMap[strings.ToUpper(c.Val())]
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					value, ok := supportedCurvesMap[strings.ToUpper(arg)]
 					if !ok {
-						return c.Errf("Wrong curve name or curve not supported: '%s'", c.Val())
+						return c.Errf("Wrong curve name or curve not supported: '%s'", arg)
 					}
 					config.CurvePreferences = append(config.CurvePreferences, value)
 				}
@@ -238,6 +258,22 @@ func setupTLS(c *caddy.Controller) error {
 				}
 
 				config.ClientCerts = clientCertList[listStart:]
+			case "client_crl":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				config.ClientCRLs = append(config.ClientCRLs, args...)
+			case "client_ocsp":
+				args := c.RemainingArgs()
+				switch {
+				case len(args) == 0:
+				case len(args) == 1 && args[0] == "strict":
+					config.ClientOCSPStrict = true
+				default:
+					return c.ArgErr()
+				}
+				config.ClientOCSP = true
 			case "load":
 				c.Args(&loadDir)
 				config.Manual = true
@@ -247,9 +283,34 @@ func setupTLS(c *caddy.Controller) error {
 			case "ask":
 				c.Args(&askURL)
 				onDemand = true
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				onDemandAllow = append(onDemandAllow, args...)
+				onDemand = true
+			case "issue_rate":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return c.Err("issue_rate count must be a positive integer")
+				}
+				window, err := time.ParseDuration(args[1])
+				if err != nil || window <= 0 {
+					return c.Errf("invalid issue_rate interval '%s'", args[1])
+				}
+				issueRate, issueRateWindow = n, window
+				onDemand = true
 			case "dns":
+				// the provider name may be followed by its
+				// credentials; otherwise, providers usually
+				// read them from the environment
 				args := c.RemainingArgs()
-				if len(args) != 1 {
+				if len(args) == 0 {
 					return c.ArgErr()
 				}
 				// TODO: we can get rid of DNS provider plugins with this one line
@@ -264,7 +325,7 @@ func setupTLS(c *caddy.Controller) error {
 				if !ok {
 					return c.Errf("Unknown DNS provider by name '%s'", dnsProvName)
 				}
-				dnsProv, err := dnsProvConstructor()
+				dnsProv, err := dnsProvConstructor(args[1:]...)
 				if err != nil {
 					return c.Errf("Setting up DNS provider '%s': %v", dnsProvName, err)
 				}
@@ -277,8 +338,18 @@ func setupTLS(c *caddy.Controller) error {
 				for _, arg := range args {
 					config.ALPN = append(config.ALPN, arg)
 				}
+			case "key_log":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				config.KeyLogFile = c.Val()
+				if c.NextArg() {
+					return c.ArgErr()
+				}
 			case "must_staple":
 				config.Manager.MustStaple = true
+			case "ocsp_hard_fail":
+				config.OCSPHardFail = true
 			case "wildcard":
 				if !certmagic.HostQualifies(config.Hostname) {
 					return c.Errf("Hostname '%s' does not qualify for managed TLS, so cannot manage wildcard certificate for it", config.Hostname)
@@ -302,15 +373,26 @@ func setupTLS(c *caddy.Controller) error {
 			return c.ArgErr()
 		}
 
-		// configure on-demand TLS, if enabled
+		// revocation can only be checked for verified client certificates
+		if (len(config.ClientCRLs) > 0 || config.ClientOCSP) &&
+			config.ClientAuth != tls.VerifyClientCertIfGiven && config.ClientAuth != tls.RequireAndVerifyClientCert {
+			return c.Err("client_crl and client_ocsp require clients to be verified against a CA")
+		}
+
+		// configure on-demand TLS, if enabled; all the checks
+		// are made by our policy, so that they can be combined
 		if onDemand {
-			config.Manager.OnDemand = new(certmagic.OnDemandConfig)
+			policy := &OnDemandPolicy{
+				Allow:      onDemandAllow,
+				Rate:       issueRate,
+				RateWindow: issueRateWindow,
+			}
 			if maxCerts != "" {
 				maxCertsNum, err := strconv.Atoi(maxCerts)
 				if err != nil || maxCertsNum < 1 {
 					return c.Err("max_certs must be a positive integer")
 				}
-				config.Manager.OnDemand.MaxObtain = int32(maxCertsNum)
+				policy.MaxObtain = maxCertsNum
 			}
 			if askURL != "" {
 				parsedURL, err := url.Parse(askURL)
@@ -320,7 +402,17 @@ func setupTLS(c *caddy.Controller) error {
 				if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
 					return c.Err("ask URL must use http or https")
 				}
-				config.Manager.OnDemand.AskURL = parsedURL
+				policy.AskURL = parsedURL
+			}
+			if len(policy.Allow) == 0 && policy.AskURL == nil && policy.MaxObtain == 0 {
+				return c.Err("on-demand TLS must be limited with allow, ask or max_certs")
+			}
+			config.OnDemand = policy
+			config.Manager.OnDemand = &certmagic.OnDemandConfig{
+				DecisionFunc:  policy.Decide,
+				HostWhitelist: policy.Allow,
+				AskURL:        policy.AskURL,
+				MaxObtain:     int32(policy.MaxObtain),
 			}
 		}
 
@@ -330,12 +422,19 @@ func setupTLS(c *caddy.Controller) error {
 		}
 
 		// load a single certificate and key, if specified
-		if certificateFile != "" && keyFile != "" {
+		// and not already loaded for another site
+		if certificateFile != "" && keyFile != "" &&
+			(config.certFiles == nil || !config.certFiles.watching(certificateFile, keyFile)) {
 			err := config.Manager.CacheUnmanagedCertificatePEMFile(certificateFile, keyFile)
 			if err != nil {
 				return c.Errf("Unable to load certificate and key files for '%s': %v", c.Key, err)
 			}
 			log.Printf("[INFO] Successfully loaded TLS assets from %s and %s", certificateFile, keyFile)
+			if config.certFiles != nil {
+				if err := config.certFiles.watch(certificateFile, keyFile); err != nil {
+					return c.Errf("Unable to watch certificate and key files for '%s': %v", c.Key, err)
+				}
+			}
 		}
 
 		// load a directory of certificates, if specified
@@ -348,11 +447,12 @@ func setupTLS(c *caddy.Controller) error {
 	}
 
 	SetDefaultTLSParams(config)
+	warnWeakTLSParams(config)
 
 	// generate self-signed cert if needed
 	if config.SelfSigned {
 		ssCert, err := newSelfSignedCertificate(selfSignedConfig{
-			SAN:     []string{config.Hostname},
+			SAN:     selfSignedSANs(config.Hostname),
 			KeyType: config.Manager.KeyType,
 		})
 		if err != nil {
@@ -365,6 +465,26 @@ func setupTLS(c *caddy.Controller) error {
 		telemetry.Increment("tls_self_signed_count")
 	}
 
+	// issue certificate from the local CA if needed
+	if config.Internal {
+		storage := config.Manager.Storage
+		if storage == nil {
+			storage = certmagic.Default.Storage
+		}
+		ca, err := LoadLocalCA(storage)
+		if err != nil {
+			return fmt.Errorf("local CA: %v", err)
+		}
+		cert, err := ca.Issue(selfSignedSANs(config.Hostname), config.Manager.KeyType)
+		if err != nil {
+			return fmt.Errorf("local CA: %v", err)
+		}
+		err = config.Manager.CacheUnmanagedTLSCertificate(cert)
+		if err != nil {
+			return fmt.Errorf("local CA: %v", err)
+		}
+	}
+
 	// store this as a custom config
 	cfgMap, ok := c.Get(configMapKey).(map[string]*Config)
 	if !ok || cfgMap == nil {
@@ -376,6 +496,21 @@ func setupTLS(c *caddy.Controller) error {
 	return nil
 }
 
+// warnWeakTLSParams logs a warning if config allows protocol
+// versions or cipher suites that are no longer considered secure.
+func warnWeakTLSParams(config *Config) {
+	if config.ProtocolMinVersion < tls.VersionTLS12 {
+		name, _ := GetSupportedProtocolName(config.ProtocolMinVersion)
+		log.Printf("[WARNING] %s: TLS protocol %s is enabled; TLS versions before 1.2 are deprecated and insecure", config.Hostname, name)
+	}
+	for _, cipher := range config.Ciphers {
+		if weakCiphers[cipher] {
+			name, _ := GetSupportedCipherName(cipher)
+			log.Printf("[WARNING] %s: weak cipher suite %s is enabled; it lacks forward secrecy or uses 3DES", config.Hostname, name)
+		}
+	}
+}
+
 // loadCertsInDir loads all the certificates/keys in dir, as long as
 // the file ends with .pem. This method of loading certificates is
 // modeled after haproxy, which expects the certificate and key to
@@ -393,65 +528,16 @@ func loadCertsInDir(cfg *Config, c *caddy.Controller, dir string) error {
 			return nil
 		}
 		if strings.HasSuffix(strings.ToLower(info.Name()), ".pem") {
-			certBuilder, keyBuilder := new(bytes.Buffer), new(bytes.Buffer)
-			var foundKey bool // use only the first key in the file
-
+			if cfg.certFiles != nil && cfg.certFiles.watching(path, "") {
+				return nil
+			}
 			bundle, err := ioutil.ReadFile(path)
 			if err != nil {
 				return err
 			}
-
-			for {
-				// Decode next block so we can see what type it is
-				var derBlock *pem.Block
-				derBlock, bundle = pem.Decode(bundle)
-				if derBlock == nil {
-					break
-				}
-
-				if derBlock.Type == "CERTIFICATE" {
-					// Re-encode certificate as PEM, appending to certificate chain
-					if err := pem.Encode(certBuilder, derBlock); err != nil {
-						log.Println("[ERROR] failed to write PEM encoding: ", err)
-					}
-				} else if derBlock.Type == "EC PARAMETERS" {
-					// EC keys generated from openssl can be composed of two blocks:
-					// parameters and key (parameter block should come first)
-					if !foundKey {
-						// Encode parameters
-						if err := pem.Encode(keyBuilder, derBlock); err != nil {
-							log.Println("[ERROR] failed to write PEM encoding: ", err)
-						}
-
-						// Key must immediately follow
-						derBlock, bundle = pem.Decode(bundle)
-						if derBlock == nil || derBlock.Type != "EC PRIVATE KEY" {
-							return c.Errf("%s: expected elliptic private key to immediately follow EC parameters", path)
-						}
-						if err := pem.Encode(keyBuilder, derBlock); err != nil {
-							log.Println("[ERROR] failed to write PEM encoding: ", err)
-						}
-						foundKey = true
-					}
-				} else if derBlock.Type == "PRIVATE KEY" || strings.HasSuffix(derBlock.Type, " PRIVATE KEY") {
-					// RSA key
-					if !foundKey {
-						if err := pem.Encode(keyBuilder, derBlock); err != nil {
-							log.Println("[ERROR] failed to write PEM encoding: ", err)
-						}
-						foundKey = true
-					}
-				} else {
-					return c.Errf("%s: unrecognized PEM block type: %s", path, derBlock.Type)
-				}
-			}
-
-			certPEMBytes, keyPEMBytes := certBuilder.Bytes(), keyBuilder.Bytes()
-			if len(certPEMBytes) == 0 {
-				return c.Errf("%s: failed to parse PEM data", path)
-			}
-			if len(keyPEMBytes) == 0 {
-				return c.Errf("%s: no private key block found", path)
+			certPEMBytes, keyPEMBytes, err := splitPEMBundle(bundle)
+			if err != nil {
+				return c.Errf("%s: %v", path, err)
 			}
 
 			err = cfg.Manager.CacheUnmanagedCertificatePEMBytes(certPEMBytes, keyPEMBytes)
@@ -459,11 +545,78 @@ func loadCertsInDir(cfg *Config, c *caddy.Controller, dir string) error {
 				return c.Errf("%s: failed to load cert and key for '%s': %v", path, c.Key, err)
 			}
 			log.Printf("[INFO] Successfully loaded TLS assets from %s", path)
+			if cfg.certFiles != nil {
+				if err := cfg.certFiles.watch(path, ""); err != nil {
+					return c.Errf("%s: failed to watch for changes: %v", path, err)
+				}
+			}
 		}
 		return nil
 	})
 }
 
+// splitPEMBundle splits bundle into the PEM blocks of
+// the certificate chain and those of the first private
+// key in it.
+func splitPEMBundle(bundle []byte) (certPEMBytes, keyPEMBytes []byte, err error) {
+	certBuilder, keyBuilder := new(bytes.Buffer), new(bytes.Buffer)
+	var foundKey bool // use only the first key in the file
+
+	for {
+		// Decode next block so we can see what type it is
+		var derBlock *pem.Block
+		derBlock, bundle = pem.Decode(bundle)
+		if derBlock == nil {
+			break
+		}
+
+		if derBlock.Type == "CERTIFICATE" {
+			// Re-encode certificate as PEM, appending to certificate chain
+			if err := pem.Encode(certBuilder, derBlock); err != nil {
+				log.Println("[ERROR] failed to write PEM encoding: ", err)
+			}
+		} else if derBlock.Type == "EC PARAMETERS" {
+			// EC keys generated from openssl can be composed of two blocks:
+			// parameters and key (parameter block should come first)
+			if !foundKey {
+				// Encode parameters
+				if err := pem.Encode(keyBuilder, derBlock); err != nil {
+					log.Println("[ERROR] failed to write PEM encoding: ", err)
+				}
+
+				// Key must immediately follow
+				derBlock, bundle = pem.Decode(bundle)
+				if derBlock == nil || derBlock.Type != "EC PRIVATE KEY" {
+					return nil, nil, fmt.Errorf("expected elliptic private key to immediately follow EC parameters")
+				}
+				if err := pem.Encode(keyBuilder, derBlock); err != nil {
+					log.Println("[ERROR] failed to write PEM encoding: ", err)
+				}
+				foundKey = true
+			}
+		} else if derBlock.Type == "PRIVATE KEY" || strings.HasSuffix(derBlock.Type, " PRIVATE KEY") {
+			// RSA key
+			if !foundKey {
+				if err := pem.Encode(keyBuilder, derBlock); err != nil {
+					log.Println("[ERROR] failed to write PEM encoding: ", err)
+				}
+				foundKey = true
+			}
+		} else {
+			return nil, nil, fmt.Errorf("unrecognized PEM block type: %s", derBlock.Type)
+		}
+	}
+
+	certPEMBytes, keyPEMBytes = certBuilder.Bytes(), keyBuilder.Bytes()
+	if len(certPEMBytes) == 0 {
+		return nil, nil, fmt.Errorf("failed to parse PEM data")
+	}
+	if len(keyPEMBytes) == 0 {
+		return nil, nil, fmt.Errorf("no private key block found")
+	}
+	return certPEMBytes, keyPEMBytes, nil
+}
+
 func constructDefaultClusterPlugin() (certmagic.Storage, error) {
 	return &certmagic.FileStorage{Path: caddy.AssetsPath()}, nil
 }
@@ -15,11 +15,17 @@
 package caddytls
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-acme/lego/certcrypto"
 	"github.com/mholt/caddy"
@@ -131,6 +137,8 @@ func TestSetupParseWithOptionalParams(t *testing.T) {
             ciphers RSA-AES256-CBC-SHA ECDHE-RSA-AES128-GCM-SHA256 ECDHE-ECDSA-AES256-GCM-SHA384
             must_staple
             alpn http/1.1
+            key_log keys.log
+            ocsp_hard_fail
         }`
 
 	tmpdir, err := ioutil.TempDir("", "caddytls_setup_test_")
@@ -168,6 +176,14 @@ func TestSetupParseWithOptionalParams(t *testing.T) {
 	if len(cfg.ALPN) != 1 || cfg.ALPN[0] != "http/1.1" {
 		t.Errorf("Expected ALPN to contain only 'http/1.1' but got: %v", cfg.ALPN)
 	}
+
+	if cfg.KeyLogFile != "keys.log" {
+		t.Errorf("Expected key log file 'keys.log', got '%s'", cfg.KeyLogFile)
+	}
+
+	if !cfg.OCSPHardFail {
+		t.Error("Expected OCSP hard-fail to be true")
+	}
 }
 
 func TestSetupDefaultWithOptionalParams(t *testing.T) {
@@ -236,6 +252,43 @@ func TestSetupParseWithWrongOptionalParams(t *testing.T) {
 	if err == nil {
 		t.Error("Expected errors, but no error returned")
 	}
+
+	// Test empty cipher and curve lists
+	for _, params := range []string{"tls {\n\tciphers\n}", "tls {\n\tcurves\n}"} {
+		cfg = &Config{Manager: &certmagic.Config{}}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c = caddy.NewTestController("", params)
+		if err = setupTLS(c); err == nil {
+			t.Errorf("Expected error for %q, but no error returned", params)
+		}
+	}
+}
+
+func TestSetupParseWithIANACipherNames(t *testing.T) {
+	params := `tls {
+			ciphers TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ecdhe-ecdsa-aes256-gcm-sha384 TLS_RSA_WITH_3DES_EDE_CBC_SHA
+		}`
+	cfg := &Config{Manager: &certmagic.Config{}}
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	c := caddy.NewTestController("", params)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	if err := setupTLS(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	expected := []uint16{tls.TLS_FALLBACK_SCSV, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}
+	if fmt.Sprint(cfg.Ciphers) != fmt.Sprint(expected) {
+		t.Errorf("Expected ciphers %v, got %v", expected, cfg.Ciphers)
+	}
+	if !strings.Contains(logged.String(), "weak cipher suite RSA-3DES-EDE-CBC-SHA") {
+		t.Errorf("Expected a warning about the weak cipher, got: %s", logged.String())
+	}
+	if strings.Contains(logged.String(), "TLS protocol") {
+		t.Errorf("Expected no warning about the default protocols, got: %s", logged.String())
+	}
 }
 
 func TestSetupParseWithClientAuth(t *testing.T) {
@@ -309,6 +362,113 @@ func TestSetupParseWithClientAuth(t *testing.T) {
 	}
 }
 
+func TestSetupParseWithClientRevocation(t *testing.T) {
+	for caseNumber, caseData := range []struct {
+		params      string
+		expectedErr bool
+		crls        []string
+		ocsp        bool
+		ocspStrict  bool
+	}{
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients client_ca.crt
+			client_crl a.crl b.crl
+		}`, false, []string{"a.crl", "b.crl"}, false, false},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			client_ocsp
+			clients verify_if_given client_ca.crt
+		}`, false, nil, true, false},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients client_ca.crt
+			client_ocsp strict
+		}`, false, nil, true, true},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients client_ca.crt
+			client_ocsp loose
+		}`, true, nil, false, false},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients client_ca.crt
+			client_crl
+		}`, true, nil, false, false},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients require
+			client_crl a.crl
+		}`, true, nil, false, false},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			client_ocsp
+		}`, true, nil, false, false},
+	} {
+		cfg := &Config{Manager: certmagic.NewDefault()}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", caseData.params)
+
+		err := setupTLS(c)
+		if caseData.expectedErr {
+			if err == nil {
+				t.Errorf("In case %d: Expected an error, got: %v", caseNumber, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("In case %d: Expected no errors, got: %v", caseNumber, err)
+		}
+
+		if !reflect.DeepEqual(cfg.ClientCRLs, caseData.crls) {
+			t.Errorf("In case %d: Expected CRLs %v, got %v", caseNumber, caseData.crls, cfg.ClientCRLs)
+		}
+		if cfg.ClientOCSP != caseData.ocsp || cfg.ClientOCSPStrict != caseData.ocspStrict {
+			t.Errorf("In case %d: Expected OCSP %v (strict %v), got %v (strict %v)", caseNumber,
+				caseData.ocsp, caseData.ocspStrict, cfg.ClientOCSP, cfg.ClientOCSPStrict)
+		}
+	}
+}
+
+func TestSetupParseWithSelfSigned(t *testing.T) {
+	for i, test := range []struct {
+		hostname string
+		expected []string
+	}{
+		{"localhost", []string{"localhost", "127.0.0.1", "::1"}},
+		{"myapp.localhost", []string{"myapp.localhost", "127.0.0.1", "::1"}},
+		{"", []string{"localhost", "127.0.0.1", "::1"}},
+		{"example.com", []string{"example.com"}},
+	} {
+		// use a cache of our own, since the default one
+		// has the certificate of other tests for localhost
+		var cfg *Config
+		certCache := certmagic.NewCache(certmagic.CacheOptions{
+			GetConfigForCert: func(certmagic.Certificate) (certmagic.Config, error) {
+				return *cfg.Manager, nil
+			},
+		})
+		defer certCache.Stop()
+		cfg = &Config{Hostname: test.hostname, Manager: certmagic.New(certCache, certmagic.Config{})}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls self_signed`)
+
+		if err := setupTLS(c); err != nil {
+			t.Fatalf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if !cfg.SelfSigned {
+			t.Errorf("Test %d: Expected SelfSigned to be true", i)
+		}
+
+		cert, err := cfg.Manager.GetCertificate(&tls.ClientHelloInfo{ServerName: test.expected[0]})
+		if err != nil {
+			t.Fatalf("Test %d: Expected a certificate for %s, got error: %v", i, test.expected[0], err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Test %d: Parsing certificate: %v", i, err)
+		}
+		for _, name := range test.expected {
+			if err := leaf.VerifyHostname(name); err != nil {
+				t.Errorf("Test %d: Expected certificate to be valid for %s: %v", i, name, err)
+			}
+		}
+	}
+}
+
 func TestSetupParseWithCAUrl(t *testing.T) {
 	testURL := "https://acme-staging.api.letsencrypt.org/directory"
 	for caseNumber, caseData := range []struct {
@@ -437,6 +597,89 @@ func TestSetupParseWithEmail(t *testing.T) {
 	}
 }
 
+func TestSetupParseWithOnDemand(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		check     func(*OnDemandPolicy) bool
+	}{
+		{input: "tls {\n\tmax_certs 10\n}", check: func(p *OnDemandPolicy) bool { return p.MaxObtain == 10 }},
+		{input: "tls {\n\task https://example.com/ask\n}", check: func(p *OnDemandPolicy) bool { return p.AskURL.Host == "example.com" }},
+		{input: "tls {\n\tallow a.example.com *.example.net\n\tissue_rate 5 1m\n}", check: func(p *OnDemandPolicy) bool {
+			return len(p.Allow) == 2 && p.Rate == 5 && p.RateWindow == time.Minute
+		}},
+		{input: "tls {\n\tissue_rate 5 1m\n}", shouldErr: true},
+		{input: "tls {\n\tallow\n}", shouldErr: true},
+		{input: "tls {\n\tmax_certs 10\n\tissue_rate 0 1m\n}", shouldErr: true},
+		{input: "tls {\n\tmax_certs 10\n\tissue_rate 5 soon\n}", shouldErr: true},
+		{input: "tls {\n\task ftp://example.com\n}", shouldErr: true},
+	} {
+		cfg := &Config{Manager: &certmagic.Config{}}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		err := setupTLS(caddy.NewTestController("", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if cfg.OnDemand == nil || cfg.Manager.OnDemand == nil || cfg.Manager.OnDemand.DecisionFunc == nil {
+			t.Errorf("Test %d: Expected on-demand TLS to be enabled with a decision function", i)
+			continue
+		}
+		if !test.check(cfg.OnDemand) {
+			t.Errorf("Test %d: Unexpected on-demand policy %+v", i, cfg.OnDemand)
+		}
+	}
+}
+
+func TestSetupParseWithDNSProvider(t *testing.T) {
+	var gotCredentials []string
+	RegisterDNSProvider("testdns", func(credentials ...string) (ChallengeProvider, error) {
+		gotCredentials = credentials
+		return newExecDNSProvider("/bin/true")
+	})
+	defer delete(dnsProviders, "testdns")
+
+	for i, test := range []struct {
+		input               string
+		shouldErr           bool
+		expectedCredentials []string
+	}{
+		{input: "tls {\n\tdns testdns\n}", expectedCredentials: []string{}},
+		{input: "tls {\n\tdns testdns key secret\n}", expectedCredentials: []string{"key", "secret"}},
+		{input: "tls {\n\tdns exec /usr/local/bin/dns-hook raw\n}"},
+		{input: "tls {\n\tdns exec /usr/local/bin/dns-hook cooked\n}", shouldErr: true},
+		{input: "tls {\n\tdns\n}", shouldErr: true},
+		{input: "tls {\n\tdns nonexistent\n}", shouldErr: true},
+	} {
+		gotCredentials = nil
+		cfg := &Config{Manager: &certmagic.Config{}}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		err := setupTLS(caddy.NewTestController("", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if cfg.Manager.DNSProvider == nil {
+			t.Errorf("Test %d: Expected a DNS provider", i)
+		}
+		if test.expectedCredentials != nil && fmt.Sprint(gotCredentials) != fmt.Sprint(test.expectedCredentials) {
+			t.Errorf("Test %d: Expected credentials %v, got %v", i, test.expectedCredentials, gotCredentials)
+		}
+	}
+}
+
 const (
 	certFile = "test_cert.pem"
 	keyFile  = "test_key.pem"
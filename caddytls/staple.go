@@ -0,0 +1,208 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/telemetry"
+	"golang.org/x/crypto/ocsp"
+)
+
+// How often refusals to serve the same certificate
+// are logged.
+var stapleAlertInterval = 1 * time.Minute
+
+// oidMustStaple is the TLS Feature extension (RFC 7633),
+// which is how certificates require OCSP stapling.
+var oidMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// stapleChecker refuses to serve certificates that
+// require an OCSP staple (Must-Staple) without a fresh,
+// good one, since clients would reject them anyway. If
+// hardFail is true, so are all other certificates that
+// name an OCSP responder, in case fetching staples
+// fails.
+type stapleChecker struct {
+	hardFail bool
+
+	mu      sync.RWMutex
+	certs   map[string]*stapleState // by DER of the leaf
+	byNames map[string]string       // DER of the leaf by its names
+
+	// for tests
+	now func() time.Time
+}
+
+// stapleState is what is known about the staple of one
+// certificate; handshakes for other certificates don't
+// wait for each other.
+type stapleState struct {
+	names      []string
+	mustStaple bool
+	hasOCSP    bool
+	leaf       *x509.Certificate
+	issuer     *x509.Certificate // nil if not in the chain
+
+	mu         sync.Mutex
+	staple     []byte // the last one seen, and
+	fresh      bool   // whether it is fresh
+	nextUpdate time.Time
+	lastAlert  time.Time
+}
+
+func newStapleChecker(hardFail bool) *stapleChecker {
+	return &stapleChecker{
+		hardFail: hardFail,
+		certs:    make(map[string]*stapleState),
+		byNames:  make(map[string]string),
+	}
+}
+
+// getCertificate returns a tls.Config.GetCertificate
+// function that checks the certificates returned by next.
+func (sc *stapleChecker) getCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := next(hello)
+		if err != nil || cert == nil || len(cert.Certificate) == 0 {
+			return cert, err
+		}
+		if err := sc.check(cert); err != nil {
+			return nil, err
+		}
+		return cert, nil
+	}
+}
+
+// state returns the state of cert, which is created the
+// first time cert is seen. The state of a certificate
+// that cert replaces, because it has the same names, is
+// forgotten then.
+func (sc *stapleChecker) state(cert *tls.Certificate) (*stapleState, error) {
+	der := string(cert.Certificate[0])
+	sc.mu.RLock()
+	state, ok := sc.certs[der]
+	sc.mu.RUnlock()
+	if ok {
+		return state, nil
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	state = &stapleState{
+		names:      leaf.DNSNames,
+		mustStaple: isMustStaple(leaf),
+		hasOCSP:    len(leaf.OCSPServer) > 0,
+		leaf:       leaf,
+	}
+	if len(cert.Certificate) > 1 {
+		if issuer, err := x509.ParseCertificate(cert.Certificate[1]); err == nil {
+			state.issuer = issuer
+		}
+	}
+	names := strings.Join(leaf.DNSNames, ",")
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if existing, ok := sc.certs[der]; ok {
+		return existing, nil
+	}
+	if names != "" {
+		if old, ok := sc.byNames[names]; ok {
+			delete(sc.certs, old)
+		}
+		sc.byNames[names] = der
+	}
+	sc.certs[der] = state
+	return state, nil
+}
+
+// check returns an error if cert may not be served
+// with the OCSP staple it has.
+func (sc *stapleChecker) check(cert *tls.Certificate) error {
+	now := time.Now()
+	if sc.now != nil {
+		now = sc.now()
+	}
+
+	state, err := sc.state(cert)
+	if err != nil {
+		return err
+	}
+	if !state.mustStaple && !(sc.hardFail && state.hasOCSP) {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.staple == nil || !bytes.Equal(state.staple, cert.OCSPStaple) {
+		state.staple = cert.OCSPStaple
+		state.fresh = false
+		// clients only trust staples signed by the issuer or
+		// a responder it delegated to, which takes the issuer
+		// to check
+		if state.issuer != nil {
+			resp, err := ocsp.ParseResponseForCert(cert.OCSPStaple, state.leaf, state.issuer)
+			if err == nil && resp.Status == ocsp.Good {
+				state.fresh, state.nextUpdate = true, resp.NextUpdate
+			}
+		}
+	}
+	if state.fresh && (state.nextUpdate.IsZero() || now.Before(state.nextUpdate)) {
+		return nil
+	}
+
+	reason := "it requires OCSP stapling (Must-Staple)"
+	if !state.mustStaple {
+		reason = "OCSP hard-fail is enabled"
+	}
+	if now.Sub(state.lastAlert) >= stapleAlertInterval {
+		state.lastAlert = now
+		log.Printf("[ERROR] Refusing to serve certificate for %v without a valid OCSP staple, since %s",
+			state.names, reason)
+	}
+	go telemetry.Increment("tls_ocsp_staple_refusals")
+	return fmt.Errorf("no valid OCSP staple for certificate of %v", state.names)
+}
+
+// isMustStaple returns true if leaf has the TLS Feature
+// extension with the status_request feature.
+func isMustStaple(leaf *x509.Certificate) bool {
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(oidMustStaple) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == 5 { // status_request
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func (ca testCA) issueMustStaple(t *testing.T, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{"http://ocsp.example.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidMustStaple, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05}},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (ca testCA) staple(t *testing.T, cert *x509.Certificate, status int, nextUpdate time.Time) []byte {
+	resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestStapleChecker(t *testing.T) {
+	ca := newTestCA(t)
+	mustStaple := ca.issueMustStaple(t, 30)
+	withOCSP := ca.issue(t, 31, "http://ocsp.example.com")
+	withoutOCSP := ca.issue(t, 32, "")
+	if !isMustStaple(mustStaple) || isMustStaple(withOCSP) {
+		t.Fatalf("Expected only the first certificate to be Must-Staple")
+	}
+
+	otherCA := newTestCA(t)
+
+	later := time.Now().Add(time.Hour)
+	for i, test := range []struct {
+		leaf        *x509.Certificate
+		staple      []byte
+		hardFail    bool
+		expectError bool
+	}{
+		{mustStaple, nil, false, true},
+		{mustStaple, ca.staple(t, mustStaple, ocsp.Good, later), false, false},
+		{mustStaple, ca.staple(t, mustStaple, ocsp.Good, time.Now().Add(-time.Second)), false, true},
+		{mustStaple, ca.staple(t, mustStaple, ocsp.Revoked, later), false, true},
+		{mustStaple, []byte("garbage"), false, true},
+		{mustStaple, otherCA.staple(t, mustStaple, ocsp.Good, later), false, true},
+		{withOCSP, nil, false, false},
+		{withOCSP, nil, true, true},
+		{withOCSP, ca.staple(t, withOCSP, ocsp.Good, later), true, false},
+		{withoutOCSP, nil, true, false},
+	} {
+		sc := newStapleChecker(test.hardFail)
+		cert := &tls.Certificate{Certificate: [][]byte{test.leaf.Raw, ca.cert.Raw}, OCSPStaple: test.staple}
+		// checking twice, so that remembered answers are checked too
+		for j := 0; j < 2; j++ {
+			err := sc.check(cert)
+			if test.expectError && err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			}
+		}
+	}
+
+	// a staple that expires while being served is noticed
+	sc := newStapleChecker(false)
+	cert := &tls.Certificate{Certificate: [][]byte{mustStaple.Raw, ca.cert.Raw}, OCSPStaple: ca.staple(t, mustStaple, ocsp.Good, later)}
+	if err := sc.check(cert); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	sc.now = func() time.Time { return later.Add(time.Second) }
+	if err := sc.check(cert); err == nil {
+		t.Errorf("Expected an error once the staple expired")
+	}
+
+	// without the issuer, a staple cannot be verified
+	sc = newStapleChecker(false)
+	cert = &tls.Certificate{Certificate: [][]byte{mustStaple.Raw}, OCSPStaple: ca.staple(t, mustStaple, ocsp.Good, later)}
+	if err := sc.check(cert); err == nil {
+		t.Errorf("Expected an error for a staple without the issuer in the chain")
+	}
+}
+
+func TestStapleCheckerForgetsReplacedCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	sc := newStapleChecker(false)
+	later := time.Now().Add(time.Hour)
+	var ders []string
+	for serial := int64(40); serial < 43; serial++ {
+		leaf := ca.issueMustStaple(t, serial)
+		ders = append(ders, string(leaf.Raw))
+		cert := &tls.Certificate{Certificate: [][]byte{leaf.Raw, ca.cert.Raw}, OCSPStaple: ca.staple(t, leaf, ocsp.Good, later)}
+		if err := sc.check(cert); err != nil {
+			t.Fatalf("Serial %d: Expected no error, got: %v", serial, err)
+		}
+	}
+	if len(sc.certs) != 1 {
+		t.Errorf("Expected only the latest certificate for the names to be remembered, got %d", len(sc.certs))
+	}
+	if _, ok := sc.certs[ders[len(ders)-1]]; !ok {
+		t.Error("Expected the latest certificate to be remembered")
+	}
+}
@@ -62,8 +62,10 @@ func QualifiesForManagedTLS(c ConfigHolder) bool {
 
 	return (!tlsConfig.Manual || onDemand) && // user might provide own cert and key
 
-		// if self-signed, we've already generated one to use
+		// if self-signed or from the local CA,
+		// we've already generated one to use
 		!tlsConfig.SelfSigned &&
+		!tlsConfig.Internal &&
 
 		// user can force-disable managed TLS
 		c.Port() != "80" &&
@@ -0,0 +1,119 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"regexp"
+	"sync"
+)
+
+// compileCache holds artifacts compiled from configuration,
+// such as regular expressions and templates, so that they can
+// be reused when the same configuration is loaded again during
+// a graceful reload instead of being compiled from scratch.
+//
+// Every load is a new generation. Entries that were not used
+// by the most recent successful load are evicted when it
+// completes, so the cache never outgrows the running config.
+type compileCache struct {
+	mu         sync.Mutex
+	entries    map[compileKey]*compileEntry
+	generation uint64
+	hits       int
+	misses     int
+}
+
+type compileKey struct {
+	kind, key string
+}
+
+type compileEntry struct {
+	value    interface{}
+	lastUsed uint64
+}
+
+var compiled = &compileCache{entries: make(map[compileKey]*compileEntry)}
+
+// CachedCompile returns the artifact identified by kind and key,
+// calling compile to produce it only if it was not already
+// compiled by this or a previous config load. The key should be
+// the exact config content the artifact is compiled from, and
+// kind should distinguish different compilers of the same
+// content (e.g. "regexp", "template:browse"). Values returned
+// from compile must be safe to share between server instances.
+// Errors are never cached.
+func CachedCompile(kind, key string, compile func() (interface{}, error)) (interface{}, error) {
+	ck := compileKey{kind, key}
+
+	compiled.mu.Lock()
+	if entry, ok := compiled.entries[ck]; ok {
+		entry.lastUsed = compiled.generation
+		compiled.hits++
+		compiled.mu.Unlock()
+		return entry.value, nil
+	}
+	compiled.mu.Unlock()
+
+	val, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	compiled.mu.Lock()
+	defer compiled.mu.Unlock()
+	if entry, ok := compiled.entries[ck]; ok {
+		// compiled concurrently; keep the first one
+		entry.lastUsed = compiled.generation
+		compiled.hits++
+		return entry.value, nil
+	}
+	compiled.entries[ck] = &compileEntry{value: val, lastUsed: compiled.generation}
+	compiled.misses++
+	return val, nil
+}
+
+// CompileRegexp is like regexp.Compile, but reuses the
+// compiled expression across config loads.
+func CompileRegexp(expr string) (*regexp.Regexp, error) {
+	val, err := CachedCompile("regexp", expr, func() (interface{}, error) {
+		return regexp.Compile(expr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.(*regexp.Regexp), nil
+}
+
+// begin starts a new generation for a config load.
+func (cc *compileCache) begin() {
+	cc.mu.Lock()
+	cc.generation++
+	cc.hits, cc.misses = 0, 0
+	cc.mu.Unlock()
+}
+
+// commit evicts entries not used by the current generation
+// and reports how many artifacts were reused and how many
+// were compiled anew during it.
+func (cc *compileCache) commit() (reused, compiledNew int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for k, entry := range cc.entries {
+		if entry.lastUsed != cc.generation {
+			delete(cc.entries, k)
+		}
+	}
+	return cc.hits, cc.misses
+}
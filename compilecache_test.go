@@ -0,0 +1,83 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCachedCompile(t *testing.T) {
+	compiled = &compileCache{entries: make(map[compileKey]*compileEntry)}
+
+	calls := 0
+	compile := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	compiled.begin()
+	v1, _ := CachedCompile("test", "a", compile)
+	v2, _ := CachedCompile("test", "a", compile)
+	CachedCompile("test", "b", compile)
+	if v1 != v2 || calls != 2 {
+		t.Errorf("Expected the same artifact to be reused within a load; got %v and %v after %d compilations", v1, v2, calls)
+	}
+	if reused, compiledNew := compiled.commit(); reused != 1 || compiledNew != 2 {
+		t.Errorf("Expected 1 reused and 2 compiled, got %d and %d", reused, compiledNew)
+	}
+
+	// next load only uses "a", so "b" should be evicted afterwards
+	compiled.begin()
+	if v, _ := CachedCompile("test", "a", compile); v != v1 {
+		t.Errorf("Expected artifact to be reused across loads, got %v instead of %v", v, v1)
+	}
+	if reused, compiledNew := compiled.commit(); reused != 1 || compiledNew != 0 {
+		t.Errorf("Expected 1 reused and 0 compiled, got %d and %d", reused, compiledNew)
+	}
+	if _, ok := compiled.entries[compileKey{"test", "b"}]; ok {
+		t.Error("Expected unused artifact to be evicted")
+	}
+
+	// same key but different kind is a different artifact
+	if v, _ := CachedCompile("other", "a", compile); v == v1 {
+		t.Error("Expected artifacts of different kinds not to be shared")
+	}
+
+	// errors are not cached
+	failures := 0
+	fail := func() (interface{}, error) {
+		failures++
+		return nil, errors.New("oops")
+	}
+	CachedCompile("test", "bad", fail)
+	if _, err := CachedCompile("test", "bad", fail); err == nil || failures != 2 {
+		t.Errorf("Expected compile errors not to be cached; got error %v after %d calls", err, failures)
+	}
+}
+
+func TestCompileRegexp(t *testing.T) {
+	re1, err := CompileRegexp("^/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re2, _ := CompileRegexp("^/foo")
+	if re1 != re2 {
+		t.Error("Expected the same compiled regexp to be returned")
+	}
+	if _, err := CompileRegexp("("); err == nil {
+		t.Error("Expected error for invalid regexp")
+	}
+}
@@ -35,6 +35,9 @@ type Controller struct {
 	// an address, hostname, or identifier of some sort.
 	Key string
 
+	// Directive is the name of the directive being set up.
+	Directive string
+
 	// OncePerServerBlock is a function that executes f
 	// exactly once per server block, no matter how many
 	// hosts are associated with it. If it is the first
@@ -61,6 +64,38 @@ type Controller struct {
 	// setup function to persist state between all
 	// the keys on a server block.
 	ServerBlockStorage interface{}
+
+	// pending, if set, collects callbacks instead of
+	// adding them to the instance directly; used when
+	// setup functions run concurrently
+	pending *callbacks
+
+	// tokens are all the tokens of the directive
+	// in this server block
+	tokens []caddyfile.Token
+}
+
+// Tokens returns all the tokens of the directive in this
+// server block, no matter how far c has been advanced.
+func (c *Controller) Tokens() []caddyfile.Token {
+	return c.tokens
+}
+
+// callbacks holds the lifecycle callbacks registered by
+// setup functions that ran concurrently, so they can be
+// added to the instance in server block order afterwards.
+type callbacks struct {
+	firstStartup, startup, restart, restartFailed, shutdown, finalShutdown []func() error
+}
+
+// addTo appends all the callbacks in cb to inst.
+func (cb *callbacks) addTo(inst *Instance) {
+	inst.OnFirstStartup = append(inst.OnFirstStartup, cb.firstStartup...)
+	inst.OnStartup = append(inst.OnStartup, cb.startup...)
+	inst.OnRestart = append(inst.OnRestart, cb.restart...)
+	inst.OnRestartFailed = append(inst.OnRestartFailed, cb.restartFailed...)
+	inst.OnShutdown = append(inst.OnShutdown, cb.shutdown...)
+	inst.OnFinalShutdown = append(inst.OnFinalShutdown, cb.finalShutdown...)
 }
 
 // ServerType gets the name of the server type that is being set up.
@@ -71,36 +106,60 @@ func (c *Controller) ServerType() string {
 // OnFirstStartup adds fn to the list of callback functions to execute
 // when the server is about to be started NOT as part of a restart.
 func (c *Controller) OnFirstStartup(fn func() error) {
+	if c.pending != nil {
+		c.pending.firstStartup = append(c.pending.firstStartup, fn)
+		return
+	}
 	c.instance.OnFirstStartup = append(c.instance.OnFirstStartup, fn)
 }
 
 // OnStartup adds fn to the list of callback functions to execute
 // when the server is about to be started (including restarts).
 func (c *Controller) OnStartup(fn func() error) {
+	if c.pending != nil {
+		c.pending.startup = append(c.pending.startup, fn)
+		return
+	}
 	c.instance.OnStartup = append(c.instance.OnStartup, fn)
 }
 
 // OnRestart adds fn to the list of callback functions to execute
 // when the server is about to be restarted.
 func (c *Controller) OnRestart(fn func() error) {
+	if c.pending != nil {
+		c.pending.restart = append(c.pending.restart, fn)
+		return
+	}
 	c.instance.OnRestart = append(c.instance.OnRestart, fn)
 }
 
 // OnRestartFailed adds fn to the list of callback functions to execute
 // if the server failed to restart.
 func (c *Controller) OnRestartFailed(fn func() error) {
+	if c.pending != nil {
+		c.pending.restartFailed = append(c.pending.restartFailed, fn)
+		return
+	}
 	c.instance.OnRestartFailed = append(c.instance.OnRestartFailed, fn)
 }
 
 // OnShutdown adds fn to the list of callback functions to execute
 // when the server is about to be shut down (including restarts).
 func (c *Controller) OnShutdown(fn func() error) {
+	if c.pending != nil {
+		c.pending.shutdown = append(c.pending.shutdown, fn)
+		return
+	}
 	c.instance.OnShutdown = append(c.instance.OnShutdown, fn)
 }
 
 // OnFinalShutdown adds fn to the list of callback functions to execute
 // when the server is about to be shut down NOT as part of a restart.
 func (c *Controller) OnFinalShutdown(fn func() error) {
+	if c.pending != nil {
+		c.pending.finalShutdown = append(c.pending.finalShutdown, fn)
+		return
+	}
 	c.instance.OnFinalShutdown = append(c.instance.OnFinalShutdown, fn)
 }
 
@@ -137,9 +196,19 @@ func NewTestController(serverType, input string) *Controller {
 	if stype, err := getServerType(serverType); err == nil {
 		testInst.context = stype.NewContext(testInst)
 	}
+	var tokens []caddyfile.Token
+	for d := caddyfile.NewDispenser("Testfile", strings.NewReader(input)); d.Next(); {
+		tokens = append(tokens, caddyfile.Token{File: d.File(), Line: d.Line(), Text: d.Val()})
+	}
+	var directive string
+	if len(tokens) > 0 {
+		directive = tokens[0].Text
+	}
 	return &Controller{
 		instance:           testInst,
+		Directive:          directive,
 		Dispenser:          caddyfile.NewDispenser("Testfile", strings.NewReader(input)),
 		OncePerServerBlock: func(f func() error) error { return f() },
+		tokens:             tokens,
 	}
 }
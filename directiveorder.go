@@ -0,0 +1,195 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DirectiveOrder returns the directives of serverType in the order
+// their actions are executed: the server type's own list, with the
+// directives of plugins that declare After or Before put among them.
+// Such a directive goes just before the first directive it must
+// precede, or else just after the last one it must follow, as far as
+// the other constraints allow; ties are broken by name, so the order
+// does not depend on the order in which plugins were registered. An
+// error is returned if the constraints name a directive that does
+// not exist or form a cycle.
+func DirectiveOrder(serverType string) ([]string, error) {
+	stype, err := getServerType(serverType)
+	if err != nil {
+		return nil, err
+	}
+	base := stype.Directives()
+
+	// plugins of the server type take precedence over generic ones
+	constrained := make(map[string]Plugin)
+	for _, stypeName := range []string{"", serverType} {
+		for name, plugin := range plugins[stypeName] {
+			if len(plugin.After) > 0 || len(plugin.Before) > 0 {
+				constrained[name] = plugin
+			}
+		}
+	}
+	if len(constrained) == 0 {
+		return base, nil
+	}
+
+	rank := make(map[string]float64, len(base)+len(constrained))
+	for i, dir := range base {
+		rank[dir] = float64(i)
+	}
+	var extras []string
+	for name := range constrained {
+		if _, ok := rank[name]; !ok {
+			extras = append(extras, name)
+		}
+	}
+	sort.Strings(extras)
+	nodes := append(append([]string{}, base...), extras...)
+	known := make(map[string]bool, len(nodes))
+	for _, name := range nodes {
+		known[name] = true
+	}
+
+	// edges point from a directive to those that must come after it
+	succ := make(map[string][]string)
+	indeg := make(map[string]int)
+	edge := func(from, to string) {
+		succ[from] = append(succ[from], to)
+		indeg[to]++
+	}
+	for i := 1; i < len(base); i++ {
+		edge(base[i-1], base[i])
+	}
+	names := make([]string, 0, len(constrained))
+	for name := range constrained {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plugin := constrained[name]
+		for _, after := range plugin.After {
+			if !known[after] {
+				return nil, fmt.Errorf("directive %s: cannot run after %s: no such directive for server type %s", name, after, serverType)
+			}
+			edge(after, name)
+		}
+		for _, before := range plugin.Before {
+			if !known[before] {
+				return nil, fmt.Errorf("directive %s: cannot run before %s: no such directive for server type %s", name, before, serverType)
+			}
+			edge(name, before)
+		}
+	}
+
+	// rank the extra directives next to what they are ordered by
+	visiting := make(map[string]bool)
+	var rankOf func(name string) float64
+	rankOf = func(name string) float64 {
+		if r, ok := rank[name]; ok {
+			return r
+		}
+		if visiting[name] {
+			return float64(len(base)) // a cycle, reported below
+		}
+		visiting[name] = true
+		plugin := constrained[name]
+		var r float64
+		if len(plugin.Before) > 0 {
+			r = rankOf(plugin.Before[0])
+			for _, before := range plugin.Before[1:] {
+				if br := rankOf(before); br < r {
+					r = br
+				}
+			}
+			r -= 0.5
+		} else {
+			r = rankOf(plugin.After[0])
+			for _, after := range plugin.After[1:] {
+				if ar := rankOf(after); ar > r {
+					r = ar
+				}
+			}
+			r += 0.5
+		}
+		rank[name] = r
+		return r
+	}
+	for _, name := range extras {
+		rankOf(name)
+	}
+
+	// topological sort, always taking the lowest-ranked ready directive
+	var ready, order []string
+	for _, name := range nodes {
+		if indeg[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	for len(ready) > 0 {
+		next := 0
+		for i, name := range ready {
+			if rank[name] < rank[ready[next]] ||
+				(rank[name] == rank[ready[next]] && name < ready[next]) {
+				next = i
+			}
+		}
+		name := ready[next]
+		ready = append(ready[:next], ready[next+1:]...)
+		order = append(order, name)
+		for _, to := range succ[name] {
+			indeg[to]--
+			if indeg[to] == 0 {
+				ready = append(ready, to)
+			}
+		}
+	}
+	if len(order) < len(nodes) {
+		// of the directives left, report those on a cycle,
+		// not those that merely come after one
+		var cycle []string
+		for _, name := range nodes {
+			if indeg[name] > 0 && reaches(succ, name, name) {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("directives of server type %s cannot be ordered; their After and Before form a cycle among: %s",
+			serverType, strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// reaches returns true if there is a path of one or more
+// edges in succ from the directive from to the directive to.
+func reaches(succ map[string][]string, from, to string) bool {
+	seen := make(map[string]bool)
+	stack := append([]string{}, succ[from]...)
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if name == to {
+			return true
+		}
+		if !seen[name] {
+			seen[name] = true
+			stack = append(stack, succ[name]...)
+		}
+	}
+	return false
+}
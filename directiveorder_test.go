@@ -0,0 +1,110 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDirectiveOrder(t *testing.T) {
+	for i, test := range []struct {
+		plugins   map[string]Plugin
+		expect    []string
+		shouldErr string
+	}{
+		{
+			plugins: nil,
+			expect:  []string{"a", "b", "c", "d"},
+		},
+		{
+			plugins: map[string]Plugin{
+				"x": {Before: []string{"c"}},
+				"y": {After: []string{"a"}},
+				"z": {After: []string{"y"}, Before: []string{"b"}},
+			},
+			expect: []string{"a", "y", "z", "b", "x", "c", "d"},
+		},
+		{
+			// the earliest of several Before wins; ties are broken by name
+			plugins: map[string]Plugin{
+				"q": {Before: []string{"d", "b"}},
+				"p": {Before: []string{"b"}},
+				"r": {After: []string{"d"}},
+			},
+			expect: []string{"a", "p", "q", "b", "c", "d", "r"},
+		},
+		{
+			// a listed directive may be constrained too, as long as it holds
+			plugins: map[string]Plugin{
+				"c": {After: []string{"a"}},
+			},
+			expect: []string{"a", "b", "c", "d"},
+		},
+		{
+			plugins: map[string]Plugin{
+				"x": {After: []string{"c"}, Before: []string{"b"}},
+			},
+			shouldErr: "cycle among: b, c, x",
+		},
+		{
+			plugins: map[string]Plugin{
+				"x": {After: []string{"y"}},
+				"y": {After: []string{"x"}},
+			},
+			shouldErr: "cycle among: x, y",
+		},
+		{
+			plugins: map[string]Plugin{
+				"x": {After: []string{"tls"}},
+			},
+			shouldErr: "cannot run after tls",
+		},
+	} {
+		serverType := "ordertest" + string(rune('a'+i))
+		RegisterServerType(serverType, ServerType{
+			Directives: func() []string { return []string{"a", "b", "c", "d"} },
+		})
+		for name, plugin := range test.plugins {
+			plugin.ServerType = serverType
+			plugin.Action = testDirectiveSetup
+			RegisterPlugin(name, plugin)
+		}
+
+		order, err := DirectiveOrder(serverType)
+		if test.shouldErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.shouldErr) {
+				t.Errorf("Test %d: Expected error containing %q, got %v (order %v)", i, test.shouldErr, err, order)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(order, test.expect) {
+			t.Errorf("Test %d: Expected order %v, got %v", i, test.expect, order)
+		}
+		// the result must not depend on registration order
+		for j := 0; j < 5; j++ {
+			again, _ := DirectiveOrder(serverType)
+			if !reflect.DeepEqual(again, order) {
+				t.Errorf("Test %d: Expected the same order every time, got %v then %v", i, order, again)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLoadTimings, if true, causes a summary of how long each
+// phase of loading a config took to be logged after every
+// load, including the slowest directives and sites.
+var LogLoadTimings bool
+
+// LoadTimings records how long it took to load a config,
+// broken down by phase, directive, and server block. It can
+// be used to find out what makes loading a config slow. As
+// JSON, durations are in nanoseconds.
+type LoadTimings struct {
+	// Parse is the time spent lexing and parsing the config.
+	Parse time.Duration `json:"parse"`
+
+	// Inspect is the time the server type spent inspecting
+	// the server blocks before directives were executed.
+	Inspect time.Duration `json:"inspect"`
+
+	// Setup is the time spent executing all directives.
+	Setup time.Duration `json:"setup"`
+
+	// MakeServers is the time the server type spent making
+	// servers out of the executed directives.
+	MakeServers time.Duration `json:"make_servers"`
+
+	// Directives holds the time each directive's setup took
+	// over all server blocks, in the order they were run.
+	Directives []DirectiveTiming `json:"directives"`
+
+	// ServerBlocks holds the total time taken by the setup
+	// of all directives for each server block, by index.
+	ServerBlocks []ServerBlockTiming `json:"server_blocks"`
+
+	mu sync.Mutex // protects ServerBlocks during concurrent setup
+}
+
+// DirectiveTiming is the time taken by setup of a directive.
+type DirectiveTiming struct {
+	Directive string        `json:"directive"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// ServerBlockTiming is the time taken to set up a server block.
+type ServerBlockTiming struct {
+	Keys     []string      `json:"keys"`
+	Duration time.Duration `json:"duration"`
+}
+
+// LoadTimings returns the timings of loading i's config,
+// or nil if i has not been loaded.
+func (i *Instance) LoadTimings() *LoadTimings {
+	return i.loadTimings
+}
+
+// addServerBlockTime adds d to the setup time of server block i.
+func (t *LoadTimings) addServerBlockTime(i int, d time.Duration) {
+	t.mu.Lock()
+	t.ServerBlocks[i].Duration += d
+	t.mu.Unlock()
+}
+
+// Total returns the time taken by all phases combined.
+func (t *LoadTimings) Total() time.Duration {
+	return t.Parse + t.Inspect + t.Setup + t.MakeServers
+}
+
+// SlowestDirectives returns up to n directives, slowest first.
+func (t *LoadTimings) SlowestDirectives(n int) []DirectiveTiming {
+	dirs := make([]DirectiveTiming, len(t.Directives))
+	copy(dirs, t.Directives)
+	sort.SliceStable(dirs, func(i, j int) bool { return dirs[i].Duration > dirs[j].Duration })
+	if len(dirs) > n {
+		dirs = dirs[:n]
+	}
+	return dirs
+}
+
+// SlowestServerBlocks returns up to n server blocks, slowest first.
+func (t *LoadTimings) SlowestServerBlocks(n int) []ServerBlockTiming {
+	blocks := make([]ServerBlockTiming, len(t.ServerBlocks))
+	copy(blocks, t.ServerBlocks)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Duration > blocks[j].Duration })
+	if len(blocks) > n {
+		blocks = blocks[:n]
+	}
+	return blocks
+}
+
+// String summarizes t on a few lines.
+func (t *LoadTimings) String() string {
+	var dirs, blocks []string
+	for _, d := range t.SlowestDirectives(slowestLimit) {
+		dirs = append(dirs, fmt.Sprintf("%s %v", d.Directive, d.Duration))
+	}
+	for _, b := range t.SlowestServerBlocks(slowestLimit) {
+		blocks = append(blocks, fmt.Sprintf("%s %v", strings.Join(b.Keys, " "), b.Duration))
+	}
+	return fmt.Sprintf("Loaded config in %v: parse %v, inspect %v, setup %v, make servers %v\n"+
+		"Slowest directives: %s\nSlowest sites: %s",
+		t.Total(), t.Parse, t.Inspect, t.Setup, t.MakeServers,
+		strings.Join(dirs, ", "), strings.Join(blocks, ", "))
+}
+
+// logLoadTimings logs the load timings of inst if enabled.
+func logLoadTimings(inst *Instance) {
+	if !LogLoadTimings || inst.loadTimings == nil {
+		return
+	}
+	for _, line := range strings.Split(inst.loadTimings.String(), "\n") {
+		log.Printf("[DEBUG] %s", line)
+	}
+}
+
+// slowestLimit is how many of the slowest directives
+// and sites are listed when logging load timings.
+const slowestLimit = 5
@@ -0,0 +1,62 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTimings(t *testing.T) {
+	timings := &LoadTimings{
+		Parse:       1 * time.Millisecond,
+		Inspect:     2 * time.Millisecond,
+		Setup:       30 * time.Millisecond,
+		MakeServers: 4 * time.Millisecond,
+		Directives: []DirectiveTiming{
+			{"root", 1 * time.Millisecond},
+			{"tls", 20 * time.Millisecond},
+			{"proxy", 9 * time.Millisecond},
+		},
+		ServerBlocks: []ServerBlockTiming{
+			{[]string{"a.com"}, 5 * time.Millisecond},
+			{[]string{"b.com", "c.com"}, 25 * time.Millisecond},
+		},
+	}
+
+	if total := timings.Total(); total != 37*time.Millisecond {
+		t.Errorf("Expected total of 37ms, got %v", total)
+	}
+
+	dirs := timings.SlowestDirectives(2)
+	if len(dirs) != 2 || dirs[0].Directive != "tls" || dirs[1].Directive != "proxy" {
+		t.Errorf("Expected tls and proxy to be slowest, got %v", dirs)
+	}
+	blocks := timings.SlowestServerBlocks(5)
+	if len(blocks) != 2 || blocks[0].Keys[0] != "b.com" {
+		t.Errorf("Expected b.com to be slowest, got %v", blocks)
+	}
+	if timings.Directives[0].Directive != "root" {
+		t.Error("Expected sorting not to modify the recorded timings")
+	}
+
+	str := timings.String()
+	for _, expect := range []string{"Loaded config in 37ms", "tls 20ms, proxy 9ms, root 1ms", "b.com c.com 25ms, a.com 5ms"} {
+		if !strings.Contains(str, expect) {
+			t.Errorf("Expected summary to contain %q, got: %s", expect, str)
+		}
+	}
+}
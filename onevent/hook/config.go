@@ -14,7 +14,11 @@ type Config struct {
 
 // SupportedEvents is a map of supported events.
 var SupportedEvents = map[string]caddy.EventName{
-	"startup":   caddy.InstanceStartupEvent,
-	"shutdown":  caddy.ShutdownEvent,
-	"certrenew": caddy.CertRenewEvent,
+	"startup":      caddy.InstanceStartupEvent,
+	"shutdown":     caddy.ShutdownEvent,
+	"certrenew":    caddy.CertRenewEvent,
+	"certobtain":   caddy.CertObtainEvent,
+	"upstreamdown": caddy.UpstreamDownEvent,
+	"upstreamup":   caddy.UpstreamUpEvent,
+	"reloadfailed": caddy.ReloadFailedEvent,
 }
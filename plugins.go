@@ -18,8 +18,12 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"reflect"
+	"runtime"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mholt/caddy/caddyfile"
 )
@@ -139,11 +143,106 @@ func ListPlugins() map[string][]string {
 // more helpful error messages, like "did you mean ..." or
 // "maybe you need to plug in ...".
 func ValidDirectives(serverType string) []string {
-	stype, err := getServerType(serverType)
+	dirs, err := DirectiveOrder(serverType)
 	if err != nil {
-		return nil
+		// the error is reported when the directives are executed
+		stype, err := getServerType(serverType)
+		if err != nil {
+			return nil
+		}
+		return stype.Directives()
+	}
+	return dirs
+}
+
+// DirectiveInfo describes a directive of a server type.
+type DirectiveInfo struct {
+	Name string
+
+	// Package is the import path of the package with the
+	// directive's action, or empty if it is not plugged in
+	Package string
+
+	// Listed is false for directives that are plugged in,
+	// but not in the server type's list of directives, so
+	// they are not recognized in the Caddyfile
+	Listed bool
+}
+
+// ListDirectives returns the directives of server type
+// serverType in the order they are executed, followed by
+// those that are plugged in but not listed by the server
+// type, in alphabetical order.
+func ListDirectives(serverType string) ([]DirectiveInfo, error) {
+	dirs, err := DirectiveOrder(serverType)
+	if err != nil {
+		return nil, err
+	}
+	var infos []DirectiveInfo
+	listed := make(map[string]bool)
+	for _, dir := range dirs {
+		info := DirectiveInfo{Name: dir, Listed: true}
+		if action, err := DirectiveAction(serverType, dir); err == nil && action != nil {
+			info.Package = funcPackage(action)
+		}
+		infos = append(infos, info)
+		listed[dir] = true
+	}
+	var unlisted []DirectiveInfo
+	for name, plugin := range plugins[serverType] {
+		if !listed[name] && plugin.Action != nil {
+			unlisted = append(unlisted, DirectiveInfo{Name: name, Package: funcPackage(plugin.Action)})
+		}
+	}
+	sort.Slice(unlisted, func(i, j int) bool { return unlisted[i].Name < unlisted[j].Name })
+	return append(infos, unlisted...), nil
+}
+
+// DescribeDirectives returns a string describing the
+// directives of server type serverType and where they
+// come from.
+func DescribeDirectives(serverType string) (string, error) {
+	infos, err := ListDirectives(serverType)
+	if err != nil {
+		return "", err
+	}
+	var width int
+	for _, info := range infos {
+		if len(info.Name) > width {
+			width = len(info.Name)
+		}
+	}
+	str := "Directives of server type " + serverType + ", in order of execution:\n"
+	var hadUnlisted bool
+	for _, info := range infos {
+		if !info.Listed && !hadUnlisted {
+			str += "\nPlugged in, but not in the list of directives (so not recognized):\n"
+			hadUnlisted = true
+		}
+		pkg := info.Package
+		if pkg == "" {
+			pkg = "(not plugged in)"
+		}
+		str += fmt.Sprintf("  %-*s  %s\n", width, info.Name, pkg)
 	}
-	return stype.Directives()
+	return str, nil
+}
+
+// funcPackage returns the import path of the package
+// that defines fn.
+func funcPackage(fn SetupFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	// names are like example.com/pkg.setup or
+	// example.com/pkg.(*T).method or example.com/pkg.init.func1
+	name := f.Name()
+	lastSlash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[lastSlash+1:], "."); dot >= 0 {
+		return name[:lastSlash+1+dot]
+	}
+	return name
 }
 
 // ServerListener pairs a server to its listener and/or packetconn.
@@ -198,6 +297,43 @@ type Context interface {
 	MakeServers() ([]Server, error)
 }
 
+// SiteDescriber is an optional interface a Context may
+// implement to report which sites it would serve on which
+// listener addresses, without obtaining certificates or
+// making servers. It is used for diagnostics.
+type SiteDescriber interface {
+	// DescribeSites returns the addresses of the sites,
+	// keyed by the listener address they are served on.
+	DescribeSites() (map[string][]string, error)
+}
+
+// SetupObserver is an optional interface a Context may
+// implement to be told each time the action of a directive
+// has set up a server block key, for instance to record
+// which directives configured what.
+type SetupObserver interface {
+	// DirectiveSetUp is called with the controller
+	// after the directive's action returned without
+	// error. It may be called concurrently for
+	// different server blocks.
+	DirectiveSetUp(*Controller)
+}
+
+// ServerBlockReuser is an optional interface a Context may
+// implement to take over the server blocks that a restart
+// leaves unchanged from the instance being replaced, instead
+// of setting them up again, so that whatever their directives
+// set up keeps its state across the restart.
+type ServerBlockReuser interface {
+	// ReuseServerBlocks is called after InspectServerBlocks
+	// with the unchanged blocks and the Context of the old
+	// instance. It returns the blocks it took over; their
+	// directives are not executed again, and the callbacks
+	// their setup registered move to the new instance once it
+	// has started. The other blocks are set up as usual.
+	ReuseServerBlocks(old Context, sblocks []caddyfile.ServerBlock) []caddyfile.ServerBlock
+}
+
 // RegisterServerType registers a server type srv by its
 // name, typeName.
 func RegisterServerType(typeName string, srv ServerType) {
@@ -240,6 +376,19 @@ type Plugin struct {
 	// Action is the plugin's setup function, if associated
 	// with a directive in the Caddyfile.
 	Action SetupFunc
+
+	// Concurrent indicates that Action may be run for
+	// different server blocks at the same time. Set it
+	// only if Action touches no state shared between
+	// server blocks other than through the Controller;
+	// this speeds up loading configs with many sites.
+	Concurrent bool
+
+	// After and Before name directives whose actions must
+	// run before and after this plugin's, respectively. With
+	// them, a directive that is not in its server type's list
+	// is put in order among the others; see DirectiveOrder.
+	After, Before []string
 }
 
 // RegisterPlugin plugs in plugin. All plugins should register
@@ -269,23 +418,54 @@ type EventName string
 
 // Define names for the various events
 const (
-	StartupEvent         EventName = "startup"
-	ShutdownEvent                  = "shutdown"
-	CertRenewEvent                 = "certrenew"
-	InstanceStartupEvent           = "instancestartup"
-	InstanceRestartEvent           = "instancerestart"
+	StartupEvent          EventName = "startup"
+	ShutdownEvent                   = "shutdown"
+	CertRenewEvent                  = "certrenew"
+	CertObtainEvent                 = "certobtain"
+	InstanceStartupEvent            = "instancestartup"
+	InstanceRestartEvent            = "instancerestart"
+	InstanceShutdownEvent           = "instanceshutdown"
+	ReloadFailedEvent               = "reloadfailed"
+	ConfigLoadEvent                 = "configload"
+	UpstreamDownEvent               = "upstreamdown"
+	UpstreamUpEvent                 = "upstreamup"
 )
 
 // EventHook is a type which holds information about a startup hook plugin.
+//
+// The info passed with each event is:
+//
+//	StartupEvent, InstanceRestartEvent: nil
+//	ShutdownEvent: the name of the signal (string)
+//	CertRenewEvent, CertObtainEvent: the certificate's name (string)
+//	InstanceStartupEvent, InstanceShutdownEvent: the *Instance
+//	ConfigLoadEvent: the Caddyfile Input that was loaded
+//	ReloadFailedEvent: the error the reload failed with
+//	UpstreamDownEvent, UpstreamUpEvent: the upstream's address (string)
 type EventHook func(eventType EventName, eventInfo interface{}) error
 
+// eventHook is an event hook and whether it was
+// registered by a directive of the running config.
+type eventHook struct {
+	hook       EventHook
+	fromConfig bool
+}
+
+// settingUp is nonzero while directives are executed, so
+// that the event hooks they register can be told apart from
+// the hooks of plugins, which must outlive reloads.
+var settingUp int32
+
 // RegisterEventHook plugs in hook. All the hooks should register themselves
-// and they must have a name.
+// and they must have a name. Hooks registered by directives while a config
+// is loading are dropped when it is reloaded, since the new config registers
+// its own; hooks registered otherwise, as from init, stay for good.
 func RegisterEventHook(name string, hook EventHook) {
 	if name == "" {
 		panic("event hook must have a name")
 	}
-	_, dup := eventHooks.LoadOrStore(name, hook)
+	fromConfig := atomic.LoadInt32(&settingUp) > 0
+	_, dup := eventHooks.LoadOrStore(name, eventHook{hook: hook, fromConfig: fromConfig})
 	if dup {
 		panic("hook named " + name + " already registered")
 	}
@@ -296,7 +476,7 @@ func RegisterEventHook(name string, hook EventHook) {
 // use 'go' keyword if they don't want to block Caddy.
 func EmitEvent(event EventName, info interface{}) {
 	eventHooks.Range(func(k, v interface{}) bool {
-		err := v.(EventHook)(event, info)
+		err := v.(eventHook).hook(event, info)
 		if err != nil {
 			log.Printf("error on '%s' hook: %v", k.(string), err)
 		}
@@ -314,10 +494,13 @@ func cloneEventHooks() *sync.Map {
 	return c
 }
 
-// purgeEventHooks purges all event hooks from the map
+// purgeEventHooks purges the event hooks registered by
+// directives from the map
 func purgeEventHooks() {
-	eventHooks.Range(func(k, _ interface{}) bool {
-		eventHooks.Delete(k)
+	eventHooks.Range(func(k, v interface{}) bool {
+		if v.(eventHook).fromConfig {
+			eventHooks.Delete(k)
+		}
 		return true
 	})
 }
@@ -370,6 +553,19 @@ func DirectiveAction(serverType, dir string) (SetupFunc, error) {
 		dir, serverType)
 }
 
+// directiveIsConcurrent returns true if the action of
+// directive dir of server type serverType may be run
+// for several server blocks concurrently.
+func directiveIsConcurrent(serverType, dir string) bool {
+	if plugin, ok := plugins[serverType][dir]; ok {
+		return plugin.Concurrent
+	}
+	if plugin, ok := plugins[""][dir]; ok {
+		return plugin.Concurrent
+	}
+	return false
+}
+
 // Loader is a type that can load a Caddyfile.
 // It is passed the name of the server type.
 // It returns an error only if something went
@@ -0,0 +1,319 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// reloadMu serializes reloads, which may be triggered
+// by signals and by watching the Caddyfile at once.
+var reloadMu sync.Mutex
+
+// Reload loads the Caddyfile again with the loader that
+// loaded it first and restarts the current instance with
+// it. If the Caddyfile doesn't load, the instance keeps
+// running with the one it has. The same goes if it loads but
+// fails to start, for example because a site can't listen;
+// ReloadFailedEvent is emitted then. It returns the Caddyfile
+// the instance runs with when the reload succeeds.
+func Reload() (Input, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	// Start with the existing Caddyfile
+	caddyfileToUse, inst, err := getCurrentCaddyfile()
+	if err != nil {
+		return nil, err
+	}
+	if loaderUsed.loader == nil {
+		// This also should never happen
+		return nil, fmt.Errorf("no Caddyfile loader with which to reload Caddyfile")
+	}
+
+	// Load the updated Caddyfile
+	newCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
+	if err != nil {
+		return nil, fmt.Errorf("loading updated Caddyfile: %v", err)
+	}
+	if newCaddyfile != nil {
+		caddyfileToUse = newCaddyfile
+	}
+
+	if _, err := restartWith(inst, caddyfileToUse); err != nil {
+		return nil, err
+	}
+	return caddyfileToUse, nil
+}
+
+// ReloadWith restarts the current instance with cdyfile, the
+// same way Reload does with the Caddyfile it loads, and
+// returns how the server blocks changed.
+func ReloadWith(cdyfile Input) (*ServerBlockChanges, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	_, inst, err := getCurrentCaddyfile()
+	if inst == nil {
+		return nil, err
+	}
+	if cdyfile.ServerType() != inst.serverType {
+		return nil, fmt.Errorf("server type %s does not match the running %s server", cdyfile.ServerType(), inst.serverType)
+	}
+	newInst, err := restartWith(inst, cdyfile)
+	if err != nil {
+		return nil, err
+	}
+	return newInst.changes, nil
+}
+
+// restartWith restarts inst with cdyfile. The event hooks that
+// directives registered are dropped, since the new config
+// registers its own, and restored if the restart fails.
+func restartWith(inst *Instance, cdyfile Input) (*Instance, error) {
+	// Backup old event hooks
+	oldEventHooks := cloneEventHooks()
+
+	// Purge the old event hooks
+	purgeEventHooks()
+
+	// Kick off the restart; our work is done
+	EmitEvent(InstanceRestartEvent, nil)
+	newInst, err := inst.Restart(cdyfile)
+	if err != nil {
+		restoreEventHooks(oldEventHooks)
+		EmitEvent(ReloadFailedEvent, err)
+		return nil, err
+	}
+	return newInst, nil
+}
+
+// ServerBlockChanges describes how a restart changed the
+// server blocks of the Caddyfile. Each block is listed by its
+// keys, and each list is sorted.
+type ServerBlockChanges struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+
+	// Unchanged blocks are either Reused, which means the
+	// new instance took them over as they were set up, or
+	// set up again, for instance since they use TLS.
+	Unchanged []string `json:"unchanged"`
+	Reused    []string `json:"reused"`
+}
+
+// serverBlockChanges compares the server blocks of the old and
+// the new instance; reused are the keys of the blocks the new
+// instance took over.
+func serverBlockChanges(oldBlocks, newBlocks []caddyfile.ServerBlock, reused []string) *ServerBlockChanges {
+	added, changed, removed, unchanged := diffServerBlocks(oldBlocks, newBlocks)
+	reused = append([]string(nil), reused...)
+	sort.Strings(reused)
+	return &ServerBlockChanges{
+		Added:     added,
+		Changed:   changed,
+		Removed:   removed,
+		Unchanged: unchanged,
+		Reused:    reused,
+	}
+}
+
+// reuseServerBlocks lets the context of inst take over the
+// blocks in sblocks that are unchanged since the instance that
+// inst replaces, and returns the blocks that still have to be
+// set up. The setup of each block taken over comes along with
+// it, but its callbacks run for inst only once it owns them.
+func reuseServerBlocks(inst *Instance, sblocks []caddyfile.ServerBlock) []caddyfile.ServerBlock {
+	prev := inst.previous
+	reuser, ok := inst.context.(ServerBlockReuser)
+	if prev == nil || prev.context == nil || !ok {
+		return sblocks
+	}
+
+	_, _, _, unchanged := diffServerBlocks(prev.serverBlocks, sblocks)
+	isUnchanged := make(map[string]bool, len(unchanged))
+	for _, key := range unchanged {
+		isUnchanged[key] = true
+	}
+	var candidates []caddyfile.ServerBlock
+	for _, sb := range sblocks {
+		if isUnchanged[strings.Join(sb.Keys, " ")] {
+			candidates = append(candidates, sb)
+		}
+	}
+	if len(candidates) == 0 {
+		return sblocks
+	}
+
+	taken := make(map[string]bool)
+	for _, sb := range reuser.ReuseServerBlocks(prev.context, candidates) {
+		key := strings.Join(sb.Keys, " ")
+		taken[key] = true
+		inst.reused = append(inst.reused, key)
+		if setup, ok := prev.blockSetups[key]; ok {
+			if inst.blockSetups == nil {
+				inst.blockSetups = make(map[string]*serverBlockSetup)
+			}
+			inst.blockSetups[key] = setup
+			setup.handTo(inst)
+		}
+	}
+
+	var rest []caddyfile.ServerBlock
+	for _, sb := range sblocks {
+		if !taken[strings.Join(sb.Keys, " ")] {
+			rest = append(rest, sb)
+		}
+	}
+	return rest
+}
+
+// serverBlockSetup holds the callbacks that setting up a server
+// block registered. They are added to each instance that uses
+// the block, but only run for the one that owns it: the one that
+// set it up, until a restart takes the block over successfully.
+type serverBlockSetup struct {
+	mu    sync.Mutex
+	owner *Instance
+	cb    callbacks
+}
+
+// blockSetup returns the setup of sb in i, making it if need be.
+func (i *Instance) blockSetup(sb caddyfile.ServerBlock) *serverBlockSetup {
+	key := strings.Join(sb.Keys, " ")
+	if i.blockSetups == nil {
+		i.blockSetups = make(map[string]*serverBlockSetup)
+	}
+	setup, ok := i.blockSetups[key]
+	if !ok {
+		setup = &serverBlockSetup{owner: i}
+		i.blockSetups[key] = setup
+	}
+	return setup
+}
+
+// register adds cb, which setting up the block in inst
+// registered, to the callbacks of the block and of inst.
+func (s *serverBlockSetup) register(inst *Instance, cb callbacks) {
+	s.cb.firstStartup = append(s.cb.firstStartup, cb.firstStartup...)
+	s.cb.startup = append(s.cb.startup, cb.startup...)
+	s.cb.restart = append(s.cb.restart, cb.restart...)
+	s.cb.restartFailed = append(s.cb.restartFailed, cb.restartFailed...)
+	s.cb.shutdown = append(s.cb.shutdown, cb.shutdown...)
+	s.cb.finalShutdown = append(s.cb.finalShutdown, cb.finalShutdown...)
+	s.guard(inst, cb).addTo(inst)
+}
+
+// handTo adds the callbacks of the block to inst, which takes
+// the block over. The startup callbacks are left out, since
+// whatever they started keeps running.
+func (s *serverBlockSetup) handTo(inst *Instance) {
+	s.guard(inst, callbacks{
+		restart:       s.cb.restart,
+		restartFailed: s.cb.restartFailed,
+		shutdown:      s.cb.shutdown,
+		finalShutdown: s.cb.finalShutdown,
+	}).addTo(inst)
+}
+
+// guard returns cb with each callback wrapped so that it does
+// nothing unless inst owns the block.
+func (s *serverBlockSetup) guard(inst *Instance, cb callbacks) *callbacks {
+	wrap := func(fns []func() error) []func() error {
+		var guarded []func() error
+		for _, fn := range fns {
+			fn := fn
+			guarded = append(guarded, func() error {
+				if !s.ownedBy(inst) {
+					return nil
+				}
+				return fn()
+			})
+		}
+		return guarded
+	}
+	return &callbacks{
+		firstStartup:  wrap(cb.firstStartup),
+		startup:       wrap(cb.startup),
+		restart:       wrap(cb.restart),
+		restartFailed: wrap(cb.restartFailed),
+		shutdown:      wrap(cb.shutdown),
+		finalShutdown: wrap(cb.finalShutdown),
+	}
+}
+
+func (s *serverBlockSetup) ownedBy(inst *Instance) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owner == inst
+}
+
+func (s *serverBlockSetup) setOwner(inst *Instance) {
+	s.mu.Lock()
+	s.owner = inst
+	s.mu.Unlock()
+}
+
+// diffServerBlocks compares the server blocks of two Caddyfiles
+// by their keys and returns the keys of the blocks that are only
+// in newBlocks, in both but with different tokens, only in
+// oldBlocks, and in both with the same tokens. Each list is sorted.
+func diffServerBlocks(oldBlocks, newBlocks []caddyfile.ServerBlock) (added, changed, removed, unchanged []string) {
+	oldByKey := make(map[string]map[string][]string, len(oldBlocks))
+	for _, sb := range oldBlocks {
+		oldByKey[strings.Join(sb.Keys, " ")] = tokenTexts(sb)
+	}
+	for _, sb := range newBlocks {
+		key := strings.Join(sb.Keys, " ")
+		oldTokens, ok := oldByKey[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case reflect.DeepEqual(oldTokens, tokenTexts(sb)):
+			unchanged = append(unchanged, key)
+		default:
+			changed = append(changed, key)
+		}
+		delete(oldByKey, key)
+	}
+	for key := range oldByKey {
+		removed = append(removed, key)
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	sort.Strings(unchanged)
+	return
+}
+
+// tokenTexts returns the text of the tokens of sb by directive,
+// leaving out where they are in the file, which may move without
+// the block changing.
+func tokenTexts(sb caddyfile.ServerBlock) map[string][]string {
+	texts := make(map[string][]string, len(sb.Tokens))
+	for dir, tokens := range sb.Tokens {
+		for _, token := range tokens {
+			texts[dir] = append(texts[dir], token.Text)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 Light Code Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestDiffServerBlocks(t *testing.T) {
+	parse := func(input string) []caddyfile.ServerBlock {
+		sblocks, err := caddyfile.Parse("Caddyfile", strings.NewReader(input), []string{"root", "gzip", "proxy"})
+		if err != nil {
+			t.Fatalf("Parsing %q: %v", input, err)
+		}
+		return sblocks
+	}
+	oldBlocks := parse(`a.com {
+		root /www/a
+	}
+	b.com {
+		root /www/b
+	}
+	c.com {
+		proxy / localhost:3000
+	}`)
+	newBlocks := parse(`
+
+	a.com {
+		root   /www/a
+	}
+	b.com {
+		root /www/b
+		gzip
+	}
+	d.com d2.com {
+		proxy / localhost:4000
+	}`)
+
+	added, changed, removed, unchanged := diffServerBlocks(oldBlocks, newBlocks)
+	for _, test := range []struct {
+		name           string
+		actual, expect []string
+	}{
+		{"added", added, []string{"d.com d2.com"}},
+		{"changed", changed, []string{"b.com"}},
+		{"removed", removed, []string{"c.com"}},
+		{"unchanged", unchanged, []string{"a.com"}},
+	} {
+		if !reflect.DeepEqual(test.actual, test.expect) {
+			t.Errorf("Expected %s %v, got %v", test.name, test.expect, test.actual)
+		}
+	}
+}
+
+// reuseTestContext takes over every unchanged
+// server block it is offered, unless fail is set.
+type reuseTestContext struct {
+	fail bool
+}
+
+func (h *reuseTestContext) InspectServerBlocks(name string, sblocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblocks, nil
+}
+func (h *reuseTestContext) MakeServers() ([]Server, error) {
+	if h.fail {
+		return nil, fmt.Errorf("MakeServers failed")
+	}
+	return nil, nil
+}
+func (h *reuseTestContext) ReuseServerBlocks(old Context, sblocks []caddyfile.ServerBlock) []caddyfile.ServerBlock {
+	return sblocks
+}
+
+func TestRestartReusesServerBlocks(t *testing.T) {
+	const serverType = "reusetest"
+	failing := false
+	RegisterServerType(serverType, ServerType{
+		Directives: func() []string { return []string{"reusetest"} },
+		NewContext: func(inst *Instance) Context { return &reuseTestContext{fail: failing} },
+	})
+	setups := make(map[string]int)
+	var shutdowns []string
+	RegisterPlugin("reusetest", Plugin{
+		ServerType: serverType,
+		Action: func(c *Controller) error {
+			key := c.Key
+			setups[key]++
+			c.OnShutdown(func() error {
+				shutdowns = append(shutdowns, key)
+				return nil
+			})
+			return nil
+		},
+	})
+	runShutdown := func(inst *Instance) {
+		shutdowns = nil
+		for _, fn := range inst.OnShutdown {
+			fn()
+		}
+		sort.Strings(shutdowns)
+	}
+
+	oldInst := &Instance{serverType: serverType, wg: new(sync.WaitGroup), Storage: make(map[interface{}]interface{})}
+	err := startWithListenerFds(CaddyfileInput{Contents: []byte("a {\nreusetest 1\n}\nb {\nreusetest 1\n}"), ServerTypeName: serverType}, oldInst, nil)
+	if err != nil {
+		t.Fatalf("Expected no error starting, got: %v", err)
+	}
+	defer oldInst.Stop()
+	newCaddyfile := CaddyfileInput{Contents: []byte("a {\nreusetest 1\n}\nb {\nreusetest 2\n}"), ServerTypeName: serverType}
+
+	// a failed restart leaves the blocks to the old instance
+	failing = true
+	if _, err := oldInst.Restart(newCaddyfile); err == nil {
+		t.Fatal("Expected restart to fail")
+	}
+	failing = false
+	runShutdown(oldInst)
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(shutdowns, expected) {
+		t.Errorf("Expected shutdown callbacks of the old instance %v after a failed restart, got %v", expected, shutdowns)
+	}
+
+	newInst, err := oldInst.Restart(newCaddyfile)
+	if err != nil {
+		t.Fatalf("Expected no error restarting, got: %v", err)
+	}
+	defer newInst.Stop()
+	if expected := map[string]int{"a": 1, "b": 3}; !reflect.DeepEqual(setups, expected) {
+		t.Errorf("Expected setups %v, got %v", expected, setups)
+	}
+	if expected := []string{"a"}; !reflect.DeepEqual(newInst.changes.Reused, expected) ||
+		!reflect.DeepEqual(newInst.changes.Changed, []string{"b"}) {
+		t.Errorf("Expected a to be reused and b to be changed, got %+v", newInst.changes)
+	}
+
+	runShutdown(oldInst)
+	if expected := []string{"b"}; !reflect.DeepEqual(shutdowns, expected) {
+		t.Errorf("Expected shutdown callbacks of the old instance %v, got %v", expected, shutdowns)
+	}
+	runShutdown(newInst)
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(shutdowns, expected) {
+		t.Errorf("Expected shutdown callbacks of the new instance %v, got %v", expected, shutdowns)
+	}
+}
@@ -16,7 +16,19 @@
 
 package caddy
 
+import (
+	"fmt"
+	"runtime"
+)
+
 // checkFdlimit issues a warning if the OS limit for
 // max file descriptors is below a recommended minimum.
 func checkFdlimit() {
 }
+
+// FileDescriptorLimit returns the soft and hard OS limits
+// for the number of open file descriptors, which are not
+// available on this platform.
+func FileDescriptorLimit() (cur, max uint64, err error) {
+	return 0, 0, fmt.Errorf("file descriptor limits are not available on %s", runtime.GOOS)
+}
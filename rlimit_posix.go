@@ -35,3 +35,14 @@ func checkFdlimit() {
 	}
 
 }
+
+// FileDescriptorLimit returns the soft and hard OS limits
+// for the number of open file descriptors.
+func FileDescriptorLimit() (cur, max uint64, err error) {
+	rlimit := &syscall.Rlimit{}
+	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, rlimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(rlimit.Cur), uint64(rlimit.Max), nil
+}
@@ -61,40 +61,7 @@ func trapSignalsPosix() {
 				log.Println("[INFO] SIGUSR1: Reloading")
 				go telemetry.AppendUnique("sigtrap", "SIGUSR1")
 
-				// Start with the existing Caddyfile
-				caddyfileToUse, inst, err := getCurrentCaddyfile()
-				if err != nil {
-					log.Printf("[ERROR] SIGUSR1: %v", err)
-					continue
-				}
-				if loaderUsed.loader == nil {
-					// This also should never happen
-					log.Println("[ERROR] SIGUSR1: no Caddyfile loader with which to reload Caddyfile")
-					continue
-				}
-
-				// Load the updated Caddyfile
-				newCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
-				if err != nil {
-					log.Printf("[ERROR] SIGUSR1: loading updated Caddyfile: %v", err)
-					continue
-				}
-				if newCaddyfile != nil {
-					caddyfileToUse = newCaddyfile
-				}
-
-				// Backup old event hooks
-				oldEventHooks := cloneEventHooks()
-
-				// Purge the old event hooks
-				purgeEventHooks()
-
-				// Kick off the restart; our work is done
-				EmitEvent(InstanceRestartEvent, nil)
-				_, err = inst.Restart(caddyfileToUse)
-				if err != nil {
-					restoreEventHooks(oldEventHooks)
-
+				if _, err := Reload(); err != nil {
 					log.Printf("[ERROR] SIGUSR1: %v", err)
 				}
 